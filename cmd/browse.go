@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"pam/internal/inventory"
+	"pam/internal/lockfile"
+	"pam/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var browseScan bool
+
+func browse(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+
+	// The same packages as pam list
+	var entries []inventory.Entry
+	if !lock.Empty() && !browseScan {
+		entries = inventory.FromLock(cfg.FlakePath, lock, hostDirs)
+	} else {
+		entries, err = inventory.Collect(modulesDir, hostsDir, cfg.Namespace(), hostDirs, cfg.AppsFiles())
+		if err != nil {
+			printError("Failed to list packages: ", err)
+			return
+		}
+	}
+
+	action, err := ui.ExploreFlake(hostDirs, entries)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if action == nil {
+		return
+	}
+
+	// The action runs as its own command, so its prompts, history entry and commit are
+	// those of pam enable, disable or uninstall
+	switch action.Verb {
+	case ui.ExploreEnable, ui.ExploreDisable:
+		command := enableCmd
+		if action.Verb == ui.ExploreDisable {
+			command = disableCmd
+		}
+		toggleHostFlags = []string{action.Host}
+		command.Flags().Lookup("host").Changed = true
+		command.SetContext(cmd.Context())
+		command.Run(command, []string{action.Package})
+	case ui.ExploreUninstall:
+		uninstallCmd.SetContext(cmd.Context())
+		uninstallCmd.Run(uninstallCmd, []string{action.Package})
+	}
+}
+
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Explore the hosts, categories and modules of the flake",
+	Long:  "Show the hosts of the flake next to a tree of its categories and modules, marking the modules the highlighted host enables. e, d and u enable, disable or uninstall the highlighted module like pam enable, pam disable and pam uninstall do.",
+	Args:  cobra.NoArgs,
+	Run:   browse,
+}
+
+func init() {
+	rootCmd.AddCommand(browseCmd)
+	browseCmd.Flags().BoolVar(&browseScan, "scan", false, "Read the module and host files instead of pam.lock.json, to include modules pam didn't install")
+}
@@ -0,0 +1,473 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"pam/internal"
+	"pam/internal/assets"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/nixconfig"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	categoryHostFlags  []string
+	categoryDefaultNix bool
+	categoryForce      bool
+	categoryYes        bool
+)
+
+// categoryPattern matches names usable as an attribute in the apps section
+var categoryPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+
+// validCategory checks every / separated name of a category, e.g. dev/editors
+func validCategory(name string) error {
+	for _, segment := range strings.Split(name, "/") {
+		if !categoryPattern.MatchString(segment) {
+			return fmt.Errorf("%q is not a valid category name, use letters, digits, - and _ separated by /", name)
+		}
+	}
+	return nil
+}
+
+// editHosts applies edit to the apps file of every host that has one, returning the changes
+// without writing them
+func editHosts(cfg *internal.Config, hostNames []string, edit func(nixcfg *nixconfig.Config) error) ([]diff.Change, []string, error) {
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	var changes []diff.Change
+	var changedHosts []string
+	for _, host := range hostNames {
+		appsFilePath := hosts.AppsFile(hostsDir, host, cfg.AppsFiles())
+		if _, err := os.Stat(appsFilePath); err != nil {
+			continue
+		}
+		change, err := hosts.Edit(appsFilePath, func(nixcfg *nixconfig.Config) error {
+			nixcfg.SetNamespace(cfg.Namespace())
+			return edit(nixcfg)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if change.Old != change.New {
+			changes = append(changes, change)
+			changedHosts = append(changedHosts, host)
+		}
+	}
+	return changes, changedHosts, nil
+}
+
+func categoryList(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	categories, err := modules.Categories(filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir))
+	if err != nil {
+		printError("Failed to read module directory: ", err)
+		return
+	}
+	if jsonOutput() {
+		if categories == nil {
+			categories = []modules.Category{}
+		}
+		printJSON(categories)
+		return
+	}
+	if len(categories) == 0 {
+		fmt.Println("No categories yet, create one with pam category add")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CATEGORY\tPACKAGES")
+	for _, category := range categories {
+		fmt.Fprintf(w, "%s\t%d\n", category.Name, category.Packages)
+	}
+	w.Flush()
+}
+
+func categoryAdd(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	name := args[0]
+	if err := validCategory(name); err != nil {
+		printError("Error: ", err)
+		return
+	}
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+	dir := filepath.Join(modulesDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		failf("Error: category %s already exists\n", name)
+		return
+	}
+
+	hostDirs, err := ui.GetDirNames(filepath.Join(cfg.FlakePath, cfg.DefaultHostDir))
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	groups := cfg.HostGroupsOf(hostDirs)
+	selectedHosts, err := internal.ExpandHosts(categoryHostFlags, groups)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	for _, host := range selectedHosts {
+		if !slices.Contains(hostDirs, host) {
+			failf("Error: unknown host %s, available hosts: %s\n", host, strings.Join(hostDirs, ", "))
+			return
+		}
+	}
+	if len(selectedHosts) == 0 && !categoryYes && len(hostDirs) > 0 {
+		err = huh.NewMultiSelect[string]().
+			Title(fmt.Sprintf("Add %s to the apps section of which hosts?", name)).
+			Description("Space to toggle, Enter to confirm, none to only create the folder").
+			Options(hostOptionsWithGroups(groups, hostDirs)...).
+			Value(&selectedHosts).
+			Run()
+		if err == nil {
+			selectedHosts, err = internal.ExpandHosts(selectedHosts, groups)
+		}
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+
+	changes, changedHosts, err := editHosts(cfg, selectedHosts, func(nixcfg *nixconfig.Config) error {
+		_, err := nixcfg.EnsureCategory(name)
+		return err
+	})
+	if err != nil {
+		printError("Error updating host config: ", err)
+		return
+	}
+	// A default.nix listing its folders has to import the new one
+	imports := modules.NewImports(modulesDir)
+	err = imports.AddFolder(dir)
+	if err != nil {
+		printError("Could not read default.nix: ", err)
+		return
+	}
+	defaultNix := filepath.Join(dir, modules.DefaultNix)
+	for _, change := range imports.Changes() {
+		if change.Path != defaultNix || !categoryDefaultNix {
+			changes = append(changes, change)
+		}
+	}
+	if categoryDefaultNix {
+		content, err := assets.ScaffoldFile("modules.nix", nil)
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		changes = append(changes, diff.Change{Path: defaultNix, New: content})
+	}
+
+	snapshot := beginBackup("category add " + name)
+	defer commitBackup(snapshot)
+	for _, change := range changes {
+		if err := backupFile(snapshot, change.Path); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	err = os.MkdirAll(dir, 0o755)
+	if err == nil {
+		err = diff.Apply(changes)
+	}
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, changes)
+
+	slog.Info("Created " + dir)
+	for _, host := range changedHosts {
+		slog.Info(fmt.Sprintf("Added %s to %s", name, host))
+	}
+	// git doesn't track empty folders, so only the files are committed
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage("add category "+name, changedHosts)
+	autoCommit(cfg, message, changedPaths(changes))
+	recordOperation(cmd, message, []string{name})
+}
+
+func categoryRename(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	name, newName := args[0], args[1]
+	for _, category := range args {
+		if err := validCategory(category); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+	dir, newDir := filepath.Join(modulesDir, name), filepath.Join(modulesDir, newName)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		failf("Error: no category %s in %s\n", name, modulesDir)
+		return
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		failf("Error: category %s already exists\n", newName)
+		return
+	}
+	if path.Dir(name) != path.Dir(newName) {
+		failf("Error: %s can only be renamed within %s, not moved to %s\n", name, path.Dir(name), path.Dir(newName))
+		return
+	}
+
+	hostDirs, err := ui.GetDirNames(filepath.Join(cfg.FlakePath, cfg.DefaultHostDir))
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	changes, changedHosts, err := editHosts(cfg, hostDirs, func(nixcfg *nixconfig.Config) error {
+		_, err := nixcfg.RenameCategory(name, newName)
+		return err
+	})
+	if err != nil {
+		printError("Error updating host config: ", err)
+		return
+	}
+	imports := modules.NewImports(modulesDir)
+	err = imports.Rename(dir, newDir)
+	if err != nil {
+		printError("Could not read default.nix: ", err)
+		return
+	}
+	changes = append(changes, imports.Changes()...)
+
+	// The modules derive their option path from their folder, so moving them is all they need
+	var moved []string
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		moved = append(moved, path, filepath.Join(newDir, rel))
+		return nil
+	})
+	if err != nil {
+		printError("Failed to read category: ", err)
+		return
+	}
+
+	snapshot := beginBackup(fmt.Sprintf("category rename %s %s", name, newName))
+	defer commitBackup(snapshot)
+	for _, path := range append(slices.Clone(moved), changedPaths(changes)...) {
+		if err := backupFile(snapshot, path); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	err = os.Rename(dir, newDir)
+	if err != nil {
+		printError("Could not move category: ", err)
+		return
+	}
+	err = diff.Apply(changes)
+	if err != nil {
+		// Keep the folder and the hosts in agreement
+		os.Rename(newDir, dir)
+		printError("Error updating host config: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, changes)
+
+	slog.Info(fmt.Sprintf("Moved %s to %s", dir, newDir))
+	for _, host := range changedHosts {
+		slog.Info(fmt.Sprintf("Renamed %s to %s in %s", name, newName, host))
+	}
+	lockPaths := updateLock(cfg, snapshot, func(lock *lockfile.Lock) {
+		lock.RenameCategory(name, newName)
+	})
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage(fmt.Sprintf("rename category %s to %s", name, newName), changedHosts)
+	autoCommit(cfg, message, append(append(moved, changedPaths(changes)...), lockPaths...))
+	recordOperation(cmd, message, []string{name, newName})
+}
+
+func categoryRemove(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	name := args[0]
+	if err := validCategory(name); err != nil {
+		printError("Error: ", err)
+		return
+	}
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+	dir := filepath.Join(modulesDir, name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		failf("Error: no category %s in %s\n", name, modulesDir)
+		return
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		printError("Failed to read category: ", err)
+		return
+	}
+	contained, err := modules.Scan(dir)
+	if err != nil {
+		printError("Failed to read category: ", err)
+		return
+	}
+	if len(contained) > 0 && !categoryForce {
+		failf("Error: %s holds %d modules, uninstall them first or pass --force to delete them too\n", name, len(contained))
+		return
+	}
+	if !categoryYes {
+		confirmed := false
+		title := fmt.Sprintf("Delete %s and remove %s from every host?", dir, name)
+		err = huh.NewConfirm().Title(title).Value(&confirmed).Run()
+		if err != nil || !confirmed {
+			cancel("Removal")
+			return
+		}
+	}
+
+	hostDirs, err := ui.GetDirNames(filepath.Join(cfg.FlakePath, cfg.DefaultHostDir))
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	changes, changedHosts, err := editHosts(cfg, hostDirs, func(nixcfg *nixconfig.Config) error {
+		nixcfg.RemoveCategory(name)
+		return nil
+	})
+	if err != nil {
+		printError("Error updating host config: ", err)
+		return
+	}
+	imports := modules.NewImports(modulesDir)
+	err = imports.Remove(dir)
+	if err != nil {
+		printError("Could not read default.nix: ", err)
+		return
+	}
+	changes = append(changes, imports.Changes()...)
+
+	snapshot := beginBackup("category rm " + name)
+	defer commitBackup(snapshot)
+	for _, path := range append(slices.Clone(files), changedPaths(changes)...) {
+		if err := backupFile(snapshot, path); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	err = diff.Apply(changes)
+	if err != nil {
+		printError("Error updating host config: ", err)
+		return
+	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		printError("Could not delete category: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, changes)
+
+	for _, host := range changedHosts {
+		slog.Info(fmt.Sprintf("Removed %s from %s", name, host))
+	}
+	slog.Info("Deleted " + dir)
+	lockPaths := updateLock(cfg, snapshot, func(lock *lockfile.Lock) {
+		for _, module := range contained {
+			if rel, err := lockfile.RelativeModule(cfg.FlakePath, module.Path); err == nil {
+				lock.Remove(rel)
+			}
+		}
+	})
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage("remove category "+name, changedHosts)
+	autoCommit(cfg, message, append(append(files, changedPaths(changes)...), lockPaths...))
+	recordOperation(cmd, message, []string{name})
+}
+
+var categoryCmd = &cobra.Command{
+	Use:   "category",
+	Short: "List, add, rename and remove module categories",
+	Long:  "Categories are the folders of the module directory, and the sets of the same name in every host's apps section.",
+}
+
+var categoryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the categories with the number of packages in each",
+	Args:  cobra.NoArgs,
+	Run:   categoryList,
+}
+
+var categoryAddCmd = &cobra.Command{
+	Use:   "add [category]",
+	Short: "Create a category folder and add it to the apps section of hosts",
+	Args:  cobra.ExactArgs(1),
+	Run:   categoryAdd,
+}
+
+var categoryRenameCmd = &cobra.Command{
+	Use:   "rename [category] [new name]",
+	Short: "Move a category's modules to a new folder and rename it in every host",
+	Args:  cobra.ExactArgs(2),
+	Run:   categoryRename,
+}
+
+var categoryRemoveCmd = &cobra.Command{
+	Use:     "rm [category]",
+	Aliases: []string{"remove"},
+	Short:   "Delete an empty category and remove it from every host",
+	Args:    cobra.ExactArgs(1),
+	Run:     categoryRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(categoryCmd)
+	categoryCmd.AddCommand(categoryListCmd)
+	categoryCmd.AddCommand(categoryAddCmd)
+	categoryCmd.AddCommand(categoryRenameCmd)
+	categoryCmd.AddCommand(categoryRemoveCmd)
+	categoryAddCmd.Flags().StringArrayVar(&categoryHostFlags, "host", nil, "Host or @group to add the category to, skips the host prompt (repeatable)")
+	categoryAddCmd.Flags().BoolVar(&categoryDefaultNix, "default-nix", false, "Also write a default.nix importing every module of the category")
+	categoryAddCmd.Flags().BoolVarP(&categoryYes, "yes", "y", false, "Don't ask for hosts, only create the folder unless --host is given")
+	categoryRemoveCmd.Flags().BoolVar(&categoryForce, "force", false, "Also delete the modules in the category")
+	categoryRemoveCmd.Flags().BoolVarP(&categoryYes, "yes", "y", false, "Delete without asking for confirmation")
+	for _, command := range []*cobra.Command{categoryAddCmd, categoryRenameCmd, categoryRemoveCmd} {
+		command.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+	}
+}
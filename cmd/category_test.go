@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestCategory_Nested(t *testing.T) {
+	flake, config := writeTestFlake(t)
+	fake := &execx.Fake{Missing: []string{"git", "nixfmt", "alejandra", "nixpkgs-fmt"}}
+	hostFile := filepath.Join(flake, "hosts", "laptop", "configuration.nix")
+	modulesDir := filepath.Join(flake, "modules", "apps")
+
+	if err := runPam(t, fake, "category", "add", "dev/editors", "--config", config, "--host", "laptop"); err != nil {
+		t.Fatalf("category add dev/editors: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(modulesDir, "dev", "editors")); err != nil || !info.IsDir() {
+		t.Errorf("category add dev/editors didn't create the folder: %v", err)
+	}
+	host, _ := os.ReadFile(hostFile)
+	if !strings.Contains(string(host), "dev = {") || !strings.Contains(string(host), "editors = {") {
+		t.Errorf("host config after add =\n%s", host)
+	}
+
+	if err := runPam(t, fake, "category", "rename", "dev/editors", "dev/ides", "--config", config); err != nil {
+		t.Fatalf("category rename dev/editors dev/ides: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(modulesDir, "dev", "ides")); err != nil {
+		t.Errorf("category rename didn't move the folder: %v", err)
+	}
+	host, _ = os.ReadFile(hostFile)
+	if !strings.Contains(string(host), "ides = {") || strings.Contains(string(host), "editors") {
+		t.Errorf("host config after rename =\n%s", host)
+	}
+
+	// Moving to another parent would leave the host configs behind the folders
+	err := runPam(t, fake, "category", "rename", "dev/ides", "tools/ides", "--config", config)
+	if err == nil {
+		t.Error("category rename dev/ides tools/ides succeeded, want it refused")
+	}
+	if _, err := os.Stat(filepath.Join(modulesDir, "dev", "ides")); err != nil {
+		t.Errorf("refused rename moved the folder: %v", err)
+	}
+	if after, _ := os.ReadFile(hostFile); string(after) != string(host) {
+		t.Errorf("refused rename changed the host config =\n%s", after)
+	}
+
+	if err := runPam(t, fake, "category", "rm", "dev/ides", "--config", config, "--yes"); err != nil {
+		t.Fatalf("category rm dev/ides: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(modulesDir, "dev", "ides")); !os.IsNotExist(err) {
+		t.Errorf("category rm left the folder: %v", err)
+	}
+	host, _ = os.ReadFile(hostFile)
+	if strings.Contains(string(host), "ides") {
+		t.Errorf("host config after rm =\n%s", host)
+	}
+}
+
+func TestValidCategory(t *testing.T) {
+	for _, name := range []string{"browsers", "dev/editors", "dev/python-tools"} {
+		if err := validCategory(name); err != nil {
+			t.Errorf("validCategory(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "dev/", "/dev", "dev//editors", "dev/1editors", "dev/../editors"} {
+		if err := validCategory(name); err == nil {
+			t.Errorf("validCategory(%q) = nil, want an error", name)
+		}
+	}
+}
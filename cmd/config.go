@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+
+	"pam/internal"
+	"pam/internal/editor"
+	"pam/internal/installer"
+
+	"github.com/spf13/cobra"
+)
+
+// configProfile returns the profile pam config works on: --profile, PAM_PROFILE or the
+// current profile of the file
+func configProfile(file *internal.Config) string {
+	if name := flagOrEnv(profileFlag, "PAM_PROFILE"); name != "" {
+		return name
+	}
+	return file.CurrentProfile
+}
+
+// readSettings returns the config file and the settings pam config shows, those of
+// configProfile with the PAM_* variables and --flake-path applied
+func readSettings() (*internal.Config, *internal.Config, error) {
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := file.Resolve(configProfile(file), configOverrides())
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, settings, nil
+}
+
+func configList(cmd *cobra.Command, args []string) {
+	_, settings, err := readSettings()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	values := map[string]string{}
+	for _, key := range internal.Keys {
+		values[key], _ = settings.Get(key)
+	}
+	if jsonOutput() {
+		printJSON(values)
+		return
+	}
+	if settings.Profile != "" {
+		fmt.Printf("Profile %s\n", settings.Profile)
+	}
+	for _, key := range internal.Keys {
+		fmt.Printf("%-20s %s\n", key, values[key])
+	}
+}
+
+func configGet(cmd *cobra.Command, args []string) {
+	_, settings, err := readSettings()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	value, err := settings.Get(args[0])
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if jsonOutput() {
+		printJSON(map[string]string{args[0]: value})
+		return
+	}
+	fmt.Println(value)
+}
+
+func configSet(cmd *cobra.Command, args []string) {
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	key, value := args[0], args[1]
+	if key == "open_after_install" {
+		// The installer knows the editor modes
+		if _, err := installer.ResolveEditorMode(value, false, false); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	profile := configProfile(file)
+	err = file.Set(profile, key, value)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	err = file.Save()
+	if err != nil {
+		printError("Could not save config: ", err)
+		return
+	}
+	// Print the value as it was read, e.g. yes for show_diff is true
+	if settings, err := file.Resolve(profile, nil); err == nil {
+		value, _ = settings.Get(key)
+	}
+	if profile != "" {
+		fmt.Printf("Set %s to %s in profile %s\n", key, value, profile)
+		return
+	}
+	fmt.Printf("Set %s to %s\n", key, value)
+}
+
+func configEdit(cmd *cobra.Command, args []string) {
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	path := internal.ConfigFile()
+	err = editor.Open(file.Editor, path)
+	if err != nil {
+		printError("Could not open the editor: ", err)
+		return
+	}
+
+	edited, err := internal.ReadConfigFile()
+	if err == nil {
+		err = edited.Check(configProfile(edited))
+	}
+	if err != nil {
+		failf("%s has a problem, run pam config edit to fix it: %v\n", path, err)
+		return
+	}
+	fmt.Printf("Saved %s\n", path)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change the pam config",
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show every config key with its value",
+	Args:  cobra.NoArgs,
+	Run:   configList,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:       "get [key]",
+	Short:     "Print the value of a config key",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: internal.Keys,
+	Run:       configGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set [key] [value]",
+	Short: "Change a config key, checking the value first",
+	Long: `Change a config key in the current profile, or in the top-level settings when no
+profile is in use. The value is checked before config.yaml is written: flake_path
+must exist, layout, nix_timeout and open_after_install must be valid.`,
+	Args: cobra.ExactArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return internal.Keys, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	},
+	Run: configSet,
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open config.yaml in the editor and check it afterwards",
+	Args:  cobra.NoArgs,
+	Run:   configEdit,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configEditCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"pam/internal/diff"
+	"pam/internal/editor"
+
+	"github.com/charmbracelet/huh"
+)
+
+const (
+	conflictKeep      = "keep"
+	conflictOverwrite = "overwrite"
+	conflictDiff      = "diff"
+	conflictMerge     = "merge"
+)
+
+var (
+	forceOverwrite bool
+	skipExisting   bool
+)
+
+// moduleConflicts decides what happens to existing modules that differ from the generated
+// ones: --force overwrites them, --skip-existing keeps them and otherwise the user is asked.
+// Installs without prompts overwrite them, as they always did.
+func moduleConflicts(configuredEditor string) (func(change diff.Change) (string, error), error) {
+	switch {
+	case forceOverwrite && skipExisting:
+		return nil, errors.New("--force and --skip-existing can't be used together")
+	case skipExisting:
+		return func(change diff.Change) (string, error) { return change.Old, nil }, nil
+	case forceOverwrite || assumeYes || dryRun || jsonOutput():
+		return nil, nil
+	}
+	return func(change diff.Change) (string, error) {
+		return askConflict(configuredEditor, fmt.Sprintf("%s already exists and differs from the generated module", change.Path), change)
+	}, nil
+}
+
+// askConflict asks what to do with an existing module until the user keeps, overwrites or
+// merges it, title saying why it is asked
+func askConflict(configuredEditor string, title string, change diff.Change) (string, error) {
+	for {
+		action := conflictKeep
+		err := huh.NewSelect[string]().
+			Title(title).
+			Options(
+				huh.NewOption("Keep the existing module", conflictKeep),
+				huh.NewOption("Overwrite it with the generated module", conflictOverwrite),
+				huh.NewOption("Show the diff", conflictDiff),
+				huh.NewOption("Merge both in the editor", conflictMerge),
+			).
+			Value(&action).
+			Run()
+		if err != nil {
+			return "", err
+		}
+
+		switch action {
+		case conflictKeep:
+			return change.Old, nil
+		case conflictOverwrite:
+			return change.New, nil
+		case conflictDiff:
+			fmt.Print(diff.Colorize(diff.Unified(change)))
+		case conflictMerge:
+			merged, err := mergeInEditor(configuredEditor, change)
+			if err != nil {
+				printError("Error: ", err)
+				continue
+			}
+			return merged, nil
+		}
+	}
+}
+
+// mergeInEditor opens the existing and generated module side by side between conflict
+// markers and returns the file once the editor is closed without markers left
+func mergeInEditor(configuredEditor string, change diff.Change) (string, error) {
+	tmp, err := os.CreateTemp("", "pam-merge-*-"+filepath.Base(change.Path))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(diff.Markers(change, "existing", "generated"))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = editor.Open(configuredEditor, tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	merged, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	if diff.HasMarkers(string(merged)) {
+		return "", fmt.Errorf("%s still has conflict markers, resolve every conflict before closing the editor", change.Path)
+	}
+	return string(merged), nil
+}
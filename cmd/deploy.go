@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/hosts"
+	"pam/internal/rebuild"
+	"pam/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var deployDryRun bool
+
+func deploy(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	deployHosts, err := internal.ExpandHosts(args, cfg.HostGroupsOf(hostDirs))
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	for _, host := range deployHosts {
+		if !deployHost(cmd.Context(), cfg, hostsDir, host, deployDryRun) && cmd.Context().Err() != nil {
+			return
+		}
+	}
+}
+
+// deployHost switches host over SSH when it has an ssh_target, or rebuilds it when it is
+// this machine, printing the command instead with dryRun. It reports whether it succeeded.
+func deployHost(ctx context.Context, cfg *internal.Config, hostsDir string, host string, dryRun bool) bool {
+	target := cfg.Host(host).SSHTarget
+	var command []string
+	switch {
+	case target != "":
+		platform := rebuild.NixOS
+		if system := hosts.DetectSystem(cfg.FlakePath, hostsDir, host); system != "" {
+			platform = rebuild.PlatformFor(system)
+		}
+		var err error
+		command, err = rebuild.DeployCommand(platform, cfg.FlakePath, host, target)
+		if err != nil {
+			printError("Error: ", err)
+			return false
+		}
+	case host == localHost():
+		command = rebuildCommand(cfg, localPlatform(cfg), host, os.Geteuid() == 0)
+	default:
+		failf("Error: %s has no ssh_target, set one under hosts in the config or the flake's .pam.yaml\n", host)
+		return false
+	}
+
+	if dryRun {
+		fmt.Printf("%s: %s\n", host, strings.Join(command, " "))
+		return true
+	}
+	if len(command) > 0 && command[0] == "sudo" {
+		// Ask for the password before the output viewport takes over the terminal
+		if err := runner.Interactive(ctx, "sudo", "-v"); err != nil {
+			printError("Could not get sudo rights: ", err)
+			return false
+		}
+	}
+	return runRebuild(ctx, host, command)
+}
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy [host|@group...]",
+	Short: "Switch hosts to the flake's configuration, over SSH for remote ones",
+	Long:  "Build the configuration of each host here and switch it with nixos-rebuild --target-host, logging in at the ssh_target of its hosts settings. This machine is rebuilt like after an install. The remote login needs root or passwordless sudo, there is no terminal to type a password in.",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   deploy,
+}
+
+func init() {
+	rootCmd.AddCommand(deployCmd)
+	deployCmd.Flags().BoolVar(&deployDryRun, "dry-run", false, "Print the command of each host without running it")
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/diff"
+	"pam/internal/direnv"
+	"pam/internal/gitops"
+	"pam/internal/installer"
+	"pam/internal/nixconfig"
+	"pam/internal/search"
+	"pam/internal/strict"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	devDryRun bool
+	noDirenv  bool
+)
+
+// devShellChange adds attrs to the default devshell of the flake.nix at path, defining
+// one when the flake has none and writing a flake with only the devshell when path
+// doesn't exist. The new flake takes nixpkgs from url.
+func devShellChange(path string, url string, attrs []string) (diff.Change, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return diff.Change{Path: path, New: nixconfig.DevShellFlake(url, attrs...)}, nil
+	}
+	if err != nil {
+		return diff.Change{}, err
+	}
+
+	flake := nixconfig.NewConfig(string(content))
+	for _, attr := range attrs {
+		_, err := flake.AddDevShellPackage(attr)
+		if errors.Is(err, nixconfig.ErrNoDevShell) {
+			err = flake.AddDevShell(attr)
+		}
+		if err != nil {
+			return diff.Change{}, err
+		}
+	}
+	return diff.Change{Path: path, Old: string(content), New: flake.Content()}, nil
+}
+
+func devAdd(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	// A devshell lists nixpkgs packages, the project's flake has none of the configured sources
+	searcher, err := newSearcher(cmd.Context(), cfg)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	searcher.nixpkgs = true
+	searcher.sources = nil
+	choice := installer.Choice{
+		Attrs:           attrFlags,
+		Index:           packageIndex,
+		AcceptBestMatch: assumeYes,
+	}
+	inst := &installer.Installer{
+		Searcher: searcher,
+		Pick:     pickPackage(searcher, strict.NewPolicy(false, messageOut()), choice, "add", true),
+	}
+	selections, err := inst.Resolve(args)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	attrs := make([]string, len(selections))
+	for i, selection := range selections {
+		attrs[i] = selection.Package.FullPath
+	}
+
+	// A new flake takes the nixpkgs searched, pinned to a branch rather than the registry
+	url := searcher.ref
+	if url == search.DefaultRef {
+		url = search.UnstableRef
+	}
+	path := filepath.Join(dir, "flake.nix")
+	change, err := devShellChange(path, url, attrs)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if change.Old == change.New {
+		fmt.Printf("The devshell of flake.nix already has %s\n", strings.Join(attrs, ", "))
+		return
+	}
+
+	display := change
+	display.Path = "flake.nix"
+	fmt.Print(diff.Colorize(diff.Unified(display)))
+	if devDryRun {
+		offerDirenv(cmd.Context(), dir, true)
+		return
+	}
+	write := true
+	if !assumeYes {
+		err = huh.NewConfirm().Title("Write flake.nix?").Value(&write).Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+	if !write {
+		fmt.Println("Left flake.nix unchanged")
+		return
+	}
+	if err := diff.Apply([]diff.Change{change}); err != nil {
+		printError("Could not write flake.nix: ", err)
+		return
+	}
+	slog.Info(fmt.Sprintf("Added %s to the devshell of %s", strings.Join(attrs, ", "), path))
+	if change.Old == "" && gitops.NewRepo(dir).IsRepo() {
+		// Nix only sees the files git tracks in a repository
+		fmt.Println("flake.nix is new, git add it before entering the devshell")
+	}
+	if !offerDirenv(cmd.Context(), dir, false) {
+		fmt.Println("Enter the devshell with nix develop")
+	}
+}
+
+// offerDirenv offers to load the devshell of dir with direnv whenever the directory is
+// entered, adding use flake to its .envrc and allowing it. A .envrc loading the devshell
+// already is reloaded. It reports whether direnv loads the devshell.
+func offerDirenv(ctx context.Context, dir string, dryRun bool) bool {
+	if noDirenv {
+		return false
+	}
+	if _, err := runner.LookPath("direnv"); err != nil {
+		slog.Debug(fmt.Sprintf("not offering direnv: %v", err))
+		return false
+	}
+	content, err := os.ReadFile(direnv.File(dir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(messageOut(), "Warning: could not read .envrc: ", err)
+		return false
+	}
+	if direnv.UsesFlake(string(content)) {
+		if dryRun {
+			return true
+		}
+		if err := direnv.Reload(dir); err != nil {
+			fmt.Fprintln(messageOut(), "Warning: could not reload the devshell, run direnv reload: ", err)
+		}
+		fmt.Println("direnv loads the new packages at the next prompt")
+		return true
+	}
+	if dryRun {
+		fmt.Printf("Would add %s to .envrc and run direnv allow\n", direnv.UseFlake)
+		return false
+	}
+
+	use := true
+	if !assumeYes {
+		err := huh.NewConfirm().
+			Title(fmt.Sprintf("Load the devshell with direnv whenever you enter %s?", filepath.Base(dir))).
+			Value(&use).
+			Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return false
+		}
+	}
+	if !use {
+		return false
+	}
+	if _, err := direnv.Write(dir); err != nil {
+		printError("Could not write .envrc: ", err)
+		return false
+	}
+	if err := direnv.Allow(ctx, runner, dir); err != nil {
+		printError("Error: ", err)
+		return false
+	}
+	fmt.Printf("Added %s to .envrc, direnv loads the devshell when you enter the directory\n", direnv.UseFlake)
+	return true
+}
+
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Manage the devshell of the project in the current directory",
+}
+
+var devAddCmd = &cobra.Command{
+	Use:   "add [packages...]",
+	Short: "Add packages to the devshell of the flake in the current directory",
+	Long:  "Search for packages like install does and add them to the default devshell of ./flake.nix, the project's flake rather than the system one. A flake without a devshell gets one for the common linux and darwin systems, a directory without a flake.nix gets a flake defining only the devshell. With direnv installed, pam offers to add use flake to .envrc and allow it, so the devshell loads whenever the directory is entered.",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   devAdd,
+}
+
+func init() {
+	rootCmd.AddCommand(devCmd)
+	devCmd.AddCommand(devAddCmd)
+	devAddCmd.Flags().BoolVar(&devDryRun, "dry-run", false, "Show the change to flake.nix without writing it")
+	devAddCmd.Flags().BoolVar(&noDirenv, "no-direnv", false, "Don't offer to load the devshell with direnv")
+	devAddCmd.Flags().BoolVarP(&showAll, "show-all", "a", false, "List the packages of package sets such as vimPlugins one by one")
+	devAddCmd.Flags().StringArrayVar(&attrFlags, "attr", nil, "Attribute path to add, e.g. go or python3Packages.numpy (repeatable)")
+	devAddCmd.Flags().IntVar(&packageIndex, "package-index", -1, "Add the search result at this 0-based position")
+	devAddCmd.Flags().StringVar(&branch, "branch", "", "Nixpkgs branch to search (stable or unstable), overrides nixpkgs_ref")
+	devAddCmd.Flags().BoolVar(&noCache, "no-cache", false, "Always run a fresh nix search instead of reusing cached results")
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"pam/internal/doctor"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorSymbols = map[doctor.Status]string{
+	doctor.OK:      "✓",
+	doctor.Warning: "!",
+	doctor.Failed:  "✗",
+	doctor.Skipped: "-",
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	results := doctor.Run(cfg, doctor.DefaultEnv(cfg))
+	if jsonOutput() {
+		printJSON(results)
+		return
+	}
+	for _, result := range results {
+		fmt.Printf("%s %-22s %s\n", doctorSymbols[result.Status], result.Name, result.Detail)
+		if result.Fix != "" && (result.Status == doctor.Warning || result.Status == doctor.Failed) {
+			fmt.Printf("  %-22s → %s\n", "", result.Fix)
+		}
+	}
+
+	if doctor.AnyFailed(results) {
+		failf("\nSome checks failed, fix them before running other pam commands\n")
+		return
+	}
+	fmt.Println("\nEverything looks good")
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that nix, the flake and pam's config are set up correctly",
+	Long:  "Check that nix is installed with flakes enabled, the flake, hosts and module directories exist, lib/mkApp.nix is up to date and the flake's git repository is clean. Every failing check prints how to fix it.",
+	Args:  cobra.NoArgs,
+	Run:   runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/diff"
+	"pam/internal/search"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+)
+
+// Exit codes of pam, so scripts can tell why a command failed
+const (
+	exitFailure = 1
+	exitSearch  = 2
+	exitConfig  = 3
+	exitWrite   = 4
+	// exitCancelled is also what a shell reports for Ctrl-C
+	exitCancelled = 130
+)
+
+// failure is the first error the command reported, it decides the exit code of pam
+var failure error
+
+// fail records err as the reason the command failed, keeping the first one
+func fail(err error) {
+	if failure == nil && err != nil {
+		failure = err
+	}
+}
+
+// errorOut is where errors are reported, so they stay out of the output scripts read
+var errorOut io.Writer = os.Stderr
+
+// errorJSON is an error as --output json reports it
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// printErrorMessage writes message to errorOut, as an {"error": ...} object with
+// --output json
+func printErrorMessage(message string) {
+	message = strings.TrimSpace(message)
+	if jsonOutput() {
+		if err := json.NewEncoder(errorOut).Encode(errorJSON{Error: strings.TrimPrefix(message, "Error: ")}); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to encode JSON: ", err)
+		}
+		return
+	}
+	fmt.Fprintln(errorOut, message)
+}
+
+// printError prints message followed by err, the way commands report errors, and fails
+// the command with err
+func printError(message string, err error) {
+	printErrorMessage(fmt.Sprintln(message, err))
+	fail(err)
+}
+
+// failf prints a formatted error message and fails the command with the first error
+// among args, or with the message when there is none
+func failf(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	printErrorMessage(message)
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			fail(err)
+			return
+		}
+	}
+	fail(errors.New(strings.TrimSpace(message)))
+}
+
+// cancel reports that the user cancelled action, e.g. Install, and fails the command
+func cancel(action string) {
+	err := &ui.UserCancelled{Action: action}
+	printErrorMessage(err.Error())
+	fail(err)
+}
+
+// exitCode maps the error a command failed with to the exit code of pam. A program pam
+// ran that failed, like a rebuild or the installs of a workspace, passes on its own.
+func exitCode(err error) int {
+	var (
+		cancelled *ui.UserCancelled
+		searchErr *search.SearchError
+		configErr *internal.ConfigParseError
+		writeErr  *diff.WriteError
+		exitErr   *exec.ExitError
+	)
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &cancelled), errors.Is(err, huh.ErrUserAborted), errors.Is(err, context.Canceled):
+		return exitCancelled
+	case errors.As(err, &searchErr):
+		return exitSearch
+	case errors.As(err, &configErr):
+		return exitConfig
+	case errors.As(err, &writeErr):
+		return exitWrite
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
+	}
+	return exitFailure
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"pam/internal/lockfile"
+	"pam/internal/manifest"
+	"pam/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+func export(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	if cfg.Plain() {
+		failf("Error: export reads the pam modules, which the plain layout doesn't use\n")
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+
+	m, err := manifest.Build(cfg.FlakePath, modulesDir, hostsDir, cfg.Namespace(), hostDirs, cfg.AppsFiles(), lock)
+	if err != nil {
+		printError("Failed to export packages: ", err)
+		return
+	}
+	if jsonOutput() {
+		printJSON(m)
+		return
+	}
+	data, err := m.Encode()
+	if err != nil {
+		printError("Failed to encode manifest: ", err)
+		return
+	}
+	os.Stdout.Write(data)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print a manifest of every pam-managed package and the hosts enabling it",
+	Long: `Walk the module directory and the host configs and print a YAML manifest of every
+package pam manages, with its version, category, source and the hosts enabling it.
+Redirect it to a file to review or share it, e.g. pam export > packages.yaml`,
+	Args: cobra.NoArgs,
+	Run:  export,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+}
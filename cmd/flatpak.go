@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/flatpak"
+	"pam/internal/installer"
+	"pam/internal/search"
+	"pam/internal/setup"
+
+	"github.com/charmbracelet/huh"
+)
+
+var useFlatpak bool
+
+// linuxSystems returns the linux systems among systems
+func linuxSystems(systems []string) []string {
+	return slices.DeleteFunc(slices.Clone(systems), func(system string) bool {
+		return !strings.HasSuffix(system, "-linux")
+	})
+}
+
+// chooseFlatpaks installs the Flathub build of an app on linux hosts instead of the nix
+// package, through the nix-flatpak module. --flatpak takes it for every selection, without
+// it pam asks for packages nixpkgs marks broken or insecure on linux when Flathub has them.
+// Darwin hosts keep the nix package.
+func chooseFlatpaks(ctx context.Context, selections []installer.Selection, plan installer.Plan, metas map[string]search.Meta) error {
+	if plan.Plain || (assumeYes && !useFlatpak) {
+		return nil
+	}
+	flathub := &flatpak.Searcher{URL: flatpak.FlathubURL}
+	for n, selection := range selections {
+		pkg := *selection.Package
+		systems := linuxSystems(pkg.Systems())
+		if pkg.Homebrew != nil || pkg.Program != "" || pkg.Wrapper != nil || len(systems) == 0 {
+			continue
+		}
+		warnings := metas[pkg.FullPath].Warnings(systems)
+		if !useFlatpak && len(warnings) == 0 {
+			continue
+		}
+
+		var apps []flatpak.App
+		var searchErr error
+		err := withSpinner(fmt.Sprintf("Searching Flathub for %s...", pkg.PName), func() {
+			apps, searchErr = flathub.Search(ctx, pkg.PName)
+		})
+		if err != nil {
+			return fmt.Errorf("running spinner: %w", err)
+		}
+		if searchErr != nil && useFlatpak {
+			return searchErr
+		}
+		if searchErr != nil || len(apps) == 0 {
+			if useFlatpak {
+				return fmt.Errorf("no Flathub app found for %s", pkg.PName)
+			}
+			slog.Debug(fmt.Sprintf("not offering a flatpak of %s: %v", pkg.PName, searchErr))
+			continue
+		}
+
+		app, ok := flatpak.BestMatch(apps, pkg.PName)
+		if !ok && assumeYes {
+			return fmt.Errorf("no Flathub app is clearly %s, %d match the search", pkg.PName, len(apps))
+		}
+		if !ok {
+			options := make([]huh.Option[flatpak.App], len(apps))
+			for i, found := range apps {
+				options[i] = huh.NewOption(fmt.Sprintf("%s (%s) - %s", found.Name, found.ID, found.Summary), found)
+			}
+			err = huh.NewSelect[flatpak.App]().
+				Title(fmt.Sprintf("Select the Flathub app of %s", pkg.PName)).
+				Options(options...).
+				Value(&app).
+				Run()
+			if err != nil {
+				return err
+			}
+		}
+
+		if !useFlatpak {
+			install := true
+			err = huh.NewConfirm().
+				Title(fmt.Sprintf("%s %s in nixpkgs, install the Flathub build %s on linux hosts instead?", pkg.FullPath, strings.Join(warnings, " and "), app.ID)).
+				Value(&install).
+				Run()
+			if err != nil {
+				return err
+			}
+			if !install {
+				continue
+			}
+		}
+		pkg.Flatpak = app.ID
+		selections[n].Package = &pkg
+	}
+	return nil
+}
+
+// registerFlatpak offers to add nix-flatpak to flake.nix and its module to the NixOS
+// systems, which modules installing a flatpak need. It returns the paths written.
+func registerFlatpak(cfg *internal.Config, selections []installer.Selection, dryRun bool) []string {
+	if !slices.ContainsFunc(selections, func(selection installer.Selection) bool { return selection.Package.Flatpak != "" }) {
+		return nil
+	}
+	change, err := setup.NewInitializer(cfg).NixosModuleRegistration(flatpak.Input, flatpak.Module)
+	if err != nil {
+		fmt.Fprintln(messageOut(), "Warning: could not check that flake.nix imports nix-flatpak: ", err)
+		return nil
+	}
+	return offerFlakeChange(cfg, change, flakeOffer{
+		intro:   "Flatpaks are installed by the nix-flatpak module, which flake.nix doesn't import yet:",
+		title:   "Add it to flake.nix?",
+		backup:  "register nix-flatpak in flake.nix",
+		refused: fmt.Sprintf("Left flake.nix unchanged, add the %s input and %s to the modules of your NixOS hosts before rebuilding", flatpak.Input.Name, flatpak.Module),
+	}, dryRun)
+}
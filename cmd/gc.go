@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"pam/internal/gc"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcOlderThan string
+	gcProfile   string
+	gcDryRun    bool
+	gcYes       bool
+)
+
+// askGCOptions lets the user choose which generations to delete and whose
+func askGCOptions(options *gc.Options) error {
+	days := strconv.Itoa(options.Days)
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Delete generations").
+				Options(
+					huh.NewOption("Keep every generation", "0"),
+					huh.NewOption("Older than 7 days", "7"),
+					huh.NewOption("Older than 14 days", "14"),
+					huh.NewOption("Older than 30 days", "30"),
+					huh.NewOption("Older than 90 days", "90"),
+				).
+				Value(&days),
+			huh.NewSelect[string]().
+				Title("Profiles").
+				Options(
+					huh.NewOption("My profiles, home-manager included", gc.ProfileUser),
+					huh.NewOption("The system profile (sudo)", gc.ProfileSystem),
+					huh.NewOption("Every profile (sudo)", gc.ProfileAll),
+				).
+				Value(&options.Profile),
+		),
+	).Run()
+	if err != nil {
+		return err
+	}
+	options.Days, err = strconv.Atoi(days)
+	return err
+}
+
+func collectGarbage(cmd *cobra.Command, args []string) {
+	options := gc.Options{Profile: gcProfile, DryRun: gcDryRun}
+	if gcOlderThan != "" {
+		days, err := gc.ParseAge(gcOlderThan)
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		options.Days = days
+	}
+	if !gcYes && !cmd.Flags().Changed("older-than") && !cmd.Flags().Changed("profiles") {
+		err := askGCOptions(&options)
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+	if err := gc.CheckProfile(options.Profile); err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	var paths int
+	var size int64
+	var sizeErr error
+	err := withSpinner("Estimating the space to reclaim...", func() {
+		paths, size, sizeErr = gc.DeadSize(cmd.Context(), runner)
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if sizeErr != nil {
+		fmt.Fprintln(messageOut(), "Warning: could not estimate the space to reclaim: ", sizeErr)
+	} else {
+		estimate := fmt.Sprintf("%s in %d unused store paths can be deleted", gc.FormatSize(size), paths)
+		if options.Days > 0 {
+			estimate += fmt.Sprintf(", deleting generations older than %d days frees more", options.Days)
+		}
+		fmt.Println(estimate)
+	}
+
+	commands := gc.Commands(options, os.Geteuid() == 0)
+	if !options.DryRun && !gcYes {
+		run := false
+		err := huh.NewConfirm().
+			Title("Collect the garbage now?").
+			Description(describeCommands(commands)).
+			Value(&run).
+			Run()
+		if err != nil || !run {
+			return
+		}
+	}
+	for _, command := range commands {
+		if command[0] == "sudo" {
+			// Ask for the password before the spinner takes over the terminal
+			if err := runner.Interactive(cmd.Context(), "sudo", "-v"); err != nil {
+				printError("Could not get sudo rights: ", err)
+				return
+			}
+			break
+		}
+	}
+
+	var freed []string
+	for _, command := range commands {
+		var output []byte
+		var runErr error
+		err := withSpinner(fmt.Sprintf("Running %s...", programName(command)), func() {
+			output, runErr = runner.CombinedOutput(cmd.Context(), nil, command[0], command[1:]...)
+		})
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		if runErr != nil {
+			failf("Error: %s failed: %v\n%s", strings.Join(command, " "), runErr, output)
+			return
+		}
+		if options.DryRun {
+			fmt.Print(string(output))
+		}
+		if summary := gc.Freed(output); summary != "" {
+			freed = append(freed, summary)
+		}
+	}
+	if len(freed) > 0 {
+		slog.Info("Reclaimed " + strings.Join(freed, ", "))
+	}
+}
+
+// programName is the program a command runs, behind sudo or not
+func programName(command []string) string {
+	if command[0] == "sudo" && len(command) > 1 {
+		return command[1]
+	}
+	return command[0]
+}
+
+// describeCommands lists the commands a confirmation is about, one per line
+func describeCommands(commands [][]string) string {
+	lines := make([]string, len(commands))
+	for i, command := range commands {
+		lines[i] = strings.Join(command, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete old generations and collect garbage in the nix store",
+	Long: `Delete the generations older than --older-than of your profiles, the system profile
+or every profile, chosen with --profiles, then collect the garbage of the nix store and
+show the space reclaimed. Without flags pam asks what to delete. The space unused store
+paths take is estimated first, --dry-run stops after listing the generations that would
+be deleted.`,
+	Args: cobra.NoArgs,
+	Run:  collectGarbage,
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().StringVar(&gcOlderThan, "older-than", "", "Delete generations older than this many days, e.g. 30d")
+	gcCmd.Flags().StringVar(&gcProfile, "profiles", gc.ProfileUser, "Profiles whose generations are deleted: user, system or all")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Show the space to reclaim and the generations that would be deleted without deleting anything")
+	gcCmd.Flags().BoolVarP(&gcYes, "yes", "y", false, "Don't ask, use the flags as given")
+}
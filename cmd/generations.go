@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"pam/internal"
+	"pam/internal/gc"
+	"pam/internal/generations"
+	"pam/internal/hosts"
+	"pam/internal/rebuild"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rollbackSystemTo     int
+	rollbackSystemDryRun bool
+	rollbackSystemYes    bool
+)
+
+// systemHost is a host whose system generations pam reads or switches
+type systemHost struct {
+	name     string
+	platform rebuild.Platform
+	// remote runs commands on the host over ssh, nil for this machine
+	remote []string
+	root   bool
+}
+
+// resolveSystemHost returns the host named in args, this machine when there is none.
+// Other hosts are reached at their ssh_target.
+func resolveSystemHost(cfg *internal.Config, args []string) (systemHost, error) {
+	local := localHost()
+	name := local
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if cfg.Host(name).Rebuild == string(rebuild.HomeManager) {
+		return systemHost{}, fmt.Errorf("%s is a home-manager configuration without system generations, see home-manager generations", name)
+	}
+	if name == local {
+		return systemHost{name: name, platform: localPlatform(cfg), root: os.Geteuid() == 0}, nil
+	}
+
+	target := cfg.Host(name).SSHTarget
+	if target == "" {
+		return systemHost{}, fmt.Errorf("%s is not this machine and has no ssh_target, set one under hosts in the config or the flake's .pam.yaml", name)
+	}
+	platform := rebuild.NixOS
+	if system := hosts.DetectSystem(cfg.FlakePath, filepath.Join(cfg.FlakePath, cfg.DefaultHostDir), name); system != "" {
+		platform = rebuild.PlatformFor(system)
+	}
+	return systemHost{name: name, platform: platform, remote: generations.Remote(target), root: strings.HasPrefix(target, "root@")}, nil
+}
+
+func listGenerations(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	host, err := resolveSystemHost(cfg, args)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	var found []generations.Generation
+	var sizeErr error
+	err = withSpinner(fmt.Sprintf("Reading the generations of %s...", host.name), func() {
+		found, err = generations.List(cmd.Context(), runner, host.remote)
+		if err == nil {
+			sizeErr = generations.Sizes(cmd.Context(), runner, host.remote, found)
+		}
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if sizeErr != nil {
+		fmt.Fprintln(messageOut(), "Warning: could not size the generations: ", sizeErr)
+	}
+
+	if jsonOutput() {
+		if found == nil {
+			found = []generations.Generation{}
+		}
+		printJSON(found)
+		return
+	}
+	if len(found) == 0 {
+		fmt.Printf("%s has no system generations\n", host.name)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GENERATION\tDATE\tSIZE\t")
+	for _, generation := range found {
+		size := "-"
+		if generation.Size > 0 {
+			size = gc.FormatSize(generation.Size)
+		}
+		current := ""
+		if generation.Current {
+			current = "current"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", generation.ID, generation.Date.Format("2006-01-02 15:04"), size, current)
+	}
+	w.Flush()
+}
+
+func rollbackSystem(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	host, err := resolveSystemHost(cfg, args)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	commands, err := generations.RollbackCommands(host.platform, rollbackSystemTo, host.root)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	for i := range commands {
+		commands[i] = append(append([]string{}, host.remote...), commands[i]...)
+	}
+
+	if rollbackSystemDryRun {
+		for _, command := range commands {
+			fmt.Printf("%s: %s\n", host.name, strings.Join(command, " "))
+		}
+		return
+	}
+	if !rollbackSystemYes {
+		target := "the previous generation"
+		if rollbackSystemTo != 0 {
+			target = fmt.Sprintf("generation %d", rollbackSystemTo)
+		}
+		run := false
+		err := huh.NewConfirm().
+			Title(fmt.Sprintf("Switch %s back to %s?", host.name, target)).
+			Description(describeCommands(commands)).
+			Value(&run).
+			Run()
+		if err != nil || !run {
+			return
+		}
+	}
+	if host.remote == nil && !host.root {
+		// Ask for the password before the output viewport takes over the terminal
+		if err := runner.Interactive(cmd.Context(), "sudo", "-v"); err != nil {
+			printError("Could not get sudo rights: ", err)
+			return
+		}
+	}
+	for _, command := range commands {
+		if !runRebuild(cmd.Context(), host.name, command) {
+			return
+		}
+	}
+	fmt.Printf("The flake still describes the newer configuration, the next rebuild of %s switches to it again\n", host.name)
+}
+
+var generationsCmd = &cobra.Command{
+	Use:   "generations [host]",
+	Short: "List the system generations of this machine or a host with an ssh_target",
+	Long:  "List the NixOS or nix-darwin system generations with their date and closure size, marking the current one. Hosts other than this machine are read over ssh at their ssh_target.",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   listGenerations,
+}
+
+var rollbackSystemCmd = &cobra.Command{
+	Use:   "rollback-system [host]",
+	Short: "Switch this machine or a host with an ssh_target back to an earlier system generation",
+	Long: `Switch the system back to the previous generation with nixos-rebuild or darwin-rebuild
+--rollback, or to the generation given with --to. Unlike pam rollback, which restores
+files of the flake, this changes the running system and leaves the flake as it is.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  rollbackSystem,
+}
+
+func init() {
+	rootCmd.AddCommand(generationsCmd)
+	rootCmd.AddCommand(rollbackSystemCmd)
+	rollbackSystemCmd.Flags().IntVar(&rollbackSystemTo, "to", 0, "Generation to switch to, as listed by pam generations, instead of the previous one")
+	rollbackSystemCmd.Flags().BoolVar(&rollbackSystemDryRun, "dry-run", false, "Print the commands without running them")
+	rollbackSystemCmd.Flags().BoolVarP(&rollbackSystemYes, "yes", "y", false, "Switch without asking")
+}
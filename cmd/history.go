@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"pam/internal"
+	"pam/internal/history"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var historyList bool
+
+// Flags that only change how an operation reports, not what it does, aren't repeated
+var unrecordedFlags = []string{"output", "verbose", "quiet", "log-file", "dry-run"}
+
+func loadHistory() (*history.History, error) {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return history.Load(history.DefaultPath(stateDir), history.MaxEntries)
+}
+
+// recordOperation remembers a completed operation so pam history can run it again. args
+// are the positional arguments the operation resolved to, the flags given are added to them.
+func recordOperation(cmd *cobra.Command, summary string, args []string) {
+	command := strings.Fields(cmd.CommandPath())[1:]
+	args = append(slices.Clone(args), flagArgs(cmd, unrecordedFlags...)...)
+
+	h, err := loadHistory()
+	if err == nil {
+		h.Append(history.Entry{
+			Command: strings.Join(command, " "),
+			Args:    args,
+			Summary: summary,
+			Time:    time.Now(),
+		})
+		err = h.Save()
+	}
+	if err != nil {
+		fmt.Println("Could not save history: ", err)
+	}
+}
+
+func listHistory(cmd *cobra.Command, args []string) {
+	h, err := loadHistory()
+	if err != nil {
+		printError("Could not load history: ", err)
+		return
+	}
+
+	entries := h.Recent()
+	if jsonOutput() {
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		printJSON(entries)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No operations recorded yet")
+		return
+	}
+	if historyList || !showProgress() {
+		for _, entry := range entries {
+			fmt.Printf("%s  %s\n", entry.Time.Format("2006-01-02 15:04"), entry.Label())
+		}
+		return
+	}
+
+	options := make([]huh.Option[int], len(entries))
+	for i, entry := range entries {
+		options[i] = huh.NewOption(fmt.Sprintf("%s  %s", entry.Time.Format("2006-01-02 15:04"), entry.Label()), i)
+	}
+	var selected int
+	err = huh.NewSelect[int]().
+		Title("Run a recent operation again").
+		Description("Type / to search").
+		Options(options...).
+		Filtering(true).
+		Value(&selected).
+		Run()
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+
+	rerun(cmd, entries[selected])
+}
+
+// rerun runs pam again with the arguments of a recorded operation
+func rerun(cmd *cobra.Command, entry history.Entry) {
+	exe, err := os.Executable()
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	commandLine := entry.CommandLine()
+	slog.Info("Running pam " + strings.Join(commandLine, " "))
+	err = runner.Interactive(cmd.Context(), exe, commandLine...)
+	if err != nil {
+		printError("Error: ", err)
+	}
+}
+
+func clearHistory(cmd *cobra.Command, args []string) {
+	h, err := loadHistory()
+	if err != nil {
+		printError("Could not load history: ", err)
+		return
+	}
+
+	err = h.Clear()
+	if err != nil {
+		printError("Could not clear history: ", err)
+		return
+	}
+	fmt.Println("History cleared")
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Search recent operations and run one again",
+	Long: `Show the installs, uninstalls and other changes pam made, newest first, in a searchable
+list. Selecting one runs it again with the same arguments. --list prints them instead.`,
+	Args: cobra.NoArgs,
+	Run:  listHistory,
+}
+
+var historyClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Forget all recent operations",
+	Args:  cobra.NoArgs,
+	Run:   clearHistory,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyClearCmd)
+	historyCmd.Flags().BoolVar(&historyList, "list", false, "Print the operations instead of choosing one to run again")
+}
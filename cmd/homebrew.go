@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/homebrew"
+	"pam/internal/search"
+	"pam/internal/types"
+)
+
+// isTap reports whether query names a formula of a Homebrew tap, such as owner/repo/formula
+func isTap(query string) bool {
+	_, _, ok := homebrew.SplitTapFormula(query)
+	return ok
+}
+
+// darwinSystems returns the darwin systems among the ones searched for
+func (s *nixpkgsSearcher) darwinSystems() []string {
+	systems := s.systems
+	if len(systems) == 0 {
+		systems = []string{indexSystem()}
+	}
+	return slices.DeleteFunc(slices.Clone(systems), func(system string) bool {
+		return !strings.HasSuffix(system, "-darwin")
+	})
+}
+
+// fetchMeta evaluates the meta of pkg in the flake it was found in. Packages from a tap or
+// the Mac App Store have none.
+func (s *nixpkgsSearcher) fetchMeta(pkg types.Package) (search.Meta, error) {
+	if pkg.Homebrew != nil {
+		return search.Meta{}, fmt.Errorf("%s is installed by Homebrew and has no nix meta", pkg.PName)
+	}
+	return search.FetchMeta(s.ctx, s.nix, s.refFor(pkg), pkg)
+}
+
+// masApps searches the Mac App Store for a query nixpkgs has nothing for, when the mas CLI
+// is installed and darwin is searched for. Failing searches are only warned about, they
+// mustn't hide that nixpkgs has no results.
+func (s *nixpkgsSearcher) masApps(query string) []types.Package {
+	systems := s.darwinSystems()
+	if !s.homebrew || len(systems) == 0 {
+		return nil
+	}
+	if _, err := runner.LookPath("mas"); err != nil {
+		return nil
+	}
+	var apps []homebrew.MasApp
+	var err error
+	spinErr := withSpinner(fmt.Sprintf("Searching the Mac App Store for %s...", query), func() {
+		apps, err = homebrew.MasSearch(s.ctx, runner, query)
+	})
+	if spinErr == nil && err != nil {
+		fmt.Fprintf(messageOut(), "Warning: %v\n", err)
+	}
+	var found []types.Package
+	for _, app := range apps {
+		found = append(found, app.Package(query, strings.Join(systems, ",")))
+	}
+	return found
+}
+
+// fromTap makes the package of a formula of a Homebrew tap for the darwin systems searched
+// for. Taps are written into mkApp modules, the plain layout has no place for them.
+func fromTap(cfg *internal.Config, searcher *nixpkgsSearcher) func(tap string, formula string) (*types.Package, error) {
+	return func(tap string, formula string) (*types.Package, error) {
+		if cfg.Plain() {
+			return nil, fmt.Errorf("installing from a Homebrew tap needs the modules layout, taps are installed through mkApp")
+		}
+		systems := searcher.darwinSystems()
+		if len(systems) == 0 && targetSystem != "" {
+			return nil, fmt.Errorf("%s/%s is a Homebrew formula, which only installs on darwin, not %s", tap, formula, targetSystem)
+		}
+		if len(systems) == 0 {
+			// The hosts aren't chosen yet, MatchSystems puts in the systems of the darwin ones
+			systems = []string{"aarch64-darwin"}
+		}
+		pkg := homebrew.TapPackage(tap, formula, strings.Join(systems, ","))
+		slog.Info(fmt.Sprintf("Installing %s from the Homebrew tap %s without searching", formula, tap))
+		return &pkg, nil
+	}
+}
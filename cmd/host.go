@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/rebuild"
+	"pam/internal/setup"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hostSystem   string
+	hostHardware string
+	hostUser     string
+	hostDryRun   bool
+	hostYes      bool
+)
+
+// hostPattern matches names usable as a host directory and flake attribute
+var hostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func hostAdd(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	options := setup.ScaffoldOptions{Host: args[0], System: hostSystem, User: hostUser, HardwareConfig: hostHardware}
+	if !hostPattern.MatchString(options.Host) {
+		failf("Error: %q is not a valid host name, use letters, digits, - and _\n", options.Host)
+		return
+	}
+	if options.User == "" {
+		if current, err := user.Current(); err == nil {
+			options.User = current.Username
+		}
+	}
+
+	if options.System == "" {
+		options.System = cfg.DefaultSystem
+		if options.System == "" {
+			options.System = localSystem()
+		}
+		if !hostYes {
+			err = huh.NewInput().
+				Title(fmt.Sprintf("System architecture of %s", options.Host)).
+				Placeholder("x86_64-linux or aarch64-darwin etc...").
+				Value(&options.System).
+				Run()
+			if err != nil {
+				printError("Form cancelled or error: ", err)
+				return
+			}
+		}
+	}
+
+	changes, err := setup.NewInitializer(cfg).AddHost(options)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if hostDryRun {
+		printChanges(cfg.FlakePath, changes)
+		return
+	}
+
+	snapshot := beginBackup("host add " + options.Host)
+	defer commitBackup(snapshot)
+	for _, change := range changes {
+		if err := backupFile(snapshot, change.Path); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	err = diff.Apply(changes)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, changes)
+
+	slog.Info(fmt.Sprintf("Added host %s:", options.Host))
+	for _, change := range changes {
+		path := change.Path
+		if rel, err := filepath.Rel(cfg.FlakePath, path); err == nil {
+			path = rel
+		}
+		if change.Old == "" {
+			slog.Info("  + " + path)
+		} else {
+			slog.Info("  ~ " + path)
+		}
+	}
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage("add host "+options.Host, nil)
+	autoCommit(cfg, message, changedPaths(changes))
+	recordOperation(cmd, message, []string{options.Host})
+
+	if jsonOutput() {
+		printJSON(dryRunJSON{Changes: newChangesJSON(cfg.FlakePath, changes)})
+		return
+	}
+	fmt.Println("\nNext steps:")
+	if options.HardwareConfig == "" && !strings.Contains(options.System, "darwin") {
+		fmt.Printf("  Replace %s with the output of nixos-generate-config --show-hardware-config on %s\n",
+			filepath.Join(cfg.DefaultHostDir, options.Host, "hardware-configuration.nix"), options.Host)
+	}
+	fmt.Printf("  On %s: %s\n", options.Host, strings.Join(rebuildCommand(cfg, rebuild.PlatformFor(options.System), options.Host, true), " "))
+}
+
+var hostCmd = &cobra.Command{
+	Use:   "host",
+	Short: "Manage the hosts of the flake",
+}
+
+var hostAddCmd = &cobra.Command{
+	Use:   "add [host]",
+	Short: "Scaffold a new host and add it to flake.nix",
+	Long:  "Create hosts/<host>/configuration.nix, a hardware-configuration.nix placeholder for NixOS hosts, and add the host to the nixosConfigurations or darwinConfigurations of flake.nix together with the module directory.",
+	Args:  cobra.ExactArgs(1),
+	Run:   hostAdd,
+}
+
+func init() {
+	rootCmd.AddCommand(hostCmd)
+	hostCmd.AddCommand(hostAddCmd)
+	hostAddCmd.Flags().StringVarP(&hostSystem, "system", "s", "", "System of the host, e.g. x86_64-linux or aarch64-darwin, skips the prompt")
+	hostAddCmd.Flags().StringVar(&hostHardware, "hardware-config", "", "Copy this hardware-configuration.nix instead of writing a placeholder")
+	hostAddCmd.Flags().StringVar(&hostUser, "user", "", "Primary user of a nix-darwin host, defaults to the current user")
+	hostAddCmd.Flags().BoolVar(&hostDryRun, "dry-run", false, "Show the changes as diffs without writing any file")
+	hostAddCmd.Flags().BoolVarP(&hostYes, "yes", "y", false, "Use default_system or this machine's system without prompting")
+	hostAddCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+}
+
+// hostGroupList returns the host groups in the order prompts offer them, @all first as
+// the one used most
+func hostGroupList(groups map[string][]string) []ui.HostGroup {
+	list := []ui.HostGroup{{Name: internal.AllHosts, Hosts: groups[internal.AllHosts]}}
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		if name != internal.AllHosts {
+			list = append(list, ui.HostGroup{Name: name, Hosts: groups[name]})
+		}
+	}
+	return list
+}
+
+// hostOptionsWithGroups offers the host groups with members among hostNames as @<group>
+// entries, followed by the hosts. Selected groups are expanded with internal.ExpandHosts.
+func hostOptionsWithGroups(groups map[string][]string, hostNames []string) []huh.Option[string] {
+	var options []huh.Option[string]
+	for _, group := range hostGroupList(groups) {
+		if len(group.Hosts) == 0 || (group.Name == internal.AllHosts && len(hostNames) < 2) {
+			continue
+		}
+		label := fmt.Sprintf("@%s (%s)", group.Name, strings.Join(group.Hosts, ", "))
+		options = append(options, huh.NewOption(label, "@"+group.Name))
+	}
+	return append(options, huh.NewOptions(hostNames...)...)
+}
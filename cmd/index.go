@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"pam/internal/search"
+
+	"github.com/spf13/cobra"
+)
+
+func indexBuild(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	ref := cfg.NixpkgsRef
+	if branch != "" {
+		ref, err = search.BranchRef(branch)
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	if ref == "" {
+		ref = search.DefaultRef
+	}
+	store := openIndexStore(nixRunner(cfg))
+	if store == nil {
+		failf("Error: could not locate the cache directory\n")
+		return
+	}
+
+	var index *search.Index
+	var buildErr error
+	system := indexSystem()
+	err = withSpinner(fmt.Sprintf("Indexing %s for %s, this takes a minute...", ref, system), func() {
+		index, buildErr = store.Build(cmd.Context(), ref, system)
+	})
+	if err == nil {
+		err = buildErr
+	}
+	if err != nil {
+		printError("Building the index failed: ", err)
+		return
+	}
+	slog.Info(fmt.Sprintf("Indexed %d packages of %s for %s", len(index.Packages), ref, system))
+}
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the local nixpkgs index used for offline searches",
+}
+
+var indexBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Dump every nixpkgs package into a local index that search and install query instead of nix search",
+	Long:  "Run nix search once for every package of the configured nixpkgs ref and keep the result in ~/.cache/pam/index. search and install then match against it offline, ranking exact names over prefixes and descriptions, until the ref moves to another revision.",
+	Args:  cobra.NoArgs,
+	Run:   indexBuild,
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.AddCommand(indexBuildCmd)
+	indexBuildCmd.Flags().StringVarP(&targetSystem, "system", "s", "", "System to index, defaults to this machine's")
+	indexBuildCmd.Flags().StringVar(&branch, "branch", "", "Nixpkgs branch to index (stable or unstable), overrides nixpkgs_ref")
+}
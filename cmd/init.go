@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/setup"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	initHost   string
+	initSystem string
+	initYes    bool
+)
+
+// nixosHardwareConfig is generated by nixos-generate-config on every NixOS install
+const nixosHardwareConfig = "/etc/nixos/hardware-configuration.nix"
+
+// localSystem returns the nix system of the running machine, e.g. x86_64-linux
+func localSystem() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	}
+	return arch + "-" + runtime.GOOS
+}
+
+func runInit(cmd *cobra.Command, args []string) {
+	dir := "~/nixos-config"
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	options := setup.ScaffoldOptions{Host: initHost, System: initSystem}
+	if options.Host == "" {
+		options.Host = localHost()
+	}
+	if options.System == "" {
+		options.System = localSystem()
+	}
+	if current, err := user.Current(); err == nil {
+		options.User = current.Username
+	}
+
+	copyHardware := false
+	_, hardwareErr := os.Stat(nixosHardwareConfig)
+	hasHardware := hardwareErr == nil && strings.HasSuffix(options.System, "-linux")
+
+	if !initYes {
+		fields := []huh.Field{
+			huh.NewInput().Title("Where should the flake be created?").Value(&dir),
+			huh.NewInput().Title("Host name").Value(&options.Host).Validate(func(s string) error {
+				if s == "" {
+					return fmt.Errorf("Host name cannot be empty")
+				}
+				return nil
+			}),
+			huh.NewInput().Title("System architecture").Placeholder("x86_64-linux or aarch64-darwin etc...").Value(&options.System),
+		}
+		if hasHardware {
+			copyHardware = true
+			fields = append(fields, huh.NewConfirm().Title("Copy "+nixosHardwareConfig+" into the new host?").Value(&copyHardware))
+		}
+		err := huh.NewForm(huh.NewGroup(fields...)).Run()
+		if err != nil {
+			printError("Init cancelled: ", err)
+			return
+		}
+	} else {
+		copyHardware = hasHardware
+	}
+	if copyHardware {
+		options.HardwareConfig = nixosHardwareConfig
+	}
+	if options.Host == "" {
+		failf("Could not detect the host name, pass it with --host\n")
+		return
+	}
+
+	flakePath, err := filepath.Abs(internal.ExpandPath(dir))
+	if err != nil {
+		printError("Invalid flake directory: ", err)
+		return
+	}
+	cfg := internal.Default()
+	cfg.FlakePath = flakePath
+	cfg.DefaultSystem = options.System
+
+	created, err := setup.NewInitializer(cfg).Scaffold(options)
+	if err != nil {
+		printError("Scaffolding the flake failed: ", err)
+		return
+	}
+	fmt.Printf("Created a flake for %s in %s:\n", options.Host, flakePath)
+	for _, path := range created {
+		if rel, err := filepath.Rel(flakePath, path); err == nil {
+			path = rel
+		}
+		fmt.Printf("  + %s\n", path)
+	}
+
+	err = saveInitConfig(cfg)
+	if err != nil {
+		printError("Saving the config failed: ", err)
+		return
+	}
+
+	rebuild := "sudo nixos-rebuild switch --flake .#" + options.Host
+	if strings.Contains(options.System, "darwin") {
+		rebuild = "sudo darwin-rebuild switch --flake .#" + options.Host
+	}
+	fmt.Println("\nNext steps:")
+	fmt.Printf("  cd %s && git init && git add .\n", flakePath)
+	fmt.Println("  pam install <package>")
+	fmt.Printf("  %s\n", rebuild)
+}
+
+// saveInitConfig points config.yaml at the new flake. An existing config is only
+// changed after confirmation, and only its flake_path and default_system.
+func saveInitConfig(cfg *internal.Config) error {
+	configDir, err := internal.ConfigDir()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "config.yaml")); os.IsNotExist(err) {
+		return cfg.Save()
+	}
+
+	existing, err := internal.ReadConfigFile()
+	if err != nil {
+		return err
+	}
+	if internal.ExpandPath(existing.FlakePath) == cfg.FlakePath {
+		return nil
+	}
+	repoint := initYes
+	if !initYes {
+		err = huh.NewConfirm().
+			Title(fmt.Sprintf("pam is configured for %s, use the new flake instead?", existing.FlakePath)).
+			Value(&repoint).
+			Run()
+		if err != nil {
+			return err
+		}
+	}
+	if !repoint {
+		fmt.Println("Kept the existing config, set flake_path in ~/.config/pam/config.yaml to use the new flake")
+		return nil
+	}
+	existing.FlakePath = cfg.FlakePath
+	existing.DefaultSystem = cfg.DefaultSystem
+	return existing.Save()
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init [directory]",
+	Short: "Create a new flake that pam can manage",
+	Long:  "Scaffold a minimal flake.nix, hosts/<host>/configuration.nix, the modules/apps directory and lib/mkApp.nix in an empty directory (~/nixos-config by default), then point pam's config at it.",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runInit,
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initHost, "host", "", "Name of the host to create, defaults to this machine's host name")
+	initCmd.Flags().StringVar(&initSystem, "system", "", "System of the host, e.g. x86_64-linux or aarch64-darwin, defaults to this machine's")
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "Use the defaults and flags without prompting")
+}
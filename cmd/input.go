@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"pam/internal"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/lockfile"
+	"pam/internal/nixconfig"
+	"pam/internal/search"
+	"pam/internal/setup"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inputName      string
+	inputOverlay   bool
+	inputNoFollows bool
+	inputDryRun    bool
+)
+
+// readFlake parses the flake.nix of the configured flake
+func readFlake(cfg *internal.Config) (*nixconfig.Config, error) {
+	content, err := os.ReadFile(setup.NewInitializer(cfg).FlakeFile())
+	if err != nil {
+		return nil, err
+	}
+	return nixconfig.NewConfig(string(content)), nil
+}
+
+// writeFlake backs up and writes a change of flake.nix, returning the paths written
+func writeFlake(cfg *internal.Config, title string, change diff.Change) ([]string, error) {
+	snapshot := beginBackup(title)
+	defer commitBackup(snapshot)
+	err := backupFile(snapshot, change.Path)
+	if err != nil {
+		return nil, err
+	}
+	err = diff.Apply([]diff.Change{change})
+	if err != nil {
+		return nil, err
+	}
+	logChanges(cfg.FlakePath, []diff.Change{change})
+	return []string{change.Path}, nil
+}
+
+// registerInputs offers to declare the flake inputs the selected packages come from and
+// to pass inputs to the modules, showing the change to flake.nix first. It returns the
+// paths written, for autoCommit.
+func registerInputs(cfg *internal.Config, searcher *nixpkgsSearcher, sources []string, dryRun bool) []string {
+	var inputs []nixconfig.Input
+	for _, name := range sources {
+		source, ok := search.FindSource(searcher.sources, name)
+		if !ok {
+			continue
+		}
+		input := nixconfig.Input{Name: source.Name, URL: source.FlakeRef(), Follows: search.NixpkgsSource}
+		if source.Pinned {
+			input.Follows = ""
+		}
+		inputs = append(inputs, input)
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+	change, err := setup.NewInitializer(cfg).InputRegistration(inputs, false)
+	if err != nil {
+		fmt.Fprintln(messageOut(), "Warning: could not check that flake.nix has the inputs of the packages: ", err)
+		return nil
+	}
+	return offerFlakeChange(cfg, change, flakeOffer{
+		intro:   "The packages come from flake inputs flake.nix doesn't pass to your modules yet:",
+		title:   "Add them to flake.nix?",
+		backup:  "register inputs in flake.nix",
+		refused: "Left flake.nix unchanged, add the inputs with pam input add before rebuilding",
+	}, dryRun)
+}
+
+// flakeOffer are the messages offerFlakeChange shows around a change of flake.nix
+type flakeOffer struct {
+	intro   string
+	title   string
+	backup  string
+	refused string
+}
+
+// offerFlakeChange shows a change of flake.nix and writes it once confirmed, or right away
+// with --yes. It returns the paths written, for autoCommit.
+func offerFlakeChange(cfg *internal.Config, change diff.Change, offer flakeOffer, dryRun bool) []string {
+	if change.Old == change.New {
+		return nil
+	}
+
+	fmt.Println(offer.intro)
+	display := change
+	display.Path = "flake.nix"
+	fmt.Print(diff.Colorize(diff.Unified(display)))
+	if dryRun {
+		return nil
+	}
+
+	register := true
+	if !assumeYes {
+		err := huh.NewConfirm().Title(offer.title).Value(&register).Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return nil
+		}
+	}
+	if !register {
+		fmt.Println(offer.refused)
+		return nil
+	}
+	paths, err := writeFlake(cfg, offer.backup, change)
+	if err != nil {
+		printError("Could not write flake.nix: ", err)
+		return nil
+	}
+	return paths
+}
+
+func inputList(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	flake, err := readFlake(cfg)
+	if err != nil {
+		printError("Could not read flake.nix: ", err)
+		return
+	}
+
+	inputs := flake.Inputs()
+	if jsonOutput() {
+		if inputs == nil {
+			inputs = []nixconfig.Input{}
+		}
+		printJSON(inputs)
+		return
+	}
+	if len(inputs) == 0 {
+		fmt.Println("flake.nix declares no inputs")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tURL\tFOLLOWS")
+	for _, input := range inputs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", input.Name, input.URL, input.Follows)
+	}
+	w.Flush()
+}
+
+func inputAdd(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	source := search.SourceFromRef(args[0])
+	if inputName != "" {
+		source.Name = inputName
+	}
+	input := nixconfig.Input{Name: source.Name, URL: args[0]}
+	if !inputNoFollows {
+		input.Follows = search.NixpkgsSource
+	}
+
+	flake, err := readFlake(cfg)
+	if err != nil {
+		printError("Could not read flake.nix: ", err)
+		return
+	}
+	if flake.HasInput(input.Name) {
+		failf("Error: flake.nix already has an input called %s, pick another one with --name\n", input.Name)
+		return
+	}
+	change, err := setup.NewInitializer(cfg).InputRegistration([]nixconfig.Input{input}, inputOverlay)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if inputDryRun {
+		printChanges(cfg.FlakePath, []diff.Change{change})
+		return
+	}
+	paths, err := writeFlake(cfg, "input add "+input.Name, change)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	slog.Info(fmt.Sprintf("Added input %s (%s) to flake.nix", input.Name, input.URL))
+	formatFiles(cmd.Context(), cfg, paths)
+	message := gitops.CommitMessage("add input "+input.Name, nil)
+	autoCommit(cfg, message, paths)
+	recordOperation(cmd, message, args)
+
+	if _, ok := search.FindSource(cfg.Sources, input.Name); !ok && !jsonOutput() {
+		fmt.Printf("To search it, add it to sources in the config:\n  - name: %s\n    ref: %q\n", input.Name, input.URL)
+	}
+	if jsonOutput() {
+		printJSON(dryRunJSON{Changes: newChangesJSON(cfg.FlakePath, []diff.Change{change})})
+	}
+}
+
+func inputUpdate(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	name := args[0]
+	flake, err := readFlake(cfg)
+	if err != nil {
+		printError("Could not read flake.nix: ", err)
+		return
+	}
+	if !flake.HasInput(name) {
+		failf("Error: flake.nix has no input called %s\n", name)
+		return
+	}
+
+	var paths []string
+	if len(args) > 1 {
+		old := flake.Content()
+		changed, err := flake.SetInputURL(name, args[1])
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		change := diff.Change{Path: setup.NewInitializer(cfg).FlakeFile(), Old: old, New: flake.Content()}
+		if inputDryRun {
+			printChanges(cfg.FlakePath, []diff.Change{change})
+			return
+		}
+		if changed {
+			paths, err = writeFlake(cfg, "input update "+name, change)
+			if err != nil {
+				printError("Error: ", err)
+				return
+			}
+			slog.Info(fmt.Sprintf("Pointed %s at %s", name, args[1]))
+		}
+	} else if inputDryRun {
+		fmt.Printf("Would run nix flake update %s\n", name)
+		return
+	}
+
+	// The lock file pins the input, so it is refreshed whether or not the URL changed
+	var output []byte
+	var updateErr error
+	err = withSpinner(fmt.Sprintf("Updating %s in flake.lock...", name), func() {
+		output, updateErr = nixRunner(cfg).CombinedOutput(cmd.Context(), nil, "nix", "flake", "update", name, "--flake", cfg.FlakePath)
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if updateErr != nil {
+		failf("Error: nix flake update failed: %v\n%s", updateErr, output)
+		return
+	}
+	slog.Info(fmt.Sprintf("Updated %s in flake.lock", name))
+	paths = append(paths, filepath.Join(cfg.FlakePath, "flake.lock"))
+	formatFiles(cmd.Context(), cfg, paths)
+	message := gitops.CommitMessage("update input "+name, nil)
+	autoCommit(cfg, message, paths)
+	recordOperation(cmd, message, args)
+}
+
+func inputRemove(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	name := args[0]
+	flake, err := readFlake(cfg)
+	if err != nil {
+		printError("Could not read flake.nix: ", err)
+		return
+	}
+	old := flake.Content()
+	if !flake.RemoveInput(name) {
+		failf("Error: flake.nix has no input called %s\n", name)
+		return
+	}
+
+	// Modules taking packages from the input stop evaluating without it
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+	var users []string
+	for _, pkg := range lock.Packages {
+		if pkg.Input == name {
+			users = append(users, pkg.Module)
+		}
+	}
+	if len(users) > 0 {
+		fmt.Fprintf(messageOut(), "Warning: these modules take packages from %s, uninstall them too: %s\n", name, strings.Join(users, ", "))
+	}
+	if strings.Contains(flake.Content(), "inputs."+name+".") {
+		fmt.Fprintf(messageOut(), "Warning: flake.nix still refers to inputs.%s, e.g. in an overlay, remove it by hand\n", name)
+	}
+
+	change := diff.Change{Path: setup.NewInitializer(cfg).FlakeFile(), Old: old, New: flake.Content()}
+	if inputDryRun {
+		printChanges(cfg.FlakePath, []diff.Change{change})
+		return
+	}
+	paths, err := writeFlake(cfg, "input rm "+name, change)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	slog.Info(fmt.Sprintf("Removed input %s from flake.nix", name))
+	formatFiles(cmd.Context(), cfg, paths)
+	message := gitops.CommitMessage("remove input "+name, nil)
+	autoCommit(cfg, message, paths)
+	recordOperation(cmd, message, args)
+}
+
+var inputCmd = &cobra.Command{
+	Use:   "input",
+	Short: "Manage the inputs of flake.nix",
+}
+
+var inputListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the inputs declared in flake.nix",
+	Args:  cobra.NoArgs,
+	Run:   inputList,
+}
+
+var inputAddCmd = &cobra.Command{
+	Use:   "add [url]",
+	Short: "Add a flake input and pass inputs to the modules",
+	Long:  "Declare the flake at url as an input of flake.nix, named after the last part of the url unless --name is given, following the flake's nixpkgs. The outputs function gets bound to inputs and every system passes it to its modules, so generated modules can take packages from the input.",
+	Args:  cobra.ExactArgs(1),
+	Run:   inputAdd,
+}
+
+var inputUpdateCmd = &cobra.Command{
+	Use:   "update [input] [url]",
+	Short: "Update an input in flake.lock, pointing it at a new url first when one is given",
+	Args:  cobra.RangeArgs(1, 2),
+	Run:   inputUpdate,
+}
+
+var inputRemoveCmd = &cobra.Command{
+	Use:     "rm [input]",
+	Aliases: []string{"remove"},
+	Short:   "Remove an input from flake.nix",
+	Args:    cobra.ExactArgs(1),
+	Run:     inputRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(inputCmd)
+	inputCmd.AddCommand(inputListCmd)
+	inputCmd.AddCommand(inputAddCmd)
+	inputCmd.AddCommand(inputUpdateCmd)
+	inputCmd.AddCommand(inputRemoveCmd)
+	inputAddCmd.Flags().StringVar(&inputName, "name", "", "Name of the input, defaults to the last part of the url")
+	inputAddCmd.Flags().BoolVar(&inputOverlay, "overlay", false, "Also add the input's default overlay to nixpkgs.overlays of every system")
+	inputAddCmd.Flags().BoolVar(&inputNoFollows, "no-follows", false, "Let the input bring its own nixpkgs instead of following the flake's")
+	for _, command := range []*cobra.Command{inputAddCmd, inputUpdateCmd, inputRemoveCmd} {
+		command.Flags().BoolVar(&inputDryRun, "dry-run", false, "Show the change to flake.nix without writing it")
+		command.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+	}
+}
@@ -1,16 +1,40 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"pam/internal"
-	"pam/internal/assets"
-	"pam/internal/nixconfig"
+	"pam/internal/backup"
+	"pam/internal/categories"
+	"pam/internal/diff"
+	"pam/internal/editor"
+	"pam/internal/execx"
+	"pam/internal/format"
+	"pam/internal/fsx"
+	"pam/internal/gitops"
+	"pam/internal/history"
+	"pam/internal/hooks"
+	"pam/internal/hosts"
+	"pam/internal/installer"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/nixvalidate"
+	"pam/internal/plugins"
+	"pam/internal/rebuild"
 	"pam/internal/search"
 	"pam/internal/setup"
+	"pam/internal/strict"
+	"pam/internal/templates"
 	"pam/internal/types"
 	"pam/internal/ui"
 
@@ -25,8 +49,130 @@ var (
 	showAll         bool
 	targetSystem    string
 	installWithBrew bool
+	confirmEach     bool
+	branch          string
+	showDiff        bool
+	appsFiles       []string
+	strictMode      bool
+	repeatLast      bool
+	editorAfter     bool
+	noEditor        bool
+	hostFlags       []string
+	categoryFlag    string
+	assumeYes       bool
+	attrFlags       []string
+	packageIndex    int
+	noCache         bool
+	dryRun          bool
+	noCommit        bool
+	noHooks         bool
+	sourceFlags     []string
+	flakeFlags      []string
+	flakeRefFlag    string
+	templateFlag    string
+	useProgram      bool
+	noProgram       bool
+	askExtras       bool
+	allowUnfree     bool
+	allowBroken     bool
 )
 
+// inWizard is set while the install wizard or the selector of a package set runs, which
+// show their own progress
+var inWizard bool
+
+// withSpinner runs action behind a spinner titled title, or directly with --quiet,
+// --output json, --yes, without a terminal or inside the install wizard
+func withSpinner(title string, action func()) error {
+	if !showProgress() || inWizard {
+		action()
+		return nil
+	}
+	return spinner.New().Title(title).Action(action).Run()
+}
+
+// searchWithProgress runs the nix search against the given flake ref, showing the tail of
+// the nix log with what is being fetched or built while it runs
+func searchWithProgress(ctx context.Context, nix execx.Runner, ref string, packageName string, system string) (search.SearchResult, error) {
+	if !showProgress() || inWizard {
+		return search.SearchPackages(ctx, nix, ref, packageName, system)
+	}
+
+	var progress rebuild.Progress
+	observe := func(line string) string {
+		progress.Observe(line)
+		return progress.String()
+	}
+	args := append([]string{"nix"}, search.SearchArgs(ref, packageName, system)...)
+	output, lines, err := ui.StreamLog(ctx, fmt.Sprintf("Searching %s...", ref), nix, args, observe)
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return nil, context.Canceled
+	}
+	if err != nil {
+		for _, line := range rebuild.Summarize(lines) {
+			fmt.Println("  " + line)
+		}
+		return nil, &search.SearchError{Ref: ref, Query: packageName, Err: err}
+	}
+	result, err := search.ParseResult(output)
+	if err != nil {
+		return nil, &search.SearchError{Ref: ref, Query: packageName, Err: err}
+	}
+	return result, nil
+}
+
+// selectCategory asks for the category of a module. The categories the flake declares in
+// .pam/categories.yaml are offered with their descriptions, without a schema the folders
+// below the module directory are browsed.
+func selectCategory(cfg *internal.Config) (string, error) {
+	if cfg.CategorySchema == nil || len(cfg.CategorySchema.Categories) == 0 {
+		return selectFolderRecursively(NIX_APPS_DIR)
+	}
+	warnUndeclaredCategories(cfg)
+
+	var options []huh.Option[string]
+	for _, category := range cfg.CategorySchema.Categories {
+		label := category.Name
+		if category.Description != "" {
+			label = fmt.Sprintf("%-20s %s", category.Name, category.Description)
+		}
+		options = append(options, huh.NewOption(label, category.Name))
+	}
+	var selected string
+	err := huh.NewSelect[string]().
+		Title("Select a category").
+		Options(options...).
+		Value(&selected).
+		Run()
+	return selected, err
+}
+
+// warnUndeclaredCategories points out the folders below the module directory that the
+// flake's .pam/categories.yaml doesn't declare, they aren't offered
+func warnUndeclaredCategories(cfg *internal.Config) {
+	found, err := modules.Categories(NIX_APPS_DIR)
+	if err != nil {
+		return
+	}
+	var folders []string
+	for _, category := range found {
+		folders = append(folders, category.Name)
+	}
+	if undeclared, _ := cfg.CategorySchema.Drift(folders); len(undeclared) > 0 {
+		fmt.Fprintf(messageOut(), "Warning: %s doesn't declare %s, add them or move their modules\n", categories.File, strings.Join(undeclared, ", "))
+	}
+}
+
+// warnUndeclaredCategory points out a --category the flake's .pam/categories.yaml doesn't declare
+func warnUndeclaredCategory(cfg *internal.Config, category string) {
+	if category == "" || cfg.CategorySchema == nil {
+		return
+	}
+	if _, ok := cfg.CategorySchema.Find(filepath.ToSlash(category)); !ok {
+		fmt.Fprintf(messageOut(), "Warning: %s doesn't declare the category %s, declared are: %s\n", categories.File, category, strings.Join(cfg.CategorySchema.Names(), ", "))
+	}
+}
+
 func selectFolderRecursively(path string) (string, error) {
 	currentPath := ""
 	for {
@@ -73,173 +219,1876 @@ func selectFolderRecursively(path string) (string, error) {
 	}
 }
 
-func install(cmd *cobra.Command, args []string) {
-	cfg, err := internal.LoadConfig()
+// confirmPackages asks about every package with its resolved attribute, category and
+// hosts before anything is written, returning the confirmed and the skipped ones
+func confirmPackages(selections []installer.Selection, plan installer.Plan) ([]installer.Selection, []installer.Selection, error) {
+	return installer.ConfirmEach(selections, plan, func(selection installer.Selection) (installer.Confirmation, error) {
+		answer := installer.Confirm
+		err := huh.NewSelect[installer.Confirmation]().
+			Title(fmt.Sprintf("Install %s?", selection.Package.PName)).
+			Description(selection.Describe()).
+			Options(
+				huh.NewOption("Yes", installer.Confirm),
+				huh.NewOption("Skip", installer.Skip),
+				huh.NewOption("Abort, install nothing", installer.Abort),
+			).
+			Value(&answer).
+			Run()
+		return answer, err
+	})
+}
+
+// printSkipped lists the packages left out with --confirm-each, --output json has them
+// in skipped
+func printSkipped(skipped []installer.Selection) {
+	if len(skipped) == 0 || jsonOutput() {
+		return
+	}
+	names := make([]string, len(skipped))
+	for i, selection := range skipped {
+		names[i] = selection.Package.PName
+	}
+	fmt.Printf("Skipped %s\n", strings.Join(names, ", "))
+}
+
+// printGitDiff shows what an install changed when the flake is a git repository.
+// It does nothing when git is missing or the flake is not tracked.
+func printGitDiff(flakePath string, changed []string, added []string) {
+	repo := gitops.NewRepo(flakePath)
+	if !repo.IsRepo() {
+		return
+	}
+
+	untracked, err := repo.Untracked(added)
 	if err != nil {
-		fmt.Printf("Loading config failed. error: %v", err)
+		fmt.Println("Could not check git status: ", err)
 		return
 	}
-	NIX_HOSTS_DIR = filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
-	NIX_APPS_DIR = filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+	for _, path := range untracked {
+		fmt.Printf("\nNote: %s was not tracked by git, pam added it with git add --intent-to-add so nix flakes see it\n", path)
+	}
 
-	init := setup.NewInitializer(cfg)
-	err = init.Run()
+	output, err := repo.Diff(changed, added)
 	if err != nil {
-		fmt.Printf("Setup failed. error: %v", err)
+		fmt.Println("Could not run git diff: ", err)
 		return
 	}
+	if output != "" {
+		fmt.Printf("\n%s", output)
+	}
+}
 
-	packageName := args[0]
+// changedPaths returns the files the changes actually modify
+func changedPaths(changes []diff.Change) []string {
+	var paths []string
+	for _, change := range changes {
+		if change.Old != change.New {
+			paths = append(paths, change.Path)
+		}
+	}
+	return paths
+}
 
-	var packages search.SearchResult
-	var searchErr error
+// runHooks runs the hooks of event, then the plugins configured for it, with the packages,
+// hosts and files of the install
+func runHooks(ctx context.Context, cfg *internal.Config, event string, summary *installer.Summary) error {
+	configured, pluginNames := cfg.Hooks.PreInstall, cfg.Plugins.PreInstall
+	if event == hooks.PostInstall {
+		configured, pluginNames = cfg.Hooks.PostInstall, cfg.Plugins.PostInstall
+	}
+	commands := hooks.Commands(cfg.FlakePath, configured, event)
+	pluginCommands, err := pluginHooks(pluginNames, event)
+	if err != nil {
+		return err
+	}
+	commands = append(commands, pluginCommands...)
+	if len(commands) == 0 {
+		return nil
+	}
 
-	err = spinner.New().
-		Title("Searching nix pkgs...").
-		Action(func() {
-			packages, searchErr = search.SearchPackages(packageName, targetSystem)
-		}).
-		Run()
+	hookContext := hooks.Context{
+		Event:    event,
+		Flake:    cfg.FlakePath,
+		Packages: []hooks.Package{},
+		Hosts:    append([]string{}, summary.Hosts...),
+		Files:    append([]string{}, changedPaths(summary.Changes)...),
+	}
+	for _, result := range summary.Results {
+		hookContext.Packages = append(hookContext.Packages, hooks.Package{
+			Name:     result.Package.PName,
+			Attr:     result.Package.FullPath,
+			Version:  result.Package.Version,
+			Category: result.Category,
+			Module:   result.ModuleFile,
+		})
+	}
+	return hooks.Run(ctx, runner, commands, hookContext)
+}
+
+// formatFiles runs the formatter setting on the nix files among paths. Failing to
+// format only warns, the files are written already.
+func formatFiles(ctx context.Context, cfg *internal.Config, paths []string) {
+	command, err := format.Command(cfg.Formatter, cfg.FlakePath, runner.LookPath)
+	if err == nil {
+		var formatted []string
+		formatted, err = format.Files(ctx, runner, cfg.FlakePath, command, paths)
+		if len(formatted) > 0 {
+			slog.Debug(fmt.Sprintf("Formatted %s with %s", strings.Join(formatted, ", "), strings.Join(command, " ")))
+		}
+	}
 	if err != nil {
-		fmt.Println("Error running spinner: ", err)
-		return
+		fmt.Fprintln(messageOut(), "Warning: could not format the changed files: ", err)
 	}
+}
 
-	if searchErr != nil {
-		fmt.Println("Error: ", searchErr)
+// autoCommit commits the files a command changed when git_auto_commit is enabled and
+// --no-commit isn't set. Failing to commit only warns, the files are written already.
+func autoCommit(cfg *internal.Config, message string, paths []string) {
+	if !cfg.GitAutoCommit || noCommit || len(paths) == 0 {
+		return
+	}
+	repo := gitops.NewRepo(cfg.FlakePath)
+	if !repo.IsRepo() {
+		fmt.Fprintf(messageOut(), "Warning: not committing, %s is not a git repository\n", cfg.FlakePath)
 		return
 	}
 
-	filteredPkgs := search.FilterAndPrioritizePackages(packages, showAll)
-
-	if len(filteredPkgs) == 0 {
-		fmt.Println("No packages found")
+	err := repo.Commit(message, paths...)
+	if err != nil {
+		fmt.Println("Could not commit changes: ", err)
 		return
 	}
+	slog.Info("Committed: " + message)
+}
 
-	pkgOptions := make([]huh.Option[*types.Package], len(filteredPkgs))
-	for i := range filteredPkgs {
-		pkg := &filteredPkgs[i]
-		label := ui.FormatPackageOption(pkg)
-		pkgOptions[i] = huh.NewOption(label, pkg)
+// updateLock applies edit to the flake's pam.lock.json and saves it, backing up the previous
+// version first. It returns the lock file to commit, failing to update it only warns.
+func updateLock(cfg *internal.Config, snapshot *backup.Snapshot, edit func(lock *lockfile.Lock)) []string {
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err == nil {
+		edit(lock)
+		// Don't create a lock file that would record nothing
+		if _, statErr := os.Stat(lock.File()); lock.Empty() && os.IsNotExist(statErr) {
+			return nil
+		}
+		err = backupFile(snapshot, lock.File())
+	}
+	if err == nil {
+		err = lock.Save()
 	}
+	if err != nil {
+		failf("Could not update %s: %v\n", lockfile.FileName, err)
+		return nil
+	}
+	return []string{lock.File()}
+}
 
-	hostDirs, err := ui.GetDirNames(NIX_HOSTS_DIR)
+// registerFlake shows the change passing mkApp and isLinux in flake.nix and writes it once
+// confirmed. It returns the paths written, for autoCommit.
+func registerFlake(init *setup.Initializer, dryRun bool) []string {
+	change, err := init.Registration()
 	if err != nil {
-		fmt.Println("Failed to read nix modules directory: ", err)
-		return
+		fmt.Fprintln(messageOut(), "Warning: could not check that flake.nix passes mkApp to your modules: ", err)
+		return nil
+	}
+	if change.Old == change.New {
+		return nil
 	}
 
-	hostOptions := huh.NewOptions(hostDirs...)
+	fmt.Println("flake.nix doesn't pass mkApp and isLinux to your modules, the modules pam generates need both:")
+	display := change
+	display.Path = "flake.nix"
+	fmt.Print(diff.Colorize(diff.Unified(display)))
+	if dryRun {
+		return nil
+	}
 
-	var selectedPkg *types.Package
-	var selectedHosts []string
-	var openAfterWriting bool
+	register := true
+	if !assumeYes {
+		err = huh.NewConfirm().Title("Add them to flake.nix?").Value(&register).Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return nil
+		}
+	}
+	if !register {
+		fmt.Println("Left flake.nix unchanged, add mkApp and isLinux to specialArgs before rebuilding")
+		return nil
+	}
 
-	err = huh.NewForm(
-		huh.NewGroup(
-			huh.NewSelect[*types.Package]().
-				Title("Select a package to install").
-				Options(pkgOptions...).
-				Value(&selectedPkg),
-		)).Run()
+	snapshot := beginBackup("register mkApp in flake.nix")
+	defer commitBackup(snapshot)
+	err = backupFile(snapshot, change.Path)
 	if err != nil {
-		fmt.Println("Form cancelled or error: ", err)
-		return
+		printError("Error: ", err)
+		return nil
 	}
-
-	selectedFolder, err := selectFolderRecursively(NIX_APPS_DIR)
+	err = fsx.WriteFileAtomic(change.Path, []byte(change.New), 0o644)
 	if err != nil {
-		fmt.Println("Selecting folders failed, error: ", err)
+		printError("Could not write flake.nix: ", err)
+		return nil
+	}
+	logChanges(filepath.Dir(change.Path), []diff.Change{change})
+	return []string{change.Path}
+}
+
+// lockInstall records the installed packages in the lock file
+func lockInstall(cfg *internal.Config, lock *lockfile.Lock, results []installer.Result, templateName string) {
+	for _, result := range results {
+		if result.Moves != nil {
+			if moved, err := lockfile.RelativeModule(cfg.FlakePath, result.Moves.Module.Path); err == nil {
+				lock.Remove(moved)
+			}
+		}
+		module, err := lockfile.RelativeModule(cfg.FlakePath, result.ModuleFile)
+		if err != nil {
+			continue
+		}
+		header, _, _ := modules.Module{Path: result.ModuleFile}.Header()
+
+		hostNames := make([]string, len(result.Hosts))
+		for i, host := range result.Hosts {
+			hostNames[i] = host.Name
+		}
+		// Hosts enabled by an earlier install of the same module stay recorded
+		if existing, ok := lock.Get(module); ok {
+			for _, host := range existing.Hosts {
+				if !slices.Contains(hostNames, host) {
+					hostNames = append(hostNames, host)
+				}
+			}
+		}
+		slices.Sort(hostNames)
+
+		lock.Put(lockfile.Package{
+			Name:        result.Package.PName,
+			Attr:        result.Package.FullPath,
+			Version:     result.Package.Version,
+			Input:       header.Input,
+			Source:      header.Source,
+			Category:    result.Category,
+			Hosts:       hostNames,
+			Systems:     result.Package.Systems(),
+			Module:      module,
+			Template:    templateName,
+			Extras:      result.Package.Extras,
+			Hash:        lockfile.Hash([]byte(result.Generated)),
+			InstalledAt: time.Now(),
+		})
+	}
+}
+
+// installSummary describes an install for its commit message, e.g. "add firefox, vim to browsers"
+func installSummary(results []installer.Result) string {
+	var categories []string
+	names := map[string][]string{}
+	for _, result := range results {
+		if _, ok := names[result.Category]; !ok {
+			categories = append(categories, result.Category)
+		}
+		names[result.Category] = append(names[result.Category], result.Package.PName)
+	}
+
+	parts := make([]string, len(categories))
+	for i, category := range categories {
+		parts[i] = strings.Join(names[category], ", ")
+		// Plain installs have no category
+		if category != "" {
+			parts[i] += " to " + category
+		}
+	}
+	return "add " + strings.Join(parts, ", ")
+}
+
+// logChanges logs the diff of every file the changes modify, shown with --verbose
+func logChanges(flakePath string, changes []diff.Change) {
+	for _, change := range changes {
+		if change.Old == change.New {
+			continue
+		}
+		if rel, err := filepath.Rel(flakePath, change.Path); err == nil {
+			change.Path = rel
+		}
+		slog.Debug("wrote " + change.Path + "\n" + strings.TrimRight(diff.Unified(change), "\n"))
+	}
+}
+
+// printChanges renders the changes of a dry run as colored diffs, with paths relative to the flake
+func printChanges(flakePath string, changes []diff.Change) {
+	if jsonOutput() {
+		printJSON(dryRunJSON{DryRun: true, Changes: newChangesJSON(flakePath, changes)})
 		return
 	}
+	for _, change := range changes {
+		if rel, err := filepath.Rel(flakePath, change.Path); err == nil {
+			change.Path = rel
+		}
+		fmt.Print(diff.Colorize(diff.Unified(change)))
+	}
+	fmt.Println("Dry run, nothing was written")
+}
 
-	err = huh.NewForm(
-		huh.NewGroup(
-			huh.NewMultiSelect[string]().
-				Title("Select hosts").
-				Description("Space to toggle, Enter to confirm").
-				Options(hostOptions...).
-				Value(&selectedHosts),
-		),
+// pickFromHistory lets the user repeat a recent install, or takes the latest one when last is set
+func pickFromHistory(h *history.History, last bool) (history.Entry, error) {
+	recent := h.Installs()
+	if len(recent) == 0 {
+		return history.Entry{}, fmt.Errorf("no installs recorded yet, pass a package name")
+	}
+	if last {
+		return recent[0], nil
+	}
+
+	options := make([]huh.Option[int], len(recent))
+	for i, entry := range recent {
+		options[i] = huh.NewOption(entry.Label(), i)
+	}
+
+	var selected int
+	err := huh.NewForm(
 		huh.NewGroup(
-			huh.NewConfirm().
-				Title("Do you want to edit the module after adding it?").
-				Value(&openAfterWriting),
+			huh.NewSelect[int]().
+				Title("Repeat a recent install").
+				Options(options...).
+				Value(&selected),
 		),
 	).Run()
 	if err != nil {
-		fmt.Println("Form cancelled or error: ", err)
-		return
+		return history.Entry{}, err
+	}
+	return recent[selected], nil
+}
+
+// chooseProgramModules offers to enable the programs.<name> module instead of listing the
+// package, for every selection whose hosts all declare one. --program takes the module
+// without asking, --no-program and --yes without --program skip the check.
+func chooseProgramModules(ctx context.Context, cfg *internal.Config, selections []installer.Selection, plan installer.Plan) error {
+	if noProgram || plan.UseHomebrew || (assumeYes && !useProgram) {
+		return nil
+	}
+	for n, selection := range selections {
+		hostList := selection.Hosts
+		if hostList == nil {
+			hostList = plan.Hosts
+		}
+		name := selection.Package.PName
+		// Packages from a tap, the Mac App Store or Flathub aren't nix packages a program could
+		// install, and neither are interpreters built with packages
+		if len(hostList) == 0 || selection.Package.Homebrew != nil || selection.Package.Flatpak != "" || selection.Package.Wrapper != nil {
+			continue
+		}
+
+		declared := true
+		var evalErr error
+		err := withSpinner(fmt.Sprintf("Checking for a programs.%s module...", name), func() {
+			for _, host := range hostList {
+				declared, evalErr = hosts.HasProgram(ctx, nixRunner(cfg), cfg.FlakePath, host.Name, name)
+				if !declared || evalErr != nil {
+					return
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("running spinner: %w", err)
+		}
+		if evalErr != nil {
+			// Hosts that don't evaluate get the plain package, nix reports the error on rebuild
+			slog.Debug(fmt.Sprintf("not offering programs.%s: %v", name, evalErr))
+			continue
+		}
+		if !declared {
+			continue
+		}
+
+		program := useProgram
+		if !program {
+			err = huh.NewSelect[bool]().
+				Title(fmt.Sprintf("%s has a programs.%s module, how should it be installed?", name, name)).
+				Options(
+					huh.NewOption(fmt.Sprintf("Program module (programs.%s.enable = true)", name), true),
+					huh.NewOption("Plain package", false),
+				).
+				Value(&program).
+				Run()
+			if err != nil {
+				return err
+			}
+		}
+		if program {
+			pkg := *selection.Package
+			pkg.Program = name
+			selections[n].Package = &pkg
+		}
+	}
+	return nil
+}
+
+// chooseExtras asks for the override arguments, extra packages, environment variables
+// and service written into the module of every selected package
+func chooseExtras(selections []installer.Selection) error {
+	// Each answer is checked on its own, so the error shows next to it
+	check := func(answer installer.ExtrasInput) error {
+		_, err := answer.Parse()
+		return err
+	}
+	for n, selection := range selections {
+		pkg := *selection.Package
+		var input installer.ExtrasInput
+		fields := []huh.Field{
+			huh.NewText().
+				Title(fmt.Sprintf("Override arguments of %s", pkg.PName)).
+				Description("One name = value per line, e.g. withWayland = true").
+				Value(&input.Override).
+				Validate(func(value string) error { return check(installer.ExtrasInput{Override: value}) }),
+			huh.NewInput().
+				Title("Extra packages").
+				Description("nixpkgs attributes installed with it, separated by spaces").
+				Value(&input.Packages).
+				Validate(func(value string) error { return check(installer.ExtrasInput{Packages: value}) }),
+			huh.NewText().
+				Title("Environment variables").
+				Description("One NAME=value per line").
+				Value(&input.Env).
+				Validate(func(value string) error { return check(installer.ExtrasInput{Env: value}) }),
+		}
+		// Services are NixOS modules
+		if strings.Contains(pkg.System, "linux") {
+			fields = append(fields, huh.NewInput().
+				Title("Service to enable on linux hosts").
+				Description(fmt.Sprintf("Name of the services.<name> module, e.g. %s, empty for none", pkg.PName)).
+				Value(&input.Service).
+				Validate(func(value string) error { return check(installer.ExtrasInput{Service: value}) }))
+		}
+		err := huh.NewForm(huh.NewGroup(fields...)).Run()
+		if err != nil {
+			return err
+		}
+
+		pkg.Extras, err = input.Parse()
+		if err != nil {
+			return err
+		}
+		selections[n].Package = &pkg
 	}
+	return nil
+}
+
+// duplicateChoice is what to do about a module that already installs a selected package
+type duplicateChoice struct {
+	action    string
+	duplicate int
+}
 
-	modulePackage := assets.FillPackageTemplate(selectedPkg, installWithBrew)
-	modulePath := filepath.Join(NIX_APPS_DIR, selectedFolder)
-	moduleFilePath := filepath.Join(modulePath, packageName) + ".nix"
+// Choices for a package another module already installs
+const (
+	duplicateCreate = "create"
+	duplicateReuse  = "reuse"
+	duplicateMove   = "move"
+)
 
-	err = os.WriteFile(moduleFilePath, []byte(modulePackage), 0o644)
+// chooseDuplicates warns about selected packages that modules in other categories or host
+// package lists already install, and offers to reuse the module or move it to the chosen
+// category instead of writing a second one. With --yes the second module is written after
+// the warning.
+func chooseDuplicates(inst *installer.Installer, selections []installer.Selection, plan installer.Plan, hostFiles []installer.Host, policy *strict.Policy) error {
+	duplicates, err := inst.FindDuplicates(selections, plan, hostFiles)
 	if err != nil {
-		fmt.Println("could not write file: ", err)
-		return
+		return err
 	}
+	for n, selection := range selections {
+		var options []huh.Option[duplicateChoice]
+		for d, duplicate := range duplicates {
+			if duplicate.Selection != n {
+				continue
+			}
+			if duplicate.Module.Path == "" || plan.Plain || assumeYes {
+				err := policy.Warn(strict.DuplicateModule, "%s is already installed: %s", selection.Query, duplicate)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err := policy.Check(strict.DuplicateModule, "%s is already installed: %s", selection.Query, duplicate)
+			if err != nil {
+				return err
+			}
+			options = append(options,
+				huh.NewOption(fmt.Sprintf("Reuse %s", duplicate), duplicateChoice{action: duplicateReuse, duplicate: d}),
+				huh.NewOption(fmt.Sprintf("Move %s to the new category", duplicate.Module.Path), duplicateChoice{action: duplicateMove, duplicate: d}),
+			)
+		}
+		if len(options) == 0 {
+			continue
+		}
 
-	for _, host := range selectedHosts {
-		fullHostPath := filepath.Join(NIX_HOSTS_DIR, host, "configuration.nix")
-		data, err := os.ReadFile(fullHostPath)
+		options = append(options, huh.NewOption("Write a second module anyway", duplicateChoice{action: duplicateCreate}))
+		choice := options[0].Value
+		err := huh.NewSelect[duplicateChoice]().
+			Title(fmt.Sprintf("%s is already installed by another module", selection.Query)).
+			Options(options...).
+			Value(&choice).
+			Run()
 		if err != nil {
-			fmt.Println("Could not read the host configuration.nix, error: ", err)
-			return
+			return err
+		}
+		duplicate := duplicates[choice.duplicate]
+		switch choice.action {
+		case duplicateReuse:
+			// Installing into the existing module updates it in place
+			selections[n].Category = duplicate.Module.Category
+			selections[n].Query = duplicate.Module.Name
+		case duplicateMove:
+			selections[n].Moves = &duplicate
 		}
+	}
+	return nil
+}
+
+// overridePerPackage asks whether every package shares the category and hosts picked for the
+// install, and otherwise lets the user pick both again for each package
+func overridePerPackage(cfg *internal.Config, selections []installer.Selection, hostOptions []huh.Option[string], selectedHosts []string, planHosts func([]string) ([]installer.Host, error)) error {
+	shared := true
+	err := huh.NewConfirm().
+		Title("Use the same category and hosts for every package?").
+		Value(&shared).
+		Run()
+	if err != nil || shared {
+		return err
+	}
 
-		nixcfg := nixconfig.NewConfig(string(data))
+	for i := range selections {
+		selection := &selections[i]
+		fmt.Printf("Category and hosts for %s\n", selection.Package.PName)
 
-		err = nixcfg.EnsureAppsSectionExists()
+		selection.Category, err = selectCategory(cfg)
 		if err != nil {
-			fmt.Println("Error ensuring apps section: ", err)
-			return
+			return err
 		}
 
-		err = nixcfg.AddOrEnablePackage(selectedFolder, selectedPkg.PName)
+		hostNames := slices.Clone(selectedHosts)
+		err = huh.NewForm(
+			huh.NewGroup(
+				huh.NewMultiSelect[string]().
+					Title(fmt.Sprintf("Select hosts for %s", selection.Package.PName)).
+					Description("Space to toggle, Enter to confirm").
+					Options(hostOptions...).
+					Value(&hostNames),
+			),
+		).Run()
 		if err != nil {
-			fmt.Println("Error updating config: ", err)
-			return
+			return err
+		}
+		selection.Hosts, err = planHosts(hostNames)
+		if err != nil {
+			return err
+		}
+		// An empty override still means no hosts rather than the shared ones
+		if selection.Hosts == nil {
+			selection.Hosts = []installer.Host{}
+		}
+	}
+	return nil
+}
+
+// nixpkgsSearcher searches the configured flake ref and remembers the branch the user switched to.
+// Results of the extra sources are added to the nixpkgs results, tagged with their source.
+type nixpkgsSearcher struct {
+	ctx context.Context
+	// nix runs the searches, bounded by nix_timeout
+	nix    execx.Runner
+	ref    string
+	branch string
+	// nixpkgs is false when --source leaves nixpkgs out of the search
+	nixpkgs bool
+	sources []search.Source
+	// cache is nil when caching is disabled
+	cache *search.Cache
+	// prefetched holds the results of a batched search, keyed by ref and query
+	prefetched map[string]search.SearchResult
+	// indexes is nil when searches always run nix search, see pam index build
+	indexes *search.IndexStore
+	// loaded holds the index of each nixpkgs ref searched so far, nil when missing or stale
+	loaded map[string]*search.Index
+	// popularity breaks ties between equally good matches, nil without popularity_file
+	popularity search.Popularity
+	// pluginContext is what plugin sources are searched with besides the query
+	pluginContext plugins.Context
+	// systems are searched side by side when the hosts installed to run on different
+	// systems and --system isn't given. Otherwise it's nil and targetSystem is searched.
+	systems []string
+	// homebrew offers Mac App Store apps for queries nixpkgs has nothing for, see masApps
+	homebrew bool
+	// sets lists the package sets holding results, such as vimPlugins, which are searched
+	// on their own when opened. lastSet is listed first, the set installed from last.
+	sets    bool
+	lastSet string
+}
+
+// newSearcher searches the configured nixpkgs ref, or the branch given with --branch, and
+// every configured source. --source and --flake narrow the search to the given sources.
+func newSearcher(ctx context.Context, cfg *internal.Config) (*nixpkgsSearcher, error) {
+	searcher := &nixpkgsSearcher{ctx: ctx, nix: nixRunner(cfg), ref: cfg.NixpkgsRef, branch: branch, nixpkgs: true, sources: cfg.Sources, pluginContext: basePluginContext(cfg)}
+	// Sets are only opened in the selectors, results picked by flags or printed as JSON
+	// list packages alone
+	searcher.sets = !showAll && !assumeYes && !jsonOutput() && len(attrFlags) == 0 && packageIndex < 0
+	if branch != "" {
+		ref, err := search.BranchRef(branch)
+		if err != nil {
+			return nil, err
+		}
+		searcher.ref = ref
+	}
+
+	if len(sourceFlags) > 0 || len(flakeFlags) > 0 {
+		searcher.nixpkgs = false
+		searcher.sources = nil
+	}
+	for _, name := range sourceFlags {
+		if name == search.NixpkgsSource {
+			searcher.nixpkgs = true
+			continue
+		}
+		source, ok := search.FindSource(cfg.Sources, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown source %s, add it to sources in the config or pass --flake", name)
 		}
+		searcher.sources = append(searcher.sources, source)
+	}
+	for _, ref := range flakeFlags {
+		searcher.sources = append(searcher.sources, search.SourceFromRef(ref))
+	}
 
-		err = os.WriteFile(fullHostPath, []byte(nixcfg.Content()), 0o644)
+	if !noCache {
+		searcher.cache = openSearchCache(searcher.nix)
+		searcher.indexes = openIndexStore(searcher.nix)
+	}
+	if cfg.PopularityFile != "" {
+		popularity, err := search.LoadPopularity(internal.ExpandPath(cfg.PopularityFile))
 		if err != nil {
-			fmt.Println("could not write file: ", err)
-			return
+			fmt.Fprintln(messageOut(), "Warning: ranking without popularity data: ", err)
+		}
+		searcher.popularity = popularity
+	}
+	return searcher, nil
+}
+
+// openIndexStore returns the store of nixpkgs indexes, or nil when it can't be located
+func openIndexStore(nix execx.Runner) *search.IndexStore {
+	cacheDir, err := internal.CacheDir()
+	if err != nil {
+		return nil
+	}
+	return search.NewIndexStore(filepath.Join(cacheDir, "index"), nix)
+}
+
+// indexSystem is the system indexes are built and looked up for
+func indexSystem() string {
+	if targetSystem != "" {
+		return targetSystem
+	}
+	return localSystem()
+}
+
+// fromIndex searches the nixpkgs index when one was built and is still current
+func (s *nixpkgsSearcher) fromIndex(ref string, query string) (search.SearchResult, bool) {
+	if s.indexes == nil || !s.nixpkgs || ref != s.ref {
+		return nil, false
+	}
+	index, loaded := s.loaded[ref]
+	if !loaded {
+		found, ok, err := s.indexes.Load(ref, indexSystem())
+		switch {
+		case err != nil:
+			slog.Warn("ignoring the search index: " + err.Error())
+		case ok && s.indexes.Stale(s.ctx, found):
+			slog.Info("The search index is out of date, searching with nix instead. Run pam index build to refresh it")
+		case ok:
+			index = found
+		}
+		if s.loaded == nil {
+			s.loaded = map[string]*search.Index{}
+		}
+		s.loaded[ref] = index
+	}
+	if index == nil {
+		return nil, false
+	}
+	return index.Search(query), true
+}
+
+// refs returns every flake reference a search runs nix search on, plugin sources answer
+// their searches themselves
+func (s *nixpkgsSearcher) refs() []string {
+	var refs []string
+	if s.nixpkgs {
+		refs = append(refs, s.ref)
+	}
+	for _, source := range s.sources {
+		if source.Plugin == "" {
+			refs = append(refs, source.FlakeRef())
 		}
+	}
+	return refs
+}
+
+// pluginSearch asks the plugin of a source for the packages matching query on system,
+// several systems are separated by commas
+func (s *nixpkgsSearcher) pluginSearch(source search.Source, query string, system string) (search.SearchResult, error) {
+	plugin, err := plugins.Find(runner, source.Plugin)
+	if err != nil {
+		return nil, err
+	}
+	pluginContext := s.pluginContext
+	pluginContext.Query = query
+	pluginContext.System = system
+	return timeSearch(func() (search.SearchResult, error) {
+		return plugins.SearchPackages(s.ctx, s.nix, plugin, pluginContext)
+	})
+}
+
+// pluginSource returns the plugin source pkg was found in
+func (s *nixpkgsSearcher) pluginSource(pkg types.Package) (search.Source, bool) {
+	source, ok := search.FindSource(s.sources, pkg.Source)
+	return source, ok && source.Plugin != ""
+}
 
-		fmt.Printf("\nDone! please run: nixos-rebuild switch --flake %s#%s", cfg.FlakePath, host)
+// refFor returns the flake reference pkg was found in
+func (s *nixpkgsSearcher) refFor(pkg types.Package) string {
+	for _, source := range s.sources {
+		if source.Name == pkg.Source {
+			return source.FlakeRef()
+		}
 	}
+	return s.ref
+}
 
-	if openAfterWriting {
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			editor = "nvim"
+// lookupFor finds the package with the attribute path of pkg built for system, in the
+// flake pkg was found in. It shows no progress, so several lookups can run at once.
+func (s *nixpkgsSearcher) lookupFor(pkg types.Package, system string) (*types.Package, error) {
+	if source, ok := s.pluginSource(pkg); ok {
+		result, err := s.pluginSearch(source, pkg.FullPath, system)
+		if err != nil {
+			return nil, err
 		}
-		editorCmd := exec.Command(editor, moduleFilePath)
-		editorCmd.Stdin = os.Stdin
-		editorCmd.Stdout = os.Stdout
-		editorCmd.Stderr = os.Stderr
-		err := editorCmd.Run()
+		return matchAttr(result, pkg), nil
+	}
+	ref := s.refFor(pkg)
+	// nix search takes a regex, the attr path must match literally
+	query := regexp.QuoteMeta(pkg.FullPath)
+	var key string
+	var result search.SearchResult
+	var cached bool
+	if s.cache != nil {
+		key = s.cache.Key(s.ctx, ref, query, system)
+		result, cached = s.cache.Get(key)
+		usage.RecordCache(cached)
+	}
+	if !cached {
+		var err error
+		result, err = timeSearch(func() (search.SearchResult, error) {
+			return search.SearchPackages(s.ctx, s.nix, ref, query, system)
+		})
 		if err != nil {
-			fmt.Println("Error opening editor: ", err)
+			return nil, err
+		}
+		if s.cache != nil {
+			if err := s.cache.Put(key, result); err != nil {
+				slog.Warn("could not cache search results: " + err.Error())
+			}
+		}
+	}
+	return matchAttr(result, pkg), nil
+}
+
+// matchAttr returns the package of result with the attribute path of pkg, nil when there is none
+func matchAttr(result search.SearchResult, pkg types.Package) *types.Package {
+	for _, candidate := range search.FilterAndPrioritizePackages(result, true) {
+		if candidate.FullPath == pkg.FullPath {
+			candidate.Source = pkg.Source
+			return &candidate
+		}
+	}
+	return nil
+}
+
+// hostSystems detects the system of every host once
+func hostSystems(cfg *internal.Config) func(host string) string {
+	detected := map[string]string{}
+	return func(host string) string {
+		system, ok := detected[host]
+		if !ok {
+			system = hosts.DetectSystem(cfg.FlakePath, NIX_HOSTS_DIR, host)
+			detected[host] = system
+		}
+		return system
+	}
+}
+
+// hostSystemList returns the distinct known systems of the hosts
+func hostSystemList(hostNames []string, systemOf func(host string) string) []string {
+	var systems []string
+	for _, host := range hostNames {
+		if system := systemOf(host); system != "" && !slices.Contains(systems, system) {
+			systems = append(systems, system)
+		}
+	}
+	return systems
+}
+
+// commonSystem returns the system every host shares, "" when they differ or one is unknown
+func commonSystem(hostNames []string, systemOf func(host string) string) string {
+	common := ""
+	for n, host := range hostNames {
+		system := systemOf(host)
+		if system == "" || (n > 0 && system != common) {
+			return ""
+		}
+		common = system
+	}
+	return common
+}
+
+// cacheSystem is the system results are cached under, all of them joined for a search
+// across several systems
+func (s *nixpkgsSearcher) cacheSystem() string {
+	if len(s.systems) > 1 {
+		return strings.Join(s.systems, ",")
+	}
+	return targetSystem
+}
+
+// searchQuietly runs one search without showing the nix log, across every system at once
+// when the hosts differ in system
+func (s *nixpkgsSearcher) searchQuietly(ref string, query string) (search.SearchResult, error) {
+	return timeSearch(func() (search.SearchResult, error) {
+		if len(s.systems) > 1 {
+			return search.SearchSystems(s.ctx, s.nix, ref, query, s.systems)
+		}
+		return search.SearchPackages(s.ctx, s.nix, ref, query, targetSystem)
+	})
+}
+
+// searchSystems searches ref for query on every system of s.systems at once behind a
+// spinner, reusing cached results
+func (s *nixpkgsSearcher) searchSystems(ref string, query string) (search.SearchResult, error) {
+	var key string
+	if s.cache != nil {
+		key = s.cache.Key(s.ctx, ref, query, s.cacheSystem())
+		packages, ok := s.cache.Get(key)
+		usage.RecordCache(ok)
+		if ok {
+			return packages, nil
+		}
+	}
+
+	var packages search.SearchResult
+	var searchErr error
+	err := withSpinner(fmt.Sprintf("Searching %s for %s...", ref, strings.Join(s.systems, " and ")), func() {
+		packages, searchErr = s.searchQuietly(ref, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Put(key, packages); err != nil {
+			fmt.Fprintln(messageOut(), "Warning: could not cache search results: ", err)
+		}
+	}
+	return packages, nil
+}
+
+func prefetchKey(ref string, query string) string {
+	return ref + "\x00" + query
+}
+
+// Prefetch searches every query at once behind a single spinner, so installing several
+// packages doesn't wait for one search after another. Failed searches are left for
+// Search to run again and report.
+func (s *nixpkgsSearcher) Prefetch(queries []string) {
+	type refQuery struct{ ref, query string }
+	var pending []refQuery
+	for _, ref := range s.refs() {
+		for _, query := range queries {
+			// Pinned versions, flake references and taps aren't searched
+			if isPinned(query) || isFlakeRef(query) || isTap(query) {
+				continue
+			}
+			if _, ok := s.fromIndex(ref, query); ok {
+				continue
+			}
+			if s.cache != nil {
+				if _, ok := s.cache.Get(s.cache.Key(s.ctx, ref, query, s.cacheSystem())); ok {
+					continue
+				}
+			}
+			if !slices.Contains(pending, refQuery{ref, query}) {
+				pending = append(pending, refQuery{ref, query})
+			}
+		}
+	}
+	// A single search keeps its own spinner
+	if len(pending) < 2 {
+		return
+	}
+
+	results := make([]search.SearchResult, len(pending))
+	errs := make([]error, len(pending))
+	err := withSpinner(fmt.Sprintf("Running %d searches...", len(pending)), func() {
+		var wg sync.WaitGroup
+		for i, item := range pending {
+			wg.Go(func() {
+				results[i], errs[i] = s.searchQuietly(item.ref, item.query)
+			})
+		}
+		wg.Wait()
+	})
+	if err != nil {
+		return
+	}
+
+	if s.prefetched == nil {
+		s.prefetched = map[string]search.SearchResult{}
+	}
+	for i, item := range pending {
+		if s.cache != nil {
+			usage.RecordCache(false)
+		}
+		if errs[i] != nil {
+			continue
+		}
+		s.prefetched[prefetchKey(item.ref, item.query)] = results[i]
+		if s.cache != nil {
+			if err := s.cache.Put(s.cache.Key(s.ctx, item.ref, item.query, s.cacheSystem()), results[i]); err != nil {
+				fmt.Fprintln(messageOut(), "Warning: could not cache search results: ", err)
+			}
+		}
+	}
+}
+
+// lookup returns the raw results of one flake, prefetched, cached or freshly searched
+func (s *nixpkgsSearcher) lookup(ref string, query string) (search.SearchResult, error) {
+	if packages, ok := s.prefetched[prefetchKey(ref, query)]; ok {
+		return packages, nil
+	}
+	if packages, ok := s.fromIndex(ref, query); ok {
+		usage.RecordIndexHit()
+		return packages, nil
+	}
+	if len(s.systems) > 1 {
+		return s.searchSystems(ref, query)
+	}
+	return cachedSearch(s.ctx, s.nix, s.cache, ref, query, targetSystem)
+}
+
+func (s *nixpkgsSearcher) Search(query string) ([]types.Package, error) {
+	var found, sets []types.Package
+	if s.nixpkgs {
+		packages, err := s.lookup(s.ref, query)
+		if err != nil {
+			return nil, err
+		}
+		found = search.FilterAndPrioritizePackages(packages, showAll)
+		sets = s.packageSets(packages, "")
+	}
+
+	for _, source := range s.sources {
+		var packages search.SearchResult
+		var err error
+		if source.Plugin != "" {
+			packages, err = s.pluginSearch(source, query, s.cacheSystem())
+		} else {
+			packages, err = s.lookup(source.FlakeRef(), query)
+		}
+		if err != nil {
+			// One unreachable source shouldn't hide the results of the others
+			if len(s.sources) > 1 || s.nixpkgs {
+				fmt.Fprintf(messageOut(), "Warning: searching %s failed: %v\n", source.Name, err)
+				continue
+			}
+			return nil, err
+		}
+		tagged := search.FilterAndPrioritizePackages(packages, showAll)
+		search.Tag(tagged, source.Name)
+		found = append(found, tagged...)
+		if source.Plugin == "" {
+			sets = append(sets, s.packageSets(packages, source.Name)...)
+		}
+	}
+	if len(found) == 0 && len(sets) == 0 {
+		// Darwin hosts may install the app from the Mac App Store instead
+		return s.masApps(query), nil
+	}
+	// Rank across sources, so an exact match from a source comes before a loose one from nixpkgs
+	return s.withSets(search.RankBy(found, query, s.popularity), sets), nil
+}
+
+// cachedSearch reuses cached results for the search when possible, a nil cache always searches
+func cachedSearch(ctx context.Context, nix execx.Runner, cache *search.Cache, ref string, query string, system string) (search.SearchResult, error) {
+	var key string
+	if cache != nil {
+		key = cache.Key(ctx, ref, query, system)
+		packages, ok := cache.Get(key)
+		usage.RecordCache(ok)
+		if ok {
+			return packages, nil
+		}
+	}
+
+	packages, err := timeSearch(func() (search.SearchResult, error) {
+		return searchWithProgress(ctx, nix, ref, query, system)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		if err := cache.Put(key, packages); err != nil {
+			fmt.Fprintln(messageOut(), "Warning: could not cache search results: ", err)
+		}
+	}
+	return packages, nil
+}
+
+// openSearchCache returns the on-disk search cache, or nil with a warning when it can't be located
+func openSearchCache(nix execx.Runner) *search.Cache {
+	cacheDir, err := internal.CacheDir()
+	if err != nil {
+		fmt.Fprintln(messageOut(), "Warning: search cache disabled: ", err)
+		return nil
+	}
+	return search.NewCache(filepath.Join(cacheDir, "search"), search.DefaultCacheTTL, nix)
+}
+
+func (s *nixpkgsSearcher) switchBranch() {
+	s.branch = search.OtherBranch(s.branch)
+	s.ref, _ = search.BranchRef(s.branch)
+}
+
+// isPinned reports whether query asks for a version, such as firefox@119
+func isPinned(query string) bool {
+	if isFlakeRef(query) || isTap(query) {
+		// git+ssh://git@host/repo and owner/repo/python@3.12 have no version
+		return false
+	}
+	_, version := search.SplitVersion(query)
+	return version != ""
+}
+
+// isFlakeRef reports whether query names a package of a flake, such as github:owner/repo#tool
+func isFlakeRef(query string) bool {
+	_, _, ok := search.SplitFlakeRef(query)
+	return ok
+}
+
+// flakeRefQueries turns the packages given with --flake-ref into flake references, the
+// flake's default package when none is given
+func flakeRefQueries(ref string, args []string) []string {
+	if ref == "" {
+		return args
+	}
+	if len(args) == 0 {
+		return []string{ref + "#default"}
+	}
+	queries := make([]string, len(args))
+	for i, arg := range args {
+		queries[i] = ref + "#" + arg
+	}
+	return queries
+}
+
+// fromFlake evaluates a package named by flake reference for the systems of the hosts and
+// adds the flake to the searcher's sources, so it is registered as a flake input. A flake
+// the config or flake.nix already has as an input is referenced through that input.
+func fromFlake(ctx context.Context, cfg *internal.Config, searcher *nixpkgsSearcher) func(ref string, attr string) (*types.Package, error) {
+	return func(ref string, attr string) (*types.Package, error) {
+		source := search.SourceFromRef(ref)
+		for _, configured := range cfg.Sources {
+			if configured.FlakeRef() == ref {
+				source = configured
+			}
+		}
+		if flake, err := readFlake(cfg); err == nil {
+			for _, input := range flake.Inputs() {
+				if input.URL == ref {
+					source = search.Source{Name: input.Name, Ref: ref}
+				}
+			}
+		}
+
+		systems := searcher.systems
+		if len(systems) == 0 {
+			systems = []string{indexSystem()}
+		}
+		var found *types.Package
+		var err error
+		spinErr := withSpinner(fmt.Sprintf("Evaluating %s#%s...", ref, attr), func() {
+			for _, system := range systems {
+				pkg, evalErr := search.FlakePackage(ctx, searcher.nix, ref, attr, system)
+				if evalErr != nil {
+					err = evalErr
+					continue
+				}
+				if found == nil {
+					found = &pkg
+					continue
+				}
+				found.System += "," + system
+			}
+		})
+		if spinErr != nil {
+			return nil, spinErr
+		}
+		if found == nil {
+			return nil, err
+		}
+		if err != nil {
+			fmt.Fprintf(messageOut(), "Warning: %s is only installed for %s: %v\n", found.PName, found.System, err)
+		}
+
+		found.Source = source.Name
+		if _, ok := search.FindSource(searcher.sources, source.Name); !ok {
+			searcher.sources = append(searcher.sources, source)
+		}
+		slog.Info(fmt.Sprintf("Installing %s %s from %s without searching", found.PName, found.Version, ref))
+		return found, nil
+	}
+}
+
+// pinVersion finds versions in the configured nixpkgs revisions, then on nixhub, and
+// adds the revision to the searcher's sources so it is registered as a flake input
+func pinVersion(ctx context.Context, cfg *internal.Config, searcher *nixpkgsSearcher) func(name string, version string) (*types.Package, error) {
+	resolver := &search.PinResolver{Revisions: cfg.NixpkgsRevisions, Runner: searcher.nix, URL: search.NixhubURL}
+	return func(name string, version string) (*types.Package, error) {
+		system := indexSystem()
+		var pin search.Pin
+		var err error
+		spinErr := withSpinner(fmt.Sprintf("Looking for %s %s...", name, version), func() {
+			pin, err = resolver.Resolve(ctx, name, version, system)
+		})
+		if spinErr != nil {
+			return nil, spinErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		slog.Info(fmt.Sprintf("Pinned %s %s from nixpkgs %s", name, pin.Version, pin.Rev))
+		searcher.sources = append(searcher.sources, pin.Source())
+		pkg := pin.Package(system)
+		return &pkg, nil
+	}
+}
+
+// pickPackage prompts for one of the candidates to install or run, offering to search the
+// other branch instead. With multi several candidates can be marked and installed together.
+func pickPackage(searcher *nixpkgsSearcher, policy *strict.Policy, choice installer.Choice, action string, multi bool) installer.Picker {
+	return func(query string, candidates []types.Package) ([]types.Package, error) {
+		pkg, err := choice.Pick(query, candidates)
+		if err != nil {
+			return nil, err
+		}
+		if pkg != nil {
+			return []types.Package{*pkg}, nil
+		}
+
+		otherBranch := search.OtherBranch(searcher.branch)
+
+		if len(candidates) == 0 {
+			fmt.Printf("No packages found for %s\n", query)
+
+			var switchBranch bool
+			err := huh.NewConfirm().
+				Title(fmt.Sprintf("Search %s nixpkgs instead?", otherBranch)).
+				Value(&switchBranch).
+				Run()
+			if err != nil {
+				return nil, err
+			}
+			if !switchBranch {
+				return nil, fmt.Errorf("no packages found")
+			}
+			searcher.switchBranch()
+			return nil, installer.ErrRetry
+		}
+
+		if _, ok := search.BestMatch(candidates, query); !ok {
+			err = policy.Check(strict.AmbiguousSearch, "no clear best match for '%s' among %d results", query, len(candidates))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// The picker shows the full metadata of the highlighted package before it is chosen
+		picked, switchBranch, err := ui.PickPackages(fmt.Sprintf("Select a package to %s for %s", action, query), query, candidates, func(pkg types.Package) (search.Meta, error) {
+			return searcher.fetchMeta(pkg)
+		}, searcher.setSearcher(), otherBranch, multi)
+		if err != nil {
+			return nil, err
+		}
+		if switchBranch {
+			searcher.switchBranch()
+			return nil, installer.ErrRetry
+		}
+		if len(picked) == 0 {
+			return nil, &ui.UserCancelled{Action: "Package selection"}
+		}
+		return picked, nil
+	}
+}
+
+func install(cmd *cobra.Command, args []string) {
+	args = flakeRefQueries(flakeRefFlag, args)
+	if workspaceFlag != "" {
+		installWorkspace(cmd, args)
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	NIX_HOSTS_DIR = filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	NIX_APPS_DIR = filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+	// A plain layout lists packages directly, so it needs neither mkApp nor its registration
+	var registeredPaths []string
+	if !cfg.Plain() {
+		init := setup.NewInitializer(cfg)
+		err = init.Run()
+		if err != nil {
+			printError("Setup failed. error:", err)
+			return
+		}
+		registeredPaths = registerFlake(init, dryRun)
+	} else if installWithBrew {
+		failf("Error: --brew needs the modules layout, Homebrew casks are installed through mkApp\n")
+		return
+	} else if useFlatpak {
+		failf("Error: --flatpak needs the modules layout, flatpaks are installed through mkApp\n")
+		return
+	} else if useWrapper {
+		failf("Error: --wrap needs the modules layout, interpreters with packages are installed through mkApp\n")
+		return
+	}
+
+	if confirmEach {
+		if assumeYes {
+			failf("Error: --confirm-each asks about every package and can't be used with --yes\n")
+			return
+		}
+		if !terminal() {
+			failf("Error: --confirm-each asks about every package and needs a terminal, use --yes in scripts\n")
+			return
+		}
+	}
+
+	policy := strict.NewPolicy(strictMode, messageOut())
+	if allowUnfree {
+		policy.Allow(strict.UnfreePackage)
+	}
+	if allowBroken {
+		policy.Allow(strict.BrokenPackage)
+	}
+
+	editorMode, err := installer.ResolveEditorMode(cfg.OpenAfterInstall, editorAfter, noEditor)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	if assumeYes {
+		// The category may choose the hosts in the config
+		if (categoryFlag == "" && !cfg.Plain()) || (len(hostFlags) == 0 && len(cfg.Category(categoryFlag).Hosts) == 0) {
+			failf("Error: --yes needs --category and at least one --host\n")
+			return
+		}
+		if len(args) == 0 && !repeatLast {
+			failf("Error: --yes needs a package name or --last\n")
+			return
+		}
+		if askExtras {
+			failf("Error: --extras asks for its values and can't be used with --yes\n")
+			return
+		}
+		// Nothing may prompt in non-interactive mode
+		if editorMode == installer.EditorAsk {
+			editorMode = installer.EditorNever
+		}
+	}
+
+	if askExtras && (cfg.Plain() || installWithBrew) {
+		failf("Error: --extras writes into pam modules, which the plain layout and Homebrew don't use\n")
+		return
+	}
+
+	appsFileOverrides, err := hosts.ParseAppsFileFlags(appsFiles)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	installHistory, err := loadHistory()
+	if err != nil {
+		printError("Could not load history: ", err)
+		return
+	}
+
+	// One package is picked together with its category and hosts in the wizard, unless
+	// flags decide the package or strict mode has to check the search
+	useWizard := !assumeYes && !strictMode && len(args) <= 1 && len(attrFlags) == 0 && !cmd.Flags().Changed("package-index") &&
+		!slices.ContainsFunc(args, isPinned) && !slices.ContainsFunc(args, isFlakeRef) && !slices.ContainsFunc(args, isTap)
+
+	hostDirs, err := ui.GetDirNames(NIX_HOSTS_DIR)
+	if err != nil {
+		printError("Failed to read nix modules directory: ", err)
+		return
+	}
+	hostFlags, err = internal.ExpandHosts(hostFlags, cfg.HostGroupsOf(hostDirs))
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	queries := args
+	selectedHosts := hostFlags
+	// Without installs to repeat the wizard asks for the package instead
+	if (len(args) == 0 && (!useWizard || len(installHistory.Installs()) > 0)) || repeatLast {
+		entry, err := pickFromHistory(installHistory, repeatLast)
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		queries = []string{entry.Query}
+		// Hosts of the repeated install start out selected
+		if len(hostFlags) == 0 {
+			selectedHosts = entry.Hosts
+		}
+	}
+
+	// Search for the system of the hosts given on the command line unless --system overrides it
+	systemOf := hostSystems(cfg)
+	if targetSystem == "" {
+		targetSystem = commonSystem(hostFlags, systemOf)
+	}
+
+	searcher, err := newSearcher(cmd.Context(), cfg)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	// Darwin hosts may get what nixpkgs doesn't have from the Mac App Store
+	searcher.homebrew = !cfg.Plain()
+	if categoryFlag != "" {
+		searcher.lastSet, _ = installHistory.LastSet(categoryFlag)
+	}
+	// Hosts of different systems are searched for all of them at once, instead of
+	// looking up the other systems one after another once a package is chosen
+	if targetSystem == "" {
+		if systems := hostSystemList(hostFlags, systemOf); len(systems) > 1 {
+			searcher.systems = systems
+		}
+	}
+
+	choice := installer.Choice{
+		Attrs:           attrFlags,
+		Index:           packageIndex,
+		AcceptBestMatch: assumeYes,
+	}
+	if cmd.Flags().Changed("show-diff") {
+		cfg.ShowDiff = showDiff
+	}
+	inst := &installer.Installer{
+		ModulesDir: NIX_APPS_DIR,
+		Namespace:  cfg.Namespace(),
+		Searcher:   searcher,
+		Pick:       pickPackage(searcher, policy, choice, "install", true),
+		Policy:     policy,
+		DryRun:     dryRun,
+		Validator:  nixvalidate.Default(),
+	}
+	if repo := gitops.NewRepo(cfg.FlakePath); repo.IsRepo() {
+		inst.Git = repo
+		// Auto-commit and the diff add the new modules to git
+		inst.TrackNew = (cfg.GitAutoCommit && !noCommit) || (cfg.ShowDiff && !jsonOutput())
+	}
+	inst.Pin = pinVersion(cmd.Context(), cfg, searcher)
+	inst.FromFlake = fromFlake(cmd.Context(), cfg, searcher)
+	inst.FromTap = fromTap(cfg, searcher)
+	inst.Conflict, err = moduleConflicts(cfg.Editor)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	for _, host := range hostFlags {
+		if !slices.Contains(hostDirs, host) {
+			failf("Error: unknown host %s, available hosts: %s\n", host, strings.Join(hostDirs, ", "))
+			return
+		}
+	}
+
+	hostGroups := cfg.HostGroupsOf(hostDirs)
+	hostOptions := hostOptionsWithGroups(hostGroups, hostDirs)
+
+	availableTemplates, err := listTemplates(cmd.Context(), cfg)
+	if err != nil {
+		printError("Failed to read templates: ", err)
+		return
+	}
+	templateName := templateFlag
+
+	var openAfterWriting bool
+	selectedFolder := categoryFlag
+	warnUndeclaredCategory(cfg, selectedFolder)
+
+	var selections []installer.Selection
+	if useWizard {
+		options := ui.WizardOptions{
+			Search:      searcher.Search,
+			AskEditor:   editorMode == installer.EditorAsk,
+			FetchMeta:   searcher.fetchMeta,
+			SearchSet:   searcher.setSearcher(),
+			OtherBranch: search.OtherBranch(searcher.branch),
+			SwitchBranch: func() string {
+				searcher.switchBranch()
+				return search.OtherBranch(searcher.branch)
+			},
+			Selected: selectedHosts,
+		}
+		if len(queries) > 0 {
+			options.Query = queries[0]
+		}
+		if selectedFolder == "" && !cfg.Plain() {
+			options.ModulesDir = NIX_APPS_DIR
+			if cfg.CategorySchema != nil {
+				warnUndeclaredCategories(cfg)
+				options.Categories = cfg.CategorySchema.Names()
+			}
+		}
+		if len(hostFlags) == 0 {
+			options.Hosts = hostDirs
+			options.HostGroups = hostGroupList(hostGroups)
+			options.CategoryHosts = func(category string) ([]string, []string) {
+				return cfg.CategoryHosts(category, hostDirs)
+			}
+		}
+		if templateName == "" && !cfg.Plain() {
+			for _, template := range availableTemplates {
+				options.Templates = append(options.Templates, template.Name)
+			}
+		}
+
+		searcher.Prefetch(queries)
+		inWizard = true
+		result, err := ui.RunWizard(options)
+		inWizard = false
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+		if result == nil {
+			cancel("Install")
+			return
+		}
+		selections = installer.Selections(result.Query, result.Packages)
+		queries = nil
+		for _, selection := range selections {
+			queries = append(queries, selection.Query)
+		}
+		if options.ModulesDir != "" {
+			selectedFolder = result.Category
+		}
+		if len(options.Hosts) > 0 {
+			selectedHosts = result.Hosts
+		}
+		if len(options.Templates) > 1 {
+			templateName = result.Template
+		}
+		openAfterWriting = result.OpenEditor
+	} else {
+		searcher.Prefetch(queries)
+		selections, err = inst.Resolve(queries)
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+
+	// Packages of other flakes are referenced through their flake input
+	var sources []string
+	for _, selection := range selections {
+		if source := selection.Package.Source; source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	registeredPaths = append(registeredPaths, registerInputs(cfg, searcher, sources, dryRun)...)
+
+	if selectedFolder == "" && !cfg.Plain() && !useWizard {
+		selectedFolder, err = selectCategory(cfg)
+		if err != nil {
+			printError("Selecting folders failed, error: ", err)
+			return
+		}
+	}
+
+	if len(hostFlags) == 0 && !useWizard {
+		// The category's hosts start out selected, and hosts it excludes aren't offered
+		categoryHosts, categorySelected := cfg.CategoryHosts(selectedFolder, hostDirs)
+		hostGroups = cfg.HostGroupsOf(categoryHosts)
+		hostOptions = hostOptionsWithGroups(hostGroups, categoryHosts)
+		if len(selectedHosts) == 0 {
+			selectedHosts = categorySelected
+		}
+		selectedHosts = slices.DeleteFunc(slices.Clone(selectedHosts), func(host string) bool {
+			return !slices.Contains(categoryHosts, host)
+		})
+	}
+
+	var groups []*huh.Group
+	if len(hostFlags) == 0 && !useWizard && !assumeYes {
+		groups = append(groups, huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Select hosts").
+				Description("Space to toggle, Enter to confirm").
+				Options(hostOptions...).
+				Value(&selectedHosts),
+		))
+	}
+	if templateName == "" && len(availableTemplates) > 1 && !assumeYes && !cfg.Plain() && !useWizard {
+		templateOptions := make([]huh.Option[string], len(availableTemplates))
+		for i, template := range availableTemplates {
+			templateOptions[i] = huh.NewOption(template.Name, template.Name)
+		}
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Select a module template").
+				Options(templateOptions...).
+				Value(&templateName),
+		))
+	}
+	if editorMode == installer.EditorAsk && !useWizard {
+		groups = append(groups, huh.NewGroup(
+			huh.NewConfirm().
+				Title("Do you want to edit the module after adding it?").
+				Value(&openAfterWriting),
+		))
+	}
+	if len(groups) > 0 {
+		err = huh.NewForm(groups...).Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+
+	// Host prompts offer the groups as @<group> entries
+	planHosts := func(hostNames []string) ([]installer.Host, error) {
+		hostNames, err := internal.ExpandHosts(hostNames, hostGroups)
+		if err != nil {
+			return nil, err
+		}
+		var planned []installer.Host
+		for _, host := range hostNames {
+			appsFilePath := hosts.AppsFile(NIX_HOSTS_DIR, host, cfg.AppsFiles(), appsFileOverrides)
+			if _, err := os.Stat(appsFilePath); err != nil {
+				err = policy.Warn(strict.SkippedHost, "skipping host %s: %v", host, err)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			planned = append(planned, installer.Host{Name: host, AppsFile: appsFilePath})
+		}
+		return planned, nil
+	}
+
+	template := templates.Bundled()
+	if templateName != "" {
+		template, err = findTemplate(cmd.Context(), cfg, templateName)
+		if err == nil {
+			err = template.Validate()
+		}
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+
+	plan := installer.Plan{Category: selectedFolder, UseHomebrew: installWithBrew, Plain: cfg.Plain()}
+	if template.Path != "" {
+		plan.Template, err = template.Parse()
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	plan.Hosts, err = planHosts(selectedHosts)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	if len(selections) > 1 && !assumeYes && !cfg.Plain() {
+		err = overridePerPackage(cfg, selections, hostOptions, selectedHosts, planHosts)
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+
+	var skipped []installer.Selection
+	if confirmEach {
+		selections, skipped, err = confirmPackages(selections, plan)
+		if errors.Is(err, installer.ErrAborted) {
+			cancel("Install")
+			return
+		}
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+		if len(selections) == 0 {
+			fmt.Println("Skipped every package, nothing to install")
+			return
+		}
+	}
+
+	// Modules list packages per system, so hosts of other systems need the package found for theirs
+	if !cfg.Plain() && !cmd.Flags().Changed("system") {
+		hostSystem := func(host installer.Host) string { return systemOf(host.Name) }
+		var lookup installer.Lookup
+		var lookupErr error
+		err = withSpinner("Finding the packages for every host system...", func() {
+			lookup, lookupErr = installer.LookupSystems(cmd.Context(), selections, plan, hostSystem, searcher.lookupFor)
+		})
+		if err == nil {
+			err = lookupErr
+		}
+		if err == nil {
+			err = inst.MatchSystems(selections, plan, hostSystem, lookup)
+		}
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+
+	// The meta of the chosen packages fills in missing versions and warns about broken ones.
+	// It is evaluated under the spinner and the warnings printed after it.
+	metas := map[string]search.Meta{}
+	metaErrs := map[string]error{}
+	err = withSpinner("Checking the packages' metadata...", func() {
+		for _, selection := range selections {
+			pkg := *selection.Package
+			metas[pkg.FullPath], metaErrs[pkg.FullPath] = searcher.fetchMeta(pkg)
+		}
+	})
+	if err == nil {
+		err = inst.Enrich(selections, func(pkg types.Package) (search.Meta, error) {
+			return metas[pkg.FullPath], metaErrs[pkg.FullPath]
+		})
+	}
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	selections, err = chooseWrappers(selections, plan, searcher.fetchMeta)
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+
+	var hostFiles []installer.Host
+	for _, host := range hostDirs {
+		hostFiles = append(hostFiles, installer.Host{Name: host, AppsFile: hosts.AppsFile(NIX_HOSTS_DIR, host, cfg.AppsFiles(), appsFileOverrides)})
+	}
+	err = chooseDuplicates(inst, selections, plan, hostFiles, policy)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	err = chooseFlatpaks(cmd.Context(), selections, plan, metas)
+	if err == nil {
+		err = chooseProgramModules(cmd.Context(), cfg, selections, plan)
+	}
+	if err == nil {
+		err = chooseDarwinServices(cmd.Context(), cfg, selections, plan)
+	}
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+	if askExtras {
+		err = chooseExtras(selections)
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+	err = chooseNixOSServices(cmd.Context(), cfg, selections, plan)
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+
+	registeredPaths = append(registeredPaths, registerFlatpak(cfg, selections, dryRun)...)
+
+	if !dryRun {
+		inst.Backup = beginBackup("install " + strings.Join(queries, " "))
+	}
+	if !noHooks {
+		inst.BeforeWrite = func(summary *installer.Summary) error {
+			return runHooks(cmd.Context(), cfg, hooks.PreInstall, summary)
+		}
+	}
+	summary, err := inst.Apply(selections, plan)
+	summary.Skipped = skipped
+	var lockPaths []string
+	// The lock file records generated modules, plain installs have none
+	if err == nil && !dryRun && !cfg.Plain() {
+		lockPaths = updateLock(cfg, inst.Backup, func(lock *lockfile.Lock) {
+			lockInstall(cfg, lock, summary.Results, template.Name)
+		})
+	}
+	// Commit even after a failed apply, in case restoring the files written so far failed too
+	commitBackup(inst.Backup)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	rebuildCommand := func(host string) []string {
+		return rebuildCommand(cfg, localPlatform(cfg), host, true)
+	}
+	if dryRun {
+		if jsonOutput() {
+			printJSON(newInstallJSON(cfg.FlakePath, summary, rebuildCommand))
+			return
+		}
+		printChanges(cfg.FlakePath, summary.Changes)
+		printSkipped(summary.Skipped)
+		return
+	}
+	logChanges(cfg.FlakePath, summary.Changes)
+	formatFiles(cmd.Context(), cfg, append(changedPaths(summary.Changes), registeredPaths...))
+
+	for _, result := range summary.Results {
+		if result.ModuleFile == "" {
+			slog.Info(fmt.Sprintf("%s → package list (%s)", result.Package.PName, result.Status))
+		} else {
+			slog.Info(fmt.Sprintf("%s → %s (%s, %s)", result.Package.PName, result.ModuleFile, result.Status, strings.Join(result.Package.Systems(), " + ")))
+		}
+
+		hostNames := make([]string, len(result.Hosts))
+		for i, host := range result.Hosts {
+			hostNames[i] = host.Name
+		}
+		if result.Category != "" {
+			usage.RecordInstall(result.Category)
+		}
+		installHistory.Append(history.Entry{
+			Command:  history.Install,
+			Query:    result.Query,
+			Package:  result.Package.PName,
+			Attr:     result.Package.FullPath,
+			Category: result.Category,
+			Hosts:    hostNames,
+			Time:     time.Now(),
+		})
+	}
+
+	err = installHistory.Save()
+	if err != nil {
+		fmt.Println("Could not save history: ", err)
+	}
+
+	if cfg.ShowDiff && !jsonOutput() {
+		printGitDiff(cfg.FlakePath, summary.ChangedFiles, summary.AddedFiles)
+	}
+
+	moduleFiles := summary.ModulesToEdit(editorMode, openAfterWriting)
+	if len(moduleFiles) > 0 && !jsonOutput() {
+		err := editor.Open(cfg.Editor, moduleFiles...)
+		if err != nil {
+			printError("Error opening editor: ", err)
+		}
+	}
+
+	// Hooks may format the files, so they run before the commit too
+	if !noHooks {
+		err = runHooks(cmd.Context(), cfg, hooks.PostInstall, summary)
+		if err != nil {
+			printError("Error: ", err)
+		}
+	}
+
+	// Committed last so edits made in the editor are part of the install
+	autoCommit(cfg, gitops.CommitMessage(installSummary(summary.Results), summary.Hosts), append(append(changedPaths(summary.Changes), lockPaths...), registeredPaths...))
+	printSkipped(summary.Skipped)
+
+	if jsonOutput() {
+		printJSON(newInstallJSON(cfg.FlakePath, summary, rebuildCommand))
+		if !rebuildAfter {
+			return
 		}
 	}
+	// Flakes only see files git knows about, so the rebuild runs after the commit
+	rebuildHosts(cmd.Context(), cfg, summary.Hosts, !assumeYes)
 }
 
 var installCmd = &cobra.Command{
-	Use:   "install [package]",
-	Short: "Install a nix package to your system",
-	Args:  cobra.MinimumNArgs(1),
+	Use:   "install [package...]",
+	Short: "Install nix packages to your system",
+	Long:  "Install one or more nix packages to your system, sharing the category and host selection. Without a package name, pick a recent install to repeat.",
+	Args:  cobra.ArbitraryArgs,
 	Run:   install,
 }
 
 func init() {
 	rootCmd.AddCommand(installCmd)
-	installCmd.Flags().BoolVarP(&showAll, "show-all", "a", false, "Show all packages including plugins")
+	installCmd.Flags().BoolVarP(&showAll, "show-all", "a", false, "List the packages of package sets such as vimPlugins one by one")
 	installCmd.Flags().StringVarP(&targetSystem, "system", "s", "", "Target system architecture (e.g., x86_64-linux, aarch64-darwin)")
 	installCmd.Flags().BoolVarP(&installWithBrew, "brew", "b", false, "Use Homebrew cask instead of nix package for Darwin")
+	installCmd.Flags().BoolVar(&confirmEach, "confirm-each", false, "Ask yes, skip or abort for every package with its attribute, category and hosts before writing")
+	installCmd.Flags().BoolVar(&useFlatpak, "flatpak", false, "Install the Flathub build on linux hosts through nix-flatpak instead of the nix package")
+	installCmd.Flags().BoolVar(&useWrapper, "wrap", false, "Build the interpreter with language packages such as python311Packages.numpy instead of listing them")
+	installCmd.Flags().BoolVar(&noWrapper, "no-wrap", false, "List language packages such as python311Packages.numpy on their own, without offering the interpreter")
+	installCmd.Flags().StringArrayVar(&appsFiles, "apps-file", nil, "File holding the apps section instead of configuration.nix, as <path> or <host>=<path> (relative to the host directory)")
+	installCmd.Flags().BoolVar(&showDiff, "show-diff", false, "Print the git diff of all changed files after installing")
+	installCmd.Flags().BoolVar(&strictMode, "strict", false, "Fail on ambiguous search results, untracked files, skipped hosts and unfree, broken or unsafe packages instead of warning")
+	installCmd.Flags().BoolVar(&allowUnfree, "allow-unfree", false, "Let --strict install packages with an unfree license")
+	installCmd.Flags().BoolVar(&allowBroken, "allow-broken", false, "Let --strict install packages marked broken, with a warning")
+	installCmd.Flags().BoolVar(&repeatLast, "last", false, "Repeat the most recent install")
+	installCmd.Flags().BoolVar(&editorAfter, "editor-after", false, "Open the generated modules in the editor without asking")
+	installCmd.Flags().BoolVar(&noEditor, "no-editor", false, "Never open the generated modules in the editor")
+	installCmd.Flags().StringArrayVar(&hostFlags, "host", nil, "Host or @group to enable the packages on, skips the host prompt (repeatable)")
+	installCmd.Flags().StringVar(&categoryFlag, "category", "", "Module category folder, e.g. browsers or dev/editors, skips the folder prompt")
+	installCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Run without prompts, taking the clear best match (needs --category and --host)")
+	installCmd.Flags().StringArrayVar(&attrFlags, "attr", nil, "Attribute path to install, e.g. firefox or python3Packages.numpy (repeatable)")
+	installCmd.Flags().IntVar(&packageIndex, "package-index", -1, "Install the search result at this 0-based position")
+	installCmd.Flags().StringVar(&branch, "branch", "", "Nixpkgs branch to search (stable or unstable), overrides nixpkgs_ref")
+	installCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes as diffs without writing any file")
+	installCmd.Flags().BoolVar(&useProgram, "program", false, "Enable the programs.<name> module of packages that have one instead of listing the package")
+	installCmd.Flags().BoolVar(&noProgram, "no-program", false, "Always list the package, without checking for a programs.<name> module")
+	installCmd.Flags().BoolVar(&askExtras, "extras", false, "Ask for override arguments, extra packages, environment variables and a service to write into the modules")
+	installCmd.MarkFlagsMutuallyExclusive("program", "no-program")
+	installCmd.Flags().BoolVar(&useService, "service", false, "Enable the NixOS or nix-darwin services.<name> module of packages that have one without asking")
+	installCmd.Flags().BoolVar(&noService, "no-service", false, "Always list the package, without checking for a services.<name> module")
+	installCmd.MarkFlagsMutuallyExclusive("service", "no-service")
+	installCmd.Flags().BoolVar(&noCache, "no-cache", false, "Always run a fresh nix search instead of reusing cached results")
+	installCmd.Flags().BoolVar(&rebuildAfter, "rebuild", false, "Switch this machine to the new configuration after installing, without asking")
+	installCmd.Flags().StringArrayVar(&sourceFlags, "source", nil, "Only search this source, nixpkgs or a name from sources in the config (repeatable)")
+	installCmd.Flags().StringArrayVar(&flakeFlags, "flake", nil, "Search this flake reference instead, e.g. github:nix-community/emacs-overlay (repeatable)")
+	installCmd.Flags().StringVar(&flakeRefFlag, "flake-ref", "", "Install the named packages of this flake without searching, like <flake-ref>#<package>, its default package without names")
+	installCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+	installCmd.Flags().BoolVar(&noHooks, "no-hooks", false, "Don't run the pre-install and post-install hooks")
+	installCmd.Flags().BoolVar(&forceOverwrite, "force", false, "Overwrite existing modules that differ from the generated ones without asking")
+	installCmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "Keep existing modules that differ from the generated ones without asking")
+	installCmd.Flags().StringVar(&workspaceFlag, "workspace", "", "Install into the flakes of this workspace, asking which one each package goes into")
+	installCmd.Flags().StringArrayVar(&placeFlags, "place", nil, "Flake of a package in the workspace as <package>=<profile>, skips its prompt (repeatable)")
+	installCmd.Flags().StringVar(&templateFlag, "template", "", "Generate the modules from this template instead of the bundled one, see pam template list")
 }
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// writeTestFlake creates a flake with the host laptop and a config file pointing at it,
+// returning the flake's path and the config file
+func writeTestFlake(t *testing.T) (string, string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, ".local", "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+
+	flake := filepath.Join(home, "nixos-config")
+	files := map[string]string{
+		"flake.nix": `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+
+  outputs = { nixpkgs, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      system = "x86_64-linux";
+      specialArgs = { mkApp = import ./lib/mkApp.nix { inherit (nixpkgs) lib; }; isLinux = true; };
+      modules = [ ./hosts/laptop/configuration.nix ./modules/apps ];
+    };
+  };
+}
+`,
+		"hosts/laptop/configuration.nix": "{ pkgs, ... }:\n{\n  apps = {\n  };\n}\n",
+		"modules/apps/cli/.keep":         "",
+	}
+	for name, content := range files {
+		path := filepath.Join(flake, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := filepath.Join(home, "config.yaml")
+	content := "version: 1\nflake_path: " + flake + "\ndefault_system: x86_64-linux\ndefault_module_dir: modules/apps\ndefault_host_dir: hosts\nnixpkgs_ref: nixpkgs\n"
+	if err := os.WriteFile(config, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return flake, config
+}
+
+// resetFlags sets every flag of cmd and its subcommands back to its default, the
+// variables behind them outlive a run
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if values, ok := flag.Value.(pflag.SliceValue); ok {
+			values.Replace(nil)
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// runPam runs pam with args against the fake, resetting the outcome of earlier runs
+func runPam(t *testing.T, fake *execx.Fake, args ...string) error {
+	t.Helper()
+	previous := runner
+	runner = fake
+	failure = nil
+	resetFlags(rootCmd)
+	t.Cleanup(func() {
+		runner = previous
+		failure = nil
+		resetFlags(rootCmd)
+		rootCmd.SetArgs(nil)
+	})
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		return err
+	}
+	return failure
+}
+
+func TestInstall_YesWithoutTerminal(t *testing.T) {
+	if terminal() {
+		t.Skip("the test checks install without a terminal")
+	}
+	flake, config := writeTestFlake(t)
+	fake := &execx.Fake{
+		Responses: map[string]execx.Response{
+			"nix search nixpkgs hello --json --system x86_64-linux": {Output: `{"legacyPackages.x86_64-linux.hello":{"pname":"hello","version":"2.12.1","description":"A program that produces a familiar, friendly greeting"}}`},
+			"nix": {Output: "{}"},
+		},
+		Missing: []string{"git", "nixfmt", "alejandra", "nixpkgs-fmt"},
+	}
+
+	err := runPam(t, fake, "install", "hello", "--config", config, "--host", "laptop", "--category", "cli", "--yes", "--no-hooks")
+	if err != nil {
+		t.Fatalf("install --yes failed without a terminal: %v\nran %v", err, fake.Calls())
+	}
+
+	module, err := os.ReadFile(filepath.Join(flake, "modules", "apps", "cli", "hello.nix"))
+	if err != nil || !strings.Contains(string(module), `name = "hello";`) {
+		t.Errorf("module = %q, %v", module, err)
+	}
+	host, err := os.ReadFile(filepath.Join(flake, "hosts", "laptop", "configuration.nix"))
+	if err != nil || !strings.Contains(string(host), "hello.enable = true;") {
+		t.Errorf("host config = %q, %v", host, err)
+	}
+}
+
+func TestInstall_ConfirmEachWithoutTerminal(t *testing.T) {
+	if terminal() {
+		t.Skip("the test checks install without a terminal")
+	}
+	flake, config := writeTestFlake(t)
+	fake := &execx.Fake{}
+
+	err := runPam(t, fake, "install", "firefox", "vim", "--config", config, "--host", "laptop", "--category", "cli", "--confirm-each")
+	if err == nil || !strings.Contains(err.Error(), "needs a terminal") {
+		t.Fatalf("install --confirm-each error = %v, want it to need a terminal", err)
+	}
+	if calls := fake.Calls(); len(calls) > 0 {
+		t.Errorf("install --confirm-each ran %v before failing", calls)
+	}
+	if _, err := os.Stat(filepath.Join(flake, "modules", "apps", "cli", "firefox.nix")); err == nil {
+		t.Error("install --confirm-each wrote a module without a terminal")
+	}
+}
+
+func TestInstall_JSONError(t *testing.T) {
+	_, config := writeTestFlake(t)
+	var errs bytes.Buffer
+	errorOut = &errs
+	t.Cleanup(func() { errorOut = os.Stderr })
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stdout
+	os.Stdout = stdout
+	t.Cleanup(func() { os.Stdout = previous })
+
+	err = runPam(t, &execx.Fake{}, "-o", "json", "install", "nosuch", "--config", config, "--host", "nohost", "--yes")
+	if err == nil {
+		t.Fatal("install succeeded without --category")
+	}
+	if output, _ := os.ReadFile(stdout.Name()); len(output) > 0 {
+		t.Errorf("install -o json printed %q on stdout, want nothing", output)
+	}
+	var got struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(errs.Bytes(), &got); err != nil || !strings.Contains(got.Error, "--yes needs --category") {
+		t.Errorf("install -o json error = %q, want an error object: %v", errs.String(), err)
+	}
+}
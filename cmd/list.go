@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"pam/internal/inventory"
+	"pam/internal/lockfile"
+	"pam/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	listJSON bool
+	listScan bool
+)
+
+func list(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+
+	var entries []inventory.Entry
+	if !lock.Empty() && !listScan {
+		entries = inventory.FromLock(cfg.FlakePath, lock, hostDirs)
+	} else {
+		entries, err = inventory.Collect(modulesDir, hostsDir, cfg.Namespace(), hostDirs, cfg.AppsFiles())
+		if err != nil {
+			printError("Failed to list packages: ", err)
+			return
+		}
+	}
+
+	if listJSON || jsonOutput() {
+		if entries == nil {
+			entries = []inventory.Entry{}
+		}
+		printJSON(entries)
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No pam-managed packages found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tPACKAGE\tSTATUS\tCATEGORY")
+	for _, entry := range entries {
+		status := "disabled"
+		if entry.Enabled {
+			status = "enabled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Host, entry.Package, status, entry.Category)
+	}
+	w.Flush()
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show pam-managed packages and whether each host enables them",
+	Args:  cobra.NoArgs,
+	Run:   list,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Print the packages as JSON for scripting, same as --output json")
+	listCmd.Flags().BoolVar(&listScan, "scan", false, "Read the module and host files instead of pam.lock.json, to include modules pam didn't install")
+}
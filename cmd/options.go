@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/nixconfig"
+	"pam/internal/options"
+	"pam/internal/rebuild"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	optionsHost        string
+	optionsHomeManager bool
+	optionsFile        string
+	optionsList        bool
+)
+
+// optionSource returns the flake output holding the options searched and the host they
+// belong to: home-manager's with --home-manager or for standalone home-manager hosts, the
+// manual of the host otherwise. The host is empty when none was chosen.
+func optionSource(cfg *internal.Config, hostDirs []string) (ref string, host string, err error) {
+	host = optionsHost
+	if host != "" && !slices.Contains(hostDirs, host) {
+		return "", "", fmt.Errorf("unknown host %s, available hosts: %s", host, strings.Join(hostDirs, ", "))
+	}
+	if optionsHomeManager {
+		return options.HomeManagerRef, host, nil
+	}
+	if host == "" {
+		switch {
+		case len(hostDirs) == 0:
+			return "", "", fmt.Errorf("no hosts found, search the home-manager options with --home-manager")
+		case len(hostDirs) == 1:
+			host = hostDirs[0]
+		case !showProgress():
+			return "", "", fmt.Errorf("name the host whose options to search with --host, hosts: %s", strings.Join(hostDirs, ", "))
+		default:
+			host = hostDirs[0]
+			err = huh.NewSelect[string]().
+				Title("Search the options of which host?").
+				Options(huh.NewOptions(hostDirs...)...).
+				Value(&host).
+				Run()
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+	if rebuild.Platform(cfg.Host(host).Rebuild) == rebuild.HomeManager {
+		return options.HomeManagerRef, host, nil
+	}
+	darwin := strings.Contains(hosts.DetectSystem(cfg.FlakePath, filepath.Join(cfg.FlakePath, cfg.DefaultHostDir), host), "darwin")
+	return options.HostRef(cfg.FlakePath, host, darwin), host, nil
+}
+
+func searchOptions(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostDirs, err := ui.GetDirNames(filepath.Join(cfg.FlakePath, cfg.DefaultHostDir))
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	query := strings.Join(args, " ")
+
+	var all []options.Option
+	host := optionsHost
+	var loadErr error
+	if optionsFile != "" {
+		all, loadErr = options.ReadFile(internal.ExpandPath(optionsFile))
+	} else {
+		var ref string
+		ref, host, err = optionSource(cfg, hostDirs)
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		err = withSpinner(fmt.Sprintf("Building the option list of %s...", ref), func() {
+			all, loadErr = options.Load(cmd.Context(), nixRunner(cfg), ref)
+		})
+		if err != nil {
+			printError("Error running spinner: ", err)
+			return
+		}
+	}
+	if loadErr != nil {
+		printError("Could not load the options: ", loadErr)
+		return
+	}
+
+	found := options.Search(all, query)
+	if jsonOutput() {
+		if found == nil {
+			found = []options.Option{}
+		}
+		printJSON(found)
+		return
+	}
+	if len(found) == 0 {
+		fmt.Printf("No options match %q\n", query)
+		return
+	}
+	if optionsList || !showProgress() {
+		for _, option := range found {
+			fmt.Printf("%s (%s)\n", option.Name, option.Type)
+		}
+		return
+	}
+
+	chosen, err := ui.PickOption(fmt.Sprintf("Options matching %q", query), found)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if chosen == nil {
+		return
+	}
+	setOption(cmd, cfg, hostDirs, host, *chosen)
+}
+
+// setOption asks which host to set the chosen option in and for the value, then writes
+// the assignment into the host's apps file, showing the change first
+func setOption(cmd *cobra.Command, cfg *internal.Config, hostDirs []string, host string, option options.Option) {
+	if option.ReadOnly {
+		fmt.Printf("%s is read-only and can't be set\n", option.Name)
+		return
+	}
+	if len(hostDirs) == 0 {
+		fmt.Printf("No hosts to set %s in\n", option.Name)
+		return
+	}
+	if host == "" {
+		host = hostDirs[0]
+	}
+
+	set := true
+	path := option.Name
+	if len(option.Loc) > 0 {
+		path = options.FormatPath(option.Loc)
+	}
+	value := ""
+	placeholder := option.Example
+	if placeholder == "" {
+		placeholder = option.Default
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().Title(fmt.Sprintf("Set %s in a host?", option.Name)).Value(&set),
+		),
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Which host?").
+				Options(huh.NewOptions(hostDirs...)...).
+				Value(&host),
+			huh.NewInput().
+				Title("Option").
+				Description("Replace <name> and * with the attribute to set").
+				Value(&path).
+				Validate(func(s string) error {
+					_, err := options.ParsePath(s)
+					return err
+				}),
+			huh.NewInput().
+				Title("Value").
+				Description(fmt.Sprintf("A nix expression of type %s, strings are quoted for you", option.Type)).
+				Placeholder(placeholder).
+				Value(&value).
+				Validate(func(s string) error {
+					if strings.TrimSpace(s) == "" {
+						return fmt.Errorf("enter a value")
+					}
+					return nil
+				}),
+		).WithHideFunc(func() bool { return !set }),
+	)
+	err := form.Run()
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+	if !set {
+		return
+	}
+
+	parts, err := options.ParsePath(path)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	expression := options.Value(option.Type, value)
+	file := hosts.AppsFile(filepath.Join(cfg.FlakePath, cfg.DefaultHostDir), host, cfg.AppsFiles())
+	if _, err := os.Stat(file); err != nil {
+		failf("Error: %s has no %s\n", host, filepath.Base(file))
+		return
+	}
+	change, err := hosts.Edit(file, func(nixcfg *nixconfig.Config) error {
+		_, err := nixcfg.SetOption(parts, expression)
+		return err
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if change.Old == change.New {
+		fmt.Printf("%s already sets %s to %s\n", host, path, expression)
+		return
+	}
+
+	display := change
+	if rel, err := filepath.Rel(cfg.FlakePath, change.Path); err == nil {
+		display.Path = rel
+	}
+	fmt.Print(diff.Colorize(diff.Unified(display)))
+	write := true
+	err = huh.NewConfirm().Title("Write the change?").Value(&write).Run()
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+	if !write {
+		return
+	}
+
+	snapshot := beginBackup("set " + path)
+	defer commitBackup(snapshot)
+	if err := backupFile(snapshot, change.Path); err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if err := hosts.Write(change); err != nil {
+		printError("Error: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, []diff.Change{change})
+	slog.Info(fmt.Sprintf("Set %s = %s on %s", path, expression, host))
+
+	formatFiles(cmd.Context(), cfg, []string{change.Path})
+	message := gitops.CommitMessage("set "+path, []string{host})
+	autoCommit(cfg, message, []string{change.Path})
+	recordOperation(cmd, message, []string{option.Name})
+}
+
+var optionsCmd = &cobra.Command{
+	Use:   "options <query>",
+	Short: "Search NixOS, nix-darwin and home-manager options and set one in a host",
+	Long:  "Search the options of a host, built from its flake so the options of its own modules show up too, or those of home-manager. Browse the matches with their type, default and example, and press enter to set one in the configuration of a host.",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   searchOptions,
+}
+
+func init() {
+	rootCmd.AddCommand(optionsCmd)
+	optionsCmd.Flags().StringVar(&optionsHost, "host", "", "Search the options of this host and set the chosen one in it")
+	optionsCmd.Flags().BoolVar(&optionsHomeManager, "home-manager", false, "Search the home-manager options")
+	optionsCmd.Flags().StringVar(&optionsFile, "file", "", "Search the options of an options.json file instead of building them")
+	optionsCmd.Flags().BoolVar(&optionsList, "list", false, "Print the matching options instead of browsing them")
+	optionsCmd.MarkFlagsMutuallyExclusive("home-manager", "file")
+}
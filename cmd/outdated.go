@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"pam/internal/lockfile"
+	"pam/internal/search"
+	"pam/internal/updater"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var outdatedUpdate bool
+
+// outdatedJSON is a package of pam outdated --output json
+type outdatedJSON struct {
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Attr      string `json:"attr"`
+	Input     string `json:"input"`
+	Installed string `json:"installed"`
+	Current   string `json:"current"`
+}
+
+// selectOutdated lets the user choose which outdated packages pam update regenerates,
+// none are selected to start with
+func selectOutdated(outdated []updater.Version) ([]string, error) {
+	options := make([]huh.Option[string], len(outdated))
+	for i, version := range outdated {
+		label := fmt.Sprintf("%s (%s)  %s → %s", version.Package.Name, version.Package.Category, version.Package.Version, version.Current)
+		options[i] = huh.NewOption(label, version.Package.Name)
+	}
+
+	var selected []string
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Select packages to update").
+				Description("Space to toggle, Enter to confirm").
+				Options(options...).
+				Value(&selected),
+		),
+	).Run()
+	return selected, err
+}
+
+func outdated(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+	if lock.Empty() {
+		fmt.Printf("No packages are recorded in %s, run pam sync to record them\n", lockfile.FileName)
+		return
+	}
+
+	system := cfg.DefaultSystem
+	if system == "" {
+		system = localSystem()
+	}
+	var report *updater.LockReport
+	err = withSpinner(fmt.Sprintf("Checking %d packages against the flake inputs...", len(lock.Packages)), func() {
+		report, err = updater.CheckLock(lock.Packages, system, func(system string, attrs []search.InputAttr) (map[search.InputAttr]string, error) {
+			return search.InputVersions(cmd.Context(), nixRunner(cfg), cfg.FlakePath, system, attrs)
+		})
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	if jsonOutput() {
+		results := []outdatedJSON{}
+		for _, version := range report.Outdated {
+			pkg := version.Package
+			results = append(results, outdatedJSON{Name: pkg.Name, Category: pkg.Category, Attr: pkg.Attr, Input: pkg.Input, Installed: pkg.Version, Current: version.Current})
+		}
+		printJSON(results)
+		return
+	}
+
+	for _, skip := range report.Skipped {
+		fmt.Printf("Skipping %s (%s): %s\n", skip.Package.Name, skip.Package.Category, skip.Reason)
+	}
+	if len(report.Outdated) == 0 {
+		fmt.Printf("All %d checked packages are up to date\n", len(report.UpToDate))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tCATEGORY\tINSTALLED\tCURRENT\tINPUT")
+	for _, version := range report.Outdated {
+		pkg := version.Package
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pkg.Name, pkg.Category, pkg.Version, version.Current, pkg.Input)
+	}
+	w.Flush()
+
+	if !outdatedUpdate {
+		fmt.Println("\nRun pam outdated --update to choose packages to update, or pam update <name> for one")
+		return
+	}
+	names, err := selectOutdated(report.Outdated)
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+	// The packages were chosen already, pam update regenerates them without asking again
+	updateYes = true
+	update(cmd, names)
+}
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "List installed packages that have a newer version in the flake's inputs",
+	Long: `Compare the version pam.lock.json records for every installed package with the one in
+the nixpkgs (or other) input the flake is locked to, evaluating them all in one nix call.
+Run pam input update nixpkgs first to compare against the latest nixpkgs.`,
+	Args: cobra.NoArgs,
+	Run:  outdated,
+}
+
+func init() {
+	rootCmd.AddCommand(outdatedCmd)
+	outdatedCmd.Flags().BoolVarP(&outdatedUpdate, "update", "u", false, "Choose outdated packages and regenerate their modules with pam update")
+	outdatedCmd.Flags().BoolVar(&updateNoCache, "no-cache", false, "Always run a fresh nix search when updating instead of reusing cached results")
+	outdatedCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the updates even when git_auto_commit is enabled")
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/diff"
+	"pam/internal/drift"
+	"pam/internal/installer"
+	"pam/internal/logging"
+	"pam/internal/types"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// Values of --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormat string
+
+// jsonOutput reports whether --output json was given, commands then print a single JSON
+// document on stdout and everything else goes to stderr
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// messageOut is where warnings go, stderr with --output json so stdout only holds the
+// JSON document
+func messageOut() io.Writer {
+	if jsonOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// showProgress reports whether spinners and viewports may draw on the terminal. --yes
+// runs without them, as scripts and CI have no terminal for them to draw on.
+func showProgress() bool {
+	return !logging.Quiet() && !jsonOutput() && !assumeYes && terminal()
+}
+
+// terminal reports whether pam reads from and writes to a terminal
+func terminal() bool {
+	return term.IsTerminal(os.Stdin.Fd()) && term.IsTerminal(os.Stdout.Fd())
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to encode JSON: ", err)
+	}
+}
+
+// packageJSON is a package as --output json prints it
+type packageJSON struct {
+	Name        string   `json:"name"`
+	Attr        string   `json:"attr"`
+	Version     string   `json:"version"`
+	Description string   `json:"description"`
+	Systems     []string `json:"systems"`
+	Source      string   `json:"source,omitempty"`
+}
+
+func newPackageJSON(pkg types.Package) packageJSON {
+	return packageJSON{
+		Name:        pkg.PName,
+		Attr:        pkg.FullPath,
+		Version:     pkg.Version,
+		Description: pkg.Description,
+		Systems:     pkg.Systems(),
+		Source:      pkg.Source,
+	}
+}
+
+// changeJSON is a file a command writes, with its diff relative to the flake
+type changeJSON struct {
+	Path string `json:"path"`
+	// Action is create, modify or delete
+	Action string `json:"action"`
+	Diff   string `json:"diff"`
+}
+
+func newChangesJSON(flakePath string, changes []diff.Change) []changeJSON {
+	result := []changeJSON{}
+	for _, change := range changes {
+		if change.Old == change.New {
+			continue
+		}
+		if rel, err := filepath.Rel(flakePath, change.Path); err == nil {
+			change.Path = rel
+		}
+		action := "modify"
+		switch {
+		case change.Old == "":
+			action = "create"
+		case change.New == "":
+			action = "delete"
+		}
+		result = append(result, changeJSON{Path: change.Path, Action: action, Diff: diff.Unified(change)})
+	}
+	return result
+}
+
+// installJSON is what install prints with --output json
+type installJSON struct {
+	DryRun   bool                `json:"dry_run"`
+	Packages []installResultJSON `json:"packages"`
+	Changes  []changeJSON        `json:"changes"`
+	// Rebuild holds the command to switch each host to its new configuration
+	Rebuild []rebuildJSON `json:"rebuild"`
+	// Skipped names the packages left out with --confirm-each
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+type installResultJSON struct {
+	packageJSON
+	Category      string   `json:"category,omitempty"`
+	Module        string   `json:"module,omitempty"`
+	Program       string   `json:"program,omitempty"`
+	DarwinService string   `json:"darwin_service,omitempty"`
+	Status        string   `json:"status"`
+	Hosts         []string `json:"hosts"`
+}
+
+type rebuildJSON struct {
+	Host    string `json:"host"`
+	Command string `json:"command"`
+}
+
+func newInstallJSON(flakePath string, summary *installer.Summary, rebuildCommand func(host string) []string) installJSON {
+	output := installJSON{DryRun: dryRun, Packages: []installResultJSON{}, Changes: newChangesJSON(flakePath, summary.Changes), Rebuild: []rebuildJSON{}}
+	for _, result := range summary.Results {
+		module := result.ModuleFile
+		if rel, err := filepath.Rel(flakePath, module); err == nil && module != "" {
+			module = rel
+		}
+		hostNames := []string{}
+		for _, host := range result.Hosts {
+			hostNames = append(hostNames, host.Name)
+		}
+		output.Packages = append(output.Packages, installResultJSON{
+			packageJSON:   newPackageJSON(*result.Package),
+			Category:      result.Category,
+			Module:        module,
+			Program:       result.Package.Program,
+			DarwinService: result.Package.DarwinService,
+			Status:        string(result.Status),
+			Hosts:         hostNames,
+		})
+	}
+	for _, host := range summary.Hosts {
+		output.Rebuild = append(output.Rebuild, rebuildJSON{Host: host, Command: strings.Join(rebuildCommand(host), " ")})
+	}
+	for _, selection := range summary.Skipped {
+		output.Skipped = append(output.Skipped, selection.Package.PName)
+	}
+	return output
+}
+
+// dryRunJSON is what the other commands print for --dry-run with --output json
+type dryRunJSON struct {
+	DryRun  bool         `json:"dry_run"`
+	Changes []changeJSON `json:"changes"`
+}
+
+// syncJSON is the result of pam sync, the issues found and the files the fixes changed
+type syncJSON struct {
+	DryRun  bool          `json:"dry_run"`
+	Issues  []drift.Issue `json:"issues"`
+	Changes []changeJSON  `json:"changes"`
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/plugins"
+
+	"github.com/spf13/cobra"
+)
+
+// basePluginContext is the part of the plugin context every action shares. cfg is nil
+// when pam isn't configured yet.
+func basePluginContext(cfg *internal.Config) plugins.Context {
+	if cfg == nil {
+		return plugins.Context{}
+	}
+	return plugins.Context{Flake: cfg.FlakePath, Profile: cfg.Profile}
+}
+
+// pluginCommand returns the plugin running pam <name> when args don't start with a pam
+// command, like git and kubectl run git-<name> and kubectl-<name>. Flags and the
+// commands of pam itself are never taken by a plugin.
+func pluginCommand(args []string) (plugins.Plugin, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return plugins.Plugin{}, false
+	}
+	if _, _, err := rootCmd.Find(args); err == nil {
+		return plugins.Plugin{}, false
+	}
+	plugin, err := plugins.Find(runner, args[0])
+	return plugin, err == nil
+}
+
+// runPluginCommand runs the plugin attached to the terminal with the arguments after its
+// name, its context in PAM_CONTEXT
+func runPluginCommand(ctx context.Context, plugin plugins.Plugin, args []string) error {
+	// pam's flags aren't parsed for plugins, the PAM_* variables still apply
+	internal.SetConfigFile(os.Getenv("PAM_CONFIG"))
+	cfg, err := internal.Load(internal.Options{Profile: os.Getenv("PAM_PROFILE"), Overrides: configOverrides(), NoSetup: true})
+	if err != nil {
+		// A plugin may work without a flake, e.g. to set one up
+		cfg = nil
+	}
+	pluginContext := basePluginContext(cfg)
+	pluginContext.Action = plugins.Command
+	pluginContext.Args = args
+	encoded, err := plugins.Encode(pluginContext)
+	if err != nil {
+		return err
+	}
+	if err := os.Setenv(plugins.ContextEnv, string(encoded)); err != nil {
+		return err
+	}
+
+	// The plugin owns the terminal until it exits, like pam run
+	foreground.Store(true)
+	defer foreground.Store(false)
+	return runner.Interactive(ctx, plugin.Path, args...)
+}
+
+// pluginHooks returns the hook commands running the plugins named for an install event
+func pluginHooks(names []string, event string) ([]string, error) {
+	var commands []string
+	for _, name := range names {
+		plugin, err := plugins.Find(runner, name)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, plugins.HookCommand(plugin, event))
+	}
+	return commands, nil
+}
+
+func listPlugins(cmd *cobra.Command, args []string) {
+	found := plugins.Discover(os.Getenv("PATH"))
+	if jsonOutput() {
+		if found == nil {
+			found = []plugins.Plugin{}
+		}
+		printJSON(found)
+		return
+	}
+	if len(found) == 0 {
+		fmt.Printf("No plugins found, put an executable named %s<name> in PATH\n", plugins.Prefix)
+		return
+	}
+	for _, plugin := range found {
+		line := fmt.Sprintf("%-20s %s", plugin.Name, plugin.Path)
+		// pam's own commands come first, pam <name> doesn't reach these plugins
+		if _, _, err := rootCmd.Find([]string{plugin.Name}); err == nil {
+			line += fmt.Sprintf(" (hidden by pam %s)", plugin.Name)
+		}
+		fmt.Println(line)
+	}
+}
+
+// exitPlugin ends pam after a plugin command with the plugin's exit code. The plugin
+// reported its own failure, only a plugin that couldn't run is explained.
+func exitPlugin(err error) {
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	os.Exit(exitCode(err))
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Work with the pam-<name> executables extending pam",
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the plugins found in PATH",
+	Args:  cobra.NoArgs,
+	Run:   listPlugins,
+}
+
+func init() {
+	rootCmd.AddCommand(pluginCmd)
+	pluginCmd.AddCommand(pluginListCmd)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"pam/internal"
+
+	"github.com/spf13/cobra"
+)
+
+func profileList(cmd *cobra.Command, args []string) {
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	names := file.ProfileNames()
+	if len(names) == 0 {
+		fmt.Println("No profiles configured, add them under profiles in ~/.config/pam/config.yaml")
+		return
+	}
+	for _, name := range names {
+		marker := " "
+		if name == file.CurrentProfile {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+}
+
+func profileUse(cmd *cobra.Command, args []string) {
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	name := args[0]
+	// "default" switches back to the top-level settings
+	if name == internal.DefaultProfile {
+		name = ""
+	}
+	_, err = file.WithProfile(name)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	file.CurrentProfile = name
+	err = file.Save()
+	if err != nil {
+		printError("Could not save config: ", err)
+		return
+	}
+	if name == "" {
+		fmt.Println("Using the default settings")
+		return
+	}
+	fmt.Printf("Using profile %s\n", name)
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "List config profiles or switch between them",
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the config profiles, marking the current one",
+	Args:  cobra.NoArgs,
+	Run:   profileList,
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use [profile]",
+	Short: "Make a profile the default, or go back to the top-level settings with default",
+	Args:  cobra.ExactArgs(1),
+	Run:   profileUse,
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileUseCmd)
+}
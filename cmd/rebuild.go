@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/rebuild"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+)
+
+var rebuildAfter bool
+
+// localHost returns the short hostname of this machine, the only host pam can switch
+func localHost() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	short, _, _ := strings.Cut(hostname, ".")
+	return short
+}
+
+// localPlatform decides the rebuild tool from default_system, falling back to the running OS
+func localPlatform(cfg *internal.Config) rebuild.Platform {
+	if cfg.DefaultSystem != "" {
+		return rebuild.PlatformFor(cfg.DefaultSystem)
+	}
+	return rebuild.PlatformFor(runtime.GOOS)
+}
+
+// rebuildCommand returns the command switching host: the one configured for it in the
+// hosts settings, or the usual command of platform
+func rebuildCommand(cfg *internal.Config, platform rebuild.Platform, host string, root bool) []string {
+	if command := cfg.Host(host).Rebuild; command != "" {
+		return rebuild.CustomCommand(command, cfg.FlakePath, host, root)
+	}
+	return rebuild.Command(platform, cfg.FlakePath, host, root)
+}
+
+func printRebuildHint(cfg *internal.Config, host string) {
+	// --output json lists the commands in the document instead
+	if jsonOutput() {
+		return
+	}
+	if cfg.Host(host).SSHTarget != "" {
+		fmt.Printf("\nDone! please run: pam deploy %s\n", host)
+		return
+	}
+	command := rebuildCommand(cfg, localPlatform(cfg), host, true)
+	fmt.Printf("\nDone! please run: %s\n", strings.Join(command, " "))
+}
+
+// rebuildHosts switches this machine to its new configuration when it is one of hostNames,
+// after asking unless --rebuild is set. Other hosts are left to pam deploy or to the
+// command printed for them.
+func rebuildHosts(ctx context.Context, cfg *internal.Config, hostNames []string, interactive bool) {
+	local := localHost()
+	isLocal := false
+	for _, host := range hostNames {
+		if host == local {
+			isLocal = true
+			continue
+		}
+		printRebuildHint(cfg, host)
+	}
+	if !isLocal {
+		return
+	}
+
+	run := rebuildAfter
+	if !run && interactive {
+		err := huh.NewConfirm().
+			Title(fmt.Sprintf("Rebuild %s now?", local)).
+			Value(&run).
+			Run()
+		if err != nil {
+			run = false
+		}
+	}
+	if !run {
+		printRebuildHint(cfg, local)
+		return
+	}
+
+	args := rebuildCommand(cfg, localPlatform(cfg), local, os.Geteuid() == 0)
+	if len(args) == 0 {
+		fmt.Printf("The rebuild command of %s is empty\n", local)
+		return
+	}
+	if args[0] == "sudo" {
+		// Ask for the password before the output viewport takes over the terminal
+		if err := runner.Interactive(ctx, "sudo", "-v"); err != nil {
+			printError("Could not get sudo rights: ", err)
+			printRebuildHint(cfg, local)
+			return
+		}
+	}
+
+	runRebuild(ctx, local, args)
+}
+
+// runRebuild runs the rebuild command args of host, streaming its output unless --quiet
+// is set, and prints why it failed. It reports whether the rebuild succeeded.
+func runRebuild(ctx context.Context, host string, args []string) bool {
+	var progress rebuild.Progress
+	var output []string
+	var err error
+	if !showProgress() {
+		// No viewport with --quiet, the output is only shown when the rebuild fails
+		output, err = rebuild.Run(ctx, runner, args, &progress)
+	} else {
+		observe := func(line string) string {
+			progress.Observe(line)
+			return progress.String()
+		}
+		output, err = ui.StreamCommand(ctx, fmt.Sprintf("Rebuilding %s", host), runner, args, observe)
+	}
+	if err != nil {
+		failf("Rebuilding %s failed while %s: %v\n", host, progress.String(), err)
+		for _, line := range rebuild.Summarize(output) {
+			fmt.Println("  " + line)
+		}
+		return false
+	}
+	slog.Info("Rebuilt " + host)
+	return true
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+
+	"pam/internal"
+	"pam/internal/backup"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rollbackLast bool
+	rollbackID   int
+)
+
+func openBackups() (*backup.Store, error) {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return backup.NewStore(backup.DefaultDir(stateDir)), nil
+}
+
+// beginBackup starts a snapshot for a command about to edit the flake.
+// Backups are skipped with a warning when the state directory can't be found.
+func beginBackup(command string) *backup.Snapshot {
+	store, err := openBackups()
+	if err != nil {
+		fmt.Fprintln(messageOut(), "Warning: not backing up files: ", err)
+		return nil
+	}
+	return store.Begin(command)
+}
+
+func commitBackup(snapshot *backup.Snapshot) {
+	if snapshot == nil {
+		return
+	}
+	err := snapshot.Commit()
+	if err != nil {
+		fmt.Println("Could not save backup: ", err)
+	}
+}
+
+// backupFile saves path into the snapshot before it is written, a nil snapshot saves nothing
+func backupFile(snapshot *backup.Snapshot, path string) error {
+	if snapshot == nil {
+		return nil
+	}
+	err := snapshot.Save(path)
+	if err != nil {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+	return nil
+}
+
+func backupLabel(manifest backup.Manifest) string {
+	label := fmt.Sprintf("#%d  %s  %s (%d files)", manifest.ID, manifest.Time.Format("2006-01-02 15:04"), manifest.Command, len(manifest.Files))
+	if manifest.Undone {
+		label += " undone"
+	}
+	return label
+}
+
+// pickBackup lets the user choose one of the recorded snapshots, newest first
+func pickBackup(store *backup.Store) (backup.Manifest, error) {
+	manifests, err := store.List()
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	if len(manifests) == 0 {
+		return backup.Manifest{}, fmt.Errorf("no backups recorded yet")
+	}
+
+	options := make([]huh.Option[int], len(manifests))
+	for i := range manifests {
+		manifest := manifests[len(manifests)-1-i]
+		options[i] = huh.NewOption(backupLabel(manifest), manifest.ID)
+	}
+
+	var selected int
+	err = huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("Roll back to before").
+				Options(options...).
+				Value(&selected),
+		),
+	).Run()
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	return store.Find(selected)
+}
+
+func rollback(cmd *cobra.Command, args []string) {
+	store, err := openBackups()
+	if err != nil {
+		printError("Could not open backups: ", err)
+		return
+	}
+
+	var manifest backup.Manifest
+	switch {
+	case rollbackLast && cmd.Flags().Changed("id"):
+		failf("Error: --last and --id can't be combined\n")
+		return
+	case rollbackLast:
+		manifest, err = store.Last()
+	case cmd.Flags().Changed("id"):
+		manifest, err = store.Find(rollbackID)
+	default:
+		manifest, err = pickBackup(store)
+	}
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	err = store.Restore(manifest)
+	if err != nil {
+		printError("Rollback failed: ", err)
+		return
+	}
+
+	fmt.Printf("Rolled back %s\n", backupLabel(manifest))
+	for _, file := range manifest.Files {
+		if file.Created {
+			fmt.Printf("  deleted  %s\n", file.Path)
+		} else {
+			fmt.Printf("  restored %s\n", file.Path)
+		}
+	}
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the files changed by an earlier command from their backup",
+	Args:  cobra.NoArgs,
+	Run:   rollback,
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().BoolVar(&rollbackLast, "last", false, "Roll back the most recent change")
+	rollbackCmd.Flags().IntVar(&rollbackID, "id", 0, "Roll back the change with this backup id")
+}
@@ -1,14 +1,175 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"pam/internal"
+	"pam/internal/execx"
+	"pam/internal/logging"
+	"pam/internal/platform"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+var (
+	profileFlag   string
+	flakePathFlag string
+	configFlag    string
+	verbose       bool
+	quiet         bool
+	logFile       string
+)
+
+// defaultLogFile is used by --log-file without a path
+const defaultLogFile = "default"
+
+// runner runs nix, git and the rebuild tools for every command
+var runner execx.Runner = execx.Default
+
+// nixRunner runs nix searches and evaluations, interrupting them after nix_timeout
+func nixRunner(cfg *internal.Config) execx.Runner {
+	return execx.WithTimeout(runner, cfg.Timeout())
+}
+
+// foreground is set while a program started by pam owns the terminal, e.g. pam run
+var foreground atomic.Bool
+
+// closeLog closes the log file opened for --log-file
+var closeLog = func() error { return nil }
+
 var rootCmd = &cobra.Command{
 	Use:   "pam",
 	Short: "This is a tool to install nix packages the easy way.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := platform.Check(runtime.GOOS); err != nil {
+			return err
+		}
+		if outputFormat != outputText && outputFormat != outputJSON {
+			return fmt.Errorf("unknown output format %s, use text or json", outputFormat)
+		}
+		options := logging.Options{Verbose: verbose, Quiet: quiet, File: logFile}
+		out := io.Writer(os.Stdout)
+		if jsonOutput() {
+			// stdout only holds the JSON document, messages go to stderr
+			out = os.Stderr
+			options.Quiet = !verbose
+		}
+		if options.File == defaultLogFile {
+			stateDir, err := internal.StateDir()
+			if err != nil {
+				return err
+			}
+			options.File = filepath.Join(stateDir, logging.FileName)
+		}
+		var err error
+		closeLog, err = logging.Setup(options, out)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		internal.SetConfigFile(flagOrEnv(configFlag, "PAM_CONFIG"))
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		closeLog()
+	},
+}
+
+// loadConfig loads the settings of the profile given with --profile, or the current
+// profile, with the PAM_* variables and --flake-path applied over them
+func loadConfig() (*internal.Config, error) {
+	return internal.Load(internal.Options{Profile: flagOrEnv(profileFlag, "PAM_PROFILE"), Overrides: configOverrides()})
+}
+
+// configOverrides returns the PAM_* variables followed by --flake-path, which wins
+func configOverrides() []internal.Override {
+	overrides := internal.EnvOverrides(os.LookupEnv)
+	if flakePathFlag != "" {
+		overrides = append(overrides, internal.Override{Source: "--flake-path", Key: "flake_path", Value: flakePathFlag})
+	}
+	return overrides
+}
+
+// flagOrEnv returns the value of a flag, or of the environment variable when it isn't given
+func flagOrEnv(flag string, env string) string {
+	if flag != "" {
+		return flag
+	}
+	return os.Getenv(env)
+}
+
+// flagArgs returns the flags given to cmd as --name=value arguments, one per value of
+// repeatable flags, leaving out the skipped ones
+func flagArgs(cmd *cobra.Command, skip ...string) []string {
+	var args []string
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if slices.Contains(skip, flag.Name) {
+			return
+		}
+		if values, ok := flag.Value.(pflag.SliceValue); ok {
+			for _, value := range values.GetSlice() {
+				args = append(args, fmt.Sprintf("--%s=%s", flag.Name, value))
+			}
+			return
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", flag.Name, flag.Value.String()))
+	})
+	return args
 }
 
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	// Ctrl-C interrupts the nix command that is running and lets pam exit on its own,
+	// a second Ctrl-C stops pam right away
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			// The program in the foreground gets Ctrl-C from the terminal itself
+			if foreground.Load() {
+				continue
+			}
+			cancel()
+			signal.Stop(interrupts)
+			return
+		}
+	}()
+	if plugin, ok := pluginCommand(os.Args[1:]); ok {
+		exitPlugin(runPluginCommand(ctx, plugin, os.Args[2:]))
+	}
+	start := time.Now()
+	executed, err := rootCmd.ExecuteContextC(ctx)
+	saveUsage(executed, time.Since(start), ctx.Err() != nil || err != nil || failure != nil)
+	if ctx.Err() != nil {
+		printErrorMessage("Cancelled")
+		os.Exit(exitCancelled)
+	}
+	if err != nil {
+		printErrorMessage(fmt.Sprintln("Error:", err))
+		os.Exit(exitCode(err))
+	}
+	if failure != nil {
+		os.Exit(exitCode(failure))
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Config profile to use instead of the current one, or set PAM_PROFILE")
+	rootCmd.PersistentFlags().StringVar(&flakePathFlag, "flake-path", "", "Flake to use instead of flake_path, for this command only")
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "Config file to use instead of ~/.config/pam/config.yaml, or set PAM_CONFIG")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show the commands pam runs and the diffs of the files it writes")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print warnings, errors and prompts, for scripts")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also write a debug log to this file, ~/.local/state/pam/pam.log when given without a path")
+	rootCmd.PersistentFlags().Lookup("log-file").NoOptDefVal = defaultLogFile
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format, text or json for scripts")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
 }
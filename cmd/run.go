@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"pam/internal/installer"
+	"pam/internal/strict"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var runShell bool
+
+// runArgs are the nix arguments running the package at installable, or starting a shell
+// with it when shell is set. programArgs are passed to the program, or run in the shell.
+func runArgs(installable string, shell bool, programArgs []string) []string {
+	if shell {
+		args := []string{"shell", installable}
+		if len(programArgs) > 0 {
+			args = append(append(args, "--command"), programArgs...)
+		}
+		return args
+	}
+	args := []string{"run", installable}
+	if len(programArgs) > 0 {
+		args = append(append(args, "--"), programArgs...)
+	}
+	return args
+}
+
+func runPackage(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	query := args[0]
+	var programArgs []string
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		programArgs = args[dash:]
+	}
+
+	searcher, err := newSearcher(cmd.Context(), cfg)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	choice := installer.Choice{
+		Attrs: attrFlags,
+		Index: packageIndex,
+	}
+	inst := &installer.Installer{
+		Searcher: searcher,
+		Pick:     pickPackage(searcher, strict.NewPolicy(false, messageOut()), choice, "run", false),
+	}
+	selections, err := inst.Resolve([]string{query})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	pkg := selections[0].Package
+
+	// The program owns the terminal until it exits, Ctrl-C is meant for it and not for pam
+	installable := searcher.refFor(*pkg) + "#" + pkg.FullPath
+	foreground.Store(true)
+	err = runner.Interactive(cmd.Context(), "nix", runArgs(installable, runShell, programArgs)...)
+	foreground.Store(false)
+	if err != nil {
+		fmt.Printf("%s exited: %v\n", installable, err)
+	}
+
+	var keep bool
+	err = huh.NewConfirm().
+		Title(fmt.Sprintf("Install %s permanently?", pkg.PName)).
+		Affirmative("Yes").
+		Negative("No").
+		Value(&keep).
+		Run()
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+	if !keep {
+		return
+	}
+
+	// Continue with the regular install flow, preselecting the attribute that was run
+	attrFlags = []string{pkg.FullPath}
+	if strings.Contains(pkg.FullPath, ".") {
+		showAll = true
+	}
+	install(cmd, []string{pkg.PName})
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [package] [-- args...]",
+	Short: "Try a package without adding it to the flake",
+	Long:  "Search for a package like install does, run it with nix run, or open a shell with it using --shell, and offer to install it permanently once it exits. Arguments after -- are passed to the program.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		count := len(args)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			count = dash
+		}
+		if count != 1 {
+			return fmt.Errorf("accepts 1 package before --, received %d", count)
+		}
+		return nil
+	},
+	Run: runPackage,
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().BoolVar(&runShell, "shell", false, "Open a shell with the package using nix shell instead of running it")
+	runCmd.Flags().BoolVarP(&showAll, "show-all", "a", false, "List the packages of package sets such as vimPlugins one by one")
+	runCmd.Flags().StringArrayVar(&attrFlags, "attr", nil, "Attribute path to run, e.g. firefox or python3Packages.numpy")
+	runCmd.Flags().IntVar(&packageIndex, "package-index", -1, "Run the search result at this 0-based position")
+	runCmd.Flags().StringVar(&branch, "branch", "", "Nixpkgs branch to search (stable or unstable), overrides nixpkgs_ref")
+	runCmd.Flags().StringArrayVar(&sourceFlags, "source", nil, "Only search this source, nixpkgs or a name from sources in the config (repeatable)")
+	runCmd.Flags().StringArrayVar(&flakeFlags, "flake", nil, "Search this flake reference instead, e.g. github:nix-community/emacs-overlay (repeatable)")
+	runCmd.Flags().BoolVar(&noCache, "no-cache", false, "Always run a fresh nix search instead of reusing cached results")
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"pam/internal/search"
+	"pam/internal/types"
+	"pam/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+func searchPackages(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	searcher, err := newSearcher(cmd.Context(), cfg)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	query := args[0]
+	packages, err := searcher.Search(query)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if jsonOutput() {
+		results := []packageJSON{}
+		for _, pkg := range packages {
+			results = append(results, newPackageJSON(pkg))
+		}
+		printJSON(results)
+		return
+	}
+	if len(packages) == 0 {
+		fmt.Printf("No packages found for %s\n", query)
+		return
+	}
+
+	selected, err := ui.BrowsePackages(fmt.Sprintf("Results for %s", query), query, packages, func(pkg types.Package) (search.Meta, error) {
+		return search.FetchMeta(searcher.ctx, searcher.nix, searcher.refFor(pkg), pkg)
+	}, searcher.setSearcher())
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if selected == nil {
+		return
+	}
+
+	// Continue with the regular install flow, preselecting the chosen attribute
+	attrFlags = []string{selected.FullPath}
+	if strings.Contains(selected.FullPath, ".") {
+		showAll = true
+	}
+	install(cmd, []string{selected.PName})
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Browse nixpkgs search results without installing",
+	Long:  "Search nixpkgs and browse the results with their version, platform, homepage and license. Press / to filter and i to install the selected package.",
+	Args:  cobra.ExactArgs(1),
+	Run:   searchPackages,
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().BoolVarP(&showAll, "show-all", "a", false, "List the packages of package sets such as vimPlugins one by one")
+	searchCmd.Flags().StringVarP(&targetSystem, "system", "s", "", "Target system architecture (e.g., x86_64-linux, aarch64-darwin)")
+	searchCmd.Flags().StringVar(&branch, "branch", "", "Nixpkgs branch to search (stable or unstable), overrides nixpkgs_ref")
+	searchCmd.Flags().StringArrayVar(&sourceFlags, "source", nil, "Only search this source, nixpkgs or a name from sources in the config (repeatable)")
+	searchCmd.Flags().StringArrayVar(&flakeFlags, "flake", nil, "Search this flake reference instead, e.g. github:nix-community/emacs-overlay (repeatable)")
+	searchCmd.Flags().BoolVar(&noCache, "no-cache", false, "Always run a fresh nix search instead of reusing cached results")
+}
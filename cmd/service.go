@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/hosts"
+	"pam/internal/installer"
+	"pam/internal/services"
+	"pam/internal/types"
+
+	"github.com/charmbracelet/huh"
+)
+
+var (
+	useService bool
+	noService  bool
+)
+
+// chooseDarwinServices offers to run packages such as yabai or skhd through their
+// nix-darwin services.<name> module instead of only listing the binary, for every
+// selection whose darwin hosts all declare one. --service takes the module without
+// asking, --no-service and --yes without --service skip the check. The plain layout has
+// no module to write the service into, and Homebrew casks and program modules install
+// the package their own way.
+func chooseDarwinServices(ctx context.Context, cfg *internal.Config, selections []installer.Selection, plan installer.Plan) error {
+	if noService || plan.Plain || plan.UseHomebrew || (assumeYes && !useService) {
+		return nil
+	}
+	hostsDir := NIX_HOSTS_DIR
+	for n, selection := range selections {
+		if selection.Package.Program != "" || selection.Package.Homebrew != nil || selection.Package.Wrapper != nil || !strings.Contains(selection.Package.System, "darwin") {
+			continue
+		}
+		hostList := selection.Hosts
+		if hostList == nil {
+			hostList = plan.Hosts
+		}
+		var darwinHosts []string
+		for _, host := range hostList {
+			if strings.Contains(hosts.DetectSystem(cfg.FlakePath, hostsDir, host.Name), "darwin") {
+				darwinHosts = append(darwinHosts, host.Name)
+			}
+		}
+		if len(darwinHosts) == 0 {
+			continue
+		}
+		name := selection.Package.PName
+
+		declared := true
+		var evalErr error
+		err := withSpinner(fmt.Sprintf("Checking for a nix-darwin services.%s module...", name), func() {
+			for _, host := range darwinHosts {
+				declared, evalErr = hosts.HasDarwinService(ctx, nixRunner(cfg), cfg.FlakePath, host, name)
+				if !declared || evalErr != nil {
+					return
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("running spinner: %w", err)
+		}
+		if evalErr != nil {
+			// Hosts that don't evaluate get the plain package, nix reports the error on rebuild
+			slog.Debug(fmt.Sprintf("not offering services.%s: %v", name, evalErr))
+			continue
+		}
+		if !declared {
+			continue
+		}
+
+		service := useService
+		if !service {
+			description := "enable = true"
+			for _, setting := range services.DarwinDefaults(name) {
+				description += fmt.Sprintf("; %s = %s", setting.Name, setting.Value)
+			}
+			err = huh.NewSelect[bool]().
+				Title(fmt.Sprintf("nix-darwin has a services.%s module, how should %s run on %s?", name, name, strings.Join(darwinHosts, ", "))).
+				Description(description).
+				Options(
+					huh.NewOption(fmt.Sprintf("Service (services.%s.enable = true)", name), true),
+					huh.NewOption("Plain package", false),
+				).
+				Value(&service).
+				Run()
+			if err != nil {
+				return err
+			}
+		}
+		if service {
+			pkg := *selection.Package
+			pkg.DarwinService = name
+			selections[n].Package = &pkg
+		}
+	}
+	return nil
+}
+
+// chooseNixOSServices offers to enable the services.<name> module of server packages such
+// as postgresql or nginx on NixOS hosts, for every selection whose linux hosts all
+// declare one, and asks for its key options such as the port and data directory. The
+// package stays listed, so its command line tools are on the path. Services chosen with
+// --extras are kept as they are.
+func chooseNixOSServices(ctx context.Context, cfg *internal.Config, selections []installer.Selection, plan installer.Plan) error {
+	if noService || plan.Plain || (assumeYes && !useService) {
+		return nil
+	}
+	hostsDir := NIX_HOSTS_DIR
+	for n, selection := range selections {
+		pkg := selection.Package
+		if pkg.Program != "" || pkg.Flatpak != "" || pkg.Wrapper != nil || (pkg.Extras != nil && pkg.Extras.Service != "") || !strings.Contains(pkg.System, "linux") {
+			continue
+		}
+		hostList := selection.Hosts
+		if hostList == nil {
+			hostList = plan.Hosts
+		}
+		var linuxHosts []string
+		for _, host := range hostList {
+			if strings.Contains(hosts.DetectSystem(cfg.FlakePath, hostsDir, host.Name), "linux") {
+				linuxHosts = append(linuxHosts, host.Name)
+			}
+		}
+		if len(linuxHosts) == 0 {
+			continue
+		}
+		name := pkg.PName
+
+		declared := true
+		var options []hosts.ServiceOption
+		var evalErr error
+		err := withSpinner(fmt.Sprintf("Checking for a NixOS services.%s module...", name), func() {
+			for _, host := range linuxHosts {
+				declared, evalErr = hosts.HasNixOSService(ctx, nixRunner(cfg), cfg.FlakePath, host, name)
+				if !declared || evalErr != nil {
+					return
+				}
+			}
+			options, evalErr = hosts.ServiceOptions(ctx, nixRunner(cfg), cfg.FlakePath, linuxHosts[0], name)
+		})
+		if err != nil {
+			return fmt.Errorf("running spinner: %w", err)
+		}
+		if evalErr != nil {
+			slog.Debug(fmt.Sprintf("not offering services.%s: %v", name, evalErr))
+			continue
+		}
+		if !declared {
+			continue
+		}
+
+		service := useService
+		if !service {
+			err = huh.NewSelect[bool]().
+				Title(fmt.Sprintf("NixOS has a services.%s module, how should %s run on %s?", name, name, strings.Join(linuxHosts, ", "))).
+				Options(
+					huh.NewOption(fmt.Sprintf("Service (services.%s.enable = true)", name), true),
+					huh.NewOption("Plain package", false),
+				).
+				Value(&service).
+				Run()
+			if err != nil {
+				return err
+			}
+		}
+		if !service {
+			continue
+		}
+
+		var settings []types.Setting
+		if !assumeYes {
+			settings, err = askServiceOptions(name, options)
+			if err != nil {
+				return err
+			}
+		}
+		chosen := *pkg
+		extras := types.Extras{}
+		if pkg.Extras != nil {
+			extras = *pkg.Extras
+		}
+		extras.Service = name
+		extras.ServiceSettings = settings
+		chosen.Extras = &extras
+		selections[n].Package = &chosen
+	}
+	return nil
+}
+
+// askServiceOptions asks for the key options of a service. Options left at their default
+// aren't written, so the module keeps following the NixOS default.
+func askServiceOptions(name string, options []hosts.ServiceOption) ([]types.Setting, error) {
+	if len(options) == 0 {
+		return nil, nil
+	}
+	values := make([]string, len(options))
+	flags := make([]bool, len(options))
+	fields := make([]huh.Field, len(options))
+	for i, option := range options {
+		title := fmt.Sprintf("services.%s.%s", name, option.Name)
+		description := option.Description
+		if option.Default != "" {
+			description = strings.TrimSpace(description + "\nDefault: " + option.Default)
+		}
+		if option.IsBool() {
+			flags[i] = option.Default == "true"
+			fields[i] = huh.NewConfirm().Title(title).Description(description).Value(&flags[i])
+			continue
+		}
+		fields[i] = huh.NewInput().
+			Title(title).
+			Description(strings.TrimSpace(description + "\nLeave empty to keep the default")).
+			Value(&values[i])
+	}
+	err := huh.NewForm(huh.NewGroup(fields...)).Run()
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []types.Setting
+	for i, option := range options {
+		value := strings.TrimSpace(values[i])
+		if option.IsBool() {
+			value = strconv.FormatBool(flags[i])
+			if value == option.Default || (value == "false" && option.Default == "") {
+				continue
+			}
+		}
+		if value == "" {
+			continue
+		}
+		settings = append(settings, option.Setting(value))
+	}
+	return settings, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+
+	"pam/internal/search"
+	"pam/internal/types"
+	"pam/internal/ui"
+)
+
+// packageSets returns the package sets holding results of one flake, such as vimPlugins,
+// when the searcher lists them
+func (s *nixpkgsSearcher) packageSets(packages search.SearchResult, source string) []types.Package {
+	if !s.sets {
+		return nil
+	}
+	sets := search.PackageSets(packages)
+	search.Tag(sets, source)
+	return sets
+}
+
+// withSets lists the set last installed from before the packages, the other sets follow them
+func (s *nixpkgsSearcher) withSets(packages []types.Package, sets []types.Package) []types.Package {
+	var last, rest []types.Package
+	for _, set := range sets {
+		if set.FullPath == s.lastSet {
+			set.Description += ", last used for this category"
+			last = append(last, set)
+			continue
+		}
+		rest = append(rest, set)
+	}
+	return slices.Concat(last, packages, rest)
+}
+
+// setSearcher opens the package sets among the results, nil when none are listed
+func (s *nixpkgsSearcher) setSearcher() ui.SetSearcher {
+	if !s.sets {
+		return nil
+	}
+	return s.searchSet
+}
+
+// searchSet searches only the packages of a set. Its selector owns the terminal, so the
+// search shows no progress of its own.
+func (s *nixpkgsSearcher) searchSet(set types.Package, query string) ([]types.Package, error) {
+	quiet := inWizard
+	inWizard = true
+	defer func() { inWizard = quiet }()
+
+	packages, err := s.lookup(s.refFor(set), query)
+	if err != nil {
+		return nil, err
+	}
+	var found []types.Package
+	for _, pkg := range search.FilterAndPrioritizePackages(packages, true) {
+		if strings.HasPrefix(pkg.FullPath, set.FullPath+".") {
+			found = append(found, pkg)
+		}
+	}
+	search.Tag(found, set.Source)
+	return search.RankBy(found, query, s.popularity), nil
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"pam/internal"
+	"pam/internal/search"
+	"pam/internal/stats"
+
+	"github.com/spf13/cobra"
+)
+
+// usage collects the stats of this run, they are added to the stats file once it ends
+var usage = &stats.Stats{}
+
+func loadStats() (*stats.Stats, error) {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return stats.Load(stats.DefaultPath(stateDir))
+}
+
+// timeSearch runs a nix search and records how long it took
+func timeSearch(run func() (search.SearchResult, error)) (search.SearchResult, error) {
+	start := time.Now()
+	result, err := run()
+	usage.RecordSearch(time.Since(start), err != nil)
+	return result, err
+}
+
+// saveUsage counts the command that ran and adds the stats of this run to the stats file.
+// Help, completion, pam stats clear and pam without a command aren't counted. The stats are
+// kept for tuning the cache and index only, so failing to save them is only logged.
+func saveUsage(executed *cobra.Command, took time.Duration, failed bool) {
+	if executed == nil || executed == rootCmd || executed == statsClearCmd || executed.Hidden {
+		return
+	}
+	command := strings.Join(strings.Fields(executed.CommandPath())[1:], " ")
+	if command == "help" || strings.HasPrefix(command, "completion") {
+		return
+	}
+	usage.RecordCommand(command, took, failed)
+
+	saved, err := loadStats()
+	if err == nil {
+		saved.Merge(usage)
+		err = saved.Save()
+	}
+	if err != nil {
+		slog.Debug("could not save usage stats: " + err.Error())
+	}
+}
+
+// statsReport is the JSON output of pam stats
+type statsReport struct {
+	Since         time.Time                `json:"since,omitzero"`
+	Commands      map[string]stats.Counter `json:"commands"`
+	Categories    []stats.Count            `json:"categories"`
+	Searches      int                      `json:"searches"`
+	AverageSearch float64                  `json:"average_search_seconds"`
+	CacheHits     int                      `json:"cache_hits"`
+	CacheMisses   int                      `json:"cache_misses"`
+	CacheHitRate  *float64                 `json:"cache_hit_rate"`
+	IndexHits     int                      `json:"index_hits"`
+}
+
+func showStats(cmd *cobra.Command, args []string) {
+	s, err := loadStats()
+	if err != nil {
+		printError("Could not load stats: ", err)
+		return
+	}
+
+	if jsonOutput() {
+		report := statsReport{
+			Since:         s.Since,
+			Commands:      s.Commands,
+			Categories:    s.TopCategories(0),
+			Searches:      s.Searches.Count,
+			AverageSearch: s.Searches.Average().Seconds(),
+			CacheHits:     s.CacheHits,
+			CacheMisses:   s.CacheMisses,
+			IndexHits:     s.IndexHits,
+		}
+		if rate, ok := s.CacheHitRate(); ok {
+			report.CacheHitRate = &rate
+		}
+		if report.Commands == nil {
+			report.Commands = map[string]stats.Counter{}
+		}
+		if report.Categories == nil {
+			report.Categories = []stats.Count{}
+		}
+		printJSON(report)
+		return
+	}
+	if len(s.Commands) == 0 {
+		fmt.Println("No usage recorded yet")
+		return
+	}
+
+	fmt.Printf("Usage since %s\n", s.Since.Format("2006-01-02"))
+	fmt.Println("\nCommands:")
+	for _, name := range s.CommandNames() {
+		counter := s.Commands[name]
+		line := fmt.Sprintf("  %-20s runs %5d, average %s", name, counter.Count, counter.Average().Round(time.Millisecond))
+		if counter.Failed > 0 {
+			line += fmt.Sprintf(", %d failed", counter.Failed)
+		}
+		fmt.Println(line)
+	}
+
+	if categories := s.TopCategories(statsTop); len(categories) > 0 {
+		fmt.Println("\nMost installed categories:")
+		for _, category := range categories {
+			fmt.Printf("  %-20s %5d\n", category.Name, category.Count)
+		}
+	}
+
+	fmt.Println("\nSearches:")
+	if s.Searches.Count > 0 {
+		fmt.Printf("  nix search ran %d times, %s on average\n", s.Searches.Count, s.Searches.Average().Round(time.Millisecond))
+	} else {
+		fmt.Println("  nix search hasn't run yet")
+	}
+	if rate, ok := s.CacheHitRate(); ok {
+		fmt.Printf("  cache hit rate %.0f%% (%d hits, %d misses)\n", rate*100, s.CacheHits, s.CacheMisses)
+	}
+	if s.IndexHits > 0 {
+		fmt.Printf("  answered from the index %d times\n", s.IndexHits)
+	}
+}
+
+func clearStats(cmd *cobra.Command, args []string) {
+	s, err := loadStats()
+	if err != nil {
+		printError("Could not load stats: ", err)
+		return
+	}
+
+	err = s.Clear()
+	if err != nil {
+		printError("Could not clear stats: ", err)
+		return
+	}
+	fmt.Println("Stats cleared")
+}
+
+var statsTop int
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how pam has been used on this machine",
+	Long: `Show how often each command ran and how long it took, the categories installed into most,
+the average nix search time and how often the search cache and index saved a search. The
+counters are kept in ~/.local/state/pam/stats.json and never leave the machine.`,
+	Args: cobra.NoArgs,
+	Run:  showStats,
+}
+
+var statsClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Reset the usage stats",
+	Args:  cobra.NoArgs,
+	Run:   clearStats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.AddCommand(statsClearCmd)
+	statsCmd.Flags().IntVar(&statsTop, "top", 5, "Number of categories to show")
+}
@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pam/internal"
+	"pam/internal/diff"
+	"pam/internal/drift"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/nixconfig"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncDryRun bool
+	syncYes    bool
+	syncPrune  bool
+)
+
+// Fixes offered for an issue
+const (
+	fixSkip   = "skip"
+	fixDelete = "delete"
+	fixEnable = "enable"
+	fixRemove = "remove"
+)
+
+// syncFix is the fix chosen for one issue
+type syncFix struct {
+	issue  drift.Issue
+	action string
+	// hosts get the module enabled, for fixEnable
+	hosts []string
+}
+
+// chooseFix asks how to fix a host or module issue, or picks the default one with --yes.
+// Lock issues are fixed together after the others.
+func chooseFix(issue drift.Issue, hostDirs []string, groups map[string][]string) (syncFix, error) {
+	fix := syncFix{issue: issue, action: fixSkip}
+	// Nested categories can't be edited in the apps section yet
+	editable := !strings.Contains(issue.Category, "/")
+	if syncYes || jsonOutput() {
+		switch {
+		case issue.Kind == drift.MissingModule && editable:
+			fix.action = fixRemove
+		case issue.Kind == drift.UnusedModule && syncPrune:
+			fix.action = fixDelete
+		}
+		return fix, nil
+	}
+
+	var options []huh.Option[string]
+	switch issue.Kind {
+	case drift.UnusedModule:
+		if editable && len(hostDirs) > 0 {
+			options = append(options, huh.NewOption("Enable it on hosts", fixEnable))
+		}
+		options = append(options, huh.NewOption("Delete the module", fixDelete))
+	case drift.MissingModule:
+		if editable {
+			options = append(options, huh.NewOption(fmt.Sprintf("Remove it from %s", strings.Join(issue.Hosts, ", ")), fixRemove))
+		}
+	}
+	options = append(options, huh.NewOption("Leave it", fixSkip))
+
+	err := huh.NewSelect[string]().
+		Title(issue.String()).
+		Options(options...).
+		Value(&fix.action).
+		Run()
+	if err != nil || fix.action != fixEnable {
+		return fix, err
+	}
+	err = huh.NewMultiSelect[string]().
+		Title(fmt.Sprintf("Enable %s on which hosts?", issue.Package)).
+		Options(hostOptionsWithGroups(groups, hostDirs)...).
+		Value(&fix.hosts).
+		Run()
+	if err == nil {
+		fix.hosts, err = internal.ExpandHosts(fix.hosts, groups)
+	}
+	if len(fix.hosts) == 0 {
+		fix.action = fixSkip
+	}
+	return fix, err
+}
+
+// syncLock brings the lock entries of issues in line with the modules and hosts, after
+// fixes deleted modules or enabled them on more hosts
+func syncLock(flakePath string, lock *lockfile.Lock, issues []drift.Issue, fixes []syncFix) {
+	for _, issue := range issues {
+		switch issue.Kind {
+		case drift.StaleLock:
+			lock.Remove(issue.Module)
+		case drift.LockHosts:
+			if pkg, ok := lock.Get(issue.Module); ok {
+				pkg.Hosts = issue.Hosts
+				lock.Put(pkg)
+			}
+		case drift.Unlocked:
+			path := filepath.Join(flakePath, filepath.FromSlash(issue.Module))
+			header, _, err := modules.Module{Path: path}.Header()
+			if err != nil {
+				continue
+			}
+			lock.Put(lockfile.Package{
+				Name:        issue.Package,
+				Attr:        header.Attr,
+				Version:     header.Version,
+				Input:       header.Input,
+				Source:      header.Source,
+				Category:    issue.Category,
+				Hosts:       issue.Hosts,
+				Systems:     strings.FieldsFunc(header.System, func(r rune) bool { return r == ',' }),
+				Module:      issue.Module,
+				InstalledAt: time.Now(),
+			})
+		}
+	}
+	for _, fix := range fixes {
+		switch fix.action {
+		case fixDelete:
+			lock.Remove(fix.issue.Module)
+		case fixEnable:
+			for _, host := range fix.hosts {
+				lock.AddHost(fix.issue.Module, host)
+			}
+		}
+	}
+}
+
+func syncRun(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+	issues, err := drift.Detect(drift.Flake{
+		Path:       cfg.FlakePath,
+		ModulesDir: filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir),
+		HostsDir:   hostsDir,
+		HostNames:  hostDirs,
+		Namespace:  cfg.Namespace(),
+		AppsFiles:  []map[string]string{cfg.AppsFiles()},
+		Lock:       lock,
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if len(issues) == 0 {
+		if jsonOutput() {
+			printJSON(syncJSON{DryRun: syncDryRun, Issues: []drift.Issue{}, Changes: []changeJSON{}})
+			return
+		}
+		fmt.Println("Modules, hosts and pam.lock.json are in sync")
+		return
+	}
+
+	if !jsonOutput() {
+		fmt.Printf("Found %d issues:\n", len(issues))
+		for _, issue := range issues {
+			fmt.Println("  " + issue.String())
+		}
+		fmt.Println()
+	}
+
+	var fixes []syncFix
+	var lockIssues []drift.Issue
+	for _, issue := range issues {
+		if issue.Kind != drift.UnusedModule && issue.Kind != drift.MissingModule {
+			lockIssues = append(lockIssues, issue)
+			continue
+		}
+		fix, err := chooseFix(issue, hostDirs, cfg.HostGroupsOf(hostDirs))
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+		fixes = append(fixes, fix)
+	}
+
+	// Collect every edit of a host first, so fixes touching the same apps file combine
+	hostEdits := map[string][]func(nixcfg *nixconfig.Config) error{}
+	var changes []diff.Change
+	for _, fix := range fixes {
+		switch fix.action {
+		case fixDelete:
+			path := filepath.Join(cfg.FlakePath, filepath.FromSlash(fix.issue.Module))
+			content, err := os.ReadFile(path)
+			if err != nil {
+				printError("Could not read module: ", err)
+				return
+			}
+			changes = append(changes, diff.Change{Path: path, Old: string(content)})
+		case fixEnable:
+			for _, host := range fix.hosts {
+				hostEdits[host] = append(hostEdits[host], hosts.EnableEdit(cfg.Namespace(), fix.issue.Category, fix.issue.Package))
+			}
+		case fixRemove:
+			for _, host := range fix.issue.Hosts {
+				hostEdits[host] = append(hostEdits[host], hosts.RemoveEdit(cfg.Namespace(), fix.issue.Category, fix.issue.Package))
+			}
+		}
+	}
+	var changedHosts []string
+	for _, host := range hostDirs {
+		edits := hostEdits[host]
+		if len(edits) == 0 {
+			continue
+		}
+		hostChanges, changed, err := editHosts(cfg, []string{host}, func(nixcfg *nixconfig.Config) error {
+			for _, edit := range edits {
+				if err := edit(nixcfg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			printError("Error updating host config: ", err)
+			return
+		}
+		changes = append(changes, hostChanges...)
+		changedHosts = append(changedHosts, changed...)
+	}
+
+	fixLock := len(lockIssues) > 0
+	if fixLock && !syncYes && !jsonOutput() && !syncDryRun {
+		err = huh.NewConfirm().
+			Title(fmt.Sprintf("Update %s to match the modules and hosts?", lockfile.FileName)).
+			Affirmative("Yes").
+			Negative("No").
+			Value(&fixLock).
+			Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+	if !fixLock {
+		lockIssues = nil
+	}
+	// Deleted and newly enabled modules are recorded either way
+	fixLock = fixLock || slices.ContainsFunc(fixes, func(fix syncFix) bool {
+		return fix.action == fixDelete || fix.action == fixEnable
+	})
+
+	if syncDryRun {
+		if jsonOutput() {
+			printJSON(syncJSON{DryRun: true, Issues: issues, Changes: newChangesJSON(cfg.FlakePath, changes)})
+			return
+		}
+		if fixLock {
+			fmt.Printf("Would update %s\n", lockfile.FileName)
+		}
+		printChanges(cfg.FlakePath, changes)
+		return
+	}
+	if len(changes) == 0 && !fixLock {
+		if jsonOutput() {
+			printJSON(syncJSON{Issues: issues, Changes: []changeJSON{}})
+			return
+		}
+		fmt.Println("Nothing changed")
+		return
+	}
+
+	snapshot := beginBackup("sync")
+	defer commitBackup(snapshot)
+	for _, change := range changes {
+		if err := backupFile(snapshot, change.Path); err != nil {
+			printError("Error: ", err)
+			return
+		}
+	}
+	err = diff.Apply(changes)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, changes)
+
+	for _, fix := range fixes {
+		switch fix.action {
+		case fixDelete:
+			slog.Info("Deleted " + fix.issue.Module)
+		case fixEnable:
+			slog.Info(fmt.Sprintf("Enabled %s on %s", fix.issue.Package, strings.Join(fix.hosts, ", ")))
+		case fixRemove:
+			slog.Info(fmt.Sprintf("Removed %s from %s", fix.issue.Package, strings.Join(fix.issue.Hosts, ", ")))
+		}
+	}
+	var lockPaths []string
+	if fixLock {
+		lockPaths = updateLock(cfg, snapshot, func(lock *lockfile.Lock) {
+			syncLock(cfg.FlakePath, lock, lockIssues, fixes)
+		})
+		if lockPaths != nil {
+			slog.Info("Updated " + lockfile.FileName)
+		}
+	}
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage("sync modules and hosts", changedHosts)
+	autoCommit(cfg, message, append(changedPaths(changes), lockPaths...))
+	recordOperation(cmd, message, args)
+
+	if jsonOutput() {
+		printJSON(syncJSON{Issues: issues, Changes: newChangesJSON(cfg.FlakePath, changes)})
+	}
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Find and fix drift between the modules, the hosts and pam.lock.json",
+	Long: `Compare the module directory with the apps section of every host and with pam.lock.json, and offer a fix for each difference:
+
+  modules no host mentions        enable them on hosts, or delete them
+  host entries without a module   remove them, the host fails to evaluate otherwise
+  lock entries of deleted modules remove them from pam.lock.json
+  generated modules not locked    record them in pam.lock.json
+  lock entries with other hosts   record the hosts enabling the module
+
+With --yes the missing modules are removed from the hosts and pam.lock.json is updated, unused modules are only deleted with --prune.`,
+	Args: cobra.NoArgs,
+	Run:  syncRun,
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Show the fixes as diffs without writing or deleting any file")
+	syncCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "Apply the default fixes without prompting")
+	syncCmd.Flags().BoolVar(&syncPrune, "prune", false, "With --yes, also delete the modules no host mentions")
+	syncCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"pam/internal"
+	"pam/internal/assets"
+	"pam/internal/nixvalidate"
+	"pam/internal/plugins"
+	"pam/internal/templates"
+	"pam/internal/types"
+
+	"github.com/spf13/cobra"
+)
+
+// templateDirs returns the directories searched for module templates
+func templateDirs(cfg *internal.Config) []string {
+	configDir, err := internal.ConfigDir()
+	if err != nil {
+		// Without a home directory only the flake's templates are used
+		return templates.Dirs(cfg.FlakePath, "")[:1]
+	}
+	return templates.Dirs(cfg.FlakePath, configDir)
+}
+
+// listTemplates returns the templates of the template directories and those of the
+// plugins named under plugins.templates
+func listTemplates(ctx context.Context, cfg *internal.Config) ([]templates.Template, error) {
+	available, err := templates.List(templateDirs(cfg)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.Plugins.Templates {
+		plugin, err := plugins.Find(runner, name)
+		if err != nil {
+			return nil, err
+		}
+		provided, err := plugins.ListTemplates(ctx, nixRunner(cfg), plugin, basePluginContext(cfg))
+		if err != nil {
+			return nil, err
+		}
+		for _, template := range provided {
+			available = templates.Add(available, templates.Template{Name: template.Name, Path: plugin.Path, Content: template.Content})
+		}
+	}
+	return available, nil
+}
+
+// findTemplate returns the template called name among listTemplates
+func findTemplate(ctx context.Context, cfg *internal.Config, name string) (templates.Template, error) {
+	available, err := listTemplates(ctx, cfg)
+	if err != nil {
+		return templates.Template{}, err
+	}
+	template, ok := templates.Named(available, name)
+	if !ok {
+		return templates.Template{}, fmt.Errorf("no template named %s in %s or the template plugins", name, strings.Join(templateDirs(cfg), " or "))
+	}
+	return template, nil
+}
+
+func templateList(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	available, err := listTemplates(cmd.Context(), cfg)
+	if err != nil {
+		printError("Failed to read templates: ", err)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, template := range available {
+		location := template.Path
+		if location == "" {
+			location = "bundled with pam"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", template.Name, location)
+	}
+	w.Flush()
+}
+
+func templateVars(cmd *cobra.Command, args []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, variable := range templates.Variables {
+		fmt.Fprintf(w, "%s\t%s\n", variable.Name, variable.Description)
+	}
+	w.Flush()
+}
+
+func templateCheck(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	template, err := findTemplate(cmd.Context(), cfg, args[0])
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	err = template.Validate()
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	// Generate a module for a sample package and make sure it parses
+	sample := &types.Package{PName: "hello", FullPath: "hello", Version: "2.12", System: "x86_64-linux", Description: "A program that produces a familiar, friendly greeting"}
+	tmpl, err := template.Parse()
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	module, err := assets.FillTemplate(tmpl, sample, false, cfg.Namespace())
+	if err == nil {
+		err = nixvalidate.Default().Validate(template.Name, []byte(module))
+	}
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	fmt.Printf("Template %s is valid\n", template.Name)
+}
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "List, document and check module templates",
+	Long:  "Module templates are .nix files in the flake's templates/ folder or ~/.config/pam/templates. The file name without .nix is the template name, pick one with install --template.",
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available templates",
+	Args:  cobra.NoArgs,
+	Run:   templateList,
+}
+
+var templateVarsCmd = &cobra.Command{
+	Use:   "vars",
+	Short: "Describe the placeholders a template can use",
+	Args:  cobra.NoArgs,
+	Run:   templateVars,
+}
+
+var templateCheckCmd = &cobra.Command{
+	Use:   "check [template]",
+	Short: "Check that a template has the required placeholders and generates valid nix",
+	Args:  cobra.ExactArgs(1),
+	Run:   templateCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateVarsCmd)
+	templateCmd.AddCommand(templateCheckCmd)
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/backup"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	toggleHostFlags []string
+	toggleDryRun    bool
+)
+
+// toggle returns the run function of enable and disable, which flip <pkg>.enable on the
+// selected hosts without regenerating the module
+func toggle(enable bool) func(cmd *cobra.Command, args []string) {
+	verb, done := "disable", "Disabled"
+	if enable {
+		verb, done = "enable", "Enabled"
+	}
+
+	return func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			printError("Loading config failed. error:", err)
+			return
+		}
+		hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+		modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+		packageName := args[0]
+
+		lock, err := lockfile.Load(cfg.FlakePath)
+		if err != nil {
+			printError("Could not read lock file: ", err)
+			return
+		}
+		found := lock.Modules(cfg.FlakePath, packageName)
+		if len(found) == 0 {
+			found, err = modules.Find(modulesDir, packageName)
+			if err != nil {
+				printError("Failed to read module directory: ", err)
+				return
+			}
+		}
+		if len(found) == 0 {
+			fmt.Printf("No module named %s found in %s\n", packageName, modulesDir)
+			return
+		}
+
+		module, err := selectModule(found)
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+
+		optionName, err := module.PackageName()
+		if err != nil {
+			printError("Could not read module: ", err)
+			return
+		}
+
+		hostDirs, err := ui.GetDirNames(hostsDir)
+		if err != nil {
+			printError("Failed to read hosts directory: ", err)
+			return
+		}
+
+		// Only hosts whose state would change are offered
+		var candidates []string
+		var unchanged []string
+		for _, host := range hostDirs {
+			appsFilePath := hosts.AppsFile(hostsDir, host, cfg.AppsFiles())
+			if _, err := os.Stat(appsFilePath); err != nil {
+				continue
+			}
+
+			enabled, err := hosts.PackageEnabled(appsFilePath, cfg.Namespace(), module.Category, optionName)
+			if err != nil {
+				printError("Error reading host config: ", err)
+				return
+			}
+			if enabled == enable {
+				unchanged = append(unchanged, host)
+			} else {
+				candidates = append(candidates, host)
+			}
+		}
+
+		selectedHosts, err := internal.ExpandHosts(toggleHostFlags, cfg.HostGroupsOf(append(slices.Clone(candidates), unchanged...)))
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		for _, host := range selectedHosts {
+			if !slices.Contains(candidates, host) && !slices.Contains(unchanged, host) {
+				failf("Error: unknown host %s, available hosts: %s\n", host, strings.Join(append(candidates, unchanged...), ", "))
+				return
+			}
+		}
+		if len(selectedHosts) == 0 {
+			if len(candidates) == 0 {
+				fmt.Printf("%s is already %sd on every host\n", optionName, verb)
+				return
+			}
+			groups := cfg.HostGroupsOf(candidates)
+			err = huh.NewMultiSelect[string]().
+				Title(fmt.Sprintf("%s %s on which hosts?", strings.ToUpper(verb[:1])+verb[1:], optionName)).
+				Description("Space to toggle, Enter to confirm").
+				Options(hostOptionsWithGroups(groups, candidates)...).
+				Value(&selectedHosts).
+				Run()
+			if err == nil {
+				selectedHosts, err = internal.ExpandHosts(selectedHosts, groups)
+			}
+			if err != nil {
+				printError("Form cancelled or error: ", err)
+				return
+			}
+		}
+
+		edit := hosts.DisableEdit(cfg.Namespace(), module.Category, optionName)
+		if enable {
+			edit = hosts.EnableEdit(cfg.Namespace(), module.Category, optionName)
+		}
+
+		var snapshot *backup.Snapshot
+		if !toggleDryRun {
+			snapshot = beginBackup(verb + " " + packageName)
+			defer commitBackup(snapshot)
+		}
+
+		var changes []diff.Change
+		var changedHosts []string
+		for _, host := range selectedHosts {
+			if slices.Contains(unchanged, host) {
+				continue
+			}
+			appsFilePath := hosts.AppsFile(hostsDir, host, cfg.AppsFiles())
+			change, err := hosts.Edit(appsFilePath, edit)
+			if err != nil {
+				printError("Error updating host config: ", err)
+				return
+			}
+			changes = append(changes, change)
+			changedHosts = append(changedHosts, host)
+			if toggleDryRun {
+				continue
+			}
+
+			err = backupFile(snapshot, appsFilePath)
+			if err == nil {
+				err = hosts.Write(change)
+			}
+			if err != nil {
+				printError("Error updating host config: ", err)
+				return
+			}
+		}
+
+		if toggleDryRun {
+			printChanges(cfg.FlakePath, changes)
+			return
+		}
+
+		logChanges(cfg.FlakePath, changes)
+		slog.Info(fmt.Sprintf("%s in %s:", optionName, module.Category))
+		for _, host := range selectedHosts {
+			if slices.Contains(changedHosts, host) {
+				slog.Info(fmt.Sprintf("  ✓ %-20s %s", host, strings.ToLower(done)))
+			} else {
+				slog.Info(fmt.Sprintf("  - %-20s already %sd", host, verb))
+			}
+		}
+		if len(changedHosts) == 0 {
+			return
+		}
+
+		lockPaths := updateLock(cfg, snapshot, func(lock *lockfile.Lock) {
+			rel, err := lockfile.RelativeModule(cfg.FlakePath, module.Path)
+			if err != nil {
+				return
+			}
+			for _, host := range changedHosts {
+				if enable {
+					lock.AddHost(rel, host)
+				} else {
+					lock.RemoveHost(rel, host)
+				}
+			}
+		})
+
+		formatFiles(cmd.Context(), cfg, changedPaths(changes))
+		message := gitops.CommitMessage(fmt.Sprintf("%s %s in %s", verb, optionName, module.Category), changedHosts)
+		autoCommit(cfg, message, append(changedPaths(changes), lockPaths...))
+
+		rerunArgs := []string{module.Name}
+		if !cmd.Flags().Changed("host") {
+			for _, host := range changedHosts {
+				rerunArgs = append(rerunArgs, "--host="+host)
+			}
+		}
+		recordOperation(cmd, message, rerunArgs)
+	}
+}
+
+var enableCmd = &cobra.Command{
+	Use:   "enable [package]",
+	Short: "Enable an installed package on more hosts",
+	Long:  "Set <package>.enable = true in the apps section of the selected hosts, adding it where the host doesn't mention the package yet. The module is left as is.",
+	Args:  cobra.ExactArgs(1),
+	Run:   toggle(true),
+}
+
+var disableCmd = &cobra.Command{
+	Use:     "disable [package]",
+	Aliases: []string{"remove-from-host"},
+	Short:   "Disable a package on selected hosts, keeping its module",
+	Long:    "Set <package>.enable = false in the apps section of the selected hosts. The module stays, so `pam enable` turns it back on.",
+	Args:    cobra.ExactArgs(1),
+	Run:     toggle(false),
+}
+
+func init() {
+	for _, command := range []*cobra.Command{enableCmd, disableCmd} {
+		rootCmd.AddCommand(command)
+		command.Flags().BoolVar(&toggleDryRun, "dry-run", false, "Show the changes as diffs without writing any file")
+		command.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+		command.Flags().StringArrayVar(&toggleHostFlags, "host", nil, "Host or @group to change, skips the host prompt (repeatable)")
+	}
+}
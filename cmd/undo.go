@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pam/internal/backup"
+	"pam/internal/gitops"
+
+	"github.com/spf13/cobra"
+)
+
+var undoForce bool
+
+// replay undoes or redoes the next command on the backup journal, then commits the files
+// it touched when git_auto_commit is enabled
+func replay(redo bool) func(cmd *cobra.Command, args []string) {
+	verb, done := "undo", "Undid"
+	if redo {
+		verb, done = "redo", "Redid"
+	}
+
+	return func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			printError("Loading config failed. error:", err)
+			return
+		}
+		store, err := openBackups()
+		if err != nil {
+			printError("Could not open backups: ", err)
+			return
+		}
+
+		var manifest backup.Manifest
+		if redo {
+			manifest, err = store.NextRedo()
+		} else {
+			manifest, err = store.NextUndo()
+		}
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		if redo {
+			err = store.Redo(manifest, undoForce)
+		} else {
+			err = store.Undo(manifest, undoForce)
+		}
+		if err != nil {
+			failf("Could not %s %s: %v\n", verb, manifest.Command, err)
+			if !undoForce {
+				fmt.Printf("Run pam %s --force to overwrite the changes\n", verb)
+			}
+			return
+		}
+
+		fmt.Printf("%s %s\n", done, backupLabel(manifest))
+		var paths []string
+		for _, file := range manifest.Files {
+			paths = append(paths, file.Path)
+			if _, err := os.Stat(file.Path); os.IsNotExist(err) {
+				fmt.Printf("  deleted  %s\n", file.Path)
+			} else {
+				fmt.Printf("  restored %s\n", file.Path)
+			}
+		}
+		autoCommit(cfg, gitops.CommitMessage(verb+" "+manifest.Command, nil), paths)
+	}
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the last command that changed the flake",
+	Long:  "Restore the files changed by the most recent install, uninstall, enable, disable or other command that edited the flake, as recorded in its backup. Running undo again steps further back. Files edited since the command are left alone unless --force is given.",
+	Args:  cobra.NoArgs,
+	Run:   replay(false),
+}
+
+var redoCmd = &cobra.Command{
+	Use:   "redo",
+	Short: "Apply the last undone command again",
+	Long:  "Write back what the command reverted by the last undo left in the files. Any command changing the flake after an undo ends the chain of commands to redo.",
+	Args:  cobra.NoArgs,
+	Run:   replay(true),
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(redoCmd)
+	for _, command := range []*cobra.Command{undoCmd, redoCmd} {
+		command.Flags().BoolVar(&undoForce, "force", false, "Overwrite files changed since the command")
+		command.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+	}
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"pam/internal/backup"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	uninstallYes    bool
+	uninstallDryRun bool
+)
+
+// selectModule asks which module to use when several categories contain the same name
+func selectModule(found []modules.Module) (modules.Module, error) {
+	if len(found) == 1 {
+		return found[0], nil
+	}
+
+	options := make([]huh.Option[int], len(found))
+	for i, module := range found {
+		options[i] = huh.NewOption(fmt.Sprintf("%s (%s)", module.Name, module.Category), i)
+	}
+
+	var selected int
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("Several modules match, select one").
+				Options(options...).
+				Value(&selected),
+		),
+	).Run()
+	if err != nil {
+		return modules.Module{}, err
+	}
+	return found[selected], nil
+}
+
+// handEdited reports whether the lock says module was changed by hand since pam generated it
+func handEdited(flakePath string, lock *lockfile.Lock, module modules.Module) bool {
+	rel, err := lockfile.RelativeModule(flakePath, module.Path)
+	if err != nil {
+		return false
+	}
+	pkg, ok := lock.Get(rel)
+	if !ok {
+		return false
+	}
+	content, err := os.ReadFile(module.Path)
+	return err == nil && pkg.Edited(content)
+}
+
+func uninstall(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+	packageName := args[0]
+
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+	// Modules missing from the lock, e.g. written before pam kept one, are looked up on disk
+	found := lock.Modules(cfg.FlakePath, packageName)
+	if len(found) == 0 {
+		found, err = modules.Find(modulesDir, packageName)
+		if err != nil {
+			printError("Failed to read module directory: ", err)
+			return
+		}
+	}
+	if len(found) == 0 {
+		fmt.Printf("No module named %s found in %s\n", packageName, modulesDir)
+		return
+	}
+
+	module, err := selectModule(found)
+	if err != nil {
+		printError("Form cancelled or error: ", err)
+		return
+	}
+
+	optionName, err := module.PackageName()
+	if err != nil {
+		printError("Could not read module: ", err)
+		return
+	}
+
+	title := fmt.Sprintf("Delete %s and remove %s from every host?", module.Path, optionName)
+	if handEdited(cfg.FlakePath, lock, module) {
+		fmt.Fprintf(messageOut(), "Warning: %s was edited by hand since pam wrote it, uninstalling deletes the changes\n", module.Path)
+		title = fmt.Sprintf("%s was edited by hand. Delete it anyway and remove %s from every host?", module.Path, optionName)
+	}
+	if !uninstallYes && !uninstallDryRun {
+		var confirmed bool
+		err = huh.NewConfirm().
+			Title(title).
+			Value(&confirmed).
+			Run()
+		if err != nil || !confirmed {
+			cancel("Uninstall")
+			return
+		}
+	}
+
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+
+	var snapshot *backup.Snapshot
+	if !uninstallDryRun {
+		snapshot = beginBackup("uninstall " + packageName)
+		defer commitBackup(snapshot)
+	}
+
+	var changes []diff.Change
+	var removedHosts []string
+	for _, host := range hostDirs {
+		appsFilePath := hosts.AppsFile(hostsDir, host, cfg.AppsFiles())
+		if _, err := os.Stat(appsFilePath); err != nil {
+			continue
+		}
+
+		change, err := hosts.Edit(appsFilePath, hosts.RemoveEdit(cfg.Namespace(), module.Category, optionName))
+		if err != nil {
+			printError("Error updating host config: ", err)
+			return
+		}
+		if change.Old == change.New {
+			continue
+		}
+		changes = append(changes, change)
+		if uninstallDryRun {
+			continue
+		}
+
+		err = backupFile(snapshot, appsFilePath)
+		if err == nil {
+			err = hosts.Write(change)
+		}
+		if err != nil {
+			printError("Error updating host config: ", err)
+			return
+		}
+		removedHosts = append(removedHosts, host)
+		slog.Info(fmt.Sprintf("Removed %s from %s", optionName, host))
+	}
+
+	// A default.nix listing its modules would import the deleted file
+	imports := modules.NewImports(modulesDir)
+	err = imports.Remove(module.Path)
+	if err != nil {
+		printError("Could not read default.nix: ", err)
+		return
+	}
+	for _, change := range imports.Changes() {
+		changes = append(changes, change)
+		if uninstallDryRun {
+			continue
+		}
+		err = backupFile(snapshot, change.Path)
+		if err == nil {
+			err = diff.WriteFile(change.Path, []byte(change.New))
+		}
+		if err != nil {
+			printError("Error updating default.nix: ", err)
+			return
+		}
+	}
+
+	if uninstallDryRun {
+		content, err := os.ReadFile(module.Path)
+		if err != nil {
+			printError("Could not read module: ", err)
+			return
+		}
+		changes = append(changes, diff.Change{Path: module.Path, Old: string(content)})
+		printChanges(cfg.FlakePath, changes)
+		return
+	}
+
+	err = backupFile(snapshot, module.Path)
+	if err == nil {
+		err = os.Remove(module.Path)
+	}
+	if err != nil {
+		printError("Could not delete module: ", err)
+		return
+	}
+	logChanges(cfg.FlakePath, changes)
+	slog.Info("Deleted " + module.Path)
+
+	lockPaths := updateLock(cfg, snapshot, func(lock *lockfile.Lock) {
+		if rel, err := lockfile.RelativeModule(cfg.FlakePath, module.Path); err == nil {
+			lock.Remove(rel)
+		}
+	})
+
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage(fmt.Sprintf("remove %s from %s", optionName, module.Category), removedHosts)
+	autoCommit(cfg, message, append(append(changedPaths(changes), module.Path), lockPaths...))
+	recordOperation(cmd, message, []string{module.Name})
+}
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall [package]",
+	Short: "Remove a pam-managed module and disable it on every host",
+	Args:  cobra.ExactArgs(1),
+	Run:   uninstall,
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+	uninstallCmd.Flags().BoolVarP(&uninstallYes, "yes", "y", false, "Delete without asking for confirmation")
+	uninstallCmd.Flags().BoolVar(&uninstallDryRun, "dry-run", false, "Show the changes as diffs without writing or deleting any file")
+	uninstallCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/nixvalidate"
+	"pam/internal/search"
+	"pam/internal/templates"
+	"pam/internal/types"
+	"pam/internal/updater"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateYes     bool
+	updateDryRun  bool
+	updateNoCache bool
+	updateForce   bool
+)
+
+func updateLabel(update updater.Update) string {
+	return fmt.Sprintf("%s (%s)  %s → %s", update.Module.Name, update.Module.Category, update.Header.Version, update.Latest.Version)
+}
+
+// selectUpdates lets the user choose which outdated modules to regenerate, all are selected to start with
+func selectUpdates(updates []updater.Update) ([]updater.Update, error) {
+	options := make([]huh.Option[int], len(updates))
+	for i, update := range updates {
+		options[i] = huh.NewOption(updateLabel(update), i).Selected(true)
+	}
+
+	var selected []int
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewMultiSelect[int]().
+				Title("Select modules to regenerate").
+				Description("Space to toggle, Enter to confirm").
+				Options(options...).
+				Value(&selected),
+		),
+	).Run()
+	if err != nil {
+		return nil, err
+	}
+
+	chosen := make([]updater.Update, len(selected))
+	for i, index := range selected {
+		chosen[i] = updates[index]
+	}
+	return chosen, nil
+}
+
+// resolveHandEdit decides what happens to a module edited by hand since pam generated it,
+// which the update would overwrite: --force overwrites it, --yes keeps it and otherwise
+// the user is asked. A dry run only warns.
+func resolveHandEdit(configuredEditor string, change diff.Change) (string, error) {
+	switch {
+	case updateForce || updateDryRun:
+		fmt.Fprintf(messageOut(), "Warning: %s was edited by hand since pam wrote it, the update overwrites it\n", change.Path)
+		return change.New, nil
+	case updateYes:
+		fmt.Printf("Skipping %s: it was edited by hand since pam wrote it, regenerate it with --force\n", change.Path)
+		return change.Old, nil
+	}
+	return askConflict(configuredEditor, fmt.Sprintf("%s was edited by hand since pam wrote it", change.Path), change)
+}
+
+func update(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+
+	lock, err := lockfile.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read lock file: ", err)
+		return
+	}
+	// Without a lock, e.g. for modules written before pam kept one, every module is checked
+	found := lock.Modules(cfg.FlakePath, "")
+	if lock.Empty() {
+		found, err = modules.Scan(modulesDir)
+		if err != nil {
+			printError("Failed to read module directory: ", err)
+			return
+		}
+	}
+	if len(args) > 0 {
+		// Only the named modules are checked, e.g. those pam outdated chose
+		found = slices.DeleteFunc(found, func(module modules.Module) bool {
+			return !slices.Contains(args, module.Name)
+		})
+	}
+	if len(found) == 0 {
+		fmt.Println("No pam-managed packages found")
+		return
+	}
+
+	var cache *search.Cache
+	if !updateNoCache {
+		cache = openSearchCache(nixRunner(cfg))
+	}
+	report, err := updater.Check(found, func(input string, query string, system string) ([]types.Package, error) {
+		ref := cfg.NixpkgsRef
+		if input != search.NixpkgsSource {
+			source, ok := search.FindSource(cfg.Sources, input)
+			if !ok {
+				// Reported as not found, the source was removed from the config
+				return nil, nil
+			}
+			ref = source.FlakeRef()
+		}
+
+		packages, err := cachedSearch(cmd.Context(), nixRunner(cfg), cache, ref, query, system)
+		if err != nil {
+			return nil, err
+		}
+		results := search.FilterAndPrioritizePackages(packages, true)
+		if input != search.NixpkgsSource {
+			search.Tag(results, input)
+		}
+		return results, nil
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	for _, skip := range report.Skipped {
+		fmt.Printf("Skipping %s (%s): %s\n", skip.Module.Name, skip.Module.Category, skip.Reason)
+	}
+	if len(report.Updates) == 0 {
+		fmt.Printf("All %d checked modules are up to date\n", len(report.UpToDate))
+		return
+	}
+
+	selected := report.Updates
+	if !updateYes && !updateDryRun {
+		selected, err = selectUpdates(report.Updates)
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	} else {
+		for _, update := range selected {
+			fmt.Println(updateLabel(update))
+		}
+	}
+
+	validator := nixvalidate.Default()
+	var changes []diff.Change
+	var regenerated []updater.Update
+	// generated is recorded in the lock, a merged module stays edited
+	generated := map[string]string{}
+	for _, update := range selected {
+		// Modules are regenerated from the template they were installed with
+		var pkg lockfile.Package
+		if rel, err := lockfile.RelativeModule(cfg.FlakePath, update.Module.Path); err == nil {
+			var ok bool
+			pkg, ok = lock.Get(rel)
+			if ok {
+				// The extras asked for at install time are written again
+				update.Latest.Extras = pkg.Extras
+			}
+			if ok && pkg.Template != "" && pkg.Template != templates.Default {
+				template, err := findTemplate(cmd.Context(), cfg, pkg.Template)
+				if err == nil {
+					update.Template, err = template.Parse()
+				}
+				if err != nil {
+					printError("Error: ", err)
+					return
+				}
+			}
+		}
+
+		change, err := update.Change(cfg.Namespace())
+		if err != nil {
+			printError("Could not read module: ", err)
+			return
+		}
+		err = validator.Validate(change.Path, []byte(change.New))
+		if err != nil {
+			printError("Error: ", err)
+			return
+		}
+		generated[change.Path] = change.New
+		if pkg.Edited([]byte(change.Old)) {
+			change.New, err = resolveHandEdit(cfg.Editor, change)
+			if err != nil {
+				printError("Form cancelled or error: ", err)
+				return
+			}
+			if change.New == change.Old {
+				continue
+			}
+		}
+		changes = append(changes, change)
+		regenerated = append(regenerated, update)
+	}
+	selected = regenerated
+	if len(changes) == 0 {
+		fmt.Println("No modules regenerated")
+		return
+	}
+
+	if updateDryRun {
+		printChanges(cfg.FlakePath, changes)
+		return
+	}
+
+	snapshot := beginBackup("update")
+	defer commitBackup(snapshot)
+	versions := make([]string, len(changes))
+	for i, change := range changes {
+		err = backupFile(snapshot, change.Path)
+		if err == nil {
+			err = hosts.Write(change)
+		}
+		if err != nil {
+			printError("Could not write module: ", err)
+			return
+		}
+		slog.Info("Regenerated " + updateLabel(selected[i]))
+		versions[i] = fmt.Sprintf("%s to %s", selected[i].Module.Name, selected[i].Latest.Version)
+	}
+
+	logChanges(cfg.FlakePath, changes)
+
+	lockPaths := updateLock(cfg, snapshot, func(lock *lockfile.Lock) {
+		for _, update := range selected {
+			rel, err := lockfile.RelativeModule(cfg.FlakePath, update.Module.Path)
+			if err != nil {
+				continue
+			}
+			if pkg, ok := lock.Get(rel); ok {
+				pkg.Attr = update.Latest.FullPath
+				pkg.Version = update.Latest.Version
+				pkg.Hash = lockfile.Hash([]byte(generated[update.Module.Path]))
+				lock.Put(pkg)
+			}
+		}
+	})
+
+	formatFiles(cmd.Context(), cfg, changedPaths(changes))
+	message := gitops.CommitMessage("update "+strings.Join(versions, ", "), nil)
+	autoCommit(cfg, message, append(changedPaths(changes), lockPaths...))
+	recordOperation(cmd, message, args)
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update [name...]",
+	Short: "Regenerate modules whose package has a new version in nixpkgs",
+	Long:  "Search nixpkgs again for every pam-managed package, or only the named ones, compare the versions with the ones recorded in the module headers and regenerate the outdated modules you select.",
+	Args:  cobra.ArbitraryArgs,
+	Run:   update,
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().BoolVarP(&updateYes, "yes", "y", false, "Regenerate every outdated module without asking")
+	updateCmd.Flags().BoolVar(&updateDryRun, "dry-run", false, "Show the changes as diffs without writing any file")
+	updateCmd.Flags().BoolVar(&updateNoCache, "no-cache", false, "Always run a fresh nix search instead of reusing cached results")
+	updateCmd.Flags().BoolVar(&updateForce, "force", false, "Also regenerate modules edited by hand since pam wrote them, without asking")
+	updateCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit the changes even when git_auto_commit is enabled")
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"pam/internal"
+	"pam/internal/flakelock"
+	"pam/internal/gitops"
+	"pam/internal/ui"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upgradeHosts  []string
+	upgradeYes    bool
+	upgradeDryRun bool
+)
+
+// upgradeJSON is an input of pam upgrade --output json
+type upgradeJSON struct {
+	Input string `json:"input"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// revisionLabel shows a locked revision with its date, or what happened to the input
+func revisionLabel(locked flakelock.Locked, missing string) string {
+	if locked == (flakelock.Locked{}) {
+		return missing
+	}
+	if date := locked.Date(); date != "" {
+		return fmt.Sprintf("%s (%s)", locked.Short(), date)
+	}
+	return locked.Short()
+}
+
+// selectRebuildHosts lets the user choose the hosts to switch after the upgrade among
+// those pam can switch: this machine and hosts with an ssh_target
+func selectRebuildHosts(cfg *internal.Config, hostDirs []string) ([]string, error) {
+	var options []huh.Option[string]
+	for _, host := range hostDirs {
+		if host == localHost() || cfg.Host(host).SSHTarget != "" {
+			options = append(options, huh.NewOption(host, host))
+		}
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+
+	var selected []string
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Select hosts to rebuild").
+				Description("Space to toggle, Enter to confirm, none to skip").
+				Options(options...).
+				Value(&selected),
+		),
+	).Run()
+	return selected, err
+}
+
+func upgrade(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	hostDirs, err := ui.GetDirNames(hostsDir)
+	if err != nil {
+		printError("Failed to read hosts directory: ", err)
+		return
+	}
+	rebuildHostNames, err := internal.ExpandHosts(upgradeHosts, cfg.HostGroupsOf(hostDirs))
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	nixArgs := append(append([]string{"flake", "update"}, args...), "--flake", cfg.FlakePath)
+	if upgradeDryRun {
+		fmt.Printf("Would run nix %s\n", strings.Join(nixArgs, " "))
+		return
+	}
+
+	before, err := flakelock.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read flake.lock: ", err)
+		return
+	}
+	lockPath := flakelock.Path(cfg.FlakePath)
+	snapshot := beginBackup("upgrade")
+	defer commitBackup(snapshot)
+	err = backupFile(snapshot, lockPath)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	title := "Updating every input in flake.lock..."
+	if len(args) > 0 {
+		title = fmt.Sprintf("Updating %s in flake.lock...", strings.Join(args, ", "))
+	}
+	var output []byte
+	var updateErr error
+	err = withSpinner(title, func() {
+		output, updateErr = nixRunner(cfg).CombinedOutput(cmd.Context(), nil, "nix", nixArgs...)
+	})
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if updateErr != nil {
+		failf("Error: nix flake update failed: %v\n%s", updateErr, output)
+		return
+	}
+
+	after, err := flakelock.Load(cfg.FlakePath)
+	if err != nil {
+		printError("Could not read flake.lock: ", err)
+		return
+	}
+	changes := flakelock.Diff(before, after)
+	if jsonOutput() {
+		results := []upgradeJSON{}
+		for _, change := range changes {
+			results = append(results, upgradeJSON{Input: change.Input, Old: change.Old.Rev, New: change.New.Rev})
+		}
+		printJSON(results)
+	}
+	if len(changes) == 0 {
+		slog.Info("Every input is up to date")
+		return
+	}
+
+	names := make([]string, len(changes))
+	for i, change := range changes {
+		names[i] = change.Input
+	}
+	if !jsonOutput() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INPUT\tOLD\tNEW")
+		for _, change := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", change.Input, revisionLabel(change.Old, "(new)"), revisionLabel(change.New, "(removed)"))
+		}
+		w.Flush()
+	}
+	message := gitops.CommitMessage("upgrade "+strings.Join(names, ", "), nil)
+	autoCommit(cfg, message, []string{lockPath})
+	recordOperation(cmd, message, args)
+
+	if len(rebuildHostNames) == 0 && !upgradeYes && !jsonOutput() {
+		rebuildHostNames, err = selectRebuildHosts(cfg, hostDirs)
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+	}
+	for _, host := range rebuildHostNames {
+		if !deployHost(cmd.Context(), cfg, hostsDir, host, false) && cmd.Context().Err() != nil {
+			return
+		}
+	}
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [input...]",
+	Short: "Update the flake's inputs, show the new revisions and rebuild hosts",
+	Long: `Run nix flake update for every input, or only the named ones, and list the revision
+each changed input moved from and to. The hosts given with --host, or the ones you select,
+are switched afterwards: this machine is rebuilt and hosts with an ssh_target are deployed.
+Undo the update of flake.lock with pam undo.`,
+	Run: upgrade,
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().StringArrayVar(&upgradeHosts, "host", nil, "Host or @group to rebuild after the update, repeatable")
+	upgradeCmd.Flags().BoolVarP(&upgradeYes, "yes", "y", false, "Don't ask which hosts to rebuild, only rebuild those given with --host")
+	upgradeCmd.Flags().BoolVar(&upgradeDryRun, "dry-run", false, "Print the nix flake update command without running it")
+	upgradeCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Don't commit flake.lock even when git_auto_commit is enabled")
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"pam/internal"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	workspaceFlag string
+	placeFlags    []string
+)
+
+// Flags choosing the flake of the install, which every member replaces with its own profile
+var workspaceFlags = []string{"workspace", "place", "profile", "flake-path"}
+
+// parsePlacements reads --place <package>=<profile> flags into the profile of each package
+func parsePlacements(flags []string, queries []string, members []string) (map[string]string, error) {
+	placements := make(map[string]string)
+	for _, flag := range flags {
+		query, member, ok := strings.Cut(flag, "=")
+		if !ok || query == "" || member == "" {
+			return nil, fmt.Errorf("invalid --place %q, use <package>=<profile>", flag)
+		}
+		if !slices.Contains(queries, query) {
+			return nil, fmt.Errorf("--place %q names %s, which isn't installed, packages: %s", flag, query, strings.Join(queries, ", "))
+		}
+		if !slices.Contains(members, member) {
+			return nil, fmt.Errorf("--place %q names profile %s, which isn't in the workspace, profiles: %s", flag, member, strings.Join(members, ", "))
+		}
+		placements[query] = member
+	}
+	return placements, nil
+}
+
+// memberLabel shows a profile of a workspace with the flake it changes
+func memberLabel(file *internal.Config, member string) string {
+	name := member
+	if member == internal.DefaultProfile {
+		name = ""
+	}
+	settings, err := file.WithProfile(name)
+	if err != nil || settings.FlakePath == "" {
+		return member
+	}
+	return fmt.Sprintf("%s (%s)", member, internal.ExpandPath(settings.FlakePath))
+}
+
+// installWorkspace asks which flake of the workspace each package goes into, then installs
+// them profile by profile with the other flags of the install
+func installWorkspace(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("profile") || cmd.Flags().Changed("flake-path") {
+		failf("Error: --workspace picks the profile of each package, it can't be used with --profile or --flake-path\n")
+		return
+	}
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+	members, err := file.Workspace(workspaceFlag)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	if len(args) == 0 {
+		failf("Error: name the packages to install into the workspace\n")
+		return
+	}
+	placements, err := parsePlacements(placeFlags, args, members)
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+
+	for _, query := range args {
+		if _, ok := placements[query]; ok {
+			continue
+		}
+		if len(members) == 1 {
+			placements[query] = members[0]
+			continue
+		}
+		if assumeYes {
+			failf("Error: --yes needs --place %s=<profile> to know which flake it goes into\n", query)
+			return
+		}
+		options := make([]huh.Option[string], len(members))
+		for i, member := range members {
+			options[i] = huh.NewOption(memberLabel(file, member), member)
+		}
+		member := members[0]
+		err := huh.NewSelect[string]().
+			Title(fmt.Sprintf("Which flake should %s go into?", query)).
+			Options(options...).
+			Value(&member).
+			Run()
+		if err != nil {
+			printError("Form cancelled or error: ", err)
+			return
+		}
+		placements[query] = member
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		printError("Error: ", err)
+		return
+	}
+	passed := flagArgs(cmd, workspaceFlags...)
+	var failed []string
+	for _, member := range members {
+		var queries []string
+		for _, query := range args {
+			if placements[query] == member {
+				queries = append(queries, query)
+			}
+		}
+		if len(queries) == 0 {
+			continue
+		}
+
+		slog.Info(fmt.Sprintf("Installing %s into %s", strings.Join(queries, ", "), memberLabel(file, member)))
+		memberArgs := append([]string{"install", "--profile", member}, queries...)
+		err := runner.Interactive(cmd.Context(), exe, append(memberArgs, passed...)...)
+		if err != nil {
+			failf("Error: installing into %s failed: %v\n", member, err)
+			failed = append(failed, member)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Printf("Installs into %s failed, the other profiles were changed\n", strings.Join(failed, ", "))
+	}
+}
+
+func workspaceList(cmd *cobra.Command, args []string) {
+	file, err := internal.ReadConfigFile()
+	if err != nil {
+		printError("Loading config failed. error:", err)
+		return
+	}
+
+	names := file.WorkspaceNames()
+	if len(names) == 0 {
+		fmt.Println("No workspaces configured, add them under workspaces in ~/.config/pam/config.yaml")
+		return
+	}
+	for _, name := range names {
+		fmt.Println(name)
+		for _, member := range file.Workspaces[name] {
+			fmt.Printf("  %s\n", memberLabel(file, member))
+		}
+	}
+}
+
+var workspaceCmd = &cobra.Command{
+	Use:   "workspace",
+	Short: "List workspaces, groups of profiles installed into together",
+}
+
+var workspaceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the workspaces with the flake of each profile",
+	Args:  cobra.NoArgs,
+	Run:   workspaceList,
+}
+
+func init() {
+	rootCmd.AddCommand(workspaceCmd)
+	workspaceCmd.AddCommand(workspaceListCmd)
+}
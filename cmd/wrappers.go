@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pam/internal/installer"
+	"pam/internal/modules"
+	"pam/internal/search"
+	"pam/internal/types"
+	"pam/internal/wrappers"
+
+	"github.com/charmbracelet/huh"
+)
+
+var (
+	useWrapper bool
+	noWrapper  bool
+)
+
+// chooseWrappers offers to build the interpreter with the language packages among the
+// selections, e.g. python311.withPackages (ps: [ ps.numpy ]) for python311Packages.numpy,
+// which the interpreter doesn't see when listed on its own. The packages of one set share
+// a module per category, named like python311-env, which keeps the packages earlier
+// installs put into it. --wrap builds them without asking, --no-wrap and --yes without
+// --wrap list the packages.
+func chooseWrappers(selections []installer.Selection, plan installer.Plan, fetchMeta func(types.Package) (search.Meta, error)) ([]installer.Selection, error) {
+	// Homebrew installs darwin packages as casks, which have no interpreter to build
+	if plan.Plain || plan.UseHomebrew || noWrapper {
+		return selections, nil
+	}
+	var result []installer.Selection
+	// envs are the indexes of the wrapper selections in result, by module file
+	envs := map[string]int{}
+	// answers remembers the choice for every set, so marking several packages asks once
+	answers := map[string]bool{}
+	for _, selection := range selections {
+		pkg := *selection.Package
+		wrapper, ok := wrappers.Detect(pkg.FullPath)
+		if pkg.Source != "" || pkg.Homebrew != nil || !ok {
+			if pkg.Source == "" && wrappers.DevShell(pkg.FullPath) && !assumeYes {
+				fmt.Printf("Note: %s is usually a dependency of a project, add it to the project's devshell with pam dev add instead of every host\n", pkg.FullPath)
+			}
+			result = append(result, selection)
+			continue
+		}
+
+		wrap, asked := answers[wrapper.Set]
+		switch {
+		case useWrapper:
+			wrap = true
+		case assumeYes:
+			wrap = false
+		case !asked:
+			interpreter := wrappers.Interpreter(wrapper)
+			err := huh.NewSelect[bool]().
+				Title(fmt.Sprintf("%s is a %s package, which %s doesn't see when it is listed on its own. How should it be installed?", pkg.FullPath, wrappers.Language(wrapper), interpreter)).
+				Options(
+					huh.NewOption(fmt.Sprintf("Build %s with it (%s module)", interpreter, wrappers.Name(wrapper)), true),
+					huh.NewOption("Plain package", false),
+				).
+				Value(&wrap).
+				Run()
+			if err != nil {
+				return nil, err
+			}
+			answers[wrapper.Set] = wrap
+		}
+		if !wrap {
+			result = append(result, selection)
+			continue
+		}
+
+		category := selection.Category
+		if category == "" {
+			category = plan.Category
+		}
+		file := installer.ModuleFile(NIX_APPS_DIR, category, wrappers.Name(wrapper))
+		if i, ok := envs[file]; ok {
+			env := *result[i].Package
+			wrappers.Apply(&env, wrappers.Merge(*env.Wrapper, wrapper))
+			result[i].Package = &env
+			continue
+		}
+		if _, err := os.Stat(file); err == nil {
+			// The packages installed before stay in the module
+			header, ok, err := modules.Module{Path: file}.Header()
+			if err != nil {
+				return nil, err
+			}
+			if existing, parsed := wrappers.Parse(header.With); ok && parsed && existing.Set == wrapper.Set {
+				wrapper = wrappers.Merge(existing, wrapper)
+			}
+		}
+
+		env := pkg
+		env.Version = ""
+		env.Program, env.DarwinService, env.Flatpak, env.Extras = "", "", "", nil
+		wrappers.Apply(&env, wrapper)
+		selection.Query = env.PName
+		selection.Package = &env
+		envs[file] = len(result)
+		result = append(result, selection)
+	}
+	if len(envs) == 0 {
+		return result, nil
+	}
+
+	// The module header records the version of the interpreter, which pam update compares
+	metaErrs := map[string]error{}
+	err := withSpinner("Checking the interpreters' metadata...", func() {
+		for n := range result {
+			env := *result[n].Package
+			if env.Wrapper == nil {
+				continue
+			}
+			meta, err := fetchMeta(env)
+			metaErrs[env.FullPath] = err
+			env.Version = meta.Version
+			result[n].Package = &env
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("running spinner: %w", err)
+	}
+	for interpreter, err := range metaErrs {
+		if err != nil {
+			fmt.Fprintf(messageOut(), "Warning: could not evaluate the version of %s: %v\n", interpreter, err)
+		}
+	}
+	return result, nil
+}
@@ -1,10 +1,16 @@
 package assets
 
 import (
-	_ "embed"
+	"embed"
+	"fmt"
 	"strings"
+	"text/template"
 
+	"pam/internal/nixconfig"
+	"pam/internal/search"
+	"pam/internal/services"
 	"pam/internal/types"
+	"pam/internal/wrappers"
 )
 
 //go:embed templates/packageTemplate.nix
@@ -13,25 +19,163 @@ var packageTemplate string
 //go:embed templates/mkApp.nix
 var mkApp string
 
-func FillPackageTemplate(pkg *types.Package, useHomebrew bool) string {
-	var linuxPackage string
-	var darwinPackage string
-	var homebrewPackage string
-
-	if strings.Contains(pkg.System, "linux") {
-		linuxPackage = "pkgs." + pkg.FullPath
-	} else if strings.Contains(pkg.System, "darwin") {
-		if useHomebrew {
-			homebrewPackage = pkg.PName
-		} else {
-			darwinPackage = "pkgs." + pkg.FullPath
+//go:embed templates/scaffold
+var scaffold embed.FS
+
+// PackageRef returns the nix expression a module uses for the package: pkgs.<attr> for
+// nixpkgs, or the attribute of the flake input the package was found in
+func PackageRef(pkg *types.Package) string {
+	if pkg.Source == "" {
+		return "pkgs." + pkg.FullPath
+	}
+	output := pkg.Output
+	if output == "" {
+		output = "packages"
+	}
+	return fmt.Sprintf("inputs.%s.%s.${pkgs.stdenv.hostPlatform.system}.%s", pkg.Source, output, pkg.FullPath)
+}
+
+// TemplateData is what module templates are executed with. The package's fields are
+// promoted, so templates use e.g. {{ .PName }} and {{ .Version }}.
+type TemplateData struct {
+	types.Package
+	// Ref is the nix expression of the package, see PackageRef
+	Ref string
+	// Input is the flake input the package comes from, nixpkgs unless found in another source
+	Input string
+	// Manager is "brew" when the package is installed as a Homebrew cask, "tap" for a
+	// formula of a Homebrew tap, "mas" for a Mac App Store app and "nix" otherwise
+	Manager string
+	// ExtraRefs are the expressions of the extra packages, e.g. pkgs.ffmpeg
+	ExtraRefs []string
+	// Env are the environment variables and Service the linux service of the Extras,
+	// ServiceSettings the options set in it
+	Env             []types.Setting
+	Service         string
+	ServiceSettings []types.Setting
+	UseHomebrew     bool
+	IsLinux         bool
+	IsDarwin        bool
+	// DarwinServiceSettings are written next to enable = true of the DarwinService
+	DarwinServiceSettings []types.Setting
+	// With lists the packages the Wrapper builds the interpreter with, e.g.
+	// python311Packages.numpy,python311Packages.pandas
+	With string
+	// Namespace is the attribute path mkApp declares the module's option under, apps
+	// unless option_namespace is set, e.g. myflake.apps
+	Namespace string
+}
+
+// NewTemplateData describes pkg for a template, with its option under namespace
+func NewTemplateData(pkg *types.Package, useHomebrew bool, namespace string) TemplateData {
+	data := TemplateData{
+		Package:   *pkg,
+		Ref:       PackageRef(pkg),
+		Input:     pkg.Source,
+		Manager:   "nix",
+		IsLinux:   strings.Contains(pkg.System, "linux"),
+		IsDarwin:  strings.Contains(pkg.System, "darwin"),
+		Namespace: namespace,
+	}
+	if data.Namespace == "" {
+		data.Namespace = nixconfig.DefaultNamespace
+	}
+	if data.Input == "" {
+		data.Input = search.NixpkgsSource
+	}
+	if pkg.DarwinService != "" {
+		data.DarwinServiceSettings = services.DarwinDefaults(pkg.DarwinService)
+	}
+	if pkg.Wrapper != nil {
+		data.Ref = wrappers.Expression(*pkg.Wrapper)
+		data.With = wrappers.Format(*pkg.Wrapper)
+	}
+	if extras := pkg.Extras; extras != nil {
+		if len(extras.Override) > 0 {
+			var args strings.Builder
+			for _, arg := range extras.Override {
+				fmt.Fprintf(&args, "%s = %s; ", arg.Name, arg.Value)
+			}
+			data.Ref = fmt.Sprintf("(%s.override { %s})", data.Ref, args.String())
+		}
+		for _, attr := range extras.Packages {
+			data.ExtraRefs = append(data.ExtraRefs, "pkgs."+attr)
 		}
+		data.Env = extras.Env
+		data.Service = extras.Service
+		data.ServiceSettings = extras.ServiceSettings
+	}
+	// Homebrew only applies to darwin packages
+	switch {
+	case !data.IsDarwin:
+	case pkg.Homebrew != nil && pkg.Homebrew.MasID != 0:
+		data.Manager = "mas"
+	case pkg.Homebrew != nil:
+		data.Manager = "tap"
+	case useHomebrew:
+		data.UseHomebrew = true
+		data.Manager = "brew"
+	}
+	return data
+}
+
+var templateFuncs = template.FuncMap{
+	"nixString": nixString,
+}
+
+// nixString escapes s for use inside a double quoted nix string
+func nixString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", "\\${").Replace(s)
+}
+
+// legacyPlaceholders translates templates written for the placeholder names pam used
+// before modules were generated with text/template
+var legacyPlaceholders = strings.NewReplacer(
+	"PackageName", "{{ .PName }}",
+	"PackageDescription", "{{ .Description }}",
+	"LinuxPackage", "{{ if .IsLinux }}{{ .Ref }}{{ end }}",
+	"DarwinPackage", "{{ if and .IsDarwin (not .UseHomebrew) }}{{ .Ref }}{{ end }}",
+	"HomebrewPackage", "{{ if .UseHomebrew }}{{ .PName }}{{ end }}",
+	"PackageAttr", "{{ .FullPath }}",
+	"PackageVersion", "{{ .Version }}",
+	"PackageSystem", "{{ .System }}",
+	"PackageSource", "{{ .Manager }}",
+	"PackageInput", "{{ .Input }}",
+)
+
+// ParseTemplate parses a module template. Templates without any {{ action }} are taken to
+// use the older placeholder names such as LinuxPackage and are translated. Templates
+// without the "# pam:" header line get the bundled one, so pam update can still track the module.
+func ParseTemplate(name string, content string) (*template.Template, error) {
+	if !strings.Contains(content, "{{") {
+		content = legacyPlaceholders.Replace(content)
+	}
+	if !strings.HasPrefix(content, "# pam:") {
+		header, _, _ := strings.Cut(packageTemplate, "\n")
+		content = header + "\n" + content
 	}
-	replacer := strings.NewReplacer("LinuxPackage", linuxPackage, "DarwinPackage", darwinPackage, "HomebrewPackage", homebrewPackage, "PackageName", pkg.PName, "PackageDescription", pkg.Description)
-	filledTemplate := replacer.Replace(packageTemplate)
-	// Clean up double spaces that occur when placeholders are replaced with empty strings
-	filledTemplate = strings.ReplaceAll(filledTemplate, "  ", " ")
-	return filledTemplate
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(content)
+}
+
+var bundledTemplate = template.Must(ParseTemplate("default", packageTemplate))
+
+// FillPackageTemplate generates the module of pkg from the template bundled with pam
+func FillPackageTemplate(pkg *types.Package, useHomebrew bool, namespace string) string {
+	// The bundled template is covered by the golden tests, executing it can't fail
+	module, _ := FillTemplate(bundledTemplate, pkg, useHomebrew, namespace)
+	return module
+}
+
+// FillTemplate generates the module of pkg from a template returned by ParseTemplate,
+// declaring its option under namespace
+func FillTemplate(tmpl *template.Template, pkg *types.Package, useHomebrew bool, namespace string) (string, error) {
+	var filled strings.Builder
+	err := tmpl.Execute(&filled, NewTemplateData(pkg, useHomebrew, namespace))
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", tmpl.Name(), err)
+	}
+	// Empty placeholders leave lists like `[  ]` behind, canonicalizing cleans them up
+	return CanonicalizeModule(filled.String()), nil
 }
 
 func GetPackageTemplate() string {
@@ -41,3 +185,17 @@ func GetPackageTemplate() string {
 func GetMkApp() string {
 	return mkApp
 }
+
+// ScaffoldFile executes one of the files pam init writes into a new flake with data
+func ScaffoldFile(name string, data any) (string, error) {
+	tmpl, err := template.ParseFS(scaffold, "templates/scaffold/"+name)
+	if err != nil {
+		return "", err
+	}
+	var filled strings.Builder
+	err = tmpl.Execute(&filled, data)
+	if err != nil {
+		return "", fmt.Errorf("scaffold %s: %w", name, err)
+	}
+	return filled.String(), nil
+}
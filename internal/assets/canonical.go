@@ -0,0 +1,118 @@
+package assets
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// fieldOrder is the canonical order of the attributes passed to mkApp.
+// Attributes not listed keep their relative order after the known ones.
+var fieldOrder = []string{
+	"_file",
+	"name",
+	"optionPath",
+	"namespace",
+	"description",
+	"packages",
+	"linuxPackages",
+	"darwinPackages",
+	"extraConfig",
+	"linuxExtraConfig",
+	"darwinExtraConfig",
+}
+
+var (
+	emptyListPattern = regexp.MustCompile(`\[\s*(""\s*)?\]`)
+	attrPattern      = regexp.MustCompile(`^(\s*)([A-Za-z_][A-Za-z0-9_'-]*)\s*=`)
+)
+
+type moduleField struct {
+	name  string
+	lines []string
+}
+
+func fieldRank(name string) int {
+	for i, field := range fieldOrder {
+		if field == name {
+			return i
+		}
+	}
+	return len(fieldOrder)
+}
+
+// CanonicalizeModule normalizes a generated module so that filling the same package
+// twice always produces byte-identical output: empty lists are collapsed to `[ ]`,
+// trailing whitespace and blank lines inside the mkApp call are removed, the mkApp
+// attributes are put in a stable order and the file ends with exactly one newline.
+func CanonicalizeModule(module string) string {
+	module = strings.ReplaceAll(module, "\r\n", "\n")
+	module = emptyListPattern.ReplaceAllString(module, "[ ]")
+
+	lines := strings.Split(module, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	lines = sortMkAppFields(lines)
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// sortMkAppFields reorders the attribute set passed to mkApp according to fieldOrder.
+// Multi-line attributes are moved as a whole.
+func sortMkAppFields(lines []string) []string {
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "mkApp {") {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return lines
+	}
+
+	end := -1
+	for i := start + 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "}") {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return lines
+	}
+
+	var fields []moduleField
+	indent := ""
+	for _, line := range lines[start+1 : end] {
+		if line == "" {
+			continue
+		}
+		match := attrPattern.FindStringSubmatch(line)
+		if match != nil && (len(fields) == 0 || match[1] == indent) {
+			indent = match[1]
+			fields = append(fields, moduleField{name: match[2], lines: []string{line}})
+			continue
+		}
+		if len(fields) == 0 {
+			// Unrecognized content before the first attribute, leave the block untouched
+			return lines
+		}
+		last := &fields[len(fields)-1]
+		last.lines = append(last.lines, line)
+	}
+
+	sort.SliceStable(fields, func(a, b int) bool {
+		return fieldRank(fields[a].name) < fieldRank(fields[b].name)
+	})
+
+	sorted := make([]string, 0, len(lines))
+	sorted = append(sorted, lines[:start+1]...)
+	for _, field := range fields {
+		sorted = append(sorted, field.lines...)
+	}
+	sorted = append(sorted, lines[end:]...)
+	return sorted
+}
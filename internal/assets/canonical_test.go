@@ -0,0 +1,68 @@
+package assets
+
+import (
+	"testing"
+)
+
+func TestCanonicalizeModule(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "trims leading and trailing blank lines",
+			input: "\n\nmkApp {\n  name = \"vim\";\n} args\n\n\n",
+			want:  "mkApp {\n  name = \"vim\";\n} args\n",
+		},
+		{
+			name:  "collapses empty lists",
+			input: "mkApp {\n  darwinPackages = pkgs: [  ];\n  darwinExtraConfig = { homebrew.casks = [ \"\" ]; };\n} args",
+			want:  "mkApp {\n  darwinPackages = pkgs: [ ];\n  darwinExtraConfig = { homebrew.casks = [ ]; };\n} args\n",
+		},
+		{
+			name:  "removes blank lines and trailing whitespace inside mkApp",
+			input: "mkApp {\n  name = \"vim\";   \n\n  description = \"editor\";\n} args\n",
+			want:  "mkApp {\n  name = \"vim\";\n  description = \"editor\";\n} args\n",
+		},
+		{
+			name:  "sorts fields into canonical order",
+			input: "mkApp {\n  darwinPackages = pkgs: [ ];\n  name = \"vim\";\n  _file = toString ./.;\n  linuxPackages = pkgs: [ pkgs.vim ];\n} args\n",
+			want:  "mkApp {\n  _file = toString ./.;\n  name = \"vim\";\n  linuxPackages = pkgs: [ pkgs.vim ];\n  darwinPackages = pkgs: [ ];\n} args\n",
+		},
+		{
+			name:  "moves multi-line fields as a whole",
+			input: "mkApp {\n  extraConfig = {\n    programs.vim.enable = true;\n  };\n  name = \"vim\";\n} args\n",
+			want:  "mkApp {\n  name = \"vim\";\n  extraConfig = {\n    programs.vim.enable = true;\n  };\n} args\n",
+		},
+		{
+			name:  "keeps unknown fields after known ones",
+			input: "mkApp {\n  custom = 1;\n  name = \"vim\";\n  other = 2;\n} args\n",
+			want:  "mkApp {\n  name = \"vim\";\n  custom = 1;\n  other = 2;\n} args\n",
+		},
+		{
+			name:  "content without mkApp is only trimmed",
+			input: "{ pkgs }:\n\n{ }\n\n",
+			want:  "{ pkgs }:\n\n{ }\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CanonicalizeModule(tt.input)
+			if got != tt.want {
+				t.Errorf("CanonicalizeModule() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeModule_Idempotent(t *testing.T) {
+	input := "\nmkApp {\n  darwinPackages = pkgs: [  ];\n\n  name = \"vim\";\n} args"
+
+	once := CanonicalizeModule(input)
+	twice := CanonicalizeModule(once)
+	if once != twice {
+		t.Errorf("CanonicalizeModule() is not idempotent:\nfirst:  %q\nsecond: %q", once, twice)
+	}
+}
@@ -1,12 +1,18 @@
 package assets
 
 import (
+	"flag"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"pam/internal/nixconfig"
 	"pam/internal/types"
 )
 
+var update = flag.Bool("update", false, "update golden files")
+
 func TestFillPackageTemplate(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -84,7 +90,7 @@ func TestFillPackageTemplate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := FillPackageTemplate(tt.pkg, tt.useHomebrew)
+			got := FillPackageTemplate(tt.pkg, tt.useHomebrew, "")
 
 			// Check that all expected strings are present
 			for _, want := range tt.wantContains {
@@ -108,10 +114,10 @@ func TestGetTemplate(t *testing.T) {
 
 	// Verify that the template contains expected placeholders
 	expectedPlaceholders := []string{
-		"PackageName",
-		"LinuxPackage",
-		"DarwinPackage",
-		"HomebrewPackage",
+		"{{ .PName }}",
+		"{{ .Ref }}",
+		"{{ if .IsLinux }}",
+		"{{ if .UseHomebrew }}",
 	}
 
 	for _, placeholder := range expectedPlaceholders {
@@ -140,7 +146,7 @@ func TestFillPackageTemplate_AllPlaceholdersReplaced(t *testing.T) {
 		Description: "Test package",
 	}
 
-	result := FillPackageTemplate(pkg, false)
+	result := FillPackageTemplate(pkg, false, "")
 
 	// Ensure no unreplaced placeholders remain
 	placeholders := []string{
@@ -162,7 +168,7 @@ func TestFillPackageTemplate_PreservesTemplateStructure(t *testing.T) {
 		System:   "x86_64-linux",
 	}
 
-	result := FillPackageTemplate(pkg, false)
+	result := FillPackageTemplate(pkg, false, "")
 
 	// Verify essential Nix syntax is preserved
 	essentialParts := []string{
@@ -225,7 +231,7 @@ func TestFillPackageTemplate_EmptyValues(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := FillPackageTemplate(tt.pkg, tt.useHomebrew)
+			result := FillPackageTemplate(tt.pkg, tt.useHomebrew, "")
 
 			for _, empty := range tt.checkEmpty {
 				if !strings.Contains(result, empty) {
@@ -248,7 +254,7 @@ func BenchmarkFillPackageTemplate(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		FillPackageTemplate(pkg, false)
+		FillPackageTemplate(pkg, false, "")
 	}
 }
 
@@ -260,10 +266,298 @@ func TestFillPackageTemplate_SpecialCharactersInDescription(t *testing.T) {
 		Description: "A \"quoted\" description with 'apostrophes' and newlines\n",
 	}
 
-	result := FillPackageTemplate(pkg, false)
+	result := FillPackageTemplate(pkg, false, "")
 
 	// Should contain the description even with special characters
 	if !strings.Contains(result, "quoted") {
 		t.Error("FillPackageTemplate() failed to preserve quoted text in description")
 	}
 }
+
+func TestFillPackageTemplate_Golden(t *testing.T) {
+	tests := []struct {
+		name        string
+		pkg         *types.Package
+		useHomebrew bool
+	}{
+		{
+			name: "linux",
+			pkg: &types.Package{
+				PName:       "firefox",
+				FullPath:    "firefox",
+				System:      "x86_64-linux",
+				Version:     "120.0",
+				Description: "A web browser",
+			},
+		},
+		{
+			name: "darwin-nix",
+			pkg: &types.Package{
+				PName:       "firefox",
+				FullPath:    "firefox",
+				System:      "aarch64-darwin",
+				Version:     "120.0",
+				Description: "A web browser",
+			},
+		},
+		{
+			name: "darwin-brew",
+			pkg: &types.Package{
+				PName:       "firefox",
+				FullPath:    "firefox",
+				System:      "aarch64-darwin",
+				Version:     "120.0",
+				Description: "A web browser",
+			},
+			useHomebrew: true,
+		},
+		{
+			name: "cross-platform",
+			pkg: &types.Package{
+				PName:       "firefox",
+				FullPath:    "firefox",
+				System:      "x86_64-linux,aarch64-darwin",
+				Version:     "120.0",
+				Description: "A web browser",
+			},
+		},
+		{
+			name: "cross-platform-brew",
+			pkg: &types.Package{
+				PName:       "firefox",
+				FullPath:    "firefox",
+				System:      "x86_64-linux,aarch64-darwin",
+				Version:     "120.0",
+				Description: "A web browser",
+			},
+			useHomebrew: true,
+		},
+		{
+			name: "flake-input",
+			pkg: &types.Package{
+				PName:       "emacs-git",
+				FullPath:    "emacs-git",
+				System:      "x86_64-linux",
+				Version:     "30.0.50",
+				Description: "The extensible, customizable text editor",
+				Output:      "packages",
+				Source:      "emacs-overlay",
+			},
+		},
+		{
+			name: "program",
+			pkg: &types.Package{
+				PName:       "git",
+				FullPath:    "git",
+				System:      "x86_64-linux,aarch64-darwin",
+				Version:     "2.47.0",
+				Description: "Distributed version control system",
+				Program:     "git",
+			},
+		},
+		{
+			name: "extras",
+			pkg: &types.Package{
+				PName:       "mpv",
+				FullPath:    "mpv",
+				System:      "x86_64-linux,aarch64-darwin",
+				Version:     "0.39.0",
+				Description: "General-purpose media player",
+				Extras: &types.Extras{
+					Override: []types.Setting{{Name: "youtubeSupport", Value: "true"}},
+					Packages: []string{"yt-dlp", "ffmpeg"},
+					Env:      []types.Setting{{Name: "MPV_HOME", Value: "$HOME/.mpv \"quoted\""}},
+					Service:  "mpd",
+				},
+			},
+		},
+		{
+			name: "darwin-service",
+			pkg: &types.Package{
+				PName:         "yabai",
+				FullPath:      "yabai",
+				System:        "aarch64-darwin",
+				Version:       "7.1.5",
+				Description:   "Tiling window manager for macOS",
+				DarwinService: "yabai",
+			},
+		},
+		{
+			name: "flatpak",
+			pkg: &types.Package{
+				PName:       "firefox",
+				FullPath:    "firefox",
+				System:      "x86_64-linux,aarch64-darwin",
+				Version:     "120.0",
+				Description: "A web browser",
+				Flatpak:     "org.mozilla.firefox",
+			},
+		},
+		{
+			name: "wrapper",
+			pkg: &types.Package{
+				PName:       "python311-env",
+				FullPath:    "python311",
+				System:      "x86_64-linux,aarch64-darwin",
+				Version:     "3.11.9",
+				Description: "python311 with numpy, pandas",
+				Wrapper:     &types.Wrapper{Set: "python311Packages", Packages: []string{"numpy", "pandas"}},
+			},
+		},
+		{
+			name: "darwin-tap",
+			pkg: &types.Package{
+				PName:       "sketchybar",
+				FullPath:    "felixkratz/formulae/sketchybar",
+				System:      "aarch64-darwin",
+				Description: "Homebrew formula from the felixkratz/formulae tap",
+				Homebrew:    &types.Homebrew{Tap: "felixkratz/formulae", Formula: "sketchybar"},
+			},
+		},
+		{
+			name: "darwin-mas",
+			pkg: &types.Package{
+				PName:       "xcode",
+				FullPath:    "497799835",
+				System:      "aarch64-darwin",
+				Version:     "16.0",
+				Description: "Mac App Store app Xcode",
+				Homebrew:    &types.Homebrew{MasID: 497799835, MasName: "Xcode"},
+			},
+		},
+		{
+			name: "nixos-service",
+			pkg: &types.Package{
+				PName:       "postgresql",
+				FullPath:    "postgresql",
+				System:      "x86_64-linux",
+				Version:     "16.4",
+				Description: "Powerful, open source object-relational database system",
+				Extras: &types.Extras{
+					Service:         "postgresql",
+					ServiceSettings: []types.Setting{{Name: "port", Value: "5433"}, {Name: "dataDir", Value: `"/srv/postgres"`}},
+				},
+			},
+		},
+		{
+			name: "extras-program",
+			pkg: &types.Package{
+				PName:       "git",
+				FullPath:    "git",
+				System:      "x86_64-linux",
+				Version:     "2.47.0",
+				Description: "Distributed version control system",
+				Program:     "git",
+				Extras:      &types.Extras{Packages: []string{"git-lfs"}, Service: "gitDaemon"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FillPackageTemplate(tt.pkg, tt.useHomebrew, "")
+
+			goldenPath := filepath.Join("testdata", "golden", tt.name+".nix")
+			if *update {
+				if err := os.WriteFile(goldenPath, []byte(got), 0o644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("FillPackageTemplate() does not match %s\nGot:\n%s\nWant:\n%s", goldenPath, got, want)
+			}
+
+			// Regenerating the same package must be byte-identical
+			if again := FillPackageTemplate(tt.pkg, tt.useHomebrew, ""); again != got {
+				t.Error("FillPackageTemplate() is not deterministic")
+			}
+		})
+	}
+}
+
+func TestFillTemplate_Custom(t *testing.T) {
+	linux := &types.Package{PName: "ripgrep", FullPath: "ripgrep", System: "x86_64-linux", Version: "14.1.0", Description: `Search "fast"`}
+	darwin := &types.Package{PName: "ripgrep", FullPath: "ripgrep", System: "aarch64-darwin", Version: "14.1.0"}
+
+	tests := []struct {
+		name        string
+		template    string
+		pkg         *types.Package
+		useHomebrew bool
+		want        []string
+	}{
+		{
+			name:     "conditionals",
+			template: "{ pkgs, ... }:\n{\n  # {{ .PName }} {{ .Version }}\n  environment.systemPackages = [{{ if .IsLinux }} {{ .Ref }} {{ end }}];\n}\n",
+			pkg:      linux,
+			want:     []string{"# ripgrep 14.1.0", "[ pkgs.ripgrep ]"},
+		},
+		{
+			name:     "escaped description",
+			template: "{ description = \"{{ nixString .Description }}\"; packages = [ {{ .Ref }} ]; }\n",
+			pkg:      linux,
+			want:     []string{`description = "Search \"fast\""`},
+		},
+		{
+			name:        "legacy placeholders",
+			template:    "mkApp {\n  name = \"PackageName\";\n  linuxPackages = pkgs: [ LinuxPackage ];\n  darwinExtraConfig = { homebrew.casks = [ \"HomebrewPackage\" ]; };\n}\n",
+			pkg:         darwin,
+			useHomebrew: true,
+			want:        []string{`name = "ripgrep"`, "linuxPackages = pkgs: [ ]", `homebrew.casks = [ "ripgrep" ]`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.name, tt.template)
+			if err != nil {
+				t.Fatalf("ParseTemplate() error = %v", err)
+			}
+			got, err := FillTemplate(tmpl, tt.pkg, tt.useHomebrew, "")
+			if err != nil {
+				t.Fatalf("FillTemplate() error = %v", err)
+			}
+
+			// Templates without a header get the bundled one
+			if !strings.HasPrefix(got, "# pam: attr=ripgrep version=14.1.0 system="+tt.pkg.System) {
+				t.Errorf("FillTemplate() did not add the pam header:\n%s", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("FillTemplate() missing %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFillPackageTemplate_Namespace(t *testing.T) {
+	pkg := &types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux", Version: "120.0"}
+
+	if got := FillPackageTemplate(pkg, false, nixconfig.DefaultNamespace); strings.Contains(got, "namespace =") {
+		t.Errorf("FillPackageTemplate() sets the default namespace:\n%s", got)
+	}
+	got := FillPackageTemplate(pkg, false, "myflake.apps")
+	if !strings.Contains(got, "namespace = \"myflake.apps\";") {
+		t.Errorf("FillPackageTemplate() missing the namespace:\n%s", got)
+	}
+}
+
+func TestParseTemplate_Errors(t *testing.T) {
+	if _, err := ParseTemplate("broken", "{{ if .IsLinux }}"); err == nil {
+		t.Error("ParseTemplate() expected error for an unclosed action")
+	}
+
+	tmpl, err := ParseTemplate("unknown", "{{ .Homepage }}")
+	if err != nil {
+		t.Fatalf("ParseTemplate() error = %v", err)
+	}
+	if _, err := FillTemplate(tmpl, &types.Package{PName: "vim"}, false, ""); err == nil {
+		t.Error("FillTemplate() expected error for an unknown field")
+	}
+}
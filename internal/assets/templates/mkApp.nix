@@ -7,6 +7,8 @@
   # Auto-derive optionPath from file location (or specify manually)
   _file ? null,
   optionPath ? null,
+  # Attribute path the derived option is declared under, set by pam's option_namespace
+  namespace ? "apps",
   # Cross-platform (use same packages for both)
   packages ? null,
   # Platform-specific packages
@@ -46,7 +48,7 @@ let
         # Convert path separators to dots (e.g., "gaming/utils" -> "gaming.utils")
         categoryPath = builtins.replaceStrings [ "/" ] [ "." ] relativePath;
         # Build the full option path: "apps.category.name"
-        fullPath = "apps.${categoryPath}.${name}";
+        fullPath = "${namespace}.${categoryPath}.${name}";
       in
       fullPath
     else
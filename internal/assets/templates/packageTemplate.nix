@@ -1,3 +1,4 @@
+# pam: attr={{ .FullPath }} version={{ .Version }} system={{ .System }} source={{ .Manager }} input={{ .Input }}{{ if .Program }} program={{ .Program }}{{ end }}{{ if .DarwinService }} darwin-service={{ .DarwinService }}{{ end }}{{ if .Flatpak }} flatpak={{ .Flatpak }}{{ end }}{{ if .With }} with={{ .With }}{{ end }}
 args@{
   config,
   pkgs,
@@ -10,9 +11,25 @@ args@{
 
 mkApp {
   _file = toString ./.;
-  name = "PackageName";
-  description = "PackageDescription";
-  linuxPackages = pkgs: [ LinuxPackage ];
-  darwinPackages = pkgs: [ DarwinPackage ];
-  darwinExtraConfig = { homebrew.casks = [ "HomebrewPackage" ]; };
+  name = "{{ .PName }}";
+{{- if ne .Namespace "apps" }}
+  namespace = "{{ .Namespace }}";
+{{- end }}
+  description = "{{ nixString .Description }}";
+{{- if .Program }}
+  linuxPackages = pkgs: [ {{ if .IsLinux }}{{ range .ExtraRefs }}{{ . }} {{ end }}{{ end }}];
+  darwinPackages = pkgs: [ {{ if .IsDarwin }}{{ range .ExtraRefs }}{{ . }} {{ end }}{{ end }}];
+  linuxExtraConfig = { {{ if .IsLinux }}programs.{{ .Program }}.enable = true; {{ if .Service }}services.{{ .Service }}.enable = true; {{ range .ServiceSettings }}services.{{ $.Service }}.{{ .Name }} = {{ .Value }}; {{ end }}{{ end }}{{ end }}};
+  darwinExtraConfig = { {{ if .IsDarwin }}programs.{{ .Program }}.enable = true; {{ end }}};
+{{- else }}
+  linuxPackages = pkgs: [ {{ if and .IsLinux (not .Flatpak) }}{{ .Ref }} {{ end }}{{ if .IsLinux }}{{ range .ExtraRefs }}{{ . }} {{ end }}{{ end }}];
+  darwinPackages = pkgs: [ {{ if and .IsDarwin (not .UseHomebrew) (not .DarwinService) (not .Homebrew) }}{{ .Ref }} {{ end }}{{ if .IsDarwin }}{{ range .ExtraRefs }}{{ . }} {{ end }}{{ end }}];
+  darwinExtraConfig = { {{ if and .IsDarwin .DarwinService }}services.{{ .DarwinService }} = { enable = true; {{ range .DarwinServiceSettings }}{{ .Name }} = {{ .Value }}; {{ end }}}; {{ end }}homebrew.casks = [ {{ if .UseHomebrew }}"{{ .PName }}"{{ end }} ]; {{ with .Homebrew }}{{ if .Tap }}homebrew.taps = [ "{{ .Tap }}" ]; homebrew.brews = [ "{{ .Tap }}/{{ .Formula }}" ]; {{ end }}{{ if .MasID }}homebrew.masApps = { "{{ nixString .MasName }}" = {{ .MasID }}; }; {{ end }}{{ end }}};
+{{- if and .IsLinux (or .Service .Flatpak) }}
+  linuxExtraConfig = { {{ if .Service }}services.{{ .Service }}.enable = true; {{ range .ServiceSettings }}services.{{ $.Service }}.{{ .Name }} = {{ .Value }}; {{ end }}{{ end }}{{ if .Flatpak }}services.flatpak.enable = true; services.flatpak.packages = [ "{{ .Flatpak }}" ]; {{ end }}};
+{{- end }}
+{{- end }}
+{{- if .Env }}
+  extraConfig = { environment.variables = { {{ range .Env }}{{ .Name }} = "{{ nixString .Value }}"; {{ end }}}; };
+{{- end }}
 } args
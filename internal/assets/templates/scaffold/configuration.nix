@@ -0,0 +1,32 @@
+{ pkgs, ... }:
+
+{
+  imports = [ {{ if .HasHardware }}./hardware-configuration.nix {{ end }}];
+{{ if .IsDarwin }}
+  nixpkgs.hostPlatform = "{{ .System }}";
+  nix.settings.experimental-features = [
+    "nix-command"
+    "flakes"
+  ];
+
+  # Homebrew casks installed with pam install --brew need Homebrew itself
+  homebrew.enable = true;
+  system.primaryUser = "{{ .User }}";
+
+  system.stateVersion = 6;
+{{- else }}
+  networking.hostName = "{{ .Host }}";
+  nixpkgs.hostPlatform = "{{ .System }}";
+  nix.settings.experimental-features = [
+    "nix-command"
+    "flakes"
+  ];
+
+  # Set to the NixOS release this machine was first installed with
+  system.stateVersion = "26.05";
+{{- end }}
+
+  # Packages installed with pam are enabled here
+  apps = {
+  };
+}
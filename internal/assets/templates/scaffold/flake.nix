@@ -0,0 +1,38 @@
+{
+  description = "{{ if .IsDarwin }}nix-darwin{{ else }}NixOS{{ end }} configuration managed with pam";
+
+  inputs = {
+    nixpkgs.url = "github:NixOS/nixpkgs/{{ if .IsDarwin }}nixpkgs-unstable{{ else }}nixos-unstable{{ end }}";
+    stable-nixpkgs.url = "github:NixOS/nixpkgs/{{ if .IsDarwin }}nixpkgs-26.05-darwin{{ else }}nixos-26.05{{ end }}";
+{{- if .IsDarwin }}
+    nix-darwin.url = "github:nix-darwin/nix-darwin/master";
+    nix-darwin.inputs.nixpkgs.follows = "nixpkgs";
+{{- end }}
+  };
+
+  outputs =
+    inputs@{ nixpkgs, {{ if .IsDarwin }}nix-darwin, {{ end }}... }:
+    let
+      mkApp = import ./lib/mkApp.nix { inherit (nixpkgs) lib; };
+    in
+    {
+{{- if .IsDarwin }}
+      darwinConfigurations."{{ .Host }}" = nix-darwin.lib.darwinSystem {
+        specialArgs = {
+          inherit inputs mkApp;
+          isLinux = false;
+        };
+{{- else }}
+      nixosConfigurations."{{ .Host }}" = nixpkgs.lib.nixosSystem {
+        specialArgs = {
+          inherit inputs mkApp;
+          isLinux = true;
+        };
+{{- end }}
+        modules = [
+          ./{{ .HostDir }}/{{ .Host }}/configuration.nix
+          ./{{ .ModuleDir }}
+        ];
+      };
+    };
+}
@@ -0,0 +1,7 @@
+# Placeholder for the hardware of {{ .Host }}. Replace it with the output of
+#   nixos-generate-config --show-hardware-config
+# on the machine before its first rebuild.
+{ ... }:
+
+{
+}
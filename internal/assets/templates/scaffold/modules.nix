@@ -0,0 +1,8 @@
+# Imports every module below this folder, so the modules pam generates are picked up
+{ lib, ... }:
+
+{
+  imports = builtins.filter (
+    path: lib.hasSuffix ".nix" (toString path) && baseNameOf path != "default.nix"
+  ) (lib.filesystem.listFilesRecursive ./.);
+}
@@ -0,0 +1,19 @@
+# pam: attr=firefox version=120.0 system=x86_64-linux,aarch64-darwin source=nix input=nixpkgs
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "firefox";
+  description = "A web browser";
+  linuxPackages = pkgs: [ pkgs.firefox ];
+  darwinPackages = pkgs: [ pkgs.firefox ];
+  darwinExtraConfig = { homebrew.casks = [ ]; };
+} args
@@ -0,0 +1,19 @@
+# pam: attr=firefox version=120.0 system=aarch64-darwin source=brew input=nixpkgs
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "firefox";
+  description = "A web browser";
+  linuxPackages = pkgs: [ ];
+  darwinPackages = pkgs: [ ];
+  darwinExtraConfig = { homebrew.casks = [ "firefox" ]; };
+} args
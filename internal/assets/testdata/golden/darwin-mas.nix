@@ -0,0 +1,19 @@
+# pam: attr=497799835 version=16.0 system=aarch64-darwin source=mas input=nixpkgs
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "xcode";
+  description = "Mac App Store app Xcode";
+  linuxPackages = pkgs: [ ];
+  darwinPackages = pkgs: [ ];
+  darwinExtraConfig = { homebrew.casks = [ ]; homebrew.masApps = { "Xcode" = 497799835; }; };
+} args
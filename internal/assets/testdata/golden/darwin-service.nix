@@ -0,0 +1,19 @@
+# pam: attr=yabai version=7.1.5 system=aarch64-darwin source=nix input=nixpkgs darwin-service=yabai
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "yabai";
+  description = "Tiling window manager for macOS";
+  linuxPackages = pkgs: [ ];
+  darwinPackages = pkgs: [ ];
+  darwinExtraConfig = { services.yabai = { enable = true; config = { layout = "bsp"; window_placement = "second_child"; window_gap = 8; }; }; homebrew.casks = [ ]; };
+} args
@@ -0,0 +1,19 @@
+# pam: attr=felixkratz/formulae/sketchybar version= system=aarch64-darwin source=tap input=nixpkgs
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "sketchybar";
+  description = "Homebrew formula from the felixkratz/formulae tap";
+  linuxPackages = pkgs: [ ];
+  darwinPackages = pkgs: [ ];
+  darwinExtraConfig = { homebrew.casks = [ ]; homebrew.taps = [ "felixkratz/formulae" ]; homebrew.brews = [ "felixkratz/formulae/sketchybar" ]; };
+} args
@@ -0,0 +1,20 @@
+# pam: attr=git version=2.47.0 system=x86_64-linux source=nix input=nixpkgs program=git
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "git";
+  description = "Distributed version control system";
+  linuxPackages = pkgs: [ pkgs.git-lfs ];
+  darwinPackages = pkgs: [ ];
+  linuxExtraConfig = { programs.git.enable = true; services.gitDaemon.enable = true; };
+  darwinExtraConfig = { };
+} args
@@ -0,0 +1,21 @@
+# pam: attr=mpv version=0.39.0 system=x86_64-linux,aarch64-darwin source=nix input=nixpkgs
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "mpv";
+  description = "General-purpose media player";
+  linuxPackages = pkgs: [ (pkgs.mpv.override { youtubeSupport = true; }) pkgs.yt-dlp pkgs.ffmpeg ];
+  darwinPackages = pkgs: [ (pkgs.mpv.override { youtubeSupport = true; }) pkgs.yt-dlp pkgs.ffmpeg ];
+  extraConfig = { environment.variables = { MPV_HOME = "$HOME/.mpv \"quoted\""; }; };
+  linuxExtraConfig = { services.mpd.enable = true; };
+  darwinExtraConfig = { homebrew.casks = [ ]; };
+} args
@@ -0,0 +1,19 @@
+# pam: attr=emacs-git version=30.0.50 system=x86_64-linux source=nix input=emacs-overlay
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "emacs-git";
+  description = "The extensible, customizable text editor";
+  linuxPackages = pkgs: [ inputs.emacs-overlay.packages.${pkgs.stdenv.hostPlatform.system}.emacs-git ];
+  darwinPackages = pkgs: [ ];
+  darwinExtraConfig = { homebrew.casks = [ ]; };
+} args
@@ -0,0 +1,20 @@
+# pam: attr=firefox version=120.0 system=x86_64-linux,aarch64-darwin source=nix input=nixpkgs flatpak=org.mozilla.firefox
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "firefox";
+  description = "A web browser";
+  linuxPackages = pkgs: [ ];
+  darwinPackages = pkgs: [ pkgs.firefox ];
+  linuxExtraConfig = { services.flatpak.enable = true; services.flatpak.packages = [ "org.mozilla.firefox" ]; };
+  darwinExtraConfig = { homebrew.casks = [ ]; };
+} args
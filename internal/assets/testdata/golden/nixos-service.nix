@@ -0,0 +1,20 @@
+# pam: attr=postgresql version=16.4 system=x86_64-linux source=nix input=nixpkgs
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "postgresql";
+  description = "Powerful, open source object-relational database system";
+  linuxPackages = pkgs: [ pkgs.postgresql ];
+  darwinPackages = pkgs: [ ];
+  linuxExtraConfig = { services.postgresql.enable = true; services.postgresql.port = 5433; services.postgresql.dataDir = "/srv/postgres"; };
+  darwinExtraConfig = { homebrew.casks = [ ]; };
+} args
@@ -0,0 +1,20 @@
+# pam: attr=git version=2.47.0 system=x86_64-linux,aarch64-darwin source=nix input=nixpkgs program=git
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "git";
+  description = "Distributed version control system";
+  linuxPackages = pkgs: [ ];
+  darwinPackages = pkgs: [ ];
+  linuxExtraConfig = { programs.git.enable = true; };
+  darwinExtraConfig = { programs.git.enable = true; };
+} args
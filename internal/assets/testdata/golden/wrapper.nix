@@ -0,0 +1,19 @@
+# pam: attr=python311 version=3.11.9 system=x86_64-linux,aarch64-darwin source=nix input=nixpkgs with=python311Packages.numpy,python311Packages.pandas
+args@{
+  config,
+  pkgs,
+  lib,
+  inputs ? null,
+  isLinux,
+  mkApp,
+  ...
+}:
+
+mkApp {
+  _file = toString ./.;
+  name = "python311-env";
+  description = "python311 with numpy, pandas";
+  linuxPackages = pkgs: [ (pkgs.python311.withPackages (ps: [ ps.numpy ps.pandas ])) ];
+  darwinPackages = pkgs: [ (pkgs.python311.withPackages (ps: [ ps.numpy ps.pandas ])) ];
+  darwinExtraConfig = { homebrew.casks = [ ]; };
+} args
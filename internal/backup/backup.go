@@ -0,0 +1,289 @@
+package backup
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"pam/internal/fsx"
+)
+
+// MaxSnapshots is how many snapshots are kept before the oldest are pruned
+const MaxSnapshots = 50
+
+const manifestName = "manifest.json"
+
+// File is one file saved by a snapshot
+type File struct {
+	Path string `json:"path"`
+	// Backup is the copy of the original inside the snapshot directory
+	Backup string `json:"backup,omitempty"`
+	// Created is set when the file did not exist, so restoring deletes it
+	Created bool `json:"created,omitempty"`
+	// After is the copy of the content the command left, for redo
+	After string `json:"after,omitempty"`
+	// Removed is set when the command deleted the file
+	Removed bool `json:"removed,omitempty"`
+}
+
+// Manifest describes a snapshot taken before one command edited the flake
+type Manifest struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Files   []File    `json:"files"`
+	// Undone is set while pam undo has reverted the snapshot's command
+	Undone bool `json:"undone,omitempty"`
+
+	dir string
+}
+
+// Store keeps snapshots in subdirectories of a single directory
+type Store struct {
+	dir string
+	now func() time.Time
+}
+
+// DefaultDir returns the backup directory inside pam's state directory
+func DefaultDir(stateDir string) string {
+	return filepath.Join(stateDir, "backups")
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, now: time.Now}
+}
+
+// List returns every snapshot, oldest first
+func (s *Store) List() ([]Manifest, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, manifestName))
+		if err != nil {
+			// Snapshots interrupted before their manifest was written can't be restored
+			continue
+		}
+		var manifest Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", dir, err)
+		}
+		manifest.dir = dir
+		manifests = append(manifests, manifest)
+	}
+
+	slices.SortFunc(manifests, func(a, b Manifest) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return manifests, nil
+}
+
+// Find returns the snapshot with the given id
+func (s *Store) Find(id int) (Manifest, error) {
+	manifests, err := s.List()
+	if err != nil {
+		return Manifest{}, err
+	}
+	for _, manifest := range manifests {
+		if manifest.ID == id {
+			return manifest, nil
+		}
+	}
+	return Manifest{}, fmt.Errorf("no backup with id %d", id)
+}
+
+// Last returns the most recent snapshot
+func (s *Store) Last() (Manifest, error) {
+	manifests, err := s.List()
+	if err != nil {
+		return Manifest{}, err
+	}
+	if len(manifests) == 0 {
+		return Manifest{}, fmt.Errorf("no backups recorded yet")
+	}
+	return manifests[len(manifests)-1], nil
+}
+
+// Restore puts every file of the snapshot back the way it was, deleting files it created
+func (s *Store) Restore(manifest Manifest) error {
+	for _, file := range manifest.Files {
+		if file.Created {
+			err := os.Remove(file.Path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(manifest.dir, file.Backup))
+		if err != nil {
+			return fmt.Errorf("reading backup of %s: %w", file.Path, err)
+		}
+		err = os.MkdirAll(filepath.Dir(file.Path), 0o755)
+		if err != nil {
+			return err
+		}
+		err = fsx.WriteFileAtomic(file.Path, data, 0o644)
+		if err != nil {
+			return fmt.Errorf("restoring %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// Snapshot collects the originals of the files one command is about to change
+type Snapshot struct {
+	store    *Store
+	manifest Manifest
+	saved    map[string]bool
+}
+
+// Begin starts a snapshot for command. Nothing is stored until a file is saved.
+func (s *Store) Begin(command string) *Snapshot {
+	return &Snapshot{
+		store:    s,
+		manifest: Manifest{Command: command, Time: s.now()},
+		saved:    make(map[string]bool),
+	}
+}
+
+// Save copies the file at path into the snapshot, unless it was saved already.
+// Call it before every write so only the original content is kept.
+func (sn *Snapshot) Save(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if sn.saved[path] {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		sn.manifest.Files = append(sn.manifest.Files, File{Path: path, Created: true})
+		sn.saved[path] = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if sn.manifest.dir == "" {
+		err = sn.createDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	backup := fmt.Sprintf("%d-%s", len(sn.manifest.Files), filepath.Base(path))
+	err = fsx.WriteFileAtomic(filepath.Join(sn.manifest.dir, backup), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+	sn.manifest.Files = append(sn.manifest.Files, File{Path: path, Backup: backup})
+	sn.saved[path] = true
+	return nil
+}
+
+// createDir makes the timestamped directory of the snapshot and picks its id
+func (sn *Snapshot) createDir() error {
+	manifests, err := sn.store.List()
+	if err != nil {
+		return err
+	}
+	sn.manifest.ID = 1
+	if len(manifests) > 0 {
+		sn.manifest.ID = manifests[len(manifests)-1].ID + 1
+	}
+
+	name := sn.manifest.Time.Format("20060102-150405")
+	if _, err := os.Stat(filepath.Join(sn.store.dir, name)); err == nil {
+		name += "-" + strconv.Itoa(sn.manifest.ID)
+	}
+	sn.manifest.dir = filepath.Join(sn.store.dir, name)
+	return os.MkdirAll(sn.manifest.dir, 0o755)
+}
+
+// Commit writes the manifest so the snapshot can be restored, then prunes old snapshots.
+// A snapshot without saved files is dropped.
+func (sn *Snapshot) Commit() error {
+	if len(sn.manifest.Files) == 0 {
+		return nil
+	}
+	if sn.manifest.dir == "" {
+		// Only new files were recorded, there is nothing to copy but the manifest
+		err := sn.createDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := sn.saveAfter()
+	if err != nil {
+		return err
+	}
+	err = writeManifest(sn.manifest)
+	if err != nil {
+		return err
+	}
+	return sn.store.prune()
+}
+
+// saveAfter copies the content the command left in every saved file, so it can be redone
+func (sn *Snapshot) saveAfter() error {
+	for i, file := range sn.manifest.Files {
+		data, err := os.ReadFile(file.Path)
+		if os.IsNotExist(err) {
+			sn.manifest.Files[i].Removed = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		after := fmt.Sprintf("%d-after-%s", i, filepath.Base(file.Path))
+		err = fsx.WriteFileAtomic(filepath.Join(sn.manifest.dir, after), data, 0o644)
+		if err != nil {
+			return fmt.Errorf("backing up %s: %w", file.Path, err)
+		}
+		sn.manifest.Files[i].After = after
+	}
+	return nil
+}
+
+func writeManifest(manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsx.WriteFileAtomic(filepath.Join(manifest.dir, manifestName), data, 0o644)
+}
+
+func (s *Store) prune() error {
+	manifests, err := s.List()
+	if err != nil {
+		return err
+	}
+	for len(manifests) > MaxSnapshots {
+		err = os.RemoveAll(manifests[0].dir)
+		if err != nil {
+			return err
+		}
+		manifests = manifests[1:]
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestSnapshot_RestoreUndoesEdits(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(root, "backups"))
+	config := filepath.Join(root, "hosts", "laptop", "configuration.nix")
+	module := filepath.Join(root, "modules", "browsers", "firefox.nix")
+	writeFile(t, config, "original")
+
+	snapshot := store.Begin("install firefox")
+	for _, path := range []string{config, module, config} {
+		if err := snapshot.Save(path); err != nil {
+			t.Fatalf("Save(%s) error = %v", path, err)
+		}
+	}
+	writeFile(t, config, "edited")
+	writeFile(t, config, "edited twice")
+	writeFile(t, module, "new module")
+	if err := snapshot.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	last, err := store.Last()
+	if err != nil {
+		t.Fatalf("Last() error = %v", err)
+	}
+	if last.ID != 1 || last.Command != "install firefox" {
+		t.Errorf("Last() = id %d %q, want id 1 install firefox", last.ID, last.Command)
+	}
+	if len(last.Files) != 2 {
+		t.Fatalf("snapshot has %d files, want 2: %+v", len(last.Files), last.Files)
+	}
+
+	if err := store.Restore(last); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := readFile(t, config); got != "original" {
+		t.Errorf("restored config = %q, want original", got)
+	}
+	if _, err := os.Stat(module); !os.IsNotExist(err) {
+		t.Errorf("Restore() kept the created module")
+	}
+}
+
+func TestSnapshot_CommitWithoutFiles(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "backups"))
+	if err := store.Begin("install").Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	manifests, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(manifests) != 0 {
+		t.Errorf("List() returned %d snapshots, want 0", len(manifests))
+	}
+	if _, err := store.Last(); err == nil {
+		t.Error("Last() expected error without backups")
+	}
+}
+
+func TestStore_FindAndPrune(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(root, "backups"))
+	path := filepath.Join(root, "configuration.nix")
+	writeFile(t, path, "content")
+
+	for range MaxSnapshots + 2 {
+		snapshot := store.Begin("install")
+		if err := snapshot.Save(path); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if err := snapshot.Commit(); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+	}
+
+	manifests, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(manifests) != MaxSnapshots {
+		t.Fatalf("List() returned %d snapshots, want %d", len(manifests), MaxSnapshots)
+	}
+	if manifests[0].ID != 3 {
+		t.Errorf("oldest snapshot id = %d, want 3", manifests[0].ID)
+	}
+
+	if _, err := store.Find(MaxSnapshots + 2); err != nil {
+		t.Errorf("Find() error = %v", err)
+	}
+	if _, err := store.Find(1); err == nil {
+		t.Error("Find() returned a pruned snapshot")
+	}
+}
+
+func TestStore_UndoRedo(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(filepath.Join(root, "backups"))
+	config := filepath.Join(root, "configuration.nix")
+	module := filepath.Join(root, "firefox.nix")
+	writeFile(t, config, "original")
+
+	run := func(command string, write func()) {
+		snapshot := store.Begin(command)
+		for _, path := range []string{config, module} {
+			if err := snapshot.Save(path); err != nil {
+				t.Fatalf("Save(%s) error = %v", path, err)
+			}
+		}
+		write()
+		if err := snapshot.Commit(); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+	}
+	run("install firefox", func() {
+		writeFile(t, config, "firefox enabled")
+		writeFile(t, module, "module")
+	})
+	run("disable firefox", func() { writeFile(t, config, "firefox disabled") })
+
+	if _, err := store.NextRedo(); err == nil {
+		t.Error("NextRedo() expected error before any undo")
+	}
+
+	// Undo both commands, newest first
+	for _, want := range []string{"firefox enabled", "original"} {
+		manifest, err := store.NextUndo()
+		if err != nil {
+			t.Fatalf("NextUndo() error = %v", err)
+		}
+		if err := store.Undo(manifest, false); err != nil {
+			t.Fatalf("Undo(%s) error = %v", manifest.Command, err)
+		}
+		if got := readFile(t, config); got != want {
+			t.Errorf("config after undoing %s = %q, want %q", manifest.Command, got, want)
+		}
+	}
+	if _, err := os.Stat(module); !os.IsNotExist(err) {
+		t.Error("undoing the install kept the module")
+	}
+	if _, err := store.NextUndo(); err == nil {
+		t.Error("NextUndo() expected error with everything undone")
+	}
+
+	// Redo replays them oldest first
+	manifest, err := store.NextRedo()
+	if err != nil || manifest.Command != "install firefox" {
+		t.Fatalf("NextRedo() = %q, %v, want install firefox", manifest.Command, err)
+	}
+	if err := store.Redo(manifest, false); err != nil {
+		t.Fatalf("Redo() error = %v", err)
+	}
+	if got := readFile(t, config); got != "firefox enabled" {
+		t.Errorf("config after redo = %q, want firefox enabled", got)
+	}
+	if got := readFile(t, module); got != "module" {
+		t.Errorf("module after redo = %q, want module", got)
+	}
+
+	// An edit since the redo blocks the next undo unless forced
+	writeFile(t, config, "edited by hand")
+	manifest, err = store.NextUndo()
+	if err != nil {
+		t.Fatalf("NextUndo() error = %v", err)
+	}
+	if err := store.Undo(manifest, false); err == nil {
+		t.Error("Undo() expected error for a file edited since")
+	}
+	if err := store.Undo(manifest, true); err != nil {
+		t.Errorf("forced Undo() error = %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/fsx"
+)
+
+// NextUndo returns the newest snapshot whose command hasn't been undone
+func (s *Store) NextUndo() (Manifest, error) {
+	manifests, err := s.List()
+	if err != nil {
+		return Manifest{}, err
+	}
+	for i := len(manifests) - 1; i >= 0; i-- {
+		if !manifests[i].Undone {
+			return manifests[i], nil
+		}
+	}
+	return Manifest{}, fmt.Errorf("nothing to undo")
+}
+
+// NextRedo returns the snapshot undone last. Commands run after an undo end the redo
+// chain, like typing after undo in an editor.
+func (s *Store) NextRedo() (Manifest, error) {
+	manifests, err := s.List()
+	if err != nil {
+		return Manifest{}, err
+	}
+	next := -1
+	for i := len(manifests) - 1; i >= 0 && manifests[i].Undone; i-- {
+		next = i
+	}
+	if next < 0 {
+		return Manifest{}, fmt.Errorf("nothing to redo")
+	}
+	return manifests[next], nil
+}
+
+// Undo restores the files of the snapshot to before its command and marks it undone.
+// Unless force is set, it refuses when a file changed since the command wrote it.
+func (s *Store) Undo(manifest Manifest, force bool) error {
+	if !force {
+		if changed := manifest.changedSince(true); len(changed) > 0 {
+			return fmt.Errorf("changed since %s: %s", manifest.Command, strings.Join(changed, ", "))
+		}
+	}
+	err := s.Restore(manifest)
+	if err != nil {
+		return err
+	}
+	manifest.Undone = true
+	return writeManifest(manifest)
+}
+
+// Redo writes the content the snapshot's command left back and clears its undone mark.
+// Unless force is set, it refuses when a file changed since it was undone.
+func (s *Store) Redo(manifest Manifest, force bool) error {
+	for _, file := range manifest.Files {
+		if file.After == "" && !file.Removed {
+			return fmt.Errorf("%s was recorded before pam kept the content commands leave, it can't be redone", manifest.Command)
+		}
+	}
+	if !force {
+		if changed := manifest.changedSince(false); len(changed) > 0 {
+			return fmt.Errorf("changed since %s was undone: %s", manifest.Command, strings.Join(changed, ", "))
+		}
+	}
+
+	for _, file := range manifest.Files {
+		if file.Removed {
+			err := os.Remove(file.Path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(manifest.dir, file.After))
+		if err != nil {
+			return fmt.Errorf("reading backup of %s: %w", file.Path, err)
+		}
+		err = os.MkdirAll(filepath.Dir(file.Path), 0o755)
+		if err != nil {
+			return err
+		}
+		err = fsx.WriteFileAtomic(file.Path, data, 0o644)
+		if err != nil {
+			return fmt.Errorf("restoring %s: %w", file.Path, err)
+		}
+	}
+	manifest.Undone = false
+	return writeManifest(manifest)
+}
+
+// changedSince lists the files no longer holding what the command left when after is set,
+// or what they held before it otherwise. Files without a recorded state are not checked.
+func (m Manifest) changedSince(after bool) []string {
+	var changed []string
+	for _, file := range m.Files {
+		name, absent := file.Backup, file.Created
+		if after {
+			name, absent = file.After, file.Removed
+		}
+		if name == "" && !absent {
+			continue
+		}
+		data, err := os.ReadFile(file.Path)
+		if absent {
+			if !os.IsNotExist(err) {
+				changed = append(changed, file.Path)
+			}
+			continue
+		}
+		want, readErr := os.ReadFile(filepath.Join(m.dir, name))
+		if err != nil || readErr != nil || !bytes.Equal(data, want) {
+			changed = append(changed, file.Path)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,121 @@
+package categories
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is where a flake declares its categories, relative to the flake
+const File = ".pam/categories.yaml"
+
+// Category is a module category the flake allows
+type Category struct {
+	// Name is the folder below the module directory, e.g. browsers or cli/editors
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Hosts start out selected for installs into the category
+	Hosts []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	// ExcludeHosts aren't offered for installs into the category
+	ExcludeHosts []string `yaml:"exclude_hosts,omitempty" json:"exclude_hosts,omitempty"`
+}
+
+// Schema is the content of .pam/categories.yaml, the categories in the order they are offered
+type Schema struct {
+	Categories []Category `yaml:"categories"`
+}
+
+// Path returns where the schema of the flake at flakePath lives
+func Path(flakePath string) string {
+	return filepath.Join(flakePath, File)
+}
+
+// Load reads the schema of the flake at flakePath, nil when the flake has none
+func Load(flakePath string) (*Schema, error) {
+	file := Path(flakePath)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(file, data)
+}
+
+// Parse reads a schema, file names it in errors. Names must be set, unique and relative
+// folder paths using / separators.
+func Parse(file string, data []byte) (*Schema, error) {
+	var schema Schema
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	var seen []string
+	for i, category := range schema.Categories {
+		name := category.Name
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("%s: category %d has no name", file, i+1)
+		case path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, ".."):
+			return nil, fmt.Errorf("%s: %q is not a folder below the module directory, write it like cli/editors", file, name)
+		case slices.Contains(seen, name):
+			return nil, fmt.Errorf("%s: %s is declared twice", file, name)
+		}
+		seen = append(seen, name)
+	}
+	return &schema, nil
+}
+
+// Names returns the declared categories in order
+func (s *Schema) Names() []string {
+	names := make([]string, len(s.Categories))
+	for i, category := range s.Categories {
+		names[i] = category.Name
+	}
+	return names
+}
+
+// Find returns the declared category called name
+func (s *Schema) Find(name string) (Category, bool) {
+	for _, category := range s.Categories {
+		if category.Name == name {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// Declares reports whether folder is a declared category or one of their parents, e.g.
+// cli for cli/editors
+func (s *Schema) Declares(folder string) bool {
+	for _, category := range s.Categories {
+		if category.Name == folder || strings.HasPrefix(category.Name, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Drift compares the schema with the category folders found below the module directory.
+// Undeclared are folders the schema doesn't know, ad-hoc categories. Missing are declared
+// categories without a folder yet, which the first install into them creates.
+func (s *Schema) Drift(folders []string) (undeclared []string, missing []string) {
+	for _, folder := range folders {
+		if !s.Declares(folder) && !slices.ContainsFunc(undeclared, func(parent string) bool {
+			return strings.HasPrefix(folder, parent+"/")
+		}) {
+			undeclared = append(undeclared, folder)
+		}
+	}
+	for _, category := range s.Categories {
+		if !slices.Contains(folders, category.Name) {
+			missing = append(missing, category.Name)
+		}
+	}
+	return undeclared, missing
+}
@@ -0,0 +1,83 @@
+package categories
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const schemaYAML = `categories:
+  - name: browsers
+    description: Web browsers
+    hosts: [laptop, desktop]
+  - name: cli/editors
+    description: Terminal editors
+    exclude_hosts: [server]
+  - name: server
+`
+
+func TestLoad(t *testing.T) {
+	flake := t.TempDir()
+	schema, err := Load(flake)
+	if err != nil || schema != nil {
+		t.Fatalf("Load() without a schema = %v, %v, want nil", schema, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(flake, ".pam"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(Path(flake), []byte(schemaYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err = Load(flake)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := schema.Names(); !slices.Equal(got, []string{"browsers", "cli/editors", "server"}) {
+		t.Errorf("Names() = %v", got)
+	}
+	browsers, ok := schema.Find("browsers")
+	if !ok || browsers.Description != "Web browsers" || !slices.Equal(browsers.Hosts, []string{"laptop", "desktop"}) {
+		t.Errorf("Find(browsers) = %+v, %v", browsers, ok)
+	}
+	if editors, _ := schema.Find("cli/editors"); !slices.Equal(editors.ExcludeHosts, []string{"server"}) {
+		t.Errorf("Find(cli/editors) = %+v", editors)
+	}
+	if _, ok := schema.Find("cli"); ok {
+		t.Error("Find(cli) found a parent that isn't declared itself")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"no name":   "categories:\n  - description: x\n",
+		"absolute":  "categories:\n  - name: /etc\n",
+		"outside":   "categories:\n  - name: ../apps\n",
+		"unclean":   "categories:\n  - name: cli//editors\n",
+		"duplicate": "categories:\n  - name: cli\n  - name: cli\n",
+		"not yaml":  "categories: [",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse(File, []byte(content)); err == nil {
+				t.Errorf("Parse(%q) should fail", content)
+			}
+		})
+	}
+}
+
+func TestSchema_Drift(t *testing.T) {
+	schema, err := Parse(File, []byte(schemaYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders := []string{"browsers", "cli", "cli/editors", "games", "games/steam", "misc"}
+	undeclared, missing := schema.Drift(folders)
+	if !slices.Equal(undeclared, []string{"games", "misc"}) {
+		t.Errorf("Drift() undeclared = %v, want games and misc", undeclared)
+	}
+	if !slices.Equal(missing, []string{"server"}) {
+		t.Errorf("Drift() missing = %v, want server", missing)
+	}
+}
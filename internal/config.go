@@ -2,19 +2,359 @@ package internal
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+
+	"pam/internal/categories"
+	"pam/internal/config/migrate"
+	"pam/internal/fsx"
+	"pam/internal/nixconfig"
+	"pam/internal/platform"
+	"pam/internal/search"
 
 	"github.com/charmbracelet/huh"
 	"gopkg.in/yaml.v3"
 )
 
+// Layouts decide how pam adds packages to the flake
+const (
+	// LayoutModules generates an mkApp module per package and enables it in the hosts' apps sections
+	LayoutModules = "modules"
+	// LayoutPlain lists packages in the hosts' environment.systemPackages or home.packages
+	LayoutPlain = "plain"
+)
+
+// FlakeSettingsFile holds settings shared by everyone using the flake, at its root
+const FlakeSettingsFile = ".pam.yaml"
+
+// DefaultProfile names the top-level settings wherever a profile is chosen
+const DefaultProfile = "default"
+
+// DefaultNixTimeout bounds nix searches and evaluations when nix_timeout isn't set
+const DefaultNixTimeout = 10 * time.Minute
+
 type Config struct {
+	// Version is the layout of the file, older files are migrated on load
+	Version          int    `yaml:"version"`
 	FlakePath        string `yaml:"flake_path"`
 	DefaultSystem    string `yaml:"default_system"`
 	DefaultModuleDir string `yaml:"default_module_dir"`
 	DefaultHostDir   string `yaml:"default_host_dir"`
+	NixpkgsRef       string `yaml:"nixpkgs_ref"`
+	ShowDiff         bool   `yaml:"show_diff"`
+	OpenAfterInstall string `yaml:"open_after_install,omitempty"`
+	Editor           string `yaml:"editor,omitempty"`
+	// Formatter formats the nix files pam writes: auto, off, or a command line the files
+	// are appended to
+	Formatter     string `yaml:"formatter,omitempty"`
+	GitAutoCommit bool   `yaml:"git_auto_commit"`
+	// Layout is how installs are written, LayoutModules when empty
+	Layout string `yaml:"layout,omitempty"`
+	// OptionNamespace is the attribute path generated modules declare their options under
+	// and hosts enable them in, e.g. myflake.apps. apps when empty.
+	OptionNamespace string `yaml:"option_namespace,omitempty"`
+	// NixTimeout bounds every nix search and evaluation, e.g. 2m, "0" disables it
+	NixTimeout string `yaml:"nix_timeout,omitempty"`
+	// PopularityFile is a JSON object of install counts by attribute path or pname, ranking
+	// the more popular of equally good search results first
+	PopularityFile string `yaml:"popularity_file,omitempty"`
+	// Sources are extra flakes searched next to nixpkgs, such as NUR
+	Sources []search.Source `yaml:"sources,omitempty"`
+	// NixpkgsRevisions are nixpkgs commits name@version installs look through before nixhub
+	NixpkgsRevisions []string `yaml:"nixpkgs_revisions,omitempty"`
+	// Hosts hold per-host settings, overriding those of the flake's .pam.yaml
+	Hosts map[string]HostSettings `yaml:"hosts,omitempty"`
+	// Categories choose the hosts of installs per module category, e.g. server or cli/editors
+	Categories map[string]CategorySettings `yaml:"categories,omitempty"`
+	// HostGroups name sets of hosts, used as --host @<group> and offered in host prompts
+	HostGroups map[string][]string `yaml:"host_groups,omitempty"`
+	// Hooks are shell commands run around installs, next to the flake's .pam/hooks
+	Hooks HookSettings `yaml:"hooks,omitempty"`
+	// Plugins name the pam-<name> executables providing templates and install actions
+	Plugins PluginSettings `yaml:"plugins,omitempty"`
+	// FlakeHosts are the per-host settings read from the flake's .pam.yaml
+	FlakeHosts map[string]HostSettings `yaml:"-"`
+	// CategorySchema holds the categories declared in the flake's .pam/categories.yaml,
+	// nil when it has none
+	CategorySchema *categories.Schema `yaml:"-"`
+	// Profiles hold settings for other flakes, each overriding the keys it sets
+	Profiles map[string]yaml.Node `yaml:"profiles,omitempty"`
+	// CurrentProfile is the profile used when --profile isn't given, empty for the top-level settings
+	CurrentProfile string `yaml:"current_profile,omitempty"`
+	// Workspaces group profiles whose flakes are installed into together, e.g. a NixOS
+	// flake and a home-manager flake. DefaultProfile stands for the top-level settings.
+	Workspaces map[string][]string `yaml:"workspaces,omitempty"`
+	// Profile is the profile these settings were loaded from
+	Profile string `yaml:"-"`
+}
+
+// HostSettings are the settings of one host of the flake
+type HostSettings struct {
+	// Rebuild is the command switching the host: nixos, darwin, home-manager, or a
+	// command line where {flake} and {host} are replaced
+	Rebuild string `yaml:"rebuild,omitempty"`
+	// SSHTarget is where pam deploy switches the host, e.g. root@server or admin@10.0.0.2
+	SSHTarget string `yaml:"ssh_target,omitempty"`
+	// AppsFile is the file, relative to the host's directory, where the host enables apps
+	AppsFile string `yaml:"apps_file,omitempty"`
+}
+
+// CategorySettings are the hosts of installs into one module category
+type CategorySettings struct {
+	// Hosts start out selected
+	Hosts []string `yaml:"hosts,omitempty"`
+	// ExcludeHosts aren't offered at all
+	ExcludeHosts []string `yaml:"exclude_hosts,omitempty"`
+}
+
+// HookSettings are the commands run at each point of an install
+type HookSettings struct {
+	PreInstall  []string `yaml:"pre_install,omitempty"`
+	PostInstall []string `yaml:"post_install,omitempty"`
+}
+
+// PluginSettings name the plugins run for templates and around installs, plugin sources
+// are configured under sources
+type PluginSettings struct {
+	// Templates are asked for module templates next to those of the template directories
+	Templates   []string `yaml:"templates,omitempty"`
+	PreInstall  []string `yaml:"pre_install,omitempty"`
+	PostInstall []string `yaml:"post_install,omitempty"`
+}
+
+// flakeSettings is the content of the flake's .pam.yaml
+type flakeSettings struct {
+	Hosts map[string]HostSettings `yaml:"hosts"`
+}
+
+// Host returns the settings of host, every one set in the config file overriding the
+// flake's .pam.yaml
+func (c *Config) Host(name string) HostSettings {
+	settings := c.FlakeHosts[name]
+	own := c.Hosts[name]
+	if own.Rebuild != "" {
+		settings.Rebuild = own.Rebuild
+	}
+	if own.SSHTarget != "" {
+		settings.SSHTarget = own.SSHTarget
+	}
+	if own.AppsFile != "" {
+		settings.AppsFile = own.AppsFile
+	}
+	return settings
+}
+
+// Category returns the settings of a module category such as cli/editors, or those of
+// its closest configured parent. The config file wins over the hosts the flake's
+// .pam/categories.yaml declares for the same category.
+func (c *Config) Category(name string) CategorySettings {
+	for name != "" && name != "." && name != string(filepath.Separator) {
+		if settings, ok := c.Categories[name]; ok {
+			return settings
+		}
+		if c.CategorySchema != nil {
+			declared, ok := c.CategorySchema.Find(filepath.ToSlash(name))
+			if ok && (len(declared.Hosts) > 0 || len(declared.ExcludeHosts) > 0) {
+				return CategorySettings{Hosts: declared.Hosts, ExcludeHosts: declared.ExcludeHosts}
+			}
+		}
+		name = filepath.Dir(name)
+	}
+	return CategorySettings{}
+}
+
+// CategoryHosts returns the hosts offered for installs into category, leaving out the
+// ones it excludes, and those of them selected first
+func (c *Config) CategoryHosts(category string, hosts []string) (offered []string, selected []string) {
+	settings := c.Category(category)
+	for _, host := range hosts {
+		if slices.Contains(settings.ExcludeHosts, host) {
+			continue
+		}
+		offered = append(offered, host)
+		if slices.Contains(settings.Hosts, host) {
+			selected = append(selected, host)
+		}
+	}
+	return offered, selected
+}
+
+// AllHosts is the host group every host belongs to, --host @all
+const AllHosts = "all"
+
+// HostGroupsOf returns the host groups with their members among hosts, and AllHosts
+// holding every one of them. Groups without any of the hosts are kept empty.
+func (c *Config) HostGroupsOf(hosts []string) map[string][]string {
+	groups := map[string][]string{AllHosts: slices.Clone(hosts)}
+	for name, members := range c.HostGroups {
+		var present []string
+		for _, member := range members {
+			if slices.Contains(hosts, member) && !slices.Contains(present, member) {
+				present = append(present, member)
+			}
+		}
+		groups[name] = present
+	}
+	return groups
+}
+
+// ExpandHosts replaces every @<group> in names with the members of the group, leaving
+// host names as they are and dropping repeated hosts
+func ExpandHosts(names []string, groups map[string][]string) ([]string, error) {
+	var expanded []string
+	for _, name := range names {
+		members := []string{name}
+		if group, ok := strings.CutPrefix(name, "@"); ok {
+			found, ok := groups[group]
+			if !ok {
+				available := slices.Sorted(maps.Keys(groups))
+				return nil, fmt.Errorf("unknown host group %s, available groups: @%s", name, strings.Join(available, ", @"))
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("host group %s has none of the flake's hosts", name)
+			}
+			members = found
+		}
+		for _, member := range members {
+			if !slices.Contains(expanded, member) {
+				expanded = append(expanded, member)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// AppsFiles returns the apps file of every host that sets one, keyed by host
+func (c *Config) AppsFiles() map[string]string {
+	files := map[string]string{}
+	for name := range maps.Keys(c.FlakeHosts) {
+		if settings := c.Host(name); settings.AppsFile != "" {
+			files[name] = settings.AppsFile
+		}
+	}
+	for name := range maps.Keys(c.Hosts) {
+		if settings := c.Host(name); settings.AppsFile != "" {
+			files[name] = settings.AppsFile
+		}
+	}
+	return files
+}
+
+// ConfigParseError is returned when the config file or the flake's .pam.yaml isn't valid
+// YAML or holds a value of the wrong type
+type ConfigParseError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigParseError) Error() string {
+	return fmt.Sprintf("reading %s: %v", e.Path, e.Err)
+}
+
+func (e *ConfigParseError) Unwrap() error {
+	return e.Err
+}
+
+// LoadFlakeSettings reads the flake's .pam.yaml into FlakeHosts and its
+// .pam/categories.yaml into CategorySchema, missing files are fine
+func (c *Config) LoadFlakeSettings() error {
+	schema, err := categories.Load(c.FlakePath)
+	if err != nil {
+		return err
+	}
+	c.CategorySchema = schema
+
+	path := filepath.Join(c.FlakePath, FlakeSettingsFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var settings flakeSettings
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		return &ConfigParseError{Path: path, Err: err}
+	}
+	c.FlakeHosts = settings.Hosts
+	return nil
+}
+
+// ProfileNames returns the configured profiles in alphabetical order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WorkspaceNames returns the configured workspaces in alphabetical order
+func (c *Config) WorkspaceNames() []string {
+	names := slices.Collect(maps.Keys(c.Workspaces))
+	sort.Strings(names)
+	return names
+}
+
+// Workspace returns the profiles of the named workspace as written, checking that each
+// one exists
+func (c *Config) Workspace(name string) ([]string, error) {
+	members, ok := c.Workspaces[name]
+	if !ok {
+		if len(c.Workspaces) == 0 {
+			return nil, fmt.Errorf("unknown workspace '%s', add workspaces to ~/.config/pam/config.yaml", name)
+		}
+		return nil, fmt.Errorf("unknown workspace '%s', available workspaces: %s", name, strings.Join(c.WorkspaceNames(), ", "))
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("workspace '%s' has no profiles", name)
+	}
+	for _, member := range members {
+		if member == DefaultProfile {
+			continue
+		}
+		if _, ok := c.Profiles[member]; !ok {
+			return nil, fmt.Errorf("workspace '%s' lists unknown profile '%s', available profiles: %s", name, member, strings.Join(c.ProfileNames(), ", "))
+		}
+	}
+	return members, nil
+}
+
+// WithProfile returns the settings of the named profile: the top-level settings with
+// every key the profile sets replaced. An empty name returns the top-level settings.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	node, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile '%s', available profiles: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	profile := *c
+	// Decoding fills maps in place, so keep the top-level hosts apart from the profile's
+	profile.Hosts = maps.Clone(c.Hosts)
+	profile.Categories = maps.Clone(c.Categories)
+	profile.HostGroups = maps.Clone(c.HostGroups)
+	err := node.Decode(&profile)
+	if err != nil {
+		return nil, &ConfigParseError{Path: getConfigPath(), Err: fmt.Errorf("profile '%s': %w", name, err)}
+	}
+	// Profiles don't nest, and the file keeps the profile and workspace lists
+	profile.Profiles = c.Profiles
+	profile.Workspaces = c.Workspaces
+	profile.CurrentProfile = c.CurrentProfile
+	profile.Profile = name
+	return &profile, nil
 }
 
 func (c *Config) Validate() error {
@@ -24,9 +364,51 @@ func (c *Config) Validate() error {
 	if _, err := os.Stat(c.FlakePath); os.IsNotExist(err) {
 		return fmt.Errorf("flake_path '%s' does not exist", c.FlakePath)
 	}
+	if c.Layout != "" && c.Layout != LayoutModules && c.Layout != LayoutPlain {
+		return fmt.Errorf("unknown layout '%s', use %s or %s", c.Layout, LayoutModules, LayoutPlain)
+	}
+	if c.OptionNamespace != "" && !namespacePattern.MatchString(c.OptionNamespace) {
+		return fmt.Errorf("invalid option_namespace '%s', use an attribute path such as myflake.apps", c.OptionNamespace)
+	}
+	if _, ok := c.HostGroups[AllHosts]; ok {
+		return fmt.Errorf("host group '%s' is built in and holds every host, use another name", AllHosts)
+	}
+	if c.NixTimeout != "" {
+		if _, err := time.ParseDuration(c.NixTimeout); err != nil {
+			return fmt.Errorf("invalid nix_timeout '%s', use a duration such as 30s or 5m", c.NixTimeout)
+		}
+	}
 	return nil
 }
 
+// Timeout returns how long a nix search or evaluation may run, 0 for no limit
+func (c *Config) Timeout() time.Duration {
+	if c.NixTimeout == "" {
+		return DefaultNixTimeout
+	}
+	timeout, err := time.ParseDuration(c.NixTimeout)
+	if err != nil {
+		return DefaultNixTimeout
+	}
+	return timeout
+}
+
+// namespacePattern matches an attribute path of plain names, e.g. myflake.apps
+var namespacePattern = regexp.MustCompile(`^[A-Za-z_][\w'-]*(\.[A-Za-z_][\w'-]*)*$`)
+
+// Namespace returns the attribute path hosts enable generated modules under
+func (c *Config) Namespace() string {
+	if c.OptionNamespace == "" {
+		return nixconfig.DefaultNamespace
+	}
+	return c.OptionNamespace
+}
+
+// Plain reports whether installs edit package lists instead of generating modules
+func (c *Config) Plain() bool {
+	return c.Layout == LayoutPlain
+}
+
 func (c *Config) Save() error {
 	path := getConfigPath()
 	yaml, err := yaml.Marshal(c)
@@ -40,7 +422,7 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	err = os.WriteFile(path, []byte(yaml), 0o644)
+	err = fsx.WriteFileAtomic(path, []byte(yaml), 0o644)
 	if err != nil {
 		return err
 	}
@@ -48,7 +430,8 @@ func (c *Config) Save() error {
 }
 
 func interactiveSetup(cfg *Config) error {
-	fmt.Println("\n🔧 Welcome to pam setup! Let's configure your flake path.")
+	// Stdout is kept for the output of the command that triggered the setup
+	fmt.Fprintln(os.Stderr, "\n🔧 Welcome to pam setup! Let's configure your flake path.")
 
 	var flakePath string
 	var system string
@@ -79,14 +462,23 @@ func interactiveSetup(cfg *Config) error {
 
 func Default() *Config {
 	return &Config{
+		Version:          migrate.Current,
 		FlakePath:        "",
 		DefaultSystem:    "",
 		DefaultModuleDir: "modules/apps",
 		DefaultHostDir:   "hosts",
+		NixpkgsRef:       "nixpkgs",
 	}
 }
 
-func expandPath(path string) string {
+// ExpandPath replaces a leading ~ with the home directory. Inside WSL a path copied from
+// Windows, such as \\wsl$\Ubuntu\home\me\nixos or C:\nixos, becomes the path WSL sees.
+func ExpandPath(path string) string {
+	if platform.InWSL() {
+		if translated, ok := platform.WSLPath(path); ok {
+			return translated
+		}
+	}
 	if !strings.HasPrefix(path, "~") {
 		return path
 	}
@@ -129,49 +521,347 @@ func getOrCreateConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	configYaml, err = migrateFile(path, configYaml)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from the defaults so keys missing from older config files keep sensible values
+	config := Default()
+	err = yaml.Unmarshal(configYaml, config)
+	if err != nil {
+		return nil, &ConfigParseError{Path: path, Err: err}
+	}
+	return config, nil
+}
+
+// migrateFile upgrades the config file at path to the current layout, keeping the
+// previous content next to it as config.yaml.v<version>.bak
+func migrateFile(path string, data []byte) ([]byte, error) {
+	migrated, version, applied, err := migrate.Migrate(data)
+	if err != nil {
+		return nil, &ConfigParseError{Path: path, Err: err}
+	}
+	if len(applied) == 0 {
+		return data, nil
+	}
 
-	var config Config
-	err = yaml.Unmarshal(configYaml, &config)
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+	err = fsx.WriteFileAtomic(backupPath, data, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("backing up %s before migrating it: %w", path, err)
+	}
+	err = fsx.WriteFileAtomic(path, migrated, 0o644)
 	if err != nil {
 		return nil, err
 	}
-	return &config, nil
+	slog.Info(fmt.Sprintf("Migrated %s to version %d (%s), the previous file is %s", path, migrate.Current, strings.Join(applied, ", "), backupPath))
+	return migrated, nil
+}
+
+// ReadConfigFile returns the config as written in the file, without applying a profile
+func ReadConfigFile() (*Config, error) {
+	return getOrCreateConfig(getConfigPath())
 }
 
-func LoadConfig() (*Config, error) {
-	configPath := getConfigPath()
+// Override sets one config key for a single invocation, over the config file
+type Override struct {
+	// Source names where the value comes from, e.g. PAM_FLAKE_PATH or --flake-path
+	Source string
+	// Key is the config key set, e.g. flake_path
+	Key   string
+	Value string
+}
 
-	config, err := getOrCreateConfig(configPath)
+// EnvVars are the environment variables overriding config keys, by variable
+var EnvVars = map[string]string{
+	"PAM_FLAKE_PATH":         "flake_path",
+	"PAM_SYSTEM":             "default_system",
+	"PAM_MODULE_DIR":         "default_module_dir",
+	"PAM_HOST_DIR":           "default_host_dir",
+	"PAM_NIXPKGS_REF":        "nixpkgs_ref",
+	"PAM_SHOW_DIFF":          "show_diff",
+	"PAM_OPEN_AFTER_INSTALL": "open_after_install",
+	"PAM_EDITOR":             "editor",
+	"PAM_FORMATTER":          "formatter",
+	"PAM_GIT_AUTO_COMMIT":    "git_auto_commit",
+	"PAM_LAYOUT":             "layout",
+	"PAM_OPTION_NAMESPACE":   "option_namespace",
+	"PAM_NIX_TIMEOUT":        "nix_timeout",
+	"PAM_POPULARITY_FILE":    "popularity_file",
+}
+
+// EnvOverrides returns the overrides set in the environment, looked up with lookupEnv,
+// in alphabetical order of the variables
+func EnvOverrides(lookupEnv func(string) (string, bool)) []Override {
+	names := slices.Sorted(maps.Keys(EnvVars))
+	var overrides []Override
+	for _, name := range names {
+		if value, ok := lookupEnv(name); ok {
+			overrides = append(overrides, Override{Source: name, Key: EnvVars[name], Value: value})
+		}
+	}
+	return overrides
+}
+
+// Apply sets the keys of overrides in order, so a later override of a key wins
+func (c *Config) Apply(overrides []Override) error {
+	for _, override := range overrides {
+		// An untagged node is read like a value in the file, so "true" sets a bool
+		node := yaml.Node{
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: override.Key},
+				{Kind: yaml.ScalarNode, Value: override.Value},
+			},
+		}
+		err := node.Decode(c)
+		if err != nil {
+			// yaml's error points at line 0 of a file that doesn't exist
+			return fmt.Errorf("invalid %s '%s', it doesn't fit %s", override.Source, override.Value, override.Key)
+		}
+	}
+	return nil
+}
+
+// Options choose the settings of one invocation
+type Options struct {
+	// Profile is the profile used, the current profile of the file when empty and the
+	// top-level settings when DefaultProfile
+	Profile string
+	// Overrides are applied over the file and the profile, see Apply
+	Overrides []Override
+	// NoSetup fails instead of asking for the flake when none is configured
+	NoSetup bool
+}
+
+// Load resolves the settings of one invocation, every layer overriding the keys it
+// sets: the defaults, the config file, the profile, then options.Overrides
+func Load(options Options) (*Config, error) {
+	if _, err := os.Stat(getConfigPath()); os.IsNotExist(err) && options.NoSetup {
+		return nil, fmt.Errorf("no config file, run pam init")
+	}
+	file, err := ReadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	name := options.Profile
+	if name == "" {
+		name = file.CurrentProfile
+	}
+	if name == DefaultProfile {
+		name = ""
+	}
+	config, err := file.Resolve(name, options.Overrides)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.FlakePath == "" && config.Profile != "" {
+		return nil, fmt.Errorf("profile '%s' has no flake_path", config.Profile)
+	}
+	if config.FlakePath == "" && options.NoSetup {
+		return nil, fmt.Errorf("no flake_path configured, run pam init")
+	}
 	if config.FlakePath == "" {
-		err = interactiveSetup(config)
+		// Set up the file itself so the overrides stay out of it
+		err = interactiveSetup(file)
 		if err != nil {
 			return nil, err
 		}
-		err = config.Save()
+		err = file.Save()
 		if err != nil {
 			return nil, fmt.Errorf("failed to save config: %w",
 				err)
 		}
+		config, err = file.Resolve(name, options.Overrides)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	config.FlakePath = expandPath(config.FlakePath)
+	config.FlakePath = ExpandPath(config.FlakePath)
+	if !filepath.IsAbs(config.FlakePath) {
+		// A relative path such as --flake . is taken from the working directory
+		config.FlakePath, err = filepath.Abs(config.FlakePath)
+		if err != nil {
+			return nil, err
+		}
+	}
 	err = config.Validate()
 	if err != nil {
 		return nil, err
 	}
+	err = config.LoadFlakeSettings()
+	if err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
 
+// Resolve returns the settings of the named profile with overrides applied, leaving c
+// as it is
+func (c *Config) Resolve(name string, overrides []Override) (*Config, error) {
+	config, err := c.WithProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *config
+	resolved.Hosts = maps.Clone(config.Hosts)
+	err = resolved.Apply(overrides)
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// Keys are the config keys pam config gets and sets, in the order of config.yaml.
+// Lists and maps such as hosts are changed with pam config edit.
+var Keys = []string{
+	"flake_path", "default_system", "default_module_dir", "default_host_dir", "nixpkgs_ref",
+	"show_diff", "open_after_install", "editor", "formatter", "git_auto_commit", "layout", "option_namespace",
+	"nix_timeout", "popularity_file",
+}
+
+func checkKey(key string) error {
+	if !slices.Contains(Keys, key) {
+		return fmt.Errorf("unknown key '%s', use one of %s", key, strings.Join(Keys, ", "))
+	}
+	return nil
+}
+
+// Get returns the value of key as config.yaml writes it, empty when it isn't set
+func (c *Config) Get(key string) (string, error) {
+	err := checkKey(key)
+	if err != nil {
+		return "", err
+	}
+	var node yaml.Node
+	err = node.Encode(c)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1].Value, nil
+		}
+	}
+	return "", nil
+}
+
+// Set changes key in the named profile, or in the top-level settings when profile is
+// empty. Nothing changes unless the resulting settings pass Check.
+func (c *Config) Set(profile string, key string, value string) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	changed := *c
+	if profile == "" {
+		err = changed.Apply([]Override{{Source: key, Key: key, Value: value}})
+		if err != nil {
+			return err
+		}
+	} else {
+		node, ok := c.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown profile '%s', available profiles: %s", profile, strings.Join(c.ProfileNames(), ", "))
+		}
+		node.Content = slices.Clone(node.Content)
+		setKey(&node, key, value)
+		changed.Profiles = maps.Clone(c.Profiles)
+		changed.Profiles[profile] = node
+	}
+
+	err = changed.Check(profile)
+	if err != nil {
+		return err
+	}
+	*c = changed
+	return nil
+}
+
+// setKey sets key in the mapping node, adding it at the end when it is missing
+func setKey(mapping *yaml.Node, key string, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value})
+}
+
+// Check validates the settings of the named profile the way Load uses them
+func (c *Config) Check(profile string) error {
+	config, err := c.Resolve(profile, nil)
+	if err != nil {
+		return err
+	}
+	config.FlakePath = ExpandPath(config.FlakePath)
+	return config.Validate()
+}
+
+// ConfigFile returns the path of config.yaml, or of the file given with --config
+func ConfigFile() string {
+	return getConfigPath()
+}
+
+// configFile is the config file given with --config, empty for the default
+var configFile string
+
+// SetConfigFile makes pam read and write the config at path instead of
+// ~/.config/pam/config.yaml, an empty path restores the default
+func SetConfigFile(path string) {
+	configFile = ExpandPath(path)
+}
+
 func getConfigPath() string {
-	homeDir, err := os.UserHomeDir()
+	if configFile != "" {
+		return configFile
+	}
+	configDir, err := ConfigDir()
 	if err != nil {
 		return fmt.Sprintf("Error getting home dir: %s", err)
 	}
-	configPath := filepath.Join(homeDir, ".config", "pam", "config.yaml")
+	configPath := filepath.Join(configDir, "config.yaml")
 	return configPath
 }
+
+// ConfigDir returns ~/.config/pam, the directory holding config.yaml and user templates
+func ConfigDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "pam"), nil
+}
+
+// StateDir returns the directory where pam keeps local state such as history,
+// following XDG_STATE_HOME and defaulting to ~/.local/state/pam
+func StateDir() (string, error) {
+	if stateHome := os.Getenv("XDG_STATE_HOME"); stateHome != "" {
+		return filepath.Join(stateHome, "pam"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".local", "state", "pam"), nil
+}
+
+// CacheDir returns the directory where pam keeps disposable data such as search results,
+// following XDG_CACHE_HOME and defaulting to ~/.cache/pam
+func CacheDir() (string, error) {
+	if cacheHome := os.Getenv("XDG_CACHE_HOME"); cacheHome != "" {
+		return filepath.Join(cacheHome, "pam"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".cache", "pam"), nil
+}
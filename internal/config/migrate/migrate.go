@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Current is the version of the config layout this pam reads and writes
+const Current = 1
+
+// Migration upgrades a config document from version From to From+1
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(config *yaml.Node) error
+}
+
+// Migrations upgrade older configs one version at a time, in order
+var Migrations = []Migration{
+	{From: 0, Description: "moved apps_files into the hosts settings", Apply: moveAppsFiles},
+}
+
+// Version returns the version the config mapping declares, 0 when it has none
+func Version(config *yaml.Node) (int, error) {
+	value := lookup(config, "version")
+	if value == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value.Value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version '%s'", value.Value)
+	}
+	return version, nil
+}
+
+// Migrate upgrades the config file content data to Current. It returns the upgraded
+// content, the version data had and the descriptions of the migrations applied, none
+// when data is current already.
+func Migrate(data []byte) ([]byte, int, []string, error) {
+	var document yaml.Node
+	err := yaml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		// An empty file holds nothing to upgrade
+		return data, Current, nil, nil
+	}
+	config := document.Content[0]
+
+	version, err := Version(config)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if version > Current {
+		return nil, version, nil, fmt.Errorf("the config has version %d, which needs a newer pam (this one reads up to %d)", version, Current)
+	}
+	if version == Current {
+		return data, version, nil, nil
+	}
+
+	var applied []string
+	for _, migration := range Migrations {
+		if migration.From < version {
+			continue
+		}
+		err = migration.Apply(config)
+		if err != nil {
+			return nil, version, nil, fmt.Errorf("migrating the config from version %d: %w", migration.From, err)
+		}
+		applied = append(applied, migration.Description)
+	}
+	setVersion(config, Current)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&document)
+	if err != nil {
+		return nil, version, nil, err
+	}
+	return out.Bytes(), version, applied, nil
+}
+
+// lookup returns the value of key in mapping, nil when it isn't set
+func lookup(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// remove deletes key from mapping
+func remove(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// child returns the mapping under key, adding an empty one at the end when it is missing
+func child(mapping *yaml.Node, key string) *yaml.Node {
+	if value := lookup(mapping, key); value != nil {
+		return value
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, scalar(key), value)
+	return value
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// setVersion records version as the first key of the config
+func setVersion(config *yaml.Node, version int) {
+	if value := lookup(config, "version"); value != nil {
+		value.Value = strconv.Itoa(version)
+		value.Tag = "!!int"
+		return
+	}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)}
+	config.Content = append([]*yaml.Node{scalar("version"), value}, config.Content...)
+}
+
+// moveAppsFiles turns `apps_files: {laptop: apps.nix}` into
+// `hosts: {laptop: {apps_file: apps.nix}}`, at the top level and in every profile
+func moveAppsFiles(config *yaml.Node) error {
+	mappings := []*yaml.Node{config}
+	if profiles := lookup(config, "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			if profiles.Content[i].Kind == yaml.MappingNode {
+				mappings = append(mappings, profiles.Content[i])
+			}
+		}
+	}
+
+	for _, mapping := range mappings {
+		appsFiles := lookup(mapping, "apps_files")
+		if appsFiles == nil {
+			continue
+		}
+		if appsFiles.Kind != yaml.MappingNode {
+			return fmt.Errorf("apps_files is not a mapping of hosts to files")
+		}
+		for i := 0; i+1 < len(appsFiles.Content); i += 2 {
+			host := child(child(mapping, "hosts"), appsFiles.Content[i].Value)
+			if lookup(host, "apps_file") == nil {
+				host.Content = append(host.Content, scalar("apps_file"), appsFiles.Content[i+1])
+			}
+		}
+		remove(mapping, "apps_files")
+	}
+	return nil
+}
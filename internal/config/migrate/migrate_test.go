@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		want        string
+		wantVersion int
+		wantApplied int
+		wantErr     bool
+	}{
+		{
+			name:        "apps files",
+			config:      "# my flake\nflake_path: ~/nixos\napps_files:\n  laptop: apps.nix\n  server: services.nix\nhosts:\n  server:\n    ssh_target: root@server\n",
+			want:        "version: 1\n# my flake\nflake_path: ~/nixos\nhosts:\n  server:\n    ssh_target: root@server\n    apps_file: services.nix\n  laptop:\n    apps_file: apps.nix\n",
+			wantApplied: 1,
+		},
+		{
+			name:        "apps files of a profile",
+			config:      "flake_path: ~/nixos\nprofiles:\n  work:\n    apps_files:\n      desktop: apps.nix\n",
+			want:        "version: 1\nflake_path: ~/nixos\nprofiles:\n  work:\n    hosts:\n      desktop:\n        apps_file: apps.nix\n",
+			wantApplied: 1,
+		},
+		{
+			name:        "nothing to move",
+			config:      "flake_path: ~/nixos\n",
+			want:        "version: 1\nflake_path: ~/nixos\n",
+			wantApplied: 1,
+		},
+		{
+			name:        "current",
+			config:      "version: 1\nflake_path: ~/nixos\n",
+			want:        "version: 1\nflake_path: ~/nixos\n",
+			wantVersion: 1,
+		},
+		{
+			name:        "empty",
+			config:      "",
+			want:        "",
+			wantVersion: Current,
+		},
+		{
+			name:        "newer",
+			config:      "version: 99\nflake_path: ~/nixos\n",
+			wantVersion: 99,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, version, applied, err := Migrate([]byte(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Migrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion || len(applied) != tt.wantApplied {
+				t.Errorf("Migrate() version = %d with %v applied, want %d with %d", version, applied, tt.wantVersion, tt.wantApplied)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Migrate() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrations_InOrder(t *testing.T) {
+	for i, migration := range Migrations {
+		if migration.From != i {
+			t.Errorf("migration %d upgrades from version %d, want %d", i, migration.From, i)
+		}
+	}
+	if len(Migrations) != Current {
+		t.Errorf("%d migrations lead to version %d, want %d", len(Migrations), len(Migrations), Current)
+	}
+	if slices.ContainsFunc(Migrations, func(m Migration) bool { return strings.TrimSpace(m.Description) == "" }) {
+		t.Error("every migration needs a description")
+	}
+}
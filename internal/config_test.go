@@ -0,0 +1,534 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"pam/internal/categories"
+
+	"gopkg.in/yaml.v3"
+)
+
+const profilesYAML = `
+flake_path: ~/nixos
+default_system: x86_64-linux
+show_diff: true
+profiles:
+  work:
+    flake_path: ~/work/flake
+    default_host_dir: machines
+  personal:
+    show_diff: false
+current_profile: work
+`
+
+func TestConfig_WithProfile(t *testing.T) {
+	config := Default()
+	if err := yaml.Unmarshal([]byte(profilesYAML), config); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		profile  string
+		wantPath string
+		wantHost string
+		wantDiff bool
+	}{
+		{name: "top-level settings", profile: "", wantPath: "~/nixos", wantHost: "hosts", wantDiff: true},
+		{name: "profile overrides keys it sets", profile: "work", wantPath: "~/work/flake", wantHost: "machines", wantDiff: true},
+		{name: "profile keeps other keys", profile: "personal", wantPath: "~/nixos", wantHost: "hosts", wantDiff: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.WithProfile(tt.profile)
+			if err != nil {
+				t.Fatalf("WithProfile() error = %v", err)
+			}
+			if got.FlakePath != tt.wantPath || got.DefaultHostDir != tt.wantHost || got.ShowDiff != tt.wantDiff {
+				t.Errorf("WithProfile(%q) = flake %q, hosts %q, show_diff %v", tt.profile, got.FlakePath, got.DefaultHostDir, got.ShowDiff)
+			}
+			if got.Profile != tt.profile || got.DefaultSystem != "x86_64-linux" {
+				t.Errorf("WithProfile(%q) profile = %q, system = %q", tt.profile, got.Profile, got.DefaultSystem)
+			}
+		})
+	}
+
+	if config.FlakePath != "~/nixos" {
+		t.Errorf("WithProfile() changed the top-level settings: %q", config.FlakePath)
+	}
+	if _, err := config.WithProfile("school"); err == nil || !strings.Contains(err.Error(), "personal, work") {
+		t.Errorf("WithProfile() unknown profile error = %v", err)
+	}
+}
+
+func TestConfig_SaveKeepsProfiles(t *testing.T) {
+	config := Default()
+	if err := yaml.Unmarshal([]byte(profilesYAML), config); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	config.CurrentProfile = "personal"
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	reloaded := Default()
+	if err := yaml.Unmarshal(data, reloaded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if reloaded.CurrentProfile != "personal" || len(reloaded.Profiles) != 2 {
+		t.Errorf("reloaded config = current %q, %d profiles:\n%s", reloaded.CurrentProfile, len(reloaded.Profiles), data)
+	}
+	work, err := reloaded.WithProfile("work")
+	if err != nil || work.FlakePath != "~/work/flake" {
+		t.Errorf("reloaded work profile = %+v, error = %v", work, err)
+	}
+}
+
+func TestConfig_ValidateLayout(t *testing.T) {
+	tests := []struct {
+		layout  string
+		wantErr bool
+	}{
+		{layout: ""},
+		{layout: LayoutModules},
+		{layout: LayoutPlain},
+		{layout: "flat", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			cfg := &Config{FlakePath: t.TempDir(), Layout: tt.layout}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Namespace(t *testing.T) {
+	tests := []struct {
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{namespace: "", want: "apps"},
+		{namespace: "myflake.apps", want: "myflake.apps"},
+		{namespace: "my-flake.apps", want: "my-flake.apps"},
+		{namespace: "myflake..apps", wantErr: true},
+		{namespace: "apps.", wantErr: true},
+		{namespace: "${name}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			cfg := &Config{FlakePath: t.TempDir(), OptionNamespace: tt.namespace}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.Namespace() != tt.want {
+				t.Errorf("Namespace() = %q, want %q", cfg.Namespace(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Timeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{timeout: "", want: DefaultNixTimeout},
+		{timeout: "90s", want: 90 * time.Second},
+		{timeout: "0", want: 0},
+		{timeout: "soon", want: DefaultNixTimeout, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timeout, func(t *testing.T) {
+			cfg := &Config{FlakePath: t.TempDir(), NixTimeout: tt.timeout}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := cfg.Timeout(); got != tt.want {
+				t.Errorf("Timeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Host(t *testing.T) {
+	flake := t.TempDir()
+	settings := "hosts:\n  macbook:\n    rebuild: darwin\n  server:\n    rebuild: deploy {flake}#{host}\n    ssh_target: root@server\n"
+	if err := os.WriteFile(filepath.Join(flake, FlakeSettingsFile), []byte(settings), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", FlakeSettingsFile, err)
+	}
+	cfg := &Config{FlakePath: flake, Hosts: map[string]HostSettings{"server": {Rebuild: "home-manager"}}}
+	if err := cfg.LoadFlakeSettings(); err != nil {
+		t.Fatalf("LoadFlakeSettings() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want HostSettings
+	}{
+		{host: "macbook", want: HostSettings{Rebuild: "darwin"}},
+		{host: "server", want: HostSettings{Rebuild: "home-manager", SSHTarget: "root@server"}},
+		{host: "laptop", want: HostSettings{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := cfg.Host(tt.host); got != tt.want {
+				t.Errorf("Host() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOrCreateConfig_Migrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	old := "flake_path: ~/nixos\napps_files:\n  laptop: apps.nix\n"
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := getOrCreateConfig(path)
+	if err != nil {
+		t.Fatalf("getOrCreateConfig() error = %v", err)
+	}
+	if cfg.Version != 1 || cfg.AppsFiles()["laptop"] != "apps.nix" {
+		t.Errorf("getOrCreateConfig() = version %d, apps files %v", cfg.Version, cfg.AppsFiles())
+	}
+	if backup, err := os.ReadFile(path + ".v0.bak"); err != nil || string(backup) != old {
+		t.Errorf("backup = %q, error = %v", backup, err)
+	}
+
+	// A migrated file is left alone the next time
+	migrated, _ := os.ReadFile(path)
+	if _, err := getOrCreateConfig(path); err != nil {
+		t.Fatalf("getOrCreateConfig() error = %v", err)
+	}
+	if again, _ := os.ReadFile(path); string(again) != string(migrated) {
+		t.Errorf("reloading changed the config:\n%s", again)
+	}
+
+	if err := os.WriteFile(path, []byte("version: 99\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := getOrCreateConfig(path); err == nil {
+		t.Error("getOrCreateConfig() accepted a config from a newer pam")
+	}
+}
+
+func TestGetOrCreateConfig_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("version: 1\nflake_path: [unclosed\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	_, err := getOrCreateConfig(path)
+	var parseErr *ConfigParseError
+	if !errors.As(err, &parseErr) || parseErr.Path != path {
+		t.Errorf("getOrCreateConfig() error = %v, want a ConfigParseError for %s", err, path)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	env := map[string]string{"PAM_HOST_DIR": "machines", "PAM_SHOW_DIFF": "true", "HOME": "/home/me"}
+	got := EnvOverrides(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	want := []Override{
+		{Source: "PAM_HOST_DIR", Key: "default_host_dir", Value: "machines"},
+		{Source: "PAM_SHOW_DIFF", Key: "show_diff", Value: "true"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("EnvOverrides() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("EnvOverrides()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides []Override
+		want      func(*Config) bool
+		wantErr   bool
+	}{
+		{
+			name:      "string",
+			overrides: []Override{{Source: "PAM_HOST_DIR", Key: "default_host_dir", Value: "machines"}},
+			want:      func(c *Config) bool { return c.DefaultHostDir == "machines" },
+		},
+		{
+			name:      "bool",
+			overrides: []Override{{Source: "PAM_GIT_AUTO_COMMIT", Key: "git_auto_commit", Value: "true"}},
+			want:      func(c *Config) bool { return c.GitAutoCommit },
+		},
+		{
+			name: "later wins",
+			overrides: []Override{
+				{Source: "PAM_FLAKE_PATH", Key: "flake_path", Value: "~/env"},
+				{Source: "--flake-path", Key: "flake_path", Value: "~/flag"},
+			},
+			want: func(c *Config) bool { return c.FlakePath == "~/flag" },
+		},
+		{
+			name:      "invalid bool",
+			overrides: []Override{{Source: "PAM_SHOW_DIFF", Key: "show_diff", Value: "maybe"}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			err := cfg.Apply(tt.overrides)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.overrides[0].Source) {
+					t.Errorf("Apply() error = %v, want it to name %s", err, tt.overrides[0].Source)
+				}
+				return
+			}
+			if !tt.want(cfg) || cfg.NixpkgsRef != "nixpkgs" {
+				t.Errorf("Apply() = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoad_Layers(t *testing.T) {
+	fileFlake, overrideFlake := t.TempDir(), t.TempDir()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "version: 1\nflake_path: " + fileFlake + "\ndefault_host_dir: machines\nshow_diff: true\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	SetConfigFile(path)
+	t.Cleanup(func() { SetConfigFile("") })
+
+	cfg, err := Load(Options{Overrides: []Override{
+		{Source: "PAM_SHOW_DIFF", Key: "show_diff", Value: "false"},
+		{Source: "--flake-path", Key: "flake_path", Value: overrideFlake},
+	}})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.FlakePath != overrideFlake || cfg.ShowDiff || cfg.DefaultHostDir != "machines" || cfg.NixpkgsRef != "nixpkgs" {
+		t.Errorf("Load() = flake %q, show_diff %v, hosts %q, nixpkgs %q", cfg.FlakePath, cfg.ShowDiff, cfg.DefaultHostDir, cfg.NixpkgsRef)
+	}
+
+	file, err := ReadConfigFile()
+	if err != nil {
+		t.Fatalf("ReadConfigFile() error = %v", err)
+	}
+	if file.FlakePath != fileFlake || !file.ShowDiff {
+		t.Errorf("Load() changed the file settings: flake %q, show_diff %v", file.FlakePath, file.ShowDiff)
+	}
+}
+
+func TestConfig_Set(t *testing.T) {
+	flake := t.TempDir()
+	profiles := "flake_path: " + flake + "\nprofiles:\n  work:\n    flake_path: " + flake + "\n"
+
+	tests := []struct {
+		name    string
+		profile string
+		key     string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "string", key: "default_host_dir", value: "machines", want: "machines"},
+		{name: "bool", key: "show_diff", value: "true", want: "true"},
+		{name: "profile", profile: "work", key: "layout", value: "plain", want: "plain"},
+		{name: "unknown key", key: "hosts", value: "laptop", wantErr: true},
+		{name: "missing flake", key: "flake_path", value: filepath.Join(flake, "missing"), wantErr: true},
+		{name: "invalid layout", key: "layout", value: "flat", wantErr: true},
+		{name: "invalid timeout", profile: "work", key: "nix_timeout", value: "soon", wantErr: true},
+		{name: "unknown profile", profile: "school", key: "layout", value: "plain", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			if err := yaml.Unmarshal([]byte(profiles), cfg); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			err := cfg.Set(tt.profile, tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// A rejected value leaves the settings alone
+				if err := cfg.Check(""); err != nil {
+					t.Errorf("Set() left invalid settings: %v", err)
+				}
+				return
+			}
+
+			settings, err := cfg.Resolve(tt.profile, nil)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got, _ := settings.Get(tt.key); got != tt.want {
+				t.Errorf("Get(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+			if top, _ := cfg.Get(tt.key); tt.profile != "" && top == tt.want {
+				t.Errorf("Set() in profile %s changed the top-level %s", tt.profile, tt.key)
+			}
+		})
+	}
+}
+
+func TestConfig_CategoryHosts(t *testing.T) {
+	cfg := &Config{Categories: map[string]CategorySettings{
+		"server":     {Hosts: []string{"nas", "vps"}},
+		"gui":        {ExcludeHosts: []string{"nas", "vps"}},
+		"gui/office": {Hosts: []string{"laptop"}},
+	}}
+	// The config wins over the flake's .pam/categories.yaml
+	cfg.CategorySchema = &categories.Schema{Categories: []categories.Category{
+		{Name: "server", Hosts: []string{"vps"}},
+		{Name: "games", ExcludeHosts: []string{"nas", "vps"}},
+		{Name: "cli"},
+	}}
+	hosts := []string{"desktop", "laptop", "nas", "vps"}
+
+	tests := []struct {
+		category     string
+		wantOffered  []string
+		wantSelected []string
+	}{
+		{category: "server", wantOffered: hosts, wantSelected: []string{"nas", "vps"}},
+		{category: "gui", wantOffered: []string{"desktop", "laptop"}},
+		{category: "gui/browsers", wantOffered: []string{"desktop", "laptop"}},
+		{category: "gui/office", wantOffered: hosts, wantSelected: []string{"laptop"}},
+		{category: "games/steam", wantOffered: []string{"desktop", "laptop"}},
+		{category: "cli", wantOffered: hosts},
+		{category: "", wantOffered: hosts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.category, func(t *testing.T) {
+			offered, selected := cfg.CategoryHosts(tt.category, hosts)
+			if !slices.Equal(offered, tt.wantOffered) || !slices.Equal(selected, tt.wantSelected) {
+				t.Errorf("CategoryHosts(%q) = %v, %v, want %v, %v", tt.category, offered, selected, tt.wantOffered, tt.wantSelected)
+			}
+		})
+	}
+}
+
+func TestExpandHosts(t *testing.T) {
+	cfg := &Config{HostGroups: map[string][]string{
+		"laptops": {"mbp", "thinkpad", "gone"},
+		"old":     {"gone"},
+	}}
+	groups := cfg.HostGroupsOf([]string{"mbp", "nas", "thinkpad"})
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "hosts", names: []string{"nas", "mbp"}, want: []string{"nas", "mbp"}},
+		{name: "group", names: []string{"@laptops"}, want: []string{"mbp", "thinkpad"}},
+		{name: "all", names: []string{"@all"}, want: []string{"mbp", "nas", "thinkpad"}},
+		{name: "repeated hosts", names: []string{"mbp", "@laptops", "@all"}, want: []string{"mbp", "thinkpad", "nas"}},
+		{name: "no hosts", names: nil, want: nil},
+		{name: "unknown group", names: []string{"@servers"}, wantErr: true},
+		{name: "group without hosts of the flake", names: []string{"@old"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandHosts(tt.names, groups)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandHosts(%v) error = %v, wantErr %v", tt.names, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ExpandHosts(%v) = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Workspace(t *testing.T) {
+	config := Default()
+	content := profilesYAML + "workspaces:\n  everything: [default, work]\n  broken: [default, school]\n  empty: []\n"
+	if err := yaml.Unmarshal([]byte(content), config); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	members, err := config.Workspace("everything")
+	if err != nil || !slices.Equal(members, []string{"default", "work"}) {
+		t.Errorf("Workspace(everything) = %v, %v", members, err)
+	}
+	if _, err := config.Workspace("broken"); err == nil || !strings.Contains(err.Error(), "school") {
+		t.Errorf("Workspace(broken) error = %v, want the unknown profile", err)
+	}
+	if _, err := config.Workspace("empty"); err == nil {
+		t.Errorf("Workspace(empty) error = nil, want one")
+	}
+	if _, err := config.Workspace("home"); err == nil || !strings.Contains(err.Error(), "broken, empty, everything") {
+		t.Errorf("Workspace(home) error = %v, want the available workspaces", err)
+	}
+
+	work, err := config.WithProfile("work")
+	if err != nil {
+		t.Fatalf("WithProfile() error = %v", err)
+	}
+	if len(work.Workspaces) != 3 {
+		t.Errorf("WithProfile() workspaces = %v, want the file's", work.Workspaces)
+	}
+}
+
+func TestLoad_DefaultProfile(t *testing.T) {
+	topFlake, workFlake := t.TempDir(), t.TempDir()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "version: 1\nflake_path: " + topFlake + "\nprofiles:\n  work:\n    flake_path: " + workFlake + "\ncurrent_profile: work\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	SetConfigFile(path)
+	t.Cleanup(func() { SetConfigFile("") })
+
+	cfg, err := Load(Options{})
+	if err != nil || cfg.FlakePath != workFlake {
+		t.Fatalf("Load() = %v, %v, want the current profile", cfg, err)
+	}
+	cfg, err = Load(Options{Profile: DefaultProfile})
+	if err != nil || cfg.FlakePath != topFlake || cfg.Profile != "" {
+		t.Errorf("Load(default) = %v, %v, want the top-level settings", cfg, err)
+	}
+}
+
+func TestLoad_NoSetup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	SetConfigFile(path)
+	t.Cleanup(func() { SetConfigFile("") })
+
+	if _, err := Load(Options{NoSetup: true}); err == nil {
+		t.Error("Load() without a flake_path should fail instead of asking for one")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Load() wrote the config file: %v", err)
+	}
+}
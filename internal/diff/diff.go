@@ -0,0 +1,185 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ContextLines is the number of unchanged lines shown around each change
+const ContextLines = 3
+
+// Change is the content of a file before and after an edit. Old is empty for a new file
+// and New is empty for a deleted one.
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+	// Positions of the line in the old and new file, counting from 0
+	oldPos int
+	newPos int
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes the edit script between two line slices from their longest common subsequence
+func diffLines(a, b []string) []op {
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{kind: opEqual, line: a[i], oldPos: i, newPos: j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// Deletions go first so a replaced line reads as - then +
+			ops = append(ops, op{kind: opDelete, line: a[i], oldPos: i, newPos: j})
+			i++
+		default:
+			ops = append(ops, op{kind: opInsert, line: b[j], oldPos: i, newPos: j})
+			j++
+		}
+	}
+	return ops
+}
+
+// hunkRange formats one side of a hunk header, where an empty range names the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// Unified renders the change as a unified diff, or "" when the content is the same
+func Unified(change Change) string {
+	if change.Old == change.New {
+		return ""
+	}
+
+	ops := diffLines(splitLines(change.Old), splitLines(change.New))
+
+	var out strings.Builder
+	oldName := "a/" + strings.TrimPrefix(change.Path, "/")
+	if change.Old == "" {
+		oldName = "/dev/null"
+	}
+	newName := "b/" + strings.TrimPrefix(change.Path, "/")
+	if change.New == "" {
+		newName = "/dev/null"
+	}
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(ops); {
+		// Find the next change and grow the hunk while changes are close enough to share context
+		first := start
+		for first < len(ops) && ops[first].kind == opEqual {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].kind != opEqual {
+				last = k
+			} else if k-last > 2*ContextLines {
+				break
+			}
+		}
+
+		from := max(first-ContextLines, start)
+		to := min(last+ContextLines+1, len(ops))
+
+		oldCount, newCount := 0, 0
+		for _, o := range ops[from:to] {
+			if o.kind != opInsert {
+				oldCount++
+			}
+			if o.kind != opDelete {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(ops[from].oldPos, oldCount), hunkRange(ops[from].newPos, newCount))
+
+		for _, o := range ops[from:to] {
+			switch o.kind {
+			case opEqual:
+				out.WriteString(" " + o.line + "\n")
+			case opDelete:
+				out.WriteString("-" + o.line + "\n")
+			case opInsert:
+				out.WriteString("+" + o.line + "\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+var (
+	headerStyle = lipgloss.NewStyle().Bold(true)
+	hunkStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	addStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	removeStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+// Colorize highlights a unified diff for the terminal. Colors are dropped when
+// the output is not a terminal.
+func Colorize(unified string) string {
+	lines := splitLines(unified)
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++"):
+			lines[i] = headerStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = hunkStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = addStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = removeStyle.Render(line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name   string
+		change Change
+		want   string
+	}{
+		{
+			name:   "no change",
+			change: Change{Path: "a.nix", Old: "x\n", New: "x\n"},
+			want:   "",
+		},
+		{
+			name:   "new file",
+			change: Change{Path: "modules/firefox.nix", New: "{\n}\n"},
+			want:   "--- /dev/null\n+++ b/modules/firefox.nix\n@@ -0,0 +1,2 @@\n+{\n+}\n",
+		},
+		{
+			name:   "deleted file",
+			change: Change{Path: "modules/firefox.nix", Old: "{\n}\n"},
+			want:   "--- a/modules/firefox.nix\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-{\n-}\n",
+		},
+		{
+			name: "line added in the middle",
+			change: Change{
+				Path: "configuration.nix",
+				Old:  "apps = {\n  browsers = {\n  };\n};\n",
+				New:  "apps = {\n  browsers = {\n    firefox.enable = true;\n  };\n};\n",
+			},
+			want: "--- a/configuration.nix\n+++ b/configuration.nix\n@@ -1,4 +1,5 @@\n apps = {\n   browsers = {\n+    firefox.enable = true;\n   };\n };\n",
+		},
+		{
+			name:   "line replaced",
+			change: Change{Path: "a.nix", Old: "x.enable = false;\n", New: "x.enable = true;\n"},
+			want:   "--- a/a.nix\n+++ b/a.nix\n@@ -1 +1 @@\n-x.enable = false;\n+x.enable = true;\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			change: Change{
+				Path: "a.nix",
+				Old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+				New:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			},
+			want: "--- a/a.nix\n+++ b/a.nix\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified(tt.change)
+			if got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorize_KeepsText(t *testing.T) {
+	unified := Unified(Change{Path: "a.nix", Old: "x\n", New: "y\n"})
+	got := Colorize(unified)
+	for _, line := range []string{"--- a/a.nix", "+++ b/a.nix", "-x", "+y"} {
+		if !strings.Contains(got, line) {
+			t.Errorf("Colorize() lost %q:\n%s", line, got)
+		}
+	}
+}
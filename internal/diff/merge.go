@@ -0,0 +1,58 @@
+package diff
+
+import "strings"
+
+// Conflict markers around the two sides of a region that differs, as git writes them
+const (
+	markerOurs   = "<<<<<<<"
+	markerSplit  = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+// Markers merges the old and new content of the change into one text, wrapping every
+// region that differs in git style conflict markers labelled oldLabel and newLabel.
+// Lines both sides share are kept once.
+func Markers(change Change, oldLabel string, newLabel string) string {
+	ops := diffLines(splitLines(change.Old), splitLines(change.New))
+
+	var out strings.Builder
+	var ours, theirs []string
+	flush := func() {
+		if len(ours) == 0 && len(theirs) == 0 {
+			return
+		}
+		out.WriteString(markerOurs + " " + oldLabel + "\n")
+		for _, line := range ours {
+			out.WriteString(line + "\n")
+		}
+		out.WriteString(markerSplit + "\n")
+		for _, line := range theirs {
+			out.WriteString(line + "\n")
+		}
+		out.WriteString(markerTheirs + " " + newLabel + "\n")
+		ours, theirs = nil, nil
+	}
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			flush()
+			out.WriteString(o.line + "\n")
+		case opDelete:
+			ours = append(ours, o.line)
+		case opInsert:
+			theirs = append(theirs, o.line)
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// HasMarkers reports whether text still holds a conflict left by Markers
+func HasMarkers(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, markerOurs+" ") || line == markerSplit || strings.HasPrefix(line, markerTheirs+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package diff
+
+import "testing"
+
+func TestMarkers(t *testing.T) {
+	change := Change{
+		Path: "firefox.nix",
+		Old:  "{\n  a = 1;\n  keep = true;\n  custom = 2;\n}\n",
+		New:  "{\n  a = 3;\n  keep = true;\n}\n",
+	}
+	want := "{\n<<<<<<< existing\n  a = 1;\n=======\n  a = 3;\n>>>>>>> generated\n  keep = true;\n<<<<<<< existing\n  custom = 2;\n=======\n>>>>>>> generated\n}\n"
+
+	got := Markers(change, "existing", "generated")
+	if got != want {
+		t.Errorf("Markers() =\n%s\nwant:\n%s", got, want)
+	}
+	if !HasMarkers(got) {
+		t.Errorf("HasMarkers() = false for a text with conflicts")
+	}
+	if HasMarkers(change.New) {
+		t.Errorf("HasMarkers() = true for a text without conflicts")
+	}
+}
+
+func TestMarkers_SameContent(t *testing.T) {
+	change := Change{Old: "x\ny\n", New: "x\ny\n"}
+	if got := Markers(change, "a", "b"); got != change.Old {
+		t.Errorf("Markers() = %q, want %q", got, change.Old)
+	}
+}
@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"pam/internal/fsx"
+)
+
+// WriteError is returned when a file of the flake can't be written or removed
+type WriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("could not write %s: %v", e.Path, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteFile replaces path with content atomically, creating its directory, so readers see
+// either the old or the new content and never a partial write
+func WriteFile(path string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = fsx.WriteFileAtomic(path, content, 0o644)
+	}
+	if err != nil {
+		return &WriteError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// Write saves the new content of the change, removing the file when New is empty
+func (c Change) Write() error {
+	if c.Old == c.New {
+		return nil
+	}
+	if c.New == "" {
+		if err := os.Remove(c.Path); err != nil {
+			return &WriteError{Path: c.Path, Err: err}
+		}
+		return nil
+	}
+	return WriteFile(c.Path, []byte(c.New))
+}
+
+// applied is a change Apply wrote, with whether its file existed before. An empty Old
+// can't tell an empty file from a missing one.
+type applied struct {
+	Change
+	Created bool
+}
+
+// revert puts back the content the change replaced, removing the file when it created it
+func (a applied) revert() error {
+	if !a.Created {
+		return WriteFile(a.Path, []byte(a.Old))
+	}
+	if err := os.Remove(a.Path); err != nil && !os.IsNotExist(err) {
+		return &WriteError{Path: a.Path, Err: err}
+	}
+	return nil
+}
+
+// Apply writes every change, or none of them: when a write fails, the files written
+// before it are restored to their old content, newest first, and new files are removed again
+func Apply(changes []Change) error {
+	var written []applied
+	for _, change := range changes {
+		if change.Old == change.New {
+			continue
+		}
+		_, statErr := os.Lstat(change.Path)
+		err := change.Write()
+		if err == nil {
+			written = append(written, applied{Change: change, Created: os.IsNotExist(statErr)})
+			continue
+		}
+		for n := len(written) - 1; n >= 0; n-- {
+			if revertErr := written[n].revert(); revertErr != nil {
+				err = errors.Join(err, fmt.Errorf("could not restore %s: %w", written[n].Path, revertErr))
+			}
+		}
+		return err
+	}
+	return nil
+}
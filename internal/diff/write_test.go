@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile_KeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configuration.nix")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path, []byte("new\n")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "new\n" {
+		t.Errorf("content = %q, want %q", data, "new\n")
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "hosts", "desktop", "configuration.nix")
+	created := filepath.Join(dir, "modules", "apps", "cli", "ripgrep.nix")
+	// A file where a directory is needed makes the write fail
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{existing: "old\n", blocker: ""} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		changes     []Change
+		wantErr     bool
+		wantContent string
+		wantCreated bool
+	}{
+		{
+			name: "every change written",
+			changes: []Change{
+				{Path: created, New: "module\n"},
+				{Path: existing, Old: "old\n", New: "new\n"},
+			},
+			wantContent: "new\n",
+			wantCreated: true,
+		},
+		{
+			name: "failed write rolls back the earlier ones",
+			changes: []Change{
+				{Path: created, New: "module\n"},
+				{Path: existing, Old: "old\n", New: "new\n"},
+				{Path: filepath.Join(blocker, "laptop.nix"), New: "x\n"},
+			},
+			wantErr:     true,
+			wantContent: "old\n",
+		},
+		{
+			name: "a file changed twice gets its first content back",
+			changes: []Change{
+				{Path: existing, Old: "old\n", New: "new\n"},
+				{Path: existing, Old: "new\n", New: "newer\n"},
+				{Path: filepath.Join(blocker, "laptop.nix"), New: "x\n"},
+			},
+			wantErr:     true,
+			wantContent: "old\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.WriteFile(existing, []byte("old\n"), 0o644)
+			os.Remove(created)
+
+			err := Apply(tt.changes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var writeErr *WriteError
+			if tt.wantErr && (!errors.As(err, &writeErr) || writeErr.Path != tt.changes[len(tt.changes)-1].Path) {
+				t.Errorf("Apply() error = %v, want a WriteError for the failed file", err)
+			}
+			data, _ := os.ReadFile(existing)
+			if string(data) != tt.wantContent {
+				t.Errorf("%s = %q, want %q", existing, data, tt.wantContent)
+			}
+			if _, err := os.Stat(created); (err == nil) != tt.wantCreated {
+				t.Errorf("%s exists = %v, want %v", created, err == nil, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestApply_RollbackKeepsEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "default.nix")
+	blocker := filepath.Join(dir, "blocker")
+	for _, path := range []string{empty, blocker} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := Apply([]Change{
+		{Path: empty, Old: "", New: "{ imports = [ ./cli ]; }\n"},
+		{Path: filepath.Join(blocker, "laptop.nix"), New: "x\n"},
+	})
+	if err == nil {
+		t.Fatal("Apply() error = nil, want the failed write")
+	}
+	data, err := os.ReadFile(empty)
+	if err != nil {
+		t.Fatalf("rollback removed the empty file that existed: %v", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("%s = %q, want it empty again", empty, data)
+	}
+}
@@ -0,0 +1,75 @@
+// Package direnv sets up direnv to load the devshell of a project whenever its directory
+// is entered, through the .envrc of the project
+package direnv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"pam/internal/execx"
+	"pam/internal/fsx"
+)
+
+// UseFlake is the .envrc line loading the default devshell of the flake next to it
+const UseFlake = "use flake"
+
+// useFlakePattern matches a line loading a devshell, e.g. use flake or use flake .#docs
+var useFlakePattern = regexp.MustCompile(`(?m)^\s*use\s+flake(\s|$)`)
+
+// File returns the path of the .envrc of the project in dir
+func File(dir string) string {
+	return filepath.Join(dir, ".envrc")
+}
+
+// UsesFlake reports whether the .envrc content loads a devshell of the flake
+func UsesFlake(content string) bool {
+	return useFlakePattern.MatchString(content)
+}
+
+// Envrc returns the .envrc content with UseFlake added at its end, and whether it changed.
+// content is empty for a project without a .envrc.
+func Envrc(content string) (string, bool) {
+	if UsesFlake(content) {
+		return content, false
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + UseFlake + "\n", true
+}
+
+// Allow lets direnv load the .envrc of dir, which it refuses for a new or changed file
+// until it is allowed
+func Allow(ctx context.Context, runner execx.Runner, dir string) error {
+	output, err := runner.CombinedOutput(ctx, nil, "direnv", "allow", File(dir))
+	if err != nil {
+		return fmt.Errorf("direnv allow failed: %w\n%s", err, output)
+	}
+	return nil
+}
+
+// Write saves the .envrc of dir with UseFlake added, returning false when it already
+// loads the devshell
+func Write(dir string) (bool, error) {
+	content, err := os.ReadFile(File(dir))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	updated, changed := Envrc(string(content))
+	if !changed {
+		return false, nil
+	}
+	return true, fsx.WriteFileAtomic(File(dir), []byte(updated), 0o644)
+}
+
+// Reload makes the direnv hook of the shell load the devshell again at its next prompt,
+// like direnv reload does, by touching the .envrc of dir
+func Reload(dir string) error {
+	now := time.Now()
+	return os.Chtimes(File(dir), now, now)
+}
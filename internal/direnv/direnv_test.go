@@ -0,0 +1,65 @@
+package direnv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestEnvrc(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantChanged bool
+	}{
+		{name: "no envrc", content: "", want: "use flake\n", wantChanged: true},
+		{name: "other settings", content: "export FOO=bar", want: "export FOO=bar\nuse flake\n", wantChanged: true},
+		{name: "uses flake", content: "use flake\n", want: "use flake\n"},
+		{name: "uses another devshell", content: "dotenv\nuse flake .#docs\n", want: "dotenv\nuse flake .#docs\n"},
+		{name: "commented out", content: "# use flake\n", want: "# use flake\nuse flake\n", wantChanged: true},
+		{name: "use flakes is not use flake", content: "use flakes\n", want: "use flakes\nuse flake\n", wantChanged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := Envrc(tt.content)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("Envrc(%q) = %q, %v, want %q, %v", tt.content, got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	changed, err := Write(dir)
+	if err != nil || !changed {
+		t.Fatalf("Write() = %v, %v, want a new .envrc", changed, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".envrc"))
+	if err != nil || string(data) != "use flake\n" {
+		t.Errorf(".envrc = %q, %v", data, err)
+	}
+	if changed, err := Write(dir); err != nil || changed {
+		t.Errorf("Write() again = %v, %v, want it unchanged", changed, err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	fake := &execx.Fake{Responses: map[string]execx.Response{"direnv": {}}}
+	if err := Allow(context.Background(), fake, "/home/me/project"); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if want := []string{"direnv allow /home/me/project/.envrc"}; !slices.Equal(fake.Calls(), want) {
+		t.Errorf("Allow() ran %v, want %v", fake.Calls(), want)
+	}
+
+	failing := &execx.Fake{Missing: []string{"direnv"}}
+	if err := Allow(context.Background(), failing, "/home/me/project"); err == nil {
+		t.Error("Allow() should fail without direnv")
+	}
+}
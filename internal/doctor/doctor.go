@@ -0,0 +1,412 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal"
+	"pam/internal/categories"
+	"pam/internal/execx"
+	"pam/internal/gitops"
+	"pam/internal/hosts"
+	"pam/internal/modules"
+	"pam/internal/nixvalidate"
+	"pam/internal/platform"
+	"pam/internal/setup"
+)
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	OK Status = iota
+	Warning
+	Failed
+	// Skipped checks depend on an earlier check that failed
+	Skipped
+)
+
+var statusNames = map[Status]string{
+	OK:      "ok",
+	Warning: "warning",
+	Failed:  "failed",
+	Skipped: "skipped",
+}
+
+func (s Status) String() string {
+	return statusNames[s]
+}
+
+// MarshalText writes the status by name in --output json
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Result is the outcome of a single check. Fix tells the user how to resolve a warning or failure.
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Env is everything the checks touch outside of the flake directory
+type Env struct {
+	LookPath func(file string) (string, error)
+	// Run executes a command and returns its standard output
+	Run       func(name string, args ...string) ([]byte, error)
+	Validator nixvalidate.Validator
+	Git       *gitops.Repo
+	// WSL is set when pam runs inside the Windows Subsystem for Linux
+	WSL bool
+}
+
+// DefaultEnv checks the real system
+func DefaultEnv(cfg *internal.Config) Env {
+	return Env{
+		LookPath: execx.Default.LookPath,
+		Run: func(name string, args ...string) ([]byte, error) {
+			return execx.Default.Output(context.Background(), name, args...)
+		},
+		Validator: nixvalidate.Default(),
+		Git:       gitops.NewRepo(cfg.FlakePath),
+		WSL:       platform.InWSL(),
+	}
+}
+
+// AnyFailed reports whether any check failed, warnings don't count
+func AnyFailed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs every check in order. Checks of the flake are skipped when the flake path is missing,
+// and checks needing nix are skipped when nix is not installed.
+func Run(cfg *internal.Config, env Env) []Result {
+	nix := checkNix(env)
+	results := []Result{nix}
+	if nix.Status == OK {
+		results = append(results, checkFeatures(env))
+	} else {
+		results = append(results, skipped("experimental features", "nix is not installed"))
+	}
+
+	flake := checkFlake(cfg, env)
+	results = append(results, flake)
+	if env.WSL {
+		results = append(results, checkWSL(cfg))
+	}
+	if flake.Status == Failed {
+		for _, name := range []string{"hosts", "modules", "categories", "mkApp.nix", "specialArgs", "git"} {
+			results = append(results, skipped(name, "the flake path is missing"))
+		}
+		return results
+	}
+
+	return append(results,
+		checkHosts(cfg),
+		checkModules(cfg),
+		checkCategories(cfg),
+		checkMkApp(cfg),
+		checkRegistration(cfg),
+		checkGit(env),
+	)
+}
+
+func skipped(name string, reason string) Result {
+	return Result{Name: name, Status: Skipped, Detail: reason}
+}
+
+func checkNix(env Env) Result {
+	path, err := env.LookPath("nix")
+	if err != nil {
+		return Result{
+			Name:   "nix",
+			Status: Failed,
+			Detail: "nix was not found in PATH",
+			Fix:    capitalize(platform.InstallHint("nix", env.WSL)),
+		}
+	}
+	return Result{Name: "nix", Status: OK, Detail: path}
+}
+
+// checkWSL warns about a flake on the Windows drives, which nix reads slowly and where
+// file modes are lost
+func checkWSL(cfg *internal.Config) Result {
+	result := Result{Name: "wsl", Status: OK, Detail: "the flake is inside the WSL distribution"}
+	if strings.HasPrefix(cfg.FlakePath, "/mnt/") {
+		result.Status = Warning
+		result.Detail = fmt.Sprintf("%s is on a Windows drive", cfg.FlakePath)
+		result.Fix = "Move the flake into the distribution, e.g. ~/nixos-config, and set flake_path to it: nix evaluates files on /mnt slowly and can't keep their modes"
+	}
+	return result
+}
+
+func capitalize(text string) string {
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// experimentalFeatures reads the enabled features, falling back to show-config for nix before 2.20
+func experimentalFeatures(env Env) ([]string, error) {
+	output, err := env.Run("nix", "config", "show", "experimental-features")
+	if err == nil {
+		return strings.Fields(string(output)), nil
+	}
+
+	output, err = env.Run("nix", "show-config")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(key) == "experimental-features" {
+			return strings.Fields(value), nil
+		}
+	}
+	return nil, nil
+}
+
+func checkFeatures(env Env) Result {
+	result := Result{Name: "experimental features"}
+	features, err := experimentalFeatures(env)
+	if err != nil {
+		result.Status = Failed
+		result.Detail = fmt.Sprintf("could not read the nix configuration: %v", err)
+		result.Fix = "Check that `nix config show` works in your shell"
+		return result
+	}
+
+	var missing []string
+	for _, want := range []string{"nix-command", "flakes"} {
+		enabled := false
+		for _, feature := range features {
+			enabled = enabled || feature == want
+		}
+		if !enabled {
+			missing = append(missing, want)
+		}
+	}
+	if len(missing) > 0 {
+		result.Status = Failed
+		result.Detail = "not enabled: " + strings.Join(missing, ", ")
+		result.Fix = "Add `experimental-features = nix-command flakes` to ~/.config/nix/nix.conf, or to nix.settings on NixOS"
+		return result
+	}
+	result.Status = OK
+	result.Detail = "nix-command flakes"
+	return result
+}
+
+func checkFlake(cfg *internal.Config, env Env) Result {
+	result := Result{Name: "flake"}
+	flakeFile := filepath.Join(cfg.FlakePath, "flake.nix")
+	content, err := os.ReadFile(flakeFile)
+	if err != nil {
+		result.Status = Failed
+		result.Detail = err.Error()
+		result.Fix = "Set flake_path in the pam config to the directory containing your flake.nix"
+		return result
+	}
+
+	err = env.Validator.Validate(flakeFile, content)
+	if err != nil {
+		result.Status = Failed
+		result.Detail = err.Error()
+		result.Fix = "Fix the syntax error in flake.nix, `nix flake check` shows more details"
+		return result
+	}
+	result.Status = OK
+	result.Detail = flakeFile
+	return result
+}
+
+func checkHosts(cfg *internal.Config) Result {
+	result := Result{Name: "hosts"}
+	hostsDir := filepath.Join(cfg.FlakePath, cfg.DefaultHostDir)
+	entries, err := os.ReadDir(hostsDir)
+	if err != nil {
+		result.Status = Failed
+		result.Detail = err.Error()
+		result.Fix = "Set default_host_dir in the pam config to the folder with one directory per host"
+		return result
+	}
+
+	var found, missing []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		found = append(found, entry.Name())
+		if _, err := os.Stat(hosts.AppsFile(hostsDir, entry.Name(), cfg.AppsFiles())); err != nil {
+			missing = append(missing, entry.Name())
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		result.Status = Failed
+		result.Detail = "no host directories in " + hostsDir
+		result.Fix = "Create a directory per host in " + hostsDir + " holding its configuration.nix"
+	case len(missing) > 0:
+		result.Status = Warning
+		result.Detail = "no apps file for " + strings.Join(missing, ", ")
+		result.Fix = "Create the missing configuration.nix files, or set apps_file in the hosts section of the pam config at the right file"
+	default:
+		result.Status = OK
+		result.Detail = strings.Join(found, ", ")
+	}
+	return result
+}
+
+func checkModules(cfg *internal.Config) Result {
+	result := Result{Name: "modules"}
+	modulesDir := filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir)
+	entries, err := os.ReadDir(modulesDir)
+	if err != nil {
+		result.Status = Failed
+		result.Detail = err.Error()
+		result.Fix = "Create " + modulesDir + " or set default_module_dir in the pam config"
+		return result
+	}
+
+	categories := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			categories++
+		}
+	}
+	if categories == 0 {
+		result.Status = Warning
+		result.Detail = "no category folders in " + modulesDir
+		result.Fix = "Install a package with `pam install`, it creates the category folder for you"
+		return result
+	}
+	result.Status = OK
+	result.Detail = fmt.Sprintf("%d categories", categories)
+	return result
+}
+
+// checkCategories compares the flake's .pam/categories.yaml with the category folders
+func checkCategories(cfg *internal.Config) Result {
+	result := Result{Name: "categories"}
+	schema, err := categories.Load(cfg.FlakePath)
+	if err != nil {
+		result.Status = Failed
+		result.Detail = err.Error()
+		result.Fix = "Fix " + categories.File + ", every category needs a unique name like cli/editors"
+		return result
+	}
+	if schema == nil {
+		result.Status = OK
+		result.Detail = "no " + categories.File + ", every folder is a category"
+		return result
+	}
+	found, err := modules.Categories(filepath.Join(cfg.FlakePath, cfg.DefaultModuleDir))
+	if err != nil {
+		return skipped(result.Name, "the module directory is missing")
+	}
+	var folders []string
+	for _, category := range found {
+		folders = append(folders, category.Name)
+	}
+
+	undeclared, missing := schema.Drift(folders)
+	result.Status = OK
+	result.Detail = fmt.Sprintf("%d declared categories", len(schema.Categories))
+	if len(missing) > 0 {
+		// The first install into a declared category creates its folder
+		result.Detail += ", no folder yet: " + strings.Join(missing, ", ")
+	}
+	if len(undeclared) > 0 {
+		result.Status = Warning
+		result.Detail = "folders not declared: " + strings.Join(undeclared, ", ")
+		result.Fix = "Declare them in " + categories.File + " or move their modules into a declared category"
+	}
+	return result
+}
+
+func checkMkApp(cfg *internal.Config) Result {
+	result := Result{Name: "mkApp.nix"}
+	initializer := setup.NewInitializer(cfg)
+	present, current, err := initializer.MkAppUpToDate()
+	switch {
+	case err != nil:
+		result.Status = Failed
+		result.Detail = err.Error()
+	case !present:
+		result.Status = Failed
+		result.Detail = initializer.MkAppPath() + " is missing"
+		result.Fix = "Run `pam install`, it creates lib/mkApp.nix before installing"
+	case !current:
+		result.Status = Warning
+		result.Detail = "differs from the version bundled with pam"
+		result.Fix = "Delete " + initializer.MkAppPath() + " to have pam write the current version, after saving any edits you made to it"
+	default:
+		result.Status = OK
+		result.Detail = initializer.MkAppPath()
+	}
+	return result
+}
+
+func checkRegistration(cfg *internal.Config) Result {
+	result := Result{Name: "specialArgs"}
+	change, err := setup.NewInitializer(cfg).Registration()
+	switch {
+	case err != nil:
+		result.Status = Warning
+		result.Detail = err.Error()
+		result.Fix = "Pass mkApp and isLinux to your modules through specialArgs, see the README"
+	case change.Old != change.New:
+		result.Status = Warning
+		result.Detail = "flake.nix doesn't pass mkApp and isLinux to every system"
+		result.Fix = "Run `pam install`, it offers to add them to specialArgs"
+	default:
+		result.Status = OK
+		result.Detail = "mkApp and isLinux are passed to every system"
+	}
+	return result
+}
+
+func checkGit(env Env) Result {
+	result := Result{Name: "git"}
+	if !env.Git.IsRepo() {
+		result.Status = Warning
+		result.Detail = "the flake is not a git repository"
+		result.Fix = "Run `git init` in the flake directory to track your changes"
+		return result
+	}
+
+	paths, err := env.Git.Status()
+	if err != nil {
+		result.Status = Failed
+		result.Detail = err.Error()
+		return result
+	}
+	if len(paths) == 0 {
+		result.Status = OK
+		result.Detail = "clean"
+		return result
+	}
+
+	result.Status = Warning
+	result.Detail = fmt.Sprintf("%d uncommitted changes", len(paths))
+	result.Fix = "Commit or stash your changes, or enable git_auto_commit"
+	for _, path := range paths {
+		if filepath.Ext(path) == ".nix" {
+			// Untracked files are invisible to nix when it evaluates a flake from a git repository
+			result.Fix = "Commit or `git add` the changed .nix files, nix ignores untracked files in a flake"
+			break
+		}
+	}
+	return result
+}
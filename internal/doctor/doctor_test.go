@@ -0,0 +1,260 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal"
+	"pam/internal/assets"
+	"pam/internal/gitops"
+	"pam/internal/nixvalidate"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+const healthyFlakeNix = `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      specialArgs = { mkApp = import ./lib/mkApp.nix { inherit (nixpkgs) lib; }; isLinux = true; };
+    };
+  };
+}
+`
+
+// healthyFlake creates a flake that passes every check
+func healthyFlake(t *testing.T) *internal.Config {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "flake.nix"), healthyFlakeNix)
+	writeFile(t, filepath.Join(root, "hosts", "laptop", "configuration.nix"), "{ apps = { }; }\n")
+	writeFile(t, filepath.Join(root, "modules", "apps", "browsers", "firefox.nix"), "{ }\n")
+	writeFile(t, filepath.Join(root, "lib", "mkApp.nix"), assets.GetMkApp())
+	return &internal.Config{FlakePath: root, DefaultHostDir: "hosts", DefaultModuleDir: "modules/apps"}
+}
+
+type fakeSystem struct {
+	nix      bool
+	features string
+	status   string
+	repo     bool
+}
+
+func (f fakeSystem) env(cfg *internal.Config) Env {
+	git := func(dir string, args ...string) ([]byte, error) {
+		switch strings.Join(args, " ") {
+		case "rev-parse --is-inside-work-tree":
+			if !f.repo {
+				return nil, errors.New("exit status 128")
+			}
+			return []byte("true\n"), nil
+		case "status --porcelain":
+			return []byte(f.status), nil
+		}
+		return nil, errors.New("unexpected git command")
+	}
+	return Env{
+		LookPath: func(file string) (string, error) {
+			if !f.nix {
+				return "", errors.New("not found")
+			}
+			return "/run/current-system/sw/bin/" + file, nil
+		},
+		Run: func(name string, args ...string) ([]byte, error) {
+			return []byte(f.features + "\n"), nil
+		},
+		Validator: nixvalidate.Chain{},
+		Git:       gitops.NewRepoWithRunner(cfg.FlakePath, git),
+	}
+}
+
+func statuses(results []Result) map[string]Status {
+	got := make(map[string]Status)
+	for _, result := range results {
+		got[result.Name] = result.Status
+	}
+	return got
+}
+
+func TestRun(t *testing.T) {
+	healthy := fakeSystem{nix: true, features: "flakes nix-command", repo: true}
+
+	tests := []struct {
+		name   string
+		system fakeSystem
+		modify func(t *testing.T, cfg *internal.Config)
+		want   map[string]Status
+	}{
+		{
+			name:   "healthy",
+			system: healthy,
+			want:   map[string]Status{"nix": OK, "experimental features": OK, "flake": OK, "hosts": OK, "modules": OK, "categories": OK, "mkApp.nix": OK, "specialArgs": OK, "git": OK},
+		},
+		{
+			name:   "nix missing",
+			system: fakeSystem{repo: true},
+			want:   map[string]Status{"nix": Failed, "experimental features": Skipped, "flake": OK},
+		},
+		{
+			name:   "flakes not enabled",
+			system: fakeSystem{nix: true, features: "nix-command", repo: true},
+			want:   map[string]Status{"experimental features": Failed},
+		},
+		{
+			name:   "flake path missing",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				cfg.FlakePath = filepath.Join(cfg.FlakePath, "missing")
+			},
+			want: map[string]Status{"flake": Failed, "hosts": Skipped, "git": Skipped},
+		},
+		{
+			name:   "host without apps file",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				os.MkdirAll(filepath.Join(cfg.FlakePath, "hosts", "server"), 0o755)
+			},
+			want: map[string]Status{"hosts": Warning},
+		},
+		{
+			name:   "outdated mkApp",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				writeFile(t, filepath.Join(cfg.FlakePath, "lib", "mkApp.nix"), "{ }\n")
+			},
+			want: map[string]Status{"mkApp.nix": Warning},
+		},
+		{
+			name:   "missing mkApp",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				os.Remove(filepath.Join(cfg.FlakePath, "lib", "mkApp.nix"))
+			},
+			want: map[string]Status{"mkApp.nix": Failed},
+		},
+		{
+			name:   "mkApp not passed",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				writeFile(t, filepath.Join(cfg.FlakePath, "flake.nix"), "{ outputs = { nixpkgs, ... }: { nixosConfigurations.laptop = nixpkgs.lib.nixosSystem { }; }; }\n")
+			},
+			want: map[string]Status{"specialArgs": Warning},
+		},
+		{
+			name:   "categories match",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				writeFile(t, filepath.Join(cfg.FlakePath, ".pam", "categories.yaml"), "categories:\n  - name: browsers\n  - name: games\n")
+			},
+			want: map[string]Status{"categories": OK},
+		},
+		{
+			name:   "undeclared category folder",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				writeFile(t, filepath.Join(cfg.FlakePath, ".pam", "categories.yaml"), "categories:\n  - name: games\n")
+			},
+			want: map[string]Status{"categories": Warning},
+		},
+		{
+			name:   "invalid category schema",
+			system: healthy,
+			modify: func(t *testing.T, cfg *internal.Config) {
+				writeFile(t, filepath.Join(cfg.FlakePath, ".pam", "categories.yaml"), "categories:\n  - name: ../apps\n")
+			},
+			want: map[string]Status{"categories": Failed},
+		},
+		{
+			name:   "dirty repository",
+			system: fakeSystem{nix: true, features: "flakes nix-command", repo: true, status: "?? modules/apps/browsers/firefox.nix\n"},
+			want:   map[string]Status{"git": Warning},
+		},
+		{
+			name:   "not a repository",
+			system: fakeSystem{nix: true, features: "flakes nix-command"},
+			want:   map[string]Status{"git": Warning},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := healthyFlake(t)
+			if tt.modify != nil {
+				tt.modify(t, cfg)
+			}
+			results := Run(cfg, tt.system.env(cfg))
+
+			got := statuses(results)
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s status = %v, want %v", name, got[name], want)
+				}
+			}
+			for _, result := range results {
+				if (result.Status == Warning || result.Status == Failed) && result.Fix == "" && result.Detail == "" {
+					t.Errorf("%s has no detail or fix", result.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestExperimentalFeatures_ShowConfigFallback(t *testing.T) {
+	env := Env{Run: func(name string, args ...string) ([]byte, error) {
+		if args[0] == "config" {
+			return nil, errors.New("unrecognised command")
+		}
+		return []byte("cores = 0\nexperimental-features = flakes nix-command\n"), nil
+	}}
+
+	features, err := experimentalFeatures(env)
+	if err != nil {
+		t.Fatalf("experimentalFeatures() error = %v", err)
+	}
+	if strings.Join(features, " ") != "flakes nix-command" {
+		t.Errorf("experimentalFeatures() = %v", features)
+	}
+}
+
+func TestResult_JSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{"ok without fix", Result{Name: "nix", Status: OK, Detail: "found"}, `{"name":"nix","status":"ok","detail":"found"}`},
+		{"failed with fix", Result{Name: "flake.nix", Status: Failed, Detail: "missing", Fix: "run pam init"}, `{"name":"flake.nix","status":"failed","detail":"missing","fix":"run pam init"}`},
+		{"skipped", Result{Name: "hosts", Status: Skipped}, `{"name":"hosts","status":"skipped","detail":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWSL(t *testing.T) {
+	if result := checkWSL(&internal.Config{FlakePath: "/home/me/nixos-config"}); result.Status != OK {
+		t.Errorf("checkWSL() = %+v, want ok for a flake in the distribution", result)
+	}
+	if result := checkWSL(&internal.Config{FlakePath: "/mnt/c/Users/me/nixos-config"}); result.Status != Warning || result.Fix == "" {
+		t.Errorf("checkWSL() = %+v, want a warning for a flake on a Windows drive", result)
+	}
+}
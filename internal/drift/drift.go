@@ -0,0 +1,197 @@
+package drift
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/nixconfig"
+)
+
+// Kind is a way the modules, the host configs and the lock file disagree
+type Kind string
+
+const (
+	// UnusedModule is a module no host mentions
+	UnusedModule Kind = "unused-module"
+	// MissingModule is a host entry without a module, the host fails to evaluate
+	MissingModule Kind = "missing-module"
+	// StaleLock is a lock entry whose module was deleted
+	StaleLock Kind = "stale-lock"
+	// Unlocked is a module generated by pam that the lock doesn't record
+	Unlocked Kind = "unlocked"
+	// LockHosts is a lock entry recording other hosts than the ones enabling the module
+	LockHosts Kind = "lock-hosts"
+)
+
+// kindOrder is the order issues are reported in, host problems first
+var kindOrder = []Kind{MissingModule, UnusedModule, StaleLock, Unlocked, LockHosts}
+
+// Issue is one disagreement found by Detect
+type Issue struct {
+	Kind     Kind   `json:"kind"`
+	Category string `json:"category"`
+	Package  string `json:"package"`
+	// Module is the module file relative to the flake, using / separators
+	Module string `json:"module"`
+	// Hosts mention the missing module, or enable the module of the other kinds
+	Hosts []string `json:"hosts"`
+}
+
+func (i Issue) String() string {
+	switch i.Kind {
+	case UnusedModule:
+		return fmt.Sprintf("%s is not mentioned by any host", i.Module)
+	case MissingModule:
+		return fmt.Sprintf("%s.%s is set on %s but %s does not exist", i.Category, i.Package, strings.Join(i.Hosts, ", "), i.Module)
+	case StaleLock:
+		return fmt.Sprintf("pam.lock.json records %s, which was deleted", i.Module)
+	case Unlocked:
+		return fmt.Sprintf("pam.lock.json does not record %s", i.Module)
+	case LockHosts:
+		return fmt.Sprintf("pam.lock.json has the wrong hosts for %s, enabled on %s", i.Module, hostList(i.Hosts))
+	}
+	return string(i.Kind)
+}
+
+func hostList(hostNames []string) string {
+	if len(hostNames) == 0 {
+		return "none"
+	}
+	return strings.Join(hostNames, ", ")
+}
+
+// Flake is what Detect compares
+type Flake struct {
+	Path       string
+	ModulesDir string
+	HostsDir   string
+	HostNames  []string
+	// Namespace is the attribute path of the apps sections, e.g. apps
+	Namespace string
+	// AppsFiles are the layers of apps file overrides, see hosts.AppsFile
+	AppsFiles []map[string]string
+	Lock      *lockfile.Lock
+}
+
+// usage is how the hosts mention one package
+type usage struct {
+	category  string
+	name      string
+	mentioned []string
+	enabled   []string
+}
+
+// Detect compares the modules with the apps sections of the hosts and the lock file.
+// Hosts without an apps file are skipped.
+func Detect(flake Flake) ([]Issue, error) {
+	found, err := modules.Scan(flake.ModulesDir)
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", flake.ModulesDir, err)
+	}
+
+	usages := map[string]*usage{}
+	var order []string
+	for _, host := range flake.HostNames {
+		path := hosts.AppsFile(flake.HostsDir, host, flake.AppsFiles...)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+		nixcfg := nixconfig.NewConfig(string(data))
+		nixcfg.SetNamespace(flake.Namespace)
+		for _, entry := range nixcfg.AppEntries() {
+			key := entry.Category + "/" + entry.Name
+			u, ok := usages[key]
+			if !ok {
+				u = &usage{category: entry.Category, name: entry.Name}
+				usages[key] = u
+				order = append(order, key)
+			}
+			if !slices.Contains(u.mentioned, host) {
+				u.mentioned = append(u.mentioned, host)
+			}
+			if entry.Enabled && !slices.Contains(u.enabled, host) {
+				u.enabled = append(u.enabled, host)
+			}
+		}
+	}
+
+	var issues []Issue
+	// enabled holds the enabling hosts of every module, keyed by its lock path
+	enabled := map[string][]string{}
+	for _, module := range found {
+		name, err := module.PackageName()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", module.Path, err)
+		}
+		rel, err := lockfile.RelativeModule(flake.Path, module.Path)
+		if err != nil {
+			return nil, err
+		}
+		issue := Issue{Category: module.Category, Package: name, Module: rel, Hosts: []string{}}
+
+		u, ok := usages[module.Category+"/"+name]
+		if !ok {
+			issue.Kind = UnusedModule
+			issues = append(issues, issue)
+		} else {
+			u.mentioned = nil
+			issue.Hosts = slices.Sorted(slices.Values(u.enabled))
+		}
+		enabled[rel] = issue.Hosts
+
+		if _, locked := flake.Lock.Get(rel); !locked {
+			if _, generated, _ := module.Header(); generated {
+				issue.Kind = Unlocked
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	for _, key := range order {
+		u := usages[key]
+		if u.mentioned == nil {
+			continue
+		}
+		module := filepath.Join(flake.ModulesDir, filepath.FromSlash(u.category), u.name+".nix")
+		rel, err := lockfile.RelativeModule(flake.Path, module)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, Issue{Kind: MissingModule, Category: u.category, Package: u.name, Module: rel, Hosts: u.mentioned})
+	}
+
+	for _, pkg := range flake.Lock.Packages {
+		issue := Issue{Category: pkg.Category, Package: pkg.Name, Module: pkg.Module, Hosts: []string{}}
+		hostNames, exists := enabled[pkg.Module]
+		switch {
+		case !exists:
+			issue.Kind = StaleLock
+			issue.Hosts = pkg.Hosts
+		case !slices.Equal(hostNames, pkg.Hosts) && !(len(hostNames) == 0 && len(pkg.Hosts) == 0):
+			issue.Kind = LockHosts
+			issue.Hosts = hostNames
+		default:
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	slices.SortStableFunc(issues, func(a, b Issue) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(kindOrder, a.Kind), slices.Index(kindOrder, b.Kind)),
+			cmp.Compare(a.Module, b.Module),
+		)
+	})
+	return issues, nil
+}
@@ -0,0 +1,128 @@
+package drift
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"pam/internal/lockfile"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules map[string]string
+		laptop  string
+		lock    []lockfile.Package
+		want    []Issue
+	}{
+		{
+			name:    "in sync",
+			modules: map[string]string{"browsers/firefox.nix": "# pam: attr=firefox version=1\nmkApp {\n  name = \"firefox\";\n}\n"},
+			laptop:  "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n  };\n}\n",
+			lock:    []lockfile.Package{{Name: "firefox", Category: "browsers", Hosts: []string{"laptop"}, Module: "modules/browsers/firefox.nix"}},
+		},
+		{
+			name:    "disabled entries still use the module",
+			modules: map[string]string{"editors/nvim.nix": "mkApp {\n  name = \"neovim\";\n}\n"},
+			laptop:  "{\n  apps = {\n    editors = {\n      neovim.enable = false;\n    };\n  };\n}\n",
+		},
+		{
+			name:    "unused module written by hand",
+			modules: map[string]string{"editors/nvim.nix": "mkApp {\n  name = \"neovim\";\n}\n"},
+			laptop:  "{\n  apps = {\n  };\n}\n",
+			want:    []Issue{{Kind: UnusedModule, Category: "editors", Package: "neovim", Module: "modules/editors/nvim.nix", Hosts: []string{}}},
+		},
+		{
+			name:   "missing module",
+			laptop: "{\n  apps = {\n    editors = {\n      neovim.enable = true;\n    };\n  };\n}\n",
+			want:   []Issue{{Kind: MissingModule, Category: "editors", Package: "neovim", Module: "modules/editors/neovim.nix", Hosts: []string{"laptop"}}},
+		},
+		{
+			name:   "stale lock entry",
+			laptop: "{\n  apps = {\n  };\n}\n",
+			lock:   []lockfile.Package{{Name: "firefox", Category: "browsers", Hosts: []string{"laptop"}, Module: "modules/browsers/firefox.nix"}},
+			want:   []Issue{{Kind: StaleLock, Category: "browsers", Package: "firefox", Module: "modules/browsers/firefox.nix", Hosts: []string{"laptop"}}},
+		},
+		{
+			name:    "unlocked generated module",
+			modules: map[string]string{"browsers/firefox.nix": "# pam: attr=firefox version=1\nmkApp {\n  name = \"firefox\";\n}\n"},
+			laptop:  "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n  };\n}\n",
+			want:    []Issue{{Kind: Unlocked, Category: "browsers", Package: "firefox", Module: "modules/browsers/firefox.nix", Hosts: []string{"laptop"}}},
+		},
+		{
+			name:    "lock records other hosts",
+			modules: map[string]string{"browsers/firefox.nix": "# pam: attr=firefox version=1\nmkApp {\n  name = \"firefox\";\n}\n"},
+			laptop:  "{\n  apps = {\n    browsers = {\n      firefox.enable = false;\n    };\n  };\n}\n",
+			lock:    []lockfile.Package{{Name: "firefox", Category: "browsers", Hosts: []string{"laptop"}, Module: "modules/browsers/firefox.nix"}},
+			want:    []Issue{{Kind: LockHosts, Category: "browsers", Package: "firefox", Module: "modules/browsers/firefox.nix", Hosts: []string{}}},
+		},
+		{
+			name: "host problems come first",
+			modules: map[string]string{
+				"browsers/firefox.nix": "# pam: attr=firefox version=1\nmkApp {\n  name = \"firefox\";\n}\n",
+			},
+			laptop: "{\n  apps = {\n    dev = {\n      git.enable = true;\n    };\n  };\n}\n",
+			want: []Issue{
+				{Kind: MissingModule, Category: "dev", Package: "git", Module: "modules/dev/git.nix", Hosts: []string{"laptop"}},
+				{Kind: UnusedModule, Category: "browsers", Package: "firefox", Module: "modules/browsers/firefox.nix", Hosts: []string{}},
+				{Kind: Unlocked, Category: "browsers", Package: "firefox", Module: "modules/browsers/firefox.nix", Hosts: []string{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			modulesDir := filepath.Join(root, "modules")
+			hostsDir := filepath.Join(root, "hosts")
+			if err := os.MkdirAll(modulesDir, 0o755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			for path, content := range tt.modules {
+				writeFile(t, filepath.Join(modulesDir, path), content)
+			}
+			writeFile(t, filepath.Join(hostsDir, "laptop", "configuration.nix"), tt.laptop)
+
+			got, err := Detect(Flake{
+				Path:       root,
+				ModulesDir: modulesDir,
+				HostsDir:   hostsDir,
+				// Hosts without an apps file are skipped
+				HostNames: []string{"laptop", "server"},
+				Lock:      &lockfile.Lock{Packages: tt.lock},
+			})
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Detect() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i].Kind != tt.want[i].Kind || got[i].Category != tt.want[i].Category || got[i].Package != tt.want[i].Package ||
+					got[i].Module != tt.want[i].Module || !slices.Equal(got[i].Hosts, tt.want[i].Hosts) {
+					t.Errorf("issue %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDetect_MissingModulesDir(t *testing.T) {
+	root := t.TempDir()
+	_, err := Detect(Flake{Path: root, ModulesDir: filepath.Join(root, "missing"), HostsDir: root, Lock: &lockfile.Lock{}})
+	if err == nil {
+		t.Error("Detect() expected error for missing modules directory")
+	}
+}
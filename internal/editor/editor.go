@@ -0,0 +1,168 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/logging"
+)
+
+// Candidates are tried in order when neither the config nor the environment names an editor
+var Candidates = []string{"nvim", "vim", "vi", "nano"}
+
+// waitFlags keeps GUI editors in the foreground until the file is closed, so pam
+// doesn't carry on (and commit) while the module is still being edited
+var waitFlags = map[string][]string{
+	"code":   {"--wait", "-w"},
+	"codium": {"--wait", "-w"},
+	"cursor": {"--wait", "-w"},
+	"zed":    {"--wait", "-w"},
+	"subl":   {"--wait", "-w"},
+	"atom":   {"--wait", "-w"},
+	"mate":   {"-w", "--wait"},
+	"gvim":   {"-f", "--nofork"},
+	"mvim":   {"-f", "--nofork"},
+	"gedit":  {"--wait"},
+	"kate":   {"--block", "-b"},
+}
+
+// terminalEditors take over the terminal and can't run without one
+var terminalEditors = map[string]bool{
+	"nvim": true, "vim": true, "vi": true, "nano": true, "hx": true, "helix": true,
+	"micro": true, "kak": true, "emacs": true, "ne": true, "joe": true, "mg": true,
+}
+
+// Editor is a resolved editor command
+type Editor struct {
+	// Command is the executable followed by its arguments, the files are appended to it
+	Command []string
+	// Terminal is true when the editor runs inside the terminal pam runs in
+	Terminal bool
+}
+
+// Split breaks an editor setting such as `code --wait` into words, honouring single
+// and double quotes so paths with spaces can be used
+func Split(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in editor command '%s'", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// withWait adds the wait flag a GUI editor needs unless the user already passed one
+func withWait(command []string) []string {
+	flags, ok := waitFlags[filepath.Base(command[0])]
+	if !ok {
+		return command
+	}
+	for _, arg := range command[1:] {
+		for _, flag := range flags {
+			if arg == flag {
+				return command
+			}
+		}
+	}
+	return append([]string{command[0], flags[0]}, command[1:]...)
+}
+
+// isTerminal reports whether the command runs inside the terminal. emacs does with -nw or
+// when there is no display to open a window on
+func isTerminal(command []string) bool {
+	name := filepath.Base(command[0])
+	if name == "emacs" {
+		for _, arg := range command[1:] {
+			if arg == "-nw" || arg == "--no-window-system" {
+				return true
+			}
+		}
+		return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+	}
+	return terminalEditors[name]
+}
+
+// Resolve picks the editor from the configured command, then $VISUAL, then $EDITOR, and
+// finally the first of Candidates that is installed. Settings naming an editor that isn't
+// installed are skipped.
+func Resolve(configured string, getenv func(string) string, lookPath func(string) (string, error)) (Editor, error) {
+	settings := []string{configured, getenv("VISUAL"), getenv("EDITOR")}
+	settings = append(settings, Candidates...)
+
+	var tried []string
+	for _, setting := range settings {
+		command, err := Split(setting)
+		if err != nil {
+			return Editor{}, err
+		}
+		if len(command) == 0 {
+			continue
+		}
+		tried = append(tried, command[0])
+		if _, err := lookPath(command[0]); err != nil {
+			continue
+		}
+		return Editor{Command: withWait(command), Terminal: isTerminal(command)}, nil
+	}
+	return Editor{}, fmt.Errorf("no editor found (tried %s), set editor in the pam config or $EDITOR", strings.Join(tried, ", "))
+}
+
+// Cmd returns the command opening files, attached to pam's standard streams
+func (e Editor) Cmd(files ...string) *exec.Cmd {
+	args := append(append([]string{}, e.Command[1:]...), files...)
+	cmd := exec.Command(e.Command[0], args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	logging.Command(cmd)
+	return cmd
+}
+
+// stdinIsTerminal reports whether pam was started from an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Open resolves the editor and waits until it is closed. Terminal editors are refused
+// when pam isn't attached to a terminal, as they would hang or garble the output.
+func Open(configured string, files ...string) error {
+	editor, err := Resolve(configured, os.Getenv, exec.LookPath)
+	if err != nil {
+		return err
+	}
+	if editor.Terminal && !stdinIsTerminal() {
+		return fmt.Errorf("%s needs a terminal, set editor in the pam config to a GUI editor such as `code --wait`", editor.Command[0])
+	}
+	return editor.Cmd(files...).Run()
+}
@@ -0,0 +1,113 @@
+package editor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", command: "nvim", want: []string{"nvim"}},
+		{name: "with args", command: "code --wait  -n", want: []string{"code", "--wait", "-n"}},
+		{name: "quoted path", command: `"/Applications/Sublime Text.app/subl" -w`, want: []string{"/Applications/Sublime Text.app/subl", "-w"}},
+		{name: "empty", command: "  ", want: nil},
+		{name: "unterminated", command: "'code --wait", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Split(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Split() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name         string
+		configured   string
+		env          map[string]string
+		installed    []string
+		want         string
+		wantTerminal bool
+		wantErr      bool
+	}{
+		{
+			name:       "config wins over the environment",
+			configured: "hx",
+			env:        map[string]string{"VISUAL": "code", "EDITOR": "vim"},
+			installed:  []string{"hx", "code", "vim"},
+			want:       "hx", wantTerminal: true,
+		},
+		{
+			name:      "visual before editor",
+			env:       map[string]string{"VISUAL": "code", "EDITOR": "vim"},
+			installed: []string{"code", "vim"},
+			want:      "code --wait",
+		},
+		{
+			name:      "existing wait flag is kept",
+			env:       map[string]string{"EDITOR": "subl -w"},
+			installed: []string{"subl"},
+			want:      "subl -w",
+		},
+		{
+			name:      "missing editor falls back",
+			env:       map[string]string{"EDITOR": "code"},
+			installed: []string{"vim"},
+			want:      "vim", wantTerminal: true,
+		},
+		{
+			name:    "nothing installed",
+			env:     map[string]string{"EDITOR": "code"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			lookPath := func(file string) (string, error) {
+				for _, installed := range tt.installed {
+					if installed == file {
+						return "/usr/bin/" + file, nil
+					}
+				}
+				return "", errors.New("not found")
+			}
+
+			got, err := Resolve(tt.configured, getenv, lookPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if strings.Join(got.Command, " ") != tt.want || got.Terminal != tt.wantTerminal {
+				t.Errorf("Resolve() = %q (terminal %v), want %q (terminal %v)", got.Command, got.Terminal, tt.want, tt.wantTerminal)
+			}
+		})
+	}
+}
+
+func TestEditor_Cmd(t *testing.T) {
+	editor := Editor{Command: []string{"code", "--wait"}}
+	cmd := editor.Cmd("a.nix", "b.nix")
+	if got := strings.Join(cmd.Args, " "); got != "code --wait a.nix b.nix" {
+		t.Errorf("Cmd() args = %q", got)
+	}
+	if len(editor.Command) != 2 {
+		t.Errorf("Cmd() modified the editor command: %q", editor.Command)
+	}
+}
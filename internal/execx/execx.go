@@ -0,0 +1,140 @@
+package execx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"pam/internal/logging"
+	"pam/internal/platform"
+)
+
+// Runner runs external programs such as nix, git and the rebuild tools. Code taking a
+// Runner can be tested with a Fake instead of the real binaries. Cancelling the context
+// interrupts the program.
+type Runner interface {
+	// LookPath finds the binary name in $PATH
+	LookPath(name string) (string, error)
+	// Output runs name and returns its standard output
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// CombinedOutput runs name, feeding it stdin when not nil, and returns its standard
+	// output and error interleaved
+	CombinedOutput(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error)
+	// Pipe runs name feeding it stdin and returns its standard output, its standard
+	// error goes to pam's so plugins can report progress
+	Pipe(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error)
+	// Start runs name in the background with its standard output written to stdout and
+	// its standard error to stderr, which may be the same writer
+	Start(ctx context.Context, stdout io.Writer, stderr io.Writer, name string, args ...string) (Process, error)
+	// Interactive runs name attached to pam's terminal, e.g. sudo asking for a password
+	Interactive(ctx context.Context, name string, args ...string) error
+}
+
+// Process is a command started with Runner.Start
+type Process interface {
+	// Wait blocks until the command exits and returns its error
+	Wait() error
+	// Interrupt asks the command to stop, like Ctrl-C
+	Interrupt() error
+}
+
+// Default runs the real binaries
+var Default Runner = Exec{}
+
+// killDelay is how long a cancelled command may take to exit after its interrupt before it is killed
+const killDelay = 5 * time.Second
+
+// Exec is the Runner executing real binaries, logging each command at debug level
+type Exec struct{}
+
+// command prepares name to be interrupted when ctx is done, and killed if that isn't enough
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = killDelay
+	logging.Command(cmd)
+	return cmd
+}
+
+// NotFoundError is returned for a program that isn't installed, with how to install it
+type NotFoundError struct {
+	Name string
+	Hint string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s was not found in PATH, %s", e.Name, e.Hint)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return exec.ErrNotFound
+}
+
+// notFound replaces the error of a program missing from PATH with a NotFoundError
+func notFound(name string, err error) error {
+	if !errors.Is(err, exec.ErrNotFound) {
+		return err
+	}
+	return &NotFoundError{Name: name, Hint: platform.InstallHint(name, platform.InWSL())}
+}
+
+func (Exec) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func (Exec) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	output, err := command(ctx, name, args...).Output()
+	return output, notFound(name, err)
+}
+
+func (Exec) CombinedOutput(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := command(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	output, err := cmd.CombinedOutput()
+	return output, notFound(name, err)
+}
+
+func (Exec) Pipe(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := command(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	return output, notFound(name, err)
+}
+
+func (Exec) Start(ctx context.Context, stdout io.Writer, stderr io.Writer, name string, args ...string) (Process, error) {
+	cmd := command(ctx, name, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, notFound(name, err)
+	}
+	return process{cmd}, nil
+}
+
+func (Exec) Interactive(ctx context.Context, name string, args ...string) error {
+	cmd := command(ctx, name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return notFound(name, cmd.Run())
+}
+
+type process struct {
+	cmd *exec.Cmd
+}
+
+func (p process) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p process) Interrupt() error {
+	return p.cmd.Process.Signal(os.Interrupt)
+}
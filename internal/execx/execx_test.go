@@ -0,0 +1,150 @@
+package execx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	ctx := context.Background()
+	runner := Exec{}
+	output, err := runner.Output(ctx, "sh", "-c", "echo out; echo err >&2")
+	if err != nil || string(output) != "out\n" {
+		t.Errorf("Output() = %q, %v, want only standard output", output, err)
+	}
+
+	output, err = runner.CombinedOutput(ctx, []byte("from stdin"), "sh", "-c", "cat; echo; echo err >&2")
+	if err != nil || string(output) != "from stdin\nerr\n" {
+		t.Errorf("CombinedOutput() = %q, %v", output, err)
+	}
+
+	var out, errOut bytes.Buffer
+	process, err := runner.Start(ctx, &out, &errOut, "sh", "-c", "echo started; echo failing >&2; exit 3")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := process.Wait(); err == nil || out.String() != "started\n" || errOut.String() != "failing\n" {
+		t.Errorf("Wait() = %v with output %q and %q, want exit status 3", err, out.String(), errOut.String())
+	}
+
+	if _, err := runner.LookPath("pam-no-such-binary"); err == nil {
+		t.Error("LookPath() found a missing binary")
+	}
+
+	_, err = runner.Output(ctx, "pam-no-such-binary")
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || notFound.Name != "pam-no-such-binary" || !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Output() of a missing binary error = %v, want a NotFoundError", err)
+	}
+}
+
+func TestFake(t *testing.T) {
+	fake := &Fake{
+		Responses: map[string]Response{
+			"nix search nixpkgs firefox --json": {Output: "{}"},
+			"nix":                               {Err: errors.New("exit status 1")},
+		},
+		Missing: []string{"brew"},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "exact command line", args: []string{"nix", "search", "nixpkgs", "firefox", "--json"}, want: "{}"},
+		{name: "name alone", args: []string{"nix", "eval", "--json"}, wantErr: true},
+		{name: "unexpected command", args: []string{"git", "status"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := fake.Output(context.Background(), tt.args[0], tt.args[1:]...)
+			if (err != nil) != tt.wantErr || string(output) != tt.want {
+				t.Errorf("Output() = %q, %v, want %q (error %v)", output, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	process, _ := fake.Start(context.Background(), &out, &out, "nix", "search", "nixpkgs", "firefox", "--json")
+	if err := process.Wait(); err != nil || out.String() != "{}" {
+		t.Errorf("Wait() = %v with output %q", err, out.String())
+	}
+
+	want := "nix search nixpkgs firefox --json,nix eval --json,git status,nix search nixpkgs firefox --json"
+	if got := strings.Join(fake.Calls(), ","); got != want {
+		t.Errorf("Calls() = %s, want %s", got, want)
+	}
+	if _, err := fake.LookPath("brew"); err == nil {
+		t.Error("LookPath() found a missing binary")
+	}
+	if _, err := fake.LookPath("nix"); err != nil {
+		t.Errorf("LookPath() error = %v", err)
+	}
+}
+
+func TestExec_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := Exec{}.Output(ctx, "sleep", "10")
+	if err == nil {
+		t.Fatal("Output() expected an error once cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > killDelay {
+		t.Errorf("Output() returned after %s, the command wasn't interrupted", elapsed)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	fake := &Fake{Responses: map[string]Response{
+		"nix search nixpkgs firefox --json": {Hang: true},
+		"nix flake metadata nixpkgs --json": {Output: "{}"},
+	}}
+	runner := WithTimeout(fake, 10*time.Millisecond)
+
+	_, err := runner.Output(context.Background(), "nix", "search", "nixpkgs", "firefox", "--json")
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "nix search nixpkgs firefox --json timed out after 10ms") {
+		t.Errorf("Output() error = %v, want a timeout", err)
+	}
+	if output, err := runner.Output(context.Background(), "nix", "flake", "metadata", "nixpkgs", "--json"); err != nil || string(output) != "{}" {
+		t.Errorf("Output() = %q, %v", output, err)
+	}
+
+	// A cancelled command isn't reported as timed out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := runner.Output(ctx, "nix", "search", "nixpkgs", "firefox", "--json"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Output() error = %v, want context.Canceled", err)
+	}
+
+	process, err := runner.Start(context.Background(), io.Discard, io.Discard, "nix", "search", "nixpkgs", "firefox", "--json")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := process.Wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want a timeout", err)
+	}
+
+	if WithTimeout(fake, 0) != Runner(fake) {
+		t.Error("WithTimeout() without a timeout wrapped the runner")
+	}
+}
+
+func TestFake_Interrupt(t *testing.T) {
+	fake := &Fake{Responses: map[string]Response{"nixos-rebuild": {Output: "building\n", Hang: true}}}
+	var out bytes.Buffer
+	process, _ := fake.Start(context.Background(), &out, &out, "nixos-rebuild", "switch")
+	time.AfterFunc(10*time.Millisecond, func() { process.Interrupt() })
+	if err := process.Wait(); err == nil || out.Len() != 0 {
+		t.Errorf("Wait() = %v with output %q, want the interrupt", err, out.String())
+	}
+}
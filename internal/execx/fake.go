@@ -0,0 +1,166 @@
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"pam/internal/platform"
+)
+
+var errInterrupted = errors.New("signal: interrupt")
+
+// Response is what a Fake answers a command with
+type Response struct {
+	Output string
+	// Stderr is written to the standard error writer of Start, before Output
+	Stderr string
+	Err    error
+	// Hang blocks the command until its context is done or it is interrupted, like a nix
+	// evaluation stuck on the network
+	Hang bool
+}
+
+// Fake is a Runner for tests. It records the commands it is asked to run and answers them
+// from Responses without executing anything.
+type Fake struct {
+	// Responses are keyed by the command line, the name and arguments joined by spaces.
+	// Commands without a response of their own get the one keyed by their name alone,
+	// or an error when there is none.
+	Responses map[string]Response
+	// Missing are the binaries LookPath doesn't find and that fail to run with a NotFoundError
+	Missing []string
+
+	mu    sync.Mutex
+	calls []string
+	// inputs holds the stdin last fed to each command line
+	inputs map[string][]byte
+}
+
+// Calls returns the command lines run so far
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// Input returns the standard input last fed to the command line, nil when it got none
+func (f *Fake) Input(line string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inputs[line]
+}
+
+// run answers a command, failing with the context's error once it is done
+func (f *Fake) run(ctx context.Context, name string, args []string) Response {
+	response := f.respond(name, args)
+	if response.Hang {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return Response{Err: err}
+	}
+	return response
+}
+
+func (f *Fake) respond(name string, args []string) Response {
+	line := strings.Join(append([]string{name}, args...), " ")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, line)
+	if slices.Contains(f.Missing, name) {
+		return Response{Err: &NotFoundError{Name: name, Hint: platform.InstallHint(name, false)}}
+	}
+	if response, ok := f.Responses[line]; ok {
+		return response
+	}
+	if response, ok := f.Responses[name]; ok {
+		return response
+	}
+	return Response{Err: fmt.Errorf("unexpected command %s", line)}
+}
+
+func (f *Fake) LookPath(name string) (string, error) {
+	if slices.Contains(f.Missing, name) {
+		return "", fmt.Errorf("exec: %q: executable file not found in $PATH", name)
+	}
+	return "/run/current-system/sw/bin/" + name, nil
+}
+
+func (f *Fake) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	response := f.run(ctx, name, args)
+	return []byte(response.Output), response.Err
+}
+
+func (f *Fake) CombinedOutput(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	f.feed(stdin, name, args)
+	response := f.run(ctx, name, args)
+	return []byte(response.Output), response.Err
+}
+
+func (f *Fake) Pipe(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	f.feed(stdin, name, args)
+	response := f.run(ctx, name, args)
+	return []byte(response.Output), response.Err
+}
+
+// feed remembers the standard input of a command for Input
+func (f *Fake) feed(stdin []byte, name string, args []string) {
+	if stdin == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.inputs == nil {
+		f.inputs = map[string][]byte{}
+	}
+	f.inputs[strings.Join(append([]string{name}, args...), " ")] = stdin
+}
+
+// Start writes the whole output of the response once the process is waited for
+func (f *Fake) Start(ctx context.Context, stdout io.Writer, stderr io.Writer, name string, args ...string) (Process, error) {
+	return &fakeProcess{ctx: ctx, stdout: stdout, stderr: stderr, response: f.respond(name, args), interrupted: make(chan struct{})}, nil
+}
+
+func (f *Fake) Interactive(ctx context.Context, name string, args ...string) error {
+	return f.run(ctx, name, args).Err
+}
+
+type fakeProcess struct {
+	ctx         context.Context
+	stdout      io.Writer
+	stderr      io.Writer
+	response    Response
+	interrupted chan struct{}
+	once        sync.Once
+}
+
+// Wait fails with errInterrupted after Interrupt, as a real command killed by the signal does
+func (p *fakeProcess) Wait() error {
+	if p.response.Hang {
+		select {
+		case <-p.ctx.Done():
+		case <-p.interrupted:
+		}
+	}
+	select {
+	case <-p.interrupted:
+		return errInterrupted
+	default:
+	}
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	io.WriteString(p.stderr, p.response.Stderr)
+	io.WriteString(p.stdout, p.response.Output)
+	return p.response.Err
+}
+
+func (p *fakeProcess) Interrupt() error {
+	p.once.Do(func() { close(p.interrupted) })
+	return nil
+}
@@ -0,0 +1,83 @@
+package execx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// timeoutRunner bounds every Output, CombinedOutput, Pipe and Start call of a Runner
+type timeoutRunner struct {
+	Runner
+	timeout time.Duration
+}
+
+// WithTimeout returns a Runner interrupting commands run with Output, CombinedOutput, Pipe
+// and Start that take longer than timeout, such as a nix evaluation hanging on the network.
+// Interactive is left unbounded, and rebuilds use a runner without a timeout since they
+// take as long as they take. A timeout of zero returns runner as is.
+func WithTimeout(runner Runner, timeout time.Duration) Runner {
+	if timeout <= 0 {
+		return runner
+	}
+	return timeoutRunner{Runner: runner, timeout: timeout}
+}
+
+// timedOut explains a call that ran out of time, keeping context.DeadlineExceeded in the chain
+func (r timeoutRunner) timedOut(ctx context.Context, err error, name string, args []string) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	command := strings.Join(append([]string{name}, args...), " ")
+	return fmt.Errorf("%s timed out after %s: %w", command, r.timeout, context.DeadlineExceeded)
+}
+
+func (r timeoutRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	output, err := r.Runner.Output(ctx, name, args...)
+	return output, r.timedOut(ctx, err, name, args)
+}
+
+func (r timeoutRunner) CombinedOutput(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	output, err := r.Runner.CombinedOutput(ctx, stdin, name, args...)
+	return output, r.timedOut(ctx, err, name, args)
+}
+
+func (r timeoutRunner) Pipe(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	output, err := r.Runner.Pipe(ctx, stdin, name, args...)
+	return output, r.timedOut(ctx, err, name, args)
+}
+
+func (r timeoutRunner) Start(ctx context.Context, stdout io.Writer, stderr io.Writer, name string, args ...string) (Process, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	process, err := r.Runner.Start(ctx, stdout, stderr, name, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return timedProcess{Process: process, ctx: ctx, cancel: cancel, runner: r, name: name, args: args}, nil
+}
+
+// timedProcess releases the timeout of a started command once it exits
+type timedProcess struct {
+	Process
+	ctx    context.Context
+	cancel context.CancelFunc
+	runner timeoutRunner
+	name   string
+	args   []string
+}
+
+func (p timedProcess) Wait() error {
+	err := p.Process.Wait()
+	err = p.runner.timedOut(p.ctx, err, p.name, p.args)
+	p.cancel()
+	return err
+}
@@ -0,0 +1,121 @@
+package flakelock
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FileName is the lock file nix keeps next to flake.nix
+const FileName = "flake.lock"
+
+// Locked is the revision an input of the flake is locked to
+type Locked struct {
+	Rev          string `json:"rev"`
+	NarHash      string `json:"narHash"`
+	LastModified int64  `json:"lastModified"`
+}
+
+// Short names the revision by its first seven characters, or by its hash for inputs
+// without one such as paths and tarballs
+func (l Locked) Short() string {
+	id := l.Rev
+	if id == "" {
+		id = strings.TrimPrefix(l.NarHash, "sha256-")
+	}
+	if len(id) > 7 {
+		return id[:7]
+	}
+	return id
+}
+
+// Date returns the day the revision was made, empty when unknown
+func (l Locked) Date() string {
+	if l.LastModified == 0 {
+		return ""
+	}
+	return time.Unix(l.LastModified, 0).UTC().Format("2006-01-02")
+}
+
+// Lock holds the revisions of the inputs flake.nix declares, by input name. Inputs that
+// follow another one aren't locked themselves and are left out.
+type Lock struct {
+	Inputs map[string]Locked
+}
+
+type lockFile struct {
+	Root  string `json:"root"`
+	Nodes map[string]struct {
+		// Inputs map names to a node, or to the path of the input they follow
+		Inputs map[string]json.RawMessage `json:"inputs"`
+		Locked Locked                     `json:"locked"`
+	} `json:"nodes"`
+}
+
+// Path returns the location of the flake.lock of the flake at flakePath
+func Path(flakePath string) string {
+	return filepath.Join(flakePath, FileName)
+}
+
+// Load reads the flake.lock of the flake. A missing file yields a lock without inputs.
+func Load(flakePath string) (*Lock, error) {
+	lock := &Lock{Inputs: map[string]Locked{}}
+	data, err := os.ReadFile(Path(flakePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return nil, err
+	}
+
+	var file lockFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", Path(flakePath), err)
+	}
+	root := file.Root
+	if root == "" {
+		root = "root"
+	}
+	for name, target := range file.Nodes[root].Inputs {
+		var node string
+		if json.Unmarshal(target, &node) != nil {
+			continue
+		}
+		lock.Inputs[name] = file.Nodes[node].Locked
+	}
+	return lock, nil
+}
+
+// Change is an input whose revision differs between two locks. Old is zero for an added
+// input and New for a removed one.
+type Change struct {
+	Input string
+	Old   Locked
+	New   Locked
+}
+
+// Diff returns the inputs whose revision changed from old to new, sorted by name
+func Diff(old *Lock, new *Lock) []Change {
+	names := slices.Sorted(maps.Keys(old.Inputs))
+	for name := range new.Inputs {
+		if _, ok := old.Inputs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var changes []Change
+	for _, name := range names {
+		before, after := old.Inputs[name], new.Inputs[name]
+		if before != after {
+			changes = append(changes, Change{Input: name, Old: before, New: after})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,103 @@
+package flakelock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLock(t *testing.T, dir string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write flake.lock: %v", err)
+	}
+}
+
+const oldLock = `{
+  "nodes": {
+    "home-manager": {
+      "inputs": { "nixpkgs": ["nixpkgs"] },
+      "locked": { "lastModified": 1717000000, "narHash": "sha256-hm", "owner": "nix-community", "repo": "home-manager", "rev": "1111111aaaa", "type": "github" }
+    },
+    "nixpkgs": {
+      "locked": { "lastModified": 1717200000, "narHash": "sha256-old", "owner": "NixOS", "repo": "nixpkgs", "rev": "2222222bbbb", "type": "github" }
+    },
+    "root": {
+      "inputs": { "home-manager": "home-manager", "nixpkgs": "nixpkgs" }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`
+
+const newLock = `{
+  "nodes": {
+    "home-manager": {
+      "inputs": { "nixpkgs": ["nixpkgs"] },
+      "locked": { "lastModified": 1717000000, "narHash": "sha256-hm", "owner": "nix-community", "repo": "home-manager", "rev": "1111111aaaa", "type": "github" }
+    },
+    "nixpkgs": {
+      "locked": { "lastModified": 1718000000, "narHash": "sha256-new", "owner": "NixOS", "repo": "nixpkgs", "rev": "3333333cccc", "type": "github" }
+    },
+    "secrets": {
+      "locked": { "lastModified": 1718100000, "narHash": "sha256-secrets", "path": "/srv/secrets", "type": "path" }
+    },
+    "root": {
+      "inputs": { "home-manager": "home-manager", "nixpkgs": "nixpkgs", "secrets": "secrets" }
+    }
+  },
+  "root": "root",
+  "version": 7
+}`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := Load(dir)
+	if err != nil || len(lock.Inputs) != 0 {
+		t.Fatalf("Load() without flake.lock = %v, %v", lock, err)
+	}
+
+	writeLock(t, dir, oldLock)
+	lock, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	nixpkgs := lock.Inputs["nixpkgs"]
+	if len(lock.Inputs) != 2 || nixpkgs.Short() != "2222222" || nixpkgs.Date() != "2024-06-01" {
+		t.Errorf("Load() inputs = %+v", lock.Inputs)
+	}
+
+	writeLock(t, dir, "{")
+	if _, err := Load(dir); err == nil {
+		t.Error("Load() accepted an invalid flake.lock")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	writeLock(t, dir, oldLock)
+	before, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLock(t, dir, newLock)
+	after, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Diff(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("Diff() = %+v, want nixpkgs and secrets", changes)
+	}
+	if changes[0].Input != "nixpkgs" || changes[0].Old.Short() != "2222222" || changes[0].New.Short() != "3333333" {
+		t.Errorf("Diff() nixpkgs = %+v", changes[0])
+	}
+	// Path inputs have no revision and are named by their hash
+	if changes[1].Input != "secrets" || changes[1].Old.Short() != "" || changes[1].New.Short() != "secrets" {
+		t.Errorf("Diff() secrets = %+v", changes[1])
+	}
+	if len(Diff(after, after)) != 0 {
+		t.Error("Diff() of a lock with itself found changes")
+	}
+}
@@ -0,0 +1,85 @@
+// Package flatpak finds the Flathub builds linux hosts install through the nix-flatpak
+// module instead of a nix package.
+package flatpak
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pam/internal/nixconfig"
+)
+
+// FlathubURL searches the apps of Flathub
+const FlathubURL = "https://flathub.org/api/v2/search"
+
+// Input is the flake providing services.flatpak.packages, and Module its NixOS module
+var (
+	Input  = nixconfig.Input{Name: "nix-flatpak", URL: "github:gmodena/nix-flatpak/?ref=latest"}
+	Module = "inputs.nix-flatpak.nixosModules.nix-flatpak"
+)
+
+// App is an app of Flathub
+type App struct {
+	ID      string `json:"app_id"`
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+}
+
+// Searcher searches Flathub
+type Searcher struct {
+	URL    string
+	Client *http.Client
+}
+
+// Search returns the apps of Flathub matching query
+func (s *Searcher) Search(ctx context.Context, query string) ([]App, error) {
+	body, err := json.Marshal(map[string]any{"query": query, "filters": []any{}})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("searching Flathub for %s: %w", query, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("searching Flathub for %s: %s", query, response.Status)
+	}
+
+	var result struct {
+		Hits []App `json:"hits"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return result.Hits, nil
+}
+
+// BestMatch returns the app named like the package name, or whose id ends in it, e.g.
+// org.mozilla.firefox for firefox. ok is false when none or several do.
+func BestMatch(apps []App, name string) (App, bool) {
+	var match App
+	found := 0
+	for _, app := range apps {
+		last := app.ID[strings.LastIndex(app.ID, ".")+1:]
+		if strings.EqualFold(app.Name, name) || strings.EqualFold(last, name) {
+			match = app
+			found++
+		}
+	}
+	return match, found == 1
+}
@@ -0,0 +1,68 @@
+package flatpak
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearcher_Search(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if body.Query != "firefox" {
+			w.Write([]byte(`{"hits": []}`))
+			return
+		}
+		w.Write([]byte(`{"hits": [{"app_id": "org.mozilla.firefox", "name": "Firefox", "summary": "Fast, Private & Safe Web Browser"}, {"app_id": "io.gitlab.librewolf-community", "name": "LibreWolf", "summary": "A custom version of Firefox"}]}`))
+	}))
+	defer server.Close()
+	searcher := &Searcher{URL: server.URL, Client: server.Client()}
+
+	apps, err := searcher.Search(context.Background(), "firefox")
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(apps) != 2 || apps[0].ID != "org.mozilla.firefox" || apps[0].Summary == "" {
+		t.Errorf("Search() = %+v", apps)
+	}
+	if apps, err := searcher.Search(context.Background(), "nothing"); err != nil || len(apps) != 0 {
+		t.Errorf("Search() without hits = %+v, %v", apps, err)
+	}
+
+	server.Close()
+	if _, err := searcher.Search(context.Background(), "firefox"); err == nil {
+		t.Error("Search() should fail when Flathub is unreachable")
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	apps := []App{
+		{ID: "org.mozilla.firefox", Name: "Firefox"},
+		{ID: "io.gitlab.librewolf-community", Name: "LibreWolf"},
+		{ID: "org.gimp.GIMP", Name: "GNU Image Manipulation Program"},
+	}
+	tests := []struct {
+		name   string
+		wantID string
+		ok     bool
+	}{
+		{name: "firefox", wantID: "org.mozilla.firefox", ok: true},
+		{name: "librewolf", wantID: "io.gitlab.librewolf-community", ok: true},
+		{name: "gimp", wantID: "org.gimp.GIMP", ok: true},
+		{name: "chromium"},
+	}
+	for _, tt := range tests {
+		app, ok := BestMatch(apps, tt.name)
+		if ok != tt.ok || (ok && app.ID != tt.wantID) {
+			t.Errorf("BestMatch(%q) = %+v, %v, want %s, %v", tt.name, app, ok, tt.wantID, tt.ok)
+		}
+	}
+}
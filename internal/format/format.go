@@ -0,0 +1,89 @@
+package format
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"pam/internal/editor"
+	"pam/internal/execx"
+)
+
+// Settings of the formatter key besides a command line
+const (
+	// Off leaves the files as pam wrote them, also the meaning of an empty setting
+	Off = "off"
+	// Auto takes the flake's formatter output, or the first known formatter installed
+	Auto = "auto"
+)
+
+// known are the formatters auto looks for when the flake has no formatter output
+var known = []string{"alejandra", "nixfmt", "nixpkgs-fmt"}
+
+// formatterOutput matches a formatter output in flake.nix, e.g. formatter.x86_64-linux = ...
+var formatterOutput = regexp.MustCompile(`(?m)^\s*formatter\s*(\.|=)`)
+
+// Command returns the command line formatting files for the formatter setting, with the
+// files to be appended. It is nil when formatting is off or auto finds no formatter.
+func Command(setting string, flakePath string, lookPath func(string) (string, error)) ([]string, error) {
+	switch setting {
+	case "", Off:
+		return nil, nil
+	case Auto:
+		if data, err := os.ReadFile(filepath.Join(flakePath, "flake.nix")); err == nil && formatterOutput.Match(data) {
+			return []string{"nix", "fmt", "--"}, nil
+		}
+		for _, name := range known {
+			if _, err := lookPath(name); err == nil {
+				return []string{name}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	command, err := editor.Split(setting)
+	if err != nil {
+		return nil, err
+	}
+	// nix fmt passes options after -- to the formatter
+	if len(command) == 2 && command[0] == "nix" && command[1] == "fmt" {
+		command = append(command, "--")
+	}
+	return command, nil
+}
+
+// Files runs command in the flake directory on the nix files among paths that still
+// exist, e.g. not the module of an uninstall. It returns the files it formatted.
+func Files(ctx context.Context, runner execx.Runner, flakePath string, command []string, paths []string) ([]string, error) {
+	if len(command) == 0 {
+		return nil, nil
+	}
+	var files []string
+	for _, path := range paths {
+		if filepath.Ext(path) != ".nix" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	// The flake directory is passed as an argument so it needs no quoting in the script
+	args := append([]string{"-c", "cd \"$1\" || exit 1\nshift\nexec \"$@\"", "pam-format", flakePath}, command...)
+	output, err := runner.CombinedOutput(ctx, nil, "sh", append(args, files...)...)
+	if err != nil {
+		text := strings.TrimSpace(string(output))
+		if text != "" {
+			return nil, fmt.Errorf("%s failed: %w\n%s", command[0], err, text)
+		}
+		return nil, fmt.Errorf("%s failed: %w", command[0], err)
+	}
+	return files, nil
+}
@@ -0,0 +1,99 @@
+package format
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestCommand(t *testing.T) {
+	plainFlake := t.TempDir()
+	if err := os.WriteFile(filepath.Join(plainFlake, "flake.nix"), []byte("{\n  outputs = { self }: { };\n}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+	formatterFlake := t.TempDir()
+	if err := os.WriteFile(filepath.Join(formatterFlake, "flake.nix"), []byte("{\n  outputs = { nixpkgs, ... }: {\n    formatter.x86_64-linux = nixpkgs.legacyPackages.x86_64-linux.alejandra;\n  };\n}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+	installed := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			if slices.Contains(names, name) {
+				return "/bin/" + name, nil
+			}
+			return "", errors.New("not found")
+		}
+	}
+
+	tests := []struct {
+		name     string
+		setting  string
+		flake    string
+		lookPath func(string) (string, error)
+		want     []string
+		wantErr  bool
+	}{
+		{name: "empty", setting: "", flake: plainFlake, lookPath: installed("alejandra"), want: nil},
+		{name: "off", setting: Off, flake: plainFlake, lookPath: installed("alejandra"), want: nil},
+		{name: "auto with flake formatter", setting: Auto, flake: formatterFlake, lookPath: installed(), want: []string{"nix", "fmt", "--"}},
+		{name: "auto with installed formatter", setting: Auto, flake: plainFlake, lookPath: installed("nixpkgs-fmt", "nixfmt"), want: []string{"nixfmt"}},
+		{name: "auto without formatter", setting: Auto, flake: plainFlake, lookPath: installed(), want: nil},
+		{name: "command line", setting: "alejandra -q", flake: plainFlake, lookPath: installed(), want: []string{"alejandra", "-q"}},
+		{name: "nix fmt", setting: "nix fmt", flake: plainFlake, lookPath: installed(), want: []string{"nix", "fmt", "--"}},
+		{name: "unterminated quote", setting: "nixfmt '", flake: plainFlake, lookPath: installed(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Command(tt.setting, tt.flake, tt.lookPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Command(%q) error = %v, wantErr %v", tt.setting, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Command(%q) = %v, want %v", tt.setting, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	flake := t.TempDir()
+	module := filepath.Join(flake, "firefox.nix")
+	if err := os.WriteFile(module, []byte("{ }\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	lock := filepath.Join(flake, "pam.lock.json")
+	if err := os.WriteFile(lock, []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	deleted := filepath.Join(flake, "removed.nix")
+
+	// The formatter runs in the flake and marks every file it gets
+	command := []string{"sh", "-c", `pwd > cwd; for f; do echo formatted >> "$f"; done`, "formatter"}
+	got, err := Files(context.Background(), execx.Exec{}, flake, command, []string{module, lock, deleted})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if !slices.Equal(got, []string{module}) {
+		t.Errorf("Files() formatted %v, want only the module", got)
+	}
+	if data, _ := os.ReadFile(module); !strings.HasSuffix(string(data), "formatted\n") {
+		t.Errorf("module = %q, want it formatted", data)
+	}
+	if data, _ := os.ReadFile(lock); strings.Contains(string(data), "formatted") {
+		t.Error("Files() formatted the lock file")
+	}
+	if data, _ := os.ReadFile(filepath.Join(flake, "cwd")); strings.TrimSpace(string(data)) != flake {
+		t.Errorf("formatter ran in %q, want %s", data, flake)
+	}
+
+	_, err = Files(context.Background(), execx.Exec{}, flake, []string{"sh", "-c", "echo bad indentation; exit 1", "formatter"}, []string{module})
+	if err == nil || !strings.Contains(err.Error(), "bad indentation") {
+		t.Errorf("Files() error = %v, want the formatter's output", err)
+	}
+}
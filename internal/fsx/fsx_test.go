@@ -0,0 +1,90 @@
+package fsx
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ripgrep.nix")
+	if err := WriteFileAtomic(path, []byte("new\n"), 0o640); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o640 {
+		t.Errorf("mode of a new file = %v, want 0640", info.Mode().Perm())
+	}
+
+	// An existing file keeps its mode
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("newer\n"), 0o644); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "newer\n" {
+		t.Errorf("content = %q, want %q", data, "newer\n")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
+
+func TestWriteFileAtomic_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "config.yaml")
+	link := filepath.Join(dir, "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("new\n"), 0o644); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the symlink was replaced by a file")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new\n" {
+		t.Errorf("content of the target = %q, want %q", data, "new\n")
+	}
+}
+
+func TestWriteAtomic_Failed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "configuration.nix")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("interrupted")
+	err := WriteAtomic(path, 0o644, func(w io.Writer) error {
+		w.Write([]byte("{ apps = {"))
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WriteAtomic() error = %v, want %v", err, failed)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old\n" {
+		t.Errorf("content after a failed write = %q, want the old content", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "file"), nil, 0o644); err == nil {
+		t.Error("WriteFileAtomic() into a missing directory should fail")
+	}
+}
@@ -0,0 +1,171 @@
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/generations"
+)
+
+// Profiles choose whose old generations are deleted
+const (
+	// ProfileUser holds the profiles of the user running pam, home-manager's included
+	ProfileUser = "user"
+	// ProfileSystem is the NixOS or nix-darwin system profile
+	ProfileSystem = "system"
+	// ProfileAll is every profile on the machine
+	ProfileAll = "all"
+)
+
+// Options choose what a garbage collection deletes
+type Options struct {
+	// Days deletes the generations older than this many days, 0 keeps every generation
+	Days int
+	// Profile is ProfileUser, ProfileSystem or ProfileAll
+	Profile string
+	// DryRun prints what would be deleted without deleting anything
+	DryRun bool
+}
+
+// ParseAge reads an age such as 30d or 30 as a number of days
+func ParseAge(age string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("invalid age '%s', use a number of days such as 30d", age)
+	}
+	return days, nil
+}
+
+// CheckProfile reports an error for a profile other than the known ones
+func CheckProfile(profile string) error {
+	switch profile {
+	case ProfileUser, ProfileSystem, ProfileAll:
+		return nil
+	}
+	return fmt.Errorf("unknown profile '%s', use %s, %s or %s", profile, ProfileUser, ProfileSystem, ProfileAll)
+}
+
+// Commands returns the commands deleting old generations and collecting the garbage, in
+// order. Those touching profiles of other users run through sudo unless root is set.
+func Commands(options Options, root bool) [][]string {
+	sudo := func(args ...string) []string {
+		if root {
+			return args
+		}
+		return append([]string{"sudo"}, args...)
+	}
+	collect := []string{"nix-collect-garbage"}
+	if options.Days > 0 {
+		collect = append(collect, "--delete-older-than", fmt.Sprintf("%dd", options.Days))
+	}
+	if options.DryRun {
+		collect = append(collect, "--dry-run")
+	}
+
+	switch options.Profile {
+	case ProfileSystem:
+		var commands [][]string
+		if options.Days > 0 {
+			deleteOld := []string{"nix-env", "--profile", generations.SystemProfile, "--delete-generations", fmt.Sprintf("%dd", options.Days)}
+			if options.DryRun {
+				deleteOld = append(deleteOld, "--dry-run")
+			}
+			commands = append(commands, sudo(deleteOld...))
+		}
+		if !options.DryRun {
+			commands = append(commands, sudo("nix-store", "--gc"))
+		}
+		return commands
+	case ProfileAll:
+		// nix-collect-garbage reaches every profile when run as root
+		return [][]string{sudo(collect...)}
+	default:
+		return [][]string{collect}
+	}
+}
+
+// freedPattern matches the summary nix prints after collecting garbage
+var freedPattern = regexp.MustCompile(`(\d+) store paths deleted, ([\d.]+ [KMGT]?i?B) freed`)
+
+// Freed returns the summary of the space a garbage collection reclaimed, such as
+// "1.20 GiB in 312 store paths", or "" when output has none
+func Freed(output []byte) string {
+	matches := freedPattern.FindAllSubmatch(output, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	last := matches[len(matches)-1]
+	return fmt.Sprintf("%s in %s store paths", last[2], last[1])
+}
+
+// pathInfoChunk is how many store paths one nix path-info call sizes
+const pathInfoChunk = 500
+
+// DeadSize estimates what collecting the garbage frees right now: the store paths no root
+// keeps alive and the sum of their sizes. Generations deleted along the way free more.
+func DeadSize(ctx context.Context, runner execx.Runner) (paths int, size int64, err error) {
+	output, err := runner.Output(ctx, "nix-store", "--gc", "--print-dead")
+	if err != nil {
+		return 0, 0, fmt.Errorf("listing dead store paths: %w", err)
+	}
+	dead := strings.Fields(string(output))
+	for start := 0; start < len(dead); start += pathInfoChunk {
+		chunk := dead[start:min(start+pathInfoChunk, len(dead))]
+		output, err := runner.Output(ctx, "nix", append([]string{"path-info", "--json"}, chunk...)...)
+		if err != nil {
+			return 0, 0, fmt.Errorf("sizing dead store paths: %w", err)
+		}
+		sizes, err := narSizes(output)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, s := range sizes {
+			size += s
+		}
+	}
+	return len(dead), size, nil
+}
+
+type pathInfo struct {
+	NarSize int64 `json:"narSize"`
+}
+
+// narSizes reads nix path-info --json, a list of paths in older nix versions and an
+// object keyed by path in newer ones
+func narSizes(output []byte) ([]int64, error) {
+	var infos []pathInfo
+	if err := json.Unmarshal(output, &infos); err != nil {
+		var byPath map[string]pathInfo
+		if err := json.Unmarshal(output, &byPath); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		for _, info := range byPath {
+			infos = append(infos, info)
+		}
+	}
+	sizes := make([]int64, len(infos))
+	for i, info := range infos {
+		sizes[i] = info.NarSize
+	}
+	return sizes, nil
+}
+
+// FormatSize prints a number of bytes the way nix does, e.g. 1.20 GiB
+func FormatSize(size int64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.2f %s", value, units[unit])
+}
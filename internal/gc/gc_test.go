@@ -0,0 +1,116 @@
+package gc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age     string
+		want    int
+		wantErr bool
+	}{
+		{age: "30d", want: 30},
+		{age: "7", want: 7},
+		{age: "0", want: 0},
+		{age: "a week", wantErr: true},
+		{age: "-3d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAge(tt.age)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAge(%q) = %d, %v", tt.age, got, err)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		root    bool
+		want    []string
+	}{
+		{name: "user keeps generations", options: Options{Profile: ProfileUser}, want: []string{"nix-collect-garbage"}},
+		{name: "user older than", options: Options{Profile: ProfileUser, Days: 30}, want: []string{"nix-collect-garbage --delete-older-than 30d"}},
+		{name: "user dry run", options: Options{Profile: ProfileUser, Days: 7, DryRun: true}, want: []string{"nix-collect-garbage --delete-older-than 7d --dry-run"}},
+		{
+			name:    "system",
+			options: Options{Profile: ProfileSystem, Days: 14},
+			want:    []string{"sudo nix-env --profile /nix/var/nix/profiles/system --delete-generations 14d", "sudo nix-store --gc"},
+		},
+		{name: "system as root", options: Options{Profile: ProfileSystem}, root: true, want: []string{"nix-store --gc"}},
+		{name: "system dry run", options: Options{Profile: ProfileSystem, Days: 14, DryRun: true}, want: []string{"sudo nix-env --profile /nix/var/nix/profiles/system --delete-generations 14d --dry-run"}},
+		{name: "all", options: Options{Profile: ProfileAll, Days: 30}, want: []string{"sudo nix-collect-garbage --delete-older-than 30d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, command := range Commands(tt.options, tt.root) {
+				got = append(got, strings.Join(command, " "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Commands() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreed(t *testing.T) {
+	output := []byte("removing old generations of profile /home/me/.local/state/nix/profiles/profile\nfinding garbage collector roots...\ndeleting unused links...\nnote: currently hard linking saves 12.00 MiB\n312 store paths deleted, 1228.80 MiB freed\n")
+	if got := Freed(output); got != "1228.80 MiB in 312 store paths" {
+		t.Errorf("Freed() = %q", got)
+	}
+	if got := Freed([]byte("nothing to do\n")); got != "" {
+		t.Errorf("Freed() without a summary = %q", got)
+	}
+}
+
+func TestDeadSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		pathInfo string
+	}{
+		{name: "list", pathInfo: `[{"path": "/nix/store/a-foo", "narSize": 1024}, {"path": "/nix/store/b-bar", "narSize": 2048}]`},
+		{name: "object", pathInfo: `{"/nix/store/a-foo": {"narSize": 1024}, "/nix/store/b-bar": {"narSize": 2048}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &execx.Fake{Responses: map[string]execx.Response{
+				"nix-store --gc --print-dead":                            {Output: "/nix/store/a-foo\n/nix/store/b-bar\n"},
+				"nix path-info --json /nix/store/a-foo /nix/store/b-bar": {Output: tt.pathInfo},
+			}}
+			paths, size, err := DeadSize(context.Background(), runner)
+			if err != nil {
+				t.Fatalf("DeadSize() error = %v", err)
+			}
+			if paths != 2 || size != 3072 {
+				t.Errorf("DeadSize() = %d paths, %d bytes", paths, size)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 512, want: "512 B"},
+		{size: 3072, want: "3.00 KiB"},
+		{size: 1288490189, want: "1.20 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatSize(tt.size); got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
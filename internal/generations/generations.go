@@ -0,0 +1,169 @@
+package generations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pam/internal/execx"
+	"pam/internal/rebuild"
+)
+
+// SystemProfile is where NixOS and nix-darwin keep the system generations
+const SystemProfile = "/nix/var/nix/profiles/system"
+
+// Generation is one system generation of a host
+type Generation struct {
+	ID      int       `json:"id"`
+	Date    time.Time `json:"date"`
+	Current bool      `json:"current"`
+	// Size is the closure size in bytes, 0 when unknown
+	Size int64 `json:"size"`
+}
+
+// Link returns the profile link of the generation, e.g. /nix/var/nix/profiles/system-42-link
+func (g Generation) Link() string {
+	return fmt.Sprintf("%s-%d-link", SystemProfile, g.ID)
+}
+
+// generationPattern matches a line of nix-env --list-generations, e.g.
+// "  42   2024-06-01 12:34:56   (current)"
+var generationPattern = regexp.MustCompile(`^\s*(\d+)\s+(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\s*(\(current\))?\s*$`)
+
+// Parse reads the output of nix-env --list-generations
+func Parse(output []byte) ([]Generation, error) {
+	var generations []Generation
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		match := generationPattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("unexpected line in the generation list: %q", line)
+		}
+		id, _ := strconv.Atoi(match[1])
+		date, err := time.ParseInLocation("2006-01-02 15:04:05", match[2], time.Local)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, Generation{ID: id, Date: date, Current: match[3] != ""})
+	}
+	return generations, nil
+}
+
+// Remote returns the prefix running a command on the host at an ssh target, nil for this machine
+func Remote(target string) []string {
+	if target == "" {
+		return nil
+	}
+	return []string{"ssh", target}
+}
+
+// run runs args on this machine, or through the remote prefix
+func run(ctx context.Context, runner execx.Runner, remote []string, args ...string) ([]byte, error) {
+	command := append(append([]string{}, remote...), args...)
+	return runner.Output(ctx, command[0], command[1:]...)
+}
+
+// List returns the system generations, oldest first, on this machine or through the
+// remote prefix
+func List(ctx context.Context, runner execx.Runner, remote []string) ([]Generation, error) {
+	output, err := run(ctx, runner, remote, "nix-env", "--list-generations", "--profile", SystemProfile)
+	if err != nil {
+		return nil, fmt.Errorf("listing system generations: %w", err)
+	}
+	return Parse(output)
+}
+
+// Sizes fills in the closure size of every generation
+func Sizes(ctx context.Context, runner execx.Runner, remote []string, generations []Generation) error {
+	if len(generations) == 0 {
+		return nil
+	}
+	// path-info reports the store paths the links point at, readlink keeps them in order
+	links := []string{"readlink", "-f"}
+	for _, generation := range generations {
+		links = append(links, generation.Link())
+	}
+	output, err := run(ctx, runner, remote, links...)
+	if err != nil {
+		return fmt.Errorf("resolving generation links: %w", err)
+	}
+	paths := strings.Fields(string(output))
+	if len(paths) != len(generations) {
+		return fmt.Errorf("readlink resolved %d of %d generations", len(paths), len(generations))
+	}
+
+	output, err = run(ctx, runner, remote, append([]string{"nix", "path-info", "--json", "--closure-size"}, paths...)...)
+	if err != nil {
+		return fmt.Errorf("sizing generations: %w", err)
+	}
+	sizes, err := closureSizes(output)
+	if err != nil {
+		return err
+	}
+	for i, path := range paths {
+		generations[i].Size = sizes[path]
+	}
+	return nil
+}
+
+type pathInfo struct {
+	Path        string `json:"path"`
+	ClosureSize int64  `json:"closureSize"`
+}
+
+// closureSizes reads nix path-info --json, a list of paths in older nix versions and an
+// object keyed by path in newer ones
+func closureSizes(output []byte) (map[string]int64, error) {
+	sizes := map[string]int64{}
+	var infos []pathInfo
+	if err := json.Unmarshal(output, &infos); err == nil {
+		for _, info := range infos {
+			sizes[info.Path] = info.ClosureSize
+		}
+		return sizes, nil
+	}
+	var byPath map[string]pathInfo
+	if err := json.Unmarshal(output, &byPath); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	for path, info := range byPath {
+		sizes[path] = info.ClosureSize
+	}
+	return sizes, nil
+}
+
+// RollbackCommands return the commands switching a host back to the previous system
+// generation, or to generation to when it isn't 0. Activating needs root, so sudo is
+// prepended unless root is set.
+func RollbackCommands(platform rebuild.Platform, to int, root bool) ([][]string, error) {
+	var commands [][]string
+	switch {
+	case platform == rebuild.HomeManager:
+		return nil, fmt.Errorf("home-manager has no system generations, activate an older one listed by home-manager generations instead")
+	case to == 0 && platform == rebuild.Darwin:
+		commands = [][]string{{"darwin-rebuild", "switch", "--rollback"}}
+	case to == 0:
+		commands = [][]string{{"nixos-rebuild", "switch", "--rollback"}}
+	default:
+		activate := []string{SystemProfile + "/bin/switch-to-configuration", "switch"}
+		if platform == rebuild.Darwin {
+			activate = []string{SystemProfile + "/activate"}
+		}
+		commands = [][]string{
+			{"nix-env", "--profile", SystemProfile, "--switch-generation", strconv.Itoa(to)},
+			activate,
+		}
+	}
+	if !root {
+		for i := range commands {
+			commands[i] = append([]string{"sudo"}, commands[i]...)
+		}
+	}
+	return commands, nil
+}
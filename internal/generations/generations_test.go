@@ -0,0 +1,97 @@
+package generations
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+	"pam/internal/rebuild"
+)
+
+const listOutput = `  41   2024-05-20 09:12:03
+  42   2024-06-01 12:34:56   (current)
+`
+
+func TestParse(t *testing.T) {
+	found, err := Parse([]byte(listOutput))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(found) != 2 || found[0].ID != 41 || found[0].Current || found[1].ID != 42 || !found[1].Current {
+		t.Errorf("Parse() = %+v", found)
+	}
+	if got := found[1].Date.Format("2006-01-02 15:04"); got != "2024-06-01 12:34" {
+		t.Errorf("Parse() date = %s", got)
+	}
+
+	if _, err := Parse([]byte("error: no profile\n")); err == nil {
+		t.Error("Parse() accepted an unexpected line")
+	}
+}
+
+func TestListAndSizes(t *testing.T) {
+	links := "/nix/var/nix/profiles/system-41-link /nix/var/nix/profiles/system-42-link"
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"ssh root@pi nix-env --list-generations --profile /nix/var/nix/profiles/system": {Output: listOutput},
+		"ssh root@pi readlink -f " + links:                                              {Output: "/nix/store/aaa-nixos-system\n/nix/store/bbb-nixos-system\n"},
+		"ssh root@pi nix path-info --json --closure-size /nix/store/aaa-nixos-system /nix/store/bbb-nixos-system": {
+			Output: `{"/nix/store/bbb-nixos-system": {"closureSize": 2048}, "/nix/store/aaa-nixos-system": {"closureSize": 1024}}`,
+		},
+	}}
+
+	found, err := List(context.Background(), runner, Remote("root@pi"))
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err := Sizes(context.Background(), runner, Remote("root@pi"), found); err != nil {
+		t.Fatalf("Sizes() error = %v", err)
+	}
+	if found[0].Size != 1024 || found[1].Size != 2048 {
+		t.Errorf("Sizes() = %+v", found)
+	}
+}
+
+func TestRollbackCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform rebuild.Platform
+		to       int
+		root     bool
+		want     []string
+		wantErr  bool
+	}{
+		{name: "nixos previous", platform: rebuild.NixOS, want: []string{"sudo nixos-rebuild switch --rollback"}},
+		{name: "darwin previous as root", platform: rebuild.Darwin, root: true, want: []string{"darwin-rebuild switch --rollback"}},
+		{
+			name:     "nixos generation",
+			platform: rebuild.NixOS,
+			to:       41,
+			want:     []string{"sudo nix-env --profile /nix/var/nix/profiles/system --switch-generation 41", "sudo /nix/var/nix/profiles/system/bin/switch-to-configuration switch"},
+		},
+		{
+			name:     "darwin generation",
+			platform: rebuild.Darwin,
+			to:       41,
+			root:     true,
+			want:     []string{"nix-env --profile /nix/var/nix/profiles/system --switch-generation 41", "/nix/var/nix/profiles/system/activate"},
+		},
+		{name: "home-manager", platform: rebuild.HomeManager, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := RollbackCommands(tt.platform, tt.to, tt.root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RollbackCommands() error = %v", err)
+			}
+			var got []string
+			for _, command := range commands {
+				got = append(got, strings.Join(command, " "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("RollbackCommands() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pam/internal/execx"
+)
+
+// Runner executes git with the given arguments inside dir and returns its output
+type Runner func(dir string, args ...string) ([]byte, error)
+
+// ExecRunner runs the real git binary
+func ExecRunner(dir string, args ...string) ([]byte, error) {
+	return execx.Default.Output(context.Background(), "git", append([]string{"-C", dir}, args...)...)
+}
+
+type Repo struct {
+	dir string
+	run Runner
+}
+
+func NewRepo(dir string) *Repo {
+	return NewRepoWithRunner(dir, ExecRunner)
+}
+
+func NewRepoWithRunner(dir string, run Runner) *Repo {
+	return &Repo{dir: dir, run: run}
+}
+
+// IsRepo reports whether the directory is inside a git work tree.
+// A missing git binary is treated the same as not being a repository.
+func (r *Repo) IsRepo() bool {
+	output, err := r.run(r.dir, "rev-parse", "--is-inside-work-tree")
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(output)) == "true"
+}
+
+// Untracked returns the given paths that git does not know about yet.
+// Flakes only see tracked files, so these will be invisible to nix until added.
+func (r *Repo) Untracked(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"ls-files", "--others", "--exclude-standard", "--full-name", "--"}, paths...)
+	output, err := r.run(r.dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	var untracked []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			untracked = append(untracked, line)
+		}
+	}
+	return untracked, nil
+}
+
+// Diff returns the working tree diff of the changed and added paths.
+// Untracked added paths are marked with git add --intent-to-add first so they show up as new
+// files, and added paths are also diffed against the index so files that were already staged
+// show up.
+func (r *Repo) Diff(changed []string, added []string) (string, error) {
+	paths := append(append([]string{}, changed...), added...)
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	untracked, err := r.Untracked(added)
+	if err != nil {
+		return "", err
+	}
+	if len(untracked) > 0 {
+		// ls-files lists the paths from the top of the repository, which may be above the flake
+		args := []string{"add", "--intent-to-add", "--"}
+		for _, path := range untracked {
+			args = append(args, ":(top)"+path)
+		}
+		_, err := r.run(r.dir, args...)
+		if err != nil {
+			return "", fmt.Errorf("git add: %w", err)
+		}
+	}
+
+	output, err := r.run(r.dir, append([]string{"diff", "--"}, paths...)...)
+	if err != nil {
+		return "", err
+	}
+	diff := string(output)
+
+	if len(added) > 0 {
+		staged, err := r.run(r.dir, append([]string{"diff", "--staged", "--"}, added...)...)
+		if err != nil {
+			return "", err
+		}
+		diff += string(staged)
+	}
+	return diff, nil
+}
+
+// Commit stages paths, including deletions, and commits only those paths with message.
+// Other changes that are already staged are left out of the commit.
+func (r *Repo) Commit(message string, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	_, err := r.run(r.dir, append([]string{"add", "-A", "--"}, paths...)...)
+	if err != nil {
+		return fmt.Errorf("git add: %w", err)
+	}
+	_, err = r.run(r.dir, append([]string{"commit", "-m", message, "--"}, paths...)...)
+	if err != nil {
+		return fmt.Errorf("git commit: %w", err)
+	}
+	return nil
+}
+
+// CommitMessage formats the message pam commits its changes with, e.g.
+// "pam: add firefox to browsers (hosts: laptop, desktop)"
+func CommitMessage(summary string, hosts []string) string {
+	message := "pam: " + summary
+	if len(hosts) > 0 {
+		message += fmt.Sprintf(" (hosts: %s)", strings.Join(hosts, ", "))
+	}
+	return message
+}
+
+// Status returns the paths with uncommitted changes, untracked files included,
+// as reported by `git status --porcelain`
+func (r *Repo) Status() ([]string, error) {
+	output, err := r.run(r.dir, "status", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		paths = append(paths, line[3:])
+	}
+	return paths, nil
+}
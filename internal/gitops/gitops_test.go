@@ -0,0 +1,229 @@
+package gitops
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeGit struct {
+	calls   [][]string
+	outputs map[string]string
+	err     error
+}
+
+func (f *fakeGit) run(dir string, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, append([]string{dir}, args...))
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(f.outputs[strings.Join(args, " ")]), nil
+}
+
+func TestRepo_IsRepo(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		err    error
+		want   bool
+	}{
+		{
+			name:   "inside work tree",
+			output: "true\n",
+			want:   true,
+		},
+		{
+			name:   "bare or outside work tree",
+			output: "false\n",
+			want:   false,
+		},
+		{
+			name: "git missing or not a repo",
+			err:  errors.New("exec: \"git\": executable file not found in $PATH"),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGit{
+				outputs: map[string]string{"rev-parse --is-inside-work-tree": tt.output},
+				err:     tt.err,
+			}
+			repo := NewRepoWithRunner("/flake", fake.run)
+
+			if got := repo.IsRepo(); got != tt.want {
+				t.Errorf("IsRepo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepo_Untracked(t *testing.T) {
+	fake := &fakeGit{
+		outputs: map[string]string{
+			"ls-files --others --exclude-standard --full-name -- /flake/modules/apps/browsers/firefox.nix /flake/hosts/laptop/configuration.nix": "modules/apps/browsers/firefox.nix\n",
+		},
+	}
+	repo := NewRepoWithRunner("/flake", fake.run)
+
+	got, err := repo.Untracked([]string{"/flake/modules/apps/browsers/firefox.nix", "/flake/hosts/laptop/configuration.nix"})
+	if err != nil {
+		t.Fatalf("Untracked() error = %v", err)
+	}
+	if len(got) != 1 || got[0] != "modules/apps/browsers/firefox.nix" {
+		t.Errorf("Untracked() = %v, want [modules/apps/browsers/firefox.nix]", got)
+	}
+}
+
+func TestRepo_Diff(t *testing.T) {
+	tests := []struct {
+		name      string
+		changed   []string
+		added     []string
+		untracked string
+		wantCalls []string
+	}{
+		{
+			name:      "only changed files",
+			changed:   []string{"/flake/hosts/laptop/configuration.nix"},
+			wantCalls: []string{"diff -- /flake/hosts/laptop/configuration.nix"},
+		},
+		{
+			name:    "changed and added files",
+			changed: []string{"/flake/hosts/laptop/configuration.nix", "/flake/hosts/desktop/configuration.nix"},
+			added:   []string{"/flake/modules/apps/browsers/firefox.nix"},
+			wantCalls: []string{
+				"ls-files --others --exclude-standard --full-name -- /flake/modules/apps/browsers/firefox.nix",
+				"diff -- /flake/hosts/laptop/configuration.nix /flake/hosts/desktop/configuration.nix /flake/modules/apps/browsers/firefox.nix",
+				"diff --staged -- /flake/modules/apps/browsers/firefox.nix",
+			},
+		},
+		{
+			name:      "new untracked module",
+			changed:   []string{"/flake/hosts/laptop/configuration.nix"},
+			added:     []string{"/flake/modules/apps/browsers/firefox.nix", "/flake/modules/apps/cli/ripgrep.nix"},
+			untracked: "modules/apps/browsers/firefox.nix\n",
+			wantCalls: []string{
+				"ls-files --others --exclude-standard --full-name -- /flake/modules/apps/browsers/firefox.nix /flake/modules/apps/cli/ripgrep.nix",
+				"add --intent-to-add -- :(top)modules/apps/browsers/firefox.nix",
+				"diff -- /flake/hosts/laptop/configuration.nix /flake/modules/apps/browsers/firefox.nix /flake/modules/apps/cli/ripgrep.nix",
+				"diff --staged -- /flake/modules/apps/browsers/firefox.nix /flake/modules/apps/cli/ripgrep.nix",
+			},
+		},
+		{
+			name:      "nothing to diff",
+			wantCalls: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGit{outputs: map[string]string{
+				"ls-files --others --exclude-standard --full-name -- " + strings.Join(tt.added, " "): tt.untracked,
+			}}
+			repo := NewRepoWithRunner("/flake", fake.run)
+
+			_, err := repo.Diff(tt.changed, tt.added)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+
+			if len(fake.calls) != len(tt.wantCalls) {
+				t.Fatalf("Diff() ran git %d times, want %d: %v", len(fake.calls), len(tt.wantCalls), fake.calls)
+			}
+			for i, call := range fake.calls {
+				if call[0] != "/flake" {
+					t.Errorf("git call %d ran in %q, want /flake", i, call[0])
+				}
+				got := strings.Join(call[1:], " ")
+				if got != tt.wantCalls[i] {
+					t.Errorf("git call %d = %q, want %q", i, got, tt.wantCalls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRepo_Commit(t *testing.T) {
+	fake := &fakeGit{}
+	repo := NewRepoWithRunner("/flake", fake.run)
+
+	err := repo.Commit("pam: add firefox to browsers", "/flake/modules/apps/browsers/firefox.nix", "/flake/hosts/laptop/configuration.nix")
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	want := []string{
+		"/flake add -A -- /flake/modules/apps/browsers/firefox.nix /flake/hosts/laptop/configuration.nix",
+		"/flake commit -m pam: add firefox to browsers -- /flake/modules/apps/browsers/firefox.nix /flake/hosts/laptop/configuration.nix",
+	}
+	if len(fake.calls) != len(want) {
+		t.Fatalf("ran %d git commands, want %d: %v", len(fake.calls), len(want), fake.calls)
+	}
+	for i, call := range fake.calls {
+		if got := strings.Join(call, " "); got != want[i] {
+			t.Errorf("call %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	fake.calls = nil
+	if err := repo.Commit("pam: nothing"); err != nil || len(fake.calls) != 0 {
+		t.Errorf("Commit() without paths ran %v, error = %v", fake.calls, err)
+	}
+
+	fake.err = errors.New("exit status 1")
+	if err := repo.Commit("pam: add vim", "/flake/vim.nix"); err == nil {
+		t.Error("Commit() expected error when git fails")
+	}
+}
+
+func TestRepo_Status(t *testing.T) {
+	fake := &fakeGit{outputs: map[string]string{
+		"status --porcelain": " M hosts/laptop/configuration.nix\n?? modules/apps/browsers/firefox.nix\n",
+	}}
+	repo := NewRepoWithRunner("/flake", fake.run)
+
+	paths, err := repo.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	want := "hosts/laptop/configuration.nix,modules/apps/browsers/firefox.nix"
+	if got := strings.Join(paths, ","); got != want {
+		t.Errorf("Status() = %v, want %v", got, want)
+	}
+
+	fake.outputs = nil
+	if paths, err := repo.Status(); err != nil || len(paths) != 0 {
+		t.Errorf("Status() of a clean tree = %v, error = %v", paths, err)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary string
+		hosts   []string
+		want    string
+	}{
+		{
+			name:    "with hosts",
+			summary: "add firefox to browsers",
+			hosts:   []string{"laptop", "desktop"},
+			want:    "pam: add firefox to browsers (hosts: laptop, desktop)",
+		},
+		{
+			name:    "without hosts",
+			summary: "update firefox to 121.0",
+			want:    "pam: update firefox to 121.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CommitMessage(tt.summary, tt.hosts); got != tt.want {
+				t.Errorf("CommitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pam/internal/fsx"
+)
+
+// MaxEntries bounds how many operations are remembered
+const MaxEntries = 200
+
+// Install is the command of install entries
+const Install = "install"
+
+// Entry is a completed operation that can be repeated. Installs keep what they installed,
+// other commands the arguments re-running them.
+type Entry struct {
+	// Command is the pam command, e.g. uninstall or input add. Entries written before
+	// other commands were recorded are installs without one.
+	Command string `json:"command,omitempty"`
+	// Args re-run the operation after the command, e.g. firefox --host laptop
+	Args []string `json:"args,omitempty"`
+	// Summary describes what the operation did
+	Summary  string    `json:"summary,omitempty"`
+	Query    string    `json:"query,omitempty"`
+	Package  string    `json:"package,omitempty"`
+	Attr     string    `json:"attr,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Hosts    []string  `json:"hosts,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// IsInstall reports whether the entry is an install
+func (e Entry) IsInstall() bool {
+	return e.Command == "" || e.Command == Install
+}
+
+// Label formats the entry for display in selection UI
+func (e Entry) Label() string {
+	if !e.IsInstall() {
+		if e.Summary != "" {
+			return e.Summary
+		}
+		return strings.Join(e.CommandLine(), " ")
+	}
+	label := fmt.Sprintf("install %s → %s", e.Query, e.Category)
+	if len(e.Hosts) > 0 {
+		label += fmt.Sprintf(" on %s", strings.Join(e.Hosts, ", "))
+	}
+	return label
+}
+
+// CommandLine returns the pam arguments repeating the operation. An install is repeated
+// with the same package, category and hosts.
+func (e Entry) CommandLine() []string {
+	if !e.IsInstall() {
+		return append(strings.Fields(e.Command), e.Args...)
+	}
+	args := []string{Install, e.Query}
+	if e.Attr != "" {
+		args = append(args, "--attr", e.Attr)
+	}
+	if e.Category != "" {
+		args = append(args, "--category", e.Category)
+	}
+	for _, host := range e.Hosts {
+		args = append(args, "--host", host)
+	}
+	return args
+}
+
+type History struct {
+	path    string
+	max     int
+	Entries []Entry `json:"entries"`
+}
+
+// DefaultPath returns the history file location inside the pam state directory
+func DefaultPath(stateDir string) string {
+	return filepath.Join(stateDir, "history.json")
+}
+
+// Load reads the history at path. A missing file yields an empty history.
+func Load(path string, max int) (*History, error) {
+	h := &History{path: path, max: max}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse history %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Append records an entry, dropping the oldest ones beyond the size bound
+func (h *History) Append(entry Entry) {
+	h.Entries = append(h.Entries, entry)
+	if h.max > 0 && len(h.Entries) > h.max {
+		h.Entries = h.Entries[len(h.Entries)-h.max:]
+	}
+}
+
+// Recent returns the entries newest first
+func (h *History) Recent() []Entry {
+	recent := make([]Entry, len(h.Entries))
+	for i, entry := range h.Entries {
+		recent[len(h.Entries)-1-i] = entry
+	}
+	return recent
+}
+
+// Installs returns the install entries newest first
+func (h *History) Installs() []Entry {
+	var installs []Entry
+	for _, entry := range h.Recent() {
+		if entry.IsInstall() {
+			installs = append(installs, entry)
+		}
+	}
+	return installs
+}
+
+// LastSet returns the package set, such as vimPlugins, of the latest install into category
+// whose package came from one, e.g. vimPlugins for vimPlugins.telescope-nvim
+func (h *History) LastSet(category string) (string, bool) {
+	for _, entry := range h.Installs() {
+		dot := strings.LastIndex(entry.Attr, ".")
+		if entry.Category == category && dot > 0 {
+			return entry.Attr[:dot], true
+		}
+	}
+	return "", false
+}
+
+// Last returns the most recent entry
+func (h *History) Last() (Entry, bool) {
+	if len(h.Entries) == 0 {
+		return Entry{}, false
+	}
+	return h.Entries[len(h.Entries)-1], true
+}
+
+func (h *History) Save() error {
+	err := os.MkdirAll(filepath.Dir(h.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsx.WriteFileAtomic(h.path, data, 0o644)
+}
+
+// Clear forgets all entries and removes the history file
+func (h *History) Clear() error {
+	h.Entries = nil
+	err := os.Remove(h.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	h, err := Load(filepath.Join(t.TempDir(), "history.json"), MaxEntries)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(h.Entries) != 0 {
+		t.Errorf("Load() returned %d entries, want 0", len(h.Entries))
+	}
+	if _, ok := h.Last(); ok {
+		t.Error("Last() ok = true on empty history")
+	}
+}
+
+func TestHistory_AppendAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history.json")
+
+	h, err := Load(path, MaxEntries)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	h.Append(Entry{Query: "firefox", Category: "browsers", Hosts: []string{"laptop"}, Time: time.Now()})
+	h.Append(Entry{Query: "vim", Category: "editors", Hosts: []string{"laptop", "desktop"}, Time: time.Now()})
+
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path, MaxEntries)
+	if err != nil {
+		t.Fatalf("Load() after Save() error = %v", err)
+	}
+	if len(loaded.Entries) != 2 {
+		t.Fatalf("Load() returned %d entries, want 2", len(loaded.Entries))
+	}
+
+	last, ok := loaded.Last()
+	if !ok || last.Query != "vim" {
+		t.Errorf("Last() = %q, want vim", last.Query)
+	}
+
+	recent := loaded.Recent()
+	if recent[0].Query != "vim" || recent[1].Query != "firefox" {
+		t.Errorf("Recent() = [%s %s], want [vim firefox]", recent[0].Query, recent[1].Query)
+	}
+}
+
+func TestHistory_AppendBounded(t *testing.T) {
+	h, err := Load(filepath.Join(t.TempDir(), "history.json"), 3)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		h.Append(Entry{Query: fmt.Sprintf("pkg%d", i)})
+	}
+
+	if len(h.Entries) != 3 {
+		t.Fatalf("Append() kept %d entries, want 3", len(h.Entries))
+	}
+	if h.Entries[0].Query != "pkg2" {
+		t.Errorf("oldest entry = %q, want pkg2", h.Entries[0].Query)
+	}
+	if last, _ := h.Last(); last.Query != "pkg4" {
+		t.Errorf("Last() = %q, want pkg4", last.Query)
+	}
+}
+
+func TestHistory_Clear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	h, err := Load(path, MaxEntries)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	h.Append(Entry{Query: "firefox"})
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := h.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if len(h.Entries) != 0 {
+		t.Errorf("Clear() left %d entries", len(h.Entries))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Clear() did not remove the history file")
+	}
+
+	// Clearing an already empty history is not an error
+	if err := h.Clear(); err != nil {
+		t.Errorf("Clear() on empty history error = %v", err)
+	}
+}
+
+func TestLoad_InvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+
+	if _, err := Load(path, MaxEntries); err == nil {
+		t.Error("Load() expected error for invalid JSON, got nil")
+	}
+}
+
+func TestEntry_Label(t *testing.T) {
+	tests := []struct {
+		entry Entry
+		want  string
+	}{
+		{Entry{Query: "firefox", Category: "browsers", Hosts: []string{"laptop", "desktop"}}, "install firefox → browsers on laptop, desktop"},
+		{Entry{Command: "uninstall", Args: []string{"firefox"}, Summary: "remove firefox from browsers"}, "remove firefox from browsers"},
+		{Entry{Command: "input add", Args: []string{"github:nix-community/nur"}}, "input add github:nix-community/nur"},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.Label(); got != tt.want {
+			t.Errorf("Label() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestEntry_CommandLine(t *testing.T) {
+	tests := []struct {
+		entry Entry
+		want  []string
+	}{
+		{
+			Entry{Query: "firefox", Attr: "firefox", Category: "browsers", Hosts: []string{"laptop", "desktop"}},
+			[]string{"install", "firefox", "--attr", "firefox", "--category", "browsers", "--host", "laptop", "--host", "desktop"},
+		},
+		{Entry{Command: Install, Query: "vim"}, []string{"install", "vim"}},
+		{Entry{Command: "input update", Args: []string{"nixpkgs"}}, []string{"input", "update", "nixpkgs"}},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.CommandLine(); !slices.Equal(got, tt.want) {
+			t.Errorf("CommandLine() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestHistory_Installs(t *testing.T) {
+	h := &History{}
+	h.Append(Entry{Query: "firefox"})
+	h.Append(Entry{Command: "uninstall", Args: []string{"vim"}})
+	h.Append(Entry{Command: Install, Query: "vim"})
+
+	installs := h.Installs()
+	if len(installs) != 2 || installs[0].Query != "vim" || installs[1].Query != "firefox" {
+		t.Errorf("Installs() = %+v, want vim then firefox", installs)
+	}
+}
+
+func TestHistory_LastSet(t *testing.T) {
+	h := &History{}
+	h.Append(Entry{Query: "black", Attr: "python311Packages.black", Category: "editors"})
+	h.Append(Entry{Query: "nerdtree", Attr: "vimPlugins.nerdtree", Category: "editors"})
+	h.Append(Entry{Query: "vim", Attr: "vim", Category: "editors"})
+	h.Append(Entry{Query: "numpy", Attr: "python311Packages.numpy", Category: "dev"})
+	h.Append(Entry{Command: "uninstall", Args: []string{"telescope"}})
+
+	if set, ok := h.LastSet("editors"); !ok || set != "vimPlugins" {
+		t.Errorf("LastSet(editors) = %q, %v, want vimPlugins", set, ok)
+	}
+	if set, ok := h.LastSet("dev"); !ok || set != "python311Packages" {
+		t.Errorf("LastSet(dev) = %q, %v, want python311Packages", set, ok)
+	}
+	if set, ok := h.LastSet("browsers"); ok {
+		t.Errorf("LastSet(browsers) = %q, want none", set)
+	}
+}
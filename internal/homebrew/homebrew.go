@@ -0,0 +1,98 @@
+// Package homebrew finds what nix-darwin's homebrew module installs for packages neither
+// nixpkgs nor the casks have: formulae of third-party taps and Mac App Store apps.
+package homebrew
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+// tapPart is one of owner, repository and formula of a fully qualified formula name
+var tapPart = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.+@-]*$`)
+
+// SplitTapFormula splits a fully qualified formula name such as owner/repo/formula into
+// the tap and the formula. ok is false for anything else, nix attribute paths never
+// contain a slash.
+func SplitTapFormula(query string) (tap string, formula string, ok bool) {
+	parts := strings.Split(query, "/")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	for _, part := range parts {
+		if !tapPart.MatchString(part) {
+			return "", "", false
+		}
+	}
+	return parts[0] + "/" + parts[1], parts[2], true
+}
+
+// TapPackage is the formula of tap installed on darwin hosts of system
+func TapPackage(tap string, formula string, system string) types.Package {
+	return types.Package{
+		PName:       formula,
+		Description: fmt.Sprintf("Homebrew formula from the %s tap", tap),
+		FullPath:    tap + "/" + formula,
+		System:      system,
+		Homebrew:    &types.Homebrew{Tap: tap, Formula: formula},
+	}
+}
+
+// MasApp is an app of the Mac App Store found by mas search
+type MasApp struct {
+	ID      int64
+	Name    string
+	Version string
+}
+
+// Package is the app installed on darwin hosts of system. The module and the option
+// hosts enable are named after the query the app was found for.
+func (a MasApp) Package(name string, system string) types.Package {
+	return types.Package{
+		PName:       name,
+		Version:     a.Version,
+		Description: fmt.Sprintf("Mac App Store app %s", a.Name),
+		FullPath:    strconv.FormatInt(a.ID, 10),
+		System:      system,
+		Homebrew:    &types.Homebrew{MasID: a.ID, MasName: a.Name},
+	}
+}
+
+// masLine is a result of mas search: the id, the name and the version in parentheses,
+// which older versions of mas leave out
+var masLine = regexp.MustCompile(`^\s*(\d+)\s+(.+?)(?:\s+\(([^()]*)\))?\s*$`)
+
+// ParseMasSearch reads the output of mas search, skipping lines that aren't results
+func ParseMasSearch(output string) []MasApp {
+	var apps []MasApp
+	for line := range strings.SplitSeq(output, "\n") {
+		match := masLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		id, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		apps = append(apps, MasApp{ID: id, Name: match[2], Version: match[3]})
+	}
+	return apps
+}
+
+// MasSearch searches the Mac App Store for query with the mas CLI
+func MasSearch(ctx context.Context, runner execx.Runner, query string) ([]MasApp, error) {
+	output, err := runner.CombinedOutput(ctx, nil, "mas", "search", query)
+	// mas fails when nothing matches
+	if err != nil && strings.Contains(string(output), "No results found") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("searching the Mac App Store for %s: %w", query, err)
+	}
+	return ParseMasSearch(string(output)), nil
+}
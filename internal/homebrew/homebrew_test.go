@@ -0,0 +1,75 @@
+package homebrew
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestSplitTapFormula(t *testing.T) {
+	tests := []struct {
+		query   string
+		tap     string
+		formula string
+		ok      bool
+	}{
+		{query: "felixkratz/formulae/sketchybar", tap: "felixkratz/formulae", formula: "sketchybar", ok: true},
+		{query: "owner/tools/python@3.12", tap: "owner/tools", formula: "python@3.12", ok: true},
+		{query: "sketchybar"},
+		{query: "owner/repo"},
+		{query: "./vendor/flake/tool"},
+		{query: "/abs/path/tool"},
+		{query: "github:owner/repo#tool"},
+		{query: "owner//tool"},
+	}
+	for _, tt := range tests {
+		tap, formula, ok := SplitTapFormula(tt.query)
+		if tap != tt.tap || formula != tt.formula || ok != tt.ok {
+			t.Errorf("SplitTapFormula(%q) = %q, %q, %v, want %q, %q, %v", tt.query, tap, formula, ok, tt.tap, tt.formula, tt.ok)
+		}
+	}
+}
+
+func TestParseMasSearch(t *testing.T) {
+	output := `
+  497799835  Xcode                    (16.0)
+ 1444383602  Xcode Cheatsheet         (1.2.1)
+  640199958  Developer
+Warning: something mas prints
+`
+	want := []MasApp{
+		{ID: 497799835, Name: "Xcode", Version: "16.0"},
+		{ID: 1444383602, Name: "Xcode Cheatsheet", Version: "1.2.1"},
+		{ID: 640199958, Name: "Developer"},
+	}
+	if got := ParseMasSearch(output); !slices.Equal(got, want) {
+		t.Errorf("ParseMasSearch() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMasSearch(t *testing.T) {
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"mas search Xcode":   {Output: "  497799835  Xcode  (16.0)\n"},
+		"mas search nothing": {Output: "No results found\n", Err: errors.New("exit status 1")},
+		"mas search broken":  {Output: "Error: not signed in\n", Err: errors.New("exit status 1")},
+	}}
+
+	apps, err := MasSearch(context.Background(), runner, "Xcode")
+	if err != nil || len(apps) != 1 || apps[0].ID != 497799835 {
+		t.Errorf("MasSearch() = %+v, %v", apps, err)
+	}
+	pkg := apps[0].Package("xcode", "aarch64-darwin")
+	if pkg.PName != "xcode" || pkg.Homebrew == nil || pkg.Homebrew.MasID != 497799835 || pkg.Homebrew.MasName != "Xcode" {
+		t.Errorf("Package() = %+v", pkg)
+	}
+
+	if apps, err := MasSearch(context.Background(), runner, "nothing"); err != nil || len(apps) != 0 {
+		t.Errorf("MasSearch() without results = %+v, %v", apps, err)
+	}
+	if _, err := MasSearch(context.Background(), runner, "broken"); err == nil {
+		t.Error("MasSearch() should fail when mas does")
+	}
+}
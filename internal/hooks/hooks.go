@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/execx"
+)
+
+// Events are the points of an install hooks run at
+const (
+	// PreInstall runs after every file is computed and checked, before any is written
+	PreInstall = "pre-install"
+	// PostInstall runs after a successful install, before git_auto_commit commits it
+	PostInstall = "post-install"
+)
+
+// Dir holds the hook scripts of a flake, named after their event
+const Dir = ".pam/hooks"
+
+// Context is what a hook reads on stdin as JSON
+type Context struct {
+	Event    string    `json:"event"`
+	Flake    string    `json:"flake"`
+	Packages []Package `json:"packages"`
+	Hosts    []string  `json:"hosts"`
+	// Files are written by the install, absolute paths
+	Files []string `json:"files"`
+}
+
+// Package is a package of the install as hooks see it
+type Package struct {
+	Name     string `json:"name"`
+	Attr     string `json:"attr"`
+	Version  string `json:"version"`
+	Category string `json:"category"`
+	// Module is the module file, empty for the plain layout
+	Module string `json:"module"`
+}
+
+// Commands returns the hooks of event: the commands configured for it, then the script
+// of the flake's .pam/hooks named after it when there is one
+func Commands(flakePath string, configured []string, event string) []string {
+	commands := append([]string{}, configured...)
+	script := filepath.Join(flakePath, Dir, event)
+	if info, err := os.Stat(script); err == nil && !info.IsDir() {
+		commands = append(commands, shellQuote(script))
+	}
+	return commands
+}
+
+// shellQuote quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Run runs every command with sh in the flake directory, the context on stdin. It stops
+// at the first failing command, whose output is part of the error.
+func Run(ctx context.Context, runner execx.Runner, commands []string, hookContext Context) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	input, err := json.Marshal(hookContext)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		// The flake directory is passed as an argument so it needs no quoting in the script
+		script := "cd \"$1\" || exit 1\nshift\n" + command
+		output, err := runner.CombinedOutput(ctx, input, "sh", "-c", script, "pam-hook", hookContext.Flake)
+		text := strings.TrimSpace(string(output))
+		if err != nil {
+			if text != "" {
+				return fmt.Errorf("%s hook %s failed: %w\n%s", hookContext.Event, command, err, text)
+			}
+			return fmt.Errorf("%s hook %s failed: %w", hookContext.Event, command, err)
+		}
+		if text != "" {
+			slog.Info(text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestCommands(t *testing.T) {
+	flake := t.TempDir()
+	configured := []string{"nixfmt modules"}
+
+	if got := Commands(flake, configured, PreInstall); !slices.Equal(got, configured) {
+		t.Errorf("Commands() without scripts = %v, want %v", got, configured)
+	}
+
+	script := filepath.Join(flake, Dir, PostInstall)
+	if err := os.MkdirAll(filepath.Dir(script), 0o755); err != nil {
+		t.Fatalf("Failed to create hooks directory: %v", err)
+	}
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+	want := []string{"nixfmt modules", "'" + script + "'"}
+	if got := Commands(flake, configured, PostInstall); !slices.Equal(got, want) {
+		t.Errorf("Commands() = %v, want %v", got, want)
+	}
+	if got := Commands(flake, nil, PreInstall); len(got) != 0 {
+		t.Errorf("Commands() for another event = %v, want none", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	flake := t.TempDir()
+	hookContext := Context{
+		Event:    PostInstall,
+		Flake:    flake,
+		Packages: []Package{{Name: "firefox", Attr: "firefox", Version: "119.0", Category: "browsers"}},
+		Hosts:    []string{"laptop"},
+		Files:    []string{filepath.Join(flake, "modules", "firefox.nix")},
+	}
+
+	// Hooks run in the flake and read the context from stdin
+	err := Run(context.Background(), execx.Exec{}, []string{"cat > context.json", "test -s context.json"}, hookContext)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(flake, "context.json"))
+	if err != nil {
+		t.Fatalf("hook didn't run in the flake: %v", err)
+	}
+	var got Context
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("hook read invalid JSON: %v", err)
+	}
+	if got.Event != PostInstall || len(got.Packages) != 1 || got.Packages[0].Name != "firefox" || !slices.Equal(got.Hosts, hookContext.Hosts) {
+		t.Errorf("hook read %+v", got)
+	}
+
+	// The first failing hook stops the others
+	err = Run(context.Background(), execx.Exec{}, []string{"echo formatting failed; exit 2", "touch later"}, hookContext)
+	if err == nil || !strings.Contains(err.Error(), "formatting failed") {
+		t.Errorf("Run() error = %v, want the output of the failing hook", err)
+	}
+	if _, err := os.Stat(filepath.Join(flake, "later")); err == nil {
+		t.Error("Run() ran the hook after the failing one")
+	}
+}
@@ -0,0 +1,180 @@
+package hosts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/diff"
+	"pam/internal/nixconfig"
+)
+
+// DefaultAppsFile is the file inside a host directory that holds the apps section
+const DefaultAppsFile = "configuration.nix"
+
+// AppsFile returns the path of the file whose apps section should be edited for host.
+// Each layer maps host names to files, with the "" key applying to every host.
+// Later layers take precedence, and relative files resolve against the host directory.
+func AppsFile(hostsDir string, host string, layers ...map[string]string) string {
+	file := DefaultAppsFile
+	for i := len(layers) - 1; i >= 0; i-- {
+		if override, ok := layers[i][host]; ok && override != "" {
+			file = override
+			break
+		}
+		if override, ok := layers[i][""]; ok && override != "" {
+			file = override
+			break
+		}
+	}
+
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(hostsDir, host, file)
+}
+
+// ParseAppsFileFlags turns `--apps-file` values into a host mapping.
+// A value of the form host=path targets a single host, a bare path targets every host.
+func ParseAppsFileFlags(values []string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, value := range values {
+		host, file, found := strings.Cut(value, "=")
+		if !found {
+			host, file = "", value
+		}
+		if file == "" {
+			return nil, fmt.Errorf("invalid --apps-file value '%s', expected <path> or <host>=<path>", value)
+		}
+		overrides[host] = file
+	}
+	return overrides, nil
+}
+
+// Edit applies edit to the nix file at path and returns its content before and after.
+// Nothing is written, see Write.
+func Edit(path string, edit func(nixcfg *nixconfig.Config) error) (diff.Change, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return diff.Change{}, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	nixcfg := nixconfig.NewConfig(string(data))
+	err = edit(nixcfg)
+	if err != nil {
+		return diff.Change{}, fmt.Errorf("updating %s: %w", path, err)
+	}
+	return diff.Change{Path: path, Old: string(data), New: nixcfg.Content()}, nil
+}
+
+// Write saves a change made by Edit, leaving the file alone when nothing changed
+func Write(change diff.Change) error {
+	if change.Old == change.New {
+		return nil
+	}
+	return diff.WriteFile(change.Path, []byte(change.New))
+}
+
+// EnableEdit enables every package in category of the apps section at namespace, e.g.
+// apps, creating the apps section and category when they are missing
+func EnableEdit(namespace string, category string, packageNames ...string) func(nixcfg *nixconfig.Config) error {
+	return func(nixcfg *nixconfig.Config) error {
+		nixcfg.SetNamespace(namespace)
+		err := nixcfg.EnsureAppsSectionExists()
+		if err != nil {
+			return fmt.Errorf("ensuring apps section: %w", err)
+		}
+		for _, packageName := range packageNames {
+			err = nixcfg.AddOrEnablePackage(category, packageName)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// EnablePackage enables category.packageName in the apps section at namespace of the nix
+// file at path, creating the apps section and category when they are missing.
+func EnablePackage(path string, namespace string, category string, packageName string) error {
+	change, err := Edit(path, EnableEdit(namespace, category, packageName))
+	if err != nil {
+		return err
+	}
+	return Write(change)
+}
+
+// RemoveEdit deletes category.packageName, leaving the content as is when it is not there
+func RemoveEdit(namespace string, category string, packageName string) func(nixcfg *nixconfig.Config) error {
+	return func(nixcfg *nixconfig.Config) error {
+		nixcfg.SetNamespace(namespace)
+		nixcfg.RemovePackage(category, packageName)
+		return nil
+	}
+}
+
+// PackageEnabled reports whether category.packageName is enabled in the nix file at path
+func PackageEnabled(path string, namespace string, category string, packageName string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	nixcfg := nixconfig.NewConfig(string(data))
+	nixcfg.SetNamespace(namespace)
+	enabled, _ := nixcfg.PackageEnabled(category, packageName)
+	return enabled, nil
+}
+
+// DisableEdit sets category.packageName to false, leaving the content as is when it is not enabled
+func DisableEdit(namespace string, category string, packageName string) func(nixcfg *nixconfig.Config) error {
+	return func(nixcfg *nixconfig.Config) error {
+		nixcfg.SetNamespace(namespace)
+		nixcfg.DisablePackage(category, packageName)
+		return nil
+	}
+}
+
+// Systems guessed for hosts whose flake entry says whether they run NixOS or nix-darwin
+// but not on which architecture
+const (
+	defaultLinuxSystem  = "x86_64-linux"
+	defaultDarwinSystem = "aarch64-darwin"
+)
+
+// DetectSystem returns the system host is built for, e.g. aarch64-darwin. It reads
+// nixpkgs.hostPlatform from the .nix files of the host directory, then the system passed
+// to the host's nixosSystem or darwinSystem call in flake.nix. A call passing no system
+// gets x86_64-linux or aarch64-darwin. It returns "" when neither tells.
+func DetectSystem(flakePath string, hostsDir string, host string) string {
+	entries, _ := os.ReadDir(filepath.Join(hostsDir, host))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".nix" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(hostsDir, host, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if system := nixconfig.NewConfig(string(data)).HostPlatform(); system != "" {
+			return system
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(flakePath, "flake.nix"))
+	if err != nil {
+		return ""
+	}
+	system, darwin, found := nixconfig.NewConfig(string(data)).SystemOf(host)
+	switch {
+	case !found:
+		return ""
+	case system != "":
+		return system
+	case darwin:
+		return defaultDarwinSystem
+	default:
+		return defaultLinuxSystem
+	}
+}
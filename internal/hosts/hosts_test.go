@@ -0,0 +1,269 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal/nixconfig"
+)
+
+func TestAppsFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		layers []map[string]string
+		want   string
+	}{
+		{
+			name: "no overrides",
+			host: "laptop",
+			want: "/flake/hosts/laptop/configuration.nix",
+		},
+		{
+			name:   "config mapping for host",
+			host:   "laptop",
+			layers: []map[string]string{{"laptop": "apps.nix"}},
+			want:   "/flake/hosts/laptop/apps.nix",
+		},
+		{
+			name:   "config mapping for other host",
+			host:   "desktop",
+			layers: []map[string]string{{"laptop": "apps.nix"}},
+			want:   "/flake/hosts/desktop/configuration.nix",
+		},
+		{
+			name:   "flag for all hosts overrides config",
+			host:   "laptop",
+			layers: []map[string]string{{"laptop": "apps.nix"}, {"": "packages.nix"}},
+			want:   "/flake/hosts/laptop/packages.nix",
+		},
+		{
+			name:   "absolute path",
+			host:   "laptop",
+			layers: []map[string]string{{"laptop": "/flake/shared/apps.nix"}},
+			want:   "/flake/shared/apps.nix",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AppsFile("/flake/hosts", tt.host, tt.layers...)
+			if got != tt.want {
+				t.Errorf("AppsFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAppsFileFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "bare path applies to every host",
+			values: []string{"apps.nix"},
+			want:   map[string]string{"": "apps.nix"},
+		},
+		{
+			name:   "per host paths",
+			values: []string{"laptop=apps.nix", "desktop=modules.nix"},
+			want:   map[string]string{"laptop": "apps.nix", "desktop": "modules.nix"},
+		},
+		{
+			name:    "missing path",
+			values:  []string{"laptop="},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAppsFileFlags(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAppsFileFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseAppsFileFlags() = %v, want %v", got, tt.want)
+			}
+			for host, file := range tt.want {
+				if got[host] != file {
+					t.Errorf("ParseAppsFileFlags()[%q] = %q, want %q", host, got[host], file)
+				}
+			}
+		})
+	}
+}
+
+func TestEnablePackage_SeparateAppsFile(t *testing.T) {
+	hostsDir := t.TempDir()
+	hostDir := filepath.Join(hostsDir, "laptop")
+	if err := os.MkdirAll(hostDir, 0o755); err != nil {
+		t.Fatalf("Failed to create host directory: %v", err)
+	}
+
+	configuration := "{ ... }:\n{\n  imports = [ ./apps.nix ];\n}\n"
+	apps := "{ ... }:\n{\n  apps = {\n    browsers = {\n      chromium.enable = true;\n    };\n  };\n}\n"
+	if err := os.WriteFile(filepath.Join(hostDir, "configuration.nix"), []byte(configuration), 0o644); err != nil {
+		t.Fatalf("Failed to write configuration.nix: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(hostDir, "apps.nix"), []byte(apps), 0o644); err != nil {
+		t.Fatalf("Failed to write apps.nix: %v", err)
+	}
+
+	path := AppsFile(hostsDir, "laptop", map[string]string{"laptop": "apps.nix"})
+	if err := EnablePackage(path, nixconfig.DefaultNamespace, "browsers", "firefox"); err != nil {
+		t.Fatalf("EnablePackage() error = %v", err)
+	}
+
+	gotApps, err := os.ReadFile(filepath.Join(hostDir, "apps.nix"))
+	if err != nil {
+		t.Fatalf("Failed to read apps.nix: %v", err)
+	}
+	if !strings.Contains(string(gotApps), "firefox.enable = true;") {
+		t.Errorf("apps.nix missing firefox.enable:\n%s", gotApps)
+	}
+	if !strings.Contains(string(gotApps), "chromium.enable = true;") {
+		t.Errorf("apps.nix lost existing chromium.enable:\n%s", gotApps)
+	}
+
+	gotConfiguration, err := os.ReadFile(filepath.Join(hostDir, "configuration.nix"))
+	if err != nil {
+		t.Fatalf("Failed to read configuration.nix: %v", err)
+	}
+	if string(gotConfiguration) != configuration {
+		t.Errorf("configuration.nix was modified:\n%s", gotConfiguration)
+	}
+}
+
+func TestEnablePackage_MissingFile(t *testing.T) {
+	err := EnablePackage(filepath.Join(t.TempDir(), "missing.nix"), nixconfig.DefaultNamespace, "browsers", "firefox")
+	if err == nil {
+		t.Error("EnablePackage() expected error for missing file, got nil")
+	}
+}
+
+// applyEdit runs edit on the file at path and writes it, reporting whether anything changed
+func applyEdit(t *testing.T, path string, edit func(nixcfg *nixconfig.Config) error) bool {
+	t.Helper()
+	change, err := Edit(path, edit)
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if err := Write(change); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	return change.Old != change.New
+}
+
+func TestRemoveEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configuration.nix")
+	content := "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n      chromium.enable = true;\n    };\n  };\n}\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write configuration.nix: %v", err)
+	}
+
+	if !applyEdit(t, path, RemoveEdit(nixconfig.DefaultNamespace, "browsers", "firefox")) {
+		t.Error("RemoveEdit() changed nothing")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read configuration.nix: %v", err)
+	}
+	if strings.Contains(string(got), "firefox") {
+		t.Errorf("RemoveEdit() left firefox behind:\n%s", got)
+	}
+	if !strings.Contains(string(got), "chromium.enable = true;") {
+		t.Errorf("RemoveEdit() removed chromium:\n%s", got)
+	}
+
+	if applyEdit(t, path, RemoveEdit(nixconfig.DefaultNamespace, "browsers", "firefox")) {
+		t.Error("second RemoveEdit() changed the file")
+	}
+}
+
+func TestDisableEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configuration.nix")
+	content := "{\n  apps = {\n    browsers = {\n      firefox.enable = true; # daily driver\n      chromium.enable = true;\n    };\n  };\n}\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write configuration.nix: %v", err)
+	}
+
+	if !applyEdit(t, path, DisableEdit(nixconfig.DefaultNamespace, "browsers", "firefox")) {
+		t.Error("DisableEdit() changed nothing")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read configuration.nix: %v", err)
+	}
+	want := strings.Replace(content, "firefox.enable = true;", "firefox.enable = false;", 1)
+	if string(got) != want {
+		t.Errorf("DisableEdit() wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	enabled, err := PackageEnabled(path, nixconfig.DefaultNamespace, "browsers", "firefox")
+	if err != nil {
+		t.Fatalf("PackageEnabled() error = %v", err)
+	}
+	if enabled {
+		t.Error("PackageEnabled() = true after disabling")
+	}
+
+	if applyEdit(t, path, DisableEdit(nixconfig.DefaultNamespace, "browsers", "firefox")) {
+		t.Error("second DisableEdit() changed the file")
+	}
+}
+
+func TestDetectSystem(t *testing.T) {
+	root := t.TempDir()
+	hostsDir := filepath.Join(root, "hosts")
+	files := map[string]string{
+		"flake.nix": `{
+  outputs = { nixpkgs, nix-darwin, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem { modules = [ ]; };
+    nixosConfigurations.pi = nixpkgs.lib.nixosSystem { system = "aarch64-linux"; };
+    darwinConfigurations.macbook = nix-darwin.lib.darwinSystem { modules = [ ]; };
+  };
+}`,
+		"hosts/laptop/configuration.nix":          "{ imports = [ ./hardware-configuration.nix ]; }",
+		"hosts/laptop/hardware-configuration.nix": `{ lib, ... }: { nixpkgs.hostPlatform = lib.mkDefault "x86_64-linux"; }`,
+		"hosts/pi/configuration.nix":              "{ }",
+		"hosts/macbook/configuration.nix":         "{ }",
+		"hosts/intel-mac/configuration.nix":       `{ nixpkgs.hostPlatform = "x86_64-darwin"; }`,
+		"hosts/unknown/configuration.nix":         "{ }",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "laptop", want: "x86_64-linux"},
+		{host: "pi", want: "aarch64-linux"},
+		{host: "macbook", want: "aarch64-darwin"},
+		{host: "intel-mac", want: "x86_64-darwin"},
+		{host: "unknown", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := DetectSystem(root, hostsDir, tt.host); got != tt.want {
+				t.Errorf("DetectSystem(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package hosts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"pam/internal/execx"
+	"pam/internal/nixconfig"
+)
+
+// optionArgs builds the nix eval call reporting whether the configuration of host
+// declares the <set>.<name>.enable option, e.g. programs.git.enable
+func optionArgs(flakePath string, host string, darwin bool, set string, name string) []string {
+	outputs := "nixosConfigurations"
+	if darwin {
+		outputs = "darwinConfigurations"
+	}
+	quoted := strconv.Quote(name)
+	return []string{
+		"eval", "--json",
+		fmt.Sprintf("%s#%s.%s.options.%s", flakePath, outputs, strconv.Quote(host), set),
+		"--apply", fmt.Sprintf("%s: %s ? %s && %s.%s ? enable", set, set, quoted, set, quoted),
+	}
+}
+
+// configurations limits an option lookup to hosts of one kind
+type configurations int
+
+const (
+	anyConfiguration configurations = iota
+	darwinConfigurations
+	nixosConfigurations
+)
+
+// matches reports whether a host of the flake, nix-darwin or NixOS, is looked up
+func (c configurations) matches(darwin bool) bool {
+	switch c {
+	case darwinConfigurations:
+		return darwin
+	case nixosConfigurations:
+		return !darwin
+	}
+	return true
+}
+
+// hasOption reports whether host declares <set>.<name>.enable, evaluating its options
+// with nix eval. Hosts flake.nix doesn't define have none, and neither do hosts of
+// another kind than which.
+func hasOption(ctx context.Context, runner execx.Runner, flakePath string, host string, set string, name string, which configurations) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(flakePath, "flake.nix"))
+	if err != nil {
+		return false, err
+	}
+	_, darwin, found := nixconfig.NewConfig(string(data)).SystemOf(host)
+	if !found || !which.matches(darwin) {
+		return false, nil
+	}
+
+	output, err := runner.Output(ctx, "nix", optionArgs(flakePath, host, darwin, set, name)...)
+	if err != nil {
+		return false, fmt.Errorf("evaluating the options of %s: %w", host, err)
+	}
+	var declared bool
+	err = json.Unmarshal(output, &declared)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return declared, nil
+}
+
+// HasProgram reports whether host has a programs.<name> module that can be enabled instead
+// of listing the package, by evaluating the host's options with nix eval. Hosts flake.nix
+// doesn't define have none.
+func HasProgram(ctx context.Context, runner execx.Runner, flakePath string, host string, name string) (bool, error) {
+	return hasOption(ctx, runner, flakePath, host, "programs", name, anyConfiguration)
+}
+
+// HasDarwinService reports whether host is a nix-darwin configuration with a
+// services.<name> module, such as yabai or skhd, that can run the package as a service
+func HasDarwinService(ctx context.Context, runner execx.Runner, flakePath string, host string, name string) (bool, error) {
+	return hasOption(ctx, runner, flakePath, host, "services", name, darwinConfigurations)
+}
+
+// HasNixOSService reports whether host is a NixOS configuration with a services.<name>
+// module, such as postgresql or nginx, that can run the package as a service
+func HasNixOSService(ctx context.Context, runner execx.Runner, flakePath string, host string, name string) (bool, error) {
+	return hasOption(ctx, runner, flakePath, host, "services", name, nixosConfigurations)
+}
@@ -0,0 +1,132 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestOptionArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		darwin bool
+		want   string
+	}{
+		{name: "nixos", want: `/flake#nixosConfigurations."laptop".options.programs`},
+		{name: "darwin", darwin: true, want: `/flake#darwinConfigurations."laptop".options.programs`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := optionArgs("/flake", "laptop", tt.darwin, "programs", "git")
+			if len(got) != 5 || got[0] != "eval" || got[2] != tt.want || got[3] != "--apply" {
+				t.Fatalf("optionArgs() = %v", got)
+			}
+			if !strings.Contains(got[4], `programs ? "git"`) {
+				t.Errorf("optionArgs() apply = %q", got[4])
+			}
+		})
+	}
+}
+
+func TestHasProgram(t *testing.T) {
+	tests := []struct {
+		name     string
+		response execx.Response
+		want     bool
+		wantErr  bool
+	}{
+		{name: "declared", response: execx.Response{Output: "true\n"}, want: true},
+		{name: "not declared", response: execx.Response{Output: "false\n"}},
+		{name: "evaluation fails", response: execx.Response{Err: errors.New("exit status 1")}, wantErr: true},
+	}
+
+	root := t.TempDir()
+	flake := "{ outputs = _: { darwinConfigurations.laptop = darwin.lib.darwinSystem { }; }; }\n"
+	if err := os.WriteFile(filepath.Join(root, "flake.nix"), []byte(flake), 0o644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &execx.Fake{Responses: map[string]execx.Response{"nix": tt.response}}
+			got, err := HasProgram(context.Background(), runner, root, "laptop", "git")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("HasProgram() = %v, %v, want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+			calls := runner.Calls()
+			if len(calls) != 1 || !strings.Contains(calls[0], `darwinConfigurations."laptop"`) {
+				t.Errorf("ran %q, want one evaluation of the darwin host", calls)
+			}
+		})
+	}
+}
+
+func TestHasProgram_UnknownHost(t *testing.T) {
+	root := t.TempDir()
+	flake := "{ outputs = _: { nixosConfigurations.laptop = nixpkgs.lib.nixosSystem { }; }; }\n"
+	if err := os.WriteFile(filepath.Join(root, "flake.nix"), []byte(flake), 0o644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+
+	// A host flake.nix doesn't define is never evaluated
+	runner := &execx.Fake{}
+	declared, err := HasProgram(context.Background(), runner, root, "desktop", "git")
+	if err != nil || declared {
+		t.Errorf("HasProgram() = %v, %v, want false, nil", declared, err)
+	}
+	if calls := runner.Calls(); len(calls) != 0 {
+		t.Errorf("ran %q, want nothing", calls)
+	}
+}
+
+func TestHasDarwinService(t *testing.T) {
+	root := t.TempDir()
+	flake := `{
+  outputs = _: {
+    nixosConfigurations.desktop = nixpkgs.lib.nixosSystem { };
+    darwinConfigurations.mac = darwin.lib.darwinSystem { };
+  };
+}
+`
+	if err := os.WriteFile(filepath.Join(root, "flake.nix"), []byte(flake), 0o644); err != nil {
+		t.Fatalf("Failed to write flake.nix: %v", err)
+	}
+
+	runner := &execx.Fake{Responses: map[string]execx.Response{"nix": {Output: "true\n"}}}
+	declared, err := HasDarwinService(context.Background(), runner, root, "mac", "yabai")
+	if err != nil || !declared {
+		t.Errorf("HasDarwinService(mac) = %v, %v, want true, nil", declared, err)
+	}
+	calls := runner.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0], `darwinConfigurations."mac".options.services`) {
+		t.Errorf("ran %q, want one evaluation of the services of mac", calls)
+	}
+
+	// NixOS hosts have their own services, which aren't nix-darwin's
+	declared, err = HasDarwinService(context.Background(), runner, root, "desktop", "yabai")
+	if err != nil || declared {
+		t.Errorf("HasDarwinService(desktop) = %v, %v, want false, nil", declared, err)
+	}
+	if calls := runner.Calls(); len(calls) != 1 {
+		t.Errorf("ran %q, want no evaluation of desktop", calls)
+	}
+
+	declared, err = HasNixOSService(context.Background(), runner, root, "desktop", "postgresql")
+	if err != nil || !declared {
+		t.Errorf("HasNixOSService(desktop) = %v, %v, want true, nil", declared, err)
+	}
+	declared, err = HasNixOSService(context.Background(), runner, root, "mac", "postgresql")
+	if err != nil || declared {
+		t.Errorf("HasNixOSService(mac) = %v, %v, want false, nil", declared, err)
+	}
+	calls = runner.Calls()
+	if len(calls) != 2 || !strings.Contains(calls[1], `nixosConfigurations."desktop".options.services`) {
+		t.Errorf("ran %q, want one more evaluation, of the services of desktop", calls)
+	}
+}
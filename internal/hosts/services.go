@@ -0,0 +1,86 @@
+package hosts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/options"
+	"pam/internal/types"
+)
+
+// KeyServiceOptions are the options of a NixOS services.<name> module asked for when it
+// is enabled on install, in the order they are asked
+var KeyServiceOptions = []string{"port", "listenAddress", "dataDir", "openFirewall"}
+
+// ServiceOption is an option of a NixOS service module as its declaration describes it
+type ServiceOption struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Type is the description of the option's type, e.g. boolean or 16 bit unsigned integer
+	Type string `json:"type"`
+	// Default is the default as the module documents it, empty when it can't be shown
+	Default string `json:"default"`
+}
+
+// IsBool reports whether the option takes true or false
+func (o ServiceOption) IsBool() bool {
+	return o.Type == "boolean"
+}
+
+// Setting returns the option set to value, quoting it as a nix string for string and
+// path options unless it already is one
+func (o ServiceOption) Setting(value string) types.Setting {
+	return types.Setting{Name: o.Name, Value: options.Value(o.Type, value)}
+}
+
+// serviceOptionsExpr picks the declarations of the key options out of a service's
+// options. Defaults that fail to evaluate, e.g. because they depend on other options,
+// are left empty.
+const serviceOptionsExpr = `service: let
+  keys = builtins.filter (key: service ? ${key} && (service.${key}._type or "") == "option") %s;
+  text = value: if builtins.isAttrs value then value.text or "" else toString value;
+  shown = option: let
+    value = builtins.tryEval (option.default or null);
+    json = builtins.tryEval (builtins.toJSON value.value);
+  in if option ? defaultText then text option.defaultText
+     else if value.success && json.success && value.value != null then json.value
+     else "";
+in map (key: let option = service.${key}; in {
+  name = key;
+  description = text (option.description or "");
+  type = option.type.description or "";
+  default = shown option;
+}) keys`
+
+// serviceOptionsArgs builds the nix eval call reading the key options of the
+// services.<name> module of a NixOS host
+func serviceOptionsArgs(flakePath string, host string, name string) []string {
+	keys := make([]string, len(KeyServiceOptions))
+	for i, key := range KeyServiceOptions {
+		keys[i] = strconv.Quote(key)
+	}
+	return []string{
+		"eval", "--json",
+		fmt.Sprintf("%s#nixosConfigurations.%s.options.services.%s", flakePath, strconv.Quote(host), strconv.Quote(name)),
+		"--apply", fmt.Sprintf(serviceOptionsExpr, "[ "+strings.Join(keys, " ")+" ]"),
+	}
+}
+
+// ServiceOptions returns the key options the services.<name> module of a NixOS host
+// declares, see KeyServiceOptions
+func ServiceOptions(ctx context.Context, runner execx.Runner, flakePath string, host string, name string) ([]ServiceOption, error) {
+	output, err := runner.Output(ctx, "nix", serviceOptionsArgs(flakePath, host, name)...)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating the options of services.%s on %s: %w", name, host, err)
+	}
+	var options []ServiceOption
+	err = json.Unmarshal(output, &options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return options, nil
+}
@@ -0,0 +1,50 @@
+package hosts
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestServiceOptions(t *testing.T) {
+	output := `[{"name":"port","description":"Port to listen on.","type":"16 bit unsigned integer; between 0 and 65535 (both inclusive)","default":"5432"},` +
+		`{"name":"dataDir","description":"Data directory.","type":"absolute path","default":"\"/var/lib/postgresql/${config.services.postgresql.package.psqlSchema}\""}]`
+	runner := &execx.Fake{Responses: map[string]execx.Response{"nix": {Output: output}}}
+
+	options, err := ServiceOptions(context.Background(), runner, "/flake", "server", "postgresql")
+	if err != nil {
+		t.Fatalf("ServiceOptions() error = %v", err)
+	}
+	if len(options) != 2 || options[0].Name != "port" || options[0].Default != "5432" || options[1].Type != "absolute path" {
+		t.Errorf("ServiceOptions() = %+v", options)
+	}
+	calls := runner.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0], `/flake#nixosConfigurations."server".options.services."postgresql"`) {
+		t.Errorf("ran %q, want one evaluation of the postgresql options of server", calls)
+	}
+}
+
+func TestServiceOption_Setting(t *testing.T) {
+	tests := []struct {
+		option ServiceOption
+		value  string
+		want   string
+	}{
+		{ServiceOption{Name: "port", Type: "16 bit unsigned integer; between 0 and 65535 (both inclusive)"}, "5433", "5433"},
+		{ServiceOption{Name: "dataDir", Type: "absolute path"}, "/srv/postgres", `"/srv/postgres"`},
+		{ServiceOption{Name: "listenAddress", Type: "string"}, `"0.0.0.0"`, `"0.0.0.0"`},
+		{ServiceOption{Name: "listenAddress", Type: "string"}, `a"b`, `"a\"b"`},
+		{ServiceOption{Name: "openFirewall", Type: "boolean"}, "true", "true"},
+	}
+	for _, tt := range tests {
+		got := tt.option.Setting(tt.value)
+		if got.Name != tt.option.Name || got.Value != tt.want {
+			t.Errorf("Setting(%q) = %+v, want %s", tt.value, got, tt.want)
+		}
+	}
+	if !(ServiceOption{Type: "boolean"}).IsBool() || (ServiceOption{Type: "string"}).IsBool() {
+		t.Errorf("IsBool() doesn't match the boolean type")
+	}
+}
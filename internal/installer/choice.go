@@ -0,0 +1,52 @@
+package installer
+
+import (
+	"fmt"
+	"slices"
+
+	"pam/internal/search"
+	"pam/internal/types"
+)
+
+// Choice picks a package without prompting, from the --attr, --package-index and --yes flags
+type Choice struct {
+	// Attrs are attribute paths that may be installed, e.g. firefox or python3Packages.numpy
+	Attrs []string
+	// Index selects a candidate by its position in the results, -1 when unset
+	Index int
+	// AcceptBestMatch takes the clear best match when neither Attrs nor Index decide
+	AcceptBestMatch bool
+}
+
+// Pick returns the candidate selected by the choice. It returns nil without an error
+// when the choice does not decide, so the caller can prompt instead.
+func (c Choice) Pick(query string, candidates []types.Package) (*types.Package, error) {
+	if len(c.Attrs) > 0 {
+		for i := range candidates {
+			if slices.Contains(c.Attrs, candidates[i].FullPath) {
+				return &candidates[i], nil
+			}
+		}
+		return nil, fmt.Errorf("none of the results for %s match --attr %v", query, c.Attrs)
+	}
+
+	if c.Index >= 0 {
+		if c.Index >= len(candidates) {
+			return nil, fmt.Errorf("--package-index %d out of range, %s has %d results", c.Index, query, len(candidates))
+		}
+		return &candidates[c.Index], nil
+	}
+
+	if c.AcceptBestMatch {
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no packages found for %s", query)
+		}
+		pkg, ok := search.BestMatch(candidates, query)
+		if !ok {
+			return nil, fmt.Errorf("no clear best match for %s among %d results, pass --attr or --package-index", query, len(candidates))
+		}
+		return pkg, nil
+	}
+
+	return nil, nil
+}
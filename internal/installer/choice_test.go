@@ -0,0 +1,94 @@
+package installer
+
+import (
+	"testing"
+
+	"pam/internal/types"
+)
+
+func TestChoice_Pick(t *testing.T) {
+	candidates := []types.Package{
+		{PName: "firefox-esr", FullPath: "firefox-esr"},
+		{PName: "firefox", FullPath: "firefox"},
+		{PName: "firefox", FullPath: "firefox-bin"},
+	}
+
+	tests := []struct {
+		name       string
+		choice     Choice
+		candidates []types.Package
+		wantPath   string
+		wantNil    bool
+		wantErr    bool
+	}{
+		{
+			name:       "attr match",
+			choice:     Choice{Attrs: []string{"firefox-bin"}, Index: -1},
+			candidates: candidates,
+			wantPath:   "firefox-bin",
+		},
+		{
+			name:       "attr not found",
+			choice:     Choice{Attrs: []string{"chromium"}, Index: -1},
+			candidates: candidates,
+			wantErr:    true,
+		},
+		{
+			name:       "index",
+			choice:     Choice{Index: 0},
+			candidates: candidates,
+			wantPath:   "firefox-esr",
+		},
+		{
+			name:       "index out of range",
+			choice:     Choice{Index: 3},
+			candidates: candidates,
+			wantErr:    true,
+		},
+		{
+			name:       "accept clear best match",
+			choice:     Choice{Index: -1, AcceptBestMatch: true},
+			candidates: candidates[:2],
+			wantPath:   "firefox",
+		},
+		{
+			name:       "accept ambiguous results",
+			choice:     Choice{Index: -1, AcceptBestMatch: true},
+			candidates: candidates,
+			wantErr:    true,
+		},
+		{
+			name:       "accept without results",
+			choice:     Choice{Index: -1, AcceptBestMatch: true},
+			candidates: nil,
+			wantErr:    true,
+		},
+		{
+			name:       "undecided falls back to prompting",
+			choice:     Choice{Index: -1},
+			candidates: candidates,
+			wantNil:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.choice.Pick("firefox", tt.candidates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Pick() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("Pick() = %q, want nil", got.FullPath)
+				}
+				return
+			}
+			if got == nil || got.FullPath != tt.wantPath {
+				t.Errorf("Pick() = %v, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Confirmation is the answer for one package of an install with --confirm-each
+type Confirmation int
+
+const (
+	// Confirm installs the package
+	Confirm Confirmation = iota
+	// Skip leaves the package out and goes on with the next one
+	Skip
+	// Abort stops the install before any file is written
+	Abort
+)
+
+// ErrAborted is returned by ConfirmEach when a package is answered with Abort
+var ErrAborted = errors.New("install aborted")
+
+// Confirmer asks whether to install a selection, resolved against the plan so it carries
+// the category and hosts it goes to
+type Confirmer func(selection Selection) (Confirmation, error)
+
+// ConfirmEach asks confirm about every selection in order and returns the confirmed and
+// the skipped ones. After an Abort it returns ErrAborted with the selections answered
+// before it.
+func ConfirmEach(selections []Selection, plan Plan, confirm Confirmer) (confirmed []Selection, skipped []Selection, err error) {
+	for _, selection := range selections {
+		answer, err := confirm(plan.resolve(selection))
+		if err != nil {
+			return confirmed, skipped, err
+		}
+		switch answer {
+		case Confirm:
+			confirmed = append(confirmed, selection)
+		case Skip:
+			skipped = append(skipped, selection)
+		case Abort:
+			return confirmed, skipped, ErrAborted
+		default:
+			return confirmed, skipped, fmt.Errorf("unknown answer %d for %s", answer, selection.Package.PName)
+		}
+	}
+	return confirmed, skipped, nil
+}
+
+// Describe returns the package, attribute, version, category and hosts of a resolved
+// selection on one line, e.g. firefox (firefox 120.0) → browsers on laptop, desktop
+func (s Selection) Describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s", s.Package.PName, s.Package.FullPath)
+	if s.Package.Version != "" {
+		b.WriteString(" " + s.Package.Version)
+	}
+	b.WriteString(")")
+	if s.Category != "" {
+		b.WriteString(" → " + s.Category)
+	}
+	hostNames := make([]string, len(s.Hosts))
+	for i, host := range s.Hosts {
+		hostNames[i] = host.Name
+	}
+	if len(hostNames) == 0 {
+		b.WriteString(" on no hosts")
+	} else {
+		b.WriteString(" on " + strings.Join(hostNames, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package installer
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"pam/internal/types"
+)
+
+func TestConfirmEach(t *testing.T) {
+	selections := []Selection{
+		{Query: "firefox", Package: &types.Package{PName: "firefox", FullPath: "firefox"}},
+		{Query: "vim", Package: &types.Package{PName: "vim", FullPath: "vim"}},
+		{Query: "ripgrep", Package: &types.Package{PName: "ripgrep", FullPath: "ripgrep"}},
+	}
+	plan := Plan{Category: "cli", Hosts: []Host{{Name: "laptop"}}}
+
+	tests := []struct {
+		name          string
+		answers       []Confirmation
+		wantConfirmed []string
+		wantSkipped   []string
+		wantAsked     int
+		wantAborted   bool
+	}{
+		{
+			name:          "all confirmed",
+			answers:       []Confirmation{Confirm, Confirm, Confirm},
+			wantConfirmed: []string{"firefox", "vim", "ripgrep"},
+			wantAsked:     3,
+		},
+		{
+			name:          "skips are collected",
+			answers:       []Confirmation{Skip, Confirm, Skip},
+			wantConfirmed: []string{"vim"},
+			wantSkipped:   []string{"firefox", "ripgrep"},
+			wantAsked:     3,
+		},
+		{
+			name:        "all skipped",
+			answers:     []Confirmation{Skip, Skip, Skip},
+			wantSkipped: []string{"firefox", "vim", "ripgrep"},
+			wantAsked:   3,
+		},
+		{
+			name:          "abort stops asking",
+			answers:       []Confirmation{Confirm, Skip, Abort},
+			wantConfirmed: []string{"firefox"},
+			wantSkipped:   []string{"vim"},
+			wantAsked:     3,
+			wantAborted:   true,
+		},
+		{
+			name:        "abort first",
+			answers:     []Confirmation{Abort, Confirm, Confirm},
+			wantAsked:   1,
+			wantAborted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked := 0
+			confirmed, skipped, err := ConfirmEach(selections, plan, func(selection Selection) (Confirmation, error) {
+				if selection.Category != "cli" || len(selection.Hosts) != 1 {
+					t.Errorf("asked about %s without the plan's category and hosts", selection.Query)
+				}
+				asked++
+				return tt.answers[asked-1], nil
+			})
+			if errors.Is(err, ErrAborted) != tt.wantAborted {
+				t.Fatalf("ConfirmEach() error = %v, want aborted %v", err, tt.wantAborted)
+			}
+			if asked != tt.wantAsked {
+				t.Errorf("ConfirmEach() asked %d times, want %d", asked, tt.wantAsked)
+			}
+			if got := selectionQueries(confirmed); !slices.Equal(got, tt.wantConfirmed) {
+				t.Errorf("confirmed = %v, want %v", got, tt.wantConfirmed)
+			}
+			if got := selectionQueries(skipped); !slices.Equal(got, tt.wantSkipped) {
+				t.Errorf("skipped = %v, want %v", got, tt.wantSkipped)
+			}
+			// The plan decides category and hosts when the selections are applied
+			for _, selection := range confirmed {
+				if selection.Category != "" || selection.Hosts != nil {
+					t.Errorf("ConfirmEach() returned %s resolved against the plan", selection.Query)
+				}
+			}
+		})
+	}
+}
+
+func TestConfirmEach_Error(t *testing.T) {
+	selections := []Selection{{Query: "firefox", Package: &types.Package{PName: "firefox"}}}
+	failed := errors.New("no terminal")
+	_, _, err := ConfirmEach(selections, Plan{}, func(Selection) (Confirmation, error) {
+		return Confirm, failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("ConfirmEach() error = %v, want %v", err, failed)
+	}
+}
+
+func TestSelection_Describe(t *testing.T) {
+	selection := Selection{
+		Package:  &types.Package{PName: "numpy", FullPath: "python3Packages.numpy", Version: "2.1.0"},
+		Category: "dev/python",
+		Hosts:    []Host{{Name: "laptop"}, {Name: "desktop"}},
+	}
+	if got, want := selection.Describe(), "numpy (python3Packages.numpy 2.1.0) → dev/python on laptop, desktop"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+	selection.Hosts = nil
+	if got, want := selection.Describe(), "numpy (python3Packages.numpy 2.1.0) → dev/python on no hosts"; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
+
+func selectionQueries(selections []Selection) []string {
+	var names []string
+	for _, selection := range selections {
+		names = append(names, selection.Query)
+	}
+	return names
+}
@@ -0,0 +1,142 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"pam/internal/assets"
+	"pam/internal/modules"
+	"pam/internal/nixconfig"
+)
+
+// Duplicate is an existing install of a selected package somewhere else than where the
+// install would put it, either a module in another category or a host package list
+type Duplicate struct {
+	// Selection is the index of the selection in the list passed to FindDuplicates
+	Selection int
+	// Module is the existing module, its Path is empty when hosts list the package directly
+	Module modules.Module
+	// Name is the option name of the module in the apps section
+	Name string
+	// Hosts mention the module in their apps section, or list the package in Listed
+	Hosts []Host
+	// Enabled are the names of the hosts enabling the module
+	Enabled []string
+	// Listed is the package list option holding the package, e.g. environment.systemPackages
+	Listed string
+}
+
+func (d Duplicate) String() string {
+	names := make([]string, len(d.Hosts))
+	for i, host := range d.Hosts {
+		names[i] = host.Name
+	}
+	if d.Module.Path == "" {
+		return fmt.Sprintf("listed in %s of %s", d.Listed, strings.Join(names, ", "))
+	}
+	if len(d.Enabled) == 0 {
+		return fmt.Sprintf("%s, enabled on no host", d.Module.Path)
+	}
+	return fmt.Sprintf("%s, enabled on %s", d.Module.Path, strings.Join(d.Enabled, ", "))
+}
+
+// FindDuplicates looks for every selected package in the modules outside the file the
+// install would write, matching the attr path of their header or their mkApp name, and in
+// the package lists of hosts. hostFiles are the apps files of every host, missing ones are
+// skipped. Package lists are only checked for a module plan, a plain install adding the
+// package there already skips lists holding it.
+func (i *Installer) FindDuplicates(selections []Selection, plan Plan, hostFiles []Host) ([]Duplicate, error) {
+	var found []modules.Module
+	if _, err := os.Stat(i.ModulesDir); err == nil {
+		found, err = modules.Scan(i.ModulesDir)
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", i.ModulesDir, err)
+		}
+	}
+	type moduleInfo struct {
+		name   string
+		header modules.Header
+	}
+	infos := make([]moduleInfo, len(found))
+	for n, module := range found {
+		name, err := module.PackageName()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", module.Path, err)
+		}
+		header, _, _ := module.Header()
+		infos[n] = moduleInfo{name: name, header: header}
+	}
+
+	var configs []*nixconfig.Config
+	var readHosts []Host
+	for _, host := range hostFiles {
+		data, err := os.ReadFile(host.AppsFile)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", host.AppsFile, err)
+		}
+		nixcfg := nixconfig.NewConfig(string(data))
+		nixcfg.SetNamespace(i.Namespace)
+		configs = append(configs, nixcfg)
+		readHosts = append(readHosts, host)
+	}
+
+	var duplicates []Duplicate
+	for n, selection := range selections {
+		selection = plan.resolve(selection)
+		pkg := selection.Package
+		target := ModuleFile(i.ModulesDir, selection.Category, selection.Query)
+		for m, module := range found {
+			if module.Path == target || (infos[m].header.Attr != pkg.FullPath && infos[m].name != pkg.PName) {
+				continue
+			}
+			duplicate := Duplicate{Selection: n, Module: module, Name: infos[m].name}
+			for h, nixcfg := range configs {
+				enabled, ok := nixcfg.PackageEnabled(module.Category, infos[m].name)
+				if !ok {
+					continue
+				}
+				duplicate.Hosts = append(duplicate.Hosts, readHosts[h])
+				if enabled {
+					duplicate.Enabled = append(duplicate.Enabled, readHosts[h].Name)
+				}
+			}
+			duplicates = append(duplicates, duplicate)
+		}
+
+		if plan.Plain {
+			continue
+		}
+		for _, option := range nixconfig.PackageListOptions {
+			duplicate := Duplicate{Selection: n, Listed: option}
+			for h, nixcfg := range configs {
+				if nixcfg.InPackageList(option, assets.PackageRef(pkg)) {
+					duplicate.Hosts = append(duplicate.Hosts, readHosts[h])
+				}
+			}
+			if len(duplicate.Hosts) > 0 {
+				duplicates = append(duplicates, duplicate)
+			}
+		}
+	}
+	return duplicates, nil
+}
+
+// moveHosts adds the hosts enabling the module a selection moves to its hosts, so they
+// keep the package
+func moveHosts(selection Selection) []Host {
+	hosts := selection.Hosts
+	for _, host := range selection.Moves.Hosts {
+		if !slices.Contains(selection.Moves.Enabled, host.Name) {
+			continue
+		}
+		if !slices.ContainsFunc(hosts, func(h Host) bool { return h.AppsFile == host.AppsFile }) {
+			hosts = append(slices.Clip(hosts), host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,141 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInstaller_FindDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules map[string]string
+		laptop  string
+		// want are the modules found, relative to the module directory, or the package list option
+		want        []string
+		wantEnabled []string
+	}{
+		{
+			name:    "no other module",
+			modules: map[string]string{"dev/git.nix": "mkApp {\n  name = \"git\";\n}\n"},
+			laptop:  "{\n  apps = {\n  };\n}\n",
+		},
+		{
+			name:    "target module is not a duplicate",
+			modules: map[string]string{"browsers/firefox.nix": "# pam: attr=firefox version=1\nmkApp {\n  name = \"firefox\";\n}\n"},
+			laptop:  "{\n  apps = {\n  };\n}\n",
+		},
+		{
+			name:        "same name in another category",
+			modules:     map[string]string{"web/firefox.nix": "mkApp {\n  name = \"firefox\";\n}\n"},
+			laptop:      "{\n  apps = {\n    web = {\n      firefox.enable = true;\n    };\n  };\n}\n",
+			want:        []string{"web/firefox.nix"},
+			wantEnabled: []string{"laptop"},
+		},
+		{
+			name:    "same attr under another name",
+			modules: map[string]string{"web/ff.nix": "# pam: attr=firefox version=1\nmkApp {\n  name = \"ff\";\n}\n"},
+			laptop:  "{\n  apps = {\n    web = {\n      ff.enable = false;\n    };\n  };\n}\n",
+			want:    []string{"web/ff.nix"},
+		},
+		{
+			name:   "listed in a package list",
+			laptop: "{ pkgs, ... }:\n{\n  environment.systemPackages = [\n    pkgs.firefox\n  ];\n}\n",
+			want:   []string{"environment.systemPackages"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, targets := setupFlake(t, "laptop")
+			modulesDir := filepath.Join(root, "modules", "apps")
+			for path, content := range tt.modules {
+				path = filepath.Join(modulesDir, path)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatalf("Failed to write module: %v", err)
+				}
+			}
+			if err := os.WriteFile(targets[0].AppsFile, []byte(tt.laptop), 0o644); err != nil {
+				t.Fatalf("Failed to write configuration.nix: %v", err)
+			}
+
+			inst := &Installer{ModulesDir: modulesDir}
+			pkg := linuxPackage("firefox")
+			// Hosts without an apps file are skipped
+			hostFiles := append(targets, Host{Name: "server", AppsFile: filepath.Join(root, "hosts", "server", "configuration.nix")})
+			duplicates, err := inst.FindDuplicates([]Selection{{Query: "firefox", Package: &pkg}}, Plan{Category: "browsers"}, hostFiles)
+			if err != nil {
+				t.Fatalf("FindDuplicates() error = %v", err)
+			}
+
+			var got []string
+			for _, duplicate := range duplicates {
+				if duplicate.Module.Path == "" {
+					got = append(got, duplicate.Listed)
+					continue
+				}
+				rel, _ := filepath.Rel(modulesDir, duplicate.Module.Path)
+				got = append(got, filepath.ToSlash(rel))
+				if !slices.Equal(duplicate.Enabled, tt.wantEnabled) {
+					t.Errorf("Enabled = %v, want %v", duplicate.Enabled, tt.wantEnabled)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindDuplicates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstaller_ApplyMove(t *testing.T) {
+	root, targets := setupFlake(t, "laptop", "desktop")
+	modulesDir := filepath.Join(root, "modules", "apps")
+	oldModule := filepath.Join(modulesDir, "web", "firefox.nix")
+	if err := os.MkdirAll(filepath.Dir(oldModule), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(oldModule, []byte("mkApp {\n  name = \"firefox\";\n}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	laptop := "{\n  apps = {\n    web = {\n      firefox.enable = true;\n    };\n  };\n}\n"
+	if err := os.WriteFile(targets[0].AppsFile, []byte(laptop), 0o644); err != nil {
+		t.Fatalf("Failed to write configuration.nix: %v", err)
+	}
+
+	inst := &Installer{ModulesDir: modulesDir}
+	pkg := linuxPackage("firefox")
+	selections := []Selection{{Query: "firefox", Package: &pkg}}
+	plan := Plan{Category: "browsers", Hosts: targets[1:]}
+	duplicates, err := inst.FindDuplicates(selections, plan, targets)
+	if err != nil || len(duplicates) != 1 {
+		t.Fatalf("FindDuplicates() = %v, %v, want one duplicate", duplicates, err)
+	}
+	selections[0].Moves = &duplicates[0]
+
+	summary, err := inst.Apply(selections, plan)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if _, err := os.Stat(oldModule); !os.IsNotExist(err) {
+		t.Errorf("moved module still exists: %v", err)
+	}
+	if _, err := os.Stat(ModuleFile(modulesDir, "browsers", "firefox")); err != nil {
+		t.Errorf("new module was not written: %v", err)
+	}
+	// The host enabling the old module keeps the package
+	if len(summary.Results) != 1 || len(summary.Results[0].Hosts) != 2 {
+		t.Errorf("Apply() results = %+v, want firefox on both hosts", summary.Results)
+	}
+	content, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+	if strings.Count(string(content), "firefox.enable") != 1 || !strings.Contains(string(content), "browsers = {\n      firefox.enable = true;") {
+		t.Errorf("laptop still enables the moved module:\n%s", content)
+	}
+}
@@ -0,0 +1,65 @@
+package installer
+
+import "fmt"
+
+// EditorMode decides which generated modules are opened in the editor after an install
+type EditorMode string
+
+const (
+	// EditorAsk prompts whether to open the modules
+	EditorAsk EditorMode = "ask"
+	// EditorNewOnly opens only modules that were created by this install
+	EditorNewOnly EditorMode = "new-only"
+	// EditorAlways opens every module of the install
+	EditorAlways EditorMode = "always"
+	// EditorNever does not open anything
+	EditorNever EditorMode = "never"
+)
+
+// ResolveEditorMode combines the configured open_after_install value with the
+// --editor-after and --no-editor flags, which take precedence over the config
+func ResolveEditorMode(configured string, editorAfter bool, noEditor bool) (EditorMode, error) {
+	if editorAfter && noEditor {
+		return "", fmt.Errorf("--editor-after and --no-editor cannot be used together")
+	}
+	if editorAfter {
+		return EditorAlways, nil
+	}
+	if noEditor {
+		return EditorNever, nil
+	}
+
+	switch mode := EditorMode(configured); mode {
+	case "":
+		return EditorAsk, nil
+	case EditorAsk, EditorNewOnly, EditorAlways, EditorNever:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid open_after_install '%s', expected ask, new-only, always or never", configured)
+	}
+}
+
+// ModulesToEdit returns the module files to open for the given mode.
+// In ask mode confirmed carries the user's answer.
+func (s *Summary) ModulesToEdit(mode EditorMode, confirmed bool) []string {
+	var files []string
+	for _, result := range s.Results {
+		// Plain installs have no module to open
+		if result.ModuleFile == "" {
+			continue
+		}
+		switch mode {
+		case EditorAlways:
+			files = append(files, result.ModuleFile)
+		case EditorAsk:
+			if confirmed {
+				files = append(files, result.ModuleFile)
+			}
+		case EditorNewOnly:
+			if result.Status == Created {
+				files = append(files, result.ModuleFile)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,72 @@
+package installer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveEditorMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		configured  string
+		editorAfter bool
+		noEditor    bool
+		want        EditorMode
+		wantErr     bool
+	}{
+		{name: "unset config asks", configured: "", want: EditorAsk},
+		{name: "configured new-only", configured: "new-only", want: EditorNewOnly},
+		{name: "configured never", configured: "never", want: EditorNever},
+		{name: "editor-after flag wins", configured: "never", editorAfter: true, want: EditorAlways},
+		{name: "no-editor flag wins", configured: "always", noEditor: true, want: EditorNever},
+		{name: "conflicting flags", editorAfter: true, noEditor: true, wantErr: true},
+		{name: "invalid config", configured: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveEditorMode(tt.configured, tt.editorAfter, tt.noEditor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveEditorMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveEditorMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummary_ModulesToEdit(t *testing.T) {
+	newModule := Result{ModuleFile: "browsers/firefox.nix", Status: Created}
+	updatedModule := Result{ModuleFile: "browsers/chromium.nix", Status: Updated}
+	existingModule := Result{ModuleFile: "editors/vim.nix", Status: Unchanged}
+
+	tests := []struct {
+		name      string
+		mode      EditorMode
+		confirmed bool
+		results   []Result
+		want      []string
+	}{
+		{name: "new-only with new module", mode: EditorNewOnly, results: []Result{newModule}, want: []string{"browsers/firefox.nix"}},
+		{name: "new-only with existing module", mode: EditorNewOnly, results: []Result{existingModule}, want: nil},
+		{name: "new-only with updated module", mode: EditorNewOnly, results: []Result{updatedModule}, want: nil},
+		{name: "new-only with mixed modules", mode: EditorNewOnly, results: []Result{existingModule, newModule}, want: []string{"browsers/firefox.nix"}},
+		{name: "always with new module", mode: EditorAlways, results: []Result{newModule}, want: []string{"browsers/firefox.nix"}},
+		{name: "always with existing module", mode: EditorAlways, results: []Result{existingModule}, want: []string{"editors/vim.nix"}},
+		{name: "never with new module", mode: EditorNever, results: []Result{newModule}, want: nil},
+		{name: "never with existing module", mode: EditorNever, results: []Result{existingModule}, want: nil},
+		{name: "ask confirmed", mode: EditorAsk, confirmed: true, results: []Result{newModule, existingModule}, want: []string{"browsers/firefox.nix", "editors/vim.nix"}},
+		{name: "ask declined", mode: EditorAsk, confirmed: false, results: []Result{newModule}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := &Summary{Results: tt.results}
+			got := summary.ModulesToEdit(tt.mode, tt.confirmed)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ModulesToEdit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package installer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"pam/internal/types"
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+	envNamePattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	attrPathPattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*(\.[A-Za-z_][A-Za-z0-9_'-]*)*$`)
+)
+
+// ExtrasInput are the answers of the extras prompt of pam install --extras
+type ExtrasInput struct {
+	// Override has one `name = value` argument per line, the values being nix expressions
+	Override string
+	// Packages are nixpkgs attribute paths separated by spaces
+	Packages string
+	// Env has one NAME=value environment variable per line
+	Env string
+	// Service names the services.<name> module to enable
+	Service string
+}
+
+// Parse checks the answers and returns the extras they ask for, nil when they are empty
+func (in ExtrasInput) Parse() (*types.Extras, error) {
+	extras := &types.Extras{}
+	var err error
+	extras.Override, err = parseSettings(in.Override, identifierPattern, "override argument", true)
+	if err != nil {
+		return nil, err
+	}
+	extras.Env, err = parseSettings(in.Env, envNamePattern, "environment variable", false)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range strings.Fields(in.Packages) {
+		if !attrPathPattern.MatchString(attr) {
+			return nil, fmt.Errorf("invalid package '%s', use an attribute path such as python3Packages.numpy", attr)
+		}
+		extras.Packages = append(extras.Packages, attr)
+	}
+	extras.Service = strings.TrimSpace(in.Service)
+	if extras.Service != "" && !identifierPattern.MatchString(extras.Service) {
+		return nil, fmt.Errorf("invalid service '%s', use the name of a services.<name> module", extras.Service)
+	}
+
+	if len(extras.Override) == 0 && len(extras.Packages) == 0 && len(extras.Env) == 0 && extras.Service == "" {
+		return nil, nil
+	}
+	return extras, nil
+}
+
+// parseSettings reads one name=value pair per line. Nix values may end in the semicolon
+// of an attribute set and can't be empty, environment variables can.
+func parseSettings(text string, names *regexp.Regexp, kind string, nixValues bool) ([]types.Setting, error) {
+	example := "NAME=value"
+	if nixValues {
+		example = "name = value"
+	}
+	var settings []types.Setting
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if nixValues {
+			value = strings.TrimSpace(strings.TrimSuffix(value, ";"))
+		}
+		if !ok || !names.MatchString(name) || (nixValues && value == "") {
+			return nil, fmt.Errorf("invalid %s '%s', write %s", kind, line, example)
+		}
+		settings = append(settings, types.Setting{Name: name, Value: value})
+	}
+	return settings, nil
+}
@@ -0,0 +1,52 @@
+package installer
+
+import (
+	"reflect"
+	"testing"
+
+	"pam/internal/types"
+)
+
+func TestExtrasInput_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   ExtrasInput
+		want    *types.Extras
+		wantErr bool
+	}{
+		{name: "empty", input: ExtrasInput{Override: "\n  \n"}, want: nil},
+		{
+			name: "all",
+			input: ExtrasInput{
+				Override: "youtubeSupport = true;\ncudaSupport=false\n",
+				Packages: " yt-dlp  python3Packages.mutagen ",
+				Env:      "MPV_HOME=~/.mpv\nEMPTY=\n",
+				Service:  " mpd ",
+			},
+			want: &types.Extras{
+				Override: []types.Setting{{Name: "youtubeSupport", Value: "true"}, {Name: "cudaSupport", Value: "false"}},
+				Packages: []string{"yt-dlp", "python3Packages.mutagen"},
+				Env:      []types.Setting{{Name: "MPV_HOME", Value: "~/.mpv"}, {Name: "EMPTY", Value: ""}},
+				Service:  "mpd",
+			},
+		},
+		{name: "value with equals", input: ExtrasInput{Env: "FLAGS=a=b"}, want: &types.Extras{Env: []types.Setting{{Name: "FLAGS", Value: "a=b"}}}},
+		{name: "override without value", input: ExtrasInput{Override: "youtubeSupport ="}, wantErr: true},
+		{name: "override without equals", input: ExtrasInput{Override: "youtubeSupport"}, wantErr: true},
+		{name: "invalid env name", input: ExtrasInput{Env: "MY-VAR=1"}, wantErr: true},
+		{name: "invalid package", input: ExtrasInput{Packages: "pkgs/ffmpeg"}, wantErr: true},
+		{name: "invalid service", input: ExtrasInput{Service: "my service"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.input.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,546 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"pam/internal/assets"
+	"pam/internal/backup"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/homebrew"
+	"pam/internal/hosts"
+	"pam/internal/modules"
+	"pam/internal/nixconfig"
+	"pam/internal/nixvalidate"
+	"pam/internal/search"
+	"pam/internal/strict"
+	"pam/internal/types"
+)
+
+// ErrRetry asks Resolve to search again, e.g. after the picker switched the nixpkgs branch
+var ErrRetry = errors.New("retry search")
+
+// Searcher looks up the candidate packages for a search term
+type Searcher interface {
+	Search(query string) ([]types.Package, error)
+}
+
+// Picker chooses the packages to install among the candidates found for query, usually
+// one. It may return ErrRetry to run the search again.
+type Picker func(query string, candidates []types.Package) ([]types.Package, error)
+
+// Selection is a search term resolved to the package that will be installed
+type Selection struct {
+	Query   string
+	Package *types.Package
+	// Category and Hosts override the plan for this package when set
+	Category string
+	Hosts    []Host
+	// Moves is an existing module of the package in another category. It is deleted, and
+	// the hosts enabling it enable the new module instead.
+	Moves *Duplicate
+}
+
+// Status describes what happened to a module file
+type Status string
+
+const (
+	Created   Status = "created"
+	Updated   Status = "updated"
+	Unchanged Status = "unchanged"
+	// Kept is an existing module that differs from the generated one and was left as it is
+	Kept Status = "kept"
+)
+
+// Result is the outcome of installing a single selection
+type Result struct {
+	Selection
+	ModuleFile string
+	Status     Status
+	// Generated is the module pam generated, also when the existing one was kept or merged
+	Generated string
+}
+
+// Host is a host to enable the packages on, with the file holding its apps section
+type Host struct {
+	Name     string
+	AppsFile string
+}
+
+// Plan holds the choices shared by every package of one install
+type Plan struct {
+	Category    string
+	UseHomebrew bool
+	Hosts       []Host
+	// Template generates the modules, the one bundled with pam is used when nil
+	Template *template.Template
+	// Plain lists the packages in each host's environment.systemPackages or home.packages
+	// instead of generating modules, for flakes that don't use mkApp
+	Plain bool
+}
+
+// resolve fills in the plan's category and hosts where the selection doesn't override them
+func (p Plan) resolve(selection Selection) Selection {
+	if selection.Category == "" {
+		selection.Category = p.Category
+	}
+	if selection.Hosts == nil {
+		selection.Hosts = p.Hosts
+	}
+	if selection.Moves != nil {
+		selection.Hosts = moveHosts(selection)
+	}
+	return selection
+}
+
+// hostPackages are the packages one host enables, grouped by category in install order
+type hostPackages struct {
+	host       Host
+	categories []string
+	packages   map[string][]string
+	// removed are the entries of moved modules, by category
+	removed map[string][]string
+}
+
+// groupByHost collects the packages every host enables, hosts are kept in the order they first appear
+func groupByHost(selections []Selection) []*hostPackages {
+	var groups []*hostPackages
+	byFile := map[string]*hostPackages{}
+	groupOf := func(host Host) *hostPackages {
+		group, ok := byFile[host.AppsFile]
+		if !ok {
+			group = &hostPackages{host: host, packages: map[string][]string{}, removed: map[string][]string{}}
+			byFile[host.AppsFile] = group
+			groups = append(groups, group)
+		}
+		return group
+	}
+	for _, selection := range selections {
+		if selection.Moves != nil {
+			for _, host := range selection.Moves.Hosts {
+				group := groupOf(host)
+				group.removed[selection.Moves.Module.Category] = append(group.removed[selection.Moves.Module.Category], selection.Moves.Name)
+			}
+		}
+		for _, host := range selection.Hosts {
+			group := groupOf(host)
+			if _, ok := group.packages[selection.Category]; !ok {
+				group.categories = append(group.categories, selection.Category)
+			}
+			group.packages[selection.Category] = append(group.packages[selection.Category], selection.Package.PName)
+		}
+	}
+	return groups
+}
+
+func (g *hostPackages) edit(nixcfg *nixconfig.Config, namespace string) error {
+	for category, names := range g.removed {
+		for _, name := range names {
+			err := hosts.RemoveEdit(namespace, category, name)(nixcfg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, category := range g.categories {
+		err := hosts.EnableEdit(namespace, category, g.packages[category]...)(nixcfg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Summary collects the results of an install and every file it touched
+type Summary struct {
+	Results      []Result
+	Hosts        []string
+	ChangedFiles []string
+	AddedFiles   []string
+	// Changes holds the content of every file before and after the install
+	Changes []diff.Change
+	// Skipped are the packages left out when asked about each one
+	Skipped []Selection
+}
+
+type Installer struct {
+	ModulesDir string
+	// Namespace is the attribute path the hosts enable modules under, e.g. apps
+	Namespace string
+	Searcher  Searcher
+	Pick      Picker
+	// Policy decides whether warnings are fatal, it is only consulted when Git is set
+	Policy *strict.Policy
+	// Git is the repository tracking the flake, nil when it is not a git repository
+	Git *gitops.Repo
+	// TrackNew is set when new files are added to git after the install, so they don't
+	// stay untracked
+	TrackNew bool
+	// DryRun computes every change without writing any file
+	DryRun bool
+	// Backup saves the originals of files before they are written, nil to skip backups
+	Backup *backup.Snapshot
+	// Validator checks every changed file before anything is written, nil to skip validation
+	Validator nixvalidate.Validator
+	// Pin finds a version asked for with name@version in a past nixpkgs, nil refuses versions
+	Pin func(name string, version string) (*types.Package, error)
+	// FromFlake looks up a package named by flake reference and attribute, e.g.
+	// github:owner/repo#tool, without searching. nil refuses flake references.
+	FromFlake func(ref string, attr string) (*types.Package, error)
+	// FromTap makes the package of a formula of a Homebrew tap, asked for as
+	// owner/repo/formula, for the darwin hosts. nil refuses taps.
+	FromTap func(tap string, formula string) (*types.Package, error)
+	// BeforeWrite sees every change once it is checked, an error stops the install
+	// before any file is written
+	BeforeWrite func(summary *Summary) error
+	// Conflict decides what an existing module that differs from the generated one
+	// becomes and returns the content to write: change.Old keeps it, change.New overwrites
+	// it. The module is overwritten when nil.
+	Conflict func(change diff.Change) (string, error)
+}
+
+// ModuleFile returns where the module generated for query in category lives
+func ModuleFile(modulesDir string, category string, query string) string {
+	return filepath.Join(modulesDir, category, query) + ".nix"
+}
+
+// Resolve searches every query and lets the picker choose the packages for each one.
+// Queries such as firefox@119 are pinned to that version instead, and flake references
+// such as github:owner/repo#tool are taken from that flake. Formulae of a Homebrew tap,
+// such as owner/repo/formula, are installed by Homebrew on darwin hosts.
+func (i *Installer) Resolve(queries []string) ([]Selection, error) {
+	selections := make([]Selection, 0, len(queries))
+	for _, query := range queries {
+		ref, attr, fromFlake := search.SplitFlakeRef(query)
+		tap, formula, fromTap := homebrew.SplitTapFormula(query)
+		name, version, pinned := strings.Cut(query, "@")
+		switch {
+		case fromFlake && i.FromFlake == nil:
+			return nil, fmt.Errorf("resolving %s: installing from a flake reference isn't supported here", query)
+		case fromFlake:
+			pkg, err := i.FromFlake(ref, attr)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %w", query, err)
+			}
+			selections = append(selections, Selection{Query: pkg.PName, Package: pkg})
+		case fromTap && i.FromTap == nil:
+			return nil, fmt.Errorf("resolving %s: installing from a Homebrew tap isn't supported here", query)
+		case fromTap:
+			pkg, err := i.FromTap(tap, formula)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %w", query, err)
+			}
+			selections = append(selections, Selection{Query: formula, Package: pkg})
+		case pinned && i.Pin == nil:
+			return nil, fmt.Errorf("resolving %s: installing a version with @ isn't supported here", query)
+		case pinned:
+			// The module is named after the package, the version is in its header
+			pkg, err := i.Pin(name, version)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %w", name, err)
+			}
+			selections = append(selections, Selection{Query: name, Package: pkg})
+		default:
+			picked, err := i.resolveOne(query)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %w", query, err)
+			}
+			selections = append(selections, Selections(query, picked)...)
+		}
+	}
+	return selections, nil
+}
+
+// Selections are the packages picked for query. A single package is installed under the
+// query, several are each named after their attribute, e.g. ripgrep and ripgrep-all.
+func Selections(query string, picked []types.Package) []Selection {
+	if len(picked) == 1 {
+		return []Selection{{Query: query, Package: &picked[0]}}
+	}
+	selections := make([]Selection, len(picked))
+	names := map[string]bool{}
+	for n := range picked {
+		pkg := &picked[n]
+		name := pkg.FullPath[strings.LastIndex(pkg.FullPath, ".")+1:]
+		if names[name] {
+			// python311Packages.numpy and python312Packages.numpy need modules of their own
+			name = strings.ReplaceAll(pkg.FullPath, ".", "-")
+		}
+		names[name] = true
+		selections[n] = Selection{Query: name, Package: pkg}
+	}
+	return selections
+}
+
+func (i *Installer) resolveOne(query string) ([]types.Package, error) {
+	for {
+		candidates, err := i.Searcher.Search(query)
+		if err != nil {
+			return nil, err
+		}
+
+		picked, err := i.Pick(query, candidates)
+		if errors.Is(err, ErrRetry) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(picked) == 0 {
+			return nil, fmt.Errorf("no package selected")
+		}
+		return picked, nil
+	}
+}
+
+// Apply writes a module for every selection and enables them on the planned hosts, or
+// lists them in the hosts' package lists for a plain plan.
+// Every change is computed and validated before the first file is written.
+func (i *Installer) Apply(selections []Selection, plan Plan) (*Summary, error) {
+	summary := &Summary{}
+
+	resolved := make([]Selection, len(selections))
+	for n, selection := range selections {
+		resolved[n] = plan.resolve(selection)
+	}
+
+	var err error
+	if plan.Plain {
+		err = i.planPlain(resolved, summary)
+	} else {
+		err = i.planModules(resolved, plan, summary)
+	}
+	if err != nil {
+		return summary, err
+	}
+
+	if i.Validator != nil {
+		for _, change := range summary.Changes {
+			if change.Old == change.New || change.New == "" {
+				continue
+			}
+			err := i.Validator.Validate(change.Path, []byte(change.New))
+			if err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	if i.DryRun {
+		return summary, nil
+	}
+	if i.BeforeWrite != nil {
+		err = i.BeforeWrite(summary)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, i.write(summary.Changes)
+}
+
+// planModules computes the module of every selection and the host edits enabling them
+func (i *Installer) planModules(resolved []Selection, plan Plan, summary *Summary) error {
+	// Check every module before writing anything so strict mode fails without side effects
+	if i.Git != nil && !i.TrackNew {
+		for _, selection := range resolved {
+			moduleFile := ModuleFile(i.ModulesDir, selection.Category, selection.Query)
+			if _, err := os.Stat(moduleFile); !os.IsNotExist(err) {
+				continue
+			}
+			err := i.Policy.Warn(strict.UntrackedFile, "%s will not be tracked by git, nix flakes ignore it until you run git add", moduleFile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	imports := modules.NewImports(i.ModulesDir)
+	for _, selection := range resolved {
+		result, change, err := i.moduleChange(selection, plan)
+		if err != nil {
+			return err
+		}
+		summary.Results = append(summary.Results, result)
+		summary.Changes = append(summary.Changes, change)
+
+		switch result.Status {
+		case Created:
+			summary.AddedFiles = append(summary.AddedFiles, result.ModuleFile)
+			err = imports.Add(result.ModuleFile)
+			if err != nil {
+				return err
+			}
+		case Updated:
+			summary.ChangedFiles = append(summary.ChangedFiles, result.ModuleFile)
+		}
+
+		// The moved module is deleted, see diff.Apply
+		if selection.Moves != nil {
+			existing, err := os.ReadFile(selection.Moves.Module.Path)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", selection.Moves.Module.Path, err)
+			}
+			summary.ChangedFiles = append(summary.ChangedFiles, selection.Moves.Module.Path)
+			summary.Changes = append(summary.Changes, diff.Change{Path: selection.Moves.Module.Path, Old: string(existing)})
+			err = imports.Remove(selection.Moves.Module.Path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The default.nix files listing the modules of their folder
+	for _, change := range imports.Changes() {
+		if change.Old == "" {
+			summary.AddedFiles = append(summary.AddedFiles, change.Path)
+		} else {
+			summary.ChangedFiles = append(summary.ChangedFiles, change.Path)
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+
+	// Every host file is read and edited at once, nothing is written yet
+	groups := groupByHost(resolved)
+	changes := make([]diff.Change, len(groups))
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for n, group := range groups {
+		wg.Go(func() {
+			changes[n], errs[n] = hosts.Edit(group.host.AppsFile, func(nixcfg *nixconfig.Config) error {
+				return group.edit(nixcfg, i.Namespace)
+			})
+		})
+	}
+	wg.Wait()
+
+	for n, group := range groups {
+		if errs[n] != nil {
+			return fmt.Errorf("updating host %s: %w", group.host.Name, errs[n])
+		}
+		summary.Hosts = append(summary.Hosts, group.host.Name)
+		summary.ChangedFiles = append(summary.ChangedFiles, group.host.AppsFile)
+		summary.Changes = append(summary.Changes, changes[n])
+	}
+	return nil
+}
+
+// plainEntry is what a plain install adds to a host for the package, its reference or
+// the programs.<name> module enabling it
+func plainEntry(pkg *types.Package) string {
+	if pkg.Program != "" {
+		return "programs." + pkg.Program
+	}
+	return assets.PackageRef(pkg)
+}
+
+// planPlain computes the host edits listing every selection in the hosts' package lists,
+// or enabling its programs.<name> module
+func (i *Installer) planPlain(resolved []Selection, summary *Summary) error {
+	var files []Host
+	refs := map[string][]*types.Package{}
+	for _, selection := range resolved {
+		for _, host := range selection.Hosts {
+			if _, ok := refs[host.AppsFile]; !ok {
+				files = append(files, host)
+			}
+			refs[host.AppsFile] = append(refs[host.AppsFile], selection.Package)
+		}
+	}
+
+	added := map[string]bool{}
+	for _, host := range files {
+		change, err := hosts.Edit(host.AppsFile, func(nixcfg *nixconfig.Config) error {
+			option := nixcfg.PackageListOption()
+			if option == "" {
+				option = nixconfig.PackageListOptions[0]
+			}
+			for _, pkg := range refs[host.AppsFile] {
+				var isNew bool
+				var err error
+				if pkg.Program != "" {
+					isNew, err = nixcfg.EnableProgram(pkg.Program)
+				} else {
+					isNew, err = nixcfg.AddToPackageList(option, assets.PackageRef(pkg))
+				}
+				if err != nil {
+					return err
+				}
+				added[plainEntry(pkg)] = added[plainEntry(pkg)] || isNew
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("updating host %s: %w", host.Name, err)
+		}
+		summary.Hosts = append(summary.Hosts, host.Name)
+		summary.ChangedFiles = append(summary.ChangedFiles, host.AppsFile)
+		summary.Changes = append(summary.Changes, change)
+	}
+
+	for _, selection := range resolved {
+		result := Result{Selection: selection, Status: Unchanged}
+		if added[plainEntry(selection.Package)] {
+			result.Status = Updated
+		}
+		summary.Results = append(summary.Results, result)
+	}
+	return nil
+}
+
+// moduleChange renders the module for selection and compares it with the file on disk
+func (i *Installer) moduleChange(selection Selection, plan Plan) (Result, diff.Change, error) {
+	modulePackage := assets.FillPackageTemplate(selection.Package, plan.UseHomebrew, i.Namespace)
+	if plan.Template != nil {
+		var err error
+		modulePackage, err = assets.FillTemplate(plan.Template, selection.Package, plan.UseHomebrew, i.Namespace)
+		if err != nil {
+			return Result{}, diff.Change{}, err
+		}
+	}
+	moduleFile := ModuleFile(i.ModulesDir, selection.Category, selection.Query)
+	result := Result{Selection: selection, ModuleFile: moduleFile, Generated: modulePackage}
+
+	existing, err := os.ReadFile(moduleFile)
+	change := diff.Change{Path: moduleFile, Old: string(existing), New: modulePackage}
+	switch {
+	case err != nil:
+		result.Status = Created
+	case string(existing) == modulePackage:
+		result.Status = Unchanged
+	case i.Conflict == nil:
+		result.Status = Updated
+	default:
+		change.New, err = i.Conflict(change)
+		if err != nil {
+			return Result{}, diff.Change{}, err
+		}
+		result.Status = Updated
+		if change.New == change.Old {
+			result.Status = Kept
+		}
+	}
+	return result, change, nil
+}
+
+// write backs up every changed file, then writes them all. When one write fails the
+// files written before it are restored, so the hosts never end up half updated.
+func (i *Installer) write(changes []diff.Change) error {
+	if i.Backup != nil {
+		for _, change := range changes {
+			if change.Old == change.New {
+				continue
+			}
+			err := i.Backup.Save(change.Path)
+			if err != nil {
+				return fmt.Errorf("backing up %s: %w", change.Path, err)
+			}
+		}
+	}
+	return diff.Apply(changes)
+}
@@ -0,0 +1,758 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/backup"
+	"pam/internal/diff"
+	"pam/internal/gitops"
+	"pam/internal/homebrew"
+	"pam/internal/nixconfig"
+	"pam/internal/nixvalidate"
+	"pam/internal/strict"
+	"pam/internal/types"
+)
+
+type mockSearcher struct {
+	results  map[string][]types.Package
+	searches []string
+}
+
+func (m *mockSearcher) Search(query string) ([]types.Package, error) {
+	m.searches = append(m.searches, query)
+	results, ok := m.results[query]
+	if !ok {
+		return nil, fmt.Errorf("search failed for %s", query)
+	}
+	return results, nil
+}
+
+func pickFirst(query string, candidates []types.Package) ([]types.Package, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no packages found for %s", query)
+	}
+	return candidates[:1], nil
+}
+
+func linuxPackage(name string) types.Package {
+	return types.Package{PName: name, FullPath: name, System: "x86_64-linux", Description: name + " package"}
+}
+
+// setupFlake creates a flake with a browsers category and the given hosts
+func setupFlake(t *testing.T, hostNames ...string) (string, []Host) {
+	t.Helper()
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "modules", "apps", "browsers"), 0o755); err != nil {
+		t.Fatalf("Failed to create modules directory: %v", err)
+	}
+
+	var targets []Host
+	for _, name := range hostNames {
+		hostDir := filepath.Join(root, "hosts", name)
+		if err := os.MkdirAll(hostDir, 0o755); err != nil {
+			t.Fatalf("Failed to create host directory: %v", err)
+		}
+		appsFile := filepath.Join(hostDir, "configuration.nix")
+		if err := os.WriteFile(appsFile, []byte("{ ... }:\n{\n  apps = {\n  };\n}\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write configuration.nix: %v", err)
+		}
+		targets = append(targets, Host{Name: name, AppsFile: appsFile})
+	}
+	return root, targets
+}
+
+func TestInstaller_MultiplePackages(t *testing.T) {
+	tests := []struct {
+		name    string
+		queries []string
+		hosts   []string
+	}{
+		{
+			name:    "two packages",
+			queries: []string{"firefox", "chromium"},
+			hosts:   []string{"laptop"},
+		},
+		{
+			name:    "three packages on two hosts",
+			queries: []string{"firefox", "chromium", "vim"},
+			hosts:   []string{"laptop", "desktop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, targets := setupFlake(t, tt.hosts...)
+			searcher := &mockSearcher{results: map[string][]types.Package{
+				"firefox":  {linuxPackage("firefox"), linuxPackage("firefox-esr")},
+				"chromium": {linuxPackage("chromium")},
+				"vim":      {linuxPackage("vim")},
+			}}
+			inst := &Installer{
+				ModulesDir: filepath.Join(root, "modules", "apps"),
+				Searcher:   searcher,
+				Pick:       pickFirst,
+			}
+
+			selections, err := inst.Resolve(tt.queries)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if len(selections) != len(tt.queries) {
+				t.Fatalf("Resolve() returned %d selections, want %d", len(selections), len(tt.queries))
+			}
+			if strings.Join(searcher.searches, ",") != strings.Join(tt.queries, ",") {
+				t.Errorf("searched %v, want %v", searcher.searches, tt.queries)
+			}
+
+			summary, err := inst.Apply(selections, Plan{Category: "browsers", Hosts: targets})
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if len(summary.Results) != len(tt.queries) {
+				t.Errorf("Apply() returned %d results, want %d", len(summary.Results), len(tt.queries))
+			}
+			if len(summary.AddedFiles) != len(tt.queries) {
+				t.Errorf("Apply() added %d files, want %d", len(summary.AddedFiles), len(tt.queries))
+			}
+			if len(summary.Hosts) != len(tt.hosts) {
+				t.Errorf("Apply() updated %d hosts, want %d", len(summary.Hosts), len(tt.hosts))
+			}
+
+			for _, query := range tt.queries {
+				moduleFile := ModuleFile(inst.ModulesDir, "browsers", query)
+				content, err := os.ReadFile(moduleFile)
+				if err != nil {
+					t.Errorf("module for %s was not written: %v", query, err)
+					continue
+				}
+				if !strings.Contains(string(content), fmt.Sprintf("name = %q", query)) {
+					t.Errorf("module for %s has wrong content:\n%s", query, content)
+				}
+			}
+
+			for _, target := range targets {
+				content, err := os.ReadFile(target.AppsFile)
+				if err != nil {
+					t.Fatalf("Failed to read %s: %v", target.AppsFile, err)
+				}
+				for _, query := range tt.queries {
+					if !strings.Contains(string(content), query+".enable = true;") {
+						t.Errorf("host %s missing %s.enable:\n%s", target.Name, query, content)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInstaller_ApplyUnchangedModule(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps")}
+	selections := []Selection{{Query: "firefox", Package: &types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}}}
+	plan := Plan{Category: "browsers", Hosts: targets}
+
+	if _, err := inst.Apply(selections, plan); err != nil {
+		t.Fatalf("first Apply() error = %v", err)
+	}
+
+	summary, err := inst.Apply(selections, plan)
+	if err != nil {
+		t.Fatalf("second Apply() error = %v", err)
+	}
+	if summary.Results[0].Status != Unchanged {
+		t.Errorf("second Apply() status = %q, want %q", summary.Results[0].Status, Unchanged)
+	}
+	if len(summary.AddedFiles) != 0 {
+		t.Errorf("second Apply() added files %v, want none", summary.AddedFiles)
+	}
+}
+
+func TestInstaller_ApplyPlain(t *testing.T) {
+	root, targets := setupFlake(t, "laptop", "desktop")
+	if err := os.WriteFile(targets[1].AppsFile, []byte("{ pkgs, ... }:\n{\n  environment.systemPackages = with pkgs; [\n    firefox\n  ];\n}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write configuration.nix: %v", err)
+	}
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps")}
+	firefox := linuxPackage("firefox")
+	selections := []Selection{{Query: "firefox", Package: &firefox}}
+
+	summary, err := inst.Apply(selections, Plan{Hosts: targets, Plain: true})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if summary.Results[0].Status != Updated || summary.Results[0].ModuleFile != "" {
+		t.Errorf("Apply() result = %+v, want an updated result without module", summary.Results[0])
+	}
+	if _, err := os.Stat(ModuleFile(inst.ModulesDir, "", "firefox")); !os.IsNotExist(err) {
+		t.Errorf("Apply() wrote a module for a plain plan")
+	}
+
+	laptop, _ := os.ReadFile(targets[0].AppsFile)
+	if !strings.Contains(string(laptop), "environment.systemPackages = [\n    pkgs.firefox\n  ];") {
+		t.Errorf("laptop configuration.nix =\n%s", laptop)
+	}
+	desktop, _ := os.ReadFile(targets[1].AppsFile)
+	if strings.Count(string(desktop), "firefox") != 1 {
+		t.Errorf("desktop lists firefox twice:\n%s", desktop)
+	}
+
+	summary, err = inst.Apply(selections, Plan{Hosts: targets, Plain: true})
+	if err != nil {
+		t.Fatalf("second Apply() error = %v", err)
+	}
+	if summary.Results[0].Status != Unchanged {
+		t.Errorf("second Apply() status = %q, want %q", summary.Results[0].Status, Unchanged)
+	}
+}
+
+func TestInstaller_ApplyPlainProgram(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps")}
+	git := linuxPackage("git")
+	git.Program = "git"
+
+	summary, err := inst.Apply([]Selection{{Query: "git", Package: &git}}, Plan{Hosts: targets, Plain: true})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if summary.Results[0].Status != Updated {
+		t.Errorf("Apply() status = %q, want %q", summary.Results[0].Status, Updated)
+	}
+	laptop, _ := os.ReadFile(targets[0].AppsFile)
+	if !strings.Contains(string(laptop), "programs.git.enable = true;") || strings.Contains(string(laptop), "systemPackages") {
+		t.Errorf("laptop configuration.nix =\n%s", laptop)
+	}
+}
+
+func TestInstaller_ApplyOverrides(t *testing.T) {
+	root, targets := setupFlake(t, "laptop", "desktop")
+	laptop, desktop := targets[0], targets[1]
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps")}
+
+	firefox, chromium, vim := linuxPackage("firefox"), linuxPackage("chromium"), linuxPackage("vim")
+	selections := []Selection{
+		{Query: "firefox", Package: &firefox},
+		{Query: "chromium", Package: &chromium, Hosts: []Host{desktop}},
+		{Query: "vim", Package: &vim, Category: "editors"},
+	}
+
+	summary, err := inst.Apply(selections, Plan{Category: "browsers", Hosts: []Host{laptop}})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if strings.Join(summary.Hosts, ",") != "laptop,desktop" {
+		t.Errorf("Apply() updated hosts %v, want [laptop desktop]", summary.Hosts)
+	}
+	if summary.Results[2].Category != "editors" || summary.Results[0].Category != "browsers" {
+		t.Errorf("result categories = %q, %q", summary.Results[0].Category, summary.Results[2].Category)
+	}
+	if _, err := os.Stat(ModuleFile(inst.ModulesDir, "editors", "vim")); err != nil {
+		t.Errorf("vim module not written to its category: %v", err)
+	}
+
+	wantEnabled := map[string][]string{
+		laptop.AppsFile:  {"browsers = {", "firefox.enable = true;", "editors = {", "vim.enable = true;"},
+		desktop.AppsFile: {"chromium.enable = true;"},
+	}
+	for file, want := range wantEnabled {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		for _, line := range want {
+			if !strings.Contains(string(content), line) {
+				t.Errorf("%s missing %q:\n%s", file, line, content)
+			}
+		}
+	}
+	desktopContent, _ := os.ReadFile(desktop.AppsFile)
+	if strings.Contains(string(desktopContent), "firefox") {
+		t.Errorf("firefox enabled on desktop without being planned for it:\n%s", desktopContent)
+	}
+}
+
+func TestInstaller_ApplyDryRun(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps"), DryRun: true}
+	selections := []Selection{{Query: "firefox", Package: &types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}}}
+
+	before, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+
+	summary, err := inst.Apply(selections, Plan{Category: "browsers", Hosts: targets})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	moduleFile := ModuleFile(inst.ModulesDir, "browsers", "firefox")
+	if _, err := os.Stat(moduleFile); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s", moduleFile)
+	}
+	after, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("dry run changed %s:\n%s", targets[0].AppsFile, after)
+	}
+
+	if summary.Results[0].Status != Created {
+		t.Errorf("dry run status = %q, want %q", summary.Results[0].Status, Created)
+	}
+	if len(summary.Changes) != 2 {
+		t.Fatalf("dry run returned %d changes, want 2", len(summary.Changes))
+	}
+	if summary.Changes[0].Path != moduleFile || summary.Changes[0].Old != "" {
+		t.Errorf("module change = %+v", summary.Changes[0])
+	}
+	if !strings.Contains(summary.Changes[1].New, "firefox.enable = true;") {
+		t.Errorf("host change does not enable firefox:\n%s", summary.Changes[1].New)
+	}
+}
+
+func TestInstaller_ApplyBackup(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	store := backup.NewStore(filepath.Join(root, "backups"))
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps"), Backup: store.Begin("install firefox")}
+	selections := []Selection{{Query: "firefox", Package: &types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}}}
+
+	before, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+
+	if _, err := inst.Apply(selections, Plan{Category: "browsers", Hosts: targets}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if err := inst.Backup.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	last, err := store.Last()
+	if err != nil {
+		t.Fatalf("Last() error = %v", err)
+	}
+	if err := store.Restore(last); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	after, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("Restore() left %s as:\n%s", targets[0].AppsFile, after)
+	}
+	if _, err := os.Stat(ModuleFile(inst.ModulesDir, "browsers", "firefox")); !os.IsNotExist(err) {
+		t.Error("Restore() kept the created module")
+	}
+}
+
+func TestInstaller_ApplyInvalidChange(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	rejectHosts := nixvalidate.Func(func(path string, content []byte) error {
+		if filepath.Base(path) == "configuration.nix" {
+			return &nixvalidate.Error{Path: path, Output: "syntax error"}
+		}
+		return nil
+	})
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps"), Validator: rejectHosts}
+	selections := []Selection{{Query: "firefox", Package: &types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}}}
+
+	before, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+
+	_, err = inst.Apply(selections, Plan{Category: "browsers", Hosts: targets})
+	var validateErr *nixvalidate.Error
+	if !errors.As(err, &validateErr) {
+		t.Fatalf("Apply() error = %v, want *nixvalidate.Error", err)
+	}
+
+	if _, err := os.Stat(ModuleFile(inst.ModulesDir, "browsers", "firefox")); !os.IsNotExist(err) {
+		t.Error("Apply() wrote the module although a host config was invalid")
+	}
+	after, err := os.ReadFile(targets[0].AppsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", targets[0].AppsFile, err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("Apply() changed %s:\n%s", targets[0].AppsFile, after)
+	}
+}
+
+func TestInstaller_ApplyBeforeWrite(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	var seen []string
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps"), BeforeWrite: func(summary *Summary) error {
+		for _, change := range summary.Changes {
+			seen = append(seen, filepath.Base(change.Path))
+		}
+		return errors.New("hook failed")
+	}}
+	selections := []Selection{{Query: "firefox", Package: &types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}}}
+
+	_, err := inst.Apply(selections, Plan{Category: "browsers", Hosts: targets})
+	if err == nil || err.Error() != "hook failed" {
+		t.Fatalf("Apply() error = %v, want the BeforeWrite error", err)
+	}
+	if len(seen) != 2 {
+		t.Errorf("BeforeWrite saw %v, want the module and the host config", seen)
+	}
+	if _, err := os.Stat(ModuleFile(inst.ModulesDir, "browsers", "firefox")); !os.IsNotExist(err) {
+		t.Error("Apply() wrote the module although BeforeWrite failed")
+	}
+}
+
+func TestInstaller_ApplyFailedWriteRollsBack(t *testing.T) {
+	root, targets := setupFlake(t, "laptop", "desktop")
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps")}
+	// A file named like the category keeps the second module from being written
+	if err := os.MkdirAll(inst.ModulesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inst.ModulesDir, "editors"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	firefox, vim := linuxPackage("firefox"), linuxPackage("vim")
+	selections := []Selection{
+		{Query: "firefox", Package: &firefox},
+		{Query: "vim", Package: &vim, Category: "editors"},
+	}
+
+	before := map[string]string{}
+	for _, host := range targets {
+		content, _ := os.ReadFile(host.AppsFile)
+		before[host.AppsFile] = string(content)
+	}
+
+	_, err := inst.Apply(selections, Plan{Category: "browsers", Hosts: targets})
+	if err == nil {
+		t.Fatal("Apply() expected an error for the blocked category")
+	}
+	if _, err := os.Stat(ModuleFile(inst.ModulesDir, "browsers", "firefox")); !os.IsNotExist(err) {
+		t.Error("Apply() left the firefox module behind after a failed write")
+	}
+	for path, content := range before {
+		after, _ := os.ReadFile(path)
+		if string(after) != content {
+			t.Errorf("Apply() changed %s:\n%s", path, after)
+		}
+	}
+}
+
+func TestInstaller_ResolveRetry(t *testing.T) {
+	searcher := &mockSearcher{results: map[string][]types.Package{"vim": {linuxPackage("vim")}}}
+	attempts := 0
+	inst := &Installer{
+		Searcher: searcher,
+		Pick: func(query string, candidates []types.Package) ([]types.Package, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, ErrRetry
+			}
+			return candidates[:1], nil
+		},
+	}
+
+	selections, err := inst.Resolve([]string{"vim"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(searcher.searches) != 2 {
+		t.Errorf("Resolve() searched %d times, want 2", len(searcher.searches))
+	}
+	if selections[0].Package.PName != "vim" {
+		t.Errorf("Resolve() selected %q, want vim", selections[0].Package.PName)
+	}
+}
+
+func TestInstaller_ResolveSeveral(t *testing.T) {
+	searcher := &mockSearcher{results: map[string][]types.Package{"ripgrep": {linuxPackage("ripgrep"), linuxPackage("ripgrep-all"), linuxPackage("ugrep")}}}
+	inst := &Installer{
+		Searcher: searcher,
+		Pick: func(query string, candidates []types.Package) ([]types.Package, error) {
+			return candidates[:2], nil
+		},
+	}
+
+	selections, err := inst.Resolve([]string{"ripgrep"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	var got []string
+	for _, selection := range selections {
+		got = append(got, selection.Query+"="+selection.Package.FullPath)
+	}
+	if want := []string{"ripgrep=ripgrep", "ripgrep-all=ripgrep-all"}; !slices.Equal(got, want) {
+		t.Errorf("Resolve() = %v, want %v", got, want)
+	}
+}
+
+func TestSelections(t *testing.T) {
+	numpy311, numpy312 := linuxPackage("numpy"), linuxPackage("numpy")
+	numpy311.FullPath, numpy312.FullPath = "python311Packages.numpy", "python312Packages.numpy"
+
+	tests := []struct {
+		name   string
+		query  string
+		picked []types.Package
+		want   []string
+	}{
+		{name: "one package keeps the query", query: "rg", picked: []types.Package{linuxPackage("ripgrep")}, want: []string{"rg"}},
+		{name: "nested attribute", query: "numpy", picked: []types.Package{numpy311, linuxPackage("scipy")}, want: []string{"numpy", "scipy"}},
+		{name: "same name", query: "numpy", picked: []types.Package{numpy311, numpy312}, want: []string{"numpy", "python312Packages-numpy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, selection := range Selections(tt.query, tt.picked) {
+				got = append(got, selection.Query)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Selections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstaller_ResolveSearchError(t *testing.T) {
+	inst := &Installer{
+		Searcher: &mockSearcher{results: map[string][]types.Package{"firefox": {linuxPackage("firefox")}}},
+		Pick:     pickFirst,
+	}
+
+	_, err := inst.Resolve([]string{"firefox", "missing"})
+	if err == nil {
+		t.Fatal("Resolve() expected error for failing search, got nil")
+	}
+	if !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Resolve() error = %q, want it to name the failing package", err.Error())
+	}
+}
+
+func TestInstaller_ResolvePickerError(t *testing.T) {
+	cancelled := errors.New("cancelled")
+	inst := &Installer{
+		Searcher: &mockSearcher{results: map[string][]types.Package{"firefox": {linuxPackage("firefox")}}},
+		Pick: func(query string, candidates []types.Package) ([]types.Package, error) {
+			return nil, cancelled
+		},
+	}
+
+	_, err := inst.Resolve([]string{"firefox"})
+	if !errors.Is(err, cancelled) {
+		t.Errorf("Resolve() error = %v, want %v", err, cancelled)
+	}
+}
+
+func TestInstaller_ResolvePinned(t *testing.T) {
+	searcher := &mockSearcher{results: map[string][]types.Package{"vim": {linuxPackage("vim")}}}
+	inst := &Installer{
+		Searcher: searcher,
+		Pick:     pickFirst,
+		Pin: func(name string, version string) (*types.Package, error) {
+			return &types.Package{PName: name, FullPath: name, Version: version + ".0.1", Source: "nixpkgs-pin-" + name}, nil
+		},
+	}
+
+	selections, err := inst.Resolve([]string{"firefox@119", "vim"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if selections[0].Query != "firefox" || selections[0].Package.Version != "119.0.1" {
+		t.Errorf("Resolve() pinned = %q %+v, want firefox 119.0.1", selections[0].Query, selections[0].Package)
+	}
+	if len(searcher.searches) != 1 || selections[1].Package.PName != "vim" {
+		t.Errorf("Resolve() searched %v, want vim only", searcher.searches)
+	}
+
+	inst.Pin = nil
+	if _, err := inst.Resolve([]string{"firefox@119"}); err == nil {
+		t.Error("Resolve() accepted a version without Pin")
+	}
+}
+
+func TestInstaller_ResolveFlakeRef(t *testing.T) {
+	searcher := &mockSearcher{results: map[string][]types.Package{}}
+	inst := &Installer{
+		Searcher: searcher,
+		Pick:     pickFirst,
+		FromFlake: func(ref string, attr string) (*types.Package, error) {
+			return &types.Package{PName: attr, FullPath: attr, Output: "packages", Source: "repo"}, nil
+		},
+	}
+
+	selections, err := inst.Resolve([]string{"github:owner/repo#tool"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(selections) != 1 || selections[0].Query != "tool" || selections[0].Package.Source != "repo" {
+		t.Errorf("Resolve() = %+v, want tool from repo", selections)
+	}
+	if len(searcher.searches) != 0 {
+		t.Errorf("Resolve() searched %v for a flake reference", searcher.searches)
+	}
+
+	inst.FromFlake = nil
+	if _, err := inst.Resolve([]string{"github:owner/repo#tool"}); err == nil {
+		t.Error("Resolve() accepted a flake reference without FromFlake")
+	}
+}
+
+func TestInstaller_ResolveTap(t *testing.T) {
+	searcher := &mockSearcher{results: map[string][]types.Package{}}
+	inst := &Installer{
+		Searcher: searcher,
+		Pick:     pickFirst,
+		FromTap: func(tap string, formula string) (*types.Package, error) {
+			pkg := homebrew.TapPackage(tap, formula, "aarch64-darwin")
+			return &pkg, nil
+		},
+	}
+
+	selections, err := inst.Resolve([]string{"owner/tools/python@3.12"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(selections) != 1 || selections[0].Query != "python@3.12" || selections[0].Package.Homebrew.Tap != "owner/tools" {
+		t.Errorf("Resolve() = %+v, want python@3.12 from owner/tools", selections)
+	}
+	if len(searcher.searches) != 0 {
+		t.Errorf("Resolve() searched %v for a tap", searcher.searches)
+	}
+
+	inst.FromTap = nil
+	if _, err := inst.Resolve([]string{"owner/tools/tool"}); err == nil {
+		t.Error("Resolve() accepted a tap without FromTap")
+	}
+}
+
+func TestInstaller_ApplyDefaultNix(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	inst := &Installer{ModulesDir: filepath.Join(root, "modules", "apps")}
+	topLevel := filepath.Join(inst.ModulesDir, "default.nix")
+	if err := os.WriteFile(topLevel, []byte(nixconfig.ImportsFile("./editors")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	firefox := linuxPackage("firefox")
+
+	summary, err := inst.Apply([]Selection{{Query: "firefox", Package: &firefox}}, Plan{Category: "web", Hosts: targets})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := map[string]string{
+		topLevel: nixconfig.ImportsFile("./editors", "./web"),
+		filepath.Join(inst.ModulesDir, "web", "default.nix"): nixconfig.ImportsFile("./firefox.nix"),
+	}
+	for path, content := range want {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Apply() didn't write %s: %v", path, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s =\n%s\nwant\n%s", path, got, content)
+		}
+	}
+	if !slices.Contains(summary.AddedFiles, filepath.Join(inst.ModulesDir, "web", "default.nix")) {
+		t.Errorf("AddedFiles = %v, want the new default.nix", summary.AddedFiles)
+	}
+}
+
+func TestInstaller_ApplyConflict(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	modulesDir := filepath.Join(root, "modules", "apps")
+	firefox := linuxPackage("firefox")
+	selections := []Selection{{Query: "firefox", Package: &firefox}}
+	plan := Plan{Category: "browsers", Hosts: targets}
+	moduleFile := ModuleFile(modulesDir, "browsers", "firefox")
+
+	if _, err := (&Installer{ModulesDir: modulesDir}).Apply(selections, plan); err != nil {
+		t.Fatalf("first Apply() error = %v", err)
+	}
+	edited := "# edited by hand\n"
+	if err := os.WriteFile(moduleFile, []byte(edited), 0o644); err != nil {
+		t.Fatalf("Failed to edit the module: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		resolve func(change diff.Change) string
+		status  Status
+	}{
+		{"keep", func(change diff.Change) string { return change.Old }, Kept},
+		{"merge", func(change diff.Change) string { return edited + change.New }, Updated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen diff.Change
+			var want string
+			inst := &Installer{ModulesDir: modulesDir, Conflict: func(change diff.Change) (string, error) {
+				seen = change
+				want = tt.resolve(change)
+				return want, nil
+			}}
+			summary, err := inst.Apply(selections, plan)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if seen.Path != moduleFile || seen.Old != edited {
+				t.Errorf("Conflict() saw %+v, want the edited module", seen)
+			}
+			if summary.Results[0].Status != tt.status {
+				t.Errorf("Apply() status = %q, want %q", summary.Results[0].Status, tt.status)
+			}
+			if summary.Results[0].Generated != seen.New {
+				t.Errorf("Apply() generated = %q, want the generated module %q", summary.Results[0].Generated, seen.New)
+			}
+			content, _ := os.ReadFile(moduleFile)
+			if string(content) != want {
+				t.Errorf("module =\n%s\nwant:\n%s", content, want)
+			}
+			os.WriteFile(moduleFile, []byte(edited), 0o644)
+		})
+	}
+
+	inst := &Installer{ModulesDir: modulesDir, Conflict: func(diff.Change) (string, error) { return "", errors.New("cancelled") }}
+	if _, err := inst.Apply(selections, plan); err == nil {
+		t.Errorf("Apply() error = nil, want the error of Conflict")
+	}
+}
+
+func TestInstaller_ApplyUntrackedModule(t *testing.T) {
+	root, targets := setupFlake(t, "laptop")
+	firefox := linuxPackage("firefox")
+	selections := []Selection{{Query: "firefox", Package: &firefox}}
+	plan := Plan{Category: "browsers", Hosts: targets}
+	repo := gitops.NewRepoWithRunner(root, func(string, ...string) ([]byte, error) { return nil, nil })
+
+	inst := &Installer{
+		ModulesDir: filepath.Join(root, "modules", "apps"),
+		Policy:     strict.NewPolicy(true, io.Discard),
+		Git:        repo,
+		DryRun:     true,
+	}
+	_, err := inst.Apply(selections, plan)
+	var strictErr *strict.Error
+	if !errors.As(err, &strictErr) || strictErr.Condition != strict.UntrackedFile {
+		t.Errorf("Apply() error = %v, want %s", err, strict.UntrackedFile)
+	}
+
+	inst.TrackNew = true
+	if _, err := inst.Apply(selections, plan); err != nil {
+		t.Errorf("Apply() error = %v, want no untracked module when new files are added to git", err)
+	}
+}
@@ -0,0 +1,58 @@
+package installer
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+
+	"pam/internal/search"
+	"pam/internal/strict"
+	"pam/internal/types"
+)
+
+// MetaFetcher evaluates the version and meta of a package, see search.FetchMeta
+type MetaFetcher func(pkg types.Package) (search.Meta, error)
+
+// Enrich evaluates the meta of every selected package, fills in the version nix search
+// left empty and warns when a package is marked broken or insecure, or isn't supported on
+// the systems it is installed for. Unfree packages only fail in strict mode. A package whose
+// meta can't be evaluated is installed as it is.
+func (i *Installer) Enrich(selections []Selection, fetch MetaFetcher) error {
+	policy := i.Policy
+	if policy == nil {
+		policy = strict.NewPolicy(false, io.Discard)
+	}
+
+	for n := range selections {
+		pkg := *selections[n].Package
+		meta, err := fetch(pkg)
+		if err != nil {
+			slog.Debug("Could not evaluate the meta of " + pkg.FullPath + ": " + err.Error())
+			continue
+		}
+		if pkg.Version == "" && meta.Version != "" {
+			pkg.Version = meta.Version
+			selections[n].Package = &pkg
+		}
+		if meta.Unfree {
+			err := policy.Check(strict.UnfreePackage, "%s has an unfree license: %s", pkg.FullPath, strings.Join(meta.Licenses, ", "))
+			if err != nil {
+				return err
+			}
+		}
+		if meta.Broken {
+			err := policy.Warn(strict.BrokenPackage, "%s is marked broken", pkg.FullPath)
+			if err != nil {
+				return err
+			}
+			meta.Broken = false
+		}
+		for _, warning := range meta.Warnings(pkg.Systems()) {
+			err := policy.Warn(strict.UnsafePackage, "%s %s", pkg.FullPath, warning)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package installer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"pam/internal/search"
+	"pam/internal/strict"
+	"pam/internal/types"
+)
+
+func TestInstaller_Enrich(t *testing.T) {
+	metas := map[string]search.Meta{
+		"hello":   {Version: "2.12", Platforms: []string{"x86_64-linux", "aarch64-darwin"}},
+		"firefox": {Version: "121.0"},
+		"olddb":   {Version: "1.0", KnownVulnerabilities: []string{"CVE-2020-1"}},
+		"linux":   {Version: "6.6", Platforms: []string{"x86_64-linux"}},
+	}
+	fetch := func(pkg types.Package) (search.Meta, error) {
+		meta, ok := metas[pkg.FullPath]
+		if !ok {
+			return search.Meta{}, errors.New("attribute missing")
+		}
+		return meta, nil
+	}
+	selection := func(attr string, version string, system string) Selection {
+		return Selection{Query: attr, Package: &types.Package{PName: attr, FullPath: attr, Version: version, System: system}}
+	}
+
+	var out bytes.Buffer
+	inst := &Installer{Policy: strict.NewPolicy(false, &out)}
+	selections := []Selection{
+		selection("hello", "", "x86_64-linux"),
+		selection("firefox", "120.0", "x86_64-linux"),
+		selection("olddb", "1.0", "x86_64-linux"),
+		selection("linux", "6.6", "x86_64-linux,aarch64-darwin"),
+		selection("unknown", "", "x86_64-linux"),
+	}
+	if err := inst.Enrich(selections, fetch); err != nil {
+		t.Fatalf("Enrich() error = %v", err)
+	}
+	if got := selections[0].Package.Version; got != "2.12" {
+		t.Errorf("hello version = %q, want the version from meta", got)
+	}
+	if got := selections[1].Package.Version; got != "120.0" {
+		t.Errorf("firefox version = %q, the version nix search found should stay", got)
+	}
+	warnings := out.String()
+	if !strings.Contains(warnings, "olddb is marked insecure: CVE-2020-1") || !strings.Contains(warnings, "linux is not supported on aarch64-darwin") {
+		t.Errorf("Enrich() warnings =\n%s", warnings)
+	}
+	if strings.Count(warnings, "Warning:") != 2 {
+		t.Errorf("Enrich() printed %d warnings, want 2:\n%s", strings.Count(warnings, "Warning:"), warnings)
+	}
+
+	inst.Policy = strict.NewPolicy(true, &out)
+	err := inst.Enrich([]Selection{selection("olddb", "1.0", "x86_64-linux")}, fetch)
+	var strictErr *strict.Error
+	if !errors.As(err, &strictErr) || strictErr.Condition != strict.UnsafePackage {
+		t.Errorf("strict Enrich() error = %v, want %s", err, strict.UnsafePackage)
+	}
+}
+
+func TestInstaller_EnrichUnfreeAndBroken(t *testing.T) {
+	metas := map[string]search.Meta{
+		"vscode": {Version: "1.96.0", Licenses: []string{"unfree"}, Unfree: true},
+		"olddb":  {Version: "1.0", Broken: true},
+	}
+	fetch := func(pkg types.Package) (search.Meta, error) {
+		return metas[pkg.FullPath], nil
+	}
+	selection := func(attr string) Selection {
+		return Selection{Query: attr, Package: &types.Package{PName: attr, FullPath: attr, System: "x86_64-linux"}}
+	}
+
+	tests := []struct {
+		name          string
+		strict        bool
+		allow         []strict.Condition
+		attr          string
+		wantCondition strict.Condition
+		wantOutput    string
+	}{
+		{name: "unfree is silent outside strict mode", attr: "vscode"},
+		{name: "broken warns outside strict mode", attr: "olddb", wantOutput: "Warning: olddb is marked broken\n"},
+		{name: "unfree fails in strict mode", strict: true, attr: "vscode", wantCondition: strict.UnfreePackage},
+		{name: "broken fails in strict mode", strict: true, attr: "olddb", wantCondition: strict.BrokenPackage},
+		{name: "allowed unfree", strict: true, allow: []strict.Condition{strict.UnfreePackage}, attr: "vscode"},
+		{
+			name:       "allowed broken still warns",
+			strict:     true,
+			allow:      []strict.Condition{strict.BrokenPackage},
+			attr:       "olddb",
+			wantOutput: "Warning: olddb is marked broken\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			policy := strict.NewPolicy(tt.strict, &out)
+			policy.Allow(tt.allow...)
+			inst := &Installer{Policy: policy}
+
+			err := inst.Enrich([]Selection{selection(tt.attr)}, fetch)
+			var strictErr *strict.Error
+			if tt.wantCondition == "" && err != nil {
+				t.Fatalf("Enrich() error = %v", err)
+			}
+			if tt.wantCondition != "" && (!errors.As(err, &strictErr) || strictErr.Condition != tt.wantCondition) {
+				t.Fatalf("Enrich() error = %v, want %s", err, tt.wantCondition)
+			}
+			if out.String() != tt.wantOutput {
+				t.Errorf("Enrich() printed %q, want %q", out.String(), tt.wantOutput)
+			}
+		})
+	}
+}
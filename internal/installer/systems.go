@@ -0,0 +1,145 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"pam/internal/strict"
+	"pam/internal/types"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Lookup finds the package with the attribute path of pkg built for system, nil when the
+// system has no such package
+type Lookup func(pkg types.Package, system string) (*types.Package, error)
+
+// MatchSystems makes the package of every selection cover the systems of the hosts it is
+// installed on, so its module lists it for linux and darwin alike. systemOf returns the
+// system of a host, "" when it is unknown. Packages are looked up again for every host
+// system they weren't found for, a system without the package is warned about and left out.
+// With Homebrew, darwin hosts get the cask and need no lookup. Packages from a tap or the
+// Mac App Store are left out for every other system.
+func (i *Installer) MatchSystems(selections []Selection, plan Plan, systemOf func(Host) string, lookup Lookup) error {
+	policy := i.Policy
+	if policy == nil {
+		policy = strict.NewPolicy(false, io.Discard)
+	}
+
+	for n := range selections {
+		pkg := *selections[n].Package
+		systems := hostSystems(plan.resolve(selections[n]), systemOf)
+		if len(systems) == 0 || slices.Equal(systems, pkg.Systems()) {
+			continue
+		}
+
+		var matched *types.Package
+		var found []string
+		for _, system := range systems {
+			candidate := &pkg
+			switch {
+			case pkg.Homebrew != nil && !strings.HasSuffix(system, "-darwin"):
+				// Taps and the Mac App Store only install on darwin
+				candidate = nil
+			case needsLookup(pkg, system, plan):
+				// Homebrew installs the cask on darwin, the nix package doesn't have to exist there
+				var err error
+				candidate, err = lookup(pkg, system)
+				if err != nil {
+					return fmt.Errorf("looking up %s for %s: %w", pkg.FullPath, system, err)
+				}
+			}
+			if candidate == nil {
+				err := policy.Warn(strict.UnavailableSystem, "%s is not available for %s, hosts on that system won't get it", pkg.FullPath, system)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if matched == nil {
+				matched = candidate
+			}
+			found = append(found, system)
+		}
+		if matched == nil {
+			return fmt.Errorf("%s is not available for %s", pkg.FullPath, strings.Join(systems, " or "))
+		}
+
+		result := *matched
+		result.System = strings.Join(found, ",")
+		selections[n].Package = &result
+	}
+	return nil
+}
+
+// hostSystems returns the distinct known systems of the hosts of a resolved selection
+func hostSystems(selection Selection, systemOf func(Host) string) []string {
+	var systems []string
+	for _, host := range selection.Hosts {
+		if system := systemOf(host); system != "" && !slices.Contains(systems, system) {
+			systems = append(systems, system)
+		}
+	}
+	return systems
+}
+
+// needsLookup reports whether pkg has to be looked up again for system. Homebrew installs
+// the cask on darwin, the nix package doesn't have to exist there. Packages from a tap or
+// the Mac App Store have no nix package to look up.
+func needsLookup(pkg types.Package, system string, plan Plan) bool {
+	homebrew := plan.UseHomebrew && strings.HasSuffix(system, "-darwin")
+	return !slices.Contains(pkg.Systems(), system) && !homebrew && pkg.Homebrew == nil
+}
+
+// LookupSystems runs every lookup MatchSystems will need for selections at once, so the
+// searches for the other systems don't wait on each other. It returns a Lookup answering
+// from their results, for MatchSystems to warn and fail in order. lookup must be safe to
+// call concurrently, the first failing lookup cancels the others through ctx.
+func LookupSystems(ctx context.Context, selections []Selection, plan Plan, systemOf func(Host) string, lookup Lookup) (Lookup, error) {
+	type request struct {
+		pkg    types.Package
+		system string
+	}
+	var requests []request
+	for n := range selections {
+		pkg := *selections[n].Package
+		for _, system := range hostSystems(plan.resolve(selections[n]), systemOf) {
+			if needsLookup(pkg, system, plan) && !slices.Contains(requests, request{pkg, system}) {
+				requests = append(requests, request{pkg, system})
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	found := map[request]*types.Package{}
+	group, ctx := errgroup.WithContext(ctx)
+	for _, r := range requests {
+		group.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			candidate, err := lookup(r.pkg, r.system)
+			if err != nil {
+				return fmt.Errorf("looking up %s for %s: %w", r.pkg.FullPath, r.system, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			found[request{r.pkg, r.system}] = candidate
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	return func(pkg types.Package, system string) (*types.Package, error) {
+		if candidate, ok := found[request{pkg, system}]; ok {
+			return candidate, nil
+		}
+		return lookup(pkg, system)
+	}, nil
+}
@@ -0,0 +1,194 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"pam/internal/strict"
+	"pam/internal/types"
+)
+
+func TestInstaller_MatchSystems(t *testing.T) {
+	systems := map[string]string{"laptop": "x86_64-linux", "server": "x86_64-linux", "macbook": "aarch64-darwin", "pi": "aarch64-linux"}
+	systemOf := func(host Host) string { return systems[host.Name] }
+	// darwin and x86_64-linux have firefox, aarch64-linux doesn't
+	lookup := func(pkg types.Package, system string) (*types.Package, error) {
+		if system == "aarch64-linux" {
+			return nil, nil
+		}
+		pkg.System = system
+		pkg.Version = "121.0"
+		return &pkg, nil
+	}
+
+	tests := []struct {
+		name        string
+		hosts       []string
+		wantSystem  string
+		wantVersion string
+		wantWarning bool
+		wantErr     bool
+	}{
+		{name: "same system", hosts: []string{"laptop", "server"}, wantSystem: "x86_64-linux", wantVersion: "120.0"},
+		{name: "unknown host", hosts: []string{"desktop"}, wantSystem: "x86_64-linux", wantVersion: "120.0"},
+		{name: "other system", hosts: []string{"macbook"}, wantSystem: "aarch64-darwin", wantVersion: "121.0"},
+		{name: "mixed systems", hosts: []string{"laptop", "macbook"}, wantSystem: "x86_64-linux,aarch64-darwin", wantVersion: "120.0"},
+		{name: "unavailable system", hosts: []string{"laptop", "pi"}, wantSystem: "x86_64-linux", wantVersion: "120.0", wantWarning: true},
+		{name: "unavailable everywhere", hosts: []string{"pi"}, wantWarning: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			inst := &Installer{Policy: strict.NewPolicy(false, &out)}
+			pkg := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux", Version: "120.0"}
+			var targets []Host
+			for _, name := range tt.hosts {
+				targets = append(targets, Host{Name: name})
+			}
+			selections := []Selection{{Query: "firefox", Package: &pkg}}
+
+			err := inst.MatchSystems(selections, Plan{Hosts: targets}, systemOf, lookup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchSystems() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (out.Len() > 0) != tt.wantWarning {
+				t.Errorf("MatchSystems() warned %q, want warning %v", out.String(), tt.wantWarning)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := selections[0].Package
+			if got.System != tt.wantSystem || got.Version != tt.wantVersion {
+				t.Errorf("MatchSystems() package = %s %s, want %s %s", got.System, got.Version, tt.wantSystem, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestInstaller_MatchSystemsHomebrew(t *testing.T) {
+	inst := &Installer{}
+	pkg := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}
+	selections := []Selection{{Query: "firefox", Package: &pkg}}
+	lookup := func(pkg types.Package, system string) (*types.Package, error) {
+		t.Errorf("looked up %s for %s, the cask needs no nix package", pkg.FullPath, system)
+		return nil, nil
+	}
+	systemOf := func(host Host) string {
+		if host.Name == "mac" {
+			return "aarch64-darwin"
+		}
+		return "x86_64-linux"
+	}
+
+	plan := Plan{UseHomebrew: true, Hosts: []Host{{Name: "laptop"}, {Name: "mac"}}}
+	if err := inst.MatchSystems(selections, plan, systemOf, lookup); err != nil {
+		t.Fatalf("MatchSystems() error = %v", err)
+	}
+	if selections[0].Package.System != "x86_64-linux,aarch64-darwin" {
+		t.Errorf("MatchSystems() system = %q, want both", selections[0].Package.System)
+	}
+}
+
+func TestInstaller_MatchSystemsTap(t *testing.T) {
+	var out bytes.Buffer
+	inst := &Installer{Policy: strict.NewPolicy(false, &out)}
+	pkg := types.Package{PName: "sketchybar", FullPath: "felixkratz/formulae/sketchybar", System: "aarch64-darwin", Homebrew: &types.Homebrew{Tap: "felixkratz/formulae", Formula: "sketchybar"}}
+	selections := []Selection{{Query: "sketchybar", Package: &pkg}}
+	lookup := func(pkg types.Package, system string) (*types.Package, error) {
+		t.Errorf("looked up %s for %s, a tap has no nix package", pkg.FullPath, system)
+		return nil, nil
+	}
+	systemOf := func(host Host) string {
+		if host.Name == "mac" {
+			return "aarch64-darwin"
+		}
+		return "x86_64-linux"
+	}
+
+	plan := Plan{Hosts: []Host{{Name: "laptop"}, {Name: "mac"}}}
+	if err := inst.MatchSystems(selections, plan, systemOf, lookup); err != nil {
+		t.Fatalf("MatchSystems() error = %v", err)
+	}
+	if selections[0].Package.System != "aarch64-darwin" || out.Len() == 0 {
+		t.Errorf("MatchSystems() system = %q, warned %q, want darwin only with a warning", selections[0].Package.System, out.String())
+	}
+
+	plan.Hosts = []Host{{Name: "laptop"}}
+	if err := inst.MatchSystems(selections, plan, systemOf, lookup); err == nil {
+		t.Error("MatchSystems() of a tap on linux hosts only should fail")
+	}
+}
+
+func TestInstaller_MatchSystemsStrict(t *testing.T) {
+	inst := &Installer{Policy: strict.NewPolicy(true, &bytes.Buffer{})}
+	pkg := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}
+	selections := []Selection{{Query: "firefox", Package: &pkg}}
+	lookup := func(pkg types.Package, system string) (*types.Package, error) { return nil, nil }
+
+	err := inst.MatchSystems(selections, Plan{Hosts: []Host{{Name: "laptop"}, {Name: "mac"}}}, func(host Host) string {
+		if host.Name == "mac" {
+			return "aarch64-darwin"
+		}
+		return "x86_64-linux"
+	}, lookup)
+	var strictErr *strict.Error
+	if !errors.As(err, &strictErr) || strictErr.Condition != strict.UnavailableSystem {
+		t.Errorf("MatchSystems() error = %v, want %s", err, strict.UnavailableSystem)
+	}
+}
+
+func TestLookupSystems(t *testing.T) {
+	systems := map[string]string{"laptop": "x86_64-linux", "macbook": "aarch64-darwin", "pi": "aarch64-linux"}
+	systemOf := func(host Host) string { return systems[host.Name] }
+	var mu sync.Mutex
+	var looked []string
+	lookup := func(pkg types.Package, system string) (*types.Package, error) {
+		mu.Lock()
+		looked = append(looked, pkg.FullPath+" "+system)
+		mu.Unlock()
+		if system == "aarch64-linux" {
+			return nil, nil
+		}
+		pkg.System = system
+		return &pkg, nil
+	}
+
+	firefox := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux"}
+	ripgrep := types.Package{PName: "ripgrep", FullPath: "ripgrep", System: "x86_64-linux"}
+	selections := []Selection{{Query: "firefox", Package: &firefox}, {Query: "ripgrep", Package: &ripgrep}}
+	plan := Plan{Hosts: []Host{{Name: "laptop"}, {Name: "macbook"}, {Name: "pi"}}}
+
+	found, err := LookupSystems(context.Background(), selections, plan, systemOf, lookup)
+	if err != nil {
+		t.Fatalf("LookupSystems() error = %v", err)
+	}
+	slices.Sort(looked)
+	want := []string{"firefox aarch64-darwin", "firefox aarch64-linux", "ripgrep aarch64-darwin", "ripgrep aarch64-linux"}
+	if !slices.Equal(looked, want) {
+		t.Errorf("looked up %q, want %q", looked, want)
+	}
+
+	var out bytes.Buffer
+	inst := &Installer{Policy: strict.NewPolicy(false, &out)}
+	if err := inst.MatchSystems(selections, plan, systemOf, found); err != nil {
+		t.Fatalf("MatchSystems() error = %v", err)
+	}
+	if len(looked) != 4 {
+		t.Errorf("MatchSystems() looked up %q again", looked[4:])
+	}
+	if got := selections[1].Package.System; got != "x86_64-linux,aarch64-darwin" {
+		t.Errorf("ripgrep system = %s, want x86_64-linux,aarch64-darwin", got)
+	}
+
+	failing := func(pkg types.Package, system string) (*types.Package, error) {
+		return nil, errors.New("nix search failed")
+	}
+	if _, err := LookupSystems(context.Background(), selections, plan, systemOf, failing); err == nil {
+		t.Error("LookupSystems() should fail when a lookup does")
+	}
+}
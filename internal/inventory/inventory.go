@@ -0,0 +1,98 @@
+package inventory
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"pam/internal/hosts"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/nixconfig"
+)
+
+// Entry is the state of one pam-managed module on one host
+type Entry struct {
+	Host     string `json:"host"`
+	Package  string `json:"package"`
+	Category string `json:"category"`
+	Enabled  bool   `json:"enabled"`
+	Module   string `json:"module"`
+}
+
+// Collect cross-references every module in modulesDir with the apps section at namespace
+// in the apps file of each host. A module the host does not mention counts as disabled,
+// since mkApp defaults enable to false. Hosts without an apps file are skipped.
+func Collect(modulesDir string, hostsDir string, namespace string, hostNames []string, appsFiles ...map[string]string) ([]Entry, error) {
+	found, err := modules.Scan(modulesDir)
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", modulesDir, err)
+	}
+
+	optionNames := make([]string, len(found))
+	for i, module := range found {
+		optionNames[i], err = module.PackageName()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", module.Path, err)
+		}
+	}
+
+	var entries []Entry
+	for _, host := range hostNames {
+		path := hosts.AppsFile(hostsDir, host, appsFiles...)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+		nixcfg := nixconfig.NewConfig(string(data))
+		nixcfg.SetNamespace(namespace)
+
+		for i, module := range found {
+			enabled, _ := nixcfg.PackageEnabled(module.Category, optionNames[i])
+			entries = append(entries, Entry{
+				Host:     host,
+				Package:  optionNames[i],
+				Category: module.Category,
+				Enabled:  enabled,
+				Module:   module.Path,
+			})
+		}
+	}
+
+	sortEntries(entries)
+	return entries, nil
+}
+
+// FromLock lists the packages recorded in the lock file for each host without reading any
+// nix file. A package counts as enabled on the hosts the lock records for it.
+func FromLock(flakePath string, lock *lockfile.Lock, hostNames []string) []Entry {
+	var entries []Entry
+	for _, host := range hostNames {
+		for _, pkg := range lock.Packages {
+			entries = append(entries, Entry{
+				Host:     host,
+				Package:  pkg.Name,
+				Category: pkg.Category,
+				Enabled:  slices.Contains(pkg.Hosts, host),
+				Module:   filepath.Join(flakePath, filepath.FromSlash(pkg.Module)),
+			})
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+func sortEntries(entries []Entry) {
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Or(
+			cmp.Compare(a.Host, b.Host),
+			cmp.Compare(a.Category, b.Category),
+			cmp.Compare(a.Package, b.Package),
+		)
+	})
+}
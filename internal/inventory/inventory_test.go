@@ -0,0 +1,84 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pam/internal/lockfile"
+	"pam/internal/nixconfig"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	root := t.TempDir()
+	modulesDir := filepath.Join(root, "modules")
+	hostsDir := filepath.Join(root, "hosts")
+
+	writeFile(t, filepath.Join(modulesDir, "browsers", "firefox.nix"), "mkApp {\n  name = \"firefox\";\n}\n")
+	writeFile(t, filepath.Join(modulesDir, "editors", "nvim.nix"), "mkApp {\n  name = \"neovim\";\n}\n")
+	writeFile(t, filepath.Join(hostsDir, "laptop", "configuration.nix"),
+		"{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n    editors = {\n      neovim.enable = false;\n    };\n  };\n}\n")
+	writeFile(t, filepath.Join(hostsDir, "server", "configuration.nix"), "{\n}\n")
+
+	got, err := Collect(modulesDir, hostsDir, nixconfig.DefaultNamespace, []string{"server", "laptop", "missing"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	want := []Entry{
+		{Host: "laptop", Package: "firefox", Category: "browsers", Enabled: true},
+		{Host: "laptop", Package: "neovim", Category: "editors", Enabled: false},
+		{Host: "server", Package: "firefox", Category: "browsers", Enabled: false},
+		{Host: "server", Package: "neovim", Category: "editors", Enabled: false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Collect() returned %d entries, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		got[i].Module = ""
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCollect_MissingModulesDir(t *testing.T) {
+	root := t.TempDir()
+	_, err := Collect(filepath.Join(root, "missing"), root, nixconfig.DefaultNamespace, nil)
+	if err == nil {
+		t.Error("Collect() expected error for missing modules directory")
+	}
+}
+
+func TestFromLock(t *testing.T) {
+	lock := &lockfile.Lock{Packages: []lockfile.Package{
+		{Name: "neovim", Category: "editors", Hosts: []string{"laptop"}, Module: "modules/apps/editors/nvim.nix"},
+		{Name: "firefox", Category: "browsers", Hosts: []string{"laptop", "server"}, Module: "modules/apps/browsers/firefox.nix"},
+	}}
+
+	got := FromLock("/flake", lock, []string{"server", "laptop"})
+	want := []Entry{
+		{Host: "laptop", Package: "firefox", Category: "browsers", Enabled: true, Module: "/flake/modules/apps/browsers/firefox.nix"},
+		{Host: "laptop", Package: "neovim", Category: "editors", Enabled: true, Module: "/flake/modules/apps/editors/nvim.nix"},
+		{Host: "server", Package: "firefox", Category: "browsers", Enabled: true, Module: "/flake/modules/apps/browsers/firefox.nix"},
+		{Host: "server", Package: "neovim", Category: "editors", Enabled: false, Module: "/flake/modules/apps/editors/nvim.nix"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FromLock() returned %d entries, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
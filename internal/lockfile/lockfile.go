@@ -0,0 +1,213 @@
+package lockfile
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pam/internal/fsx"
+	"pam/internal/modules"
+	"pam/internal/types"
+)
+
+// FileName is the lock file pam keeps at the flake root
+const FileName = "pam.lock.json"
+
+// Package is a package pam installed, as it was at install time
+type Package struct {
+	// Name is the option name the hosts enable, apps.<category>.<name>.enable
+	Name     string   `json:"name"`
+	Attr     string   `json:"attr"`
+	Version  string   `json:"version"`
+	Input    string   `json:"input"`
+	Source   string   `json:"source"`
+	Category string   `json:"category"`
+	Hosts    []string `json:"hosts"`
+	// Systems are the systems the module installs the package for
+	Systems []string `json:"systems,omitempty"`
+	// Module is the module file relative to the flake root, using / separators
+	Module string `json:"module"`
+	// Template is the name of the template the module was generated from
+	Template string `json:"template"`
+	// Extras were written into the module next to the package, see pam install --extras
+	Extras *types.Extras `json:"extras,omitempty"`
+	// Hash is the Hash of the module pam generated last, telling hand edits apart
+	Hash        string    `json:"hash,omitempty"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// Hash returns the hash of a module recorded in the lock. Whitespace is left out, so a
+// formatter run over the module doesn't count as an edit.
+func Hash(content []byte) string {
+	sum := sha256.New()
+	for _, field := range bytes.Fields(content) {
+		sum.Write(field)
+	}
+	return "sha256-" + hex.EncodeToString(sum.Sum(nil))
+}
+
+// Edited reports whether content, the module file as it is now, was changed by hand since
+// pam generated it. Entries recorded before the lock kept hashes never count as edited.
+func (p Package) Edited(content []byte) bool {
+	return p.Hash != "" && p.Hash != Hash(content)
+}
+
+type Lock struct {
+	path     string
+	Version  int       `json:"version"`
+	Packages []Package `json:"packages"`
+}
+
+// Path returns the location of the lock file of the flake at flakePath
+func Path(flakePath string) string {
+	return filepath.Join(flakePath, FileName)
+}
+
+// Load reads the lock file of the flake. A missing file yields an empty lock.
+func Load(flakePath string) (*Lock, error) {
+	l := &Lock{path: Path(flakePath), Version: 1}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", l.path, err)
+	}
+	return l, nil
+}
+
+// File returns the path of the lock file
+func (l *Lock) File() string {
+	return l.path
+}
+
+// Empty reports whether the lock records no packages, e.g. for flakes set up before pam kept one
+func (l *Lock) Empty() bool {
+	return len(l.Packages) == 0
+}
+
+// Put records pkg, replacing the entry of the same module
+func (l *Lock) Put(pkg Package) {
+	for i, existing := range l.Packages {
+		if existing.Module == pkg.Module {
+			l.Packages[i] = pkg
+			return
+		}
+	}
+	l.Packages = append(l.Packages, pkg)
+}
+
+// Get returns the entry of a module file
+func (l *Lock) Get(module string) (Package, bool) {
+	for _, pkg := range l.Packages {
+		if pkg.Module == module {
+			return pkg, true
+		}
+	}
+	return Package{}, false
+}
+
+// Remove forgets the entry of a module file
+func (l *Lock) Remove(module string) {
+	l.Packages = slices.DeleteFunc(l.Packages, func(pkg Package) bool {
+		return pkg.Module == module
+	})
+}
+
+// RemoveHost drops host from the hosts of a module file
+func (l *Lock) RemoveHost(module string, host string) {
+	for i, pkg := range l.Packages {
+		if pkg.Module == module {
+			l.Packages[i].Hosts = slices.DeleteFunc(slices.Clone(pkg.Hosts), func(h string) bool {
+				return h == host
+			})
+		}
+	}
+}
+
+// AddHost records that host enables the package of the module, keeping the hosts sorted
+func (l *Lock) AddHost(module string, host string) {
+	for i, pkg := range l.Packages {
+		if pkg.Module == module && !slices.Contains(pkg.Hosts, host) {
+			hosts := append(slices.Clone(pkg.Hosts), host)
+			slices.Sort(hosts)
+			l.Packages[i].Hosts = hosts
+		}
+	}
+}
+
+// RenameCategory moves the entries of category and its subcategories to newName, whose
+// module files moved along with the category folder
+func (l *Lock) RenameCategory(category string, newName string) {
+	for i, pkg := range l.Packages {
+		rest, ok := strings.CutPrefix(pkg.Category, category)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		suffix := "/" + pkg.Category + "/" + path.Base(pkg.Module)
+		base, ok := strings.CutSuffix(pkg.Module, suffix)
+		if !ok {
+			continue
+		}
+		l.Packages[i].Category = newName + rest
+		l.Packages[i].Module = base + "/" + newName + rest + "/" + path.Base(pkg.Module)
+	}
+}
+
+// Modules returns the module of every entry whose file is named name, like modules.Find,
+// or of every entry when name is empty
+func (l *Lock) Modules(flakePath string, name string) []modules.Module {
+	var found []modules.Module
+	for _, pkg := range l.Packages {
+		moduleName := strings.TrimSuffix(path.Base(pkg.Module), ".nix")
+		if name != "" && moduleName != name {
+			continue
+		}
+		found = append(found, modules.Module{
+			Name:     moduleName,
+			Category: pkg.Category,
+			Path:     filepath.Join(flakePath, filepath.FromSlash(pkg.Module)),
+		})
+	}
+	return found
+}
+
+// Save writes the lock sorted by category and name, so that it diffs cleanly
+func (l *Lock) Save() error {
+	slices.SortFunc(l.Packages, func(a, b Package) int {
+		return cmp.Or(cmp.Compare(a.Category, b.Category), cmp.Compare(a.Name, b.Name))
+	})
+	if l.Packages == nil {
+		l.Packages = []Package{}
+	}
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsx.WriteFileAtomic(l.path, append(data, '\n'), 0o644)
+}
+
+// RelativeModule converts a module path to the form stored in the lock
+func RelativeModule(flakePath string, modulePath string) (string, error) {
+	rel, err := filepath.Rel(flakePath, modulePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
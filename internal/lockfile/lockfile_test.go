@@ -0,0 +1,133 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad_Missing(t *testing.T) {
+	lock, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !lock.Empty() || lock.Version != 1 {
+		t.Errorf("Load() = %+v, want an empty version 1 lock", lock)
+	}
+}
+
+func TestLock_SaveAndLoad(t *testing.T) {
+	root := t.TempDir()
+	lock, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	lock.Put(Package{Name: "vim", Attr: "vim", Version: "9.1", Category: "editors", Hosts: []string{"laptop"}, Module: "modules/apps/editors/vim.nix"})
+	lock.Put(Package{Name: "firefox", Attr: "firefox", Version: "120.0", Category: "browsers", Hosts: []string{"laptop", "desktop"}, Module: "modules/apps/browsers/firefox.nix"})
+	// Putting the same module again replaces its entry
+	lock.Put(Package{Name: "firefox", Attr: "firefox", Version: "121.0", Category: "browsers", Hosts: []string{"laptop", "desktop"}, Module: "modules/apps/browsers/firefox.nix"})
+	if err := lock.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reloaded, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(reloaded.Packages) != 2 {
+		t.Fatalf("reloaded %d packages, want 2: %+v", len(reloaded.Packages), reloaded.Packages)
+	}
+	// Saved sorted by category
+	if reloaded.Packages[0].Name != "firefox" || reloaded.Packages[0].Version != "121.0" {
+		t.Errorf("first package = %+v, want firefox 121.0", reloaded.Packages[0])
+	}
+
+	reloaded.RemoveHost("modules/apps/browsers/firefox.nix", "desktop")
+	if pkg, _ := reloaded.Get("modules/apps/browsers/firefox.nix"); strings.Join(pkg.Hosts, ",") != "laptop" {
+		t.Errorf("hosts after RemoveHost() = %v, want [laptop]", pkg.Hosts)
+	}
+
+	reloaded.AddHost("modules/apps/browsers/firefox.nix", "desktop")
+	reloaded.AddHost("modules/apps/browsers/firefox.nix", "desktop")
+	if pkg, _ := reloaded.Get("modules/apps/browsers/firefox.nix"); strings.Join(pkg.Hosts, ",") != "desktop,laptop" {
+		t.Errorf("hosts after AddHost() = %v, want [desktop laptop]", pkg.Hosts)
+	}
+
+	reloaded.Remove("modules/apps/editors/vim.nix")
+	if _, ok := reloaded.Get("modules/apps/editors/vim.nix"); ok {
+		t.Error("Get() found vim after Remove()")
+	}
+}
+
+func TestLock_Modules(t *testing.T) {
+	lock := &Lock{Packages: []Package{
+		{Name: "neovim", Category: "editors", Module: "modules/apps/editors/nvim.nix"},
+		{Name: "firefox", Category: "browsers", Module: "modules/apps/browsers/firefox.nix"},
+	}}
+
+	found := lock.Modules("/flake", "nvim")
+	if len(found) != 1 {
+		t.Fatalf("Modules() returned %d modules, want 1", len(found))
+	}
+	want := filepath.Join("/flake", "modules", "apps", "editors", "nvim.nix")
+	if found[0].Name != "nvim" || found[0].Category != "editors" || found[0].Path != want {
+		t.Errorf("Modules() = %+v", found[0])
+	}
+
+	if all := lock.Modules("/flake", ""); len(all) != 2 {
+		t.Errorf("Modules() without a name returned %d modules, want 2", len(all))
+	}
+}
+
+func TestLock_RenameCategory(t *testing.T) {
+	lock := &Lock{Packages: []Package{
+		{Name: "firefox", Category: "browsers", Module: "modules/apps/browsers/firefox.nix"},
+		{Name: "tor", Category: "browsers/private", Module: "modules/apps/browsers/private/tor.nix"},
+		{Name: "vim", Category: "browsers-old", Module: "modules/apps/browsers-old/vim.nix"},
+	}}
+
+	lock.RenameCategory("browsers", "web")
+
+	want := []Package{
+		{Name: "firefox", Category: "web", Module: "modules/apps/web/firefox.nix"},
+		{Name: "tor", Category: "web/private", Module: "modules/apps/web/private/tor.nix"},
+		{Name: "vim", Category: "browsers-old", Module: "modules/apps/browsers-old/vim.nix"},
+	}
+	for i, pkg := range lock.Packages {
+		if pkg.Category != want[i].Category || pkg.Module != want[i].Module {
+			t.Errorf("%s = %s in %s, want %s in %s", pkg.Name, pkg.Module, pkg.Category, want[i].Module, want[i].Category)
+		}
+	}
+}
+
+func TestPackage_Edited(t *testing.T) {
+	generated := []byte("{ mkApp, ... }:\nmkApp {\n  name = \"ripgrep\";\n}\n")
+	pkg := Package{Name: "ripgrep", Hash: Hash(generated)}
+
+	if pkg.Edited(generated) {
+		t.Error("Edited() of the generated module = true")
+	}
+	formatted := []byte("{ mkApp, ... }:\n\nmkApp {\n    name = \"ripgrep\";\n}")
+	if pkg.Edited(formatted) {
+		t.Error("Edited() of the formatted module = true, whitespace should not count")
+	}
+	edited := []byte("{ mkApp, ... }:\nmkApp {\n  name = \"ripgrep\";\n  # keep the config\n}\n")
+	if !pkg.Edited(edited) {
+		t.Error("Edited() of a hand-edited module = false")
+	}
+	if (Package{Name: "ripgrep"}).Edited(edited) {
+		t.Error("Edited() of an entry without a hash = true")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(Path(root), []byte("{"), 0o644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	if _, err := Load(root); err == nil {
+		t.Error("Load() expected error for invalid JSON")
+	}
+}
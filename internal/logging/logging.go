@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileName is the log file kept in pam's state directory when --log-file is given without a path
+const FileName = "pam.log"
+
+// Options configure the logger set up by Setup
+type Options struct {
+	// Verbose shows debug messages, such as the commands pam runs and the diffs of written files
+	Verbose bool
+	// Quiet hides everything below warnings, for scripts
+	Quiet bool
+	// File also writes every message, debug included, to this path when set
+	File string
+}
+
+var quiet bool
+
+// Quiet reports whether --quiet was given, spinners and other progress output should be skipped
+func Quiet() bool {
+	return quiet
+}
+
+// Setup makes slog's default logger print to out at the level the options ask for, and
+// to the log file when one is given. The returned function closes the log file.
+func Setup(options Options, out io.Writer) (func() error, error) {
+	level := slog.LevelInfo
+	switch {
+	case options.Verbose:
+		level = slog.LevelDebug
+	case options.Quiet:
+		level = slog.LevelWarn
+	}
+	quiet = options.Quiet
+
+	handlers := []slog.Handler{&consoleHandler{out: out, level: level, mu: &sync.Mutex{}}}
+	closeFile := func() error { return nil }
+	if options.File != "" {
+		err := os.MkdirAll(filepath.Dir(options.File), 0o755)
+		if err != nil {
+			return closeFile, err
+		}
+		file, err := os.OpenFile(options.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return closeFile, err
+		}
+		handlers = append(handlers, slog.NewTextHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		closeFile = file.Close
+	}
+
+	slog.SetDefault(slog.New(fanout(handlers)))
+	return closeFile, nil
+}
+
+// Command logs a command before it runs, at debug level
+func Command(cmd *exec.Cmd) {
+	slog.Debug("running " + strings.Join(cmd.Args, " "))
+}
+
+// consoleHandler prints messages the way pam always printed them: info messages as they
+// are, warnings and errors with a prefix, and attributes as key=value after the message
+type consoleHandler struct {
+	out   io.Writer
+	level slog.Level
+	attrs []slog.Attr
+	mu    *sync.Mutex
+}
+
+var prefixes = map[slog.Level]string{
+	slog.LevelDebug: "debug: ",
+	slog.LevelWarn:  "Warning: ",
+	slog.LevelError: "Error: ",
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	line.WriteString(prefixes[record.Level])
+	line.WriteString(record.Message)
+	writeAttr := func(attr slog.Attr) bool {
+		fmt.Fprintf(&line, " %s=%v", attr.Key, attr.Value)
+		return true
+	}
+	for _, attr := range h.attrs {
+		writeAttr(attr)
+	}
+	record.Attrs(writeAttr)
+	line.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, line.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &clone
+}
+
+// WithGroup is not used by pam, groups are flattened into the attributes
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// fanout sends every record to each handler that is enabled for it
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range f {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	for _, handler := range f {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		err := handler.Handle(ctx, record.Clone())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, handler := range f {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, handler := range f {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup_Levels(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    string
+	}{
+		{
+			name: "default",
+			want: "installed firefox\nWarning: host skipped host=server\nError: search failed\n",
+		},
+		{
+			name:    "verbose",
+			options: Options{Verbose: true},
+			want:    "debug: running nix search nixpkgs firefox\ninstalled firefox\nWarning: host skipped host=server\nError: search failed\n",
+		},
+		{
+			name:    "quiet",
+			options: Options{Quiet: true},
+			want:    "Warning: host skipped host=server\nError: search failed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := slog.Default()
+			defer slog.SetDefault(previous)
+
+			var out bytes.Buffer
+			closeFile, err := Setup(tt.options, &out)
+			if err != nil {
+				t.Fatalf("Setup() error = %v", err)
+			}
+			defer closeFile()
+
+			Command(exec.Command("nix", "search", "nixpkgs", "firefox"))
+			slog.Info("installed firefox")
+			slog.Warn("host skipped", "host", "server")
+			slog.Error("search failed")
+
+			if out.String() != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+			if Quiet() != tt.options.Quiet {
+				t.Errorf("Quiet() = %v, want %v", Quiet(), tt.options.Quiet)
+			}
+		})
+	}
+}
+
+func TestSetup_File(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+
+	path := filepath.Join(t.TempDir(), "state", FileName)
+	var out bytes.Buffer
+	closeFile, err := Setup(Options{Quiet: true, File: path}, &out)
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	Command(exec.Command("git", "status"))
+	slog.Info("committed")
+	if err := closeFile(); err != nil {
+		t.Fatalf("closing the log file: %v", err)
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("quiet console output = %q, want none", out.String())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	for _, want := range []string{`level=DEBUG msg="running git status"`, "level=INFO msg=committed"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("log file missing %q:\n%s", want, content)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+
+	"pam/internal/inventory"
+	"pam/internal/lockfile"
+	"pam/internal/modules"
+	"pam/internal/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the format of the manifests pam writes
+const Version = 1
+
+// header starts every manifest, so the file explains itself in a review
+const header = "# Packages managed by pam, written by pam export\n"
+
+// Manifest lists every package pam manages in a flake and the hosts enabling it
+type Manifest struct {
+	Version  int       `yaml:"version" json:"version"`
+	Packages []Package `yaml:"packages" json:"packages"`
+}
+
+// Package is a pam module as the manifest records it
+type Package struct {
+	// Name is the option name the hosts enable, apps.<category>.<name>.enable
+	Name     string `yaml:"name" json:"name"`
+	Attr     string `yaml:"attr,omitempty" json:"attr,omitempty"`
+	Version  string `yaml:"version,omitempty" json:"version,omitempty"`
+	Category string `yaml:"category" json:"category"`
+	// Hosts are the hosts enabling the package, empty when none does
+	Hosts []string `yaml:"hosts" json:"hosts"`
+	// Input is the flake input the package comes from, left out for nixpkgs
+	Input         string        `yaml:"input,omitempty" json:"input,omitempty"`
+	Program       string        `yaml:"program,omitempty" json:"program,omitempty"`
+	DarwinService string        `yaml:"darwin_service,omitempty" json:"darwin_service,omitempty"`
+	Brew          bool          `yaml:"brew,omitempty" json:"brew,omitempty"`
+	Template      string        `yaml:"template,omitempty" json:"template,omitempty"`
+	Extras        *types.Extras `yaml:"extras,omitempty" json:"extras,omitempty"`
+}
+
+// Build walks the modules in modulesDir and the apps section at namespace in the apps
+// file of each host, and takes the template and extras of each module from the lock.
+// Modules without a pam header, e.g. written by hand, are listed with their name only.
+func Build(flakePath string, modulesDir string, hostsDir string, namespace string, hostNames []string, appsFiles map[string]string, lock *lockfile.Lock) (*Manifest, error) {
+	entries, err := inventory.Collect(modulesDir, hostsDir, namespace, hostNames, appsFiles)
+	if err != nil {
+		return nil, err
+	}
+	found, err := modules.Scan(modulesDir)
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", modulesDir, err)
+	}
+
+	manifest := &Manifest{Version: Version, Packages: []Package{}}
+	for _, module := range found {
+		name, err := module.PackageName()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", module.Path, err)
+		}
+		pkg := Package{Name: name, Category: module.Category, Hosts: []string{}}
+
+		moduleHeader, ok, err := module.Header()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", module.Path, err)
+		}
+		if ok {
+			pkg.Attr = moduleHeader.Attr
+			pkg.Version = moduleHeader.Version
+			pkg.Program = moduleHeader.Program
+			pkg.DarwinService = moduleHeader.DarwinService
+			pkg.Brew = moduleHeader.UsesHomebrew()
+			if moduleHeader.Input != "nixpkgs" {
+				pkg.Input = moduleHeader.Input
+			}
+		}
+		if rel, err := lockfile.RelativeModule(flakePath, module.Path); err == nil {
+			if locked, ok := lock.Get(rel); ok {
+				pkg.Template = locked.Template
+				pkg.Extras = locked.Extras
+			}
+		}
+
+		for _, entry := range entries {
+			if entry.Module == module.Path && entry.Enabled {
+				pkg.Hosts = append(pkg.Hosts, entry.Host)
+			}
+		}
+		manifest.Packages = append(manifest.Packages, pkg)
+	}
+
+	slices.SortFunc(manifest.Packages, func(a, b Package) int {
+		return cmp.Or(cmp.Compare(a.Category, b.Category), cmp.Compare(a.Name, b.Name))
+	})
+	return manifest, nil
+}
+
+// Encode returns the manifest as YAML
+func (m *Manifest) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(m)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
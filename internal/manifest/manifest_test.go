@@ -0,0 +1,99 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pam/internal/lockfile"
+	"pam/internal/nixconfig"
+	"pam/internal/types"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	root := t.TempDir()
+	modulesDir := filepath.Join(root, "modules", "apps")
+	hostsDir := filepath.Join(root, "hosts")
+
+	writeFile(t, filepath.Join(modulesDir, "browsers", "firefox.nix"),
+		"# pam: attr=firefox version=119.0 system=x86_64-linux source=nix input=nixpkgs\nmkApp {\n  name = \"firefox\";\n}\n")
+	writeFile(t, filepath.Join(modulesDir, "editors", "emacs.nix"),
+		"# pam: attr=emacs-git version=30.0 system=x86_64-linux source=nix input=emacs-overlay\nmkApp {\n  name = \"emacs\";\n}\n")
+	writeFile(t, filepath.Join(modulesDir, "shells", "zsh.nix"),
+		"# pam: attr=zsh version=5.9 system=x86_64-linux source=nix input=nixpkgs program=zsh\nmkApp {\n  name = \"zsh\";\n}\n")
+	writeFile(t, filepath.Join(modulesDir, "misc", "handwritten.nix"), "mkApp {\n  name = \"tool\";\n}\n")
+	writeFile(t, filepath.Join(hostsDir, "laptop", "configuration.nix"),
+		"{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n    shells = {\n      zsh.enable = false;\n    };\n  };\n}\n")
+	writeFile(t, filepath.Join(hostsDir, "server", "configuration.nix"),
+		"{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n    editors = {\n      emacs.enable = true;\n    };\n  };\n}\n")
+
+	extras := &types.Extras{Packages: []string{"ffmpeg"}}
+	lock := &lockfile.Lock{Packages: []lockfile.Package{
+		{Name: "firefox", Module: "modules/apps/browsers/firefox.nix", Template: "custom", Extras: extras},
+	}}
+
+	got, err := Build(root, modulesDir, hostsDir, nixconfig.DefaultNamespace, []string{"laptop", "server"}, nil, lock)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	want := &Manifest{Version: Version, Packages: []Package{
+		{Name: "firefox", Attr: "firefox", Version: "119.0", Category: "browsers", Hosts: []string{"laptop", "server"}, Template: "custom", Extras: extras},
+		{Name: "emacs", Attr: "emacs-git", Version: "30.0", Category: "editors", Hosts: []string{"server"}, Input: "emacs-overlay"},
+		{Name: "tool", Category: "misc", Hosts: []string{}},
+		{Name: "zsh", Attr: "zsh", Version: "5.9", Category: "shells", Hosts: []string{}, Program: "zsh"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuild_MissingModulesDir(t *testing.T) {
+	root := t.TempDir()
+	_, err := Build(root, filepath.Join(root, "missing"), root, nixconfig.DefaultNamespace, nil, nil, &lockfile.Lock{})
+	if err == nil {
+		t.Error("Build() expected error for missing modules directory")
+	}
+}
+
+func TestManifest_Encode(t *testing.T) {
+	m := &Manifest{Version: Version, Packages: []Package{
+		{Name: "firefox", Attr: "firefox", Version: "119.0", Category: "browsers", Hosts: []string{"laptop"}},
+		{Name: "tool", Category: "misc", Hosts: []string{}},
+	}}
+
+	got, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	want := strings.Join([]string{
+		"# Packages managed by pam, written by pam export",
+		"version: 1",
+		"packages:",
+		"  - name: firefox",
+		"    attr: firefox",
+		"    version: \"119.0\"",
+		"    category: browsers",
+		"    hosts:",
+		"      - laptop",
+		"  - name: tool",
+		"    category: misc",
+		"    hosts: []",
+		"",
+	}, "\n")
+	if string(got) != want {
+		t.Errorf("Encode() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"pam/internal/diff"
+	"pam/internal/nixconfig"
+)
+
+// DefaultNix is the file a folder of modules is imported through
+const DefaultNix = "default.nix"
+
+// Imports edits the default.nix files listing the modules of the module directory.
+// Only files importing through a list literal are edited, a default.nix importing its
+// folder with lib.filesystem.listFilesRecursive picks new modules up by itself.
+// Every file is read once, so the modules of one command land in a single change.
+type Imports struct {
+	dir   string
+	files map[string]*diff.Change
+	order []string
+}
+
+func NewImports(modulesDir string) *Imports {
+	return &Imports{dir: filepath.Clean(modulesDir), files: map[string]*diff.Change{}}
+}
+
+// file returns the change of the default.nix in dir, empty when there is none
+func (m *Imports) file(dir string) (*diff.Change, error) {
+	path := filepath.Join(dir, DefaultNix)
+	if change, ok := m.files[path]; ok {
+		return change, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	change := &diff.Change{Path: path, Old: string(content), New: string(content)}
+	m.files[path] = change
+	m.order = append(m.order, path)
+	return change, nil
+}
+
+// Add lists a new module in the default.nix of its folder. When the module's folder
+// doesn't exist yet, the folder is listed in the default.nix of the first folder above
+// it that does, and every new folder gets a default.nix importing the one below it.
+func (m *Imports) Add(module string) error {
+	return m.add(filepath.Dir(module), "./"+filepath.Base(module))
+}
+
+// AddFolder lists a folder about to be created like Add, giving it a default.nix with an
+// empty import list
+func (m *Imports) AddFolder(dir string) error {
+	return m.add(dir, "")
+}
+
+// add lists child, empty for none, in the default.nix of dir, see Add
+func (m *Imports) add(dir string, child string) error {
+	// The folders to be created, each with the path its default.nix imports
+	type folder struct{ dir, child string }
+	var created []folder
+	for dir != m.dir {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		created = append(created, folder{dir, child})
+		child = "./" + filepath.Base(dir)
+		dir = parent
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() || child == "" {
+		return nil
+	}
+
+	top, err := m.file(dir)
+	if err != nil {
+		return err
+	}
+	if !nixconfig.NewConfig(top.New).HasImportList() {
+		return nil
+	}
+	if err := m.addImport(dir, child); err != nil {
+		return err
+	}
+	for _, f := range created {
+		change, err := m.file(f.dir)
+		if err != nil {
+			return err
+		}
+		switch {
+		case change.New == "" && f.child == "":
+			change.New = nixconfig.ImportsFile()
+		case change.New == "":
+			change.New = nixconfig.ImportsFile(f.child)
+		case f.child != "":
+			if err := m.addImport(f.dir, f.child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addImport adds path to the default.nix of dir unless it has no import list
+func (m *Imports) addImport(dir string, path string) error {
+	change, err := m.file(dir)
+	if err != nil {
+		return err
+	}
+	nixcfg := nixconfig.NewConfig(change.New)
+	_, err = nixcfg.AddImport(path)
+	if errors.Is(err, nixconfig.ErrNoImportList) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("updating %s: %w", change.Path, err)
+	}
+	change.New = nixcfg.Content()
+	return nil
+}
+
+// Remove drops a deleted module or folder from the default.nix of the folder above it
+func (m *Imports) Remove(module string) error {
+	change, err := m.file(filepath.Dir(module))
+	if err != nil {
+		return err
+	}
+	nixcfg := nixconfig.NewConfig(change.New)
+	if nixcfg.RemoveImport("./" + filepath.Base(module)) {
+		change.New = nixcfg.Content()
+	}
+	return nil
+}
+
+// Rename follows a module or folder moved from oldPath to newPath, listing it in the
+// default.nix of its new folder when the old one listed it
+func (m *Imports) Rename(oldPath string, newPath string) error {
+	change, err := m.file(filepath.Dir(oldPath))
+	if err != nil {
+		return err
+	}
+	nixcfg := nixconfig.NewConfig(change.New)
+	if !nixcfg.RemoveImport("./" + filepath.Base(oldPath)) {
+		return nil
+	}
+	change.New = nixcfg.Content()
+	return m.addImport(filepath.Dir(newPath), "./"+filepath.Base(newPath))
+}
+
+// Changes returns the default.nix files the edits changed, in the order they were first read
+func (m *Imports) Changes() []diff.Change {
+	var changes []diff.Change
+	for _, path := range m.order {
+		if change := m.files[path]; change.Old != change.New {
+			changes = append(changes, *change)
+		}
+	}
+	return changes
+}
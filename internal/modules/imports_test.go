@@ -0,0 +1,150 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pam/internal/nixconfig"
+)
+
+const autoImport = "{ lib, ... }:\n{\n  imports = lib.filesystem.listFilesRecursive ./.;\n}\n"
+
+func TestImports(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		add     []string
+		remove  []string
+		want    map[string]string
+		wantLen int
+	}{
+		{
+			name: "sibling import list",
+			files: map[string]string{
+				"browsers/default.nix": nixconfig.ImportsFile("./chromium.nix"),
+			},
+			add: []string{"browsers/firefox.nix"},
+			want: map[string]string{
+				"browsers/default.nix": nixconfig.ImportsFile("./chromium.nix", "./firefox.nix"),
+			},
+			wantLen: 1,
+		},
+		{
+			name: "auto-import is left alone",
+			files: map[string]string{
+				"default.nix":          autoImport,
+				"browsers/default.nix": autoImport,
+			},
+			add:     []string{"browsers/firefox.nix", "editors/neovim.nix"},
+			wantLen: 0,
+		},
+		{
+			name:    "no default.nix",
+			files:   map[string]string{"browsers/chromium.nix": "{ }"},
+			add:     []string{"browsers/firefox.nix", "editors/neovim.nix"},
+			wantLen: 0,
+		},
+		{
+			name: "new category",
+			files: map[string]string{
+				"default.nix": nixconfig.ImportsFile("./browsers"),
+			},
+			add: []string{"dev/editors/neovim.nix", "dev/editors/helix.nix"},
+			want: map[string]string{
+				"default.nix":             nixconfig.ImportsFile("./browsers", "./dev"),
+				"dev/default.nix":         nixconfig.ImportsFile("./editors"),
+				"dev/editors/default.nix": nixconfig.ImportsFile("./neovim.nix", "./helix.nix"),
+			},
+			wantLen: 3,
+		},
+		{
+			name: "moved module",
+			files: map[string]string{
+				"browsers/default.nix": nixconfig.ImportsFile("./chromium.nix", "./firefox.nix"),
+				"web/default.nix":      nixconfig.ImportsFile(),
+			},
+			add:    []string{"web/firefox.nix"},
+			remove: []string{"browsers/firefox.nix"},
+			want: map[string]string{
+				"web/default.nix":      nixconfig.ImportsFile("./firefox.nix"),
+				"browsers/default.nix": nixconfig.ImportsFile("./chromium.nix"),
+			},
+			wantLen: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for file, content := range tt.files {
+				path := filepath.Join(root, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatalf("Failed to write %s: %v", file, err)
+				}
+			}
+
+			imports := NewImports(root)
+			for _, module := range tt.add {
+				if err := imports.Add(filepath.Join(root, module)); err != nil {
+					t.Fatalf("Add(%s) error = %v", module, err)
+				}
+			}
+			for _, module := range tt.remove {
+				if err := imports.Remove(filepath.Join(root, module)); err != nil {
+					t.Fatalf("Remove(%s) error = %v", module, err)
+				}
+			}
+
+			changes := imports.Changes()
+			if len(changes) != tt.wantLen {
+				t.Fatalf("Changes() returned %d changes, want %d: %v", len(changes), tt.wantLen, changes)
+			}
+			for _, change := range changes {
+				rel, _ := filepath.Rel(root, change.Path)
+				want, ok := tt.want[rel]
+				if !ok {
+					t.Errorf("unexpected change of %s", rel)
+					continue
+				}
+				if change.New != want {
+					t.Errorf("%s =\n%s\nwant\n%s", rel, change.New, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImports_Folders(t *testing.T) {
+	root := t.TempDir()
+	writeModules(t, root, "browsers/firefox.nix")
+	topLevel := filepath.Join(root, DefaultNix)
+	if err := os.WriteFile(topLevel, []byte(nixconfig.ImportsFile("./browsers")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imports := NewImports(root)
+	if err := imports.AddFolder(filepath.Join(root, "editors")); err != nil {
+		t.Fatalf("AddFolder() error = %v", err)
+	}
+	if err := imports.Rename(filepath.Join(root, "browsers"), filepath.Join(root, "web")); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+
+	want := map[string]string{
+		topLevel: nixconfig.ImportsFile("./editors", "./web"),
+		filepath.Join(root, "editors", DefaultNix): nixconfig.ImportsFile(),
+	}
+	changes := imports.Changes()
+	if len(changes) != len(want) {
+		t.Fatalf("Changes() returned %d changes, want %d: %v", len(changes), len(want), changes)
+	}
+	for _, change := range changes {
+		if change.New != want[change.Path] {
+			t.Errorf("%s =\n%s\nwant\n%s", change.Path, change.New, want[change.Path])
+		}
+	}
+}
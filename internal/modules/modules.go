@@ -0,0 +1,214 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var namePattern = regexp.MustCompile(`(?m)^\s*name\s*=\s*"([^"]+)"\s*;`)
+
+// headerPrefix starts the comment pam writes on the first line of every generated module
+const headerPrefix = "# pam:"
+
+// Header records the nixpkgs package a module was generated from
+type Header struct {
+	Attr    string
+	Version string
+	System  string
+	// Source is "brew" when the darwin package is a Homebrew cask, "tap" for a formula of a
+	// Homebrew tap, "mas" for a Mac App Store app and "nix" otherwise
+	Source string
+	// Input is the flake input the package comes from, nixpkgs unless it was found in another source
+	Input string
+	// Program is the programs.<name> module the module enables instead of listing the package
+	Program string
+	// DarwinService is the nix-darwin services.<name> module the module enables on darwin
+	DarwinService string
+	// Flatpak is the Flathub app id linux hosts install instead of the nix package
+	Flatpak string
+	// With lists the packages the interpreter of Attr is built with, see wrappers.Format
+	With string
+}
+
+// UsesHomebrew reports whether the module installs a Homebrew cask on darwin
+func (h Header) UsesHomebrew() bool {
+	return h.Source == "brew"
+}
+
+// FromHomebrew reports whether the module installs a formula of a Homebrew tap or a Mac
+// App Store app instead of a nix package
+func (h Header) FromHomebrew() bool {
+	return h.Source == "tap" || h.Source == "mas"
+}
+
+// Module is a generated package module inside the module directory
+type Module struct {
+	// Name is the file name without the .nix extension
+	Name string
+	// Category is the folder path relative to the module directory, using / separators
+	Category string
+	Path     string
+}
+
+// Scan walks the module directory and returns every module file.
+// default.nix files are import lists rather than package modules and are skipped.
+func Scan(modulesDir string) ([]Module, error) {
+	var found []Module
+	err := filepath.WalkDir(modulesDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".nix" || entry.Name() == "default.nix" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(modulesDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		category := filepath.ToSlash(rel)
+		if category == "." {
+			category = ""
+		}
+
+		found = append(found, Module{
+			Name:     strings.TrimSuffix(entry.Name(), ".nix"),
+			Category: category,
+			Path:     path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// Category is a folder of the module directory
+type Category struct {
+	// Name is the folder path relative to the module directory, using / separators
+	Name string `json:"name"`
+	// Packages counts the modules directly in the folder
+	Packages int `json:"packages"`
+}
+
+// Categories returns every folder below the module directory, empty ones included, sorted by name
+func Categories(modulesDir string) ([]Category, error) {
+	var found []Category
+	err := filepath.WalkDir(modulesDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || path == modulesDir {
+			return nil
+		}
+		rel, err := filepath.Rel(modulesDir, path)
+		if err != nil {
+			return err
+		}
+		found = append(found, Category{Name: filepath.ToSlash(rel)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := Scan(modulesDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		for _, module := range all {
+			if module.Category == found[i].Name {
+				found[i].Packages++
+			}
+		}
+	}
+	return found, nil
+}
+
+// Find returns the modules named name, in any category
+func Find(modulesDir string, name string) ([]Module, error) {
+	all, err := Scan(modulesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Module
+	for _, module := range all {
+		if module.Name == name {
+			matches = append(matches, module)
+		}
+	}
+	return matches, nil
+}
+
+// PackageName returns the name passed to mkApp, which is the option name enabled in host configs.
+// It falls back to the file name when the module does not set one.
+func (m Module) PackageName() (string, error) {
+	data, err := os.ReadFile(m.Path)
+	if err != nil {
+		return "", err
+	}
+	match := namePattern.FindSubmatch(data)
+	if match == nil {
+		return m.Name, nil
+	}
+	return string(match[1]), nil
+}
+
+// Header reads the header pam wrote into the module. It reports false for modules
+// written by hand or generated before pam recorded headers.
+func (m Module) Header() (Header, bool, error) {
+	data, err := os.ReadFile(m.Path)
+	if err != nil {
+		return Header{}, false, err
+	}
+	header, ok := ParseHeader(string(data))
+	return header, ok, nil
+}
+
+// ParseHeader parses the `# pam: attr=... version=...` line at the top of a module
+func ParseHeader(content string) (Header, bool) {
+	firstLine, _, _ := strings.Cut(content, "\n")
+	fields, ok := strings.CutPrefix(strings.TrimSpace(firstLine), headerPrefix)
+	if !ok {
+		return Header{}, false
+	}
+
+	var header Header
+	for _, field := range strings.Fields(fields) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "attr":
+			header.Attr = value
+		case "version":
+			header.Version = value
+		case "system":
+			header.System = value
+		case "source":
+			header.Source = value
+		case "input":
+			header.Input = value
+		case "program":
+			header.Program = value
+		case "darwin-service":
+			header.DarwinService = value
+		case "flatpak":
+			header.Flatpak = value
+		case "with":
+			header.With = value
+		}
+	}
+	if header.Attr == "" {
+		return Header{}, false
+	}
+	// Modules generated before other sources were supported all come from nixpkgs
+	if header.Input == "" {
+		header.Input = "nixpkgs"
+	}
+	return header, true
+}
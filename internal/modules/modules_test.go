@@ -0,0 +1,232 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeModules(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("{ }"), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	writeModules(t, root,
+		"browsers/firefox.nix",
+		"browsers/default.nix",
+		"dev/editors/neovim.nix",
+		"dev/notes.txt",
+	)
+
+	got, err := Scan(root)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	want := map[string]string{
+		"firefox": "browsers",
+		"neovim":  "dev/editors",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Scan() returned %d modules, want %d: %v", len(got), len(want), got)
+	}
+	for _, module := range got {
+		category, ok := want[module.Name]
+		if !ok {
+			t.Errorf("Scan() returned unexpected module %q", module.Name)
+			continue
+		}
+		if module.Category != category {
+			t.Errorf("module %q category = %q, want %q", module.Name, module.Category, category)
+		}
+		if module.Path != filepath.Join(root, category, module.Name+".nix") {
+			t.Errorf("module %q path = %q", module.Name, module.Path)
+		}
+	}
+}
+
+func TestCategories(t *testing.T) {
+	root := t.TempDir()
+	writeModules(t, root,
+		"browsers/firefox.nix",
+		"browsers/chromium.nix",
+		"browsers/default.nix",
+		"dev/editors/neovim.nix",
+	)
+	if err := os.MkdirAll(filepath.Join(root, "games"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Categories(root)
+	if err != nil {
+		t.Fatalf("Categories() error = %v", err)
+	}
+	want := []Category{{"browsers", 2}, {"dev", 0}, {"dev/editors", 1}, {"games", 0}}
+	if len(got) != len(want) {
+		t.Fatalf("Categories() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Categories()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScan_MissingDirectory(t *testing.T) {
+	_, err := Scan(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Error("Scan() expected error for missing directory, got nil")
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	writeModules(t, root,
+		"browsers/firefox.nix",
+		"work/firefox.nix",
+		"editors/vim.nix",
+	)
+
+	tests := []struct {
+		name      string
+		search    string
+		wantCount int
+	}{
+		{name: "unique module", search: "vim", wantCount: 1},
+		{name: "module in two categories", search: "firefox", wantCount: 2},
+		{name: "unknown module", search: "emacs", wantCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Find(root, tt.search)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("Find(%q) returned %d modules, want %d", tt.search, len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestModule_PackageName(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "name attribute",
+			content: "mkApp {\n  _file = toString ./.;\n  name = \"firefox-bin\";\n} args\n",
+			want:    "firefox-bin",
+		},
+		{
+			name:    "no name attribute falls back to file name",
+			content: "{ pkgs, ... }: { }\n",
+			want:    "firefox",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(root, "firefox.nix")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("Failed to write module: %v", err)
+			}
+
+			module := Module{Name: "firefox", Category: "browsers", Path: path}
+			got, err := module.PackageName()
+			if err != nil {
+				t.Fatalf("PackageName() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PackageName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Header
+		wantOK  bool
+	}{
+		{
+			name:    "generated module",
+			content: "# pam: attr=firefox version=120.0 system=x86_64-linux source=nix input=nixpkgs\nargs@{ ... }: { }\n",
+			want:    Header{Attr: "firefox", Version: "120.0", System: "x86_64-linux", Source: "nix", Input: "nixpkgs"},
+			wantOK:  true,
+		},
+		{
+			name:    "flake input module",
+			content: "# pam: attr=emacs-git version=30.0.50 system=x86_64-linux source=nix input=emacs-overlay\n",
+			want:    Header{Attr: "emacs-git", Version: "30.0.50", System: "x86_64-linux", Source: "nix", Input: "emacs-overlay"},
+			wantOK:  true,
+		},
+		{
+			name:    "program module",
+			content: "# pam: attr=git version=2.47.0 system=x86_64-linux source=nix input=nixpkgs program=git\n",
+			want:    Header{Attr: "git", Version: "2.47.0", System: "x86_64-linux", Source: "nix", Input: "nixpkgs", Program: "git"},
+			wantOK:  true,
+		},
+		{
+			name:    "darwin service module",
+			content: "# pam: attr=yabai version=7.1.5 system=aarch64-darwin source=nix input=nixpkgs darwin-service=yabai\n",
+			want:    Header{Attr: "yabai", Version: "7.1.5", System: "aarch64-darwin", Source: "nix", Input: "nixpkgs", DarwinService: "yabai"},
+			wantOK:  true,
+		},
+		{
+			name:    "wrapper module",
+			content: "# pam: attr=python311 version=3.11.9 system=x86_64-linux source=nix input=nixpkgs with=python311Packages.numpy,python311Packages.pandas\n",
+			want:    Header{Attr: "python311", Version: "3.11.9", System: "x86_64-linux", Source: "nix", Input: "nixpkgs", With: "python311Packages.numpy,python311Packages.pandas"},
+			wantOK:  true,
+		},
+		{
+			name:    "flatpak module",
+			content: "# pam: attr=firefox version=120.0 system=x86_64-linux source=nix input=nixpkgs flatpak=org.mozilla.firefox\n",
+			want:    Header{Attr: "firefox", Version: "120.0", System: "x86_64-linux", Source: "nix", Input: "nixpkgs", Flatpak: "org.mozilla.firefox"},
+			wantOK:  true,
+		},
+		{
+			name:    "homebrew module without version",
+			content: "# pam: attr=firefox version= system=aarch64-darwin source=brew\n",
+			want:    Header{Attr: "firefox", System: "aarch64-darwin", Source: "brew", Input: "nixpkgs"},
+			wantOK:  true,
+		},
+		{
+			name:    "module without header",
+			content: "args@{ ... }:\n# pam: attr=firefox\n",
+		},
+		{
+			name:    "header without attr",
+			content: "# pam: version=1.0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseHeader(tt.content)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseHeader() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
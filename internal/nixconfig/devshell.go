@@ -0,0 +1,202 @@
+package nixconfig
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DevShellSystems are the systems a devshell added by pam is defined for
+var DevShellSystems = []string{"x86_64-linux", "aarch64-linux", "x86_64-darwin", "aarch64-darwin"}
+
+// devShellLists are the mkShell arguments listing packages, in the order they are preferred
+var devShellLists = []string{"packages", "buildInputs", "nativeBuildInputs"}
+
+// ErrNoDevShell is returned when a flake.nix has no mkShell call to add packages to
+var ErrNoDevShell = errors.New("flake.nix defines no devshell")
+
+// mkShellPattern matches the end of `pkgs.mkShell` or `nixpkgs.legacyPackages.${system}.mkShell`
+// before the '{' of its arguments, the submatch being the package set mkShell is taken from
+var mkShellPattern = regexp.MustCompile(`(?:([A-Za-z_][\w'-]*(?:\.(?:[A-Za-z_][\w'-]*|\$\{[^}]*\}))*)\.)?mkShell\s*$`)
+
+// devShell returns the arguments of the mkShell call bound to default, or of the first one
+// when none is, with the package set the call is taken from, e.g. pkgs
+func (d *document) devShell() (*attrSet, string) {
+	var shell *attrSet
+	for _, set := range d.sets {
+		if set.function != "mkShell" {
+			continue
+		}
+		if shell == nil || (d.defaultShell(set) && !d.defaultShell(shell)) {
+			shell = set
+		}
+	}
+	if shell == nil {
+		return nil, ""
+	}
+	match := mkShellPattern.FindStringSubmatch(d.src[:shell.open])
+	if match == nil {
+		return shell, ""
+	}
+	return shell, match[1]
+}
+
+// defaultShell reports whether the innermost binding holding set is named default, as in
+// devShells.x86_64-linux.default = pkgs.mkShell { ... }
+func (d *document) defaultShell(set *attrSet) bool {
+	var inner *binding
+	for _, b := range d.bindings {
+		if len(b.path) == 0 || b.valueStart > set.open || set.close >= b.valueEnd {
+			continue
+		}
+		if inner == nil || b.valueStart >= inner.valueStart {
+			inner = b
+		}
+	}
+	return inner != nil && inner.path[len(inner.path)-1] == "default"
+}
+
+// AddDevShellPackage adds attr, a nixpkgs attribute path, to the packages of the default
+// devshell, or to its buildInputs when it lists them instead. It returns false when the
+// devshell already has the package and ErrNoDevShell when the file has no mkShell call.
+func (c *Config) AddDevShellPackage(attr string) (bool, error) {
+	doc := parse(c.content)
+	shell, set := doc.devShell()
+	if shell == nil {
+		return false, ErrNoDevShell
+	}
+	ref := attr
+	if set != "" {
+		ref = set + "." + attr
+	}
+
+	for _, name := range devShellLists {
+		for _, b := range shell.bindings {
+			if !slices.Equal(b.path, []string{name}) {
+				continue
+			}
+			list := doc.packageList(b)
+			if list == nil {
+				return false, fmt.Errorf("%s of the devshell is not a list, add %s to it by hand", name, attr)
+			}
+			if list.contains(ref) {
+				return false, nil
+			}
+			item := ref
+			if bare, isPkgs := strings.CutPrefix(ref, "pkgs."); list.withPkgs && isPkgs {
+				item = bare
+			}
+			c.appendToList(list, item)
+			return true, nil
+		}
+	}
+	c.insertBinding(shell, fmt.Sprintf("packages = [ %s ];", ref))
+	return true, nil
+}
+
+// devShellsText is the devShells binding of a default devshell with attrs for every
+// DevShellSystems, indented by unit
+func devShellsText(unit string, attrs []string) string {
+	systems := make([]string, len(DevShellSystems))
+	for i, system := range DevShellSystems {
+		systems[i] = fmt.Sprintf("%q", system)
+	}
+	refs := make([]string, len(attrs))
+	for i, attr := range attrs {
+		refs[i] = "pkgs." + attr
+	}
+	lines := []string{
+		fmt.Sprintf("devShells = inputs.nixpkgs.lib.genAttrs [ %s ] (system:", strings.Join(systems, " ")),
+		unit + "let",
+		unit + unit + "pkgs = inputs.nixpkgs.legacyPackages.${system};",
+		unit + "in",
+		unit + "{",
+		unit + unit + "default = pkgs.mkShell {",
+		unit + unit + unit + fmt.Sprintf("packages = [ %s ];", strings.Join(refs, " ")),
+		unit + unit + "};",
+		unit + "});",
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AddDevShell defines a default devshell with attr in the attribute set the outputs
+// function returns, for flakes that have none yet. The outputs function gets bound to
+// inputs, the devshell takes its packages from the nixpkgs input.
+func (c *Config) AddDevShell(attr string) error {
+	if strings.Contains(c.content, "devShells") {
+		return fmt.Errorf("flake.nix defines devShells without a mkShell call pam can read, add %s to it by hand", attr)
+	}
+	if !c.HasInput("nixpkgs") {
+		return fmt.Errorf("flake.nix has no nixpkgs input to take the packages of the devshell from")
+	}
+	if _, err := c.BindInputs(); err != nil {
+		return err
+	}
+
+	doc := parse(c.content)
+	outputs := doc.outputsSet()
+	if outputs == nil {
+		return fmt.Errorf("outputs doesn't return an attribute set pam can add devShells to, add a devshell with %s by hand", attr)
+	}
+	c.insertBinding(outputs, devShellsText(c.indentUnit(), []string{attr}))
+	return nil
+}
+
+// outputsSet returns the attribute set the outputs function returns directly, nil when
+// it is built by a function call such as flake-utils.lib.eachDefaultSystem
+func (d *document) outputsSet() *attrSet {
+	body := d.moduleBody()
+	if body == nil {
+		return nil
+	}
+	var outputs *binding
+	for _, b := range body.bindings {
+		if slices.Equal(b.path, []string{"outputs"}) {
+			outputs = b
+		}
+	}
+	if outputs == nil {
+		return nil
+	}
+
+	var result *attrSet
+	for _, set := range d.sets {
+		if set.parent != body || set.open < outputs.valueStart || set.close >= outputs.valueEnd {
+			continue
+		}
+		// The argument pattern of the function is followed by : or @
+		rest := strings.TrimLeft(d.src[set.close+1:], " \t\n")
+		if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "@") {
+			continue
+		}
+		depth := 0
+		for _, tok := range tokenize(d.src[outputs.valueStart:set.open]) {
+			switch tok.kind {
+			case tokLParen:
+				depth++
+			case tokRParen:
+				depth--
+			}
+		}
+		if depth == 0 {
+			result = set
+		}
+	}
+	return result
+}
+
+// DevShellFlake returns a flake.nix defining only a default devshell with attrs, taking
+// them from nixpkgs at url
+func DevShellFlake(url string, attrs ...string) string {
+	unit := defaultIndentUnit
+	var b strings.Builder
+	b.WriteString("{\n")
+	fmt.Fprintf(&b, "%sdescription = \"Development shell\";\n\n", unit)
+	fmt.Fprintf(&b, "%sinputs.nixpkgs.url = %q;\n\n", unit, url)
+	fmt.Fprintf(&b, "%soutputs = { nixpkgs, ... }@inputs: {\n", unit)
+	b.WriteString(indentLines(devShellsText(unit, attrs), unit+unit) + "\n")
+	fmt.Fprintf(&b, "%s};\n}\n", unit)
+	return b.String()
+}
@@ -0,0 +1,152 @@
+package nixconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const flakeUtilsShell = `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+  inputs.flake-utils.url = "github:numtide/flake-utils";
+
+  outputs = { nixpkgs, flake-utils, ... }:
+    flake-utils.lib.eachDefaultSystem (system:
+      let
+        pkgs = nixpkgs.legacyPackages.${system};
+      in
+      {
+        devShells.default = pkgs.mkShell {
+          buildInputs = with pkgs; [
+            go
+          ];
+        };
+      });
+}
+`
+
+func TestConfig_AddDevShellPackage(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		attr      string
+		want      string
+		wantAdded bool
+		wantErr   error
+	}{
+		{
+			name:      "packages",
+			content:   "{\n  devShells.x86_64-linux.default = pkgs.mkShell {\n    packages = [ pkgs.go ];\n  };\n}\n",
+			attr:      "ripgrep",
+			want:      "{\n  devShells.x86_64-linux.default = pkgs.mkShell {\n    packages = [ pkgs.go pkgs.ripgrep ];\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:      "buildInputs with pkgs",
+			content:   flakeUtilsShell,
+			attr:      "gopls",
+			want:      strings.Replace(flakeUtilsShell, "            go\n", "            go\n            gopls\n", 1),
+			wantAdded: true,
+		},
+		{
+			name:      "set taken from nixpkgs",
+			content:   "{\n  devShells.x86_64-linux.default = nixpkgs.legacyPackages.x86_64-linux.mkShell {\n    packages = [ ];\n  };\n}\n",
+			attr:      "jq",
+			want:      "{\n  devShells.x86_64-linux.default = nixpkgs.legacyPackages.x86_64-linux.mkShell {\n    packages = [ nixpkgs.legacyPackages.x86_64-linux.jq ];\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:      "no list",
+			content:   "{\n  devShells.x86_64-linux.default = pkgs.mkShell {\n    shellHook = \"echo hi\";\n  };\n}\n",
+			attr:      "jq",
+			want:      "{\n  devShells.x86_64-linux.default = pkgs.mkShell {\n    shellHook = \"echo hi\";\n    packages = [ pkgs.jq ];\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:      "default shell preferred",
+			content:   "{\n  devShells.x86_64-linux = {\n    docs = pkgs.mkShell { packages = [ ]; };\n    default = pkgs.mkShell { packages = [ ]; };\n  };\n}\n",
+			attr:      "jq",
+			want:      "{\n  devShells.x86_64-linux = {\n    docs = pkgs.mkShell { packages = [ ]; };\n    default = pkgs.mkShell { packages = [ pkgs.jq ]; };\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:    "already in the shell",
+			content: flakeUtilsShell,
+			attr:    "go",
+			want:    flakeUtilsShell,
+		},
+		{
+			name:    "no devshell",
+			content: "{\n  outputs = { nixpkgs, ... }: { };\n}\n",
+			attr:    "jq",
+			want:    "{\n  outputs = { nixpkgs, ... }: { };\n}\n",
+			wantErr: ErrNoDevShell,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(tt.content)
+			added, err := c.AddDevShellPackage(tt.attr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddDevShellPackage() error = %v, want %v", err, tt.wantErr)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("AddDevShellPackage() = %v, want %v", added, tt.wantAdded)
+			}
+			if c.Content() != tt.want {
+				t.Errorf("content = %q, want %q", c.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_AddDevShell(t *testing.T) {
+	content := `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+
+  outputs = { self, nixpkgs }: {
+    packages.x86_64-linux.default = nixpkgs.legacyPackages.x86_64-linux.hello;
+  };
+}
+`
+	c := NewConfig(content)
+	if err := c.AddDevShell("jq"); err != nil {
+		t.Fatalf("AddDevShell() error = %v", err)
+	}
+	got := c.Content()
+	for _, want := range []string{
+		"outputs = { self, nixpkgs }@inputs: {",
+		"    packages.x86_64-linux.default = nixpkgs.legacyPackages.x86_64-linux.hello;\n    devShells = inputs.nixpkgs.lib.genAttrs [",
+		"        default = pkgs.mkShell {\n          packages = [ pkgs.jq ];\n        };\n      });\n  };\n}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("content = %s\nwant it to contain %q", got, want)
+		}
+	}
+	if added, err := c.AddDevShellPackage("ripgrep"); err != nil || !added || !strings.Contains(c.Content(), "packages = [ pkgs.jq pkgs.ripgrep ];") {
+		t.Errorf("AddDevShellPackage() after AddDevShell = %v, %v:\n%s", added, err, c.Content())
+	}
+
+	if err := NewConfig(flakeUtilsShell).AddDevShell("jq"); err == nil {
+		t.Error("AddDevShell() should refuse a flake that already defines devShells")
+	}
+	eachSystem := "{\n  inputs.nixpkgs.url = \"nixpkgs\";\n  outputs = { nixpkgs, flake-utils, ... }: flake-utils.lib.eachDefaultSystem (system: { });\n}\n"
+	if err := NewConfig(eachSystem).AddDevShell("jq"); err == nil {
+		t.Error("AddDevShell() should refuse outputs built by a function call")
+	}
+}
+
+func TestDevShellFlake(t *testing.T) {
+	c := NewConfig(DevShellFlake("github:NixOS/nixpkgs/nixos-unstable", "go", "gopls"))
+	if !c.HasInput("nixpkgs") {
+		t.Errorf("DevShellFlake() has no nixpkgs input:\n%s", c.Content())
+	}
+	added, err := c.AddDevShellPackage("gopls")
+	if err != nil || added {
+		t.Errorf("AddDevShellPackage(gopls) = %v, %v, want it already there:\n%s", added, err, c.Content())
+	}
+	added, err = c.AddDevShellPackage("delve")
+	if err != nil || !added || !strings.Contains(c.Content(), "packages = [ pkgs.go pkgs.gopls pkgs.delve ];") {
+		t.Errorf("AddDevShellPackage(delve) = %v, %v:\n%s", added, err, c.Content())
+	}
+}
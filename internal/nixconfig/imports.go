@@ -0,0 +1,123 @@
+package nixconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoImportList is returned when a file doesn't import through a list literal, e.g. a
+// default.nix importing its folder with lib.filesystem.listFilesRecursive
+var ErrNoImportList = errors.New("imports is not a list")
+
+// ImportsFile returns a module importing paths, the default.nix of a new folder
+func ImportsFile(paths ...string) string {
+	var b strings.Builder
+	b.WriteString("{\n" + defaultIndentUnit + "imports = [\n")
+	for _, path := range paths {
+		b.WriteString(strings.Repeat(defaultIndentUnit, 2) + path + "\n")
+	}
+	b.WriteString(defaultIndentUnit + "];\n}\n")
+	return b.String()
+}
+
+// importList reads the list bound to imports, nil when the file has none
+func (d *document) importList() *packageList {
+	b := d.findBinding("imports")
+	if b == nil {
+		return nil
+	}
+	return d.packageList(b)
+}
+
+// listPaths returns the path tokens at the top level of list
+func (d *document) listPaths(list *packageList) []token {
+	var paths []token
+	depth := 0
+	for _, tok := range tokenize(d.src) {
+		if tok.start <= list.open || tok.start >= list.close {
+			continue
+		}
+		switch tok.kind {
+		case tokLBracket, tokLParen, tokLBrace:
+			depth++
+		case tokRBracket, tokRParen, tokRBrace:
+			depth--
+		case tokPath:
+			if depth == 0 {
+				paths = append(paths, tok)
+			}
+		}
+	}
+	return paths
+}
+
+// HasImportList reports whether the file imports through a list literal AddImport can edit
+func (c *Config) HasImportList() bool {
+	return parse(c.content).importList() != nil
+}
+
+// Imports returns the paths of the imports list in file order
+func (c *Config) Imports() []string {
+	doc := parse(c.content)
+	list := doc.importList()
+	if list == nil {
+		return nil
+	}
+	var paths []string
+	for _, tok := range doc.listPaths(list) {
+		paths = append(paths, tok.text)
+	}
+	return paths
+}
+
+// AddImport appends path, such as ./firefox.nix, to the imports list. It returns false
+// when the list already holds it, and ErrNoImportList when there is no list to add it to.
+func (c *Config) AddImport(path string) (bool, error) {
+	doc := parse(c.content)
+	list := doc.importList()
+	if list == nil {
+		return false, ErrNoImportList
+	}
+	for _, tok := range doc.listPaths(list) {
+		if tok.text == path {
+			return false, nil
+		}
+	}
+	if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		return false, fmt.Errorf("%s is not a relative path", path)
+	}
+	c.appendToList(list, path)
+	return true, nil
+}
+
+// RemoveImport deletes path from the imports list, reporting whether it was there
+func (c *Config) RemoveImport(path string) bool {
+	doc := parse(c.content)
+	list := doc.importList()
+	if list == nil {
+		return false
+	}
+	paths := doc.listPaths(list)
+	for n := len(paths) - 1; n >= 0; n-- {
+		tok := paths[n]
+		if tok.text != path {
+			continue
+		}
+		// Take the spaces after an item sharing its line, or before the last one, so
+		// `[ ./a.nix ./b.nix ]` keeps single spaces
+		start, end := tok.start, tok.end
+		for end < len(c.content) && (c.content[end] == ' ' || c.content[end] == '\t') {
+			end++
+		}
+		if end == list.close {
+			end = tok.end
+			for start > list.open+1 && (c.content[start-1] == ' ' || c.content[start-1] == '\t') {
+				start--
+			}
+		}
+		c.removeRange(start, end)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package nixconfig
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+const autoImports = `{ lib, ... }:
+
+{
+  imports = builtins.filter (
+    path: lib.hasSuffix ".nix" (toString path) && baseNameOf path != "default.nix"
+  ) (lib.filesystem.listFilesRecursive ./.);
+}`
+
+func TestConfig_AddImport(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		path      string
+		want      string
+		wantAdded bool
+		wantErr   error
+	}{
+		{
+			name:      "multi-line list",
+			content:   "{\n  imports = [\n    ./git.nix\n  ];\n}\n",
+			path:      "./firefox.nix",
+			want:      "{\n  imports = [\n    ./git.nix\n    ./firefox.nix\n  ];\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:      "single-line list",
+			content:   "{ ... }: {\n  imports = [ ./git.nix ];\n}",
+			path:      "./firefox.nix",
+			want:      "{ ... }: {\n  imports = [ ./git.nix ./firefox.nix ];\n}",
+			wantAdded: true,
+		},
+		{
+			name:      "folder",
+			content:   "{\n\timports = [\n\t\t./cli\n\t];\n}\n",
+			path:      "./gui",
+			want:      "{\n\timports = [\n\t\t./cli\n\t\t./gui\n\t];\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:    "already imported",
+			content: "{\n  imports = [ ./firefox.nix ];\n}",
+			path:    "./firefox.nix",
+			want:    "{\n  imports = [ ./firefox.nix ];\n}",
+		},
+		{
+			name:    "auto-import is left alone",
+			content: autoImports,
+			path:    "./firefox.nix",
+			want:    autoImports,
+			wantErr: ErrNoImportList,
+		},
+		{
+			name:    "no imports",
+			content: "{ ... }: {\n  programs.git.enable = true;\n}",
+			path:    "./firefox.nix",
+			want:    "{ ... }: {\n  programs.git.enable = true;\n}",
+			wantErr: ErrNoImportList,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(tt.content)
+			added, err := c.AddImport(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddImport() error = %v, want %v", err, tt.wantErr)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("AddImport() added = %v, want %v", added, tt.wantAdded)
+			}
+			if got := c.Content(); got != tt.want {
+				t.Errorf("AddImport() content =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_RemoveImport(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		path        string
+		want        string
+		wantRemoved bool
+	}{
+		{
+			name:        "own line",
+			content:     "{\n  imports = [\n    ./git.nix\n    ./firefox.nix\n  ];\n}\n",
+			path:        "./firefox.nix",
+			want:        "{\n  imports = [\n    ./git.nix\n  ];\n}\n",
+			wantRemoved: true,
+		},
+		{
+			name:        "first of a single line",
+			content:     "{\n  imports = [ ./firefox.nix ./git.nix ];\n}",
+			path:        "./firefox.nix",
+			want:        "{\n  imports = [ ./git.nix ];\n}",
+			wantRemoved: true,
+		},
+		{
+			name:        "last of a single line",
+			content:     "{\n  imports = [ ./git.nix ./firefox.nix ];\n}",
+			path:        "./firefox.nix",
+			want:        "{\n  imports = [ ./git.nix ];\n}",
+			wantRemoved: true,
+		},
+		{
+			name:    "not imported",
+			content: "{\n  imports = [ ./git.nix ];\n}",
+			path:    "./firefox.nix",
+			want:    "{\n  imports = [ ./git.nix ];\n}",
+		},
+		{
+			name:    "auto-import",
+			content: autoImports,
+			path:    "./firefox.nix",
+			want:    autoImports,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(tt.content)
+			if removed := c.RemoveImport(tt.path); removed != tt.wantRemoved {
+				t.Errorf("RemoveImport() = %v, want %v", removed, tt.wantRemoved)
+			}
+			if got := c.Content(); got != tt.want {
+				t.Errorf("RemoveImport() content =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Imports(t *testing.T) {
+	c := NewConfig("{\n  imports = [\n    ./git.nix\n    ../shared/default.nix\n    (import ./lib.nix { })\n  ];\n}")
+	want := []string{"./git.nix", "../shared/default.nix"}
+	if got := c.Imports(); !slices.Equal(got, want) {
+		t.Errorf("Imports() = %v, want %v", got, want)
+	}
+	if NewConfig(autoImports).HasImportList() {
+		t.Error("HasImportList() = true for a listFilesRecursive import")
+	}
+}
+
+func TestImportsFile(t *testing.T) {
+	want := "{\n  imports = [\n    ./firefox.nix\n  ];\n}\n"
+	if got := ImportsFile("./firefox.nix"); got != want {
+		t.Errorf("ImportsFile() =\n%s\nwant\n%s", got, want)
+	}
+}
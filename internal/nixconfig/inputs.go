@@ -0,0 +1,243 @@
+package nixconfig
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Input is a flake input declared in flake.nix
+type Input struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Follows is the input this input's nixpkgs follows, empty when it brings its own
+	Follows string `json:"follows,omitempty"`
+}
+
+// topLevel reports whether b is a binding of the flake's outer set, or nested in one
+func (d *document) topLevel(b *binding, body *attrSet) bool {
+	for b.parent != nil && b.parent.owner != nil {
+		b = b.parent.owner
+	}
+	return b.parent == body
+}
+
+// inputBindings returns the bindings declaring input name, like `name.url = ...;` inside
+// `inputs = { ... };` or `inputs.name = { ... };`. An empty name returns every input binding.
+func (d *document) inputBindings(name string) []*binding {
+	body := d.moduleBody()
+	if body == nil {
+		return nil
+	}
+	var found []*binding
+	for _, b := range d.bindings {
+		full := b.fullPath()
+		if len(full) < 2 || full[0] != "inputs" || (name != "" && full[1] != name) || !d.topLevel(b, body) {
+			continue
+		}
+		// Only the outermost binding of the input, its nested bindings go with it
+		if owner := b.parent.owner; owner != nil && len(owner.fullPath()) >= 2 {
+			continue
+		}
+		found = append(found, b)
+	}
+	return found
+}
+
+// Inputs returns the inputs declared in flake.nix in file order
+func (c *Config) Inputs() []Input {
+	doc := parse(c.content)
+	body := doc.moduleBody()
+	if body == nil {
+		return nil
+	}
+	var inputs []Input
+	index := map[string]int{}
+	for _, b := range doc.bindings {
+		full := b.fullPath()
+		if len(full) < 2 || full[0] != "inputs" || !doc.topLevel(b, body) {
+			continue
+		}
+		name := full[1]
+		n, ok := index[name]
+		if !ok {
+			n = len(inputs)
+			index[name] = n
+			inputs = append(inputs, Input{Name: name})
+		}
+		switch {
+		case len(full) == 3 && full[2] == "url":
+			inputs[n].URL = doc.stringValue(b)
+		case len(full) == 5 && full[2] == "inputs" && full[3] == "nixpkgs" && full[4] == "follows":
+			inputs[n].Follows = doc.stringValue(b)
+		}
+	}
+	return inputs
+}
+
+// HasInput reports whether flake.nix declares the input name
+func (c *Config) HasInput(name string) bool {
+	return slices.ContainsFunc(c.Inputs(), func(input Input) bool { return input.Name == name })
+}
+
+// inputText is the declaration of input inside the inputs set
+func inputText(input Input) string {
+	text := fmt.Sprintf("%s.url = %s;", input.Name, strconv.Quote(input.URL))
+	if input.Follows != "" {
+		text += fmt.Sprintf("\n%s.inputs.nixpkgs.follows = %s;", input.Name, strconv.Quote(input.Follows))
+	}
+	return text
+}
+
+// AddInput declares input in flake.nix, inside `inputs = { ... };` or next to the other
+// `inputs.<name>` bindings. It fails when the input exists already.
+func (c *Config) AddInput(input Input) error {
+	if c.HasInput(input.Name) {
+		return fmt.Errorf("flake.nix already has an input called %s", input.Name)
+	}
+	doc := parse(c.content)
+	body := doc.moduleBody()
+	if body == nil {
+		return fmt.Errorf("no attribute set found in flake.nix")
+	}
+	for _, b := range body.bindings {
+		if slices.Equal(b.path, []string{"inputs"}) && b.set != nil {
+			c.insertBinding(b.set, inputText(input))
+			return nil
+		}
+	}
+	if existing := doc.inputBindings(""); len(existing) > 0 {
+		c.insertAfter(existing[len(existing)-1], indentLines(inputText(input), "inputs."))
+		return nil
+	}
+	c.insertBinding(body, "inputs = {\n"+indentLines(inputText(input), c.indentUnit())+"\n};")
+	return nil
+}
+
+// insertAfter adds text on the lines following b, at the indentation of b
+func (c *Config) insertAfter(b *binding, text string) {
+	lineStart := strings.LastIndex(c.content[:b.start], "\n") + 1
+	indent := c.content[lineStart:b.start]
+	indent = indent[:len(indent)-len(strings.TrimLeft(indent, " \t"))]
+	c.content = c.content[:b.end] + "\n" + indentLines(text, indent) + c.content[b.end:]
+}
+
+// RemoveInput deletes every binding declaring the input name, reporting whether there was one
+func (c *Config) RemoveInput(name string) bool {
+	found := parse(c.content).inputBindings(name)
+	for i := len(found) - 1; i >= 0; i-- {
+		c.removeRange(found[i].start, found[i].end)
+	}
+	return len(found) > 0
+}
+
+// SetInputURL points the input name at url, reporting whether the URL changed
+func (c *Config) SetInputURL(name string, url string) (bool, error) {
+	doc := parse(c.content)
+	for _, b := range doc.inputBindings(name) {
+		full := b.fullPath()
+		var target *binding
+		switch {
+		case len(full) == 3 && full[2] == "url":
+			target = b
+		case len(full) == 2 && b.set != nil:
+			for _, nested := range b.set.bindings {
+				if slices.Equal(nested.path, []string{"url"}) {
+					target = nested
+				}
+			}
+		}
+		if target == nil {
+			continue
+		}
+		if doc.stringValue(target) == url {
+			return false, nil
+		}
+		c.content = c.content[:target.valueStart] + strconv.Quote(url) + c.content[target.valueEnd:]
+		return true, nil
+	}
+	return false, fmt.Errorf("flake.nix has no url for the input %s", name)
+}
+
+// inputsPattern matches an outputs function binding its argument as inputs, like
+// `inputs: ...`, `inputs@{ ... }:` or `{ self, ... }@inputs:`
+var inputsPattern = regexp.MustCompile(`^\s*(inputs\s*(:|@)|\{[^}]*\}\s*@\s*inputs\s*:)`)
+
+// BindInputs makes the outputs function name its argument inputs, turning
+// `outputs = { self, nixpkgs, ... }:` into `outputs = { self, nixpkgs, ... }@inputs:` so
+// the systems can pass inputs to their modules. It reports whether the file changed.
+func (c *Config) BindInputs() (bool, error) {
+	doc := parse(c.content)
+	body := doc.moduleBody()
+	if body == nil {
+		return false, fmt.Errorf("no attribute set found in flake.nix")
+	}
+	for _, b := range body.bindings {
+		if !slices.Equal(b.path, []string{"outputs"}) {
+			continue
+		}
+		value := c.content[b.valueStart:b.valueEnd]
+		if inputsPattern.MatchString(value) {
+			return false, nil
+		}
+		for _, set := range doc.sets {
+			if set.open != b.valueStart || set.close >= b.valueEnd {
+				continue
+			}
+			if rest := strings.TrimLeft(c.content[set.close+1:], " \t\n"); strings.HasPrefix(rest, ":") {
+				c.content = c.content[:set.close+1] + "@inputs" + c.content[set.close+1:]
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("outputs doesn't take its inputs as an attribute set, add @inputs to its arguments by hand")
+	}
+	return false, fmt.Errorf("no outputs found in flake.nix")
+}
+
+// AddOverlay adds the default overlay of the input name to nixpkgs.overlays, in the
+// modules list of every nixosSystem and darwinSystem call. It reports how many calls changed.
+func (c *Config) AddOverlay(name string) (int, error) {
+	overlay := fmt.Sprintf("inputs.%s.overlays.default", name)
+	return c.addSystemModule(overlay, fmt.Sprintf("{ nixpkgs.overlays = [ %s ]; }", overlay), systemFunctions)
+}
+
+// AddNixosModule adds module, a nix expression such as inputs.x.nixosModules.default, to the
+// modules list of every nixosSystem call. It reports how many calls changed.
+func (c *Config) AddNixosModule(module string) (int, error) {
+	return c.addSystemModule(module, module, map[string]bool{"nixosSystem": true})
+}
+
+// addSystemModule appends entry to the modules list of every call of functions that
+// doesn't mention marker yet, and reports how many calls changed
+func (c *Config) addSystemModule(marker string, entry string, functions map[string]bool) (int, error) {
+	changed := 0
+	for {
+		doc := parse(c.content)
+		var modules *binding
+		for _, set := range doc.sets {
+			if !functions[set.function] {
+				continue
+			}
+			for _, b := range set.bindings {
+				if slices.Equal(b.path, []string{"modules"}) && !strings.Contains(c.content[b.valueStart:b.valueEnd], marker) {
+					modules = b
+					break
+				}
+			}
+			if modules != nil {
+				break
+			}
+		}
+		if modules == nil {
+			return changed, nil
+		}
+		list := doc.packageList(modules)
+		if list == nil {
+			return changed, fmt.Errorf("the modules of a system are not a list, add %s to them by hand", entry)
+		}
+		c.appendToList(list, entry)
+		changed++
+	}
+}
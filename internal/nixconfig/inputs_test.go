@@ -0,0 +1,311 @@
+package nixconfig
+
+import (
+	"slices"
+	"testing"
+)
+
+const flakeWithInputSet = `{
+  inputs = {
+    nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+    home-manager = {
+      url = "github:nix-community/home-manager";
+      inputs.nixpkgs.follows = "nixpkgs";
+    };
+  };
+
+  outputs = { self, nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}`
+
+const flakeWithInputPaths = `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+  inputs.nur.url = "github:nix-community/NUR";
+
+  outputs = inputs@{ nixpkgs, ... }: { };
+}`
+
+func TestConfig_Inputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Input
+	}{
+		{
+			name:    "inputs set",
+			content: flakeWithInputSet,
+			want: []Input{
+				{Name: "nixpkgs", URL: "github:NixOS/nixpkgs/nixos-unstable"},
+				{Name: "home-manager", URL: "github:nix-community/home-manager", Follows: "nixpkgs"},
+			},
+		},
+		{
+			name:    "input paths",
+			content: flakeWithInputPaths,
+			want: []Input{
+				{Name: "nixpkgs", URL: "github:NixOS/nixpkgs/nixos-unstable"},
+				{Name: "nur", URL: "github:nix-community/NUR"},
+			},
+		},
+		{
+			name:    "inputs used in outputs are not declarations",
+			content: `{ outputs = inputs: { specialArgs = { inputs = inputs; }; }; }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewConfig(tt.content).Inputs()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Inputs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_AddInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		input   Input
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "inputs set",
+			content: "{\n  inputs = {\n    nixpkgs.url = \"nixpkgs\";\n  };\n  outputs = _: { };\n}",
+			input:   Input{Name: "nur", URL: "github:nix-community/NUR", Follows: "nixpkgs"},
+			want:    "{\n  inputs = {\n    nixpkgs.url = \"nixpkgs\";\n    nur.url = \"github:nix-community/NUR\";\n    nur.inputs.nixpkgs.follows = \"nixpkgs\";\n  };\n  outputs = _: { };\n}",
+		},
+		{
+			name:    "input paths",
+			content: "{\n  inputs.nixpkgs.url = \"nixpkgs\";\n\n  outputs = _: { };\n}",
+			input:   Input{Name: "nur", URL: "github:nix-community/NUR"},
+			want:    "{\n  inputs.nixpkgs.url = \"nixpkgs\";\n  inputs.nur.url = \"github:nix-community/NUR\";\n\n  outputs = _: { };\n}",
+		},
+		{
+			name:    "no inputs",
+			content: "{\n  outputs = _: { };\n}",
+			input:   Input{Name: "nur", URL: "github:nix-community/NUR"},
+			want:    "{\n  outputs = _: { };\n  inputs = {\n    nur.url = \"github:nix-community/NUR\";\n  };\n}",
+		},
+		{
+			name:    "input exists",
+			content: flakeWithInputPaths,
+			input:   Input{Name: "nur", URL: "github:nix-community/NUR"},
+			want:    flakeWithInputPaths,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			err := cfg.AddInput(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("AddInput() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_RemoveInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		input   string
+		want    []string
+		removed bool
+	}{
+		{name: "nested set", content: flakeWithInputSet, input: "home-manager", want: []string{"nixpkgs"}, removed: true},
+		{name: "input path", content: flakeWithInputPaths, input: "nur", want: []string{"nixpkgs"}, removed: true},
+		{name: "missing", content: flakeWithInputPaths, input: "emacs-overlay", want: []string{"nixpkgs", "nur"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			if removed := cfg.RemoveInput(tt.input); removed != tt.removed {
+				t.Errorf("RemoveInput() = %v, want %v", removed, tt.removed)
+			}
+			var got []string
+			for _, input := range cfg.Inputs() {
+				got = append(got, input.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("inputs after RemoveInput() = %v, want %v\n%s", got, tt.want, cfg.Content())
+			}
+		})
+	}
+}
+
+func TestConfig_SetInputURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		input       string
+		url         string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{name: "nested set", content: flakeWithInputSet, input: "home-manager", url: "github:nix-community/home-manager/release-25.05", wantChanged: true},
+		{name: "input path", content: flakeWithInputPaths, input: "nur", url: "github:nix-community/NUR/main", wantChanged: true},
+		{name: "same url", content: flakeWithInputPaths, input: "nur", url: "github:nix-community/NUR"},
+		{name: "missing", content: flakeWithInputPaths, input: "emacs-overlay", url: "github:nix-community/emacs-overlay", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			changed, err := cfg.SetInputURL(tt.input, tt.url)
+			if (err != nil) != tt.wantErr || changed != tt.wantChanged {
+				t.Fatalf("SetInputURL() = %v, %v, want %v (error %v)", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, input := range cfg.Inputs() {
+				if input.Name == tt.input && input.URL != tt.url {
+					t.Errorf("url after SetInputURL() = %s, want %s", input.URL, tt.url)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_BindInputs(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{
+			name:        "set pattern",
+			content:     "{\n  outputs = { self, nixpkgs, ... }: { };\n}",
+			want:        "{\n  outputs = { self, nixpkgs, ... }@inputs: { };\n}",
+			wantChanged: true,
+		},
+		{
+			name:    "bound in front",
+			content: "{\n  outputs = inputs@{ self, ... }: { };\n}",
+			want:    "{\n  outputs = inputs@{ self, ... }: { };\n}",
+		},
+		{
+			name:    "bound behind",
+			content: "{\n  outputs = { self, ... } @ inputs: { };\n}",
+			want:    "{\n  outputs = { self, ... } @ inputs: { };\n}",
+		},
+		{
+			name:    "plain argument",
+			content: "{\n  outputs = inputs: { };\n}",
+			want:    "{\n  outputs = inputs: { };\n}",
+		},
+		{
+			name:    "other argument name",
+			content: "{\n  outputs = args: { };\n}",
+			want:    "{\n  outputs = args: { };\n}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			changed, err := cfg.BindInputs()
+			if (err != nil) != tt.wantErr || changed != tt.wantChanged {
+				t.Fatalf("BindInputs() = %v, %v, want %v (error %v)", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("BindInputs() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_AddOverlay(t *testing.T) {
+	content := `{
+  outputs = { nixpkgs, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [
+        ./hosts/laptop/configuration.nix
+      ];
+    };
+    nixosConfigurations.server = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/server/configuration.nix ];
+    };
+  };
+}`
+	want := `{
+  outputs = { nixpkgs, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [
+        ./hosts/laptop/configuration.nix
+        { nixpkgs.overlays = [ inputs.emacs-overlay.overlays.default ]; }
+      ];
+    };
+    nixosConfigurations.server = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/server/configuration.nix { nixpkgs.overlays = [ inputs.emacs-overlay.overlays.default ]; } ];
+    };
+  };
+}`
+
+	cfg := NewConfig(content)
+	changed, err := cfg.AddOverlay("emacs-overlay")
+	if err != nil || changed != 2 {
+		t.Fatalf("AddOverlay() = %d, %v, want 2 calls changed", changed, err)
+	}
+	if cfg.Content() != want {
+		t.Errorf("AddOverlay() content =\n%s\nwant\n%s", cfg.Content(), want)
+	}
+
+	// Adding it again changes nothing
+	changed, err = cfg.AddOverlay("emacs-overlay")
+	if err != nil || changed != 0 || cfg.Content() != want {
+		t.Errorf("second AddOverlay() = %d, %v, want no change", changed, err)
+	}
+}
+
+func TestConfig_AddNixosModule(t *testing.T) {
+	content := `{
+  outputs = { nixpkgs, nix-darwin, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+    darwinConfigurations.macbook = nix-darwin.lib.darwinSystem {
+      modules = [ ./hosts/macbook/configuration.nix ];
+    };
+  };
+}`
+	want := `{
+  outputs = { nixpkgs, nix-darwin, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix inputs.nix-flatpak.nixosModules.nix-flatpak ];
+    };
+    darwinConfigurations.macbook = nix-darwin.lib.darwinSystem {
+      modules = [ ./hosts/macbook/configuration.nix ];
+    };
+  };
+}`
+
+	cfg := NewConfig(content)
+	changed, err := cfg.AddNixosModule("inputs.nix-flatpak.nixosModules.nix-flatpak")
+	if err != nil || changed != 1 {
+		t.Fatalf("AddNixosModule() = %d, %v, want the NixOS call changed", changed, err)
+	}
+	if cfg.Content() != want {
+		t.Errorf("AddNixosModule() content =\n%s\nwant\n%s", cfg.Content(), want)
+	}
+
+	changed, err = cfg.AddNixosModule("inputs.nix-flatpak.nixosModules.nix-flatpak")
+	if err != nil || changed != 0 || cfg.Content() != want {
+		t.Errorf("second AddNixosModule() = %d, %v, want no change", changed, err)
+	}
+}
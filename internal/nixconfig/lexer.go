@@ -0,0 +1,230 @@
+package nixconfig
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokLBrace
+	tokRBrace
+	tokLBracket
+	tokRBracket
+	tokLParen
+	tokRParen
+	tokAssign
+	tokSemicolon
+	tokDot
+	// tokPath is a relative or home path such as ./firefox.nix
+	tokPath
+	tokOther
+)
+
+// token is a lexical element of a nix file. Whitespace and comments are not tokens,
+// so edits made by offset keep them untouched.
+type token struct {
+	kind  tokenKind
+	start int
+	end   int
+	text  string
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func tokenize(src string) []token {
+	l := &lexer{src: src}
+	var tokens []token
+	for {
+		tok := l.next()
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '-' || c == '\''
+}
+
+func isPathChar(c byte) bool {
+	return isIdentChar(c) || c == '.' || c == '/' || c == '+'
+}
+
+// pathStart reports whether a path starts at the current position: ./, ../ or ~/
+func (l *lexer) pathStart() bool {
+	switch l.peek(0) {
+	case '~':
+		return l.peek(1) == '/'
+	case '.':
+		return l.peek(1) == '/' || (l.peek(1) == '.' && l.peek(2) == '/')
+	}
+	return false
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+offset]
+}
+
+func (l *lexer) token(kind tokenKind, start int) token {
+	return token{kind: kind, start: start, end: l.pos, text: l.src[start:l.pos]}
+}
+
+func (l *lexer) next() token {
+	l.skipSpaceAndComments()
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, start: len(l.src), end: len(l.src)}
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '"':
+		l.scanString()
+		return l.token(tokString, start)
+	case c == '\'' && l.peek(1) == '\'':
+		l.scanIndentedString()
+		return l.token(tokString, start)
+	case l.pathStart():
+		for l.pos < len(l.src) && isPathChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return l.token(tokPath, start)
+	case isIdentStart(c):
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return l.token(tokIdent, start)
+	}
+
+	l.pos++
+	switch c {
+	case '{':
+		return l.token(tokLBrace, start)
+	case '}':
+		return l.token(tokRBrace, start)
+	case '[':
+		return l.token(tokLBracket, start)
+	case ']':
+		return l.token(tokRBracket, start)
+	case '(':
+		return l.token(tokLParen, start)
+	case ')':
+		return l.token(tokRParen, start)
+	case ';':
+		return l.token(tokSemicolon, start)
+	case '.':
+		return l.token(tokDot, start)
+	case '=':
+		if l.peek(0) == '=' {
+			l.pos++
+			return l.token(tokOther, start)
+		}
+		return l.token(tokAssign, start)
+	case '!', '<', '>':
+		// Keep comparison operators from looking like an assignment
+		if l.peek(0) == '=' {
+			l.pos++
+		}
+	}
+	return l.token(tokOther, start)
+}
+
+func (l *lexer) skipSpaceAndComments() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.peek(1) == '*':
+			l.pos += 2
+			for l.pos < len(l.src) && !(l.src[l.pos] == '*' && l.peek(1) == '/') {
+				l.pos++
+			}
+			l.pos += 2
+			if l.pos > len(l.src) {
+				l.pos = len(l.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// scanString consumes a "double quoted" string including any ${...} interpolations
+func (l *lexer) scanString() {
+	l.pos++
+	for l.pos < len(l.src) {
+		switch {
+		case l.src[l.pos] == '\\':
+			l.pos += 2
+		case l.src[l.pos] == '"':
+			l.pos++
+			return
+		case l.src[l.pos] == '$' && l.peek(1) == '{':
+			l.pos += 2
+			l.skipInterpolation()
+		default:
+			l.pos++
+		}
+	}
+	l.pos = min(l.pos, len(l.src))
+}
+
+// scanIndentedString consumes an indented string with its escapes and interpolations
+func (l *lexer) scanIndentedString() {
+	l.pos += 2
+	for l.pos < len(l.src) {
+		switch {
+		case l.src[l.pos] == '\'' && l.peek(1) == '\'':
+			switch l.peek(2) {
+			case '\'', '$':
+				l.pos += 3
+			case '\\':
+				l.pos += 4
+			default:
+				l.pos += 2
+				return
+			}
+		case l.src[l.pos] == '$' && l.peek(1) == '{':
+			l.pos += 2
+			l.skipInterpolation()
+		default:
+			l.pos++
+		}
+	}
+	l.pos = min(l.pos, len(l.src))
+}
+
+// skipInterpolation consumes tokens up to the brace closing a ${ that was already consumed
+func (l *lexer) skipInterpolation() {
+	depth := 1
+	for {
+		tok := l.next()
+		switch tok.kind {
+		case tokEOF:
+			return
+		case tokLBrace:
+			depth++
+		case tokRBrace:
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
@@ -1,133 +1,1013 @@
 package nixconfig
 
 import (
+	"errors"
 	"fmt"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// defaultIndentUnit is the indentation added per nesting level for inserted bindings
+// when the file doesn't show one
+const defaultIndentUnit = "  "
+
+// DefaultNamespace is the attribute path hosts enable generated modules under, as in
+// apps.<category>.<name>.enable
+const DefaultNamespace = "apps"
+
+// Config edits a nix file through its syntax tree. Every edit splices the source at
+// node offsets, so comments and formatting outside the edited bindings are kept as is.
 type Config struct {
 	content string
+	// namespace is the attribute path of the apps section, see SetNamespace
+	namespace []string
 }
 
 func NewConfig(content string) *Config {
-	return &Config{content: content}
+	return &Config{content: content, namespace: []string{DefaultNamespace}}
+}
+
+// SetNamespace makes the category edits work on the apps section at namespace, an
+// attribute path such as myflake.apps, instead of DefaultNamespace
+func (c *Config) SetNamespace(namespace string) {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	c.namespace = strings.Split(namespace, ".")
+}
+
+// document parses the content, with the apps section at the namespace of c
+func (c *Config) document() *document {
+	doc := parse(c.content)
+	doc.namespace = c.namespace
+	return doc
 }
 
 func (c *Config) Content() string {
 	return c.content
 }
 
-func (c *Config) CategoryExists(category string) bool {
-	pattern := regexp.QuoteMeta(category) + `\s*=\s*\{`
-	matched, _ := regexp.MatchString(pattern, c.content)
-	return matched
+// findSet returns the attribute set bound at path, falling back to any set whose
+// attribute path ends in path so that fragments of a config can be edited too
+func (d *document) findSet(path ...string) *attrSet {
+	for _, b := range d.bindings {
+		if b.set != nil && slices.Equal(b.fullPath(), path) {
+			return b.set
+		}
+	}
+	for _, b := range d.bindings {
+		full := b.fullPath()
+		if b.set != nil && len(full) >= len(path) && slices.Equal(full[len(full)-len(path):], path) {
+			return b.set
+		}
+	}
+	return nil
 }
 
-func (c *Config) PackageExistsInCategory(category string, packageName string) bool {
-	// Use regex to find category with flexible whitespace
-	categoryStart := regexp.QuoteMeta(category) + `\s*=\s*\{`
-	re := regexp.MustCompile(categoryStart)
-	startLoc := re.FindStringIndex(c.content)
+// categoryPath splits a category, a folder below the module directory such as
+// dev/editors, into the attribute path of its set within the apps section
+func categoryPath(category string) []string {
+	return strings.Split(category, "/")
+}
 
-	if startLoc == nil {
-		return false
+// setAt returns the attribute set bound at exactly path
+func (d *document) setAt(path []string) *attrSet {
+	for _, b := range d.bindings {
+		if b.set != nil && slices.Equal(b.fullPath(), path) {
+			return b.set
+		}
+	}
+	return nil
+}
+
+// findCategory returns the set for a category, preferring the one inside the apps section
+func (d *document) findCategory(category string) *attrSet {
+	path := categoryPath(category)
+	if apps := d.findSet(d.namespace...); apps != nil && apps.owner != nil {
+		if set := d.setAt(append(apps.owner.fullPath(), path...)); set != nil {
+			return set
+		}
+	}
+	return d.findSet(path...)
+}
+
+// deepestSet returns the innermost set of apps holding the path of a category, with the
+// names of path below it that have no set yet. For dev/editors in `apps = { dev = { }; };`
+// that is the set of dev and [editors].
+func (d *document) deepestSet(apps *attrSet, path []string) (*attrSet, []string) {
+	if apps.owner == nil {
+		return apps, path
+	}
+	set, prefix := apps, apps.owner.fullPath()
+	for len(path) > 0 {
+		prefix = append(prefix, path[0])
+		inner := d.setAt(prefix)
+		if inner == nil {
+			break
+		}
+		set, path = inner, path[1:]
+	}
+	return set, path
+}
+
+// nestedSets returns a binding nesting a set for every name of path, the innermost one
+// holding the binding inner or nothing when it is empty, e.g. for [dev editors]:
+//
+//	dev = {
+//	  editors = {
+//	    helix.enable = true;
+//	  };
+//	};
+func nestedSets(unit string, path []string, inner string) string {
+	text := attrPath(path[len(path)-1:]) + " = { };"
+	if inner != "" {
+		text = fmt.Sprintf("%s = {\n%s\n};", attrPath(path[len(path)-1:]), indentLines(inner, unit))
+	}
+	for i := len(path) - 2; i >= 0; i-- {
+		text = fmt.Sprintf("%s = {\n%s\n};", attrPath(path[i:i+1]), indentLines(text, unit))
+	}
+	return text
+}
+
+// enableBindings returns the `<pkg>.enable` bindings of a package within set
+func (d *document) enableBindings(set *attrSet, packageName string) []*binding {
+	var prefix []string
+	if set.owner != nil {
+		prefix = set.owner.fullPath()
 	}
+	target := append(append([]string{}, prefix...), packageName, "enable")
 
-	startPos := startLoc[1]
-	endPos := strings.Index(c.content[startPos:], "};")
-	if endPos == -1 {
+	var found []*binding
+	for _, b := range d.bindings {
+		if slices.Equal(b.fullPath(), target) {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+func (c *Config) CategoryExists(category string) bool {
+	return c.document().findSet(categoryPath(category)...) != nil
+}
+
+func (c *Config) PackageExistsInCategory(category string, packageName string) bool {
+	doc := c.document()
+	set := doc.findCategory(category)
+	if set == nil {
 		return false
 	}
+	return len(doc.enableBindings(set, packageName)) > 0
+}
 
-	categorySection := c.content[startPos : startPos+endPos]
-	// Use regex to match package.enable pattern
-	packagePattern := regexp.QuoteMeta(packageName) + `\.enable`
-	matched, _ := regexp.MatchString(packagePattern, categorySection)
-	return matched
+// PackageEnabled reports whether the package is set to true in the category, and whether it is set at all
+func (c *Config) PackageEnabled(category string, packageName string) (enabled bool, found bool) {
+	doc := c.document()
+	set := doc.findCategory(category)
+	if set == nil {
+		return false, false
+	}
+	bindings := doc.enableBindings(set, packageName)
+	if len(bindings) == 0 {
+		return false, false
+	}
+	b := bindings[len(bindings)-1]
+	return c.content[b.valueStart:b.valueEnd] == "true", true
 }
 
+// EnablePackage flips every `<pkg>.enable = false;` in the file to true
 func (c *Config) EnablePackage(packageName string) bool {
-	// Use regex to match flexible whitespace around equals and semicolon
-	oldPattern := regexp.QuoteMeta(packageName) + `\.enable\s*=\s*false\s*;`
-	newPattern := packageName + ".enable = true;"
+	doc := c.document()
+	var disabled []*binding
+	for _, b := range doc.bindings {
+		path := b.path
+		if len(path) >= 2 && slices.Equal(path[len(path)-2:], []string{packageName, "enable"}) {
+			disabled = append(disabled, b)
+		} else if len(path) == 1 && path[0] == "enable" && b.parent.owner != nil && b.parent.owner.path[len(b.parent.owner.path)-1] == packageName {
+			disabled = append(disabled, b)
+		}
+	}
+	return c.setEnabled(disabled, true)
+}
 
-	re := regexp.MustCompile(oldPattern)
-	if !re.MatchString(c.content) {
-		return false // Pattern not found
+// setEnabled flips the given bindings to enabled, reporting whether any of them changed
+func (c *Config) setEnabled(bindings []*binding, enabled bool) bool {
+	from, to := "true", "false"
+	if enabled {
+		from, to = to, from
 	}
 
-	c.content = re.ReplaceAllString(c.content, newPattern)
+	changed := false
+	// Work backwards so earlier offsets stay valid
+	for i := len(bindings) - 1; i >= 0; i-- {
+		b := bindings[i]
+		if c.content[b.valueStart:b.valueEnd] != from {
+			continue
+		}
+		if len(b.path) == 2 && b.end > b.valueEnd {
+			// Keep the key as written, `"1password".enable` loses its quotes in b.path
+			c.content = c.content[:b.start] + c.content[b.start:b.pathEnd] + " = " + to + ";" + c.content[b.end:]
+		} else {
+			c.content = c.content[:b.valueStart] + to + c.content[b.valueEnd:]
+		}
+		changed = true
+	}
+	return changed
+}
+
+// DisablePackage sets the package to false in the category, keeping the line so it
+// can be enabled again. It reports whether the package was enabled before.
+func (c *Config) DisablePackage(category string, packageName string) bool {
+	doc := c.document()
+	set := doc.findCategory(category)
+	if set == nil {
+		return false
+	}
+	return c.setEnabled(doc.enableBindings(set, packageName), false)
+}
+
+// RemovePackage deletes the package.enable line from the category, reporting whether one was found
+func (c *Config) RemovePackage(category string, packageName string) bool {
+	doc := c.document()
+	set := doc.findCategory(category)
+	if set == nil {
+		return false
+	}
+	found := doc.enableBindings(set, packageName)
+	if len(found) == 0 {
+		return false
+	}
+
+	for i := len(found) - 1; i >= 0; i-- {
+		b := found[i]
+		// Drop `pkg = { enable = true; };` as a whole when enable is all it holds
+		if owner := b.parent.owner; owner != nil && len(b.path) == 1 && len(b.parent.bindings) == 1 {
+			b = owner
+		}
+		c.removeRange(b.start, b.end)
+	}
 	return true
 }
 
-func (c *Config) AddPackageToCategory(category string, packageName string) error {
-	// Use regex to find category with flexible whitespace
-	categoryStart := regexp.QuoteMeta(category) + `\s*=\s*\{`
-	re := regexp.MustCompile(categoryStart)
-	startLoc := re.FindStringIndex(c.content)
+// removeRange cuts src[start:end], taking the whole line with it when nothing but a
+// trailing comment shares it
+func (c *Config) removeRange(start, end int) {
+	lineStart := strings.LastIndex(c.content[:start], "\n") + 1
+	lineEnd := len(c.content)
+	if i := strings.Index(c.content[end:], "\n"); i >= 0 {
+		lineEnd = end + i + 1
+	}
+	rest := strings.TrimSpace(c.content[end:lineEnd])
+	if strings.TrimSpace(c.content[lineStart:start]) == "" && (rest == "" || strings.HasPrefix(rest, "#")) {
+		start, end = lineStart, lineEnd
+	}
+	c.content = c.content[:start] + c.content[end:]
+}
 
-	if startLoc == nil {
+func (c *Config) AddPackageToCategory(category string, packageName string) error {
+	set := c.document().findCategory(category)
+	if set == nil {
 		return fmt.Errorf("category '%s' not found in configuration", category)
 	}
-
-	startPos := startLoc[1]
-	endPos := strings.Index(c.content[startPos:], "};")
-	if endPos == -1 {
+	if set.close >= len(c.content) {
 		return fmt.Errorf("category '%s' closing brace not found", category)
 	}
 
-	absoluteEndPos := startPos + endPos
-	packageContent := "\n      " + packageName + ".enable = true;\n    "
-
-	c.content = c.content[:absoluteEndPos] + packageContent + c.content[absoluteEndPos:]
+	c.insertBinding(set, attrPath([]string{packageName, "enable"})+" = true;")
 	return nil
 }
 
+// CreateCategory adds the category with packageName enabled to the apps section. A nested
+// category such as dev/editors goes into the sets of its parents, creating the missing ones.
 func (c *Config) CreateCategory(category string, packageName string) error {
-	// Use regex to find apps section with flexible whitespace
-	appStart := `apps\s*=\s*\{`
-	re := regexp.MustCompile(appStart)
-	startLoc := re.FindStringIndex(c.content)
-
-	if startLoc == nil {
-		return fmt.Errorf("'apps' section not found in configuration")
+	doc := c.document()
+	apps := doc.findSet(c.namespace...)
+	if apps == nil {
+		return fmt.Errorf("'%s' section not found in configuration", attrPath(c.namespace))
+	}
+	set, missing := doc.deepestSet(apps, categoryPath(category))
+	if set.close >= len(c.content) {
+		return fmt.Errorf("'%s' section closing brace not found", attrPath(c.namespace))
 	}
 
-	insertPos := startLoc[1]
-	newCategory := fmt.Sprintf("\n    %s = {\n      %s.enable = true;\n    };\n", category, packageName)
-
-	c.content = c.content[:insertPos] + newCategory + c.content[insertPos:]
+	enable := attrPath([]string{packageName, "enable"}) + " = true;"
+	if len(missing) == 0 {
+		c.insertBinding(set, enable)
+		return nil
+	}
+	c.insertBinding(set, nestedSets(c.indentUnit(), missing, enable))
 	return nil
 }
 
 func (c *Config) EnsureAppsSectionExists() error {
-	if c.CategoryExists("apps") {
+	doc := c.document()
+	if doc.findSet(c.namespace...) != nil {
 		return nil
 	}
 
-	// Find the last closing brace in the file
-	lastBrace := strings.LastIndex(c.content, "}")
-	if lastBrace == -1 {
-		return fmt.Errorf("no closing brace found in configuration")
+	body := doc.moduleBody()
+	if body == nil {
+		return fmt.Errorf("no attribute set found in configuration")
 	}
 
-	// Insert apps section before the last closing brace
-	appsSection := "\n  apps = {\n  };\n\n"
-	c.content = c.content[:lastBrace] + appsSection + c.content[lastBrace:]
+	c.insertBinding(body, attrPath(c.namespace)+" = {\n};")
 	return nil
 }
 
-func (c *Config) AddOrEnablePackage(category, packageName string) error {
-	if c.CategoryExists(category) {
-		if c.PackageExistsInCategory(category, packageName) {
-			c.EnablePackage(packageName)
-			return nil
-		} else {
-			c.AddPackageToCategory(category, packageName)
+// moduleBody returns the last top level set, which follows any function arguments
+func (d *document) moduleBody() *attrSet {
+	var body *attrSet
+	for _, set := range d.sets {
+		if set.parent == d.root && set.close < len(d.src) {
+			body = set
+		}
+	}
+	return body
+}
+
+// indentUnit returns the indentation the file adds per nesting level: a tab when most
+// indented lines start with one, otherwise the most common step between the indentation
+// of a line and the next deeper one
+func (c *Config) indentUnit() string {
+	tabs, spaces := 0, 0
+	steps := map[int]int{}
+	previous := 0
+	for _, line := range strings.Split(c.content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
 		}
-	} else {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indent, "\t") {
+			tabs++
+			continue
+		}
+		if indent != "" {
+			spaces++
+		}
+		if len(indent) > previous {
+			steps[len(indent)-previous]++
+		}
+		previous = len(indent)
+	}
+	if tabs > spaces {
+		return "\t"
+	}
+	best := 0
+	for step, count := range steps {
+		if count > steps[best] || (count == steps[best] && step < best) {
+			best = step
+		}
+	}
+	if best == 0 {
+		return defaultIndentUnit
+	}
+	return strings.Repeat(" ", best)
+}
+
+// lineIndent returns the whitespace starting the line of offset, and whether nothing
+// else comes before offset on that line
+func (c *Config) lineIndent(offset int) (string, bool) {
+	lineStart := strings.LastIndex(c.content[:offset], "\n") + 1
+	prefix := c.content[lineStart:offset]
+	indent := prefix[:len(prefix)-len(strings.TrimLeft(prefix, " \t"))]
+	return indent, indent == prefix
+}
+
+// insertBinding adds text as the last binding of set, at the indentation of the bindings
+// it has, or one level deeper than its closing brace
+func (c *Config) insertBinding(set *attrSet, text string) {
+	lineStart := strings.LastIndex(c.content[:set.close], "\n") + 1
+	if lineStart > set.open && strings.TrimSpace(c.content[lineStart:set.close]) == "" {
+		// The closing brace sits on its own line, so add the binding just above it
+		indent := c.content[lineStart:set.close] + c.indentUnit()
+		if n := len(set.bindings); n > 0 {
+			if own, ok := c.lineIndent(set.bindings[n-1].start); ok {
+				indent = own
+			}
+		}
+		c.content = c.content[:lineStart] + indentLines(text, indent) + "\n" + c.content[lineStart:]
+		return
+	}
+
+	// `{ }` or a set on a single line: break it open
+	openLineStart := strings.LastIndex(c.content[:set.open], "\n") + 1
+	openLine := c.content[openLineStart:set.open]
+	baseIndent := openLine[:len(openLine)-len(strings.TrimLeft(openLine, " \t"))]
+	before := strings.TrimRight(c.content[:set.close], " \t")
+	c.content = before + "\n" + indentLines(text, baseIndent+c.indentUnit()) + "\n" + baseIndent + c.content[set.close:]
+}
+
+func indentLines(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = indent + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Config) AddOrEnablePackage(category, packageName string) error {
+	doc := c.document()
+	set := doc.findCategory(category)
+	if set == nil {
 		return c.CreateCategory(category, packageName)
 	}
+	if found := doc.enableBindings(set, packageName); len(found) > 0 {
+		c.setEnabled(found, true)
+		return nil
+	}
+	return c.AddPackageToCategory(category, packageName)
+}
+
+// EnsureCategory adds an empty category to the apps section, creating the section when
+// it is missing. It reports whether the category was added.
+func (c *Config) EnsureCategory(category string) (bool, error) {
+	if c.document().findCategory(category) != nil {
+		return false, nil
+	}
+	err := c.EnsureAppsSectionExists()
+	if err != nil {
+		return false, err
+	}
+	doc := c.document()
+	apps := doc.findSet(c.namespace...)
+	if apps == nil {
+		return false, fmt.Errorf("'%s' section closing brace not found", attrPath(c.namespace))
+	}
+	set, missing := doc.deepestSet(apps, categoryPath(category))
+	if set.close >= len(c.content) {
+		return false, fmt.Errorf("'%s' section closing brace not found", attrPath(c.namespace))
+	}
+	c.insertBinding(set, nestedSets(c.indentUnit(), missing, ""))
+	return true, nil
+}
+
+// appsPrefix returns the attribute path of the apps section, e.g. [apps] or [config apps]
+func (d *document) appsPrefix() []string {
+	if apps := d.findSet(d.namespace...); apps != nil && apps.owner != nil {
+		return apps.owner.fullPath()
+	}
+	if slices.ContainsFunc(d.bindings, func(b *binding) bool {
+		full := b.fullPath()
+		return len(full) > len(d.namespace) && slices.Equal(full[:len(d.namespace)], d.namespace)
+	}) {
+		// Only flattened `apps.<category>...` bindings
+		return d.namespace
+	}
 	return nil
 }
+
+// AppEntry is a package the apps section of a host mentions
+type AppEntry struct {
+	// Category is the path between apps and the package with / separators, like module folders
+	Category string
+	Name     string
+	Enabled  bool
+}
+
+// AppEntries lists every `<category>.<name>.enable` binding of the apps section in file order
+func (c *Config) AppEntries() []AppEntry {
+	doc := c.document()
+	prefix := doc.appsPrefix()
+	if prefix == nil {
+		return nil
+	}
+	var entries []AppEntry
+	for _, b := range doc.bindings {
+		full := b.fullPath()
+		if len(full) < len(prefix)+3 || !slices.Equal(full[:len(prefix)], prefix) || full[len(full)-1] != "enable" {
+			continue
+		}
+		rest := full[len(prefix) : len(full)-1]
+		entries = append(entries, AppEntry{
+			Category: strings.Join(rest[:len(rest)-1], "/"),
+			Name:     rest[len(rest)-1],
+			Enabled:  strings.TrimSpace(c.content[b.valueStart:b.valueEnd]) == "true",
+		})
+	}
+	return entries
+}
+
+// categoryName is the path element naming a category, the last one of a nested category,
+// and the binding it appears in
+type categoryName struct {
+	b     *binding
+	index int
+}
+
+// categoryNames finds every binding naming the category in its own attribute path, e.g.
+// `browsers = { ... };` inside apps or `apps.browsers.firefox.enable = true;`
+func (d *document) categoryNames(category string) []categoryName {
+	prefix := d.appsPrefix()
+	target := append(append([]string{}, prefix...), categoryPath(category)...)
+
+	var found []categoryName
+	for _, b := range d.bindings {
+		full := b.fullPath()
+		if len(full) < len(target) || !slices.Equal(full[:len(target)], target) {
+			continue
+		}
+		index := len(target) - 1 - (len(full) - len(b.path))
+		if index >= 0 {
+			found = append(found, categoryName{b: b, index: index})
+		}
+	}
+	return found
+}
+
+// ErrCategoryParent is returned when a rename would move a nested category to other parents
+var ErrCategoryParent = errors.New("a category can only be renamed within its parent")
+
+// RenameCategory renames the category in the apps section, keeping its packages and
+// formatting. A nested category keeps its parents, newName can only differ from it in
+// its last name. It reports whether the category was found.
+func (c *Config) RenameCategory(category string, newName string) (bool, error) {
+	path, newPath := categoryPath(category), categoryPath(newName)
+	if !slices.Equal(path[:len(path)-1], newPath[:len(newPath)-1]) {
+		return false, fmt.Errorf("renaming %s to %s: %w", category, newName, ErrCategoryParent)
+	}
+	newName = attrPath(newPath[len(newPath)-1:])
+	doc := c.document()
+	found := doc.categoryNames(category)
+	// Work backwards so earlier offsets stay valid
+	for i := len(found) - 1; i >= 0; i-- {
+		b := found[i].b
+		// The path is a sequence of names separated by dots
+		tok := tokenize(c.content[b.start:b.valueStart])[found[i].index*2]
+		start, end := b.start+tok.start, b.start+tok.end
+		c.content = c.content[:start] + newName + c.content[end:]
+	}
+	return len(found) > 0, nil
+}
+
+// RemoveCategory deletes the category and every package in it from the apps section,
+// reporting whether the category was found
+func (c *Config) RemoveCategory(category string) bool {
+	doc := c.document()
+	found := doc.categoryNames(category)
+	for i := len(found) - 1; i >= 0; i-- {
+		c.removeRange(found[i].b.start, found[i].b.end)
+	}
+	return len(found) > 0
+}
+
+// systemFunctions build a system from modules and take the specialArgs passed to them
+var systemFunctions = map[string]bool{"nixosSystem": true, "darwinSystem": true}
+
+// mentions reports whether the nix source uses the identifier name
+func mentions(src string, name string) bool {
+	for _, tok := range tokenize(src) {
+		if tok.kind == tokIdent && tok.text == name {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleArg reports whether name is set for every module through _module.args
+func (d *document) moduleArg(name string) bool {
+	for _, b := range d.bindings {
+		full := strings.Join(b.fullPath(), ".")
+		if !strings.HasPrefix(full, "_module.args") && !strings.Contains(full, "._module.args") {
+			continue
+		}
+		if slices.Contains(b.path, name) || mentions(d.src[b.valueStart:b.valueEnd], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingSpecialArg returns the first system call that doesn't pass name and its
+// specialArgs binding, which is nil when the call has none
+func (d *document) missingSpecialArg(name string) (call *attrSet, specialArgs *binding) {
+	for _, set := range d.sets {
+		if !systemFunctions[set.function] {
+			continue
+		}
+		var found *binding
+		passed := false
+		for _, b := range set.bindings {
+			if b.path[0] != "specialArgs" {
+				continue
+			}
+			if len(b.path) == 1 {
+				found = b
+			}
+			if slices.Contains(b.path, name) || mentions(d.src[b.valueStart:b.valueEnd], name) {
+				passed = true
+			}
+		}
+		if !passed {
+			return set, found
+		}
+	}
+	return nil, nil
+}
+
+// SystemCalls returns how many nixosSystem and darwinSystem calls the file makes
+func (c *Config) SystemCalls() int {
+	calls := 0
+	for _, set := range parse(c.content).sets {
+		if systemFunctions[set.function] {
+			calls++
+		}
+	}
+	return calls
+}
+
+// AddSpecialArg passes name to the modules of every nixosSystem and darwinSystem call
+// that doesn't pass it yet, adding it to the call's specialArgs or creating them.
+// value returns the expression for a call, darwin is true for darwinSystem.
+// Arguments set with _module.args count as passed. It returns how many calls changed.
+func (c *Config) AddSpecialArg(name string, value func(darwin bool) string) (int, error) {
+	changed := 0
+	for {
+		doc := parse(c.content)
+		if doc.moduleArg(name) {
+			return changed, nil
+		}
+		call, specialArgs := doc.missingSpecialArg(name)
+		if call == nil {
+			return changed, nil
+		}
+
+		arg := fmt.Sprintf("%s = %s;", name, value(call.function == "darwinSystem"))
+		switch {
+		case specialArgs == nil:
+			c.insertBinding(call, fmt.Sprintf("specialArgs = {\n%s%s\n};", c.indentUnit(), arg))
+		case specialArgs.set != nil:
+			c.insertBinding(specialArgs.set, arg)
+		default:
+			return changed, fmt.Errorf("the specialArgs of %s are not an attribute set, add `%s` to them by hand", call.function, arg)
+		}
+		changed++
+	}
+}
+
+// PackageListOptions are the options a plain layout installs packages into, the first
+// one a file sets is used
+var PackageListOptions = []string{"environment.systemPackages", "home.packages"}
+
+// packageList is the first list literal in the value of a package list option
+type packageList struct {
+	open  int // offset of '['
+	close int // offset of ']'
+	// withPkgs is set for `with pkgs; [ ... ]`, whose items leave out the pkgs. prefix
+	withPkgs bool
+	items    []string
+}
+
+// findBinding returns the binding at path, falling back to one whose attribute path
+// ends in path, e.g. config.environment.systemPackages
+func (d *document) findBinding(path ...string) *binding {
+	for _, b := range d.bindings {
+		if slices.Equal(b.fullPath(), path) {
+			return b
+		}
+	}
+	for _, b := range d.bindings {
+		full := b.fullPath()
+		if len(full) >= len(path) && slices.Equal(full[len(full)-len(path):], path) {
+			return b
+		}
+	}
+	return nil
+}
+
+// packageList reads the list bound by b, nil when its value holds no list
+func (d *document) packageList(b *binding) *packageList {
+	list := &packageList{open: -1}
+	depth := 0
+	tokens := tokenize(d.src)
+	for n := 0; n < len(tokens); n++ {
+		tok := tokens[n]
+		if tok.start < b.valueStart || tok.end > b.valueEnd {
+			continue
+		}
+		if list.open < 0 {
+			switch {
+			case tok.kind == tokIdent && tok.text == "with" && tokens[n+1].text == "pkgs":
+				list.withPkgs = true
+			case tok.kind == tokLBracket:
+				list.open = tok.start
+			}
+			continue
+		}
+
+		switch tok.kind {
+		case tokLBracket, tokLParen, tokLBrace:
+			depth++
+		case tokRParen, tokRBrace:
+			depth--
+		case tokRBracket:
+			if depth == 0 {
+				list.close = tok.start
+				return list
+			}
+			depth--
+		case tokIdent:
+			if depth > 0 {
+				continue
+			}
+			// Join `pkgs.python3Packages.numpy` into a single item
+			item := tok.text
+			for n+2 < len(tokens) && tokens[n+1].kind == tokDot && tokens[n+2].kind == tokIdent {
+				item += "." + tokens[n+2].text
+				n += 2
+			}
+			list.items = append(list.items, item)
+		}
+	}
+	return nil
+}
+
+// contains reports whether the list holds ref, such as pkgs.firefox
+func (l *packageList) contains(ref string) bool {
+	if slices.Contains(l.items, ref) {
+		return true
+	}
+	bare, isPkgs := strings.CutPrefix(ref, "pkgs.")
+	return l.withPkgs && isPkgs && slices.Contains(l.items, bare)
+}
+
+// PackageListOption returns the first of PackageListOptions the file sets, empty when it sets none
+func (c *Config) PackageListOption() string {
+	doc := parse(c.content)
+	for _, option := range PackageListOptions {
+		if doc.findBinding(strings.Split(option, ".")...) != nil {
+			return option
+		}
+	}
+	return ""
+}
+
+// InPackageList reports whether the list bound at option holds ref
+func (c *Config) InPackageList(option string, ref string) bool {
+	doc := parse(c.content)
+	b := doc.findBinding(strings.Split(option, ".")...)
+	if b == nil {
+		return false
+	}
+	list := doc.packageList(b)
+	return list != nil && list.contains(ref)
+}
+
+// AddToPackageList appends ref to the list bound at option, creating the option in the
+// module body when the file doesn't set it. Inside `with pkgs;` the pkgs. prefix is left
+// out. It returns false when the list already holds the package.
+func (c *Config) AddToPackageList(option string, ref string) (bool, error) {
+	doc := parse(c.content)
+	b := doc.findBinding(strings.Split(option, ".")...)
+	if b == nil {
+		body := doc.moduleBody()
+		if body == nil {
+			return false, fmt.Errorf("no attribute set found in configuration")
+		}
+		c.insertBinding(body, fmt.Sprintf("%s = [\n%s%s\n];", option, c.indentUnit(), ref))
+		return true, nil
+	}
+
+	list := doc.packageList(b)
+	if list == nil {
+		return false, fmt.Errorf("%s is not a list, add %s to it by hand", option, ref)
+	}
+	if list.contains(ref) {
+		return false, nil
+	}
+	item := ref
+	if bare, isPkgs := strings.CutPrefix(ref, "pkgs."); list.withPkgs && isPkgs {
+		item = bare
+	}
+	c.appendToList(list, item)
+	return true, nil
+}
+
+// appendToList adds item as the last item of list
+func (c *Config) appendToList(list *packageList, item string) {
+	lineStart := strings.LastIndex(c.content[:list.close], "\n") + 1
+	if lineStart > list.open && strings.TrimSpace(c.content[lineStart:list.close]) == "" {
+		// The closing bracket sits on its own line, so add the item just above it, at the
+		// indentation of the last item when it starts a line
+		indent := c.content[lineStart:list.close] + c.indentUnit()
+		inside := strings.TrimRight(c.content[list.open+1:lineStart], " \t\n")
+		if lastLine := strings.LastIndex(inside, "\n") + 1; lastLine > 0 {
+			line := inside[lastLine:]
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+		c.content = c.content[:lineStart] + indent + item + "\n" + c.content[lineStart:]
+		return
+	}
+	before := strings.TrimRight(c.content[:list.close], " \t")
+	c.content = before + " " + item + " " + c.content[list.close:]
+}
+
+// EnableProgram sets `programs.<name>.enable = true;`, turning on a disabled binding or
+// adding one to the programs set or the module body. It reports whether the file changed.
+func (c *Config) EnableProgram(name string) (bool, error) {
+	doc := parse(c.content)
+	if b := doc.findBinding("programs", name, "enable"); b != nil {
+		if strings.TrimSpace(c.content[b.valueStart:b.valueEnd]) == "true" {
+			return false, nil
+		}
+		c.content = c.content[:b.valueStart] + "true" + c.content[b.valueEnd:]
+		return true, nil
+	}
+	switch set, programs := doc.findSet("programs", name), doc.findSet("programs"); {
+	case set != nil:
+		c.insertBinding(set, "enable = true;")
+	case programs != nil:
+		c.insertBinding(programs, attrPath([]string{name, "enable"})+" = true;")
+	default:
+		body := doc.moduleBody()
+		if body == nil {
+			return false, fmt.Errorf("no attribute set found in configuration")
+		}
+		c.insertBinding(body, attrPath([]string{"programs", name, "enable"})+" = true;")
+	}
+	return true, nil
+}
+
+// attrPath joins attribute names into a path, quoting the names that aren't identifiers
+func attrPath(path []string) string {
+	parts := make([]string, len(path))
+	for i, part := range path {
+		parts[i] = part
+		ident := part != "" && isIdentStart(part[0])
+		for n := 1; ident && n < len(part); n++ {
+			ident = isIdentChar(part[n])
+		}
+		if !ident {
+			parts[i] = strconv.Quote(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// SetOption sets the option at path to the nix expression value, replacing the value of
+// a binding the file already has or adding one to the deepest set of the path it binds,
+// the module body otherwise. It reports whether the file changed.
+func (c *Config) SetOption(path []string, value string) (bool, error) {
+	if len(path) == 0 {
+		return false, fmt.Errorf("empty option path")
+	}
+	doc := parse(c.content)
+	if b := doc.findBinding(path...); b != nil {
+		if strings.TrimSpace(c.content[b.valueStart:b.valueEnd]) == value {
+			return false, nil
+		}
+		c.content = c.content[:b.valueStart] + value + c.content[b.valueEnd:]
+		return true, nil
+	}
+	for n := len(path) - 1; n > 0; n-- {
+		if set := doc.findSet(path[:n]...); set != nil {
+			c.insertBinding(set, fmt.Sprintf("%s = %s;", attrPath(path[n:]), value))
+			return true, nil
+		}
+	}
+	body := doc.moduleBody()
+	if body == nil {
+		return false, fmt.Errorf("no attribute set found in configuration")
+	}
+	c.insertBinding(body, fmt.Sprintf("%s = %s;", attrPath(path), value))
+	return true, nil
+}
+
+// stringValue returns the last string literal in the value of b, so that wrapped values
+// like `lib.mkDefault "x86_64-linux"` are read too
+func (d *document) stringValue(b *binding) string {
+	value := ""
+	for _, tok := range tokenize(d.src[b.valueStart:b.valueEnd]) {
+		if tok.kind == tokString {
+			value = unquote(tok)
+		}
+	}
+	return value
+}
+
+// hostPlatformOptions are the options a NixOS or nix-darwin configuration sets its system with
+var hostPlatformOptions = [][]string{
+	{"nixpkgs", "hostPlatform", "system"},
+	{"nixpkgs", "hostPlatform"},
+	{"nixpkgs", "system"},
+}
+
+// HostPlatform returns the system a configuration sets with nixpkgs.hostPlatform or
+// nixpkgs.system, empty when it sets neither
+func (c *Config) HostPlatform() string {
+	doc := parse(c.content)
+	for _, option := range hostPlatformOptions {
+		if b := doc.findBinding(option...); b != nil && b.set == nil {
+			if value := doc.stringValue(b); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// SystemOf finds the nixosSystem or darwinSystem call building host in a flake. It returns
+// the system the call passes, empty when it passes none, and whether it builds nix-darwin.
+func (c *Config) SystemOf(host string) (system string, darwin bool, found bool) {
+	doc := parse(c.content)
+	for _, b := range doc.bindings {
+		full := b.fullPath()
+		if len(full) < 2 || full[len(full)-1] != host {
+			continue
+		}
+		outputs := full[len(full)-2]
+		if outputs != "nixosConfigurations" && outputs != "darwinConfigurations" {
+			continue
+		}
+		for _, set := range doc.sets {
+			if !systemFunctions[set.function] || set.open < b.valueStart || set.close > b.valueEnd {
+				continue
+			}
+			for _, arg := range set.bindings {
+				if len(arg.path) == 1 && arg.path[0] == "system" {
+					system = doc.stringValue(arg)
+				}
+			}
+			return system, set.function == "darwinSystem", true
+		}
+		return "", outputs == "darwinConfigurations", true
+	}
+	return "", false, false
+}
+
+// systemOutputs names the flake output and builder function of each kind of system
+var systemOutputs = map[bool]struct{ outputs, function, fallback string }{
+	false: {"nixosConfigurations", "nixosSystem", "nixpkgs.lib.nixosSystem"},
+	true:  {"darwinConfigurations", "darwinSystem", "nix-darwin.lib.darwinSystem"},
+}
+
+// systemCall returns the first call to function bound as a whole value, e.g.
+// `laptop = nixpkgs.lib.nixosSystem { ... };`, with the expression naming the function
+func (d *document) systemCall(function string) (call *attrSet, callee string) {
+	for _, set := range d.sets {
+		if set.function != function {
+			continue
+		}
+		for _, b := range d.bindings {
+			if b.valueStart > set.open || set.close >= b.valueEnd {
+				continue
+			}
+			callee = strings.TrimSpace(d.src[b.valueStart:set.open])
+			if !strings.ContainsAny(callee, " \t\n({") {
+				return set, callee
+			}
+		}
+	}
+	return nil, ""
+}
+
+// source returns the text of b with its continuation lines dedented to its first line
+func (d *document) source(b *binding) string {
+	lineStart := strings.LastIndex(d.src[:b.start], "\n") + 1
+	indent := d.src[lineStart:b.start]
+	return strings.ReplaceAll(d.src[b.start:b.end], "\n"+indent, "\n")
+}
+
+// AddSystem adds host to the nixosConfigurations of the flake, or the darwinConfigurations
+// when darwin is set, building it from modules. The call and its specialArgs are copied
+// from an existing host of the same kind. It fails when the host exists already or the
+// flake defines no hosts to place it next to.
+func (c *Config) AddSystem(host string, darwin bool, modules []string) error {
+	if _, _, found := c.SystemOf(host); found {
+		return fmt.Errorf("%s is already defined in the flake", host)
+	}
+	kind := systemOutputs[darwin]
+	doc := parse(c.content)
+
+	callee := kind.fallback
+	var body []string
+	if call, existing := doc.systemCall(kind.function); call != nil {
+		callee = existing
+		for _, b := range call.bindings {
+			if len(b.path) == 1 && b.path[0] == "specialArgs" {
+				body = append(body, doc.source(b))
+			}
+		}
+	}
+	body = append(body, "modules = [\n"+indentLines(strings.Join(modules, "\n"), c.indentUnit())+"\n];")
+	value := fmt.Sprintf("%s {\n%s\n};", callee, indentLines(strings.Join(body, "\n"), c.indentUnit()))
+	name := strconv.Quote(host)
+
+	// A `nixosConfigurations = { ... };` set takes the host as another binding
+	for _, b := range doc.bindings {
+		if b.set != nil && b.path[len(b.path)-1] == kind.outputs {
+			c.insertBinding(b.set, name+" = "+value)
+			return nil
+		}
+	}
+	// Otherwise it goes next to the hosts defined like `nixosConfigurations.laptop = ...;`
+	for _, b := range doc.bindings {
+		for i, attr := range b.path {
+			if attr == systemOutputs[false].outputs || attr == systemOutputs[true].outputs {
+				path := append(slices.Clone(b.path[:i]), kind.outputs, name)
+				c.insertBinding(b.parent, strings.Join(path, ".")+" = "+value)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no %s or %s found in the flake, add %s by hand", systemOutputs[false].outputs, systemOutputs[true].outputs, host)
+}
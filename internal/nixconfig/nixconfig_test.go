@@ -1,8 +1,10 @@
 package nixconfig
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -177,6 +179,20 @@ func TestConfig_EnablePackage(t *testing.T) {
 			want:        true,
 			wantContent: "firefox.enable = true;",
 		},
+		{
+			name:        "enable quoted package name",
+			content:     `"1password".enable  =  false;`,
+			packageName: "1password",
+			want:        true,
+			wantContent: `"1password".enable = true;`,
+		},
+		{
+			name:        "enable package in a quoted set",
+			content:     "\"7zz\" = { enable = false; };",
+			packageName: "7zz",
+			want:        true,
+			wantContent: "\"7zz\" = { enable = true; };",
+		},
 		{
 			name:        "package already enabled",
 			content:     "firefox.enable = true;",
@@ -208,6 +224,128 @@ func TestConfig_EnablePackage(t *testing.T) {
 	}
 }
 
+func TestConfig_DisablePackage(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		category    string
+		packageName string
+		want        bool
+		wantContent string
+	}{
+		{
+			name:        "disable enabled package",
+			content:     "apps = {\n  browsers = {\n    firefox.enable = true;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        true,
+			wantContent: "apps = {\n  browsers = {\n    firefox.enable = false;\n  };\n}",
+		},
+		{
+			name:        "disable quoted package name",
+			content:     "apps = {\n  security = {\n    \"1password\".enable = true;\n  };\n}",
+			category:    "security",
+			packageName: "1password",
+			want:        true,
+			wantContent: "apps = {\n  security = {\n    \"1password\".enable = false;\n  };\n}",
+		},
+		{
+			name:        "already disabled",
+			content:     "apps = {\n  browsers = {\n    firefox.enable = false;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        false,
+			wantContent: "apps = {\n  browsers = {\n    firefox.enable = false;\n  };\n}",
+		},
+		{
+			name:        "package in different category is kept",
+			content:     "apps = {\n  browsers = {\n  };\n  editors = {\n    firefox.enable = true;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        false,
+			wantContent: "apps = {\n  browsers = {\n  };\n  editors = {\n    firefox.enable = true;\n  };\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewConfig(tt.content)
+			got := editor.DisablePackage(tt.category, tt.packageName)
+			if got != tt.want {
+				t.Errorf("DisablePackage(%q, %q) = %v, want %v", tt.category, tt.packageName, got, tt.want)
+			}
+			if editor.Content() != tt.wantContent {
+				t.Errorf("Content() = %q, want %q", editor.Content(), tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestConfig_RemovePackage(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		category    string
+		packageName string
+		want        bool
+		wantContent string
+	}{
+		{
+			name:        "remove enabled package",
+			content:     "apps = {\n  browsers = {\n    firefox.enable = true;\n    chrome.enable = true;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        true,
+			wantContent: "apps = {\n  browsers = {\n    chrome.enable = true;\n  };\n}",
+		},
+		{
+			name:        "remove disabled package with extra spaces",
+			content:     "apps = {\n  browsers = {\n    firefox.enable  =  false ;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        true,
+			wantContent: "apps = {\n  browsers = {\n  };\n}",
+		},
+		{
+			name:        "package in different category is kept",
+			content:     "apps = {\n  browsers = {\n  };\n  editors = {\n    firefox.enable = true;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        false,
+			wantContent: "apps = {\n  browsers = {\n  };\n  editors = {\n    firefox.enable = true;\n  };\n}",
+		},
+		{
+			name:        "similar package name is kept",
+			content:     "apps = {\n  browsers = {\n    firefox-esr.enable = true;\n  };\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        false,
+			wantContent: "apps = {\n  browsers = {\n    firefox-esr.enable = true;\n  };\n}",
+		},
+		{
+			name:        "category not found",
+			content:     "apps = {\n}",
+			category:    "browsers",
+			packageName: "firefox",
+			want:        false,
+			wantContent: "apps = {\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewConfig(tt.content)
+			got := editor.RemovePackage(tt.category, tt.packageName)
+			if got != tt.want {
+				t.Errorf("RemovePackage(%q, %q) = %v, want %v", tt.category, tt.packageName, got, tt.want)
+			}
+			if editor.Content() != tt.wantContent {
+				t.Errorf("Content() = %q, want %q", editor.Content(), tt.wantContent)
+			}
+		})
+	}
+}
+
 func TestConfig_AddPackageToCategory(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -240,6 +378,17 @@ func TestConfig_AddPackageToCategory(t *testing.T) {
 			wantErr:     false,
 			wantContain: "firefox.enable = true;",
 		},
+		{
+			name: "quote digit-leading package name",
+			content: `apps = {
+  security = {
+  };
+}`,
+			category:    "security",
+			packageName: "1password",
+			wantErr:     false,
+			wantContain: `"1password".enable = true;`,
+		},
 		{
 			name:        "category not found",
 			content:     "apps = {\n}",
@@ -298,6 +447,15 @@ func TestConfig_CreateCategory(t *testing.T) {
 			wantErr:     false,
 			wantContain: []string{"browsers = {", "firefox.enable = true;"},
 		},
+		{
+			name: "quote digit-leading package name",
+			content: `apps = {
+}`,
+			category:    "archives",
+			packageName: "7zz",
+			wantErr:     false,
+			wantContain: []string{"archives = {", `"7zz".enable = true;`},
+		},
 		{
 			name:        "apps section not found",
 			content:     "{ }",
@@ -405,6 +563,140 @@ func TestConfig_AddOrEnablePackage(t *testing.T) {
 	}
 }
 
+func TestConfig_PreservesFormatting(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		edit        func(c *Config) error
+		wantContent string
+	}{
+		{
+			name:    "comment mentioning a category",
+			content: "{\n  # browsers = { };\n  apps = {\n    browsers = {\n      chrome.enable = true; # work\n    };\n  };\n}\n",
+			edit: func(c *Config) error {
+				return c.AddOrEnablePackage("browsers", "firefox")
+			},
+			wantContent: "{\n  # browsers = { };\n  apps = {\n    browsers = {\n      chrome.enable = true; # work\n      firefox.enable = true;\n    };\n  };\n}\n",
+		},
+		{
+			name:    "closing braces inside a string",
+			content: "{\n  shellInit = ''\n    echo \"};\"\n  '';\n  apps = {\n  };\n}\n",
+			edit: func(c *Config) error {
+				return c.AddOrEnablePackage("editors", "vim")
+			},
+			wantContent: "{\n  shellInit = ''\n    echo \"};\"\n  '';\n  apps = {\n    editors = {\n      vim.enable = true;\n    };\n  };\n}\n",
+		},
+		{
+			name:    "empty category on one line",
+			content: "apps = {\n  browsers = { };\n};\n",
+			edit: func(c *Config) error {
+				return c.AddPackageToCategory("browsers", "firefox")
+			},
+			wantContent: "apps = {\n  browsers = {\n    firefox.enable = true;\n  };\n};\n",
+		},
+		{
+			name:    "nested enable attribute",
+			content: "apps = {\n  editors = {\n    vim = { enable = false; };\n  };\n};\n",
+			edit: func(c *Config) error {
+				return c.AddOrEnablePackage("editors", "vim")
+			},
+			wantContent: "apps = {\n  editors = {\n    vim = { enable = true; };\n  };\n};\n",
+		},
+		{
+			name:    "remove takes the trailing comment",
+			content: "apps = {\n  editors = {\n    neovim.enable = true; # main\n    vim.enable = true;\n  };\n};\n",
+			edit: func(c *Config) error {
+				c.RemovePackage("editors", "neovim")
+				return nil
+			},
+			wantContent: "apps = {\n  editors = {\n    vim.enable = true;\n  };\n};\n",
+		},
+		{
+			name:    "apps section added to module body",
+			content: "{ config, ... }:\n{\n  imports = [ ];\n}\n",
+			edit: func(c *Config) error {
+				return c.EnsureAppsSectionExists()
+			},
+			wantContent: "{ config, ... }:\n{\n  imports = [ ];\n  apps = {\n  };\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewConfig(tt.content)
+			if err := tt.edit(editor); err != nil {
+				t.Fatalf("edit error = %v", err)
+			}
+			if editor.Content() != tt.wantContent {
+				t.Errorf("Content() = %q, want %q", editor.Content(), tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestConfig_IndentStyle(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		edit        func(c *Config) error
+		wantContent string
+	}{
+		{
+			name:    "four spaces, new category",
+			content: "{\n    apps = {\n        browsers = {\n            chrome.enable = true;\n        };\n    };\n}\n",
+			edit: func(c *Config) error {
+				return c.AddOrEnablePackage("editors", "vim")
+			},
+			wantContent: "{\n    apps = {\n        browsers = {\n            chrome.enable = true;\n        };\n        editors = {\n            vim.enable = true;\n        };\n    };\n}\n",
+		},
+		{
+			name:    "tabs",
+			content: "{\n\tapps = {\n\t\tbrowsers = {\n\t\t\tchrome.enable = true;\n\t\t};\n\t};\n}\n",
+			edit: func(c *Config) error {
+				return c.AddOrEnablePackage("editors", "vim")
+			},
+			wantContent: "{\n\tapps = {\n\t\tbrowsers = {\n\t\t\tchrome.enable = true;\n\t\t};\n\t\teditors = {\n\t\t\tvim.enable = true;\n\t\t};\n\t};\n}\n",
+		},
+		{
+			name:    "bindings deeper than the brace",
+			content: "apps = {\n  browsers = {\n        chrome.enable = true;\n  };\n};\n",
+			edit: func(c *Config) error {
+				return c.AddPackageToCategory("browsers", "firefox")
+			},
+			wantContent: "apps = {\n  browsers = {\n        chrome.enable = true;\n        firefox.enable = true;\n  };\n};\n",
+		},
+		{
+			name:    "empty set in a four space file",
+			content: "{\n    imports = [ ];\n    apps = {\n    };\n}\n",
+			edit: func(c *Config) error {
+				return c.CreateCategory("editors", "vim")
+			},
+			wantContent: "{\n    imports = [ ];\n    apps = {\n        editors = {\n            vim.enable = true;\n        };\n    };\n}\n",
+		},
+		{
+			name:    "list items",
+			content: "{ pkgs, ... }:\n{\n    environment.systemPackages = with pkgs; [\n            git\n    ];\n}\n",
+			edit: func(c *Config) error {
+				_, err := c.AddToPackageList("environment.systemPackages", "pkgs.ripgrep")
+				return err
+			},
+			wantContent: "{ pkgs, ... }:\n{\n    environment.systemPackages = with pkgs; [\n            git\n            ripgrep\n    ];\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewConfig(tt.content)
+			if err := tt.edit(editor); err != nil {
+				t.Fatalf("edit error = %v", err)
+			}
+			if editor.Content() != tt.wantContent {
+				t.Errorf("Content() = %q, want %q", editor.Content(), tt.wantContent)
+			}
+		})
+	}
+}
+
 func TestConfig_WithRealConfigFile(t *testing.T) {
 	// Test with actual sample config file
 	testdataPath := filepath.Join("..", "..", "testdata", "sample_config.nix")
@@ -461,3 +753,808 @@ func TestConfig_WithWhitespaceVariations(t *testing.T) {
 		t.Error("Failed to find browsers with extra spaces")
 	}
 }
+
+func TestConfig_AddSpecialArg(t *testing.T) {
+	isLinux := func(darwin bool) string {
+		if darwin {
+			return "false"
+		}
+		return "true"
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantChanged int
+		wantErr     bool
+	}{
+		{
+			name: "adds to existing specialArgs",
+			content: `{
+  outputs = { nixpkgs, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      specialArgs = {
+        inherit inputs;
+      };
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}`,
+			want: `{
+  outputs = { nixpkgs, ... }@inputs: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      specialArgs = {
+        inherit inputs;
+        isLinux = true;
+      };
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}`,
+			wantChanged: 1,
+		},
+		{
+			name: "creates specialArgs for every system",
+			content: `{
+  outputs = { nixpkgs, nix-darwin, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+    darwinConfigurations.mac = nix-darwin.lib.darwinSystem {
+      modules = [ ./hosts/mac/configuration.nix ];
+    };
+  };
+}`,
+			want: `{
+  outputs = { nixpkgs, nix-darwin, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+      specialArgs = {
+        isLinux = true;
+      };
+    };
+    darwinConfigurations.mac = nix-darwin.lib.darwinSystem {
+      modules = [ ./hosts/mac/configuration.nix ];
+      specialArgs = {
+        isLinux = false;
+      };
+    };
+  };
+}`,
+			wantChanged: 2,
+		},
+		{
+			name:        "already inherited",
+			content:     `{ nixosConfigurations.a = lib.nixosSystem { specialArgs = { inherit inputs isLinux; }; }; }`,
+			want:        `{ nixosConfigurations.a = lib.nixosSystem { specialArgs = { inherit inputs isLinux; }; }; }`,
+			wantChanged: 0,
+		},
+		{
+			name:        "set with _module.args",
+			content:     `{ nixosConfigurations.a = lib.nixosSystem { modules = [ { _module.args.isLinux = true; } ]; }; }`,
+			want:        `{ nixosConfigurations.a = lib.nixosSystem { modules = [ { _module.args.isLinux = true; } ]; }; }`,
+			wantChanged: 0,
+		},
+		{
+			name:    "specialArgs is not a set",
+			content: `{ nixosConfigurations.a = lib.nixosSystem { specialArgs = inputs // { }; }; }`,
+			want:    `{ nixosConfigurations.a = lib.nixosSystem { specialArgs = inputs // { }; }; }`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			changed, err := cfg.AddSpecialArg("isLinux", isLinux)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddSpecialArg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("AddSpecialArg() changed = %d, want %d", changed, tt.wantChanged)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("AddSpecialArg() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_AddToPackageList(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		option    string
+		ref       string
+		want      string
+		wantAdded bool
+		wantErr   bool
+	}{
+		{
+			name: "multi-line list",
+			content: `{ pkgs, ... }: {
+  environment.systemPackages = [
+    pkgs.git
+  ];
+}`,
+			option: "environment.systemPackages",
+			ref:    "pkgs.firefox",
+			want: `{ pkgs, ... }: {
+  environment.systemPackages = [
+    pkgs.git
+    pkgs.firefox
+  ];
+}`,
+			wantAdded: true,
+		},
+		{
+			name:      "with pkgs leaves out the prefix",
+			content:   "{ pkgs, ... }: {\n  environment.systemPackages = with pkgs; [ git ];\n}",
+			option:    "environment.systemPackages",
+			ref:       "pkgs.firefox",
+			want:      "{ pkgs, ... }: {\n  environment.systemPackages = with pkgs; [ git firefox ];\n}",
+			wantAdded: true,
+		},
+		{
+			name:      "empty list",
+			content:   "{ pkgs, ... }: {\n  home.packages = [ ];\n}",
+			option:    "home.packages",
+			ref:       "pkgs.python3Packages.numpy",
+			want:      "{ pkgs, ... }: {\n  home.packages = [ pkgs.python3Packages.numpy ];\n}",
+			wantAdded: true,
+		},
+		{
+			name:    "already listed",
+			content: "{ pkgs, ... }: {\n  environment.systemPackages = [ pkgs.firefox ];\n}",
+			option:  "environment.systemPackages",
+			ref:     "pkgs.firefox",
+			want:    "{ pkgs, ... }: {\n  environment.systemPackages = [ pkgs.firefox ];\n}",
+		},
+		{
+			name:    "already listed inside with pkgs",
+			content: "{ pkgs, ... }: {\n  environment.systemPackages = with pkgs; [\n    firefox\n  ];\n}",
+			option:  "environment.systemPackages",
+			ref:     "pkgs.firefox",
+			want:    "{ pkgs, ... }: {\n  environment.systemPackages = with pkgs; [\n    firefox\n  ];\n}",
+		},
+		{
+			name:      "override is not a match",
+			content:   "{ pkgs, ... }: {\n  environment.systemPackages = [ (pkgs.firefox.override { }) ];\n}",
+			option:    "environment.systemPackages",
+			ref:       "pkgs.firefox",
+			want:      "{ pkgs, ... }: {\n  environment.systemPackages = [ (pkgs.firefox.override { }) pkgs.firefox ];\n}",
+			wantAdded: true,
+		},
+		{
+			name:      "creates the option",
+			content:   "{ pkgs, ... }: {\n  networking.hostName = \"laptop\";\n}",
+			option:    "environment.systemPackages",
+			ref:       "pkgs.firefox",
+			want:      "{ pkgs, ... }: {\n  networking.hostName = \"laptop\";\n  environment.systemPackages = [\n    pkgs.firefox\n  ];\n}",
+			wantAdded: true,
+		},
+		{
+			name:    "not a list",
+			content: "{ pkgs, ... }: {\n  environment.systemPackages = import ./packages.nix pkgs;\n}",
+			option:  "environment.systemPackages",
+			ref:     "pkgs.firefox",
+			want:    "{ pkgs, ... }: {\n  environment.systemPackages = import ./packages.nix pkgs;\n}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			added, err := cfg.AddToPackageList(tt.option, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddToPackageList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("AddToPackageList() added = %v, want %v", added, tt.wantAdded)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("AddToPackageList() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+			if !tt.wantErr && !cfg.InPackageList(tt.option, tt.ref) {
+				t.Errorf("InPackageList() = false after adding %s", tt.ref)
+			}
+		})
+	}
+}
+
+func TestConfig_PackageListOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"system packages", "{ environment.systemPackages = [ ]; }", "environment.systemPackages"},
+		{"home manager", "{ home.packages = with pkgs; [ ]; }", "home.packages"},
+		{"nested sets", "{ environment = { systemPackages = [ ]; }; }", "environment.systemPackages"},
+		{"neither", "{ apps = { }; }", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewConfig(tt.content).PackageListOption(); got != tt.want {
+				t.Errorf("PackageListOption() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_HostPlatform(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"host platform", `{ nixpkgs.hostPlatform = "x86_64-linux"; }`, "x86_64-linux"},
+		{"mkDefault", `{ lib, ... }: { nixpkgs.hostPlatform = lib.mkDefault "aarch64-linux"; }`, "aarch64-linux"},
+		{"platform set", `{ nixpkgs.hostPlatform = { system = "aarch64-darwin"; }; }`, "aarch64-darwin"},
+		{"legacy system", `{ nixpkgs = { system = "x86_64-darwin"; }; }`, "x86_64-darwin"},
+		{"not set", `{ networking.hostName = "laptop"; }`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewConfig(tt.content).HostPlatform(); got != tt.want {
+				t.Errorf("HostPlatform() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_SystemOf(t *testing.T) {
+	flake := `{
+  outputs = { nixpkgs, nix-darwin, ... }: {
+    nixosConfigurations = {
+      laptop = nixpkgs.lib.nixosSystem {
+        system = "x86_64-linux";
+        modules = [ ./hosts/laptop/configuration.nix ];
+      };
+      server = nixpkgs.lib.nixosSystem {
+        modules = [ ./hosts/server/configuration.nix ];
+      };
+    };
+    darwinConfigurations."macbook" = nix-darwin.lib.darwinSystem {
+      system = "aarch64-darwin";
+    };
+    darwinConfigurations.imac = mkDarwin "imac";
+  };
+}`
+
+	tests := []struct {
+		host       string
+		wantSystem string
+		wantDarwin bool
+		wantFound  bool
+	}{
+		{host: "laptop", wantSystem: "x86_64-linux", wantFound: true},
+		{host: "server", wantFound: true},
+		{host: "macbook", wantSystem: "aarch64-darwin", wantDarwin: true, wantFound: true},
+		{host: "imac", wantDarwin: true, wantFound: true},
+		{host: "desktop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			system, darwin, found := NewConfig(flake).SystemOf(tt.host)
+			if system != tt.wantSystem || darwin != tt.wantDarwin || found != tt.wantFound {
+				t.Errorf("SystemOf(%q) = %q, %v, %v, want %q, %v, %v", tt.host, system, darwin, found, tt.wantSystem, tt.wantDarwin, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestConfig_EnsureCategory(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		category  string
+		want      string
+		wantAdded bool
+	}{
+		{
+			name:      "added to apps",
+			content:   "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n  };\n}\n",
+			category:  "editors",
+			want:      "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n    editors = { };\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:      "apps section created",
+			content:   "{ config, ... }:\n{\n  networking.hostName = \"laptop\";\n}\n",
+			category:  "editors",
+			want:      "{ config, ... }:\n{\n  networking.hostName = \"laptop\";\n  apps = {\n    editors = { };\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:     "already there",
+			content:  "{\n  apps = {\n    editors = { };\n  };\n}\n",
+			category: "editors",
+			want:     "{\n  apps = {\n    editors = { };\n  };\n}\n",
+		},
+		{
+			name:      "nested category",
+			content:   "{\n  apps = { };\n}\n",
+			category:  "dev/editors",
+			want:      "{\n  apps = {\n    dev = {\n      editors = { };\n    };\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:      "nested category in its parent",
+			content:   "{\n  apps = {\n    dev = {\n      git.enable = true;\n    };\n  };\n}\n",
+			category:  "dev/editors",
+			want:      "{\n  apps = {\n    dev = {\n      git.enable = true;\n      editors = { };\n    };\n  };\n}\n",
+			wantAdded: true,
+		},
+		{
+			name:     "nested category already there",
+			content:  "{\n  apps = {\n    dev.editors = { };\n  };\n}\n",
+			category: "dev/editors",
+			want:     "{\n  apps = {\n    dev.editors = { };\n  };\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			added, err := cfg.EnsureCategory(tt.category)
+			if err != nil {
+				t.Fatalf("EnsureCategory() error = %v", err)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("EnsureCategory() = %v, want %v", added, tt.wantAdded)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("EnsureCategory() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_RenameCategory(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "nested set",
+			content:   "{\n  apps = {\n    browsers = {\n      firefox.enable = true; # main\n    };\n  };\n}\n",
+			want:      "{\n  apps = {\n    web = {\n      firefox.enable = true; # main\n    };\n  };\n}\n",
+			wantFound: true,
+		},
+		{
+			name:      "flattened paths",
+			content:   "{\n  apps.browsers.firefox.enable = true;\n  apps.browsers.chromium.enable = false;\n}\n",
+			want:      "{\n  apps.web.firefox.enable = true;\n  apps.web.chromium.enable = false;\n}\n",
+			wantFound: true,
+		},
+		{
+			name:      "package named like the category is kept",
+			content:   "{\n  apps = {\n    tools.browsers.enable = true;\n    browsers.firefox.enable = true;\n  };\n}\n",
+			want:      "{\n  apps = {\n    tools.browsers.enable = true;\n    web.firefox.enable = true;\n  };\n}\n",
+			wantFound: true,
+		},
+		{
+			name:    "missing category",
+			content: "{\n  apps = {\n    editors.vim.enable = true;\n  };\n}\n",
+			want:    "{\n  apps = {\n    editors.vim.enable = true;\n  };\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			found, err := cfg.RenameCategory("browsers", "web")
+			if err != nil || found != tt.wantFound {
+				t.Errorf("RenameCategory() = %v, %v, want %v", found, err, tt.wantFound)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("RenameCategory() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_RemoveCategory(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "whole set",
+			content:   "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n    editors.vim.enable = true;\n  };\n}\n",
+			want:      "{\n  apps = {\n    editors.vim.enable = true;\n  };\n}\n",
+			wantFound: true,
+		},
+		{
+			name:      "flattened paths",
+			content:   "{\n  apps.browsers.firefox.enable = true;\n  apps.editors.vim.enable = true;\n}\n",
+			want:      "{\n  apps.editors.vim.enable = true;\n}\n",
+			wantFound: true,
+		},
+		{
+			name:    "missing category",
+			content: "{\n  apps = { };\n}\n",
+			want:    "{\n  apps = { };\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			if found := cfg.RemoveCategory("browsers"); found != tt.wantFound {
+				t.Errorf("RemoveCategory() = %v, want %v", found, tt.wantFound)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("RemoveCategory() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_NestedCategory(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "created with its parents",
+			content: "{\n  apps = {\n    browsers.firefox.enable = true;\n  };\n}\n",
+			want:    "{\n  apps = {\n    browsers.firefox.enable = true;\n    dev = {\n      editors = {\n        helix.enable = true;\n      };\n    };\n  };\n}\n",
+		},
+		{
+			name:    "created in the parent",
+			content: "{\n  apps = {\n    dev = {\n      git.enable = true;\n    };\n  };\n}\n",
+			want:    "{\n  apps = {\n    dev = {\n      git.enable = true;\n      editors = {\n        helix.enable = true;\n      };\n    };\n  };\n}\n",
+		},
+		{
+			name:    "added to the nested set",
+			content: "{\n  apps = {\n    dev = {\n      editors = {\n        vim.enable = true;\n      };\n    };\n  };\n}\n",
+			want:    "{\n  apps = {\n    dev = {\n      editors = {\n        vim.enable = true;\n        helix.enable = true;\n      };\n    };\n  };\n}\n",
+		},
+		{
+			name:    "added to a dotted path",
+			content: "{\n  apps = {\n    dev.editors = {\n      vim.enable = true;\n    };\n  };\n}\n",
+			want:    "{\n  apps = {\n    dev.editors = {\n      vim.enable = true;\n      helix.enable = true;\n    };\n  };\n}\n",
+		},
+		{
+			name:    "enabled again",
+			content: "{\n  apps = {\n    dev.editors = {\n      helix.enable = false;\n    };\n  };\n}\n",
+			want:    "{\n  apps = {\n    dev.editors = {\n      helix.enable = true;\n    };\n  };\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			if err := cfg.AddOrEnablePackage("dev/editors", "helix"); err != nil {
+				t.Fatalf("AddOrEnablePackage() error = %v", err)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("AddOrEnablePackage() content =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+			if enabled, found := cfg.PackageEnabled("dev/editors", "helix"); !enabled || !found {
+				t.Errorf("PackageEnabled() = %v, %v, want true, true", enabled, found)
+			}
+			if entries := cfg.AppEntries(); !slices.Contains(entries, AppEntry{Category: "dev/editors", Name: "helix", Enabled: true}) {
+				t.Errorf("AppEntries() = %v, missing dev/editors helix", entries)
+			}
+		})
+	}
+
+	cfg := NewConfig("{\n  apps = {\n    dev = {\n      git.enable = true;\n      editors = {\n        helix.enable = true;\n      };\n    };\n  };\n}\n")
+	if !cfg.DisablePackage("dev/editors", "helix") || !strings.Contains(cfg.Content(), "helix.enable = false;") {
+		t.Errorf("DisablePackage() content =\n%s", cfg.Content())
+	}
+	if found, err := cfg.RenameCategory("dev/editors", "dev/ides"); !found || err != nil || !strings.Contains(cfg.Content(), "      ides = {\n") {
+		t.Errorf("RenameCategory() = %v, %v, content =\n%s", found, err, cfg.Content())
+	}
+	before := cfg.Content()
+	if _, err := cfg.RenameCategory("dev/ides", "tools/ides"); !errors.Is(err, ErrCategoryParent) || cfg.Content() != before {
+		t.Errorf("RenameCategory() to another parent error = %v, want %v without changes", err, ErrCategoryParent)
+	}
+	if !cfg.RemoveCategory("dev/ides") {
+		t.Error("RemoveCategory() did not find dev/ides")
+	}
+	if want := "{\n  apps = {\n    dev = {\n      git.enable = true;\n    };\n  };\n}\n"; cfg.Content() != want {
+		t.Errorf("RemoveCategory() content =\n%s\nwant\n%s", cfg.Content(), want)
+	}
+}
+
+func TestConfig_AddSystem(t *testing.T) {
+	modules := []string{"./hosts/work/configuration.nix", "./modules/apps"}
+
+	tests := []struct {
+		name    string
+		content string
+		darwin  bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "next to a flattened host",
+			content: `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations."laptop" = nixpkgs.lib.nixosSystem {
+      specialArgs = {
+        inherit mkApp;
+        isLinux = true;
+      };
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}
+`,
+			want: `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations."laptop" = nixpkgs.lib.nixosSystem {
+      specialArgs = {
+        inherit mkApp;
+        isLinux = true;
+      };
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+    nixosConfigurations."work" = nixpkgs.lib.nixosSystem {
+      specialArgs = {
+        inherit mkApp;
+        isLinux = true;
+      };
+      modules = [
+        ./hosts/work/configuration.nix
+        ./modules/apps
+      ];
+    };
+  };
+}
+`,
+		},
+		{
+			name: "into the hosts set",
+			content: `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations = {
+      laptop = inputs.nixpkgs.lib.nixosSystem { modules = [ ]; };
+    };
+  };
+}
+`,
+			want: `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations = {
+      laptop = inputs.nixpkgs.lib.nixosSystem { modules = [ ]; };
+      "work" = inputs.nixpkgs.lib.nixosSystem {
+        modules = [
+          ./hosts/work/configuration.nix
+          ./modules/apps
+        ];
+      };
+    };
+  };
+}
+`,
+		},
+		{
+			name:    "first darwin host",
+			content: "{\n  outputs = { nixpkgs, ... }: {\n    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem { };\n  };\n}\n",
+			darwin:  true,
+			want:    "{\n  outputs = { nixpkgs, ... }: {\n    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem { };\n    darwinConfigurations.\"work\" = nix-darwin.lib.darwinSystem {\n      modules = [\n        ./hosts/work/configuration.nix\n        ./modules/apps\n      ];\n    };\n  };\n}\n",
+		},
+		{
+			name:    "host exists",
+			content: "{ outputs = _: { nixosConfigurations.work = nixpkgs.lib.nixosSystem { }; }; }",
+			wantErr: true,
+		},
+		{
+			name:    "no hosts",
+			content: "{ outputs = _: { packages = { }; }; }",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			err := cfg.AddSystem("work", tt.darwin, modules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddSystem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Content() != tt.want {
+				t.Errorf("AddSystem() =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_EnableProgram(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantChanged bool
+	}{
+		{
+			name:        "added to the module body",
+			content:     "{ pkgs, ... }:\n\n{\n  networking.hostName = \"laptop\";\n}\n",
+			want:        "{ pkgs, ... }:\n\n{\n  networking.hostName = \"laptop\";\n  programs.git.enable = true;\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:        "added to the programs set",
+			content:     "{\n  programs = {\n    zsh.enable = true;\n  };\n}\n",
+			want:        "{\n  programs = {\n    zsh.enable = true;\n    git.enable = true;\n  };\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:        "added to the program set",
+			content:     "{\n  programs.git = {\n    lfs.enable = true;\n  };\n}\n",
+			want:        "{\n  programs.git = {\n    lfs.enable = true;\n    enable = true;\n  };\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:        "disabled program",
+			content:     "{\n  programs.git.enable = false;\n}\n",
+			want:        "{\n  programs.git.enable = true;\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:    "already enabled",
+			content: "{\n  programs.git.enable = true;\n}\n",
+			want:    "{\n  programs.git.enable = true;\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			changed, err := cfg.EnableProgram("git")
+			if err != nil {
+				t.Fatalf("EnableProgram() error = %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("EnableProgram() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("EnableProgram() =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_SetOption(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		path        []string
+		value       string
+		want        string
+		wantChanged bool
+	}{
+		{
+			name:        "added to the module body",
+			content:     "{ pkgs, ... }:\n\n{\n  networking.hostName = \"laptop\";\n}\n",
+			path:        []string{"services", "openssh", "enable"},
+			value:       "true",
+			want:        "{ pkgs, ... }:\n\n{\n  networking.hostName = \"laptop\";\n  services.openssh.enable = true;\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:        "added to the deepest set",
+			content:     "{\n  services = {\n    openssh = {\n      enable = true;\n    };\n  };\n}\n",
+			path:        []string{"services", "openssh", "ports"},
+			value:       "[ 2222 ]",
+			want:        "{\n  services = {\n    openssh = {\n      enable = true;\n      ports = [ 2222 ];\n    };\n  };\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:        "existing value replaced",
+			content:     "{\n  time.timeZone = \"UTC\";\n}\n",
+			path:        []string{"time", "timeZone"},
+			value:       `"Europe/Oslo"`,
+			want:        "{\n  time.timeZone = \"Europe/Oslo\";\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:        "names that aren't identifiers are quoted",
+			content:     "{\n  boot.kernel.sysctl = {\n    \"vm.swappiness\" = 10;\n  };\n}\n",
+			path:        []string{"boot", "kernel", "sysctl", "net.ipv4.ip_forward"},
+			value:       "1",
+			want:        "{\n  boot.kernel.sysctl = {\n    \"vm.swappiness\" = 10;\n    \"net.ipv4.ip_forward\" = 1;\n  };\n}\n",
+			wantChanged: true,
+		},
+		{
+			name:    "already set",
+			content: "{\n  programs.git.enable = true;\n}\n",
+			path:    []string{"programs", "git", "enable"},
+			value:   "true",
+			want:    "{\n  programs.git.enable = true;\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(tt.content)
+			changed, err := cfg.SetOption(tt.path, tt.value)
+			if err != nil {
+				t.Fatalf("SetOption() error = %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("SetOption() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if cfg.Content() != tt.want {
+				t.Errorf("SetOption() =\n%s\nwant\n%s", cfg.Content(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_AppEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []AppEntry
+	}{
+		{
+			name:    "nested sets",
+			content: "{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n      chromium.enable = false;\n    };\n    gaming.utils.mangohud.enable = true;\n  };\n}\n",
+			want: []AppEntry{
+				{Category: "browsers", Name: "firefox", Enabled: true},
+				{Category: "browsers", Name: "chromium"},
+				{Category: "gaming/utils", Name: "mangohud", Enabled: true},
+			},
+		},
+		{
+			name:    "flattened bindings",
+			content: "{\n  apps.editors.vim.enable = true;\n  programs.git.enable = true;\n}\n",
+			want:    []AppEntry{{Category: "editors", Name: "vim", Enabled: true}},
+		},
+		{
+			name:    "no apps section",
+			content: "{\n  programs.git.enable = true;\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewConfig(tt.content).AppEntries()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("AppEntries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Namespace(t *testing.T) {
+	c := NewConfig("{ config, ... }:\n\n{\n  networking.hostName = \"laptop\";\n}\n")
+	c.SetNamespace("myflake.apps")
+	if err := c.AddOrEnablePackage("browsers", "firefox"); err == nil {
+		t.Error("AddOrEnablePackage() should fail without the apps section")
+	}
+	if err := c.EnsureAppsSectionExists(); err != nil {
+		t.Fatalf("EnsureAppsSectionExists() error = %v", err)
+	}
+	if err := c.AddOrEnablePackage("browsers", "firefox"); err != nil {
+		t.Fatalf("AddOrEnablePackage() error = %v", err)
+	}
+	want := "{ config, ... }:\n\n{\n  networking.hostName = \"laptop\";\n  myflake.apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n  };\n}\n"
+	if c.Content() != want {
+		t.Errorf("content = %q, want %q", c.Content(), want)
+	}
+	if enabled, found := c.PackageEnabled("browsers", "firefox"); !enabled || !found {
+		t.Errorf("PackageEnabled() = %v, %v", enabled, found)
+	}
+	if got, want := c.AppEntries(), []AppEntry{{Category: "browsers", Name: "firefox", Enabled: true}}; !slices.Equal(got, want) {
+		t.Errorf("AppEntries() = %+v, want %+v", got, want)
+	}
+
+	flattened := NewConfig("{\n  myflake.apps.editors.vim.enable = true;\n  apps.editors.emacs.enable = true;\n}\n")
+	flattened.SetNamespace("myflake.apps")
+	if got, want := flattened.AppEntries(), []AppEntry{{Category: "editors", Name: "vim", Enabled: true}}; !slices.Equal(got, want) {
+		t.Errorf("AppEntries() of flattened bindings = %+v, want %+v", got, want)
+	}
+}
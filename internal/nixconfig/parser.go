@@ -0,0 +1,246 @@
+package nixconfig
+
+import "strings"
+
+// attrSet is a { ... } literal in the source. The parser is tolerant of fragments:
+// an unterminated set runs to the end of the file.
+type attrSet struct {
+	open     int // offset of '{'
+	close    int // offset of '}', len(src) when unterminated
+	owner    *binding
+	parent   *attrSet
+	bindings []*binding
+	// function is the identifier the set is passed to, e.g. nixosSystem in `lib.nixosSystem { ... }`
+	function string
+}
+
+// binding is an `attr.path = value;` entry of an attribute set
+type binding struct {
+	path       []string
+	start      int // offset of the first attribute name
+	pathEnd    int // offset just past the last attribute name, quotes included
+	end        int // offset just past the ';'
+	valueStart int
+	valueEnd   int
+	set        *attrSet // the value, when it is a plain attribute set literal
+	parent     *attrSet
+}
+
+// fullPath joins the binding's path onto the paths of the bindings owning its enclosing sets
+func (b *binding) fullPath() []string {
+	var prefix []string
+	if b.parent != nil && b.parent.owner != nil {
+		prefix = b.parent.owner.fullPath()
+	}
+	return append(append([]string{}, prefix...), b.path...)
+}
+
+// document is the parsed form of a nix file. The top level is treated as a set body
+// so bare fragments like `firefox.enable = true;` parse as well as whole modules.
+type document struct {
+	src      string
+	root     *attrSet
+	sets     []*attrSet
+	bindings []*binding
+	// namespace is the attribute path of the apps section, e.g. [apps]
+	namespace []string
+}
+
+type parser struct {
+	src      string
+	tokens   []token
+	pos      int
+	sets     []*attrSet
+	bindings []*binding
+}
+
+func parse(src string) *document {
+	p := &parser{src: src, tokens: tokenize(src)}
+	root := &attrSet{open: -1, close: len(src)}
+	p.parseBody(root, "")
+	return &document{src: src, root: root, sets: p.sets, bindings: p.bindings, namespace: []string{DefaultNamespace}}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseSet parses the attribute set opened by the current '{' token
+func (p *parser) parseSet(parent *attrSet) *attrSet {
+	open := p.advance()
+	set := &attrSet{open: open.start, close: len(p.src), parent: parent}
+	if p.pos > 1 && p.tokens[p.pos-2].kind == tokIdent {
+		set.function = p.tokens[p.pos-2].text
+	}
+	p.sets = append(p.sets, set)
+	p.parseBody(set, "")
+	return set
+}
+
+// parseBody collects the bindings of set up to its closing brace, or up to the
+// keyword until when parsing the bindings of a let expression
+func (p *parser) parseBody(set *attrSet, until string) {
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokEOF:
+			return
+		case tok.kind == tokRBrace:
+			p.advance()
+			if set.open >= 0 {
+				set.close = tok.start
+				return
+			}
+			// A stray brace at the top level
+			continue
+		case until != "" && tok.kind == tokIdent && tok.text == until:
+			p.advance()
+			return
+		case tok.kind == tokIdent && tok.text == "inherit":
+			p.advance()
+			p.parseValue(&binding{}, set)
+			continue
+		}
+
+		if b := p.parseBinding(set); b != nil {
+			set.bindings = append(set.bindings, b)
+			continue
+		}
+		p.skipToken(set)
+	}
+}
+
+// skipToken steps over a token that is not part of a binding, still descending
+// into any sets so that function patterns and module bodies are found
+func (p *parser) skipToken(set *attrSet) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokLBrace:
+		p.parseSet(set)
+	case tok.kind == tokIdent && tok.text == "let":
+		p.advance()
+		p.parseBody(&attrSet{open: -1, parent: set}, "in")
+	default:
+		p.advance()
+	}
+}
+
+// parseBinding parses `attr.path = value;`, leaving the position untouched when the
+// tokens ahead are not a binding
+func (p *parser) parseBinding(set *attrSet) *binding {
+	start := p.pos
+	var path []string
+	pathEnd := 0
+	for {
+		tok := p.peek()
+		if tok.kind != tokIdent && tok.kind != tokString {
+			p.pos = start
+			return nil
+		}
+		path = append(path, unquote(tok))
+		pathEnd = tok.end
+		p.advance()
+		if p.peek().kind != tokDot {
+			break
+		}
+		p.advance()
+	}
+	if p.peek().kind != tokAssign {
+		p.pos = start
+		return nil
+	}
+	p.advance()
+
+	b := &binding{path: path, start: p.tokens[start].start, pathEnd: pathEnd, parent: set}
+	p.parseValue(b, set)
+	p.bindings = append(p.bindings, b)
+	return b
+}
+
+// parseValue consumes an expression up to and including its terminating ';'. A missing
+// semicolon before the enclosing '}' or the end of the file is tolerated.
+func (p *parser) parseValue(b *binding, set *attrSet) {
+	b.valueStart = p.peek().start
+	b.valueEnd = b.valueStart
+
+	depth := 0
+	items := 0
+	var candidate *attrSet
+	finish := func(end int) {
+		b.end = end
+		if items == 1 && candidate != nil {
+			b.set = candidate
+			candidate.owner = b
+		}
+	}
+
+	for {
+		tok := p.peek()
+		switch tok.kind {
+		case tokEOF:
+			finish(b.valueEnd)
+			return
+		case tokSemicolon:
+			if depth == 0 {
+				p.advance()
+				finish(tok.end)
+				return
+			}
+		case tokRBrace:
+			if depth == 0 {
+				finish(b.valueEnd)
+				return
+			}
+		case tokLParen, tokLBracket:
+			depth++
+		case tokRParen, tokRBracket:
+			depth = max(depth-1, 0)
+		case tokLBrace:
+			nested := p.parseSet(set)
+			b.valueEnd = min(nested.close+1, len(p.src))
+			if items == 0 {
+				candidate = nested
+			}
+			items++
+			continue
+		case tokIdent:
+			switch {
+			case tok.text == "rec" && items == 0:
+				// `rec { ... }` is still a plain set
+				p.advance()
+				b.valueEnd = tok.end
+				continue
+			case tok.text == "let":
+				p.advance()
+				p.parseBody(&attrSet{open: -1, parent: set}, "in")
+				items += 2
+				continue
+			case tok.text == "with" || tok.text == "assert":
+				// These carry their own ';' before the expression they guard
+				p.advance()
+				p.parseValue(&binding{}, set)
+				items += 2
+				continue
+			}
+		}
+
+		p.advance()
+		b.valueEnd = tok.end
+		items++
+	}
+}
+
+func unquote(tok token) string {
+	if tok.kind == tokString {
+		return strings.Trim(tok.text, `"`)
+	}
+	return tok.text
+}
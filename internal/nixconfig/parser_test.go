@@ -0,0 +1,128 @@
+package nixconfig
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "binding",
+			content: "firefox.enable = true;",
+			want:    []string{"firefox", ".", "enable", "=", "true", ";"},
+		},
+		{
+			name:    "comments are skipped",
+			content: "# apps = {\na /* }; */ = 1;",
+			want:    []string{"a", "=", "1", ";"},
+		},
+		{
+			name:    "braces inside strings",
+			content: `a = "}; ${ { b = 1; }.b }";`,
+			want:    []string{"a", "=", `"}; ${ { b = 1; }.b }"`, ";"},
+		},
+		{
+			name:    "indented string with escapes",
+			content: "a = ''\n  ''${x} ''' }\n'';",
+			want:    []string{"a", "=", "''\n  ''${x} ''' }\n''", ";"},
+		},
+		{
+			name:    "comparison is not an assignment",
+			content: "a == b",
+			want:    []string{"a", "==", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, tok := range tokenize(tt.content) {
+				if tok.kind != tokEOF {
+					got = append(got, tok.text)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tokenize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Bindings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "module with function arguments",
+			content: "{ config, pkgs, ... }:\n{\n  apps = {\n    browsers = {\n      firefox.enable = true;\n    };\n  };\n}",
+			want:    []string{"apps", "apps.browsers", "apps.browsers.firefox.enable"},
+		},
+		{
+			name:    "dotted paths and quoted names",
+			content: `{ apps.browsers."firefox".enable = true; }`,
+			want:    []string{"apps.browsers.firefox.enable"},
+		},
+		{
+			name:    "with and let keep their own semicolons",
+			content: "{\n  environment.systemPackages = with pkgs; [ git ];\n  x = let y = 1; in y;\n  apps = { };\n}",
+			want:    []string{"environment.systemPackages", "x", "y", "apps"},
+		},
+		{
+			name:    "nested package set",
+			content: "apps = { editors = { vim = { enable = false; }; }; };",
+			want:    []string{"apps", "apps.editors", "apps.editors.vim", "apps.editors.vim.enable"},
+		},
+		{
+			name:    "unterminated set",
+			content: "apps = {\n  browsers = {",
+			want:    []string{"apps", "apps.browsers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, b := range parse(tt.content).bindings {
+				got = append(got, strings.Join(b.fullPath(), "."))
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("parse() bindings = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParse_Offsets(t *testing.T) {
+	content := "apps = {\n  firefox.enable = false; # browser\n};"
+	doc := parse(content)
+
+	apps := doc.findSet("apps")
+	if apps == nil {
+		t.Fatal("findSet(apps) = nil")
+	}
+	if got := content[apps.open : apps.close+1]; !strings.HasPrefix(got, "{") || !strings.HasSuffix(got, "}") {
+		t.Errorf("apps set spans %q", got)
+	}
+	if len(apps.bindings) != 1 {
+		t.Fatalf("apps has %d bindings, want 1", len(apps.bindings))
+	}
+
+	b := apps.bindings[0]
+	if got := content[b.start:b.end]; got != "firefox.enable = false;" {
+		t.Errorf("binding spans %q", got)
+	}
+	if got := content[b.valueStart:b.valueEnd]; got != "false" {
+		t.Errorf("value spans %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package nixvalidate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pam/internal/execx"
+)
+
+// Validator checks the new content of a file before it is written
+type Validator interface {
+	Validate(path string, content []byte) error
+}
+
+// Func adapts a plain function to a Validator
+type Func func(path string, content []byte) error
+
+func (f Func) Validate(path string, content []byte) error {
+	return f(path, content)
+}
+
+// Chain runs every validator in order and stops at the first failure
+type Chain []Validator
+
+func (c Chain) Validate(path string, content []byte) error {
+	for _, validator := range c {
+		err := validator.Validate(path, content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Error reports a file that failed validation together with the validator's output
+type Error struct {
+	Path   string
+	Output string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s would not be valid nix: %s", e.Path, e.Output)
+}
+
+// Runner executes name with args, feeding stdin, and returns the combined output
+type Runner func(stdin []byte, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs the real binary
+func ExecRunner(stdin []byte, name string, args ...string) ([]byte, error) {
+	return execx.Default.CombinedOutput(context.Background(), stdin, name, args...)
+}
+
+// Parse checks the syntax of a file with `nix-instantiate --parse`, without evaluating it
+func Parse(run Runner) Validator {
+	return Func(func(path string, content []byte) error {
+		output, err := run(content, "nix-instantiate", "--parse", "-")
+		if err != nil {
+			return &Error{Path: path, Output: strings.TrimSpace(string(output))}
+		}
+		return nil
+	})
+}
+
+// Default returns the validators used by pam commands. Validation is skipped when
+// nix-instantiate is not installed.
+func Default() Validator {
+	if _, err := execx.Default.LookPath("nix-instantiate"); err != nil {
+		return Chain{}
+	}
+	return Chain{Parse(ExecRunner)}
+}
@@ -0,0 +1,74 @@
+package nixvalidate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeParser accepts content with balanced braces, standing in for nix-instantiate
+func fakeParser(calls *[]string) Runner {
+	return func(stdin []byte, name string, args ...string) ([]byte, error) {
+		*calls = append(*calls, name+" "+strings.Join(args, " "))
+		if strings.Count(string(stdin), "{") != strings.Count(string(stdin), "}") {
+			return []byte("error: syntax error, unexpected end of file\n"), errors.New("exit status 1")
+		}
+		return []byte("{ }\n"), nil
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid module", content: "{ apps = { }; }"},
+		{name: "missing brace", content: "{ apps = { ; }", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			err := Parse(fakeParser(&calls)).Validate("hosts/laptop/configuration.nix", []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(calls) != 1 || calls[0] != "nix-instantiate --parse -" {
+				t.Errorf("ran %v, want nix-instantiate --parse -", calls)
+			}
+
+			var validateErr *Error
+			if tt.wantErr {
+				if !errors.As(err, &validateErr) {
+					t.Fatalf("Validate() error = %T, want *Error", err)
+				}
+				if validateErr.Path != "hosts/laptop/configuration.nix" || !strings.Contains(validateErr.Output, "syntax error") {
+					t.Errorf("Validate() error = %+v", validateErr)
+				}
+			}
+		})
+	}
+}
+
+func TestChain_StopsAtFirstFailure(t *testing.T) {
+	var ran []string
+	record := func(name string, err error) Validator {
+		return Func(func(path string, content []byte) error {
+			ran = append(ran, name)
+			return err
+		})
+	}
+
+	chain := Chain{record("first", nil), record("second", errors.New("invalid")), record("third", nil)}
+	if err := chain.Validate("a.nix", nil); err == nil {
+		t.Fatal("Validate() expected error")
+	}
+	if strings.Join(ran, ",") != "first,second" {
+		t.Errorf("ran %v, want [first second]", ran)
+	}
+
+	if err := (Chain{}).Validate("a.nix", nil); err != nil {
+		t.Errorf("empty Chain error = %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package options
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pam/internal/execx"
+)
+
+// HomeManagerRef is the flake output holding the options.json of home-manager
+const HomeManagerRef = "github:nix-community/home-manager#docs-json"
+
+// Option is a NixOS, nix-darwin or home-manager option as options.json describes it
+type Option struct {
+	Name string `json:"name"`
+	// Loc is the attribute path of the option, Name split into its parts
+	Loc         []string `json:"loc,omitempty"`
+	Description string   `json:"description"`
+	// Type is the description of the option's type, e.g. boolean or list of string
+	Type string `json:"type"`
+	// Default and Example are nix expressions, empty when the option has none
+	Default      string   `json:"default,omitempty"`
+	Example      string   `json:"example,omitempty"`
+	Declarations []string `json:"declarations,omitempty"`
+	ReadOnly     bool     `json:"read_only,omitempty"`
+}
+
+// jsonOption is an entry of options.json, whose defaults and examples are literal
+// expressions or plain values and whose declarations are paths or links
+type jsonOption struct {
+	Loc          []string          `json:"loc"`
+	Description  json.RawMessage   `json:"description"`
+	Type         string            `json:"type"`
+	Default      json.RawMessage   `json:"default"`
+	Example      json.RawMessage   `json:"example"`
+	Declarations []json.RawMessage `json:"declarations"`
+	ReadOnly     bool              `json:"readOnly"`
+}
+
+// literal reads a value of options.json as nix source: the text of a literalExpression
+// or literalMD, a string as it is, and other values as JSON
+func literal(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var expression struct {
+		Type string `json:"_type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &expression) == nil && expression.Type != "" {
+		return strings.TrimSpace(expression.Text)
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return strings.TrimSpace(text)
+	}
+	return string(raw)
+}
+
+// Parse reads an options.json into its options sorted by name
+func Parse(data []byte) ([]Option, error) {
+	var entries map[string]jsonOption
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse options.json: %w", err)
+	}
+
+	parsed := make([]Option, 0, len(entries))
+	for name, entry := range entries {
+		option := Option{
+			Name:        name,
+			Loc:         entry.Loc,
+			Description: literal(entry.Description),
+			Type:        entry.Type,
+			Default:     literal(entry.Default),
+			Example:     literal(entry.Example),
+			ReadOnly:    entry.ReadOnly,
+		}
+		for _, declaration := range entry.Declarations {
+			var link struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(declaration, &link) == nil && link.Name != "" {
+				option.Declarations = append(option.Declarations, link.Name)
+			} else {
+				option.Declarations = append(option.Declarations, literal(declaration))
+			}
+		}
+		parsed = append(parsed, option)
+	}
+	sort.Slice(parsed, func(i, j int) bool { return parsed[i].Name < parsed[j].Name })
+	return parsed, nil
+}
+
+// Search returns the options whose name or description contains every word of query,
+// those matching by name first: the exact name, then names starting with the query,
+// then the others, each in alphabetical order
+func Search(all []Option, query string) []Option {
+	words := strings.Fields(strings.ToLower(query))
+	query = strings.ToLower(strings.TrimSpace(query))
+	rank := func(option Option) int {
+		name := strings.ToLower(option.Name)
+		switch {
+		case name == query:
+			return 0
+		case strings.HasPrefix(name, query):
+			return 1
+		case !slices.ContainsFunc(words, func(word string) bool { return !strings.Contains(name, word) }):
+			return 2
+		}
+		return 3
+	}
+
+	var found []Option
+	for _, option := range all {
+		text := strings.ToLower(option.Name + " " + option.Description)
+		if !slices.ContainsFunc(words, func(word string) bool { return !strings.Contains(text, word) }) {
+			found = append(found, option)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return rank(found[i]) < rank(found[j]) })
+	return found
+}
+
+// HostRef is the options.json the manual of a NixOS or nix-darwin host is built from,
+// covering the modules of the flake as well
+func HostRef(flakePath string, host string, darwin bool) string {
+	outputs := "nixosConfigurations"
+	if darwin {
+		outputs = "darwinConfigurations"
+	}
+	return fmt.Sprintf("%s#%s.%s.config.system.build.manual.optionsJSON", flakePath, outputs, strconv.Quote(host))
+}
+
+// Load builds ref with nix build and reads the options.json it holds
+func Load(ctx context.Context, runner execx.Runner, ref string) ([]Option, error) {
+	output, err := runner.Output(ctx, "nix", "build", "--no-link", "--print-out-paths", ref)
+	if err != nil {
+		return nil, fmt.Errorf("building %s: %w", ref, err)
+	}
+	out := strings.TrimSpace(string(output))
+	if i := strings.LastIndex(out, "\n"); i >= 0 {
+		out = out[i+1:]
+	}
+	found, err := filepath.Glob(filepath.Join(out, "share", "doc", "*", "options.json"))
+	if err != nil || len(found) == 0 {
+		return nil, fmt.Errorf("%s has no share/doc/*/options.json", out)
+	}
+	return ReadFile(found[0])
+}
+
+// ReadFile reads the options of an options.json file
+func ReadFile(path string) ([]Option, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+
+// FormatPath joins an attribute path, quoting the parts that aren't identifiers such as
+// "net.ipv4.ip_forward"
+func FormatPath(path []string) string {
+	parts := make([]string, len(path))
+	for i, part := range path {
+		parts[i] = part
+		if !identifier.MatchString(part) {
+			parts[i] = strconv.Quote(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ParsePath splits an attribute path such as boot.kernel.sysctl."net.ipv4.ip_forward"
+// into its parts. Parts left as <name> or * by the option's declaration have to be
+// replaced first.
+func ParsePath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	var parts []string
+	for i := 0; i < len(path); {
+		var part string
+		if path[i] == '"' {
+			end := strings.IndexByte(path[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %s", path)
+			}
+			part = path[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			end := strings.IndexByte(path[i:], '.')
+			if end < 0 {
+				end = len(path) - i
+			}
+			part = path[i : i+end]
+			i += end
+		}
+		if part == "" {
+			return nil, fmt.Errorf("invalid attribute path %s", path)
+		}
+		if part == "*" || (strings.HasPrefix(part, "<") && strings.HasSuffix(part, ">")) {
+			return nil, fmt.Errorf("replace %s in %s with the attribute to set", part, path)
+		}
+		parts = append(parts, part)
+		if i < len(path) {
+			if path[i] != '.' || i == len(path)-1 {
+				return nil, fmt.Errorf("invalid attribute path %s", path)
+			}
+			i++
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty attribute path")
+	}
+	return parts, nil
+}
+
+// Value returns value as a nix expression for an option of the given type: values of
+// string and path options are quoted unless they already are, lists, attribute sets and
+// the rest are taken as they are
+func Value(optionType string, value string) string {
+	value = strings.TrimSpace(value)
+	textual := (strings.Contains(optionType, "string") || strings.Contains(optionType, "path")) &&
+		!strings.Contains(optionType, "list of") && !strings.Contains(optionType, "attribute set") &&
+		!strings.Contains(optionType, "package")
+	if !textual || value == "null" || strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "''") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", "\\${").Replace(value) + `"`
+}
@@ -0,0 +1,201 @@
+package options
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+const optionsJSON = `{
+  "services.openssh.enable": {
+    "loc": ["services", "openssh", "enable"],
+    "description": "Whether to enable the OpenSSH secure shell daemon.",
+    "type": "boolean",
+    "default": {"_type": "literalExpression", "text": "false"},
+    "example": {"_type": "literalExpression", "text": "true"},
+    "declarations": ["nixos/modules/services/networking/ssh/sshd.nix"],
+    "readOnly": false
+  },
+  "services.openssh.ports": {
+    "loc": ["services", "openssh", "ports"],
+    "description": "Specifies on which ports the SSH daemon listens.",
+    "type": "list of 16 bit unsigned integer; between 0 and 65535 (both inclusive)",
+    "default": [22],
+    "declarations": [{"name": "<nixpkgs/nixos/modules/services/networking/ssh/sshd.nix>", "url": "https://github.com/NixOS/nixpkgs/blob/master/nixos/modules/services/networking/ssh/sshd.nix"}]
+  },
+  "programs.ssh.startAgent": {
+    "loc": ["programs", "ssh", "startAgent"],
+    "description": "Whether to start the OpenSSH agent when you log in.",
+    "type": "boolean",
+    "default": false
+  },
+  "users.users.<name>.shell": {
+    "loc": ["users", "users", "<name>", "shell"],
+    "description": "The path to the user's shell.",
+    "type": "null or package or path",
+    "default": {"_type": "literalExpression", "text": "pkgs.shadow"},
+    "example": {"_type": "literalExpression", "text": "pkgs.bashInteractive"}
+  }
+}`
+
+func TestParse(t *testing.T) {
+	parsed, err := Parse([]byte(optionsJSON))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var names []string
+	for _, option := range parsed {
+		names = append(names, option.Name)
+	}
+	want := []string{"programs.ssh.startAgent", "services.openssh.enable", "services.openssh.ports", "users.users.<name>.shell"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("Parse() names = %v, want %v", names, want)
+	}
+
+	enable := parsed[1]
+	if enable.Default != "false" || enable.Example != "true" || enable.Type != "boolean" {
+		t.Errorf("services.openssh.enable = %+v, want the literal default and example", enable)
+	}
+	if !slices.Equal(enable.Declarations, []string{"nixos/modules/services/networking/ssh/sshd.nix"}) {
+		t.Errorf("services.openssh.enable declarations = %v", enable.Declarations)
+	}
+	ports := parsed[2]
+	if ports.Default != "[22]" {
+		t.Errorf("services.openssh.ports default = %q, want [22]", ports.Default)
+	}
+	if !slices.Equal(ports.Declarations, []string{"<nixpkgs/nixos/modules/services/networking/ssh/sshd.nix>"}) {
+		t.Errorf("services.openssh.ports declarations = %v, want the name of the link", ports.Declarations)
+	}
+	if parsed[0].Default != "false" {
+		t.Errorf("programs.ssh.startAgent default = %q, want false", parsed[0].Default)
+	}
+
+	if _, err := Parse([]byte("[")); err == nil {
+		t.Error("Parse() of invalid JSON should fail")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	all, err := Parse([]byte(optionsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"services.openssh.enable", []string{"services.openssh.enable"}},
+		{"openssh", []string{"services.openssh.enable", "services.openssh.ports", "programs.ssh.startAgent"}},
+		{"ssh agent", []string{"programs.ssh.startAgent"}},
+		{"SHELL", []string{"users.users.<name>.shell", "services.openssh.enable"}},
+		{"firefox", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []string
+			for _, option := range Search(all, tt.query) {
+				got = append(got, option.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostRef(t *testing.T) {
+	if got := HostRef("/flake", "laptop", false); got != `/flake#nixosConfigurations."laptop".config.system.build.manual.optionsJSON` {
+		t.Errorf("HostRef(nixos) = %s", got)
+	}
+	if got := HostRef("/flake", "mac", true); !strings.HasPrefix(got, `/flake#darwinConfigurations."mac".`) {
+		t.Errorf("HostRef(darwin) = %s", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	out := t.TempDir()
+	doc := filepath.Join(out, "share", "doc", "nixos")
+	if err := os.MkdirAll(doc, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(doc, "options.json"), []byte(optionsJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &execx.Fake{Responses: map[string]execx.Response{"nix": {Output: out + "\n"}}}
+	loaded, err := Load(context.Background(), runner, HomeManagerRef)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded) != 4 {
+		t.Errorf("Load() returned %d options, want 4", len(loaded))
+	}
+	if calls := runner.Calls(); len(calls) != 1 || calls[0] != "nix build --no-link --print-out-paths "+HomeManagerRef {
+		t.Errorf("ran %q, want one nix build of the options", calls)
+	}
+
+	runner = &execx.Fake{Responses: map[string]execx.Response{"nix": {Output: t.TempDir()}}}
+	if _, err := Load(context.Background(), runner, HomeManagerRef); err == nil {
+		t.Error("Load() of an output without options.json should fail")
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "services.openssh.enable", want: []string{"services", "openssh", "enable"}},
+		{path: `boot.kernel.sysctl."net.ipv4.ip_forward"`, want: []string{"boot", "kernel", "sysctl", "net.ipv4.ip_forward"}},
+		{path: "users.users.<name>.shell", wantErr: true},
+		{path: "fileSystems.*.options", wantErr: true},
+		{path: "services..enable", wantErr: true},
+		{path: "services.", wantErr: true},
+		{path: `boot."net`, wantErr: true},
+		{path: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ParsePath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParsePath() = %q, want %q", got, tt.want)
+			}
+			if !tt.wantErr && FormatPath(got) != tt.path {
+				t.Errorf("FormatPath() = %s, want %s", FormatPath(got), tt.path)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		optionType string
+		value      string
+		want       string
+	}{
+		{"boolean", "true", "true"},
+		{"string", "Europe/Oslo", `"Europe/Oslo"`},
+		{"string", `"quoted"`, `"quoted"`},
+		{"strings concatenated with \"\\n\"", "''\n  text\n''", "''\n  text\n''"},
+		{"null or string", "null", "null"},
+		{"absolute path", "/srv/data", `"/srv/data"`},
+		{"string", `say "hi" ${x}`, `"say \"hi\" \${x}"`},
+		{"list of string", `[ "a" ]`, `[ "a" ]`},
+		{"attribute set of string", `{ a = "b"; }`, `{ a = "b"; }`},
+		{"16 bit unsigned integer; between 0 and 65535 (both inclusive)", "8080", "8080"},
+	}
+	for _, tt := range tests {
+		if got := Value(tt.optionType, tt.value); got != tt.want {
+			t.Errorf("Value(%q, %q) = %s, want %s", tt.optionType, tt.value, got, tt.want)
+		}
+	}
+}
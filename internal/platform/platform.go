@@ -0,0 +1,96 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// NixInstallURL is where the nix installer and its instructions live
+const NixInstallURL = "https://nixos.org/download"
+
+// Check returns an error telling the user how to run pam when nix doesn't run on goos
+func Check(goos string) error {
+	switch goos {
+	case "linux", "darwin":
+		return nil
+	case "windows":
+		return fmt.Errorf("nix doesn't run on Windows, run pam inside WSL instead: install it with `wsl --install`, install nix in the WSL distribution from %s and build pam there", NixInstallURL)
+	default:
+		return fmt.Errorf("nix doesn't run on %s, pam needs Linux, macOS or WSL", goos)
+	}
+}
+
+// Env is what WSL detection reads
+type Env struct {
+	Getenv   func(key string) string
+	ReadFile func(name string) ([]byte, error)
+}
+
+// IsWSL reports whether pam runs inside the Windows Subsystem for Linux
+func IsWSL(env Env) bool {
+	if env.Getenv("WSL_DISTRO_NAME") != "" || env.Getenv("WSL_INTEROP") != "" {
+		return true
+	}
+	release, err := env.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+	release = []byte(strings.ToLower(string(release)))
+	return strings.Contains(string(release), "microsoft") || strings.Contains(string(release), "wsl")
+}
+
+// InWSL reports whether this process runs inside WSL, detected once
+var InWSL = sync.OnceValue(func() bool {
+	return IsWSL(Env{Getenv: os.Getenv, ReadFile: os.ReadFile})
+})
+
+var (
+	// A path into a distribution as Windows shows it, \\wsl$\Ubuntu\home\me or \\wsl.localhost\Ubuntu\home\me
+	wslSharePath = regexp.MustCompile(`(?i)^(?:\\\\|//)wsl(?:\$|\.localhost)[\\/][^\\/]+(.*)$`)
+	// A Windows drive path such as C:\Users\me, mounted under /mnt/c in WSL
+	drivePath = regexp.MustCompile(`^([A-Za-z]):(?:[\\/](.*))?$`)
+)
+
+// WSLPath translates a path copied from Windows into the one WSL sees: \\wsl$\<distro>\home\me
+// becomes /home/me and C:\Users\me becomes /mnt/c/Users/me. Other paths are returned as
+// they are and ok is false.
+func WSLPath(path string) (translated string, ok bool) {
+	if match := wslSharePath.FindStringSubmatch(path); match != nil {
+		rest := strings.ReplaceAll(match[1], `\`, "/")
+		if rest == "" {
+			rest = "/"
+		}
+		return rest, true
+	}
+	if match := drivePath.FindStringSubmatch(path); match != nil {
+		translated = "/mnt/" + strings.ToLower(match[1])
+		if match[2] != "" {
+			translated += "/" + strings.ReplaceAll(match[2], `\`, "/")
+		}
+		return strings.TrimSuffix(translated, "/"), true
+	}
+	return path, false
+}
+
+// InstallHint tells the user how to get a program pam runs that isn't in PATH
+func InstallHint(program string, wsl bool) string {
+	switch program {
+	case "nix", "nix-env", "nix-store", "nix-instantiate", "nix-collect-garbage":
+		if wsl {
+			return fmt.Sprintf("install nix inside the WSL distribution, not on Windows, with the Linux installer from %s, then open a new shell", NixInstallURL)
+		}
+		return fmt.Sprintf("install nix from %s and open a new shell", NixInstallURL)
+	case "nixos-rebuild":
+		return "nixos-rebuild comes with NixOS, set the rebuild of the host to another command in the config on other systems"
+	case "darwin-rebuild":
+		return "install nix-darwin from https://github.com/LnL7/nix-darwin, or set the rebuild of the host to another command in the config"
+	case "home-manager":
+		return "install home-manager from https://github.com/nix-community/home-manager"
+	case "git":
+		return "install git, e.g. with nix profile install nixpkgs#git"
+	}
+	return fmt.Sprintf("install %s or add it to PATH", program)
+}
@@ -0,0 +1,85 @@
+package platform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	for _, goos := range []string{"linux", "darwin"} {
+		if err := Check(goos); err != nil {
+			t.Errorf("Check(%s) error = %v", goos, err)
+		}
+	}
+	if err := Check("windows"); err == nil || !strings.Contains(err.Error(), "WSL") {
+		t.Errorf("Check(windows) error = %v, want a pointer to WSL", err)
+	}
+	if err := Check("plan9"); err == nil {
+		t.Error("Check(plan9) error = nil")
+	}
+}
+
+func TestIsWSL(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		release string
+		want    bool
+	}{
+		{name: "distro variable", env: map[string]string{"WSL_DISTRO_NAME": "Ubuntu"}, want: true},
+		{name: "WSL2 kernel", release: "5.15.153.1-microsoft-standard-WSL2\n", want: true},
+		{name: "WSL1 kernel", release: "4.4.0-19041-Microsoft\n", want: true},
+		{name: "linux", release: "6.6.30\n", want: false},
+		{name: "no proc", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := Env{
+				Getenv: func(key string) string { return tt.env[key] },
+				ReadFile: func(name string) ([]byte, error) {
+					if tt.release == "" {
+						return nil, errors.New("no such file")
+					}
+					return []byte(tt.release), nil
+				},
+			}
+			if got := IsWSL(env); got != tt.want {
+				t.Errorf("IsWSL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWSLPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{`\\wsl$\Ubuntu\home\me\nixos-config`, "/home/me/nixos-config", true},
+		{`\\wsl.localhost\NixOS\home\me`, "/home/me", true},
+		{`//wsl$/Ubuntu/etc/nixos`, "/etc/nixos", true},
+		{`\\wsl$\Ubuntu`, "/", true},
+		{`C:\Users\me\nixos`, "/mnt/c/Users/me/nixos", true},
+		{`D:/config`, "/mnt/d/config", true},
+		{`C:\`, "/mnt/c", true},
+		{"/home/me/nixos-config", "/home/me/nixos-config", false},
+		{"~/nixos-config", "~/nixos-config", false},
+	}
+	for _, tt := range tests {
+		got, ok := WSLPath(tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("WSLPath(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestInstallHint(t *testing.T) {
+	if hint := InstallHint("nix", true); !strings.Contains(hint, "inside the WSL distribution") {
+		t.Errorf("InstallHint(nix, wsl) = %q", hint)
+	}
+	if hint := InstallHint("nix", false); strings.Contains(hint, "WSL") || !strings.Contains(hint, NixInstallURL) {
+		t.Errorf("InstallHint(nix) = %q", hint)
+	}
+}
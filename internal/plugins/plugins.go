@@ -0,0 +1,158 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/search"
+)
+
+// Prefix starts the name of every plugin executable, pam-<name> adds pam <name>
+const Prefix = "pam-"
+
+// ContextEnv holds the JSON context of a plugin run as a command, whose standard input
+// is the terminal
+const ContextEnv = "PAM_CONTEXT"
+
+// Version is the version of the context plugins receive, raised when a field changes meaning
+const Version = 1
+
+// Actions a plugin is run for, passed as its first argument except for commands
+const (
+	// Command runs the plugin as pam <name> with the remaining arguments
+	Command = "command"
+	// Search asks a plugin source for the packages matching the query
+	Search = "search"
+	// Templates asks for the module templates the plugin provides
+	Templates = "templates"
+)
+
+// Plugin is a pam-<name> executable
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Context is what a plugin receives as JSON, on stdin or in PAM_CONTEXT for commands.
+// Fields that don't apply to the action are left out.
+type Context struct {
+	Version int    `json:"version"`
+	Action  string `json:"action"`
+	// Flake is the flake pam manages, empty when pam isn't configured yet
+	Flake   string `json:"flake,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	// Args are the arguments after pam <name> of a command
+	Args []string `json:"args,omitempty"`
+	// Query and System are what a search looks for
+	Query  string `json:"query,omitempty"`
+	System string `json:"system,omitempty"`
+}
+
+// Discover returns the pam-<name> executables of the directories in path, a PATH value.
+// Like with PATH lookups the first directory wins when two hold the same plugin.
+func Discover(path string) []Plugin {
+	seen := map[string]bool{}
+	var found []Plugin
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), Prefix)
+			if !ok || name == "" || seen[name] {
+				continue
+			}
+			plugin := filepath.Join(dir, entry.Name())
+			info, err := os.Stat(plugin)
+			if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+				continue
+			}
+			seen[name] = true
+			found = append(found, Plugin{Name: name, Path: plugin})
+		}
+	}
+	slices.SortFunc(found, func(a, b Plugin) int { return strings.Compare(a.Name, b.Name) })
+	return found
+}
+
+// Find looks up the executable of the plugin called name in PATH
+func Find(runner execx.Runner, name string) (Plugin, error) {
+	path, err := runner.LookPath(Prefix + name)
+	if err != nil {
+		return Plugin{}, fmt.Errorf("plugin %s not found, put an executable named %s%s in PATH", name, Prefix, name)
+	}
+	return Plugin{Name: name, Path: path}, nil
+}
+
+// Encode returns the JSON of a context, stamped with the context version
+func Encode(pluginContext Context) ([]byte, error) {
+	pluginContext.Version = Version
+	return json.Marshal(pluginContext)
+}
+
+// Call runs the plugin for the action of the context, which it reads on stdin, and
+// returns what it printed
+func Call(ctx context.Context, runner execx.Runner, plugin Plugin, pluginContext Context) ([]byte, error) {
+	input, err := Encode(pluginContext)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runner.Pipe(ctx, input, plugin.Path, pluginContext.Action)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s %s failed: %w", plugin.Name, pluginContext.Action, err)
+	}
+	return output, nil
+}
+
+// SearchPackages asks a plugin source for the packages matching query on system. The
+// plugin prints them like nix search --json does, keyed by output, system and attribute.
+func SearchPackages(ctx context.Context, runner execx.Runner, plugin Plugin, pluginContext Context) (search.SearchResult, error) {
+	pluginContext.Action = Search
+	output, err := Call(ctx, runner, plugin, pluginContext)
+	if err != nil {
+		return nil, &search.SearchError{Ref: Prefix + plugin.Name, Query: pluginContext.Query, Err: err}
+	}
+	result, err := search.ParseResult(output)
+	if err != nil {
+		return nil, &search.SearchError{Ref: Prefix + plugin.Name, Query: pluginContext.Query, Err: err}
+	}
+	return result, nil
+}
+
+// Template is a module template a plugin provides
+type Template struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// ListTemplates asks a plugin for its module templates, printed as a JSON list of name and content
+func ListTemplates(ctx context.Context, runner execx.Runner, plugin Plugin, pluginContext Context) ([]Template, error) {
+	pluginContext.Action = Templates
+	output, err := Call(ctx, runner, plugin, pluginContext)
+	if err != nil {
+		return nil, err
+	}
+	var found []Template
+	if err := json.Unmarshal(output, &found); err != nil {
+		return nil, fmt.Errorf("reading the templates of plugin %s: %w", plugin.Name, err)
+	}
+	for _, template := range found {
+		if template.Name == "" {
+			return nil, fmt.Errorf("plugin %s returned a template without a name", plugin.Name)
+		}
+	}
+	return found, nil
+}
+
+// HookCommand is the hook command running a plugin for an install event, e.g.
+// pam-notify post-install. It reads the hook context on stdin like any hook.
+func HookCommand(plugin Plugin, event string) string {
+	return "'" + strings.ReplaceAll(plugin.Path, "'", `'\''`) + "' " + event
+}
@@ -0,0 +1,114 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"pam/internal/execx"
+	"pam/internal/search"
+)
+
+func writeExecutable(t *testing.T, dir string, name string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeExecutable(t, first, "pam-notify", 0o755)
+	writeExecutable(t, first, "pam-readme", 0o644)
+	writeExecutable(t, first, "pam-", 0o755)
+	writeExecutable(t, first, "git", 0o755)
+	writeExecutable(t, second, "pam-notify", 0o755)
+	writeExecutable(t, second, "pam-aur", 0o755)
+	if err := os.Mkdir(filepath.Join(second, "pam-dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	found := Discover(first + string(filepath.ListSeparator) + filepath.Join(first, "missing") + string(filepath.ListSeparator) + second)
+	want := []Plugin{
+		{Name: "aur", Path: filepath.Join(second, "pam-aur")},
+		{Name: "notify", Path: filepath.Join(first, "pam-notify")},
+	}
+	if !slices.Equal(found, want) {
+		t.Errorf("Discover() = %v, want %v", found, want)
+	}
+}
+
+func TestFind(t *testing.T) {
+	runner := &execx.Fake{Missing: []string{"pam-missing"}}
+	plugin, err := Find(runner, "notify")
+	if err != nil || plugin.Path != "/run/current-system/sw/bin/pam-notify" {
+		t.Errorf("Find() = %+v, %v", plugin, err)
+	}
+	if _, err := Find(runner, "missing"); err == nil {
+		t.Error("Find() of a plugin missing from PATH should fail")
+	}
+}
+
+func TestSearchPackages(t *testing.T) {
+	plugin := Plugin{Name: "aur", Path: "/bin/pam-aur"}
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"/bin/pam-aur search": {Output: `{"packages.x86_64-linux.yay": {"pname": "yay", "version": "12.4"}}`},
+	}}
+	result, err := SearchPackages(context.Background(), runner, plugin, Context{Flake: "/flake", Query: "yay", System: "x86_64-linux"})
+	if err != nil {
+		t.Fatalf("SearchPackages() error = %v", err)
+	}
+	if result["packages.x86_64-linux.yay"].PName != "yay" {
+		t.Errorf("SearchPackages() = %v", result)
+	}
+
+	var got Context
+	if err := json.Unmarshal(runner.Input("/bin/pam-aur search"), &got); err != nil {
+		t.Fatalf("plugin read invalid context: %v", err)
+	}
+	want := Context{Version: Version, Action: Search, Flake: "/flake", Query: "yay", System: "x86_64-linux"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("context = %+v, want %+v", got, want)
+	}
+
+	failing := &execx.Fake{Responses: map[string]execx.Response{"/bin/pam-aur search": {Err: errors.New("exit status 1")}}}
+	var searchErr *search.SearchError
+	if _, err := SearchPackages(context.Background(), failing, plugin, Context{Query: "yay"}); !errors.As(err, &searchErr) {
+		t.Errorf("SearchPackages() error = %v, want a SearchError", err)
+	}
+	invalid := &execx.Fake{Responses: map[string]execx.Response{"/bin/pam-aur search": {Output: "not json"}}}
+	if _, err := SearchPackages(context.Background(), invalid, plugin, Context{Query: "yay"}); !errors.As(err, &searchErr) {
+		t.Errorf("SearchPackages() of invalid output error = %v, want a SearchError", err)
+	}
+}
+
+func TestListTemplates(t *testing.T) {
+	plugin := Plugin{Name: "company", Path: "/bin/pam-company"}
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"/bin/pam-company templates": {Output: `[{"name": "service", "content": "{ }"}]`},
+	}}
+	found, err := ListTemplates(context.Background(), runner, plugin, Context{})
+	if err != nil {
+		t.Fatalf("ListTemplates() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Name != "service" || found[0].Content != "{ }" {
+		t.Errorf("ListTemplates() = %+v", found)
+	}
+
+	unnamed := &execx.Fake{Responses: map[string]execx.Response{"/bin/pam-company templates": {Output: `[{"content": "{ }"}]`}}}
+	if _, err := ListTemplates(context.Background(), unnamed, plugin, Context{}); err == nil {
+		t.Error("ListTemplates() should refuse a template without a name")
+	}
+}
+
+func TestHookCommand(t *testing.T) {
+	got := HookCommand(Plugin{Name: "notify", Path: "/opt/it's/pam-notify"}, "post-install")
+	if want := `'/opt/it'\''s/pam-notify' post-install`; got != want {
+		t.Errorf("HookCommand() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package rebuild
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"pam/internal/execx"
+)
+
+// Platform is the kind of system a host runs, deciding which rebuild tool switches it
+type Platform string
+
+const (
+	NixOS  Platform = "nixos"
+	Darwin Platform = "darwin"
+	// HomeManager is a standalone home-manager configuration, switched without root
+	HomeManager Platform = "home-manager"
+)
+
+// PlatformFor maps a nix system such as aarch64-darwin, or a GOOS such as linux, to its platform
+func PlatformFor(system string) Platform {
+	if strings.Contains(system, "darwin") {
+		return Darwin
+	}
+	return NixOS
+}
+
+// Command returns the command that switches host to the flake's configuration.
+// Both tools need root to activate, so sudo is prepended unless pam already runs as root.
+func Command(platform Platform, flakePath string, host string, root bool) []string {
+	tool := "nixos-rebuild"
+	switch platform {
+	case Darwin:
+		tool = "darwin-rebuild"
+	case HomeManager:
+		return []string{"home-manager", "switch", "--flake", fmt.Sprintf("%s#%s", flakePath, host)}
+	}
+	args := []string{tool, "switch", "--flake", fmt.Sprintf("%s#%s", flakePath, host)}
+	if root {
+		return args
+	}
+	return append([]string{"sudo"}, args...)
+}
+
+// CustomCommand turns a rebuild command from the config into arguments. The name of a
+// platform stands for its usual command, anything else is split on spaces with {flake}
+// and {host} replaced, and runs as written, sudo included.
+func CustomCommand(command string, flakePath string, host string, root bool) []string {
+	switch platform := Platform(command); platform {
+	case NixOS, Darwin, HomeManager:
+		return Command(platform, flakePath, host, root)
+	}
+	replacer := strings.NewReplacer("{flake}", flakePath, "{host}", host)
+	args := strings.Fields(command)
+	for i, arg := range args {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// DeployCommand returns the command switching host over SSH at target to the flake's
+// configuration, built here and copied over. Only NixOS can activate a remote host, so
+// other platforms fail. A target logging in as another user than root gets sudo there.
+func DeployCommand(platform Platform, flakePath string, host string, target string) ([]string, error) {
+	if platform != NixOS {
+		return nil, fmt.Errorf("%s can't switch a remote host, set a custom rebuild command for %s instead", platform, host)
+	}
+	args := []string{"nixos-rebuild", "switch", "--flake", fmt.Sprintf("%s#%s", flakePath, host), "--target-host", target}
+	if !strings.HasPrefix(target, "root@") {
+		args = append(args, "--use-remote-sudo")
+	}
+	return args, nil
+}
+
+// Phase is the step of a rebuild currently running
+type Phase string
+
+const (
+	Evaluating Phase = "evaluating"
+	Fetching   Phase = "fetching"
+	Building   Phase = "building"
+	Activating Phase = "activating"
+)
+
+var (
+	toBuildPattern = regexp.MustCompile(`^these (\d+) derivations? will be built`)
+	toFetchPattern = regexp.MustCompile(`^these (\d+) paths? will be fetched`)
+)
+
+// Progress follows the output of a rebuild to tell which phase it is in and how far along it is
+type Progress struct {
+	Phase   Phase
+	Built   int
+	ToBuild int
+	Fetched int
+	ToFetch int
+	// Current is the name of the derivation being built or the path being fetched
+	Current string
+}
+
+// storeName returns the name of a store path quoted in line, e.g. firefox-121.0 for
+// '/nix/store/<hash>-firefox-121.0.drv'
+func storeName(line string) string {
+	_, path, ok := strings.Cut(line, "'")
+	if !ok {
+		return ""
+	}
+	path, _, _ = strings.Cut(path, "'")
+	base := path[strings.LastIndex(path, "/")+1:]
+	if _, name, ok := strings.Cut(base, "-"); ok {
+		base = name
+	}
+	return strings.TrimSuffix(base, ".drv")
+}
+
+// Observe updates the progress with one line of rebuild output
+func (p *Progress) Observe(line string) {
+	line = strings.TrimSpace(line)
+	if p.Phase == "" {
+		p.Phase = Evaluating
+	}
+
+	if match := toBuildPattern.FindStringSubmatch(line); match != nil {
+		fmt.Sscan(match[1], &p.ToBuild)
+		return
+	}
+	if match := toFetchPattern.FindStringSubmatch(line); match != nil {
+		fmt.Sscan(match[1], &p.ToFetch)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(line, "building '"):
+		p.Phase = Building
+		p.Built++
+		p.Current = storeName(line)
+	case strings.HasPrefix(line, "copying path '"):
+		p.Phase = Fetching
+		p.Fetched++
+		p.Current = storeName(line)
+	case strings.HasPrefix(line, "activating the configuration"), strings.HasPrefix(line, "setting up /etc"), strings.HasPrefix(line, "Activating "):
+		p.Phase = Activating
+	}
+}
+
+// String describes the progress for a status line, e.g. "building firefox-121.0 (3/12)"
+func (p Progress) String() string {
+	phase := string(p.Phase)
+	if (p.Phase == Building || p.Phase == Fetching) && p.Current != "" {
+		phase += " " + p.Current
+	}
+	switch {
+	case p.Phase == Building && p.ToBuild > 0:
+		return fmt.Sprintf("%s (%d/%d)", phase, min(p.Built, p.ToBuild), p.ToBuild)
+	case p.Phase == Fetching && p.ToFetch > 0:
+		return fmt.Sprintf("%s (%d/%d)", phase, min(p.Fetched, p.ToFetch), p.ToFetch)
+	case p.Phase == "":
+		return "starting"
+	default:
+		return phase
+	}
+}
+
+// Run runs the rebuild command args with runner, following its output with progress.
+// It returns the output lines, for Summarize when the rebuild failed.
+func Run(ctx context.Context, runner execx.Runner, args []string, progress *Progress) ([]string, error) {
+	output, err := runner.CombinedOutput(ctx, nil, args[0], args[1:]...)
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	for _, line := range lines {
+		progress.Observe(line)
+	}
+	return lines, err
+}
+
+// tailLines is how much output Summarize falls back to when no error line is recognized
+const tailLines = 10
+
+// Summarize picks the lines that explain why a rebuild failed: every `error:` line with
+// the indented lines that follow it, or the end of the output when there is none.
+func Summarize(lines []string) []string {
+	var summary []string
+	inError := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "error:"):
+			inError = true
+			summary = append(summary, line)
+		case inError && trimmed != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			summary = append(summary, line)
+		default:
+			inError = false
+		}
+	}
+	if len(summary) > 0 {
+		return summary
+	}
+	return lines[max(0, len(lines)-tailLines):]
+}
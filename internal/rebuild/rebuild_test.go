@@ -0,0 +1,163 @@
+package rebuild
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform Platform
+		root     bool
+		want     string
+	}{
+		{name: "nixos", platform: PlatformFor("x86_64-linux"), want: "sudo nixos-rebuild switch --flake /flake#laptop"},
+		{name: "darwin", platform: PlatformFor("aarch64-darwin"), want: "sudo darwin-rebuild switch --flake /flake#laptop"},
+		{name: "already root", platform: PlatformFor("linux"), root: true, want: "nixos-rebuild switch --flake /flake#laptop"},
+		{name: "home-manager", platform: HomeManager, want: "home-manager switch --flake /flake#laptop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(Command(tt.platform, "/flake", "laptop", tt.root), " ")
+			if got != tt.want {
+				t.Errorf("Command() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "darwin", want: "sudo darwin-rebuild switch --flake /flake#laptop"},
+		{command: "home-manager", want: "home-manager switch --flake /flake#laptop"},
+		{command: "deploy {flake}#{host} --skip-checks", want: "deploy /flake#laptop --skip-checks"},
+		{command: "sudo nixos-rebuild boot --flake {flake}#{host}", want: "sudo nixos-rebuild boot --flake /flake#laptop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got := strings.Join(CustomCommand(tt.command, "/flake", "laptop", false), " ")
+			if got != tt.want {
+				t.Errorf("CustomCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeployCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform Platform
+		target   string
+		want     string
+		wantErr  bool
+	}{
+		{name: "root login", platform: NixOS, target: "root@server", want: "nixos-rebuild switch --flake /flake#server --target-host root@server"},
+		{name: "user login", platform: NixOS, target: "admin@10.0.0.2", want: "nixos-rebuild switch --flake /flake#server --target-host admin@10.0.0.2 --use-remote-sudo"},
+		{name: "darwin", platform: Darwin, target: "root@server", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := DeployCommand(tt.platform, "/flake", "server", tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeployCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := strings.Join(args, " "); got != tt.want {
+				t.Errorf("DeployCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgress_Observe(t *testing.T) {
+	output := []string{
+		"building the system configuration...",
+		"these 2 derivations will be built:",
+		"  /nix/store/abc-firefox.drv",
+		"these 3 paths will be fetched (12.0 MiB download, 40.0 MiB unpacked):",
+		"copying path '/nix/store/def-firefox-121.0' from 'https://cache.nixos.org'...",
+		"building '/nix/store/abc-firefox.drv'...",
+	}
+
+	var progress Progress
+	for _, line := range output {
+		progress.Observe(line)
+	}
+	if progress.String() != "building firefox (1/2)" {
+		t.Errorf("progress = %q, want building firefox (1/2)", progress.String())
+	}
+	if progress.ToFetch != 3 || progress.Fetched != 1 {
+		t.Errorf("fetched %d/%d, want 1/3", progress.Fetched, progress.ToFetch)
+	}
+
+	progress.Observe("activating the configuration...")
+	if progress.Phase != Activating {
+		t.Errorf("phase = %q, want %q", progress.Phase, Activating)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name: "error with trace",
+			lines: []string{
+				"building the system configuration...",
+				"error: undefined variable 'firefx'",
+				"       at /flake/modules/apps/browsers/firefox.nix:3:5:",
+				"",
+				"(use '--show-trace' to show detailed location information)",
+			},
+			want: []string{
+				"error: undefined variable 'firefx'",
+				"       at /flake/modules/apps/browsers/firefox.nix:3:5:",
+			},
+		},
+		{
+			name:  "no error line keeps the tail",
+			lines: []string{"a", "b", "c"},
+			want:  []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Summarize(tt.lines)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Summarize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	output := "these 2 derivations will be built:\nbuilding '/nix/store/abc-etc.drv'...\nerror: builder failed\n"
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"sudo nixos-rebuild switch --flake /flake#laptop": {Output: output, Err: errors.New("exit status 1")},
+	}}
+
+	var progress Progress
+	lines, err := Run(context.Background(), runner, Command(NixOS, "/flake", "laptop", false), &progress)
+	if err == nil {
+		t.Fatal("Run() expected the error of the rebuild")
+	}
+	if len(lines) != 3 || lines[2] != "error: builder failed" {
+		t.Errorf("Run() lines = %q", lines)
+	}
+	if progress.String() != "building etc (1/2)" {
+		t.Errorf("progress = %q, want building etc (1/2)", progress.String())
+	}
+}
@@ -0,0 +1,142 @@
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pam/internal/execx"
+	"pam/internal/fsx"
+)
+
+// DefaultCacheTTL is how long cached search results are reused
+const DefaultCacheTTL = 24 * time.Hour
+
+type cacheEntry struct {
+	Time   time.Time    `json:"time"`
+	Result SearchResult `json:"result"`
+}
+
+// Cache persists search results on disk, keyed by query, system and nixpkgs revision
+type Cache struct {
+	Dir string
+	TTL time.Duration
+	// Revision resolves a flake ref to the nixpkgs revision it currently points at.
+	// An empty revision keys the results by the ref alone, leaving expiry to the TTL.
+	Revision func(ctx context.Context, ref string) string
+
+	now func() time.Time
+	// revisions holds the revision of every ref resolved so far, so nix runs once per ref
+	mu        sync.Mutex
+	revisions map[string]string
+}
+
+// NewCache returns a cache storing its entries in dir, resolving revisions with nix run by runner
+func NewCache(dir string, ttl time.Duration, runner execx.Runner) *Cache {
+	return &Cache{Dir: dir, TTL: ttl, Revision: RevisionFunc(runner), now: time.Now}
+}
+
+// RevisionFunc returns FlakeRevision running nix with runner, for Cache.Revision and IndexStore.Revision
+func RevisionFunc(runner execx.Runner) func(ctx context.Context, ref string) string {
+	return func(ctx context.Context, ref string) string {
+		return FlakeRevision(ctx, runner, ref)
+	}
+}
+
+// FlakeRevision asks nix which revision ref is locked to, returning "" when it can't tell
+func FlakeRevision(ctx context.Context, runner execx.Runner, ref string) string {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	output, err := runner.Output(ctx, "nix", "flake", "metadata", ref, "--json")
+	if err != nil {
+		return ""
+	}
+
+	var metadata struct {
+		Revision string `json:"revision"`
+		Locked   struct {
+			Rev string `json:"rev"`
+		} `json:"locked"`
+	}
+	if err := json.Unmarshal(output, &metadata); err != nil {
+		return ""
+	}
+	if metadata.Revision != "" {
+		return metadata.Revision
+	}
+	return metadata.Locked.Rev
+}
+
+// Key identifies the results of one search
+func (c *Cache) Key(ctx context.Context, ref string, packageName string, system string) string {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	revision := c.revision(ctx, ref)
+	sum := sha256.Sum256([]byte(ref + "\x00" + revision + "\x00" + packageName + "\x00" + system))
+	return hex.EncodeToString(sum[:])
+}
+
+// revision resolves ref with Revision the first time it is asked for, a ref doesn't move
+// while pam runs
+func (c *Cache) revision(ctx context.Context, ref string) string {
+	if c.Revision == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if revision, ok := c.revisions[ref]; ok {
+		return revision
+	}
+	revision := c.Revision(ctx, ref)
+	// An interrupted lookup says nothing about the ref
+	if ctx.Err() != nil {
+		return revision
+	}
+	if c.revisions == nil {
+		c.revisions = make(map[string]string)
+	}
+	c.revisions[ref] = revision
+	return revision
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get returns the results stored under key unless they are missing, unreadable or expired
+func (c *Cache) Get(key string) (SearchResult, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if c.now().Sub(entry.Time) > c.TTL {
+		return nil, false
+	}
+	return entry.Result, true
+}
+
+// Put stores results under key
+func (c *Cache) Put(key string, result SearchResult) error {
+	err := os.MkdirAll(c.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cacheEntry{Time: c.now(), Result: result})
+	if err != nil {
+		return err
+	}
+	return fsx.WriteFileAtomic(c.path(key), data, 0o644)
+}
@@ -0,0 +1,120 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+func newTestCache(t *testing.T, revision string) (*Cache, *time.Time) {
+	t.Helper()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := &Cache{
+		Dir:      t.TempDir(),
+		TTL:      time.Hour,
+		Revision: func(context.Context, string) string { return revision },
+		now:      func() time.Time { return now },
+	}
+	return cache, &now
+}
+
+func TestCache_PutGet(t *testing.T) {
+	cache, now := newTestCache(t, "abc123")
+	result := SearchResult{
+		"legacyPackages.x86_64-linux.firefox": {PName: "firefox", Version: "120.0"},
+	}
+
+	key := cache.Key(context.Background(), DefaultRef, "firefox", "x86_64-linux")
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("Get() hit on an empty cache")
+	}
+	if err := cache.Put(key, result); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, ok := cache.Get(key)
+	if !ok {
+		t.Fatal("Get() missed after Put()")
+	}
+	if got["legacyPackages.x86_64-linux.firefox"] != (types.Package{PName: "firefox", Version: "120.0"}) {
+		t.Errorf("Get() = %v, want %v", got, result)
+	}
+
+	*now = now.Add(2 * time.Hour)
+	if _, ok := cache.Get(key); ok {
+		t.Error("Get() returned expired results")
+	}
+}
+
+func TestCache_Key(t *testing.T) {
+	cache, _ := newTestCache(t, "abc123")
+	other, _ := newTestCache(t, "def456")
+
+	base := cache.Key(context.Background(), DefaultRef, "firefox", "x86_64-linux")
+	tests := []struct {
+		name string
+		key  string
+		same bool
+	}{
+		{name: "same search", key: cache.Key(context.Background(), DefaultRef, "firefox", "x86_64-linux"), same: true},
+		{name: "empty ref is the default ref", key: cache.Key(context.Background(), "", "firefox", "x86_64-linux"), same: true},
+		{name: "different query", key: cache.Key(context.Background(), DefaultRef, "chromium", "x86_64-linux")},
+		{name: "different system", key: cache.Key(context.Background(), DefaultRef, "firefox", "aarch64-darwin")},
+		{name: "different ref", key: cache.Key(context.Background(), StableRef, "firefox", "x86_64-linux")},
+		{name: "different revision", key: other.Key(context.Background(), DefaultRef, "firefox", "x86_64-linux")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.key == base) != tt.same {
+				t.Errorf("Key() equal = %v, want %v", tt.key == base, tt.same)
+			}
+		})
+	}
+}
+
+func TestCache_KeyResolvesRevisionOnce(t *testing.T) {
+	fake := &execx.Fake{Responses: map[string]execx.Response{
+		"nix flake metadata nixpkgs --json":           {Output: `{"revision":"abc123"}`},
+		"nix flake metadata " + StableRef + " --json": {Output: `{"revision":"def456"}`},
+	}}
+	cache := NewCache(t.TempDir(), time.Hour, fake)
+
+	first := cache.Key(context.Background(), DefaultRef, "firefox", "x86_64-linux")
+	cache.Key(context.Background(), DefaultRef, "chromium", "x86_64-linux")
+	if again := cache.Key(context.Background(), "", "firefox", "x86_64-linux"); again != first {
+		t.Errorf("Key() = %s, want %s for the same search", again, first)
+	}
+	cache.Key(context.Background(), StableRef, "firefox", "x86_64-linux")
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Errorf("Key() ran %v, want nix flake metadata once per ref", calls)
+	}
+}
+
+func TestFlakeRevision(t *testing.T) {
+	tests := []struct {
+		name     string
+		response execx.Response
+		want     string
+	}{
+		{name: "revision", response: execx.Response{Output: `{"revision": "abc123", "locked": {"rev": "def456"}}`}, want: "abc123"},
+		{name: "locked rev only", response: execx.Response{Output: `{"locked": {"rev": "def456"}}`}, want: "def456"},
+		{name: "nix fails", response: execx.Response{Err: errors.New("exit status 1")}},
+		{name: "invalid JSON", response: execx.Response{Output: "error: cannot find flake"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &execx.Fake{Responses: map[string]execx.Response{"nix flake metadata nixpkgs --json": tt.response}}
+			if got := FlakeRevision(context.Background(), runner, ""); got != tt.want {
+				t.Errorf("FlakeRevision() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
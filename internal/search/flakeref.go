@@ -0,0 +1,97 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+// SplitFlakeRef splits a query naming a package of a flake, such as github:owner/repo#pkg,
+// into the flake reference and the attribute. The attribute is default when the query
+// names only the flake, and ok is false for a plain package name like ripgrep.
+func SplitFlakeRef(query string) (ref string, attr string, ok bool) {
+	ref, attr, hasAttr := strings.Cut(query, "#")
+	// Every flake reference other than a registry name has a scheme or is a path
+	if !hasAttr && !strings.Contains(ref, ":") && !strings.HasPrefix(ref, ".") && !strings.HasPrefix(ref, "/") {
+		return "", "", false
+	}
+	if ref == "" {
+		return "", "", false
+	}
+	if attr == "" {
+		attr = "default"
+	}
+	return ref, attr, true
+}
+
+// flakePackageExpr reduces a package to the fields pam records for it
+const flakePackageExpr = `pkg: {
+  pname = pkg.pname or (builtins.parseDrvName (pkg.name or "")).name;
+  version = pkg.version or "";
+  description = pkg.meta.description or "";
+}`
+
+// flakeOutputs returns the outputs attr may live in, and the attribute below the system.
+// An attribute naming its output and system, e.g. packages.x86_64-linux.hello, is taken as
+// it is, for system.
+func flakeOutputs(attr string, system string) ([]string, string, bool) {
+	for _, output := range []string{"packages", "legacyPackages"} {
+		rest, ok := strings.CutPrefix(attr, output+".")
+		if !ok {
+			continue
+		}
+		attrSystem, name, ok := strings.Cut(rest, ".")
+		if !ok || attrSystem != system {
+			return nil, "", false
+		}
+		return []string{output}, name, true
+	}
+	// Like nix build, packages is looked at before legacyPackages
+	return []string{"packages", "legacyPackages"}, attr, true
+}
+
+// FlakePackage evaluates the package attr of the flake ref for system without searching,
+// looking in the packages and then the legacyPackages output like nix build does. The
+// package's Source is left for the caller to set to the flake input referencing ref.
+func FlakePackage(ctx context.Context, runner execx.Runner, ref string, attr string, system string) (types.Package, error) {
+	outputs, name, ok := flakeOutputs(attr, system)
+	if !ok {
+		return types.Package{}, fmt.Errorf("%s#%s is not a package for %s", ref, attr, system)
+	}
+	var errs []string
+	for _, output := range outputs {
+		installable := fmt.Sprintf("%s#%s.%s.%s", ref, output, system, name)
+		data, err := runner.Output(ctx, "nix", "eval", "--json", installable, "--apply", flakePackageExpr)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		var evaluated struct {
+			PName       string `json:"pname"`
+			Version     string `json:"version"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(data, &evaluated); err != nil {
+			return types.Package{}, fmt.Errorf("reading %s: %w", installable, err)
+		}
+		pkg := types.Package{
+			// The module and the option hosts enable are named after the attribute
+			PName:       name[strings.LastIndex(name, ".")+1:],
+			Version:     evaluated.Version,
+			Description: evaluated.Description,
+			FullPath:    name,
+			System:      system,
+			Output:      output,
+		}
+		if name == "default" && evaluated.PName != "" {
+			// The default package is named after what it builds instead
+			pkg.PName = evaluated.PName
+		}
+		return pkg, nil
+	}
+	return types.Package{}, fmt.Errorf("%s has no package %s for %s: %s", ref, name, system, strings.Join(errs, "; "))
+}
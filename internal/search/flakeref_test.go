@@ -0,0 +1,72 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+func TestSplitFlakeRef(t *testing.T) {
+	tests := []struct {
+		query string
+		ref   string
+		attr  string
+		ok    bool
+	}{
+		{query: "github:owner/repo#tool", ref: "github:owner/repo", attr: "tool", ok: true},
+		{query: "github:owner/repo", ref: "github:owner/repo", attr: "default", ok: true},
+		{query: "git+ssh://git@example.com/repo#tool", ref: "git+ssh://git@example.com/repo", attr: "tool", ok: true},
+		{query: "./vendor/flake#tool", ref: "./vendor/flake", attr: "tool", ok: true},
+		{query: "nur#repos.x.tool", ref: "nur", attr: "repos.x.tool", ok: true},
+		{query: "ripgrep"},
+		{query: "firefox@119"},
+		{query: "#tool"},
+	}
+	for _, tt := range tests {
+		ref, attr, ok := SplitFlakeRef(tt.query)
+		if ref != tt.ref || attr != tt.attr || ok != tt.ok {
+			t.Errorf("SplitFlakeRef(%q) = %q, %q, %v, want %q, %q, %v", tt.query, ref, attr, ok, tt.ref, tt.attr, tt.ok)
+		}
+	}
+}
+
+func flakeEval(installable string) string {
+	return "nix eval --json " + installable + " --apply " + flakePackageExpr
+}
+
+func TestFlakePackage(t *testing.T) {
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		flakeEval("github:owner/repo#packages.x86_64-linux.tool"):       {Err: errors.New("does not provide attribute")},
+		flakeEval("github:owner/repo#legacyPackages.x86_64-linux.tool"): {Output: `{"pname": "tool-cli", "version": "1.2.0", "description": "A tool"}`},
+		flakeEval("github:owner/repo#packages.x86_64-linux.default"):    {Output: `{"pname": "repo", "version": "0.1", "description": ""}`},
+	}}
+
+	pkg, err := FlakePackage(context.Background(), runner, "github:owner/repo", "tool", "x86_64-linux")
+	if err != nil {
+		t.Fatalf("FlakePackage() error = %v", err)
+	}
+	want := types.Package{PName: "tool", Version: "1.2.0", Description: "A tool", FullPath: "tool", System: "x86_64-linux", Output: "legacyPackages"}
+	if pkg != want {
+		t.Errorf("FlakePackage() = %+v, want %+v", pkg, want)
+	}
+
+	pkg, err = FlakePackage(context.Background(), runner, "github:owner/repo", "default", "x86_64-linux")
+	if err != nil || pkg.PName != "repo" || pkg.Output != "packages" {
+		t.Errorf("FlakePackage() of the default package = %+v, %v", pkg, err)
+	}
+
+	// An attribute naming its output is only looked up there
+	pkg, err = FlakePackage(context.Background(), runner, "github:owner/repo", "packages.x86_64-linux.default", "x86_64-linux")
+	if err != nil || pkg.FullPath != "default" {
+		t.Errorf("FlakePackage() of a full attribute = %+v, %v", pkg, err)
+	}
+	if _, err := FlakePackage(context.Background(), runner, "github:owner/repo", "packages.aarch64-darwin.default", "x86_64-linux"); err == nil {
+		t.Error("FlakePackage() of another system's attribute should fail")
+	}
+	if _, err := FlakePackage(context.Background(), runner, "github:owner/repo", "missing", "x86_64-linux"); err == nil {
+		t.Error("FlakePackage() of a missing package should fail")
+	}
+}
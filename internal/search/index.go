@@ -0,0 +1,164 @@
+package search
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pam/internal/execx"
+	"pam/internal/fsx"
+)
+
+// DefaultIndexTTL is how long an index is trusted when the revision of its ref can't be resolved
+const DefaultIndexTTL = 7 * 24 * time.Hour
+
+// indexLimit caps the results an index search returns, like the output of a narrow nix search
+const indexLimit = 100
+
+// Index holds every package of a flake for one system, so searches run offline
+type Index struct {
+	Ref      string    `json:"ref"`
+	System   string    `json:"system"`
+	Revision string    `json:"revision"`
+	Built    time.Time `json:"built"`
+	// Packages is the output of `nix search <ref> ^ --json`
+	Packages SearchResult `json:"packages"`
+}
+
+// IndexStore keeps indexes on disk, one per flake ref and system
+type IndexStore struct {
+	Dir string
+	TTL time.Duration
+	// Runner runs the nix search dumping the packages
+	Runner execx.Runner
+	// Revision resolves a flake ref to the revision it currently points at, "" when unknown
+	Revision func(ctx context.Context, ref string) string
+
+	now func() time.Time
+}
+
+// NewIndexStore returns a store keeping its indexes in dir, running nix with runner
+func NewIndexStore(dir string, runner execx.Runner) *IndexStore {
+	return &IndexStore{Dir: dir, TTL: DefaultIndexTTL, Runner: runner, Revision: RevisionFunc(runner), now: time.Now}
+}
+
+func (s *IndexStore) path(ref string, system string) string {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	sum := sha256.Sum256([]byte(ref + "\x00" + system))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json.gz")
+}
+
+// Build dumps every package of ref for system with nix search and saves the index
+func (s *IndexStore) Build(ctx context.Context, ref string, system string) (*Index, error) {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	output, err := s.Runner.Output(ctx, "nix", SearchArgs(ref, "^", system)...)
+	if err != nil {
+		return nil, fmt.Errorf("dumping %s: %w", ref, err)
+	}
+	index := &Index{Ref: ref, System: system, Built: s.now()}
+	err = json.Unmarshal(output, &index.Packages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if s.Revision != nil {
+		index.Revision = s.Revision(ctx, ref)
+	}
+	return index, s.Save(index)
+}
+
+// Save writes the index compressed, replacing the previous one of its ref and system
+func (s *IndexStore) Save(index *Index) error {
+	err := os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+	return fsx.WriteAtomic(s.path(index.Ref, index.System), 0o644, func(w io.Writer) error {
+		writer := gzip.NewWriter(w)
+		if err := json.NewEncoder(writer).Encode(index); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+}
+
+// Load reads the index of ref and system, reporting false when there is none
+func (s *IndexStore) Load(ref string, system string) (*Index, bool, error) {
+	file, err := os.Open(s.path(ref, system))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading index: %w", err)
+	}
+	var index Index
+	err = json.NewDecoder(reader).Decode(&index)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading index: %w", err)
+	}
+	return &index, true, nil
+}
+
+// Stale reports whether the ref moved to another revision since the index was built, or
+// when the revision can't be resolved, whether the index is older than the TTL
+func (s *IndexStore) Stale(ctx context.Context, index *Index) bool {
+	revision := ""
+	if s.Revision != nil {
+		revision = s.Revision(ctx, index.Ref)
+	}
+	if revision != "" && index.Revision != "" {
+		return revision != index.Revision
+	}
+	return s.now().Sub(index.Built) > s.TTL
+}
+
+// Search returns the packages matching query, the best ranked ones when there are many
+func (ix *Index) Search(query string) SearchResult {
+	var matches []scored
+	keys := map[string]string{}
+	for key, pkg := range ix.Packages {
+		// Rank by the attribute path like FilterAndPrioritizePackages, not the
+		// legacyPackages.<system> prefix every key shares
+		pkg.FullPath = attributePath(key)
+		if score := Score(pkg, query); score > 0 {
+			matches = append(matches, scored{pkg: pkg, score: score, likelihood: likelihood(pkg)})
+			keys[pkg.FullPath] = key
+		}
+	}
+	slices.SortFunc(matches, compareScored)
+
+	result := SearchResult{}
+	for _, match := range matches[:min(len(matches), indexLimit)] {
+		key := keys[match.pkg.FullPath]
+		result[key] = ix.Packages[key]
+	}
+	return result
+}
+
+// attributePath strips the output and system from a key of nix search, e.g.
+// legacyPackages.x86_64-linux.python3Packages.numpy becomes python3Packages.numpy
+func attributePath(key string) string {
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) < 3 {
+		return key
+	}
+	return parts[2]
+}
@@ -0,0 +1,133 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+func newTestIndexStore(t *testing.T, revision string) (*IndexStore, *time.Time) {
+	t.Helper()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &IndexStore{
+		Dir:      t.TempDir(),
+		TTL:      time.Hour,
+		Revision: func(context.Context, string) string { return revision },
+		now:      func() time.Time { return now },
+	}
+	return store, &now
+}
+
+func TestIndexStore_SaveLoad(t *testing.T) {
+	store, now := newTestIndexStore(t, "abc123")
+	index := &Index{Ref: DefaultRef, System: "x86_64-linux", Revision: "abc123", Built: *now, Packages: SearchResult{
+		"legacyPackages.x86_64-linux.ripgrep": {PName: "ripgrep", Version: "14.1.0"},
+	}}
+
+	if _, ok, err := store.Load(DefaultRef, "x86_64-linux"); ok || err != nil {
+		t.Fatalf("Load() on an empty store = %v, %v", ok, err)
+	}
+	if err := store.Save(index); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, ok, err := store.Load(DefaultRef, "x86_64-linux")
+	if err != nil || !ok {
+		t.Fatalf("Load() = %v, %v", ok, err)
+	}
+	if got.Packages["legacyPackages.x86_64-linux.ripgrep"] != (types.Package{PName: "ripgrep", Version: "14.1.0"}) {
+		t.Errorf("Load() packages = %v", got.Packages)
+	}
+	if _, ok, _ := store.Load(DefaultRef, "aarch64-darwin"); ok {
+		t.Error("Load() returned the index of another system")
+	}
+}
+
+func TestIndexStore_Build(t *testing.T) {
+	store, _ := newTestIndexStore(t, "abc123")
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"nix search nixpkgs ^ --json --system x86_64-linux": {Output: `{"legacyPackages.x86_64-linux.ripgrep": {"pname": "ripgrep", "version": "14.1.0"}}`},
+	}}
+	store.Runner = runner
+
+	index, err := store.Build(context.Background(), "", "x86_64-linux")
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if index.Ref != DefaultRef || index.Revision != "abc123" || len(index.Packages) != 1 {
+		t.Errorf("Build() = %+v", index)
+	}
+	if _, ok, err := store.Load(DefaultRef, "x86_64-linux"); !ok || err != nil {
+		t.Errorf("Load() after Build() = %v, %v", ok, err)
+	}
+
+	if _, err := store.Build(context.Background(), "", "aarch64-darwin"); err == nil {
+		t.Error("Build() expected error when nix search fails")
+	}
+}
+
+func TestIndexStore_Stale(t *testing.T) {
+	built := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		revision string
+		indexRev string
+		age      time.Duration
+		want     bool
+	}{
+		{"same revision", "abc", "abc", 48 * time.Hour, false},
+		{"ref moved", "def", "abc", time.Minute, true},
+		{"unknown revision, recent", "", "abc", time.Minute, false},
+		{"unknown revision, old", "", "abc", 2 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, now := newTestIndexStore(t, tt.revision)
+			*now = built.Add(tt.age)
+			index := &Index{Ref: DefaultRef, Revision: tt.indexRev, Built: built}
+			if got := store.Stale(context.Background(), index); got != tt.want {
+				t.Errorf("Stale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	index := &Index{Packages: SearchResult{
+		"legacyPackages.x86_64-linux.ripgrep":     {PName: "ripgrep", Description: "grep replacement"},
+		"legacyPackages.x86_64-linux.ripgrep-all": {PName: "ripgrep-all", Description: "ripgrep for PDFs"},
+		"legacyPackages.x86_64-linux.firefox":     {PName: "firefox", Description: "Web browser"},
+	}}
+
+	got := index.Search("ripgrp")
+	if len(got) != 2 {
+		t.Fatalf("Search() = %v, want ripgrep and ripgrep-all", got)
+	}
+	if _, ok := got["legacyPackages.x86_64-linux.firefox"]; ok {
+		t.Error("Search() matched firefox")
+	}
+	if len(index.Search("browser")) != 1 {
+		t.Error("Search() missed the description match")
+	}
+}
+
+func TestIndex_SearchRanksAttributePaths(t *testing.T) {
+	index := &Index{Packages: SearchResult{
+		"legacyPackages.x86_64-linux.yt-dlp": {PName: "yt-dlp"},
+	}}
+	// More equally good matches in package sets than the index returns
+	for i := range indexLimit {
+		index.Packages[fmt.Sprintf("legacyPackages.x86_64-linux.set%d.yt-dlp", i)] = types.Package{PName: "yt-dlp"}
+	}
+
+	got := index.Search("yt-dlp")
+	if len(got) != indexLimit {
+		t.Fatalf("Search() returned %d packages, want %d", len(got), indexLimit)
+	}
+	if _, ok := got["legacyPackages.x86_64-linux.yt-dlp"]; !ok {
+		t.Error("Search() left out the top-level package for ones in package sets")
+	}
+}
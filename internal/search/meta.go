@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+// Meta holds the package metadata nix search leaves out
+type Meta struct {
+	// Version is the package's version, which nix search leaves empty for some packages
+	Version         string   `json:"version"`
+	Homepage        string   `json:"homepage"`
+	Licenses        []string `json:"licenses"`
+	LongDescription string   `json:"longDescription"`
+	// Maintainers are GitHub handles, or names for maintainers without one
+	Maintainers []string `json:"maintainers"`
+	// Platforms are the systems the package builds on, e.g. x86_64-linux
+	Platforms []string `json:"platforms"`
+	// MainProgram is the binary nix run starts
+	MainProgram string `json:"mainProgram"`
+	Broken      bool   `json:"broken"`
+	// Unfree is set when one of the licenses is not free, nix refuses to build the package
+	// without allowUnfree
+	Unfree bool `json:"unfree"`
+	// KnownVulnerabilities mark the package insecure, nix refuses to build it without
+	// permittedInsecurePackages
+	KnownVulnerabilities []string `json:"knownVulnerabilities"`
+}
+
+// metaExpr reduces a package to its version and the meta fields pam shows. license may be
+// a single license or a list, and each one a license attrset or a plain string. Platform
+// patterns given as attrsets are left out.
+const metaExpr = `pkg: let
+  meta = pkg.meta or { };
+  licenses = if builtins.isList (meta.license or [ ]) then meta.license or [ ] else [ meta.license ];
+in {
+  version = pkg.version or "";
+  homepage = meta.homepage or "";
+  licenses = map (l: if builtins.isAttrs l then l.spdxId or l.shortName or "unknown" else toString l) licenses;
+  unfree = builtins.any (l: builtins.isAttrs l && !(l.free or true)) licenses;
+  longDescription = meta.longDescription or "";
+  maintainers = map (m: m.github or m.name or "unknown") (meta.maintainers or [ ]);
+  platforms = builtins.filter builtins.isString (meta.platforms or [ ]);
+  mainProgram = meta.mainProgram or "";
+  broken = meta.broken or false;
+  knownVulnerabilities = meta.knownVulnerabilities or [ ];
+}`
+
+// Warnings describe why installing the package on systems may fail: it is marked broken,
+// insecure, or its platforms leave some of the systems out
+func (m Meta) Warnings(systems []string) []string {
+	var warnings []string
+	if m.Broken {
+		warnings = append(warnings, "is marked broken")
+	}
+	if len(m.KnownVulnerabilities) > 0 {
+		warnings = append(warnings, fmt.Sprintf("is marked insecure: %s", strings.Join(m.KnownVulnerabilities, "; ")))
+	}
+	var unsupported []string
+	for _, system := range systems {
+		if len(m.Platforms) > 0 && !slices.Contains(m.Platforms, system) {
+			unsupported = append(unsupported, system)
+		}
+	}
+	if len(unsupported) > 0 {
+		warnings = append(warnings, fmt.Sprintf("is not supported on %s", strings.Join(unsupported, ", ")))
+	}
+	return warnings
+}
+
+func metaArgs(ref string, pkg types.Package) []string {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	output := pkg.Output
+	if output == "" {
+		output = "legacyPackages"
+	}
+	// A package found for several systems has the same meta on each
+	system := pkg.System
+	if systems := pkg.Systems(); len(systems) > 0 {
+		system = systems[0]
+	}
+	return []string{"eval", "--json", fmt.Sprintf("%s#%s.%s.%s", ref, output, system, pkg.FullPath), "--apply", metaExpr}
+}
+
+// FetchMeta evaluates the version and meta of a package found in the flake ref
+func FetchMeta(ctx context.Context, runner execx.Runner, ref string, pkg types.Package) (Meta, error) {
+	output, err := runner.Output(ctx, "nix", metaArgs(ref, pkg)...)
+	if err != nil {
+		return Meta{}, fmt.Errorf("evaluating meta of %s: %w", pkg.FullPath, err)
+	}
+	var meta Meta
+	err = json.Unmarshal(output, &meta)
+	if err != nil {
+		return Meta{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+func TestMetaArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  string
+		pkg  types.Package
+		want string
+	}{
+		{
+			name: "default ref",
+			pkg:  types.Package{FullPath: "firefox", System: "x86_64-linux"},
+			want: "nixpkgs#legacyPackages.x86_64-linux.firefox",
+		},
+		{
+			name: "nested attr",
+			ref:  StableRef,
+			pkg:  types.Package{FullPath: "python3Packages.numpy", System: "aarch64-darwin", Output: "legacyPackages"},
+			want: StableRef + "#legacyPackages.aarch64-darwin.python3Packages.numpy",
+		},
+		{
+			name: "several systems",
+			pkg:  types.Package{FullPath: "firefox", System: "x86_64-linux,aarch64-darwin"},
+			want: "nixpkgs#legacyPackages.x86_64-linux.firefox",
+		},
+		{
+			name: "flake packages output",
+			ref:  "github:nix-community/emacs-overlay",
+			pkg:  types.Package{FullPath: "emacs-git", System: "x86_64-linux", Output: "packages"},
+			want: "github:nix-community/emacs-overlay#packages.x86_64-linux.emacs-git",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := metaArgs(tt.ref, tt.pkg)
+			if len(got) != 5 || got[0] != "eval" || got[1] != "--json" || got[3] != "--apply" {
+				t.Fatalf("metaArgs() = %v", got)
+			}
+			if got[2] != tt.want {
+				t.Errorf("metaArgs() installable = %q, want %q", got[2], tt.want)
+			}
+		})
+	}
+}
+
+func TestMeta_Warnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		meta    Meta
+		systems []string
+		want    []string
+	}{
+		{name: "fine", meta: Meta{Platforms: []string{"x86_64-linux"}}, systems: []string{"x86_64-linux"}},
+		{name: "no platforms", meta: Meta{}, systems: []string{"x86_64-linux"}},
+		{name: "broken", meta: Meta{Broken: true}, systems: []string{"x86_64-linux"}, want: []string{"is marked broken"}},
+		{
+			name:    "insecure",
+			meta:    Meta{KnownVulnerabilities: []string{"CVE-2023-1", "CVE-2023-2"}},
+			systems: []string{"x86_64-linux"},
+			want:    []string{"is marked insecure: CVE-2023-1; CVE-2023-2"},
+		},
+		{
+			name:    "other platform",
+			meta:    Meta{Platforms: []string{"x86_64-linux"}},
+			systems: []string{"x86_64-linux", "aarch64-darwin", "aarch64-linux"},
+			want:    []string{"is not supported on aarch64-darwin, aarch64-linux"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.meta.Warnings(tt.systems); !slices.Equal(got, tt.want) {
+				t.Errorf("Warnings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchMeta_Unfree(t *testing.T) {
+	fake := &execx.Fake{Responses: map[string]execx.Response{
+		"nix": {Output: `{"version":"1.96.0","licenses":["unfree"],"unfree":true,"broken":false}`},
+	}}
+	meta, err := FetchMeta(context.Background(), fake, "", types.Package{FullPath: "vscode", System: "x86_64-linux"})
+	if err != nil {
+		t.Fatalf("FetchMeta() error = %v", err)
+	}
+	if !meta.Unfree || meta.Version != "1.96.0" {
+		t.Errorf("FetchMeta() = %+v, want an unfree 1.96.0", meta)
+	}
+}
@@ -0,0 +1,156 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pam/internal/execx"
+	"pam/internal/types"
+)
+
+// NixhubURL resolves package versions to nixpkgs revisions, it is the API behind nixhub.io
+const NixhubURL = "https://search.devbox.sh/v2/resolve"
+
+// pinPrefix starts the name of every flake input pam adds for a pinned version
+const pinPrefix = "nixpkgs-pin-"
+
+// SplitVersion splits a query such as firefox@119 into the package name and the version,
+// which is empty when the query doesn't ask for one
+func SplitVersion(query string) (name string, version string) {
+	name, version, _ = strings.Cut(query, "@")
+	return name, version
+}
+
+// IsPinInput reports whether the flake input was added for a pinned version
+func IsPinInput(input string) bool {
+	return strings.HasPrefix(input, pinPrefix)
+}
+
+// Pin is a package version found in a past nixpkgs revision
+type Pin struct {
+	Name string
+	// Requested is the version asked for, e.g. 119
+	Requested string
+	// Version is the version found, e.g. 119.0.1
+	Version string
+	// Attr is the attribute path of the package in the revision
+	Attr string
+	Rev  string
+}
+
+// Source returns the flake input modules take the pinned package from, e.g.
+// nixpkgs-pin-firefox-119
+func (p Pin) Source() Source {
+	name := pinPrefix + p.Name + "-" + p.Requested
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, name)
+	return Source{Name: name, Ref: "github:NixOS/nixpkgs/" + p.Rev, Pinned: true}
+}
+
+// Package returns the pinned package built for system, referenced through Source
+func (p Pin) Package(system string) types.Package {
+	return types.Package{
+		PName:    p.Name,
+		Version:  p.Version,
+		FullPath: p.Attr,
+		System:   system,
+		Output:   "legacyPackages",
+		Source:   p.Source().Name,
+	}
+}
+
+// versionMatches reports whether version is the one requested or one of its releases,
+// e.g. 119.0.1 for 119
+func versionMatches(version string, requested string) bool {
+	return version == requested || strings.HasPrefix(version, requested+".") || strings.HasPrefix(version, requested+"-")
+}
+
+// PinResolver finds the nixpkgs revision holding a package version
+type PinResolver struct {
+	// Revisions are nixpkgs commits looked through first, in order
+	Revisions []string
+	// Runner evaluates the package version of each revision
+	Runner execx.Runner
+	// URL is asked when none of the revisions has the version, empty to not ask
+	URL    string
+	Client *http.Client
+}
+
+// nixhubResult is the part of a nixhub answer pam uses
+type nixhubResult struct {
+	Version string `json:"version"`
+	Systems map[string]struct {
+		FlakeInstallable struct {
+			Ref struct {
+				Rev string `json:"rev"`
+			} `json:"ref"`
+			AttrPath string `json:"attr_path"`
+		} `json:"flake_installable"`
+	} `json:"systems"`
+}
+
+// Resolve finds version of the package name built for system
+func (r *PinResolver) Resolve(ctx context.Context, name string, version string, system string) (Pin, error) {
+	for _, rev := range r.Revisions {
+		ref := "github:NixOS/nixpkgs/" + rev
+		output, err := r.Runner.Output(ctx, "nix", "eval", "--raw", fmt.Sprintf("%s#legacyPackages.%s.%s.version", ref, system, name))
+		if err != nil {
+			// The package may not exist in this revision
+			continue
+		}
+		if found := strings.TrimSpace(string(output)); versionMatches(found, version) {
+			return Pin{Name: name, Requested: version, Version: found, Attr: name, Rev: rev}, nil
+		}
+	}
+	if r.URL == "" {
+		return Pin{}, fmt.Errorf("none of the nixpkgs revisions in the config has %s %s", name, version)
+	}
+	return r.fromNixhub(ctx, name, version, system)
+}
+
+func (r *PinResolver) fromNixhub(ctx context.Context, name string, version string, system string) (Pin, error) {
+	query := url.Values{"name": {name}, "version": {version}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+"?"+query.Encode(), nil)
+	if err != nil {
+		return Pin{}, err
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return Pin{}, fmt.Errorf("looking up %s %s on nixhub: %w", name, version, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return Pin{}, fmt.Errorf("nixhub knows no version %s of %s", version, name)
+	}
+	if response.StatusCode != http.StatusOK {
+		return Pin{}, fmt.Errorf("looking up %s %s on nixhub: %s", name, version, response.Status)
+	}
+
+	var result nixhubResult
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return Pin{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	found, ok := result.Systems[system]
+	if !ok || found.FlakeInstallable.Ref.Rev == "" {
+		return Pin{}, fmt.Errorf("nixhub has no build of %s %s for %s", name, result.Version, system)
+	}
+	attr := found.FlakeInstallable.AttrPath
+	if attr == "" {
+		attr = name
+	}
+	return Pin{Name: name, Requested: version, Version: result.Version, Attr: attr, Rev: found.FlakeInstallable.Ref.Rev}, nil
+}
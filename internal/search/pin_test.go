@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		query       string
+		wantName    string
+		wantVersion string
+	}{
+		{query: "firefox@119", wantName: "firefox", wantVersion: "119"},
+		{query: "python3Packages.numpy@1.26.4", wantName: "python3Packages.numpy", wantVersion: "1.26.4"},
+		{query: "firefox", wantName: "firefox"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			name, version := SplitVersion(tt.query)
+			if name != tt.wantName || version != tt.wantVersion {
+				t.Errorf("SplitVersion() = %q, %q, want %q, %q", name, version, tt.wantName, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestPin_Source(t *testing.T) {
+	pin := Pin{Name: "python3Packages.numpy", Requested: "1.26", Version: "1.26.4", Attr: "python3Packages.numpy", Rev: "abc123"}
+	source := pin.Source()
+	want := Source{Name: "nixpkgs-pin-python3Packages-numpy-1-26", Ref: "github:NixOS/nixpkgs/abc123", Pinned: true}
+	if source != want {
+		t.Errorf("Source() = %+v, want %+v", source, want)
+	}
+	if !IsPinInput(source.Name) || IsPinInput("nixpkgs-stable") {
+		t.Error("IsPinInput() does not tell pinned inputs apart")
+	}
+
+	pkg := pin.Package("x86_64-linux")
+	if pkg.Source != source.Name || pkg.Output != "legacyPackages" || pkg.Version != "1.26.4" || pkg.PName != "python3Packages.numpy" {
+		t.Errorf("Package() = %+v", pkg)
+	}
+}
+
+func TestPinResolver_Revisions(t *testing.T) {
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"nix eval --raw github:NixOS/nixpkgs/old#legacyPackages.x86_64-linux.firefox.version": {Output: "115.0"},
+		"nix eval --raw github:NixOS/nixpkgs/new#legacyPackages.x86_64-linux.firefox.version": {Output: "119.0.1"},
+	}}
+	resolver := &PinResolver{Revisions: []string{"old", "new"}, Runner: runner}
+
+	pin, err := resolver.Resolve(context.Background(), "firefox", "119", "x86_64-linux")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if pin.Rev != "new" || pin.Version != "119.0.1" || pin.Attr != "firefox" {
+		t.Errorf("Resolve() = %+v, want firefox 119.0.1 from new", pin)
+	}
+
+	// 11 is not 115
+	if _, err := resolver.Resolve(context.Background(), "firefox", "11", "x86_64-linux"); err == nil {
+		t.Error("Resolve() found firefox 11 without asking nixhub")
+	}
+}
+
+func TestPinResolver_Nixhub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "go" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name":"go","version":"1.21.13","systems":{"x86_64-linux":{"flake_installable":{"ref":{"type":"github","owner":"NixOS","repo":"nixpkgs","rev":"deadbeef"},"attr_path":"go_1_21"}}}}`))
+	}))
+	defer server.Close()
+	resolver := &PinResolver{Runner: &execx.Fake{}, URL: server.URL, Client: server.Client()}
+
+	tests := []struct {
+		name    string
+		pkg     string
+		system  string
+		want    Pin
+		wantErr bool
+	}{
+		{name: "found", pkg: "go", system: "x86_64-linux", want: Pin{Name: "go", Requested: "1.21", Version: "1.21.13", Attr: "go_1_21", Rev: "deadbeef"}},
+		{name: "other system", pkg: "go", system: "aarch64-darwin", wantErr: true},
+		{name: "unknown", pkg: "nope", system: "x86_64-linux", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.pkg, "1.21", tt.system)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package search
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"pam/internal/types"
+)
+
+// Scores of the ways a package can match a query, higher ranks first
+const (
+	scoreExact       = 100
+	scorePrefix      = 80
+	scoreSubstring   = 60
+	scoreFuzzy       = 40
+	scoreDescription = 20
+)
+
+// Score rates how well the package matches query: an exact pname beats a prefix, which
+// beats a substring, letters in order and finally a match in the description. The last
+// element of the attribute path counts like the pname. Zero means no match.
+func Score(pkg types.Package, query string) int {
+	query = strings.ToLower(query)
+	names := []string{strings.ToLower(pkg.PName)}
+	if attr := pkg.FullPath; attr != "" {
+		names = append(names, strings.ToLower(attr[strings.LastIndex(attr, ".")+1:]))
+	}
+
+	best := 0
+	for _, name := range names {
+		switch {
+		case name == query:
+			best = max(best, scoreExact)
+		case strings.HasPrefix(name, query):
+			best = max(best, scorePrefix)
+		case strings.Contains(name, query):
+			best = max(best, scoreSubstring)
+		case subsequence(name, query):
+			best = max(best, scoreFuzzy)
+		}
+	}
+	if best == 0 && strings.Contains(strings.ToLower(pkg.Description), query) {
+		best = scoreDescription
+	}
+	return best
+}
+
+// subsequence reports whether the letters of query appear in name in order, e.g. rg in ripgrep
+func subsequence(name string, query string) bool {
+	if query == "" {
+		return false
+	}
+	rest := query
+	for _, r := range name {
+		if r == rune(rest[0]) {
+			rest = rest[1:]
+			if rest == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Popularity counts how often packages are installed, by attribute path or pname, e.g.
+// from the nixpkgs usage statistics. It breaks ties between packages matching equally well.
+type Popularity map[string]int
+
+// LoadPopularity reads popularity data from a JSON object of counts such as {"firefox": 9120}
+func LoadPopularity(path string) (Popularity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var popularity Popularity
+	err = json.Unmarshal(data, &popularity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse popularity data %s: %w", path, err)
+	}
+	return popularity, nil
+}
+
+// Of returns the count of pkg, looked up by attribute path and then by pname
+func (p Popularity) Of(pkg types.Package) int {
+	if count, ok := p[pkg.FullPath]; ok && pkg.FullPath != "" {
+		return count
+	}
+	return p[pkg.PName]
+}
+
+// variantSuffixes mark builds of a package that are rarely the one meant, such as
+// firefox-unwrapped or discord-canary
+var variantSuffixes = []string{"-unwrapped", "-bin", "-git", "-nightly", "-beta", "-canary", "-unstable"}
+
+// likelihood guesses how commonly pkg is installed from its attribute alone, for when
+// there is no popularity data or it doesn't know either package: top-level packages
+// before ones in a package set like python3Packages, and plain builds before variants
+func likelihood(pkg types.Package) int {
+	likely := 0
+	if !strings.Contains(pkg.FullPath, ".") {
+		likely += 2
+	}
+	if !slices.ContainsFunc(variantSuffixes, func(suffix string) bool {
+		return strings.HasSuffix(pkg.PName, suffix)
+	}) {
+		likely++
+	}
+	return likely
+}
+
+type scored struct {
+	pkg        types.Package
+	score      int
+	popularity int
+	likelihood int
+}
+
+// compareScored orders by score, then popularity, then likelihood, then shorter pnames,
+// then attribute path. Packages that don't match at all are equal, so a stable sort
+// keeps their order.
+func compareScored(a, b scored) int {
+	if a.score == 0 && b.score == 0 {
+		return 0
+	}
+	return cmp.Or(
+		cmp.Compare(b.score, a.score),
+		cmp.Compare(b.popularity, a.popularity),
+		cmp.Compare(b.likelihood, a.likelihood),
+		cmp.Compare(len(a.pkg.PName), len(b.pkg.PName)),
+		strings.Compare(a.pkg.FullPath, b.pkg.FullPath),
+	)
+}
+
+// Rank sorts packages by how well they match query, see Score. Packages that don't match
+// at all, e.g. found by nix search through a regular expression, come last in their original order.
+func Rank(packages []types.Package, query string) []types.Package {
+	return RankBy(packages, query, nil)
+}
+
+// RankBy sorts packages like Rank, putting the more popular of equally good matches
+// first. Without popularity, or for packages it doesn't count, top-level packages and
+// plain builds come before package sets and variants, see likelihood.
+func RankBy(packages []types.Package, query string, popularity Popularity) []types.Package {
+	matches := make([]scored, len(packages))
+	for i, pkg := range packages {
+		matches[i] = scored{pkg, Score(pkg, query), popularity.Of(pkg), likelihood(pkg)}
+	}
+	slices.SortStableFunc(matches, compareScored)
+
+	ranked := make([]types.Package, len(matches))
+	for i, match := range matches {
+		ranked[i] = match.pkg
+	}
+	return ranked
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pam/internal/types"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		pkg   types.Package
+		query string
+		want  int
+	}{
+		{"exact pname", types.Package{PName: "ripgrep"}, "ripgrep", scoreExact},
+		{"case insensitive", types.Package{PName: "Firefox"}, "firefox", scoreExact},
+		{"exact attribute", types.Package{PName: "python3.12-numpy", FullPath: "python3Packages.numpy"}, "numpy", scoreExact},
+		{"prefix", types.Package{PName: "firefox-esr"}, "firefox", scorePrefix},
+		{"substring", types.Package{PName: "librewolf-bin"}, "wolf", scoreSubstring},
+		{"letters in order", types.Package{PName: "ripgrep"}, "rpg", scoreFuzzy},
+		{"description", types.Package{PName: "fd", Description: "A simple, fast alternative to find"}, "find", scoreDescription},
+		{"no match", types.Package{PName: "fd", Description: "Fast"}, "zzz", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Score(tt.pkg, tt.query); got != tt.want {
+				t.Errorf("Score() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	packages := []types.Package{
+		{PName: "unrelated", Description: "matched by a regex"},
+		{PName: "git-doc", Description: "docs"},
+		{PName: "gitui", Description: "git tui"},
+		{PName: "git"},
+		{PName: "lazygit"},
+		{PName: "tig", Description: "text-mode interface for git"},
+	}
+
+	got := Rank(packages, "git")
+	want := []string{"git", "gitui", "git-doc", "lazygit", "tig", "unrelated"}
+	for i, pkg := range got {
+		if pkg.PName != want[i] {
+			t.Fatalf("Rank() order = %v, want %v", names(got), want)
+		}
+	}
+}
+
+func TestRank_NoMatchKeepsOrder(t *testing.T) {
+	packages := []types.Package{
+		{PName: "zoxide-unwrapped", FullPath: "python3Packages.zoxide-unwrapped", Description: "matched by a regex"},
+		{PName: "git"},
+		{PName: "fd", FullPath: "fd", Description: "matched by a regex too"},
+	}
+	popularity := Popularity{"fd": 9000}
+
+	got := RankBy(packages, "git", popularity)
+	// Popularity, likelihood and length would all put fd first among the non-matches
+	want := []string{"git", "zoxide-unwrapped", "fd"}
+	for i, pkg := range got {
+		if pkg.PName != want[i] {
+			t.Fatalf("RankBy() order = %v, want %v", names(got), want)
+		}
+	}
+}
+
+func TestRank_Default(t *testing.T) {
+	packages := []types.Package{
+		{PName: "firefox-unwrapped", FullPath: "firefox-unwrapped"},
+		{PName: "yt-dlp", FullPath: "python3Packages.yt-dlp"},
+		{PName: "firefox-bin", FullPath: "firefox-bin"},
+		{PName: "yt-dlp", FullPath: "yt-dlp"},
+		{PName: "firefox-esr", FullPath: "firefox-esr"},
+		{PName: "firefox", FullPath: "firefox"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Plain builds before variants among the prefix matches
+		{query: "firefox", want: []string{"firefox", "firefox-esr", "firefox-bin", "firefox-unwrapped"}},
+		// The top-level package before the one in a package set
+		{query: "yt-dlp", want: []string{"yt-dlp", "python3Packages.yt-dlp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := Rank(packages, tt.query)
+			for i, want := range tt.want {
+				if got[i].FullPath != want {
+					t.Fatalf("Rank() order = %v, want %v first", attrs(got), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRankBy_Popularity(t *testing.T) {
+	packages := []types.Package{
+		{PName: "vim", FullPath: "vim"},
+		{PName: "vim-full", FullPath: "vim-full"},
+		{PName: "vimb", FullPath: "vimb"},
+		{PName: "neovim", FullPath: "neovim"},
+	}
+	popularity := Popularity{"vimb": 5, "vim-full": 300, "neovim": 9000}
+
+	got := RankBy(packages, "vim", popularity)
+	// Popularity orders the prefix matches but never lifts a weaker match above them
+	want := []string{"vim", "vim-full", "vimb", "neovim"}
+	for i, pkg := range got {
+		if pkg.PName != want[i] {
+			t.Fatalf("RankBy() order = %v, want %v", names(got), want)
+		}
+	}
+}
+
+func TestLoadPopularity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "popularity.json")
+	if err := os.WriteFile(path, []byte(`{"firefox": 12, "python3Packages.numpy": 7}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	popularity, err := LoadPopularity(path)
+	if err != nil {
+		t.Fatalf("LoadPopularity() error = %v", err)
+	}
+	if got := popularity.Of(types.Package{PName: "firefox", FullPath: "firefox-esr"}); got != 12 {
+		t.Errorf("Of() by pname = %d, want 12", got)
+	}
+	if got := popularity.Of(types.Package{PName: "python3.12-numpy", FullPath: "python3Packages.numpy"}); got != 7 {
+		t.Errorf("Of() by attribute = %d, want 7", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPopularity(path); err == nil {
+		t.Error("LoadPopularity() of invalid data succeeded")
+	}
+}
+
+func names(packages []types.Package) []string {
+	result := make([]string, len(packages))
+	for i, pkg := range packages {
+		result[i] = pkg.PName
+	}
+	return result
+}
+
+func attrs(packages []types.Package) []string {
+	result := make([]string, len(packages))
+	for i, pkg := range packages {
+		result[i] = pkg.FullPath
+	}
+	return result
+}
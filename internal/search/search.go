@@ -1,31 +1,128 @@
 package search
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"maps"
+	"slices"
 	"strings"
 
+	"pam/internal/execx"
 	"pam/internal/types"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type SearchResult map[string]types.Package
 
-func SearchPackages(packageName string, system string) (SearchResult, error) {
-	args := []string{"search", "nixpkgs", packageName, "--json"}
+const (
+	// DefaultRef is the flake registry entry used when no branch or ref is configured
+	DefaultRef = "nixpkgs"
+	// UnstableRef points at the rolling nixpkgs branch
+	UnstableRef = "github:NixOS/nixpkgs/nixos-unstable"
+	// StableRef points at the current stable NixOS release branch
+	StableRef = "github:NixOS/nixpkgs/nixos-26.05"
+)
+
+// BranchRef maps a branch name (stable or unstable) to the flake reference passed to nix search
+func BranchRef(branch string) (string, error) {
+	switch branch {
+	case "stable":
+		return StableRef, nil
+	case "unstable":
+		return UnstableRef, nil
+	default:
+		return "", fmt.Errorf("unknown branch '%s', expected stable or unstable", branch)
+	}
+}
+
+// OtherBranch returns the branch to offer when the results of the given branch are unsatisfying.
+// The registry default (empty branch) tracks unstable, so stable is offered for it.
+func OtherBranch(branch string) string {
+	if branch == "stable" {
+		return "unstable"
+	}
+	return "stable"
+}
+
+// SearchArgs are the arguments of the nix search for packageName in ref
+func SearchArgs(ref string, packageName string, system string) []string {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	args := []string{"search", ref, packageName, "--json"}
 
 	if system != "" {
 		args = append(args, "--system", system)
 	}
+	return args
+}
+
+// SearchError is returned when nix search fails or its output can't be read
+type SearchError struct {
+	Ref   string
+	Query string
+	Err   error
+}
 
-	cmd := exec.Command("nix", args...)
-	output, err := cmd.Output()
+func (e *SearchError) Error() string {
+	return fmt.Sprintf("Search failed: %v", e.Err)
+}
+
+func (e *SearchError) Unwrap() error {
+	return e.Err
+}
+
+func SearchPackages(ctx context.Context, runner execx.Runner, ref string, packageName string, system string) (SearchResult, error) {
+	output, err := runner.Output(ctx, "nix", SearchArgs(ref, packageName, system)...)
+	if ctx.Err() != nil {
+		// Cancelled with Ctrl-C, there is nothing to report
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, &SearchError{Ref: ref, Query: packageName, Err: err}
+	}
+	result, err := ParseResult(output)
 	if err != nil {
-		fmt.Println("Error: ", err)
-		return nil, fmt.Errorf("Search failed: %w", err)
+		return nil, &SearchError{Ref: ref, Query: packageName, Err: err}
+	}
+	return result, nil
+}
+
+// SearchSystems runs the search for packageName in ref for every one of systems at once
+// and merges the results. The attribute paths of nix search name the system, so the
+// results of different systems don't overwrite each other. The first failing search
+// cancels the others and is returned.
+func SearchSystems(ctx context.Context, runner execx.Runner, ref string, packageName string, systems []string) (SearchResult, error) {
+	results := make([]SearchResult, len(systems))
+	group, groupCtx := errgroup.WithContext(ctx)
+	for i, system := range systems {
+		group.Go(func() error {
+			result, err := SearchPackages(groupCtx, runner, ref, packageName, system)
+			results[i] = result
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return MergeResults(results...), nil
+}
+
+// MergeResults joins the results of several searches into one
+func MergeResults(results ...SearchResult) SearchResult {
+	merged := SearchResult{}
+	for _, result := range results {
+		maps.Copy(merged, result)
 	}
+	return merged
+}
+
+// ParseResult reads the JSON output of nix search
+func ParseResult(output []byte) (SearchResult, error) {
 	var result SearchResult
-	err = json.Unmarshal(output, &result)
+	err := json.Unmarshal(output, &result)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
@@ -38,6 +135,7 @@ func FilterAndPrioritizePackages(packages SearchResult, showAll bool) []types.Pa
 
 	for fullPath, pkg := range packages {
 		fullPathParts := strings.Split(fullPath, ".")
+		pkg.Output = fullPathParts[0]
 		if len(fullPathParts) > 1 {
 			pkg.System = fullPathParts[1]
 		}
@@ -52,8 +150,104 @@ func FilterAndPrioritizePackages(packages SearchResult, showAll bool) []types.Pa
 		// Paths with < 3 parts are malformed, skip them
 	}
 	if showAll {
-		return append(topLevel, plugins...)
+		return MergeSystems(append(topLevel, plugins...))
 	} else {
-		return topLevel
+		return MergeSystems(topLevel)
+	}
+}
+
+// PackageSets returns an entry for every package set holding results that
+// FilterAndPrioritizePackages leaves out without showAll, such as vimPlugins for
+// vimPlugins.telescope-nvim. SetSize counts the matching packages of the set, the sets
+// with the most come first.
+func PackageSets(packages SearchResult) []types.Package {
+	type key struct{ output, name string }
+	attrs := map[key]map[string]bool{}
+	systems := map[key][]string{}
+	for fullPath := range packages {
+		parts := strings.Split(fullPath, ".")
+		if len(parts) < 4 {
+			continue
+		}
+		k := key{parts[0], parts[2]}
+		if attrs[k] == nil {
+			attrs[k] = map[string]bool{}
+		}
+		attrs[k][strings.Join(parts[3:], ".")] = true
+		if !slices.Contains(systems[k], parts[1]) {
+			systems[k] = append(systems[k], parts[1])
+		}
+	}
+
+	var sets []types.Package
+	for k, found := range attrs {
+		slices.Sort(systems[k])
+		description := fmt.Sprintf("Package set with %d matching packages", len(found))
+		if len(found) == 1 {
+			description = "Package set with 1 matching package"
+		}
+		sets = append(sets, types.Package{
+			PName:       k.name,
+			FullPath:    k.name,
+			Output:      k.output,
+			System:      strings.Join(systems[k], ","),
+			Description: description,
+			SetSize:     len(found),
+		})
+	}
+	slices.SortFunc(sets, func(a, b types.Package) int {
+		if a.SetSize != b.SetSize {
+			return b.SetSize - a.SetSize
+		}
+		return strings.Compare(a.FullPath, b.FullPath)
+	})
+	return sets
+}
+
+// MergeSystems joins the entries of one attribute path found for several systems into a
+// single package listing every system, see types.Package.Systems. Entries whose versions
+// differ stay apart, so each row installs what it shows.
+func MergeSystems(packages []types.Package) []types.Package {
+	type key struct{ source, output, attr, version string }
+	merged := map[key]int{}
+	var result []types.Package
+	for _, pkg := range packages {
+		k := key{pkg.Source, pkg.Output, pkg.FullPath, pkg.Version}
+		i, ok := merged[k]
+		if !ok || pkg.System == "" {
+			merged[k] = len(result)
+			result = append(result, pkg)
+			continue
+		}
+		systems := result[i].Systems()
+		for _, system := range pkg.Systems() {
+			if !slices.Contains(systems, system) {
+				systems = append(systems, system)
+			}
+		}
+		slices.Sort(systems)
+		result[i].System = strings.Join(systems, ",")
+	}
+	return result
+}
+
+// BestMatch returns the package that clearly matches the searched name: the only result,
+// or the only result whose pname equals the name. It reports false when the results are ambiguous.
+// Package sets, see PackageSets, are never a match.
+func BestMatch(packages []types.Package, packageName string) (*types.Package, bool) {
+	if len(packages) == 1 && packages[0].SetSize == 0 {
+		return &packages[0], true
+	}
+
+	var match *types.Package
+	for i := range packages {
+		if packages[i].PName != packageName || packages[i].SetSize > 0 {
+			continue
+		}
+		if match != nil {
+			return nil, false
+		}
+		match = &packages[i]
 	}
+	return match, match != nil
 }
@@ -1,9 +1,14 @@
 package search
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
+	"pam/internal/execx"
 	"pam/internal/types"
 )
 
@@ -146,15 +151,14 @@ func joinPath(parts []string) string {
 	return result
 }
 
-func TestSearcher_Search(t *testing.T) {
-	// This test defines the expected interface for the Searcher
-	// The actual implementation will need to execute the nix command
-
+func TestSearchPackages(t *testing.T) {
 	tests := []struct {
 		name        string
 		packageName string
 		system      string
 		mockOutput  string
+		mockErr     error
+		wantCommand string
 		wantErr     bool
 		wantCount   int
 	}{
@@ -162,6 +166,7 @@ func TestSearcher_Search(t *testing.T) {
 			name:        "successful search",
 			packageName: "firefox",
 			system:      "x86_64-linux",
+			wantCommand: "nix search nixpkgs firefox --json --system x86_64-linux",
 			mockOutput: `{
 				"legacyPackages.x86_64-linux.firefox": {
 					"pname": "firefox",
@@ -180,10 +185,23 @@ func TestSearcher_Search(t *testing.T) {
 			wantErr:     false,
 			wantCount:   0,
 		},
+		{
+			name:        "nix fails",
+			packageName: "firefox",
+			mockErr:     errors.New("exit status 1"),
+			wantErr:     true,
+		},
+		{
+			name:        "invalid JSON",
+			packageName: "firefox",
+			mockOutput:  "error: flake 'nixpkgs' does not provide attribute",
+			wantErr:     true,
+		},
 		{
 			name:        "search without system filter",
 			packageName: "vim",
 			system:      "",
+			wantCommand: "nix search nixpkgs vim --json",
 			mockOutput: `{
 				"legacyPackages.x86_64-linux.vim": {
 					"pname": "vim",
@@ -203,33 +221,49 @@ func TestSearcher_Search(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// This is a stub test that defines the interface
-			// The actual implementation will need to:
-			// 1. Create a Searcher with the system
-			// 2. Call Search with the package name
-			// 3. Return the results
-
-			// Mock the search results
-			var mockResult map[string]types.Package
-			err := json.Unmarshal([]byte(tt.mockOutput), &mockResult)
-			if err != nil {
-				t.Fatalf("Failed to parse mock output: %v", err)
+			runner := &execx.Fake{Responses: map[string]execx.Response{"nix": {Output: tt.mockOutput, Err: tt.mockErr}}}
+			results, err := SearchPackages(context.Background(), runner, "", tt.packageName, tt.system)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SearchPackages() error = %v, wantErr %v", err, tt.wantErr)
 			}
-
-			// Verify the mock has expected count
-			if len(mockResult) != tt.wantCount {
-				t.Errorf("Mock has %d packages, want %d", len(mockResult), tt.wantCount)
+			var searchErr *SearchError
+			if tt.wantErr && (!errors.As(err, &searchErr) || searchErr.Query != tt.packageName) {
+				t.Errorf("SearchPackages() error = %v, want a SearchError for %s", err, tt.packageName)
+			}
+			if len(results) != tt.wantCount {
+				t.Errorf("SearchPackages() returned %d packages, want %d", len(results), tt.wantCount)
+			}
+			if calls := runner.Calls(); tt.wantCommand != "" && (len(calls) != 1 || calls[0] != tt.wantCommand) {
+				t.Errorf("ran %q, want %q", calls, tt.wantCommand)
 			}
-
-			// The actual implementation should:
-			// searcher := NewSearcher(tt.system)
-			// results, err := searcher.Search(tt.packageName)
-			// if (err != nil) != tt.wantErr { ... }
-			// if len(results) != tt.wantCount { ... }
 		})
 	}
 }
 
+func TestFilterAndPrioritize_MergesSystems(t *testing.T) {
+	packages := SearchResult{
+		"legacyPackages.x86_64-linux.ripgrep":   {PName: "ripgrep", Version: "14.1.0"},
+		"legacyPackages.aarch64-darwin.ripgrep": {PName: "ripgrep", Version: "14.1.0"},
+		"legacyPackages.aarch64-linux.ripgrep":  {PName: "ripgrep", Version: "14.1.0"},
+		"legacyPackages.x86_64-linux.fd":        {PName: "fd", Version: "10.1.0"},
+		"legacyPackages.aarch64-darwin.fd":      {PName: "fd", Version: "9.0.0"},
+	}
+
+	got := FilterAndPrioritizePackages(packages, false)
+	systems := map[string][]string{}
+	for _, pkg := range got {
+		systems[pkg.FullPath+"@"+pkg.Version] = pkg.Systems()
+	}
+	want := map[string][]string{
+		"ripgrep@14.1.0": {"aarch64-darwin", "aarch64-linux", "x86_64-linux"},
+		"fd@10.1.0":      {"x86_64-linux"},
+		"fd@9.0.0":       {"aarch64-darwin"},
+	}
+	if !reflect.DeepEqual(systems, want) {
+		t.Errorf("FilterAndPrioritizePackages() systems = %v, want %v", systems, want)
+	}
+}
+
 func TestFilterAndPrioritize(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -278,4 +312,245 @@ func TestFilterAndPrioritize(t *testing.T) {
 	}
 }
 
+func TestPackageSets(t *testing.T) {
+	packages := SearchResult{
+		"legacyPackages.x86_64-linux.vim":                            {PName: "vim"},
+		"legacyPackages.x86_64-linux.vimPlugins.nerdtree":            {PName: "nerdtree"},
+		"legacyPackages.x86_64-linux.vimPlugins.telescope-nvim":      {PName: "telescope-nvim"},
+		"legacyPackages.aarch64-darwin.vimPlugins.telescope-nvim":    {PName: "telescope-nvim"},
+		"legacyPackages.x86_64-linux.python311Packages.vim-vint":     {PName: "vim-vint"},
+		"legacyPackages.x86_64-linux.nodePackages.neovim.dev":        {PName: "neovim"},
+		"legacyPackages.x86_64-linux.nodePackages.vim-language-tool": {PName: "vim-language-tool"},
+	}
+
+	got := PackageSets(packages)
+	want := []types.Package{
+		{PName: "nodePackages", FullPath: "nodePackages", Output: "legacyPackages", System: "x86_64-linux", Description: "Package set with 2 matching packages", SetSize: 2},
+		{PName: "vimPlugins", FullPath: "vimPlugins", Output: "legacyPackages", System: "aarch64-darwin,x86_64-linux", Description: "Package set with 2 matching packages", SetSize: 2},
+		{PName: "python311Packages", FullPath: "python311Packages", Output: "legacyPackages", System: "x86_64-linux", Description: "Package set with 1 matching package", SetSize: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PackageSets() = %+v, want %+v", got, want)
+	}
+	if sets := PackageSets(SearchResult{"legacyPackages.x86_64-linux.vim": {PName: "vim"}}); len(sets) != 0 {
+		t.Errorf("PackageSets() without nested results = %+v", sets)
+	}
+}
+
 // Benchmark removed - FilterTopLevel not needed
+
+func TestBranchRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		branch  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "stable branch",
+			branch: "stable",
+			want:   StableRef,
+		},
+		{
+			name:   "unstable branch",
+			branch: "unstable",
+			want:   UnstableRef,
+		},
+		{
+			name:    "unknown branch",
+			branch:  "master",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BranchRef(tt.branch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BranchRef(%q) error = %v, wantErr %v", tt.branch, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BranchRef(%q) = %q, want %q", tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOtherBranch(t *testing.T) {
+	tests := []struct {
+		branch string
+		want   string
+	}{
+		{branch: "stable", want: "unstable"},
+		{branch: "unstable", want: "stable"},
+		{branch: "", want: "stable"},
+	}
+
+	for _, tt := range tests {
+		if got := OtherBranch(tt.branch); got != tt.want {
+			t.Errorf("OtherBranch(%q) = %q, want %q", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestSearchArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		ref         string
+		packageName string
+		system      string
+		want        []string
+	}{
+		{
+			name:        "default ref",
+			ref:         "",
+			packageName: "firefox",
+			want:        []string{"search", "nixpkgs", "firefox", "--json"},
+		},
+		{
+			name:        "stable branch ref",
+			ref:         StableRef,
+			packageName: "firefox",
+			want:        []string{"search", StableRef, "firefox", "--json"},
+		},
+		{
+			name:        "unstable branch ref with system",
+			ref:         UnstableRef,
+			packageName: "vim",
+			system:      "aarch64-darwin",
+			want:        []string{"search", UnstableRef, "vim", "--json", "--system", "aarch64-darwin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SearchArgs(tt.ref, tt.packageName, tt.system)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("SearchArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		packages    []types.Package
+		packageName string
+		wantPath    string
+		wantOK      bool
+	}{
+		{
+			name:        "single result",
+			packages:    []types.Package{{PName: "firefox-bin", FullPath: "firefox-bin"}},
+			packageName: "firefox",
+			wantPath:    "firefox-bin",
+			wantOK:      true,
+		},
+		{
+			name: "one exact pname match",
+			packages: []types.Package{
+				{PName: "firefox", FullPath: "firefox"},
+				{PName: "firefox-esr", FullPath: "firefox-esr"},
+			},
+			packageName: "firefox",
+			wantPath:    "firefox",
+			wantOK:      true,
+		},
+		{
+			name: "several exact matches",
+			packages: []types.Package{
+				{PName: "vim", FullPath: "vim", System: "x86_64-linux"},
+				{PName: "vim", FullPath: "vim", System: "aarch64-darwin"},
+			},
+			packageName: "vim",
+			wantOK:      false,
+		},
+		{
+			name: "no exact match",
+			packages: []types.Package{
+				{PName: "firefox-esr", FullPath: "firefox-esr"},
+				{PName: "firefox-bin", FullPath: "firefox-bin"},
+			},
+			packageName: "firefox",
+			wantOK:      false,
+		},
+		{
+			name:        "no results",
+			packages:    nil,
+			packageName: "firefox",
+			wantOK:      false,
+		},
+		{
+			name:        "only a package set",
+			packages:    []types.Package{{PName: "vimPlugins", FullPath: "vimPlugins", SetSize: 3}},
+			packageName: "vimPlugins",
+			wantOK:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := BestMatch(tt.packages, tt.packageName)
+			if ok != tt.wantOK {
+				t.Fatalf("BestMatch() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.FullPath != tt.wantPath {
+				t.Errorf("BestMatch() = %q, want %q", got.FullPath, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestSearchPackages_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runner := &execx.Fake{Responses: map[string]execx.Response{"nix": {Hang: true}}}
+	if _, err := SearchPackages(ctx, runner, "", "firefox", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchPackages() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSearchSystems(t *testing.T) {
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"nix search nixpkgs ^ripgrep$ --json --system x86_64-linux":   {Output: `{"legacyPackages.x86_64-linux.ripgrep": {"pname": "ripgrep", "version": "14.1.1"}}`},
+		"nix search nixpkgs ^ripgrep$ --json --system aarch64-darwin": {Output: `{"legacyPackages.aarch64-darwin.ripgrep": {"pname": "ripgrep", "version": "14.1.1"}}`},
+	}}
+	result, err := SearchSystems(context.Background(), runner, "", "^ripgrep$", []string{"x86_64-linux", "aarch64-darwin"})
+	if err != nil {
+		t.Fatalf("SearchSystems() error = %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("SearchSystems() = %v, want the results of both systems", result)
+	}
+	packages := FilterAndPrioritizePackages(result, false)
+	if len(packages) != 1 || packages[0].System != "aarch64-darwin,x86_64-linux" {
+		t.Errorf("FilterAndPrioritizePackages() = %+v, want one ripgrep for both systems", packages)
+	}
+	if calls := runner.Calls(); len(calls) != 2 {
+		t.Errorf("ran %q, want one search per system", calls)
+	}
+}
+
+func TestSearchSystems_Error(t *testing.T) {
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"nix search nixpkgs ripgrep --json --system x86_64-linux":   {Err: errors.New("exit status 1")},
+		"nix search nixpkgs ripgrep --json --system aarch64-darwin": {Hang: true},
+	}}
+	_, err := SearchSystems(context.Background(), runner, "", "ripgrep", []string{"x86_64-linux", "aarch64-darwin"})
+	var searchErr *SearchError
+	if !errors.As(err, &searchErr) {
+		t.Errorf("SearchSystems() error = %v, want the failed search, cancelling the other", err)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	merged := MergeResults(
+		SearchResult{"legacyPackages.x86_64-linux.hello": {PName: "hello"}},
+		nil,
+		SearchResult{"legacyPackages.aarch64-linux.hello": {PName: "hello"}},
+	)
+	if len(merged) != 2 {
+		t.Errorf("MergeResults() = %v, want both entries", merged)
+	}
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"strings"
+
+	"pam/internal/types"
+)
+
+// NixpkgsSource names the default source, which generated modules reference through pkgs
+const NixpkgsSource = "nixpkgs"
+
+// Source is a flake searched for packages besides nixpkgs, such as NUR or an overlay flake
+type Source struct {
+	// Name is the flake input generated modules take the package from, e.g. inputs.nur
+	Name string `yaml:"name"`
+	// Ref is the flake reference to search, the registry entry Name when empty
+	Ref string `yaml:"ref,omitempty"`
+	// Plugin names the pam-<name> executable answering the searches of the source instead
+	// of nix search, see package plugins. Packages it finds come from the input Name.
+	Plugin string `yaml:"plugin,omitempty"`
+	// Pinned marks a nixpkgs revision holding a pinned version, which has no nixpkgs
+	// input to follow
+	Pinned bool `yaml:"-"`
+}
+
+// FlakeRef returns the reference passed to nix search
+func (s Source) FlakeRef() string {
+	if s.Ref == "" {
+		return s.Name
+	}
+	return s.Ref
+}
+
+// SourceFromRef builds a source for a flake reference given on the command line, naming
+// the input after the last part of the reference, e.g. github:nix-community/emacs-overlay
+// becomes emacs-overlay
+func SourceFromRef(ref string) Source {
+	name := ref
+	if _, path, ok := strings.Cut(name, ":"); ok {
+		name = path
+	}
+	name, _, _ = strings.Cut(name, "?")
+	name = strings.TrimSuffix(name, "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	return Source{Name: name, Ref: ref}
+}
+
+// FindSource returns the configured source called name
+func FindSource(sources []Source, name string) (Source, bool) {
+	for _, source := range sources {
+		if source.Name == name {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+// Tag marks packages as coming from the named source
+func Tag(packages []types.Package, source string) {
+	for i := range packages {
+		packages[i].Source = source
+	}
+}
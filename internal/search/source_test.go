@@ -0,0 +1,32 @@
+package search
+
+import "testing"
+
+func TestSourceFromRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Source
+	}{
+		{ref: "nur", want: Source{Name: "nur", Ref: "nur"}},
+		{ref: "github:nix-community/emacs-overlay", want: Source{Name: "emacs-overlay", Ref: "github:nix-community/emacs-overlay"}},
+		{ref: "github:nix-community/NUR/master", want: Source{Name: "master", Ref: "github:nix-community/NUR/master"}},
+		{ref: "git+https://example.com/flakes/tools?ref=main", want: Source{Name: "tools", Ref: "git+https://example.com/flakes/tools?ref=main"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if got := SourceFromRef(tt.ref); got != tt.want {
+				t.Errorf("SourceFromRef() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_FlakeRef(t *testing.T) {
+	if got := (Source{Name: "nur"}).FlakeRef(); got != "nur" {
+		t.Errorf("FlakeRef() = %q, want registry name nur", got)
+	}
+	if got := (Source{Name: "nur", Ref: "github:nix-community/NUR"}).FlakeRef(); got != "github:nix-community/NUR" {
+		t.Errorf("FlakeRef() = %q, want the configured ref", got)
+	}
+}
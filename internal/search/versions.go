@@ -0,0 +1,76 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"pam/internal/execx"
+)
+
+// InputAttr is a package attribute in one of the inputs of a flake, e.g. nixpkgs and firefox
+type InputAttr struct {
+	Input string
+	Attr  string
+}
+
+// versionsExpr looks up the version of every attribute in the inputs the flake is locked to.
+// An input or attribute that is missing, or a package that fails to evaluate, yields null.
+func versionsExpr(flakePath string, system string, attrs []InputAttr) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `let
+  flake = builtins.getFlake "path:%s";
+  version = input: path:
+    let
+      outputs = flake.inputs.${input} or { };
+      packages = outputs.legacyPackages."%s" or outputs.packages."%s" or { };
+      found = builtins.tryEval ((builtins.foldl' (set: name: set.${name}) packages path).version or null);
+    in
+    if builtins.hasAttrByPath path packages && found.success then found.value else null;
+in
+[
+`, nixString(flakePath), nixString(system), nixString(system))
+	for _, attr := range attrs {
+		var path []string
+		for _, name := range strings.Split(attr.Attr, ".") {
+			path = append(path, `"`+nixString(name)+`"`)
+		}
+		fmt.Fprintf(&b, "  (version \"%s\" [ %s ])\n", nixString(attr.Input), strings.Join(path, " "))
+	}
+	b.WriteString("]\n")
+	return b.String()
+}
+
+// nixString escapes s for use inside a double quoted nix string
+func nixString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", "\\${").Replace(s)
+}
+
+// InputVersions evaluates, in a single nix call, the version each attribute has for system
+// in the inputs the flake at flakePath is locked to. Attributes their input lacks are left out.
+func InputVersions(ctx context.Context, runner execx.Runner, flakePath string, system string, attrs []InputAttr) (map[InputAttr]string, error) {
+	if len(attrs) == 0 {
+		return map[InputAttr]string{}, nil
+	}
+	output, err := runner.Output(ctx, "nix", "eval", "--impure", "--json", "--expr", versionsExpr(flakePath, system, attrs))
+	if err != nil {
+		return nil, fmt.Errorf("evaluating versions in the flake inputs: %w", err)
+	}
+	var found []*string
+	err = json.Unmarshal(output, &found)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if len(found) != len(attrs) {
+		return nil, fmt.Errorf("nix returned %d versions for %d packages", len(found), len(attrs))
+	}
+
+	versions := map[InputAttr]string{}
+	for i, version := range found {
+		if version != nil {
+			versions[attrs[i]] = *version
+		}
+	}
+	return versions, nil
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"pam/internal/execx"
+)
+
+func TestInputVersions(t *testing.T) {
+	attrs := []InputAttr{
+		{Input: "nixpkgs", Attr: "firefox"},
+		{Input: "nixpkgs", Attr: "python3Packages.numpy"},
+		{Input: "nur", Attr: "repos.gone"},
+	}
+	expr := versionsExpr("/home/me/nixos", "x86_64-linux", attrs)
+	for _, want := range []string{
+		`builtins.getFlake "path:/home/me/nixos"`,
+		`legacyPackages."x86_64-linux"`,
+		`(version "nixpkgs" [ "python3Packages" "numpy" ])`,
+		`(version "nur" [ "repos" "gone" ])`,
+	} {
+		if !strings.Contains(expr, want) {
+			t.Errorf("versionsExpr() missing %q:\n%s", want, expr)
+		}
+	}
+
+	runner := &execx.Fake{Responses: map[string]execx.Response{
+		"nix": {Output: `["121.0", "1.26.4", null]`},
+	}}
+	versions, err := InputVersions(context.Background(), runner, "/home/me/nixos", "x86_64-linux", attrs)
+	if err != nil {
+		t.Fatalf("InputVersions() error = %v", err)
+	}
+	if len(versions) != 2 || versions[attrs[0]] != "121.0" || versions[attrs[1]] != "1.26.4" {
+		t.Errorf("InputVersions() = %v", versions)
+	}
+	if calls := runner.Calls(); len(calls) != 1 || !strings.HasPrefix(calls[0], "nix eval --impure --json --expr") {
+		t.Errorf("InputVersions() ran %v, want a single nix eval", calls)
+	}
+
+	runner = &execx.Fake{Responses: map[string]execx.Response{"nix": {Output: `["121.0"]`}}}
+	if _, err := InputVersions(context.Background(), runner, "/home/me/nixos", "x86_64-linux", attrs); err == nil {
+		t.Error("InputVersions() accepted fewer versions than packages")
+	}
+}
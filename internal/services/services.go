@@ -0,0 +1,22 @@
+package services
+
+import "pam/internal/types"
+
+// darwinDefaults are the settings written next to enable = true for nix-darwin service
+// modules whose defaults leave the service doing little, as nix expressions
+var darwinDefaults = map[string][]types.Setting{
+	"yabai": {
+		{Name: "config", Value: `{ layout = "bsp"; window_placement = "second_child"; window_gap = 8; }`},
+	},
+	"jankyborders": {
+		{Name: "active_color", Value: `"0xffe1e3e4"`},
+		{Name: "inactive_color", Value: `"0xff494d64"`},
+		{Name: "width", Value: "5.0"},
+	},
+}
+
+// DarwinDefaults returns the settings a generated module gives the nix-darwin
+// services.<name> module besides enabling it, nil for services whose defaults work as they are
+func DarwinDefaults(name string) []types.Setting {
+	return darwinDefaults[name]
+}
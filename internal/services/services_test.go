@@ -0,0 +1,13 @@
+package services
+
+import "testing"
+
+func TestDarwinDefaults(t *testing.T) {
+	yabai := DarwinDefaults("yabai")
+	if len(yabai) != 1 || yabai[0].Name != "config" {
+		t.Errorf("DarwinDefaults(yabai) = %v, want its config", yabai)
+	}
+	if got := DarwinDefaults("tailscale"); got != nil {
+		t.Errorf("DarwinDefaults(tailscale) = %v, want nil", got)
+	}
+}
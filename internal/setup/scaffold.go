@@ -0,0 +1,174 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"pam/internal/assets"
+	"pam/internal/diff"
+	"pam/internal/fsx"
+	"pam/internal/nixconfig"
+)
+
+// ScaffoldOptions describes the host of a flake generated by Scaffold
+type ScaffoldOptions struct {
+	Host   string
+	System string
+	// User is the primary user nix-darwin runs Homebrew as, unused on NixOS
+	User string
+	// HardwareConfig is copied next to the host configuration when set,
+	// e.g. /etc/nixos/hardware-configuration.nix
+	HardwareConfig string
+}
+
+// scaffoldData is what the scaffold templates are executed with
+type scaffoldData struct {
+	ScaffoldOptions
+	IsDarwin bool
+	// HasHardware imports hardware-configuration.nix into the host configuration
+	HasHardware bool
+	HostDir     string
+	ModuleDir   string
+}
+
+// isEmptyDir reports whether dir is missing or holds nothing but a git repository
+func isEmptyDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Name() != ".git" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Scaffold writes a minimal flake with one host, the module directory and lib/mkApp.nix
+// into the flake path, which must be empty. It returns the files it created.
+func (i *Initializer) Scaffold(options ScaffoldOptions) ([]string, error) {
+	flakePath := i.config.FlakePath
+	empty, err := isEmptyDir(flakePath)
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, fmt.Errorf("%s is not empty, pam init only scaffolds new flakes", flakePath)
+	}
+
+	data := i.scaffoldData(options)
+	data.HasHardware = options.HardwareConfig != ""
+	hostDir := filepath.Join(flakePath, i.config.DefaultHostDir, options.Host)
+	files := []struct {
+		template string
+		path     string
+	}{
+		{"flake.nix", filepath.Join(flakePath, "flake.nix")},
+		{"configuration.nix", filepath.Join(hostDir, "configuration.nix")},
+		{"modules.nix", filepath.Join(flakePath, i.config.DefaultModuleDir, "default.nix")},
+	}
+
+	var created []string
+	for _, file := range files {
+		content, err := assets.ScaffoldFile(file.template, data)
+		if err != nil {
+			return created, err
+		}
+		err = writeFile(file.path, []byte(content))
+		if err != nil {
+			return created, err
+		}
+		created = append(created, file.path)
+	}
+
+	if options.HardwareConfig != "" {
+		content, err := os.ReadFile(options.HardwareConfig)
+		if err != nil {
+			return created, err
+		}
+		path := filepath.Join(hostDir, "hardware-configuration.nix")
+		err = writeFile(path, content)
+		if err != nil {
+			return created, err
+		}
+		created = append(created, path)
+	}
+
+	err = i.Run()
+	if err != nil {
+		return created, err
+	}
+	return append(created, i.MkAppPath()), nil
+}
+
+func (i *Initializer) scaffoldData(options ScaffoldOptions) scaffoldData {
+	return scaffoldData{
+		ScaffoldOptions: options,
+		IsDarwin:        strings.Contains(options.System, "darwin"),
+		HostDir:         filepath.ToSlash(i.config.DefaultHostDir),
+		ModuleDir:       filepath.ToSlash(i.config.DefaultModuleDir),
+	}
+}
+
+// AddHost returns the changes that add a host to an existing flake: its configuration.nix,
+// a hardware-configuration.nix for NixOS hosts and its entry in flake.nix, which builds it
+// from the host configuration and the module directory. HardwareConfig is copied when set,
+// otherwise a placeholder is written. Nothing is written, see diff.Apply.
+func (i *Initializer) AddHost(options ScaffoldOptions) ([]diff.Change, error) {
+	hostDir := filepath.Join(i.config.FlakePath, i.config.DefaultHostDir, options.Host)
+	if _, err := os.Stat(hostDir); err == nil {
+		return nil, fmt.Errorf("host %s already exists in %s", options.Host, hostDir)
+	}
+	data := i.scaffoldData(options)
+	data.HasHardware = !data.IsDarwin
+
+	var changes []diff.Change
+	content, err := assets.ScaffoldFile("configuration.nix", data)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, diff.Change{Path: filepath.Join(hostDir, "configuration.nix"), New: content})
+
+	if data.HasHardware {
+		if options.HardwareConfig != "" {
+			hardware, err := os.ReadFile(options.HardwareConfig)
+			if err != nil {
+				return nil, err
+			}
+			content = string(hardware)
+		} else {
+			content, err = assets.ScaffoldFile("hardware-configuration.nix", data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, diff.Change{Path: filepath.Join(hostDir, "hardware-configuration.nix"), New: content})
+	}
+
+	modules := []string{
+		"./" + path.Join(data.HostDir, options.Host, "configuration.nix"),
+		"./" + data.ModuleDir,
+	}
+	registration, err := i.editFlake(func(flake *nixconfig.Config) error {
+		return flake.AddSystem(options.Host, data.IsDarwin, modules)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, registration), nil
+}
+
+func writeFile(path string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	return fsx.WriteFileAtomic(path, content, 0o644)
+}
@@ -0,0 +1,196 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal"
+	"pam/internal/diff"
+	"pam/internal/hosts"
+	"pam/internal/nixconfig"
+)
+
+func TestInitializer_Scaffold(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      ScaffoldOptions
+		wantContains map[string][]string
+	}{
+		{
+			name:    "nixos",
+			options: ScaffoldOptions{Host: "laptop", System: "x86_64-linux"},
+			wantContains: map[string][]string{
+				"flake.nix":                      {`nixosConfigurations."laptop"`, "isLinux = true;", "./hosts/laptop/configuration.nix", "./modules/apps"},
+				"hosts/laptop/configuration.nix": {`networking.hostName = "laptop";`, `nixpkgs.hostPlatform = "x86_64-linux";`, "apps = {"},
+				"modules/apps/default.nix":       {"listFilesRecursive"},
+				"lib/mkApp.nix":                  {"Universal app module helper"},
+			},
+		},
+		{
+			name:    "darwin",
+			options: ScaffoldOptions{Host: "macbook", System: "aarch64-darwin", User: "victor"},
+			wantContains: map[string][]string{
+				"flake.nix":                       {`darwinConfigurations."macbook"`, "nix-darwin.lib.darwinSystem", "isLinux = false;"},
+				"hosts/macbook/configuration.nix": {`system.primaryUser = "victor";`, "homebrew.enable = true;"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "nixos-config")
+			cfg := &internal.Config{FlakePath: root, DefaultHostDir: "hosts", DefaultModuleDir: "modules/apps"}
+
+			created, err := NewInitializer(cfg).Scaffold(tt.options)
+			if err != nil {
+				t.Fatalf("Scaffold() error = %v", err)
+			}
+			if len(created) != 4 {
+				t.Errorf("Scaffold() created %v, want 4 files", created)
+			}
+
+			for file, wants := range tt.wantContains {
+				content, err := os.ReadFile(filepath.Join(root, file))
+				if err != nil {
+					t.Fatalf("Failed to read %s: %v", file, err)
+				}
+				for _, want := range wants {
+					if !strings.Contains(string(content), want) {
+						t.Errorf("%s missing %q:\n%s", file, want, content)
+					}
+				}
+			}
+
+			// pam must be able to enable packages in the generated host config
+			appsFile := filepath.Join(root, "hosts", tt.options.Host, "configuration.nix")
+			change, err := hosts.Edit(appsFile, hosts.EnableEdit(nixconfig.DefaultNamespace, "browsers", "firefox"))
+			if err != nil {
+				t.Fatalf("enabling a package in the scaffolded host failed: %v", err)
+			}
+			if !strings.Contains(change.New, "firefox.enable = true;") {
+				t.Errorf("enabled host config:\n%s", change.New)
+			}
+		})
+	}
+}
+
+func TestInitializer_Scaffold_CopiesHardwareConfig(t *testing.T) {
+	root := t.TempDir()
+	hardware := filepath.Join(t.TempDir(), "hardware-configuration.nix")
+	if err := os.WriteFile(hardware, []byte("{ fileSystems = { }; }\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write hardware config: %v", err)
+	}
+	cfg := &internal.Config{FlakePath: root, DefaultHostDir: "hosts", DefaultModuleDir: "modules/apps"}
+
+	_, err := NewInitializer(cfg).Scaffold(ScaffoldOptions{Host: "desktop", System: "x86_64-linux", HardwareConfig: hardware})
+	if err != nil {
+		t.Fatalf("Scaffold() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "hosts", "desktop", "hardware-configuration.nix")); err != nil {
+		t.Errorf("hardware configuration was not copied: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(root, "hosts", "desktop", "configuration.nix"))
+	if !strings.Contains(string(content), "imports = [ ./hardware-configuration.nix ];") {
+		t.Errorf("host config does not import the hardware configuration:\n%s", content)
+	}
+}
+
+func TestInitializer_Scaffold_NotEmpty(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "flake.nix"), []byte("{ }\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write flake: %v", err)
+	}
+	cfg := &internal.Config{FlakePath: root, DefaultHostDir: "hosts", DefaultModuleDir: "modules/apps"}
+
+	if _, err := NewInitializer(cfg).Scaffold(ScaffoldOptions{Host: "laptop", System: "x86_64-linux"}); err == nil {
+		t.Error("Scaffold() expected error for a directory that is not empty")
+	}
+}
+
+func TestInitializer_Scaffold_Registered(t *testing.T) {
+	for _, system := range []string{"x86_64-linux", "aarch64-darwin"} {
+		root := t.TempDir()
+		cfg := &internal.Config{FlakePath: root, DefaultHostDir: "hosts", DefaultModuleDir: "modules/apps"}
+		init := NewInitializer(cfg)
+		if _, err := init.Scaffold(ScaffoldOptions{Host: "host", System: system, User: "me"}); err != nil {
+			t.Fatalf("Scaffold() error = %v", err)
+		}
+		change, err := init.Registration()
+		if err != nil {
+			t.Fatalf("Registration() error = %v", err)
+		}
+		if change.Old != change.New {
+			t.Errorf("scaffolded %s flake is not registered:\n%s", system, change.New)
+		}
+	}
+}
+
+func TestInitializer_AddHost(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      ScaffoldOptions
+		wantFiles    []string
+		wantContains map[string][]string
+	}{
+		{
+			name:      "nixos",
+			options:   ScaffoldOptions{Host: "work", System: "x86_64-linux"},
+			wantFiles: []string{"hosts/work/configuration.nix", "hosts/work/hardware-configuration.nix", "flake.nix"},
+			wantContains: map[string][]string{
+				"hosts/work/configuration.nix":          {`networking.hostName = "work";`, "imports = [ ./hardware-configuration.nix ];"},
+				"hosts/work/hardware-configuration.nix": {"nixos-generate-config --show-hardware-config"},
+				"flake.nix":                             {`nixosConfigurations."work" = nixpkgs.lib.nixosSystem {`, "./hosts/work/configuration.nix", "inherit inputs mkApp;"},
+			},
+		},
+		{
+			name:      "darwin",
+			options:   ScaffoldOptions{Host: "macbook", System: "aarch64-darwin", User: "victor"},
+			wantFiles: []string{"hosts/macbook/configuration.nix", "flake.nix"},
+			wantContains: map[string][]string{
+				"flake.nix": {`darwinConfigurations."macbook" = nix-darwin.lib.darwinSystem {`, "isLinux = false;", "./hosts/macbook/configuration.nix"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			cfg := &internal.Config{FlakePath: root, DefaultHostDir: "hosts", DefaultModuleDir: "modules/apps"}
+			init := NewInitializer(cfg)
+			if _, err := init.Scaffold(ScaffoldOptions{Host: "laptop", System: "x86_64-linux"}); err != nil {
+				t.Fatalf("Scaffold() error = %v", err)
+			}
+
+			changes, err := init.AddHost(tt.options)
+			if err != nil {
+				t.Fatalf("AddHost() error = %v", err)
+			}
+			var files []string
+			for _, change := range changes {
+				rel, _ := filepath.Rel(root, change.Path)
+				files = append(files, filepath.ToSlash(rel))
+				for _, want := range tt.wantContains[filepath.ToSlash(rel)] {
+					if !strings.Contains(change.New, want) {
+						t.Errorf("%s missing %q:\n%s", rel, want, change.New)
+					}
+				}
+			}
+			if strings.Join(files, " ") != strings.Join(tt.wantFiles, " ") {
+				t.Errorf("AddHost() changed %v, want %v", files, tt.wantFiles)
+			}
+
+			// The new host is registered like the scaffolded one
+			if err := diff.Apply(changes); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if change, err := init.Registration(); err != nil || change.Old != change.New {
+				t.Errorf("new host is not registered, error = %v:\n%s", err, change.New)
+			}
+			if _, err := init.AddHost(tt.options); err == nil {
+				t.Error("AddHost() expected error for an existing host")
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package setup
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"pam/internal"
 	"pam/internal/assets"
+	"pam/internal/diff"
+	"pam/internal/fsx"
+	"pam/internal/nixconfig"
 )
 
 type Initializer struct {
@@ -22,17 +27,39 @@ func (i *Initializer) EnsureLibDirectory() error {
 }
 
 func (i *Initializer) EnsureMkAppNix() error {
-	mkAppPath := filepath.Join(i.config.FlakePath, "lib", "mkApp.nix")
+	mkAppPath := i.MkAppPath()
 
 	if _, err := os.Stat(mkAppPath); err == nil {
 		return nil // File exists, don't overwrite
 	}
 
 	template := assets.GetMkApp()
-	return os.WriteFile(mkAppPath, []byte(template), 0o644)
+	return fsx.WriteFileAtomic(mkAppPath, []byte(template), 0o644)
+}
+
+// MkAppPath is where the mkApp helper lives inside the flake
+func (i *Initializer) MkAppPath() string {
+	return filepath.Join(i.config.FlakePath, "lib", "mkApp.nix")
+}
+
+// MkAppUpToDate reports whether lib/mkApp.nix exists and matches the template bundled with pam
+func (i *Initializer) MkAppUpToDate() (present bool, current bool, err error) {
+	content, err := os.ReadFile(i.MkAppPath())
+	if os.IsNotExist(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, string(content) == assets.GetMkApp(), nil
 }
 
 func (i *Initializer) Run() error {
+	// Never create the flake directory itself, a missing one means flake_path is wrong
+	if _, err := os.Stat(i.config.FlakePath); err != nil {
+		return fmt.Errorf("flake path: %w", err)
+	}
+
 	if err := i.EnsureLibDirectory(); err != nil {
 		return err
 	}
@@ -40,8 +67,108 @@ func (i *Initializer) Run() error {
 	if err := i.EnsureMkAppNix(); err != nil {
 		return err
 	}
-
-	// TODO: make this also check the default.nix for lib dir
-	// make it also add the registration for the lib functions in the flake.nix
 	return nil
 }
+
+// mkAppImport is how flakes registered by pam load the helper
+const mkAppImport = "import ./lib/mkApp.nix { inherit (nixpkgs) lib; }"
+
+// FlakeFile is the flake.nix of the flake
+func (i *Initializer) FlakeFile() string {
+	return filepath.Join(i.config.FlakePath, "flake.nix")
+}
+
+// Registration returns the change to flake.nix that passes mkApp and isLinux, which every
+// generated module takes as arguments, to each system the flake builds. Old equals New
+// when the flake already passes both.
+func (i *Initializer) Registration() (diff.Change, error) {
+	return i.editFlake(func(*nixconfig.Config) error { return nil })
+}
+
+// editFlake applies edit to flake.nix, then passes mkApp and isLinux to every system
+// like Registration. Nothing is written.
+func (i *Initializer) editFlake(edit func(flake *nixconfig.Config) error) (diff.Change, error) {
+	return i.changeFlake(func(flake *nixconfig.Config) error {
+		err := edit(flake)
+		if err != nil {
+			return err
+		}
+		_, err = flake.AddSpecialArg("mkApp", func(bool) string { return mkAppImport })
+		if err != nil {
+			return err
+		}
+		_, err = flake.AddSpecialArg("isLinux", func(darwin bool) string { return strconv.FormatBool(!darwin) })
+		return err
+	})
+}
+
+// changeFlake applies edit to flake.nix without writing it
+func (i *Initializer) changeFlake(edit func(flake *nixconfig.Config) error) (diff.Change, error) {
+	path := i.FlakeFile()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return diff.Change{}, err
+	}
+	change := diff.Change{Path: path, Old: string(content), New: string(content)}
+
+	flake := nixconfig.NewConfig(string(content))
+	err = edit(flake)
+	if err != nil {
+		return change, err
+	}
+	if flake.SystemCalls() == 0 {
+		return change, fmt.Errorf("no nixosSystem or darwinSystem call found in %s", path)
+	}
+	change.New = flake.Content()
+	return change, nil
+}
+
+// NixosModuleRegistration returns the change to flake.nix declaring input when the flake
+// lacks it and adding module, an expression such as inputs.x.nixosModules.default, to
+// every nixosSystem call. Old equals New when nothing is missing.
+func (i *Initializer) NixosModuleRegistration(input nixconfig.Input, module string) (diff.Change, error) {
+	change, err := i.InputRegistration([]nixconfig.Input{input}, false)
+	if err != nil {
+		return change, err
+	}
+	flake := nixconfig.NewConfig(change.New)
+	_, err = flake.AddNixosModule(module)
+	if err != nil {
+		return change, err
+	}
+	change.New = flake.Content()
+	return change, nil
+}
+
+// InputRegistration returns the change to flake.nix declaring every input the flake
+// lacks and passing inputs to each system, which modules taking packages from another
+// flake need. With overlay set, the default overlay of each input is added to the
+// systems' nixpkgs.overlays too. Old equals New when nothing is missing.
+func (i *Initializer) InputRegistration(inputs []nixconfig.Input, overlay bool) (diff.Change, error) {
+	return i.changeFlake(func(flake *nixconfig.Config) error {
+		for _, input := range inputs {
+			if !flake.HasInput(input.Name) {
+				// Follow the flake's nixpkgs only when it has one to follow
+				if input.Follows != "" && !flake.HasInput(input.Follows) {
+					input.Follows = ""
+				}
+				err := flake.AddInput(input)
+				if err != nil {
+					return err
+				}
+			}
+			if overlay {
+				_, err := flake.AddOverlay(input.Name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		_, err := flake.BindInputs()
+		if err != nil {
+			return err
+		}
+		_, err = flake.AddSpecialArg("inputs", func(bool) string { return "inputs" })
+		return err
+	})
+}
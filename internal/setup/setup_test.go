@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"pam/internal"
+	"pam/internal/nixconfig"
 )
 
 func TestInitializer_EnsureLibDirectory(t *testing.T) {
@@ -312,3 +313,186 @@ func BenchmarkInitializer_Run(b *testing.B) {
 		_ = init.Run()
 	}
 }
+
+func TestInitializer_Registration(t *testing.T) {
+	tests := []struct {
+		name         string
+		flake        string
+		wantChanged  bool
+		wantContains []string
+		wantErr      bool
+	}{
+		{
+			name: "missing arguments",
+			flake: `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}
+`,
+			wantChanged:  true,
+			wantContains: []string{"mkApp = import ./lib/mkApp.nix { inherit (nixpkgs) lib; };", "isLinux = true;"},
+		},
+		{
+			name: "already registered",
+			flake: `{
+  outputs = { nixpkgs, ... }:
+    let
+      mkApp = import ./lib/mkApp.nix { inherit (nixpkgs) lib; };
+    in {
+      darwinConfigurations.mac = nix-darwin.lib.darwinSystem {
+        specialArgs = { inherit mkApp; isLinux = false; };
+      };
+    };
+}
+`,
+		},
+		{
+			name:    "no system",
+			flake:   "{ outputs = { ... }: { }; }\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			err := os.WriteFile(filepath.Join(tmpDir, "flake.nix"), []byte(tt.flake), 0o644)
+			if err != nil {
+				t.Fatalf("Failed to write flake: %v", err)
+			}
+
+			change, err := NewInitializer(&internal.Config{FlakePath: tmpDir}).Registration()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Registration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (change.Old != change.New) != tt.wantChanged {
+				t.Errorf("Registration() changed = %v, want %v:\n%s", change.Old != change.New, tt.wantChanged, change.New)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(change.New, want) {
+					t.Errorf("Registration() missing %q:\n%s", want, change.New)
+				}
+			}
+		})
+	}
+}
+
+func TestInitializer_InputRegistration(t *testing.T) {
+	tests := []struct {
+		name         string
+		flake        string
+		overlay      bool
+		wantChanged  bool
+		wantContains []string
+	}{
+		{
+			name: "missing input",
+			flake: `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}
+`,
+			wantChanged: true,
+			wantContains: []string{
+				`inputs.nur.url = "github:nix-community/NUR";`,
+				`inputs.nur.inputs.nixpkgs.follows = "nixpkgs";`,
+				"{ nixpkgs, ... }@inputs:",
+				"inputs = inputs;",
+			},
+		},
+		{
+			name: "with overlay",
+			flake: `{
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}
+`,
+			overlay:     true,
+			wantChanged: true,
+			wantContains: []string{
+				"nur.url = \"github:nix-community/NUR\";\n  };",
+				"{ nixpkgs.overlays = [ inputs.nur.overlays.default ]; }",
+			},
+		},
+		{
+			name: "already wired",
+			flake: `{
+  inputs.nur.url = "github:nix-community/NUR";
+
+  outputs = inputs@{ nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      specialArgs = { inherit inputs; };
+    };
+  };
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			err := os.WriteFile(filepath.Join(tmpDir, "flake.nix"), []byte(tt.flake), 0o644)
+			if err != nil {
+				t.Fatalf("Failed to write flake: %v", err)
+			}
+
+			input := nixconfig.Input{Name: "nur", URL: "github:nix-community/NUR", Follows: "nixpkgs"}
+			change, err := NewInitializer(&internal.Config{FlakePath: tmpDir}).InputRegistration([]nixconfig.Input{input}, tt.overlay)
+			if err != nil {
+				t.Fatalf("InputRegistration() error = %v", err)
+			}
+			if (change.Old != change.New) != tt.wantChanged {
+				t.Errorf("InputRegistration() changed = %v, want %v:\n%s", change.Old != change.New, tt.wantChanged, change.New)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(change.New, want) {
+					t.Errorf("InputRegistration() missing %q:\n%s", want, change.New)
+				}
+			}
+		})
+	}
+}
+
+func TestInitializer_NixosModuleRegistration(t *testing.T) {
+	tmpDir := t.TempDir()
+	flake := `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+
+  outputs = { nixpkgs, ... }: {
+    nixosConfigurations.laptop = nixpkgs.lib.nixosSystem {
+      modules = [ ./hosts/laptop/configuration.nix ];
+    };
+  };
+}
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "flake.nix"), []byte(flake), 0o644); err != nil {
+		t.Fatalf("Failed to write flake: %v", err)
+	}
+
+	input := nixconfig.Input{Name: "nix-flatpak", URL: "github:gmodena/nix-flatpak"}
+	change, err := NewInitializer(&internal.Config{FlakePath: tmpDir}).NixosModuleRegistration(input, "inputs.nix-flatpak.nixosModules.nix-flatpak")
+	if err != nil {
+		t.Fatalf("NixosModuleRegistration() error = %v", err)
+	}
+	for _, want := range []string{
+		`inputs.nix-flatpak.url = "github:gmodena/nix-flatpak";`,
+		"{ nixpkgs, ... }@inputs:",
+		"./hosts/laptop/configuration.nix inputs.nix-flatpak.nixosModules.nix-flatpak ]",
+	} {
+		if !strings.Contains(change.New, want) {
+			t.Errorf("NixosModuleRegistration() missing %q:\n%s", want, change.New)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package stats
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"pam/internal/fsx"
+)
+
+// Counter counts the runs of something and how long they took together
+type Counter struct {
+	Count  int           `json:"count"`
+	Failed int           `json:"failed,omitempty"`
+	Total  time.Duration `json:"total_ns"`
+}
+
+// Average returns the mean duration of a run, 0 before the first one
+func (c Counter) Average() time.Duration {
+	if c.Count == 0 {
+		return 0
+	}
+	return c.Total / time.Duration(c.Count)
+}
+
+func (c Counter) add(other Counter) Counter {
+	return Counter{Count: c.Count + other.Count, Failed: c.Failed + other.Failed, Total: c.Total + other.Total}
+}
+
+// Stats are usage counters kept on this machine only, nothing is ever sent anywhere.
+// The recording methods are safe for concurrent use, searches run side by side.
+type Stats struct {
+	mu   sync.Mutex
+	path string
+
+	// Since is when the first stats were saved
+	Since time.Time `json:"since,omitzero"`
+	// Commands counts each pam command by its path, e.g. install or index build
+	Commands map[string]Counter `json:"commands,omitempty"`
+	// Searches counts the nix search runs, cache and index hits don't run one
+	Searches    Counter `json:"searches"`
+	CacheHits   int     `json:"cache_hits"`
+	CacheMisses int     `json:"cache_misses"`
+	IndexHits   int     `json:"index_hits"`
+	// Categories counts the packages installed into each category
+	Categories map[string]int `json:"categories,omitempty"`
+}
+
+// DefaultPath returns the stats file location inside the pam state directory
+func DefaultPath(stateDir string) string {
+	return filepath.Join(stateDir, "stats.json")
+}
+
+// Load reads the stats at path. A missing file yields empty stats.
+func Load(path string) (*Stats, error) {
+	s := &Stats{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stats %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// RecordCommand counts a run of the command, failed when it didn't succeed
+func (s *Stats) RecordCommand(name string, took time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Commands == nil {
+		s.Commands = map[string]Counter{}
+	}
+	run := Counter{Count: 1, Total: took}
+	if failed {
+		run.Failed = 1
+	}
+	s.Commands[name] = s.Commands[name].add(run)
+}
+
+// RecordSearch counts a nix search and how long it took
+func (s *Stats) RecordSearch(took time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := Counter{Count: 1, Total: took}
+	if failed {
+		run.Failed = 1
+	}
+	s.Searches = s.Searches.add(run)
+}
+
+// RecordCache counts a lookup in the search cache
+func (s *Stats) RecordCache(hit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hit {
+		s.CacheHits++
+	} else {
+		s.CacheMisses++
+	}
+}
+
+// RecordIndexHit counts a search answered by the nixpkgs index
+func (s *Stats) RecordIndexHit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.IndexHits++
+}
+
+// RecordInstall counts a package installed into category
+func (s *Stats) RecordInstall(category string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Categories == nil {
+		s.Categories = map[string]int{}
+	}
+	s.Categories[category]++
+}
+
+// Merge adds the counters of other, the stats of one run, to s
+func (s *Stats) Merge(other *Stats) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Commands == nil && len(other.Commands) > 0 {
+		s.Commands = map[string]Counter{}
+	}
+	for name, counter := range other.Commands {
+		s.Commands[name] = s.Commands[name].add(counter)
+	}
+	s.Searches = s.Searches.add(other.Searches)
+	s.CacheHits += other.CacheHits
+	s.CacheMisses += other.CacheMisses
+	s.IndexHits += other.IndexHits
+	if s.Categories == nil && len(other.Categories) > 0 {
+		s.Categories = map[string]int{}
+	}
+	for category, count := range other.Categories {
+		s.Categories[category] += count
+	}
+}
+
+// CacheHitRate returns the share of cache lookups that found results, false before the first lookup
+func (s *Stats) CacheHitRate() (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lookups := s.CacheHits + s.CacheMisses
+	if lookups == 0 {
+		return 0, false
+	}
+	return float64(s.CacheHits) / float64(lookups), true
+}
+
+// Count is how often something named happened
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TopCategories returns the n categories most installed into, most first. n < 1 returns all.
+func (s *Stats) TopCategories(n int) []Count {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var counts []Count
+	for _, name := range slices.Sorted(maps.Keys(s.Categories)) {
+		counts = append(counts, Count{Name: name, Count: s.Categories[name]})
+	}
+	slices.SortStableFunc(counts, func(a, b Count) int { return cmp.Compare(b.Count, a.Count) })
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// CommandNames returns the recorded commands, most run first
+func (s *Stats) CommandNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := slices.Sorted(maps.Keys(s.Commands))
+	slices.SortStableFunc(names, func(a, b string) int { return cmp.Compare(s.Commands[b].Count, s.Commands[a].Count) })
+	return names
+}
+
+func (s *Stats) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Since.IsZero() {
+		s.Since = time.Now()
+	}
+
+	err := os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsx.WriteFileAtomic(s.path, data, 0o644)
+}
+
+// Clear forgets all counters and removes the stats file
+func (s *Stats) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Since = time.Time{}
+	s.Commands = nil
+	s.Searches = Counter{}
+	s.CacheHits, s.CacheMisses, s.IndexHits = 0, 0, 0
+	s.Categories = nil
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "stats.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(s.Commands) != 0 || s.Searches.Count != 0 {
+		t.Errorf("Load() = %+v, want empty stats", s)
+	}
+	if _, ok := s.CacheHitRate(); ok {
+		t.Error("CacheHitRate() ok = true without cache lookups")
+	}
+}
+
+func TestStats_MergeAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "stats.json")
+	saved, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run := range 2 {
+		session := &Stats{}
+		session.RecordCommand("install", 3*time.Second, run == 1)
+		session.RecordInstall("browsers")
+		session.RecordCache(run == 1)
+		session.RecordSearch(2*time.Second, false)
+		saved.Merge(session)
+	}
+	session := &Stats{}
+	session.RecordCommand("search", time.Second, false)
+	session.RecordInstall("editors")
+	session.RecordIndexHit()
+	saved.Merge(session)
+	if err := saved.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Since.IsZero() {
+		t.Error("Save() didn't record since when the stats are kept")
+	}
+	install := loaded.Commands["install"]
+	if install.Count != 2 || install.Failed != 1 || install.Average() != 3*time.Second {
+		t.Errorf("install = %+v, want 2 runs of 3s, 1 failed", install)
+	}
+	if got := loaded.Searches.Average(); got != 2*time.Second {
+		t.Errorf("average search = %s, want 2s", got)
+	}
+	if rate, ok := loaded.CacheHitRate(); !ok || rate != 0.5 {
+		t.Errorf("CacheHitRate() = %v, %v, want 0.5", rate, ok)
+	}
+	if loaded.IndexHits != 1 {
+		t.Errorf("IndexHits = %d, want 1", loaded.IndexHits)
+	}
+	want := []Count{{"browsers", 2}, {"editors", 1}}
+	if got := loaded.TopCategories(0); !slices.Equal(got, want) {
+		t.Errorf("TopCategories() = %v, want %v", got, want)
+	}
+	if got := loaded.TopCategories(1); len(got) != 1 {
+		t.Errorf("TopCategories(1) = %v, want one category", got)
+	}
+	if got := loaded.CommandNames(); !slices.Equal(got, []string{"install", "search"}) {
+		t.Errorf("CommandNames() = %v", got)
+	}
+
+	if err := loaded.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Clear() left the stats file: %v", err)
+	}
+	if len(loaded.Commands) != 0 || loaded.CacheHits != 0 {
+		t.Errorf("Clear() kept %+v", loaded)
+	}
+}
+
+func TestStats_Concurrent(t *testing.T) {
+	s := &Stats{}
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			s.RecordSearch(time.Millisecond, false)
+			s.RecordCache(false)
+		})
+	}
+	wg.Wait()
+	if s.Searches.Count != 20 || s.CacheMisses != 20 {
+		t.Errorf("recorded %d searches and %d misses, want 20", s.Searches.Count, s.CacheMisses)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of invalid JSON should fail")
+	}
+}
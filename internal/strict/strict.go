@@ -0,0 +1,80 @@
+package strict
+
+import (
+	"fmt"
+	"io"
+)
+
+// Condition identifies a warning site that becomes fatal in strict mode
+type Condition string
+
+const (
+	// AmbiguousSearch is raised when the search results have no clear best match
+	AmbiguousSearch Condition = "ambiguous-search"
+	// UntrackedFile is raised when a new file in a git flake is not tracked, so nix cannot see it
+	UntrackedFile Condition = "untracked-file"
+	// SkippedHost is raised when a selected host cannot be updated and is skipped
+	SkippedHost Condition = "skipped-host"
+	// UnavailableSystem is raised when a package doesn't exist for the system of a selected host
+	UnavailableSystem Condition = "unavailable-system"
+	// DuplicateModule is raised when a package is already installed by another module or a package list
+	DuplicateModule Condition = "duplicate-module"
+	// UnsafePackage is raised when a package is marked insecure, or not supported on a host's system
+	UnsafePackage Condition = "unsafe-package"
+	// UnfreePackage is raised when a package has an unfree license
+	UnfreePackage Condition = "unfree-package"
+	// BrokenPackage is raised when a package is marked broken
+	BrokenPackage Condition = "broken-package"
+)
+
+// Error is returned for a warning condition when strict mode is enabled
+type Error struct {
+	Condition Condition
+	Message   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("strict mode: %s (%s)", e.Message, e.Condition)
+}
+
+// Policy decides whether warnings are printed or turned into errors
+type Policy struct {
+	Strict bool
+	Out    io.Writer
+	// Allowed conditions stay warnings in strict mode
+	Allowed map[Condition]bool
+}
+
+func NewPolicy(strict bool, out io.Writer) *Policy {
+	return &Policy{Strict: strict, Out: out}
+}
+
+// Allow keeps the conditions from failing in strict mode
+func (p *Policy) Allow(conditions ...Condition) {
+	if p.Allowed == nil {
+		p.Allowed = make(map[Condition]bool)
+	}
+	for _, condition := range conditions {
+		p.Allowed[condition] = true
+	}
+}
+
+// Warn reports a warning condition. In strict mode it returns an *Error instead of printing,
+// unless the condition is allowed.
+func (p *Policy) Warn(condition Condition, format string, args ...any) error {
+	message := fmt.Sprintf(format, args...)
+	if p.Strict && !p.Allowed[condition] {
+		return &Error{Condition: condition, Message: message}
+	}
+	fmt.Fprintf(p.Out, "Warning: %s\n", message)
+	return nil
+}
+
+// Check fails in strict mode unless the condition is allowed, and is silent otherwise.
+// It is meant for conditions that are resolved interactively outside strict mode, like prompting.
+func (p *Policy) Check(condition Condition, format string, args ...any) error {
+	if !p.Strict || p.Allowed[condition] {
+		return nil
+	}
+	return &Error{Condition: condition, Message: fmt.Sprintf(format, args...)}
+}
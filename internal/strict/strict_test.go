@@ -0,0 +1,126 @@
+package strict
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Warn(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		condition  Condition
+		message    string
+		wantErr    bool
+		wantOutput string
+	}{
+		{
+			name:       "ambiguous search warns",
+			strict:     false,
+			condition:  AmbiguousSearch,
+			message:    "no clear best match for firefox",
+			wantOutput: "Warning: no clear best match for firefox\n",
+		},
+		{
+			name:      "ambiguous search fails in strict mode",
+			strict:    true,
+			condition: AmbiguousSearch,
+			message:   "no clear best match for firefox",
+			wantErr:   true,
+		},
+		{
+			name:      "untracked file fails in strict mode",
+			strict:    true,
+			condition: UntrackedFile,
+			message:   "modules/apps/browsers/firefox.nix is not tracked by git",
+			wantErr:   true,
+		},
+		{
+			name:      "skipped host fails in strict mode",
+			strict:    true,
+			condition: SkippedHost,
+			message:   "skipping host laptop",
+			wantErr:   true,
+		},
+		{
+			name:       "skipped host warns",
+			strict:     false,
+			condition:  SkippedHost,
+			message:    "skipping host laptop",
+			wantOutput: "Warning: skipping host laptop\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			policy := NewPolicy(tt.strict, &out)
+
+			err := policy.Warn(tt.condition, "%s", tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Warn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if out.String() != tt.wantOutput {
+				t.Errorf("Warn() output = %q, want %q", out.String(), tt.wantOutput)
+			}
+
+			if tt.wantErr {
+				var strictErr *Error
+				if !errors.As(err, &strictErr) {
+					t.Fatalf("Warn() error type = %T, want *Error", err)
+				}
+				if strictErr.Condition != tt.condition {
+					t.Errorf("Error.Condition = %q, want %q", strictErr.Condition, tt.condition)
+				}
+				if !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("Error() = %q, want it to contain %q", err.Error(), tt.message)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	var out bytes.Buffer
+
+	lenient := NewPolicy(false, &out)
+	if err := lenient.Check(AmbiguousSearch, "no clear best match for %s", "vim"); err != nil {
+		t.Errorf("Check() error = %v, want nil outside strict mode", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Check() printed %q, want no output", out.String())
+	}
+
+	strict := NewPolicy(true, &out)
+	err := strict.Check(AmbiguousSearch, "no clear best match for %s", "vim")
+	if err == nil {
+		t.Fatal("Check() error = nil, want error in strict mode")
+	}
+	if !strings.Contains(err.Error(), "no clear best match for vim") {
+		t.Errorf("Check() error = %q, want it to contain the message", err.Error())
+	}
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	var out bytes.Buffer
+	policy := NewPolicy(true, &out)
+	policy.Allow(UnfreePackage, BrokenPackage)
+
+	if err := policy.Check(UnfreePackage, "vscode has an unfree license"); err != nil {
+		t.Errorf("Check() error = %v, want nil for an allowed condition", err)
+	}
+	if err := policy.Warn(BrokenPackage, "olddb is marked broken"); err != nil {
+		t.Errorf("Warn() error = %v, want nil for an allowed condition", err)
+	}
+	if got := out.String(); got != "Warning: olddb is marked broken\n" {
+		t.Errorf("Warn() printed %q, want the warning", got)
+	}
+
+	var strictErr *Error
+	err := policy.Warn(UnsafePackage, "olddb is marked insecure")
+	if !errors.As(err, &strictErr) || strictErr.Condition != UnsafePackage {
+		t.Errorf("Warn() error = %v, want %s to stay fatal", err, UnsafePackage)
+	}
+}
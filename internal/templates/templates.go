@@ -0,0 +1,180 @@
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"pam/internal/assets"
+	"pam/internal/nixconfig"
+	"pam/internal/types"
+)
+
+// Default names the template bundled with pam, it can't be overridden
+const Default = "default"
+
+// Template is a module template, either bundled or a .nix file in a template directory
+type Template struct {
+	Name string
+	// Path is empty for the bundled template
+	Path    string
+	Content string
+}
+
+// Variable is a value templates can use
+type Variable struct {
+	Name        string
+	Description string
+}
+
+// Variables documents the fields of assets.TemplateData, which templates are executed with
+var Variables = []Variable{
+	{".PName", "Package name, also the option hosts enable (<namespace>.<category>.<name>.enable)"},
+	{".Description", "Description from nixpkgs, use nixString to escape it inside a nix string"},
+	{".Ref", "Package expression, e.g. pkgs.firefox or an attribute of another flake input"},
+	{".FullPath", "Attribute path, e.g. python3Packages.numpy"},
+	{".Version", "Version at install time"},
+	{".System", "System the package was found for, e.g. x86_64-linux, several separated by commas for hosts of different systems"},
+	{".IsLinux", "True for linux packages"},
+	{".IsDarwin", "True for darwin packages"},
+	{".UseHomebrew", "True when installing a darwin package as a Homebrew cask (--brew)"},
+	{".Manager", "nix, brew for a Homebrew cask, tap for a formula of a Homebrew tap or mas for a Mac App Store app"},
+	{".Homebrew", "Set for a darwin package from a Homebrew tap (.Tap, .Formula) or the Mac App Store (.MasID, .MasName), nil otherwise"},
+	{".Input", "Flake input the package comes from, nixpkgs unless found in another source"},
+	{".Source", "Name of the source the package was found in, empty for nixpkgs"},
+	{".Program", "Name of the programs.<name> module to enable instead of listing the package, empty for a plain package"},
+	{".DarwinService", "Name of the nix-darwin services.<name> module enabled on darwin hosts instead of listing the package, empty for none"},
+	{".Flatpak", "Flathub app id linux hosts install through nix-flatpak instead of the package (--flatpak), empty for none"},
+	{".With", "Packages the interpreter is built with, e.g. python311Packages.numpy, empty unless .Ref is an interpreter with packages"},
+	{".DarwinServiceSettings", "Settings written next to enable = true of the darwin service, each with .Name and .Value"},
+	{".ExtraRefs", "Expressions of the extra packages chosen with --extras, e.g. pkgs.ffmpeg"},
+	{".Env", "Environment variables chosen with --extras, each with .Name and .Value"},
+	{".Service", "Name of the services.<name> module chosen with --extras or on NixOS hosts, empty for none"},
+	{".ServiceSettings", "Options set in the service besides enable, each with .Name and .Value"},
+	{".Namespace", "Attribute path the option is declared under, apps unless option_namespace is set"},
+}
+
+// samples are the packages Validate generates modules for
+var samples = []struct {
+	pkg         types.Package
+	useHomebrew bool
+}{
+	{pkg: types.Package{PName: "pam-sample", FullPath: "pamSampleAttr", Version: "1.0", System: "x86_64-linux", Description: "Sample"}},
+	{pkg: types.Package{PName: "pam-sample", FullPath: "pamSampleAttr", Version: "1.0", System: "aarch64-darwin", Description: "Sample"}},
+	{pkg: types.Package{PName: "pam-sample", FullPath: "pamSampleAttr", Version: "1.0", System: "aarch64-darwin", Description: "Sample"}, useHomebrew: true},
+	{pkg: types.Package{PName: "pam-sample", FullPath: "pam/sample/pam-sample", System: "aarch64-darwin", Description: "Sample", Homebrew: &types.Homebrew{Tap: "pam/sample", Formula: "pam-sample"}}},
+	{pkg: types.Package{PName: "pam-sample", FullPath: "1", Version: "1.0", System: "aarch64-darwin", Description: "Sample", Homebrew: &types.Homebrew{MasID: 1, MasName: "Sample"}}},
+}
+
+// Dirs returns the template directories, the flake's templates/ folder taking precedence
+// over ~/.config/pam/templates
+func Dirs(flakePath string, configDir string) []string {
+	return []string{filepath.Join(flakePath, "templates"), filepath.Join(configDir, "templates")}
+}
+
+// Bundled returns the template pam ships with
+func Bundled() Template {
+	return Template{Name: Default, Content: assets.GetPackageTemplate()}
+}
+
+// List returns the bundled template followed by the .nix files of dirs, sorted by name.
+// A template in an earlier directory hides one of the same name in a later directory,
+// missing directories are skipped.
+func List(dirs ...string) ([]Template, error) {
+	seen := map[string]bool{Default: true}
+	var found []Template
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name, isNix := strings.CutSuffix(entry.Name(), ".nix")
+			if entry.IsDir() || !isNix || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			path := filepath.Join(dir, entry.Name())
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, Template{Name: name, Path: path, Content: string(content)})
+		}
+	}
+
+	slices.SortFunc(found, func(a, b Template) int { return strings.Compare(a.Name, b.Name) })
+	return append([]Template{Bundled()}, found...), nil
+}
+
+// Find returns the template called name
+func Find(name string, dirs ...string) (Template, error) {
+	all, err := List(dirs...)
+	if err != nil {
+		return Template{}, err
+	}
+	if found, ok := Named(all, name); ok {
+		return found, nil
+	}
+	return Template{}, fmt.Errorf("no template named %s in %s", name, strings.Join(dirs, " or "))
+}
+
+// Named returns the template called name among all
+func Named(all []Template, name string) (Template, bool) {
+	for _, candidate := range all {
+		if candidate.Name == name {
+			return candidate, true
+		}
+	}
+	return Template{}, false
+}
+
+// Add adds templates provided elsewhere, such as by plugins, to the list of List. Templates
+// already listed hide extra ones of the same name, the bundled one stays first.
+func Add(all []Template, extra ...Template) []Template {
+	added := slices.Clone(all)
+	for _, template := range extra {
+		if _, ok := Named(added, template.Name); !ok {
+			added = append(added, template)
+		}
+	}
+	slices.SortStableFunc(added[min(1, len(added)):], func(a, b Template) int { return strings.Compare(a.Name, b.Name) })
+	return added
+}
+
+// Parse parses the template for assets.FillTemplate
+func (t Template) Parse() (*template.Template, error) {
+	return assets.ParseTemplate(t.Name, t.Content)
+}
+
+// Validate parses the template and generates modules for sample linux and darwin packages.
+// Every module must name the package, and at least one must install it with .Ref.
+func (t Template) Validate() error {
+	tmpl, err := t.Parse()
+	if err != nil {
+		return err
+	}
+
+	installs := false
+	for _, sample := range samples {
+		module, err := assets.FillTemplate(tmpl, &sample.pkg, sample.useHomebrew, nixconfig.DefaultNamespace)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(module, sample.pkg.PName) {
+			return fmt.Errorf("template %s does not use .PName, hosts could not enable the module", t.Name)
+		}
+		installs = installs || strings.Contains(module, assets.PackageRef(&sample.pkg))
+	}
+	if !installs {
+		return fmt.Errorf("template %s does not use .Ref, the module would not install anything", t.Name)
+	}
+	return nil
+}
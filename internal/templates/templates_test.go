@@ -0,0 +1,96 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	root := t.TempDir()
+	flakeDir := filepath.Join(root, "flake", "templates")
+	userDir := filepath.Join(root, "config", "templates")
+
+	writeTemplate(t, flakeDir, "service.nix", "flake service")
+	writeTemplate(t, userDir, "service.nix", "user service")
+	writeTemplate(t, userDir, "cli.nix", "user cli")
+	writeTemplate(t, userDir, "default.nix", "can't replace the bundled template")
+	writeTemplate(t, userDir, "README.md", "not a template")
+
+	got, err := List(flakeDir, userDir, filepath.Join(root, "missing"))
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	var names []string
+	for _, template := range got {
+		names = append(names, template.Name)
+	}
+	if strings.Join(names, ",") != "default,cli,service" {
+		t.Fatalf("List() = %v, want [default cli service]", names)
+	}
+	if got[0].Path != "" || got[0].Content != Bundled().Content {
+		t.Errorf("first template = %+v, want the bundled one", got[0])
+	}
+	if got[2].Content != "flake service" {
+		t.Errorf("service template = %q, want the flake's one", got[2].Content)
+	}
+
+	if _, err := Find("missing", flakeDir, userDir); err == nil {
+		t.Error("Find() expected error for unknown template")
+	}
+}
+
+func TestTemplate_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "bundled", content: Bundled().Content},
+		{name: "linux only", content: `mkApp { name = "{{ .PName }}"; linuxPackages = pkgs: [ {{ if .IsLinux }}{{ .Ref }}{{ end }} ]; }`},
+		{name: "legacy placeholders", content: `mkApp { name = "PackageName"; linuxPackages = pkgs: [ LinuxPackage ]; }`},
+		{name: "no name", content: `{ environment.systemPackages = [ {{ .Ref }} ]; }`, wantErr: true},
+		{name: "no package", content: `mkApp { name = "{{ .PName }}"; }`, wantErr: true},
+		{name: "syntax error", content: `{{ if .IsLinux }}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Template{Name: tt.name, Content: tt.content}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	all := []Template{Bundled(), {Name: "cli", Path: "/flake/templates/cli.nix"}}
+	added := Add(all, Template{Name: "gui", Path: "/bin/pam-company"}, Template{Name: "cli", Path: "/bin/pam-company"}, Template{Name: "app", Path: "/bin/pam-company"})
+
+	var names []string
+	for _, template := range added {
+		names = append(names, template.Name)
+	}
+	if got := strings.Join(names, " "); got != "default app cli gui" {
+		t.Errorf("Add() = %s, want default app cli gui", got)
+	}
+	if cli, _ := Named(added, "cli"); cli.Path != "/flake/templates/cli.nix" {
+		t.Errorf("Add() replaced the listed cli template with %s", cli.Path)
+	}
+	if _, ok := Named(added, "missing"); ok {
+		t.Error("Named() found a missing template")
+	}
+}
@@ -1,9 +1,85 @@
 package types
 
+import "strings"
+
 type Package struct {
 	PName       string `json:"pname"`
 	Version     string `json:"version"`
 	Description string `json:"description"`
 	FullPath    string
-	System      string
+	// System is the system the package was found for. A package installed on hosts of
+	// different systems lists all of them separated by commas, see Systems.
+	System string
+	// Output is the flake output holding the package, packages or legacyPackages
+	Output string
+	// Source is the flake input the package comes from, empty for nixpkgs
+	Source string
+	// Program is set to the name of a programs.<name> module that installs the package
+	// when enabled, which is used instead of listing the package
+	Program string
+	// DarwinService is set to the name of a nix-darwin services.<name> module that runs the
+	// package on darwin hosts when enabled, which is used there instead of listing the package
+	DarwinService string
+	// Flatpak is set to the Flathub app id linux hosts install through nix-flatpak instead
+	// of the package, e.g. org.mozilla.firefox
+	Flatpak string
+	// Extras are written into the module next to the package, nil for none
+	Extras *Extras
+	// Homebrew is set for a package nixpkgs doesn't have that darwin hosts install from a
+	// Homebrew tap or the Mac App Store instead
+	Homebrew *Homebrew
+	// Wrapper is set when the package is an interpreter or editor built with packages of a
+	// language package set, which is written instead of the package
+	Wrapper *Wrapper
+	// SetSize is set on a search result standing for a package set such as vimPlugins
+	// instead of a package, to the number of its packages matching the search
+	SetSize int
+}
+
+// Homebrew is a formula of a third-party tap or a Mac App Store app, written into the
+// homebrew.taps and homebrew.brews or the homebrew.masApps of nix-darwin
+type Homebrew struct {
+	// Tap is the tap holding Formula, e.g. owner/repo
+	Tap     string `json:"tap,omitempty"`
+	Formula string `json:"formula,omitempty"`
+	// MasID is the Mac App Store id of the app named MasName
+	MasID   int64  `json:"mas_id,omitempty"`
+	MasName string `json:"mas_name,omitempty"`
+}
+
+// Wrapper is an interpreter built with packages of a language package set, such as
+// python311.withPackages (ps: [ ps.numpy ]) for python311Packages.numpy
+type Wrapper struct {
+	// Set is the package set the packages are taken from, e.g. python311Packages
+	Set string `json:"set"`
+	// Packages are attribute names within Set, e.g. numpy
+	Packages []string `json:"packages"`
+}
+
+// Setting is a name with its value, see Extras
+type Setting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Extras are settings a generated module gets besides installing the package
+type Extras struct {
+	// Override are the arguments of pkg.override, with nix expressions as values
+	Override []Setting `json:"override,omitempty"`
+	// Packages are more nixpkgs attribute paths installed with the package
+	Packages []string `json:"packages,omitempty"`
+	// Env are environment variables set on the hosts
+	Env []Setting `json:"env,omitempty"`
+	// Service is the services.<name> module enabled on linux hosts
+	Service string `json:"service,omitempty"`
+	// ServiceSettings are set in the Service besides enable, e.g. port = 5432
+	ServiceSettings []Setting `json:"service_settings,omitempty"`
+}
+
+// Systems returns every system in System
+func (p *Package) Systems() []string {
+	if p.System == "" {
+		return nil
+	}
+	return strings.Split(p.System, ",")
 }
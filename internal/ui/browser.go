@@ -0,0 +1,601 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"pam/internal/search"
+	"pam/internal/types"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// MetaFetcher looks up the homepage and licenses of a package, which nix search doesn't return
+type MetaFetcher func(pkg types.Package) (search.Meta, error)
+
+// SetSearcher searches only the packages of a package set, such as vimPlugins, see
+// types.Package.SetSize
+type SetSearcher func(set types.Package, query string) ([]types.Package, error)
+
+// Column widths of the result list, the description takes the remaining width
+const (
+	nameWidth     = 28
+	versionWidth  = 14
+	platformWidth = 16
+	// detailHeight is the number of lines below the list showing the selected package
+	detailHeight = 6
+	// shownPlatforms is how many platforms the pane below the list names
+	shownPlatforms = 4
+	// pageSize is how many results the list holds at first and adds with every load
+	pageSize = 200
+)
+
+var (
+	browserSelectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	browserHeaderStyle   = lipgloss.NewStyle().Bold(true).Faint(true)
+	browserDetailStyle   = lipgloss.NewStyle().Faint(true)
+)
+
+type packageItem struct {
+	pkg types.Package
+}
+
+func (i packageItem) FilterValue() string {
+	return i.pkg.FullPath + " " + i.pkg.Description
+}
+
+// fit pads or truncates s to exactly width cells
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if lipgloss.Width(s) > width {
+		runes := []rune(s)
+		for lipgloss.Width(string(runes)) > width-1 {
+			runes = runes[:len(runes)-1]
+		}
+		return string(runes) + "…"
+	}
+	return s + strings.Repeat(" ", width-lipgloss.Width(s))
+}
+
+// packageColumns renders one row of the result table
+func packageColumns(name, version, platform, description string, width int) string {
+	rest := width - nameWidth - versionWidth - platformWidth - 2
+	return "  " + fit(name, nameWidth) + fit(version, versionWidth) + fit(platform, platformWidth) + fit(description, rest)
+}
+
+// platformLabel names the system of a package, or the first and how many more it was
+// found for
+func platformLabel(pkg types.Package) string {
+	systems := pkg.Systems()
+	if len(systems) > 1 {
+		return fmt.Sprintf("%s +%d", systems[0], len(systems)-1)
+	}
+	return pkg.System
+}
+
+// packageKey identifies a result among packages of other sources with the same attribute path
+func packageKey(pkg types.Package) string {
+	return pkg.Source + "#" + pkg.FullPath
+}
+
+// packageDelegate renders a result row. marked is shared by every copy of the browser
+// model, so rows see the marks set with space.
+type packageDelegate struct {
+	marked map[string]bool
+}
+
+func (d packageDelegate) Height() int                               { return 1 }
+func (d packageDelegate) Spacing() int                              { return 0 }
+func (d packageDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd { return nil }
+
+func (d packageDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	pkg := item.(packageItem).pkg
+	name, version := pkg.FullPath, pkg.Version
+	if pkg.Source != "" {
+		name = pkg.Source + "#" + name
+	}
+	if pkg.SetSize > 0 {
+		name, version = name+" ›", fmt.Sprintf("%d pkgs", pkg.SetSize)
+	}
+	row := packageColumns(name, version, platformLabel(pkg), pkg.Description, m.Width())
+	if d.marked[packageKey(pkg)] {
+		row = row[:1] + "✓" + row[2:]
+	}
+	if index == m.Index() {
+		row = browserSelectedStyle.Render("▸" + row[1:])
+	}
+	fmt.Fprint(w, row)
+}
+
+type metaMsg struct {
+	attr string
+	meta search.Meta
+	err  error
+	// loaded is false while the lookup is still running
+	loaded bool
+}
+
+type setResultMsg struct {
+	set      string
+	query    string
+	packages []types.Package
+	err      error
+}
+
+// setModel searches within the package set the user opened from the results
+type setModel struct {
+	set   types.Package
+	input textinput.Model
+	// searching is the query being searched, empty otherwise
+	searching string
+	message   string
+	// results are the packages of the set found for the last query, nil before
+	results *browserModel
+}
+
+type browserModel struct {
+	list      list.Model
+	fetchMeta MetaFetcher
+	meta      map[string]metaMsg
+	// title is the list title without the result counter
+	title string
+	// pending are the results not in the list yet, added a page at a time
+	pending []types.Package
+	total   int
+	// keys are the help keys besides m
+	keys []key.Binding
+	// install is the package the user pressed i on, or enter when picking
+	install *types.Package
+	// pick chooses a package with enter instead of browsing, see PickPackage
+	pick bool
+	// multi lets the picker mark several packages with space, chosen holds them in the
+	// order they were marked once enter is pressed
+	multi  bool
+	marked map[string]bool
+	order  []types.Package
+	chosen []types.Package
+	// otherBranch is offered with b when picking, switchBranch records that it was taken
+	otherBranch  string
+	switchBranch bool
+	// expanded shows every detail of the selected package instead of the list
+	expanded bool
+	// searchSet opens a package set among the results in a selector searching only
+	// within it, starting with query. set is that selector while it is shown.
+	searchSet SetSearcher
+	query     string
+	set       *setModel
+}
+
+var (
+	installKey = key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "install"))
+	pickKey    = key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "choose"))
+	detailKey  = key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "details"))
+	backKey    = key.NewBinding(key.WithKeys("tab", "esc"), key.WithHelp("tab", "back"))
+	moreKey    = key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "load more"))
+	markKey    = key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "mark"))
+	// setSearchKey searches the open package set again, leaveSetKey returns to the results
+	setSearchKey = key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "search set"))
+	leaveSetKey  = key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "all results"))
+)
+
+func branchKey(branch string) key.Binding {
+	return key.NewBinding(key.WithKeys("b"), key.WithHelp("b", "search "+branch))
+}
+
+func newPickerModel(title string, packages []types.Package, fetchMeta MetaFetcher, otherBranch string, multi bool) browserModel {
+	m := newBrowserModel(title, packages, fetchMeta)
+	m.pick = true
+	m.multi = multi
+	m.otherBranch = otherBranch
+	keys := []key.Binding{pickKey, detailKey}
+	if multi {
+		keys = append(keys, markKey)
+	}
+	if otherBranch != "" {
+		keys = append(keys, branchKey(otherBranch))
+	}
+	m.keys = keys
+	m.loadMore(0)
+	return m
+}
+
+// newBrowserModel lists the first page of packages, the rest are added as the cursor
+// reaches the end of the list, with m, or all at once when filtering
+func newBrowserModel(title string, packages []types.Package, fetchMeta MetaFetcher) browserModel {
+	marked := map[string]bool{}
+	results := list.New(nil, packageDelegate{marked: marked}, 100, 20)
+	results.SetStatusBarItemName("package", "packages")
+
+	m := browserModel{list: results, fetchMeta: fetchMeta, meta: map[string]metaMsg{}, title: title, pending: packages, total: len(packages), marked: marked}
+	m.keys = []key.Binding{installKey, detailKey}
+	m.loadMore(pageSize)
+	return m
+}
+
+// loadMore moves up to n pending results into the list and updates the result counter
+// and the help, which offers m while results are pending
+func (m *browserModel) loadMore(n int) tea.Cmd {
+	n = min(n, len(m.pending))
+	items := m.list.Items()
+	for _, pkg := range m.pending[:n] {
+		items = append(items, packageItem{pkg: pkg})
+	}
+	m.pending = m.pending[n:]
+
+	help := m.keys
+	if len(m.pending) > 0 {
+		help = append(slices.Clip(help), moreKey)
+	}
+	m.list.AdditionalShortHelpKeys = func() []key.Binding { return help }
+	m.list.AdditionalFullHelpKeys = func() []key.Binding { return help }
+	cmd := m.list.SetItems(items)
+	m.list.Title = m.counterTitle()
+	return cmd
+}
+
+func (m browserModel) selected() (types.Package, bool) {
+	item, ok := m.list.SelectedItem().(packageItem)
+	return item.pkg, ok
+}
+
+// loadMeta fetches the metadata of the selected package unless it is known or loading already
+func (m browserModel) loadMeta() tea.Cmd {
+	pkg, ok := m.selected()
+	if !ok || m.fetchMeta == nil {
+		return nil
+	}
+	if _, known := m.meta[pkg.FullPath]; known || pkg.SetSize > 0 {
+		return nil
+	}
+	m.meta[pkg.FullPath] = metaMsg{attr: pkg.FullPath}
+	return func() tea.Msg {
+		meta, err := m.fetchMeta(pkg)
+		return metaMsg{attr: pkg.FullPath, meta: meta, err: err, loaded: true}
+	}
+}
+
+func (m browserModel) Init() tea.Cmd {
+	return m.loadMeta()
+}
+
+func (m browserModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		// Leave room for the column header and the detail lines
+		m.list.SetSize(msg.Width, msg.Height-detailHeight-1)
+		if m.set != nil && m.set.results != nil {
+			m.set.results.list.SetSize(msg.Width, msg.Height-detailHeight-2)
+		}
+		return m, nil
+	case metaMsg:
+		m.meta[msg.attr] = msg
+		return m, nil
+	case setResultMsg:
+		return m.setResult(msg)
+	}
+	if m.set != nil {
+		return m.updateSet(msg)
+	}
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.expanded {
+			if key.Matches(msg, backKey) {
+				m.expanded = false
+			}
+			return m, nil
+		}
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		pkg, ok := m.selected()
+		switch {
+		case key.Matches(msg, moreKey) && len(m.pending) > 0:
+			return m, m.loadMore(pageSize)
+		case pkg.SetSize > 0 && (!m.pick && key.Matches(msg, installKey) || m.pick && key.Matches(msg, pickKey)):
+			// A set is opened instead of chosen, it can't be installed
+			return m, m.openSet(pkg)
+		case key.Matches(msg, detailKey) && ok && pkg.SetSize == 0:
+			m.expanded = true
+			return m, nil
+		case m.multi && key.Matches(msg, markKey) && ok && pkg.SetSize == 0:
+			m.toggleMark(pkg)
+			return m, nil
+		case (!m.pick && key.Matches(msg, installKey) || m.pick && key.Matches(msg, pickKey)) && ok:
+			m.install = &pkg
+			m.chosen = m.order
+			if len(m.chosen) == 0 {
+				m.chosen = []types.Package{pkg}
+			}
+			return m, tea.Quit
+		case m.pick && m.otherBranch != "" && key.Matches(msg, branchKey(m.otherBranch)):
+			m.switchBranch = true
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	var more tea.Cmd
+	switch {
+	case len(m.pending) == 0:
+	case m.list.FilterState() != list.Unfiltered:
+		// A filter has to see every result
+		more = m.loadMore(len(m.pending))
+	case m.list.Index() == len(m.list.Items())-1:
+		more = m.loadMore(pageSize)
+	}
+	return m, tea.Batch(cmd, more, m.loadMeta())
+}
+
+// openSet shows the selector of a package set, searching it for the query of the results
+func (m *browserModel) openSet(set types.Package) tea.Cmd {
+	if m.searchSet == nil {
+		return nil
+	}
+	input := textinput.New()
+	input.Placeholder = "search " + set.FullPath
+	input.SetValue(m.query)
+	m.set = &setModel{set: set, input: input}
+	if m.query == "" {
+		return m.set.input.Focus()
+	}
+	return m.searchIn(m.query)
+}
+
+// searchIn searches the open package set for query
+func (m *browserModel) searchIn(query string) tea.Cmd {
+	m.set.input.Blur()
+	m.set.searching = query
+	m.set.message = ""
+	set, find := m.set.set, m.searchSet
+	return func() tea.Msg {
+		packages, err := find(set, query)
+		return setResultMsg{set: set.FullPath, query: query, packages: packages, err: err}
+	}
+}
+
+// setResult lists the packages found in the open set, which are chosen like the results
+func (m browserModel) setResult(msg setResultMsg) (tea.Model, tea.Cmd) {
+	if m.set == nil || msg.set != m.set.set.FullPath || msg.query != m.set.searching {
+		return m, nil
+	}
+	set := *m.set
+	m.set = &set
+	set.searching = ""
+	switch {
+	case msg.err != nil:
+		set.message = msg.err.Error()
+		return m, set.input.Focus()
+	case len(msg.packages) == 0:
+		set.message = fmt.Sprintf("No packages of %s match %s", set.set.FullPath, msg.query)
+		return m, set.input.Focus()
+	}
+
+	title := fmt.Sprintf("%s matching %s", set.set.FullPath, msg.query)
+	results := newBrowserModel(title, msg.packages, m.fetchMeta)
+	if m.pick {
+		results = newPickerModel(title, msg.packages, m.fetchMeta, "", m.multi)
+	}
+	results.meta = m.meta
+	results.list.KeyMap.Quit.SetEnabled(m.list.KeyMap.Quit.Enabled())
+	results.list.SetSize(m.list.Width(), m.list.Height()-1)
+	results.keys = append(slices.Clip(results.keys), setSearchKey, leaveSetKey)
+	results.loadMore(0)
+	set.results = &results
+	return m, results.Init()
+}
+
+// updateSet handles the selector of the open package set. A package chosen there is
+// chosen together with the ones marked in the results.
+func (m browserModel) updateSet(msg tea.Msg) (tea.Model, tea.Cmd) {
+	set := *m.set
+	m.set = &set
+	keyMsg, isKey := msg.(tea.KeyMsg)
+	if set.results == nil || set.input.Focused() {
+		if isKey && set.searching != "" {
+			return m, nil
+		}
+		if isKey && keyMsg.String() == "esc" {
+			if set.results == nil {
+				m.set = nil
+			}
+			set.input.Blur()
+			return m, nil
+		}
+		if isKey && keyMsg.String() == "enter" {
+			query := strings.TrimSpace(set.input.Value())
+			if query == "" {
+				return m, nil
+			}
+			return m, m.searchIn(query)
+		}
+		var cmd tea.Cmd
+		set.input, cmd = set.input.Update(msg)
+		return m, cmd
+	}
+
+	results := *set.results
+	if isKey && !results.expanded && results.list.FilterState() == list.Unfiltered {
+		switch {
+		case key.Matches(keyMsg, leaveSetKey):
+			m.set = nil
+			return m, nil
+		case key.Matches(keyMsg, setSearchKey):
+			return m, set.input.Focus()
+		}
+	}
+	model, cmd := results.Update(msg)
+	results = model.(browserModel)
+	set.results = &results
+	if results.install != nil {
+		m.install = results.install
+		m.chosen = append(slices.Clone(m.order), results.chosen...)
+		return m, tea.Quit
+	}
+	return m, cmd
+}
+
+// setView is the selector of the open package set, its search above the packages found
+func (m browserModel) setView() string {
+	set := m.set
+	line := browserSelectedStyle.Render(set.set.FullPath+" ›") + " " + set.input.View()
+	switch {
+	case set.searching != "":
+		return line + "\n\n" + fmt.Sprintf("Searching %s for %s...", set.set.FullPath, set.searching)
+	case set.results != nil && !set.input.Focused():
+		return line + "\n" + set.results.View()
+	}
+	help := "enter search • esc back"
+	if set.message != "" {
+		help = set.message + "\n\n" + help
+	}
+	return line + "\n\n" + browserDetailStyle.Render(help)
+}
+
+// toggleMark marks the package to be chosen with the others on enter, or unmarks it
+func (m *browserModel) toggleMark(pkg types.Package) {
+	id := packageKey(pkg)
+	if m.marked[id] {
+		delete(m.marked, id)
+		m.order = slices.DeleteFunc(m.order, func(marked types.Package) bool { return packageKey(marked) == id })
+	} else {
+		m.marked[id] = true
+		m.order = append(m.order, pkg)
+	}
+	m.list.Title = m.counterTitle()
+}
+
+// counterTitle is the list title with how many results are shown and marked
+func (m browserModel) counterTitle() string {
+	var counts []string
+	if len(m.pending) > 0 {
+		counts = append(counts, fmt.Sprintf("%d of %d shown", len(m.list.Items()), m.total))
+	}
+	if len(m.order) > 0 {
+		counts = append(counts, fmt.Sprintf("%d marked", len(m.order)))
+	}
+	if len(counts) == 0 {
+		return m.title
+	}
+	return fmt.Sprintf("%s (%s)", m.title, strings.Join(counts, ", "))
+}
+
+// details returns the labelled metadata lines of the selected package. Long platform
+// lists are shortened unless all is set.
+func (m browserModel) details(pkg types.Package, all bool) []string {
+	homepage, license, maintainers, platforms := "loading…", "loading…", "loading…", "loading…"
+	meta := m.meta[pkg.FullPath]
+	switch {
+	case m.fetchMeta == nil || meta.err != nil:
+		homepage, license, maintainers, platforms = "unavailable", "unavailable", "unavailable", "unavailable"
+	case meta.loaded:
+		homepage = meta.meta.Homepage
+		license = strings.Join(meta.meta.Licenses, ", ")
+		maintainers = strings.Join(meta.meta.Maintainers, ", ")
+		platforms = strings.Join(meta.meta.Platforms, ", ")
+		if extra := len(meta.meta.Platforms) - shownPlatforms; extra > 0 && !all {
+			platforms = fmt.Sprintf("%s +%d more", strings.Join(meta.meta.Platforms[:shownPlatforms], ", "), extra)
+		}
+	}
+	lines := []string{
+		"Homepage: " + homepage,
+		"License:  " + license,
+		"Maintainers: " + maintainers,
+		"Platforms: " + platforms,
+	}
+	if systems := pkg.Systems(); len(systems) > 1 {
+		lines = append(lines, "Available on: "+strings.Join(systems, ", "))
+	}
+	return lines
+}
+
+func (m browserModel) detail() string {
+	pkg, ok := m.selected()
+	if !ok {
+		return strings.Repeat("\n", detailHeight-1)
+	}
+	if pkg.SetSize > 0 {
+		open := "i"
+		if m.pick {
+			open = "enter"
+		}
+		return browserDetailStyle.Render(fmt.Sprintf("%s\nPress %s to search only within %s", pkg.Description, open, pkg.FullPath))
+	}
+	lines := append([]string{pkg.Description}, m.details(pkg, false)...)
+	return browserDetailStyle.Render(strings.Join(lines, "\n"))
+}
+
+// expandedView is the detail screen of the selected package, with the long description
+// and every platform
+func (m browserModel) expandedView() string {
+	pkg, _ := m.selected()
+	width := max(m.list.Width(), 20)
+	wrap := lipgloss.NewStyle().Width(width)
+
+	lines := []string{browserSelectedStyle.Render(fmt.Sprintf("%s %s", pkg.FullPath, pkg.Version)), "", wrap.Render(pkg.Description)}
+	if meta := m.meta[pkg.FullPath]; meta.loaded && meta.meta.LongDescription != "" {
+		lines = append(lines, "", wrap.Render(strings.TrimSpace(meta.meta.LongDescription)))
+	}
+	lines = append(lines, "")
+	for _, line := range m.details(pkg, true) {
+		lines = append(lines, wrap.Render(line))
+	}
+	if meta := m.meta[pkg.FullPath]; meta.loaded {
+		if meta.meta.MainProgram != "" {
+			lines = append(lines, "Program: "+meta.meta.MainProgram)
+		}
+		for _, warning := range meta.meta.Warnings(pkg.Systems()) {
+			lines = append(lines, wrap.Render(fmt.Sprintf("Warning: %s %s", pkg.PName, warning)))
+		}
+	}
+	lines = append(lines, "", browserDetailStyle.Render("tab back"))
+	return strings.Join(lines, "\n")
+}
+
+func (m browserModel) View() string {
+	if m.set != nil {
+		return m.setView()
+	}
+	if m.expanded {
+		return m.expandedView()
+	}
+	header := browserHeaderStyle.Render(packageColumns("PACKAGE", "VERSION", "PLATFORM", "DESCRIPTION", m.list.Width()))
+	return header + "\n" + m.list.View() + "\n" + m.detail()
+}
+
+// BrowsePackages shows packages in a filterable list with their details. It returns the
+// package the user chose to install, or nil when they quit without choosing one.
+// Package sets among the packages are searched for query with searchSet when opened.
+func BrowsePackages(title string, query string, packages []types.Package, fetchMeta MetaFetcher, searchSet SetSearcher) (*types.Package, error) {
+	m := newBrowserModel(title, packages, fetchMeta)
+	m.query, m.searchSet = query, searchSet
+	final, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, err
+	}
+	return final.(browserModel).install, nil
+}
+
+// PickPackages shows packages like BrowsePackages and returns the one chosen with enter.
+// With multi, space marks several packages and enter returns the marked ones instead.
+// When otherBranch is set, b returns switchBranch instead to search that nixpkgs branch.
+// No packages are returned when the user quit without choosing.
+func PickPackages(title string, query string, packages []types.Package, fetchMeta MetaFetcher, searchSet SetSearcher, otherBranch string, multi bool) (chosen []types.Package, switchBranch bool, err error) {
+	m := newPickerModel(title, packages, fetchMeta, otherBranch, multi)
+	m.query, m.searchSet = query, searchSet
+	final, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, false, err
+	}
+	model := final.(browserModel)
+	return model.chosen, model.switchBranch, nil
+}
@@ -0,0 +1,323 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/search"
+	"pam/internal/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		width int
+		want  string
+	}{
+		{name: "pads short text", input: "vim", width: 6, want: "vim   "},
+		{name: "truncates long text", input: "firefox-esr", width: 8, want: "firefox…"},
+		{name: "no room", input: "vim", width: 0, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fit(tt.input, tt.width); got != tt.want {
+				t.Errorf("fit(%q, %d) = %q, want %q", tt.input, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlatformLabel(t *testing.T) {
+	tests := []struct {
+		system string
+		want   string
+	}{
+		{system: "x86_64-linux", want: "x86_64-linux"},
+		{system: "aarch64-darwin,x86_64-linux", want: "aarch64-darwin +1"},
+		{system: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := platformLabel(types.Package{System: tt.system}); got != tt.want {
+			t.Errorf("platformLabel(%q) = %q, want %q", tt.system, got, tt.want)
+		}
+	}
+}
+
+func TestBrowserModel(t *testing.T) {
+	packages := []types.Package{
+		{PName: "firefox", FullPath: "firefox", Version: "121.0", System: "x86_64-linux", Description: "A web browser"},
+		{PName: "firefox-esr", FullPath: "firefox-esr", Version: "115.6", System: "x86_64-linux", Description: "Extended support release"},
+	}
+	fetched := map[string]bool{}
+	fetch := func(pkg types.Package) (search.Meta, error) {
+		fetched[pkg.FullPath] = true
+		if pkg.FullPath == "firefox-esr" {
+			return search.Meta{}, errors.New("eval failed")
+		}
+		return search.Meta{
+			Homepage:        "https://www.mozilla.org/firefox/",
+			Licenses:        []string{"MPL-2.0"},
+			LongDescription: "Mozilla Firefox is a free and open-source web browser.",
+			Maintainers:     []string{"mweinelt"},
+			Platforms:       []string{"x86_64-linux", "aarch64-linux", "x86_64-darwin", "aarch64-darwin", "i686-linux"},
+		}, nil
+	}
+
+	var model tea.Model = newBrowserModel("Results for fire", packages, fetch)
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	if !strings.Contains(model.View(), "Homepage: loading…") {
+		t.Errorf("View() before the lookup finished:\n%s", model.View())
+	}
+
+	msg := model.Init()()
+	model, _ = model.Update(msg)
+	view := model.View()
+	for _, want := range []string{"firefox", "121.0", "x86_64-linux", "Homepage: https://www.mozilla.org/firefox/", "License:  MPL-2.0", "Maintainers: mweinelt", "aarch64-darwin +1 more"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() missing %q:\n%s", want, view)
+		}
+	}
+
+	model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	for _, msg := range collect(cmd) {
+		model, _ = model.Update(msg)
+	}
+	if !fetched["firefox-esr"] || !strings.Contains(model.View(), "Homepage: unavailable") {
+		t.Errorf("moving down did not load the next package:\n%s", model.View())
+	}
+
+	model, cmd = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'i'}})
+	if cmd == nil {
+		t.Fatal("pressing i did not quit")
+	}
+	if got := model.(browserModel).install; got == nil || got.FullPath != "firefox-esr" {
+		t.Errorf("install = %+v, want firefox-esr", got)
+	}
+}
+
+func TestBrowserModel_Pick(t *testing.T) {
+	packages := []types.Package{
+		{PName: "ripgrep", FullPath: "ripgrep", Version: "14.1.0", System: "x86_64-linux", Description: "A fast grep"},
+	}
+	fetch := func(pkg types.Package) (search.Meta, error) {
+		return search.Meta{LongDescription: "Recursively searches directories.", Platforms: []string{"x86_64-linux", "aarch64-linux", "x86_64-darwin", "aarch64-darwin", "i686-linux"}}, nil
+	}
+
+	tests := []struct {
+		name         string
+		key          tea.KeyMsg
+		otherBranch  string
+		wantPicked   bool
+		switchBranch bool
+	}{
+		{name: "enter picks", key: tea.KeyMsg{Type: tea.KeyEnter}, wantPicked: true},
+		{name: "i does nothing", key: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'i'}}},
+		{name: "b switches branch", key: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'b'}}, otherBranch: "unstable", switchBranch: true},
+		{name: "b without other branch", key: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'b'}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model tea.Model = newPickerModel("Pick", packages, fetch, tt.otherBranch, false)
+			model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+			model, _ = model.Update(model.Init()())
+			model, _ = model.Update(tt.key)
+
+			picker := model.(browserModel)
+			if got := picker.install != nil; got != tt.wantPicked {
+				t.Errorf("picked = %v, want %v", got, tt.wantPicked)
+			}
+			if picker.switchBranch != tt.switchBranch {
+				t.Errorf("switchBranch = %v, want %v", picker.switchBranch, tt.switchBranch)
+			}
+		})
+	}
+
+	var model tea.Model = newPickerModel("Pick", packages, fetch, "", false)
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	model, _ = model.Update(model.Init()())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyTab})
+	view := model.View()
+	for _, want := range []string{"Recursively searches directories.", "i686-linux"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("detail screen missing %q:\n%s", want, view)
+		}
+	}
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if model.(browserModel).install != nil {
+		t.Error("enter on the detail screen picked the package")
+	}
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if model.(browserModel).expanded {
+		t.Error("esc did not close the detail screen")
+	}
+}
+
+func TestBrowserModel_PickMarked(t *testing.T) {
+	packages := []types.Package{
+		{PName: "ripgrep", FullPath: "ripgrep", Version: "14.1.0", System: "x86_64-linux"},
+		{PName: "ripgrep-all", FullPath: "ripgrep-all", Version: "0.10.6", System: "x86_64-linux"},
+		{PName: "ugrep", FullPath: "ugrep", Version: "6.0", System: "x86_64-linux"},
+	}
+	space := tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+	down := tea.KeyMsg{Type: tea.KeyDown}
+
+	var model tea.Model = newPickerModel("Pick", packages, nil, "", true)
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	// Mark ugrep and ripgrep-all, then ripgrep, and unmark ugrep again
+	for _, msg := range []tea.Msg{down, down, space, tea.KeyMsg{Type: tea.KeyUp}, space, tea.KeyMsg{Type: tea.KeyUp}, space, down, down, space} {
+		model, _ = model.Update(msg)
+	}
+	if view := model.View(); !strings.Contains(view, "Pick (2 marked)") || !strings.Contains(view, "✓ripgrep-all") {
+		t.Errorf("View() missing the marks:\n%s", view)
+	}
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	var got []string
+	for _, pkg := range model.(browserModel).chosen {
+		got = append(got, pkg.FullPath)
+	}
+	if !slices.Equal(got, []string{"ripgrep-all", "ripgrep"}) {
+		t.Errorf("chosen = %v, want the marked packages in the order they were marked", got)
+	}
+
+	model = newPickerModel("Pick", packages, nil, "", true)
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if chosen := model.(browserModel).chosen; len(chosen) != 1 || chosen[0].FullPath != "ripgrep" {
+		t.Errorf("chosen = %v, want the highlighted package when none is marked", chosen)
+	}
+
+	model = newPickerModel("Pick", packages, nil, "", false)
+	model, _ = model.Update(space)
+	if len(model.(browserModel).order) != 0 {
+		t.Error("space marked a package in a single choice picker")
+	}
+}
+
+func TestBrowserModel_PackageSet(t *testing.T) {
+	packages := []types.Package{
+		{PName: "telescope", FullPath: "telescope", Version: "0.4", System: "x86_64-linux"},
+		{PName: "vimPlugins", FullPath: "vimPlugins", System: "x86_64-linux", Description: "Package set with 2 matching packages", SetSize: 2},
+	}
+	var searched []string
+	searchSet := func(set types.Package, query string) ([]types.Package, error) {
+		searched = append(searched, set.FullPath+" "+query)
+		if query != "tele" {
+			return nil, nil
+		}
+		return []types.Package{
+			{PName: "telescope-nvim", FullPath: "vimPlugins.telescope-nvim", System: "x86_64-linux"},
+			{PName: "telescope-fzf-native-nvim", FullPath: "vimPlugins.telescope-fzf-native-nvim", System: "x86_64-linux"},
+		}, nil
+	}
+	run := func(model tea.Model, msg tea.Msg) tea.Model {
+		model, cmd := model.Update(msg)
+		if cmd != nil {
+			if result, ok := cmd().(setResultMsg); ok {
+				model, _ = model.Update(result)
+			}
+		}
+		return model
+	}
+
+	picker := newPickerModel("Pick", packages, nil, "", true)
+	picker.query, picker.searchSet = "tele", searchSet
+	var model tea.Model = picker
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	if view := model.View(); !strings.Contains(view, "vimPlugins ›") || !strings.Contains(view, "2 pkgs") {
+		t.Errorf("View() doesn't show the set:\n%s", view)
+	}
+	model = press(model, spaceKey, downKey, spaceKey)
+	if marked := model.(browserModel).order; len(marked) != 1 {
+		t.Errorf("marked = %v, want the set left unmarked", marked)
+	}
+
+	model = run(model, enterKey)
+	if model.(browserModel).install != nil || !slices.Equal(searched, []string{"vimPlugins tele"}) {
+		t.Fatalf("enter on the set chose %v and searched %v, want the set searched for the query", model.(browserModel).install, searched)
+	}
+	if view := model.View(); !strings.Contains(view, "vimPlugins matching tele") || !strings.Contains(view, "vimPlugins.telescope-nvim") {
+		t.Errorf("View() doesn't show the packages of the set:\n%s", view)
+	}
+
+	// A search without results keeps the input, esc leaves the set
+	model = press(model, runeKey('s'), runeKey('x'))
+	model = run(model, enterKey)
+	if view := model.View(); !strings.Contains(view, "No packages of vimPlugins match telex") {
+		t.Errorf("View() after a search without results:\n%s", view)
+	}
+	model = press(model, escKey, escKey)
+	if model.(browserModel).set != nil {
+		t.Fatal("esc did not return to the results")
+	}
+
+	model = run(model, enterKey)
+	model = press(model, downKey, enterKey)
+	var got []string
+	for _, pkg := range model.(browserModel).chosen {
+		got = append(got, pkg.FullPath)
+	}
+	if !slices.Equal(got, []string{"telescope", "vimPlugins.telescope-fzf-native-nvim"}) {
+		t.Errorf("chosen = %v, want the marked package and the one chosen in the set", got)
+	}
+}
+
+func TestBrowserModel_Pages(t *testing.T) {
+	packages := make([]types.Package, 2*pageSize+50)
+	for i := range packages {
+		packages[i] = types.Package{PName: fmt.Sprintf("go-%d", i), FullPath: fmt.Sprintf("go-%d", i)}
+	}
+
+	var model tea.Model = newBrowserModel("Results for go", packages, nil)
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	if got := len(model.(browserModel).list.Items()); got != pageSize {
+		t.Fatalf("listed %d results at first, want %d", got, pageSize)
+	}
+	if !strings.Contains(model.View(), fmt.Sprintf("Results for go (%d of %d shown)", pageSize, len(packages))) {
+		t.Errorf("View() missing the result counter:\n%s", model.View())
+	}
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'m'}})
+	if got := len(model.(browserModel).list.Items()); got != 2*pageSize {
+		t.Errorf("listed %d results after m, want %d", got, 2*pageSize)
+	}
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnd})
+	browser := model.(browserModel)
+	if got := len(browser.list.Items()); got != len(packages) {
+		t.Errorf("listed %d results after reaching the end, want %d", got, len(packages))
+	}
+	if strings.Contains(browser.list.Title, "shown") {
+		t.Errorf("title %q still counts the results once all are listed", browser.list.Title)
+	}
+
+	model = newBrowserModel("Results for go", packages, nil)
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	if got := len(model.(browserModel).list.Items()); got != len(packages) {
+		t.Errorf("listed %d results when filtering, want every one of %d", got, len(packages))
+	}
+}
+
+// collect runs cmd and every command it batches, returning the messages they produce
+func collect(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		var msgs []tea.Msg
+		for _, c := range batch {
+			msgs = append(msgs, collect(c)...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
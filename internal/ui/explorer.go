@@ -0,0 +1,346 @@
+package ui
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"pam/internal/inventory"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Actions the flake explorer hands back to run outside of it
+const (
+	ExploreEnable    = "enable"
+	ExploreDisable   = "disable"
+	ExploreUninstall = "uninstall"
+)
+
+// ExplorerAction is what the user chose to do in the flake explorer
+type ExplorerAction struct {
+	// Verb is ExploreEnable, ExploreDisable or ExploreUninstall
+	Verb     string
+	Package  string
+	Category string
+	// Host is the highlighted host, the one enable and disable change
+	Host string
+}
+
+var (
+	toggleTreeKey   = key.NewBinding(key.WithKeys("enter", " "), key.WithHelp("enter", "expand/collapse"))
+	switchPaneKey   = key.NewBinding(key.WithKeys("tab", "left", "right", "h", "l"), key.WithHelp("tab", "switch pane"))
+	explorerUpKey   = key.NewBinding(key.WithKeys("up", "k"))
+	explorerDownKey = key.NewBinding(key.WithKeys("down", "j"))
+	enableKey       = key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "enable"))
+	disableKey      = key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "disable"))
+	uninstallKey    = key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "uninstall"))
+	quitKey         = key.NewBinding(key.WithKeys("q", "esc", "ctrl+c"), key.WithHelp("q", "quit"))
+)
+
+// explorerHeight is the number of lines around the panes: header, detail, blank and help
+const explorerHeight = 4
+
+// explorerModule is a module of the tree with the hosts enabling it
+type explorerModule struct {
+	pkg      string
+	category string
+	enabled  []string
+}
+
+// explorerRow is a line of the tree, a category or a module in one
+type explorerRow struct {
+	category string
+	module   *explorerModule
+	depth    int
+}
+
+type explorerModel struct {
+	hosts []string
+	// categories holds every category with its parents, sorted, and modules their modules
+	categories []string
+	modules    map[string][]*explorerModule
+	collapsed  map[string]bool
+
+	// inHosts is set while the host pane has the focus
+	inHosts    bool
+	hostCursor int
+	cursor     int
+	offset     int
+	width      int
+	height     int
+	message    string
+
+	action *ExplorerAction
+}
+
+func newExplorerModel(hostNames []string, entries []inventory.Entry) explorerModel {
+	m := explorerModel{
+		hosts:     hostNames,
+		modules:   map[string][]*explorerModule{},
+		collapsed: map[string]bool{},
+		height:    24,
+	}
+	for _, entry := range entries {
+		i := slices.IndexFunc(m.modules[entry.Category], func(module *explorerModule) bool { return module.pkg == entry.Package })
+		if i < 0 {
+			m.modules[entry.Category] = append(m.modules[entry.Category], &explorerModule{pkg: entry.Package, category: entry.Category})
+			i = len(m.modules[entry.Category]) - 1
+		}
+		if entry.Enabled {
+			m.modules[entry.Category][i].enabled = append(m.modules[entry.Category][i].enabled, entry.Host)
+		}
+	}
+	for category, found := range m.modules {
+		slices.SortFunc(found, func(a, b *explorerModule) int { return strings.Compare(a.pkg, b.pkg) })
+		// Parents such as cli of cli/editors get a row of their own
+		for name := category; name != "." && name != ""; name = path.Dir(name) {
+			if !slices.Contains(m.categories, name) {
+				m.categories = append(m.categories, name)
+			}
+		}
+	}
+	slices.Sort(m.categories)
+	return m
+}
+
+// rows returns the lines of the tree, leaving out what collapsed categories hold
+func (m explorerModel) rows() []explorerRow {
+	var rows []explorerRow
+	for _, category := range m.categories {
+		if m.hidden(category) {
+			continue
+		}
+		depth := strings.Count(category, "/")
+		rows = append(rows, explorerRow{category: category, depth: depth})
+		if m.collapsed[category] {
+			continue
+		}
+		for _, module := range m.modules[category] {
+			rows = append(rows, explorerRow{module: module, depth: depth + 1})
+		}
+	}
+	return rows
+}
+
+// hidden reports whether a parent of category is collapsed
+func (m explorerModel) hidden(category string) bool {
+	for parent := path.Dir(category); parent != "."; parent = path.Dir(parent) {
+		if m.collapsed[parent] {
+			return true
+		}
+	}
+	return false
+}
+
+func (m explorerModel) host() string {
+	if len(m.hosts) == 0 {
+		return ""
+	}
+	return m.hosts[m.hostCursor]
+}
+
+func (m explorerModel) selectedModule() *explorerModule {
+	rows := m.rows()
+	if m.cursor >= len(rows) {
+		return nil
+	}
+	return rows[m.cursor].module
+}
+
+// treeHeight is the number of tree rows that fit
+func (m explorerModel) treeHeight() int {
+	return max(m.height-explorerHeight, 1)
+}
+
+// scroll keeps the cursor inside the shown part of the tree
+func (m *explorerModel) scroll() {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+m.treeHeight() {
+		m.offset = m.cursor - m.treeHeight() + 1
+	}
+}
+
+func (m explorerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m explorerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+		return m, nil
+	case tea.KeyMsg:
+		m.message = ""
+		switch {
+		case key.Matches(msg, quitKey):
+			return m, tea.Quit
+		case key.Matches(msg, switchPaneKey):
+			m.inHosts = !m.inHosts && len(m.hosts) > 0
+		case key.Matches(msg, explorerUpKey):
+			m.move(-1)
+		case key.Matches(msg, explorerDownKey):
+			m.move(1)
+		case key.Matches(msg, toggleTreeKey) && !m.inHosts:
+			if rows := m.rows(); m.cursor < len(rows) && rows[m.cursor].module == nil {
+				category := rows[m.cursor].category
+				m.collapsed[category] = !m.collapsed[category]
+			}
+		case key.Matches(msg, enableKey, disableKey, uninstallKey):
+			return m.act(msg)
+		}
+	}
+	return m, nil
+}
+
+// move goes up or down in the pane with the focus
+func (m *explorerModel) move(by int) {
+	if m.inHosts {
+		m.hostCursor = min(max(m.hostCursor+by, 0), len(m.hosts)-1)
+		return
+	}
+	m.cursor = min(max(m.cursor+by, 0), max(len(m.rows())-1, 0))
+	m.scroll()
+}
+
+// act ends the explorer with the action of the key on the highlighted module, or says why
+// it doesn't apply
+func (m explorerModel) act(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	module := m.selectedModule()
+	if module == nil {
+		m.message = "Highlight a module first"
+		return m, nil
+	}
+	action := ExplorerAction{Package: module.pkg, Category: module.category, Host: m.host()}
+	enabled := slices.Contains(module.enabled, action.Host)
+	switch {
+	case key.Matches(msg, uninstallKey):
+		action.Verb = ExploreUninstall
+	case action.Host == "":
+		m.message = "The flake has no hosts"
+		return m, nil
+	case key.Matches(msg, enableKey) && enabled:
+		m.message = fmt.Sprintf("%s is already enabled on %s", module.pkg, action.Host)
+		return m, nil
+	case key.Matches(msg, disableKey) && !enabled:
+		m.message = fmt.Sprintf("%s is already disabled on %s", module.pkg, action.Host)
+		return m, nil
+	case key.Matches(msg, enableKey):
+		action.Verb = ExploreEnable
+	default:
+		action.Verb = ExploreDisable
+	}
+	m.action = &action
+	return m, tea.Quit
+}
+
+// hostPane lists the hosts with the number of modules each enables
+func (m explorerModel) hostPane() string {
+	width := len("HOSTS")
+	for _, host := range m.hosts {
+		width = max(width, lipgloss.Width(host))
+	}
+	lines := []string{browserHeaderStyle.Render(fit("HOSTS", width+6))}
+	for i, host := range m.hosts {
+		count := 0
+		for _, found := range m.modules {
+			for _, module := range found {
+				if slices.Contains(module.enabled, host) {
+					count++
+				}
+			}
+		}
+		line := fmt.Sprintf("  %s %3d", fit(host, width), count)
+		if i == m.hostCursor {
+			line = "▸" + line[1:]
+			if m.inHosts {
+				line = browserSelectedStyle.Render(line)
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(m.hosts) == 0 {
+		lines = append(lines, browserDetailStyle.Render("  no hosts"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// treePane shows the categories and modules, ● marking the modules the highlighted host enables
+func (m explorerModel) treePane() string {
+	header := "MODULES"
+	if host := m.host(); host != "" {
+		header = fmt.Sprintf("MODULES (● enabled on %s)", host)
+	}
+	lines := []string{browserHeaderStyle.Render(header)}
+	rows := m.rows()
+	if len(rows) == 0 {
+		lines = append(lines, browserDetailStyle.Render("  no pam-managed modules"))
+	}
+	end := min(m.offset+m.treeHeight(), len(rows))
+	for i := m.offset; i < end; i++ {
+		row := rows[i]
+		indent := strings.Repeat("  ", row.depth)
+		var line string
+		if row.module == nil {
+			marker := "▾"
+			if m.collapsed[row.category] {
+				marker = "▸"
+			}
+			line = fmt.Sprintf("  %s%s %s/", indent, marker, path.Base(row.category))
+		} else {
+			state := "○"
+			if slices.Contains(row.module.enabled, m.host()) {
+				state = "●"
+			}
+			line = fmt.Sprintf("  %s%s %s", indent, state, row.module.pkg)
+			line = fmt.Sprintf("%s %d/%d", fit(line, 36), len(row.module.enabled), len(m.hosts))
+		}
+		if i == m.cursor && !m.inHosts {
+			line = browserSelectedStyle.Render("▸" + line[1:])
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// detail describes the highlighted module, or the message of the last key
+func (m explorerModel) detail() string {
+	if m.message != "" {
+		return wizardErrorStyle.Render(m.message)
+	}
+	module := m.selectedModule()
+	if module == nil {
+		return ""
+	}
+	enabled := "enabled on no host"
+	if len(module.enabled) > 0 {
+		enabled = "enabled on " + strings.Join(module.enabled, ", ")
+	}
+	return browserDetailStyle.Render(fmt.Sprintf("%s in %s, %s", module.pkg, module.category, enabled))
+}
+
+func (m explorerModel) View() string {
+	panes := lipgloss.JoinHorizontal(lipgloss.Top, m.hostPane(), "   ", m.treePane())
+	help := "tab switch pane • enter expand/collapse • e enable • d disable • u uninstall • q quit"
+	if host := m.host(); host != "" {
+		help = fmt.Sprintf("tab switch pane • enter expand/collapse • e enable on %s • d disable on %s • u uninstall • q quit", host, host)
+	}
+	return panes + "\n" + m.detail() + "\n\n" + browserDetailStyle.Render(help)
+}
+
+// ExploreFlake shows the hosts of the flake next to a tree of its categories and modules,
+// with the state of each module on the highlighted host. It changes nothing itself and
+// returns the action chosen on a module, or nil when the user quit.
+func ExploreFlake(hostNames []string, entries []inventory.Entry) (*ExplorerAction, error) {
+	final, err := tea.NewProgram(newExplorerModel(hostNames, entries), tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, err
+	}
+	return final.(explorerModel).action, nil
+}
@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/inventory"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func explorerEntries() []inventory.Entry {
+	return []inventory.Entry{
+		{Host: "desktop", Package: "firefox", Category: "browsers", Enabled: true},
+		{Host: "desktop", Package: "helix", Category: "cli/editors", Enabled: false},
+		{Host: "laptop", Package: "firefox", Category: "browsers", Enabled: true},
+		{Host: "laptop", Package: "helix", Category: "cli/editors", Enabled: true},
+	}
+}
+
+func TestExplorerModel_Tree(t *testing.T) {
+	m := newExplorerModel([]string{"desktop", "laptop"}, explorerEntries())
+	var got []string
+	for _, row := range m.rows() {
+		if row.module != nil {
+			got = append(got, row.module.pkg)
+		} else {
+			got = append(got, row.category+"/")
+		}
+	}
+	if want := []string{"browsers/", "firefox", "cli/", "cli/editors/", "helix"}; !slices.Equal(got, want) {
+		t.Fatalf("rows() = %v, want %v", got, want)
+	}
+
+	// Collapsing cli hides its subcategory
+	var model tea.Model = m
+	model = press(model, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown}, enterKey)
+	if rows := model.(explorerModel).rows(); len(rows) != 3 {
+		t.Errorf("rows after collapsing cli = %d, want 3", len(rows))
+	}
+	if view := model.View(); !strings.Contains(view, "▸ cli/") || strings.Contains(view, "helix") {
+		t.Errorf("View() after collapsing cli:\n%s", view)
+	}
+}
+
+func TestExplorerModel_Actions(t *testing.T) {
+	var model tea.Model = newExplorerModel([]string{"desktop", "laptop"}, explorerEntries())
+
+	// A category isn't acted on
+	model = press(model, runeKey('u'))
+	if m := model.(explorerModel); m.action != nil || m.message == "" {
+		t.Fatalf("u on a category: action %+v, message %q", m.action, m.message)
+	}
+
+	// firefox is already enabled on desktop
+	model = press(model, tea.KeyMsg{Type: tea.KeyDown}, runeKey('e'))
+	if m := model.(explorerModel); m.action != nil || !strings.Contains(m.View(), "already enabled on desktop") {
+		t.Fatalf("e on an enabled module: action %+v\n%s", m.action, m.View())
+	}
+
+	// helix is enabled on desktop from the tree after picking desktop in the host pane
+	model = press(model, tea.KeyMsg{Type: tea.KeyTab}, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeyTab})
+	model = press(model, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown})
+	model, cmd := model.Update(runeKey('e'))
+	want := ExplorerAction{Verb: ExploreEnable, Package: "helix", Category: "cli/editors", Host: "desktop"}
+	if m := model.(explorerModel); m.action == nil || *m.action != want || cmd == nil {
+		t.Errorf("e on helix: action %+v, want %+v", m.action, want)
+	}
+}
@@ -22,7 +22,26 @@ func GetDirNames(path string) ([]string, error) {
 	return dirs, nil
 }
 
-// FormatPackageOption formats a package for display in selection UI
+// FormatPackageOption formats a package for display in selection UI, naming the source
+// of packages that don't come from nixpkgs
 func FormatPackageOption(pkg *types.Package) string {
-	return fmt.Sprintf("%s (%s) - %s", pkg.PName, pkg.Version, pkg.System)
+	label := fmt.Sprintf("%s (%s) - %s", pkg.PName, pkg.Version, pkg.System)
+	if pkg.Source != "" {
+		label += fmt.Sprintf(" [%s]", pkg.Source)
+	}
+	return label
+}
+
+// UserCancelled is returned when the user quits a form or picker without choosing, so
+// pam can exit with a status telling it apart from a failure
+type UserCancelled struct {
+	// Action is what was cancelled, e.g. Install
+	Action string
+}
+
+func (e *UserCancelled) Error() string {
+	if e.Action == "" {
+		return "cancelled"
+	}
+	return e.Action + " cancelled"
 }
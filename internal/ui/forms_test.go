@@ -90,6 +90,16 @@ func TestFormatPackageOption(t *testing.T) {
 			},
 			want: "firefox (120.0) - x86_64-linux",
 		},
+		{
+			name: "package from another source",
+			pkg: &types.Package{
+				PName:   "emacs-git",
+				Version: "30.0.50",
+				System:  "x86_64-linux",
+				Source:  "emacs-overlay",
+			},
+			want: "emacs-git (30.0.50) - x86_64-linux [emacs-overlay]",
+		},
 		{
 			name: "darwin package",
 			pkg: &types.Package{
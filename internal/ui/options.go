@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"pam/internal/options"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Column widths of the option list, the description takes the remaining width
+const (
+	optionNameWidth = 44
+	optionTypeWidth = 20
+	// optionDetailHeight is the number of lines below the list showing the selected option
+	optionDetailHeight = 4
+)
+
+type optionItem struct {
+	option options.Option
+}
+
+func (i optionItem) FilterValue() string {
+	return i.option.Name + " " + i.option.Description
+}
+
+// optionColumns renders one row of the option table
+func optionColumns(name, optionType, description string, width int) string {
+	rest := width - optionNameWidth - optionTypeWidth - 2
+	return "  " + fit(name, optionNameWidth) + fit(optionType, optionTypeWidth) + fit(description, rest)
+}
+
+// firstLine returns the first line of a markdown description
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+type optionDelegate struct{}
+
+func (d optionDelegate) Height() int                               { return 1 }
+func (d optionDelegate) Spacing() int                              { return 0 }
+func (d optionDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd { return nil }
+
+func (d optionDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	option := item.(optionItem).option
+	row := optionColumns(option.Name, option.Type, firstLine(option.Description), m.Width())
+	if index == m.Index() {
+		row = browserSelectedStyle.Render("▸" + row[1:])
+	}
+	fmt.Fprint(w, row)
+}
+
+type optionsModel struct {
+	list list.Model
+	// chosen is the option the user pressed enter on
+	chosen *options.Option
+	// expanded shows every detail of the selected option instead of the list
+	expanded bool
+}
+
+func newOptionsModel(title string, found []options.Option) optionsModel {
+	items := make([]list.Item, len(found))
+	for i, option := range found {
+		items[i] = optionItem{option: option}
+	}
+	results := list.New(items, optionDelegate{}, 100, 20)
+	results.Title = title
+	results.SetStatusBarItemName("option", "options")
+	keys := []key.Binding{pickKey, detailKey}
+	results.AdditionalShortHelpKeys = func() []key.Binding { return keys }
+	results.AdditionalFullHelpKeys = func() []key.Binding { return keys }
+	return optionsModel{list: results}
+}
+
+func (m optionsModel) selected() (options.Option, bool) {
+	item, ok := m.list.SelectedItem().(optionItem)
+	return item.option, ok
+}
+
+func (m optionsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m optionsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width, msg.Height-optionDetailHeight-1)
+		return m, nil
+	case tea.KeyMsg:
+		if m.expanded {
+			if key.Matches(msg, backKey) {
+				m.expanded = false
+			}
+			return m, nil
+		}
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		option, ok := m.selected()
+		switch {
+		case key.Matches(msg, detailKey) && ok:
+			m.expanded = true
+			return m, nil
+		case key.Matches(msg, pickKey) && ok:
+			m.chosen = &option
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+// valueOrNone shows a default or example, which options may not have
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+func (m optionsModel) detail() string {
+	option, ok := m.selected()
+	if !ok {
+		return strings.Repeat("\n", optionDetailHeight-1)
+	}
+	lines := []string{
+		firstLine(option.Description),
+		"Type:    " + option.Type,
+		"Default: " + firstLine(valueOrNone(option.Default)),
+	}
+	return browserDetailStyle.Render(strings.Join(lines, "\n"))
+}
+
+// expandedView is the detail screen of the selected option, with the whole description,
+// the default and example and the files declaring it
+func (m optionsModel) expandedView() string {
+	option, _ := m.selected()
+	width := max(m.list.Width(), 20)
+	wrap := lipgloss.NewStyle().Width(width)
+
+	lines := []string{browserSelectedStyle.Render(option.Name), "", wrap.Render(option.Description), ""}
+	lines = append(lines, wrap.Render("Type: "+option.Type))
+	if option.ReadOnly {
+		lines = append(lines, "Read-only")
+	}
+	lines = append(lines, "Default: "+valueOrNone(option.Default))
+	if option.Example != "" {
+		lines = append(lines, "Example: "+option.Example)
+	}
+	if len(option.Declarations) > 0 {
+		lines = append(lines, "", "Declared in:")
+		for _, declaration := range option.Declarations {
+			lines = append(lines, "  "+declaration)
+		}
+	}
+	lines = append(lines, "", browserDetailStyle.Render("tab back"))
+	return strings.Join(lines, "\n")
+}
+
+func (m optionsModel) View() string {
+	if m.expanded {
+		return m.expandedView()
+	}
+	header := browserHeaderStyle.Render(optionColumns("OPTION", "TYPE", "DESCRIPTION", m.list.Width()))
+	return header + "\n" + m.list.View() + "\n" + m.detail()
+}
+
+// PickOption shows options in a filterable list with their type and default, tab shows
+// the description, example and declarations of one. It returns the option chosen with
+// enter, or nil when the user quit without choosing one.
+func PickOption(title string, found []options.Option) (*options.Option, error) {
+	final, err := tea.NewProgram(newOptionsModel(title, found), tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, err
+	}
+	return final.(optionsModel).chosen, nil
+}
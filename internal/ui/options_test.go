@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"pam/internal/options"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestOptionsModel(t *testing.T) {
+	found := []options.Option{
+		{Name: "services.openssh.enable", Type: "boolean", Description: "Whether to enable the OpenSSH secure shell daemon.", Default: "false", Example: "true"},
+		{
+			Name:         "services.openssh.ports",
+			Type:         "list of 16 bit unsigned integer",
+			Description:  "Specifies on which ports the SSH daemon listens.\n\nMore text.",
+			Default:      "[ 22 ]",
+			Declarations: []string{"<nixpkgs/nixos/modules/services/networking/ssh/sshd.nix>"},
+		},
+	}
+
+	var model tea.Model = newOptionsModel("Options for openssh", found)
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 140, Height: 30})
+	view := model.View()
+	for _, want := range []string{"OPTION", "services.openssh.enable", "boolean", "Type:    boolean", "Default: false"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() missing %q:\n%s", want, view)
+		}
+	}
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyTab})
+	view = model.View()
+	for _, want := range []string{"More text.", "Default: [ 22 ]", "Declared in:", "sshd.nix"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expanded View() missing %q:\n%s", want, view)
+		}
+	}
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if model.(optionsModel).chosen != nil {
+		t.Error("enter on the detail screen chose the option")
+	}
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyTab})
+	model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("pressing enter did not quit")
+	}
+	if got := model.(optionsModel).chosen; got == nil || got.Name != "services.openssh.ports" {
+		t.Errorf("chosen = %+v, want services.openssh.ports", got)
+	}
+}
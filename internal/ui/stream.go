@@ -0,0 +1,160 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"pam/internal/execx"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// streamHeight is the number of output lines visible while a command runs
+const streamHeight = 15
+
+// logHeight is the number of log lines StreamLog keeps visible
+const logHeight = 8
+
+var (
+	streamTitleStyle = lipgloss.NewStyle().Bold(true)
+	streamHelpStyle  = lipgloss.NewStyle().Faint(true)
+)
+
+type streamLineMsg string
+
+type streamDoneMsg struct {
+	err error
+}
+
+type streamModel struct {
+	title    string
+	status   string
+	observe  func(line string) string
+	lines    []string
+	viewport viewport.Model
+	cancel   func()
+	err      error
+	// transient clears the output once the command exited
+	transient bool
+	done      bool
+	// cancelled is set when the user interrupted the command
+	cancelled bool
+}
+
+func (m streamModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m streamModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.viewport.Width = msg.Width
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			// The command is interrupted, the program quits once it has exited
+			m.cancelled = true
+			m.cancel()
+			return m, nil
+		}
+	case streamLineMsg:
+		following := m.viewport.AtBottom()
+		m.lines = append(m.lines, string(msg))
+		if m.observe != nil {
+			m.status = m.observe(string(msg))
+		}
+		m.viewport.SetContent(strings.Join(m.lines, "\n"))
+		if following {
+			m.viewport.GotoBottom()
+		}
+		return m, nil
+	case streamDoneMsg:
+		m.err = msg.err
+		m.done = true
+		return m, tea.Quit
+	}
+
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m streamModel) View() string {
+	if m.done && m.transient {
+		return ""
+	}
+	header := streamTitleStyle.Render(m.title)
+	if m.status != "" {
+		header += " · " + m.status
+	}
+	return header + "\n" + m.viewport.View() + "\n" + streamHelpStyle.Render("↑/↓ scroll · ctrl+c cancel") + "\n"
+}
+
+// StreamCommand runs args with runner while showing its combined output in a scrolling viewport.
+// observe is called with every line and returns the status shown next to the title.
+// It returns every line of output, and the error of the command when it failed, which is
+// context.Canceled when the user interrupted it with ctrl+c.
+func StreamCommand(ctx context.Context, title string, runner execx.Runner, args []string, observe func(line string) string) ([]string, error) {
+	return stream(ctx, streamModel{title: title, observe: observe, viewport: viewport.New(80, streamHeight)}, runner, args, nil)
+}
+
+// StreamLog runs args with runner, keeping its standard output while the last lines of
+// its standard error show below title, e.g. the log of a nix search. observe works as for
+// StreamCommand. The log is cleared once the command exited, the lines are returned to
+// explain a failure.
+func StreamLog(ctx context.Context, title string, runner execx.Runner, args []string, observe func(line string) string) (output []byte, lines []string, err error) {
+	var stdout bytes.Buffer
+	model := streamModel{title: title, observe: observe, viewport: viewport.New(80, logHeight), transient: true}
+	lines, err = stream(ctx, model, runner, args, &stdout)
+	return stdout.Bytes(), lines, err
+}
+
+// stream runs args while model shows the lines written to standard error, and to
+// standard output too when stdout is nil
+func stream(ctx context.Context, model streamModel, runner execx.Runner, args []string, stdout io.Writer) ([]string, error) {
+	reader, writer := io.Pipe()
+	if stdout == nil {
+		stdout = writer
+	}
+	process, err := runner.Start(ctx, stdout, writer, args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	model.cancel = func() {
+		process.Interrupt()
+	}
+	program := tea.NewProgram(model)
+
+	waitErr := make(chan error, 1)
+	go func() {
+		err := process.Wait()
+		writer.Close()
+		waitErr <- err
+	}()
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			program.Send(streamLineMsg(scanner.Text()))
+		}
+		// Drain whatever is left after an overlong line so the command never blocks on the pipe
+		io.Copy(io.Discard, reader)
+		program.Send(streamDoneMsg{err: <-waitErr})
+	}()
+
+	final, err := program.Run()
+	if err != nil {
+		return nil, err
+	}
+	result := final.(streamModel)
+	if result.cancelled && result.err != nil {
+		return result.lines, context.Canceled
+	}
+	return result.lines, result.err
+}
@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestStreamModel_Update(t *testing.T) {
+	cancelled := false
+	var model tea.Model = streamModel{
+		title:    "Rebuilding laptop",
+		observe:  func(line string) string { return "last: " + line },
+		viewport: viewport.New(80, streamHeight),
+		cancel:   func() { cancelled = true },
+	}
+
+	for _, line := range []string{"building the system configuration...", "activating the configuration..."} {
+		model, _ = model.Update(streamLineMsg(line))
+	}
+	if view := model.View(); !strings.Contains(view, "Rebuilding laptop · last: activating the configuration...") {
+		t.Errorf("View() missing status:\n%s", view)
+	}
+
+	model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if !cancelled || cmd != nil {
+		t.Errorf("ctrl+c cancelled = %v, cmd = %v, want the command interrupted without quitting", cancelled, cmd)
+	}
+
+	model, cmd = model.Update(streamDoneMsg{err: errors.New("exit status 1")})
+	if cmd == nil {
+		t.Fatal("Update() did not quit once the command exited")
+	}
+	result := model.(streamModel)
+	if len(result.lines) != 2 || result.err == nil {
+		t.Errorf("result lines = %v, err = %v", result.lines, result.err)
+	}
+}
+
+func TestStreamModel_Transient(t *testing.T) {
+	var model tea.Model = streamModel{
+		title:     "Searching nixpkgs",
+		viewport:  viewport.New(80, logHeight),
+		cancel:    func() {},
+		transient: true,
+	}
+	model, _ = model.Update(streamLineMsg("copying path '/nix/store/abc-source' from 'https://cache.nixos.org'..."))
+	if view := model.View(); !strings.Contains(view, "copying path") {
+		t.Errorf("View() while running is missing the log:\n%s", view)
+	}
+	model, _ = model.Update(streamDoneMsg{})
+	if view := model.View(); view != "" {
+		t.Errorf("View() after the command exited = %q, want it cleared", view)
+	}
+}
@@ -0,0 +1,680 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"pam/internal/types"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// WizardOptions configure the install wizard. Steps whose answer is known already are skipped.
+type WizardOptions struct {
+	// Query is searched right away when set, the wizard asks for one otherwise
+	Query string
+	// Search finds the packages matching a query
+	Search func(query string) ([]types.Package, error)
+	// FetchMeta looks up the details shown for the highlighted package
+	FetchMeta MetaFetcher
+	// SearchSet searches within a package set among the results when it is opened
+	SearchSet SetSearcher
+	// OtherBranch is offered when the results don't have the package, SwitchBranch
+	// searches it from then on and returns the branch to offer next
+	OtherBranch  string
+	SwitchBranch func() string
+	// ModulesDir holds the categories, empty skips the category step
+	ModulesDir string
+	// Categories are offered as a flat list instead of browsing ModulesDir, the ones
+	// the flake declares
+	Categories []string
+	// Hosts are offered with Selected checked, no hosts skip the hosts step
+	Hosts    []string
+	Selected []string
+	// CategoryHosts narrows Hosts down for the chosen category and returns the ones to
+	// check when Selected is empty
+	CategoryHosts func(category string) (hosts []string, selected []string)
+	// HostGroups are offered above the hosts, checking a group checks its members
+	HostGroups []HostGroup
+	// Templates are offered when there is more than one
+	Templates []string
+	// AskEditor lets the confirm step choose whether to open the module after writing it
+	AskEditor bool
+}
+
+// HostGroup is a named set of hosts from the config, offered as @<name>
+type HostGroup struct {
+	Name  string
+	Hosts []string
+}
+
+// WizardResult holds the answers of a confirmed wizard
+type WizardResult struct {
+	Query string
+	// Packages are the packages chosen for the query, several when some were marked
+	Packages   []types.Package
+	Category   string
+	Hosts      []string
+	Template   string
+	OpenEditor bool
+}
+
+type wizardStep int
+
+const (
+	searchStep wizardStep = iota
+	packageStep
+	categoryStep
+	hostsStep
+	templateStep
+	confirmStep
+)
+
+var stepNames = []string{"Search", "Package", "Category", "Hosts", "Template", "Confirm"}
+
+var (
+	wizardStepStyle  = lipgloss.NewStyle().Faint(true)
+	wizardTitleStyle = lipgloss.NewStyle().Bold(true)
+	wizardErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+// useFolder is the category option choosing the folder being browsed
+const useFolder = "Use this folder"
+
+type searchResultMsg struct {
+	query    string
+	packages []types.Package
+	err      error
+}
+
+type wizardModel struct {
+	options WizardOptions
+	step    wizardStep
+	width   int
+	height  int
+	// message explains why the current step can't go on
+	message string
+
+	input     textinput.Model
+	spinner   spinner.Model
+	searching bool
+	// noResults offers the other branch with tab on the search step
+	noResults bool
+
+	browser browserModel
+
+	// folder is the category being browsed, relative to ModulesDir
+	folder  string
+	folders []string
+	cursor  int
+	// hosts are offered on the hosts step, for the category hostsCategory
+	hosts         []string
+	hostsCategory *string
+	checked       map[string]bool
+
+	result WizardResult
+	// confirmed is set when the wizard finished with enter on the confirm step
+	confirmed bool
+}
+
+func newWizardModel(options WizardOptions) wizardModel {
+	input := textinput.New()
+	input.Placeholder = "package name"
+	input.SetValue(options.Query)
+	input.Focus()
+
+	checked := map[string]bool{}
+	for _, host := range options.Selected {
+		checked[host] = true
+	}
+	template := ""
+	if len(options.Templates) > 0 {
+		template = options.Templates[0]
+	}
+	return wizardModel{
+		options:   options,
+		input:     input,
+		spinner:   spinner.New(spinner.WithSpinner(spinner.Dot)),
+		searching: options.Query != "",
+		hosts:     options.Hosts,
+		checked:   checked,
+		result:    WizardResult{Query: options.Query, Template: template},
+		width:     100,
+		height:    30,
+	}
+}
+
+func (m wizardModel) Init() tea.Cmd {
+	if m.searching {
+		return m.searchCmd(m.result.Query)
+	}
+	return textinput.Blink
+}
+
+// search starts looking for query, showing the spinner on the search step meanwhile
+func (m *wizardModel) search(query string) tea.Cmd {
+	m.step = searchStep
+	m.searching = true
+	m.noResults = false
+	m.message = ""
+	m.result.Query = query
+	return m.searchCmd(query)
+}
+
+func (m wizardModel) searchCmd(query string) tea.Cmd {
+	find := m.options.Search
+	return tea.Batch(m.spinner.Tick, func() tea.Msg {
+		packages, err := find(query)
+		return searchResultMsg{query: query, packages: packages, err: err}
+	})
+}
+
+func (m wizardModel) skipped(step wizardStep) bool {
+	switch step {
+	case categoryStep:
+		return m.options.ModulesDir == ""
+	case hostsStep:
+		return len(m.options.Hosts) == 0
+	case templateStep:
+		return len(m.options.Templates) <= 1
+	}
+	return false
+}
+
+// next moves to the following step that isn't skipped
+func (m *wizardModel) next() {
+	step := m.step + 1
+	for m.skipped(step) {
+		step++
+	}
+	m.enter(step)
+}
+
+// back returns to the previous step that isn't skipped
+func (m *wizardModel) back() {
+	step := m.step - 1
+	for step > searchStep && m.skipped(step) {
+		step--
+	}
+	m.enter(step)
+}
+
+func (m *wizardModel) enter(step wizardStep) {
+	m.step = step
+	m.message = ""
+	m.cursor = 0
+	switch step {
+	case searchStep:
+		m.input.Focus()
+	case categoryStep:
+		m.folder = ""
+		m.loadFolders()
+	case hostsStep:
+		m.loadHosts()
+	case templateStep:
+		m.cursor = max(0, slices.Index(m.options.Templates, m.result.Template))
+	}
+}
+
+// loadHosts offers the hosts of the chosen category, checking its defaults. Going back
+// and choosing another category starts its hosts over.
+func (m *wizardModel) loadHosts() {
+	category := m.result.Category
+	if m.options.CategoryHosts == nil || (m.hostsCategory != nil && *m.hostsCategory == category) {
+		return
+	}
+	m.hostsCategory = &category
+	hosts, selected := m.options.CategoryHosts(category)
+	m.hosts = hosts
+	if len(m.options.Selected) == 0 {
+		m.checked = map[string]bool{}
+		for _, host := range selected {
+			m.checked[host] = true
+		}
+	}
+	for host := range m.checked {
+		if !slices.Contains(hosts, host) {
+			delete(m.checked, host)
+		}
+	}
+}
+
+// hostGroups returns the groups with members among the offered hosts, holding only those
+func (m wizardModel) hostGroups() []HostGroup {
+	var groups []HostGroup
+	for _, group := range m.options.HostGroups {
+		var members []string
+		for _, host := range group.Hosts {
+			if slices.Contains(m.hosts, host) {
+				members = append(members, host)
+			}
+		}
+		if len(members) > 0 {
+			groups = append(groups, HostGroup{Name: group.Name, Hosts: members})
+		}
+	}
+	return groups
+}
+
+// allChecked reports whether every host is checked
+func (m wizardModel) allChecked(hosts []string) bool {
+	for _, host := range hosts {
+		if !m.checked[host] {
+			return false
+		}
+	}
+	return true
+}
+
+// toggleHost toggles the highlighted host, or every member of the highlighted group:
+// all of them are unchecked when they were all checked, checked otherwise
+func (m *wizardModel) toggleHost() {
+	groups := m.hostGroups()
+	if m.cursor >= len(groups) {
+		host := m.hosts[m.cursor-len(groups)]
+		m.checked[host] = !m.checked[host]
+		return
+	}
+	members := groups[m.cursor].Hosts
+	check := !m.allChecked(members)
+	for _, host := range members {
+		m.checked[host] = check
+	}
+}
+
+// hostLines renders the groups and hosts of the hosts step
+func (m wizardModel) hostLines() string {
+	var options []string
+	var checked []bool
+	for _, group := range m.hostGroups() {
+		options = append(options, fmt.Sprintf("@%s (%s)", group.Name, strings.Join(group.Hosts, ", ")))
+		checked = append(checked, m.allChecked(group.Hosts))
+	}
+	for _, host := range m.hosts {
+		options = append(options, host)
+		checked = append(checked, m.checked[host])
+	}
+	return m.optionLines(options, checked)
+}
+
+// loadFolders lists the options of the category being browsed
+func (m *wizardModel) loadFolders() {
+	m.cursor = 0
+	if len(m.options.Categories) > 0 {
+		m.folders = m.options.Categories
+		return
+	}
+	subdirs, err := GetDirNames(filepath.Join(m.options.ModulesDir, m.folder))
+	if err != nil {
+		m.folders = nil
+		m.message = err.Error()
+		return
+	}
+	m.folders = nil
+	if m.folder != "" {
+		m.folders = append(m.folders, useFolder)
+	}
+	m.folders = append(m.folders, subdirs...)
+	if len(m.folders) == 0 {
+		m.message = fmt.Sprintf("no folders found in %s", m.options.ModulesDir)
+	}
+}
+
+// chooseFolder goes into the highlighted folder, or takes it as the category when it has
+// no subfolders
+func (m *wizardModel) chooseFolder() {
+	if len(m.folders) == 0 {
+		return
+	}
+	selected := m.folders[m.cursor]
+	if len(m.options.Categories) > 0 {
+		m.result.Category = selected
+		m.next()
+		return
+	}
+	if selected == useFolder {
+		m.result.Category = m.folder
+		m.next()
+		return
+	}
+	path := filepath.Join(m.folder, selected)
+	subdirs, err := GetDirNames(filepath.Join(m.options.ModulesDir, path))
+	if err == nil && len(subdirs) > 0 {
+		m.folder = path
+		m.loadFolders()
+		return
+	}
+	m.result.Category = path
+	m.next()
+}
+
+// optionCount is the number of options the cursor moves over on the current step
+func (m wizardModel) optionCount() int {
+	switch m.step {
+	case categoryStep:
+		return len(m.folders)
+	case hostsStep:
+		return len(m.hostGroups()) + len(m.hosts)
+	case templateStep:
+		return len(m.options.Templates)
+	}
+	return 0
+}
+
+func (m wizardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		if m.step == packageStep {
+			return m.updateBrowser(m.browserSize())
+		}
+		return m, nil
+	case spinner.TickMsg:
+		if !m.searching {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case searchResultMsg:
+		if msg.query != m.result.Query {
+			return m, nil
+		}
+		m.searching = false
+		switch {
+		case msg.err != nil:
+			m.message = msg.err.Error()
+			return m, nil
+		case len(msg.packages) == 0:
+			m.noResults = true
+			m.message = fmt.Sprintf("No packages found for %s", msg.query)
+			return m, nil
+		}
+		m.browser = newPickerModel(fmt.Sprintf("Select a package to install for %s", msg.query), msg.packages, m.options.FetchMeta, m.options.OtherBranch, true)
+		m.browser.list.KeyMap.Quit.SetEnabled(false)
+		m.browser.query, m.browser.searchSet = msg.query, m.options.SearchSet
+		m.enter(packageStep)
+		model, cmd := m.updateBrowser(m.browserSize())
+		return model, tea.Batch(cmd, m.browser.Init())
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		return m.updateKey(msg)
+	case metaMsg, setResultMsg:
+		if m.step == packageStep {
+			return m.updateBrowser(msg)
+		}
+		return m, nil
+	}
+
+	if m.step == searchStep {
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// browserSize leaves room for the step line above the package list
+func (m wizardModel) browserSize() tea.WindowSizeMsg {
+	return tea.WindowSizeMsg{Width: m.width, Height: m.height - 2}
+}
+
+func (m wizardModel) updateBrowser(msg tea.Msg) (tea.Model, tea.Cmd) {
+	model, cmd := m.browser.Update(msg)
+	m.browser = model.(browserModel)
+	if m.browser.switchBranch {
+		// The picker quits on b, the wizard searches the other branch instead
+		m.browser.switchBranch = false
+		return m, m.switchBranch()
+	}
+	if m.browser.install != nil {
+		m.result.Packages = m.browser.chosen
+		m.browser.install = nil
+		m.next()
+		return m, nil
+	}
+	return m, cmd
+}
+
+// switchBranch searches the query again in the other nixpkgs branch
+func (m *wizardModel) switchBranch() tea.Cmd {
+	if m.options.SwitchBranch == nil || m.options.OtherBranch == "" {
+		return nil
+	}
+	m.options.OtherBranch = m.options.SwitchBranch()
+	return m.search(m.result.Query)
+}
+
+func (m wizardModel) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.step {
+	case searchStep:
+		if m.searching {
+			return m, nil
+		}
+		switch msg.String() {
+		case "esc":
+			return m, tea.Quit
+		case "tab":
+			if m.noResults {
+				return m, m.switchBranch()
+			}
+		case "enter":
+			query := strings.TrimSpace(m.input.Value())
+			if query == "" {
+				return m, nil
+			}
+			m.input.Blur()
+			return m, m.search(query)
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+
+	case packageStep:
+		if msg.String() == "esc" && !m.browser.expanded && m.browser.set == nil && m.browser.list.FilterState() == list.Unfiltered {
+			m.back()
+			return m, textinput.Blink
+		}
+		return m.updateBrowser(msg)
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < m.optionCount()-1 {
+			m.cursor++
+		}
+	case "esc":
+		if m.step == categoryStep && m.folder != "" {
+			m.folder = filepath.Dir(m.folder)
+			if m.folder == "." {
+				m.folder = ""
+			}
+			m.message = ""
+			m.loadFolders()
+			return m, nil
+		}
+		m.back()
+	case " ":
+		if m.step == hostsStep && m.optionCount() > 0 {
+			m.toggleHost()
+		}
+	case "e":
+		if m.step == confirmStep && m.options.AskEditor {
+			m.result.OpenEditor = !m.result.OpenEditor
+		}
+	case "enter":
+		switch m.step {
+		case categoryStep:
+			m.chooseFolder()
+		case hostsStep:
+			m.result.Hosts = nil
+			for _, host := range m.hosts {
+				if m.checked[host] {
+					m.result.Hosts = append(m.result.Hosts, host)
+				}
+			}
+			m.next()
+		case templateStep:
+			m.result.Template = m.options.Templates[m.cursor]
+			m.next()
+		case confirmStep:
+			m.confirmed = true
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+// steps renders the line naming every step of the wizard, the current one highlighted
+func (m wizardModel) steps() string {
+	var names []string
+	for step := searchStep; step <= confirmStep; step++ {
+		if m.skipped(step) {
+			continue
+		}
+		name := stepNames[step]
+		if step == m.step {
+			names = append(names, browserSelectedStyle.Render(name))
+		} else {
+			names = append(names, wizardStepStyle.Render(name))
+		}
+	}
+	return strings.Join(names, wizardStepStyle.Render(" › "))
+}
+
+// optionLines renders the options of the current step with the cursor on one of them,
+// with a checkbox in front of each when checked is given
+func (m wizardModel) optionLines(options []string, checked []bool) string {
+	var lines []string
+	for i, option := range options {
+		label := option
+		if checked != nil {
+			mark := "[ ]"
+			if checked[i] {
+				mark = "[x]"
+			}
+			label = mark + " " + option
+		}
+		if i == m.cursor {
+			lines = append(lines, browserSelectedStyle.Render("▸ "+label))
+		} else {
+			lines = append(lines, "  "+label)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m wizardModel) View() string {
+	if m.step == packageStep {
+		return m.steps() + "\n\n" + m.browser.View()
+	}
+
+	var title, body, help string
+	switch m.step {
+	case searchStep:
+		title = "Search for a package"
+		body = m.input.View()
+		if m.searching {
+			body = fmt.Sprintf("%s Searching for %s...", m.spinner.View(), m.result.Query)
+		}
+		help = "enter search • esc cancel"
+		if m.noResults && m.options.OtherBranch != "" {
+			help = fmt.Sprintf("enter search • tab search %s nixpkgs • esc cancel", m.options.OtherBranch)
+		}
+	case categoryStep:
+		title = "Select a folder"
+		if len(m.options.Categories) > 0 {
+			title = "Select a category"
+		}
+		if m.folder != "" {
+			title = fmt.Sprintf("Select a folder (current: %s)", m.folder)
+		}
+		body = m.optionLines(m.folders, nil)
+		help = "enter choose • esc back"
+	case hostsStep:
+		title = "Select hosts"
+		body = m.hostLines()
+		if len(m.hosts) == 0 {
+			body = "The category excludes every host, the module is only written"
+		}
+		help = "space toggle • enter confirm • esc back"
+	case templateStep:
+		title = "Select a module template"
+		body = m.optionLines(m.options.Templates, nil)
+		help = "enter choose • esc back"
+	case confirmStep:
+		title = "Install?"
+		body = m.summary()
+		help = "enter install • esc back"
+		if m.options.AskEditor {
+			help = "enter install • e toggle editing • esc back"
+		}
+	}
+
+	lines := []string{m.steps(), "", wizardTitleStyle.Render(title), body}
+	if m.message != "" {
+		lines = append(lines, "", wizardErrorStyle.Render(m.message))
+	}
+	lines = append(lines, "", wizardStepStyle.Render(help+" • ctrl+c quit"))
+	return strings.Join(lines, "\n")
+}
+
+// summary lists the answers on the confirm step
+func (m wizardModel) summary() string {
+	var lines []string
+	for i, pkg := range m.result.Packages {
+		label := "Package:  "
+		if len(m.result.Packages) > 1 {
+			label = fmt.Sprintf("Package %d: ", i+1)
+		}
+		lines = append(lines, label+FormatPackageOption(&pkg))
+	}
+	if !m.skipped(categoryStep) {
+		lines = append(lines, "Category: "+m.result.Category)
+	}
+	if !m.skipped(hostsStep) {
+		hosts := strings.Join(m.result.Hosts, ", ")
+		if hosts == "" {
+			hosts = "none, the module is only written"
+		}
+		lines = append(lines, "Hosts:    "+hosts)
+	}
+	if !m.skipped(templateStep) {
+		lines = append(lines, "Template: "+m.result.Template)
+	}
+	if m.options.AskEditor {
+		edit := "no"
+		if m.result.OpenEditor {
+			edit = "yes"
+		}
+		lines = append(lines, "Edit the module after writing it: "+edit)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunWizard asks for everything an install needs in one screen: the package, searched
+// with Search, its category, the hosts and the template, then a confirmation. Esc goes
+// back a step. The result is nil when the user quit before confirming.
+func RunWizard(options WizardOptions) (*WizardResult, error) {
+	final, err := tea.NewProgram(newWizardModel(options), tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, err
+	}
+	model := final.(wizardModel)
+	if !model.confirmed {
+		return nil, nil
+	}
+	return &model.result, nil
+}
@@ -0,0 +1,248 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"pam/internal/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// press sends the keys to the model one after another
+func press(model tea.Model, keys ...tea.KeyMsg) tea.Model {
+	for _, key := range keys {
+		model, _ = model.Update(key)
+	}
+	return model
+}
+
+var (
+	enterKey = tea.KeyMsg{Type: tea.KeyEnter}
+	escKey   = tea.KeyMsg{Type: tea.KeyEsc}
+	downKey  = tea.KeyMsg{Type: tea.KeyDown}
+	spaceKey = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+)
+
+func runeKey(r rune) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}
+}
+
+func TestWizardModel(t *testing.T) {
+	modulesDir := t.TempDir()
+	for _, dir := range []string{"browsers", "dev/editors"} {
+		if err := os.MkdirAll(filepath.Join(modulesDir, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	packages := []types.Package{
+		{PName: "firefox", FullPath: "firefox", Version: "121.0", System: "x86_64-linux"},
+		{PName: "firefox-esr", FullPath: "firefox-esr", Version: "115.6", System: "x86_64-linux"},
+	}
+	var model tea.Model = newWizardModel(WizardOptions{
+		Query:      "fire",
+		Search:     func(query string) ([]types.Package, error) { return packages, nil },
+		ModulesDir: modulesDir,
+		Hosts:      []string{"laptop", "desktop"},
+		Selected:   []string{"laptop"},
+		AskEditor:  true,
+	})
+	if !strings.Contains(model.View(), "Searching for fire") {
+		t.Errorf("View() while searching:\n%s", model.View())
+	}
+	for _, msg := range collect(model.Init()) {
+		model, _ = model.Update(msg)
+	}
+	if step := model.(wizardModel).step; step != packageStep {
+		t.Fatalf("step after the search = %v, want the package step", step)
+	}
+
+	// Pick firefox-esr, then go into dev, back out and into it again to use it
+	model = press(model, downKey, enterKey)
+	model = press(model, downKey, enterKey)
+	if got := model.(wizardModel).folder; got != "dev" {
+		t.Fatalf("browsed folder = %q, want dev", got)
+	}
+	model = press(model, escKey)
+	if m := model.(wizardModel); m.step != categoryStep || m.folder != "" {
+		t.Fatalf("esc in dev went to step %v folder %q, want the category step at the top", m.step, m.folder)
+	}
+	model = press(model, downKey, enterKey, enterKey)
+
+	// laptop starts checked, desktop is added
+	model = press(model, downKey, spaceKey, enterKey)
+	if step := model.(wizardModel).step; step != confirmStep {
+		t.Fatalf("step after the hosts = %v, want the confirm step (no templates)", step)
+	}
+	model = press(model, escKey)
+	if step := model.(wizardModel).step; step != hostsStep {
+		t.Fatalf("esc on the confirm step went to step %v, want the hosts step", step)
+	}
+	model = press(model, enterKey, runeKey('e'))
+	view := model.View()
+	for _, want := range []string{"firefox-esr (115.6)", "Category: dev", "Hosts:    laptop, desktop", "after writing it: yes"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("confirm step missing %q:\n%s", want, view)
+		}
+	}
+
+	model, cmd := model.Update(enterKey)
+	if cmd == nil || !model.(wizardModel).confirmed {
+		t.Fatal("enter on the confirm step did not finish the wizard")
+	}
+	result := model.(wizardModel).result
+	if result.Query != "fire" || len(result.Packages) != 1 || result.Packages[0].FullPath != "firefox-esr" || result.Category != "dev" || !slices.Equal(result.Hosts, []string{"laptop", "desktop"}) || !result.OpenEditor {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestWizardModel_OtherBranch(t *testing.T) {
+	branch := "stable"
+	search := func(query string) ([]types.Package, error) {
+		if branch == "stable" {
+			return nil, nil
+		}
+		return []types.Package{{PName: query, FullPath: query, Version: "1.0"}}, nil
+	}
+	var model tea.Model = newWizardModel(WizardOptions{
+		Search:       search,
+		OtherBranch:  "unstable",
+		SwitchBranch: func() string { branch = "unstable"; return "stable" },
+	})
+
+	// Type the query, which finds nothing on stable
+	for _, r := range "zed" {
+		model = press(model, runeKey(r))
+	}
+	model, cmd := model.Update(enterKey)
+	for _, msg := range collect(cmd) {
+		model, _ = model.Update(msg)
+	}
+	if !strings.Contains(model.View(), "No packages found for zed") || !strings.Contains(model.View(), "tab search unstable") {
+		t.Fatalf("View() without results:\n%s", model.View())
+	}
+
+	model, cmd = model.Update(tea.KeyMsg{Type: tea.KeyTab})
+	for _, msg := range collect(cmd) {
+		model, _ = model.Update(msg)
+	}
+	if step := model.(wizardModel).step; step != packageStep {
+		t.Fatalf("step after searching unstable = %v, want the package step", step)
+	}
+
+	// Back on the search step, esc cancels without a result
+	model = press(model, escKey)
+	model, cmd = model.Update(escKey)
+	if cmd == nil || model.(wizardModel).confirmed {
+		t.Error("esc on the search step did not cancel the wizard")
+	}
+}
+
+func TestWizardModel_CategoryHosts(t *testing.T) {
+	modulesDir := t.TempDir()
+	for _, dir := range []string{"gui", "server"} {
+		if err := os.MkdirAll(filepath.Join(modulesDir, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	categoryHosts := func(category string) ([]string, []string) {
+		if category == "server" {
+			return []string{"laptop", "nas", "vps"}, []string{"nas", "vps"}
+		}
+		return []string{"laptop"}, nil
+	}
+	var model tea.Model = newWizardModel(WizardOptions{
+		Query: "nginx",
+		Search: func(query string) ([]types.Package, error) {
+			return []types.Package{{PName: query, FullPath: query}}, nil
+		},
+		ModulesDir:    modulesDir,
+		Hosts:         []string{"laptop", "nas", "vps"},
+		CategoryHosts: categoryHosts,
+	})
+	for _, msg := range collect(model.Init()) {
+		model, _ = model.Update(msg)
+	}
+
+	// server checks its hosts
+	model = press(model, enterKey, downKey, enterKey)
+	if m := model.(wizardModel); m.step != hostsStep || len(m.hosts) != 3 || !m.checked["nas"] || !m.checked["vps"] || m.checked["laptop"] {
+		t.Fatalf("hosts of server = %v, checked %v", m.hosts, m.checked)
+	}
+
+	// gui offers laptop only, and the server hosts don't stay checked
+	model = press(model, escKey, enterKey)
+	m := model.(wizardModel)
+	if m.step != hostsStep || len(m.hosts) != 1 || len(m.checked) != 0 {
+		t.Fatalf("hosts of gui = %v, checked %v", m.hosts, m.checked)
+	}
+	model = press(model, spaceKey, enterKey)
+	if !strings.Contains(model.View(), "Hosts:    laptop") {
+		t.Errorf("confirm step:\n%s", model.View())
+	}
+}
+
+func TestWizardModel_Categories(t *testing.T) {
+	// The declared categories are offered flat, cli/editors is taken without browsing cli
+	var model tea.Model = newWizardModel(WizardOptions{
+		Query: "helix",
+		Search: func(query string) ([]types.Package, error) {
+			return []types.Package{{PName: query, FullPath: query}}, nil
+		},
+		ModulesDir: t.TempDir(),
+		Categories: []string{"browsers", "cli/editors"},
+	})
+	for _, msg := range collect(model.Init()) {
+		model, _ = model.Update(msg)
+	}
+	model = press(model, enterKey)
+	if m := model.(wizardModel); m.step != categoryStep || !strings.Contains(m.View(), "Select a category") {
+		t.Fatalf("step %v after the package:\n%s", m.step, m.View())
+	}
+	model = press(model, downKey, enterKey)
+	if got := model.(wizardModel).result.Category; got != "cli/editors" {
+		t.Errorf("category = %q, want cli/editors", got)
+	}
+}
+
+func TestWizardModel_HostGroups(t *testing.T) {
+	var model tea.Model = newWizardModel(WizardOptions{
+		Query: "git",
+		Search: func(query string) ([]types.Package, error) {
+			return []types.Package{{PName: query, FullPath: query}}, nil
+		},
+		Hosts: []string{"mbp", "nas", "thinkpad"},
+		HostGroups: []HostGroup{
+			{Name: "laptops", Hosts: []string{"mbp", "thinkpad"}},
+			{Name: "old", Hosts: []string{"gone"}},
+		},
+	})
+	for _, msg := range collect(model.Init()) {
+		model, _ = model.Update(msg)
+	}
+
+	// Groups without any of the hosts aren't offered
+	model = press(model, enterKey)
+	view := model.View()
+	if !strings.Contains(view, "@laptops (mbp, thinkpad)") || strings.Contains(view, "@old") {
+		t.Fatalf("hosts step:\n%s", view)
+	}
+
+	// Checking the group checks its members, and a second time unchecks them
+	model = press(model, spaceKey)
+	if m := model.(wizardModel); !m.checked["mbp"] || !m.checked["thinkpad"] || m.checked["nas"] {
+		t.Fatalf("checked after the group = %v", m.checked)
+	}
+	model = press(model, spaceKey)
+	if m := model.(wizardModel); m.checked["mbp"] || m.checked["thinkpad"] {
+		t.Fatalf("checked after the group twice = %v", m.checked)
+	}
+
+	model = press(model, spaceKey, downKey, downKey, spaceKey, enterKey)
+	if !strings.Contains(model.View(), "Hosts:    mbp, nas, thinkpad") {
+		t.Errorf("confirm step:\n%s", model.View())
+	}
+}
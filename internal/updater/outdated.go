@@ -0,0 +1,89 @@
+package updater
+
+import (
+	"fmt"
+	"slices"
+
+	"pam/internal/lockfile"
+	"pam/internal/search"
+)
+
+// Versions returns the version each attribute has in the flake's inputs for system, leaving
+// out the ones their input lacks, see search.InputVersions
+type Versions func(system string, attrs []search.InputAttr) (map[search.InputAttr]string, error)
+
+// Version is a locked package with the version its flake input holds now
+type Version struct {
+	Package lockfile.Package
+	Current string
+}
+
+// LockReport sorts the packages of the lock by how their version compares to their input
+type LockReport struct {
+	Outdated []Version
+	UpToDate []Version
+	Skipped  []LockSkip
+}
+
+// LockSkip is a locked package that could not be compared, with the reason why
+type LockSkip struct {
+	Package lockfile.Package
+	Reason  string
+}
+
+// CheckLock compares the version the lock records for every package with the one in the
+// flake input it comes from, evaluating all packages of a system at once. Packages without
+// systems are looked up for defaultSystem.
+func CheckLock(packages []lockfile.Package, defaultSystem string, versions Versions) (*LockReport, error) {
+	report := &LockReport{}
+	bySystem := map[string][]lockfile.Package{}
+	var systems []string
+	for _, pkg := range packages {
+		if search.IsPinInput(pkg.Input) {
+			report.Skipped = append(report.Skipped, LockSkip{Package: pkg, Reason: fmt.Sprintf("pinned to %s, install another version with name@version", pkg.Version)})
+			continue
+		}
+		// A package installed for several systems is compared on the first one
+		system := defaultSystem
+		if len(pkg.Systems) > 0 {
+			system = pkg.Systems[0]
+		}
+		if !slices.Contains(systems, system) {
+			systems = append(systems, system)
+		}
+		bySystem[system] = append(bySystem[system], pkg)
+	}
+
+	for _, system := range systems {
+		locked := bySystem[system]
+		attrs := make([]search.InputAttr, len(locked))
+		for i, pkg := range locked {
+			attrs[i] = inputAttr(pkg)
+		}
+		found, err := versions(system, attrs)
+		if err != nil {
+			return report, err
+		}
+		for i, pkg := range locked {
+			current, ok := found[attrs[i]]
+			switch {
+			case !ok:
+				report.Skipped = append(report.Skipped, LockSkip{Package: pkg, Reason: fmt.Sprintf("%s was not found in %s", pkg.Attr, attrs[i].Input)})
+			case current == pkg.Version:
+				report.UpToDate = append(report.UpToDate, Version{Package: pkg, Current: current})
+			default:
+				report.Outdated = append(report.Outdated, Version{Package: pkg, Current: current})
+			}
+		}
+	}
+	return report, nil
+}
+
+// inputAttr is where the package of a lock entry comes from, nixpkgs when no input is recorded
+func inputAttr(pkg lockfile.Package) search.InputAttr {
+	input := pkg.Input
+	if input == "" {
+		input = search.NixpkgsSource
+	}
+	return search.InputAttr{Input: input, Attr: pkg.Attr}
+}
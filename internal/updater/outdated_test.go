@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"pam/internal/lockfile"
+	"pam/internal/search"
+)
+
+func TestCheckLock(t *testing.T) {
+	packages := []lockfile.Package{
+		{Name: "firefox", Attr: "firefox", Version: "120.0", Input: "nixpkgs", Systems: []string{"x86_64-linux"}},
+		{Name: "ripgrep", Attr: "ripgrep", Version: "14.1.0", Input: "nixpkgs"},
+		{Name: "emacs", Attr: "emacs-git", Version: "30.0", Input: "emacs-overlay", Systems: []string{"aarch64-darwin", "x86_64-linux"}},
+		{Name: "netscape", Attr: "netscape", Version: "9.0", Input: "nixpkgs", Systems: []string{"x86_64-linux"}},
+		{Name: "node", Attr: "nodejs", Version: "18.0.0", Input: "nixpkgs-pin-nodejs-18"},
+	}
+	upstream := map[string]map[search.InputAttr]string{
+		"x86_64-linux": {
+			{Input: "nixpkgs", Attr: "firefox"}: "121.0",
+			{Input: "nixpkgs", Attr: "ripgrep"}: "14.1.0",
+		},
+		"aarch64-darwin": {
+			{Input: "emacs-overlay", Attr: "emacs-git"}: "31.0",
+		},
+	}
+
+	var calls []string
+	report, err := CheckLock(packages, "x86_64-linux", func(system string, attrs []search.InputAttr) (map[search.InputAttr]string, error) {
+		calls = append(calls, system)
+		return upstream[system], nil
+	})
+	if err != nil {
+		t.Fatalf("CheckLock() error = %v", err)
+	}
+
+	// Every system is evaluated once, with all of its packages
+	if !slices.Equal(calls, []string{"x86_64-linux", "aarch64-darwin"}) {
+		t.Errorf("evaluated systems = %v", calls)
+	}
+	var outdated []string
+	for _, version := range report.Outdated {
+		outdated = append(outdated, version.Package.Name+" "+version.Current)
+	}
+	if !slices.Equal(outdated, []string{"firefox 121.0", "emacs 31.0"}) {
+		t.Errorf("Outdated = %v", outdated)
+	}
+	if len(report.UpToDate) != 1 || report.UpToDate[0].Package.Name != "ripgrep" {
+		t.Errorf("UpToDate = %+v, want ripgrep", report.UpToDate)
+	}
+	var skipped []string
+	for _, skip := range report.Skipped {
+		skipped = append(skipped, skip.Package.Name)
+	}
+	if !slices.Equal(skipped, []string{"node", "netscape"}) {
+		t.Errorf("Skipped = %v, want node and netscape", skipped)
+	}
+
+	_, err = CheckLock(packages, "x86_64-linux", func(string, []search.InputAttr) (map[search.InputAttr]string, error) {
+		return nil, errors.New("eval failed")
+	})
+	if err == nil {
+		t.Error("CheckLock() ignored a failed evaluation")
+	}
+}
@@ -0,0 +1,124 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"pam/internal/assets"
+	"pam/internal/diff"
+	"pam/internal/modules"
+	"pam/internal/search"
+	"pam/internal/types"
+	"pam/internal/wrappers"
+)
+
+// Searcher returns the packages of the flake input matching query for system, with FullPath
+// and System filled in
+type Searcher func(input string, query string, system string) ([]types.Package, error)
+
+// Update is a module whose package has a different version upstream than the one recorded
+type Update struct {
+	Module modules.Module
+	Header modules.Header
+	Latest *types.Package
+	// Template is the template the module was generated from, the one bundled with pam when nil
+	Template *template.Template
+}
+
+// Skip is a module that could not be checked, with the reason why
+type Skip struct {
+	Module modules.Module
+	Reason string
+}
+
+// Report sorts the checked modules by what update can do with them
+type Report struct {
+	Updates  []Update
+	UpToDate []modules.Module
+	Skipped  []Skip
+}
+
+// Check searches nixpkgs for the package of every module and compares its version with the module header
+func Check(found []modules.Module, find Searcher) (*Report, error) {
+	report := &Report{}
+	for _, module := range found {
+		header, ok, err := module.Header()
+		if err != nil {
+			return report, fmt.Errorf("reading %s: %w", module.Path, err)
+		}
+		if !ok {
+			report.Skipped = append(report.Skipped, Skip{Module: module, Reason: "no pam header, reinstall it to record one"})
+			continue
+		}
+
+		if header.FromHomebrew() {
+			report.Skipped = append(report.Skipped, Skip{Module: module, Reason: "installed by Homebrew, brew upgrade or mas upgrade updates it"})
+			continue
+		}
+
+		if search.IsPinInput(header.Input) {
+			report.Skipped = append(report.Skipped, Skip{Module: module, Reason: fmt.Sprintf("pinned to %s, install another version with name@version", header.Version)})
+			continue
+		}
+
+		// A module generated for several systems is checked against the first one
+		system, _, _ := strings.Cut(header.System, ",")
+		// nix search takes a regex, the attr path must match literally
+		candidates, err := find(header.Input, regexp.QuoteMeta(header.Attr), system)
+		if err != nil {
+			return report, fmt.Errorf("searching %s: %w", header.Attr, err)
+		}
+		latest := findAttr(candidates, header.Attr)
+		if latest != nil && header.System != "" {
+			// Regenerate the module for every system it covers
+			latest.System = header.System
+		}
+		if latest != nil {
+			latest.Program = header.Program
+			latest.DarwinService = header.DarwinService
+			latest.Flatpak = header.Flatpak
+			// An interpreter built with packages keeps them and its module name
+			if wrapper, ok := wrappers.Parse(header.With); ok {
+				wrappers.Apply(latest, wrapper)
+			}
+		}
+		switch {
+		case latest == nil:
+			report.Skipped = append(report.Skipped, Skip{Module: module, Reason: fmt.Sprintf("%s was not found in %s", header.Attr, header.Input)})
+		case latest.Version == header.Version:
+			report.UpToDate = append(report.UpToDate, module)
+		default:
+			report.Updates = append(report.Updates, Update{Module: module, Header: header, Latest: latest})
+		}
+	}
+	return report, nil
+}
+
+func findAttr(candidates []types.Package, attr string) *types.Package {
+	for i := range candidates {
+		if candidates[i].FullPath == attr {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+// Change regenerates the module for the latest package, keeping the template and Homebrew
+// choice of the original, with its option under namespace
+func (u Update) Change(namespace string) (diff.Change, error) {
+	existing, err := os.ReadFile(u.Module.Path)
+	if err != nil {
+		return diff.Change{}, err
+	}
+	module := assets.FillPackageTemplate(u.Latest, u.Header.UsesHomebrew(), namespace)
+	if u.Template != nil {
+		module, err = assets.FillTemplate(u.Template, u.Latest, u.Header.UsesHomebrew(), namespace)
+		if err != nil {
+			return diff.Change{}, err
+		}
+	}
+	return diff.Change{Path: u.Module.Path, Old: string(existing), New: module}, nil
+}
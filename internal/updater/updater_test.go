@@ -0,0 +1,198 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pam/internal/assets"
+	"pam/internal/modules"
+	"pam/internal/types"
+)
+
+func writeModule(t *testing.T, root string, name string, content string) modules.Module {
+	t.Helper()
+	path := filepath.Join(root, "browsers", name+".nix")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	return modules.Module{Name: name, Category: "browsers", Path: path}
+}
+
+func generated(pkg types.Package, useHomebrew bool) string {
+	return assets.FillPackageTemplate(&pkg, useHomebrew, "")
+}
+
+func TestCheck(t *testing.T) {
+	root := t.TempDir()
+	firefox := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux", Version: "120.0"}
+	chromium := types.Package{PName: "chromium", FullPath: "chromium", System: "x86_64-linux", Version: "119.0"}
+	gone := types.Package{PName: "netscape", FullPath: "netscape", System: "x86_64-linux", Version: "9.0"}
+
+	found := []modules.Module{
+		writeModule(t, root, "firefox", generated(firefox, false)),
+		writeModule(t, root, "chromium", generated(chromium, false)),
+		writeModule(t, root, "netscape", generated(gone, false)),
+		writeModule(t, root, "custom", "{ pkgs, ... }: { }\n"),
+	}
+
+	upstream := map[string]types.Package{
+		"firefox":  {PName: "firefox", FullPath: "firefox", System: "x86_64-linux", Version: "121.0"},
+		"chromium": chromium,
+	}
+	var queries []string
+	search := func(input string, query string, system string) ([]types.Package, error) {
+		queries = append(queries, input+"#"+query+"@"+system)
+		pkg, ok := upstream[query]
+		if !ok {
+			return nil, nil
+		}
+		// Results of an unanchored regex search also hold packages with longer attr paths
+		return []types.Package{{PName: pkg.PName + "-esr", FullPath: pkg.FullPath + "-esr"}, pkg}, nil
+	}
+
+	report, err := Check(found, search)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	if len(report.Updates) != 1 || report.Updates[0].Module.Name != "firefox" || report.Updates[0].Latest.Version != "121.0" {
+		t.Errorf("Updates = %+v, want firefox 121.0", report.Updates)
+	}
+	if len(report.UpToDate) != 1 || report.UpToDate[0].Name != "chromium" {
+		t.Errorf("UpToDate = %+v, want chromium", report.UpToDate)
+	}
+	if len(report.Skipped) != 2 {
+		t.Errorf("Skipped = %+v, want netscape and custom", report.Skipped)
+	}
+	if strings.Join(queries, ",") != "nixpkgs#firefox@x86_64-linux,nixpkgs#chromium@x86_64-linux,nixpkgs#netscape@x86_64-linux" {
+		t.Errorf("searched %v", queries)
+	}
+}
+
+func TestCheck_MultipleSystems(t *testing.T) {
+	root := t.TempDir()
+	pkg := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux,aarch64-darwin", Version: "120.0"}
+	found := []modules.Module{writeModule(t, root, "firefox", generated(pkg, false))}
+
+	var searched string
+	search := func(input string, query string, system string) ([]types.Package, error) {
+		searched = system
+		return []types.Package{{PName: "firefox", FullPath: "firefox", System: system, Version: "121.0"}}, nil
+	}
+
+	report, err := Check(found, search)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if searched != "x86_64-linux" {
+		t.Errorf("searched system %q, want x86_64-linux", searched)
+	}
+	if len(report.Updates) != 1 || report.Updates[0].Latest.System != pkg.System {
+		t.Fatalf("Updates = %+v, want firefox for both systems", report.Updates)
+	}
+	module := assets.FillPackageTemplate(report.Updates[0].Latest, false, "")
+	if !strings.Contains(module, "linuxPackages = pkgs: [ pkgs.firefox ];") || !strings.Contains(module, "darwinPackages = pkgs: [ pkgs.firefox ];") {
+		t.Errorf("regenerated module lost a system:\n%s", module)
+	}
+}
+
+func TestCheck_SearchError(t *testing.T) {
+	root := t.TempDir()
+	pkg := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux", Version: "120.0"}
+	found := []modules.Module{writeModule(t, root, "firefox", generated(pkg, false))}
+
+	_, err := Check(found, func(string, string, string) ([]types.Package, error) {
+		return nil, errors.New("nix not found")
+	})
+	if err == nil {
+		t.Error("Check() expected error when the search fails")
+	}
+}
+
+func TestUpdate_ChangeKeepsHomebrew(t *testing.T) {
+	root := t.TempDir()
+	old := types.Package{PName: "firefox", FullPath: "firefox", System: "aarch64-darwin", Version: "120.0"}
+	module := writeModule(t, root, "firefox", generated(old, true))
+	header, _, err := module.Header()
+	if err != nil {
+		t.Fatalf("Header() error = %v", err)
+	}
+
+	latest := old
+	latest.Version = "121.0"
+	change, err := Update{Module: module, Header: header, Latest: &latest}.Change("")
+	if err != nil {
+		t.Fatalf("Change() error = %v", err)
+	}
+	if change.New != generated(latest, true) {
+		t.Errorf("Change() New =\n%s", change.New)
+	}
+	if !strings.Contains(change.New, "version=121.0") || !strings.Contains(change.New, "source=brew") {
+		t.Errorf("Change() header not updated:\n%s", change.New)
+	}
+}
+
+func TestCheck_Pinned(t *testing.T) {
+	pinned := types.Package{PName: "firefox", FullPath: "firefox", System: "x86_64-linux", Version: "119.0.1", Output: "legacyPackages", Source: "nixpkgs-pin-firefox-119"}
+	found := []modules.Module{writeModule(t, t.TempDir(), "firefox", generated(pinned, false))}
+	search := func(input string, query string, system string) ([]types.Package, error) {
+		t.Errorf("Check() searched %s for a pinned module", query)
+		return nil, nil
+	}
+
+	report, err := Check(found, search)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Skipped) != 1 || !strings.Contains(report.Skipped[0].Reason, "pinned to 119.0.1") {
+		t.Errorf("Skipped = %+v, want firefox pinned", report.Skipped)
+	}
+}
+
+func TestCheck_Homebrew(t *testing.T) {
+	app := types.Package{PName: "xcode", FullPath: "497799835", System: "aarch64-darwin", Version: "16.0", Homebrew: &types.Homebrew{MasID: 497799835, MasName: "Xcode"}}
+	found := []modules.Module{writeModule(t, t.TempDir(), "xcode", generated(app, false))}
+	search := func(input string, query string, system string) ([]types.Package, error) {
+		t.Errorf("Check() searched %s for a Mac App Store app", query)
+		return nil, nil
+	}
+
+	report, err := Check(found, search)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Skipped) != 1 || !strings.Contains(report.Skipped[0].Reason, "Homebrew") {
+		t.Errorf("Skipped = %+v, want xcode skipped", report.Skipped)
+	}
+}
+
+func TestCheck_Wrapper(t *testing.T) {
+	env := types.Package{PName: "python311-env", FullPath: "python311", System: "x86_64-linux", Version: "3.11.8", Wrapper: &types.Wrapper{Set: "python311Packages", Packages: []string{"numpy"}}}
+	found := []modules.Module{writeModule(t, t.TempDir(), "python311-env", generated(env, false))}
+	search := func(input string, query string, system string) ([]types.Package, error) {
+		return []types.Package{{PName: "python3", FullPath: "python311", System: system, Version: "3.11.9"}}, nil
+	}
+
+	report, err := Check(found, search)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Updates) != 1 {
+		t.Fatalf("Updates = %+v, want python311-env", report.Updates)
+	}
+	change, err := report.Updates[0].Change("")
+	if err != nil {
+		t.Fatalf("Change() error = %v", err)
+	}
+	for _, want := range []string{`name = "python311-env";`, "(pkgs.python311.withPackages (ps: [ ps.numpy ]))", "with=python311Packages.numpy"} {
+		if !strings.Contains(change.New, want) {
+			t.Errorf("updated module missing %q:\n%s", want, change.New)
+		}
+	}
+}
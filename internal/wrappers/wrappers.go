@@ -0,0 +1,185 @@
+// Package wrappers builds interpreters and editors with the packages of a language package
+// set, such as python311.withPackages, which is how nix makes libraries like
+// python311Packages.numpy usable. Installed on their own they are invisible to the
+// interpreter.
+package wrappers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"pam/internal/types"
+)
+
+// language is a family of package sets and the interpreter their packages are built into
+type language struct {
+	name string
+	// pattern matches the name of a set, its submatch tells the interpreter version apart
+	pattern *regexp.Regexp
+	// interpreter returns the attribute of the interpreter for the submatch
+	interpreter func(version string) string
+	// expression returns the nix expression of the interpreter with the packages
+	expression func(interpreter string, set string, packages []string) string
+}
+
+// withPackages is the expression of interpreters with a withPackages function
+func withPackages(interpreter string, set string, packages []string) string {
+	return fmt.Sprintf("(pkgs.%s.withPackages (ps: [ %s]))", interpreter, refs("ps", packages))
+}
+
+// refs lists packages as attributes of set, e.g. ps.numpy ps.pandas
+func refs(set string, packages []string) string {
+	var list strings.Builder
+	for _, name := range packages {
+		fmt.Fprintf(&list, "%s.%s ", set, name)
+	}
+	return list.String()
+}
+
+var languages = []language{
+	{
+		name:        "python",
+		pattern:     regexp.MustCompile(`^python(\d*)Packages$`),
+		interpreter: func(version string) string { return "python" + version },
+		expression:  withPackages,
+	},
+	{
+		name:        "perl",
+		pattern:     regexp.MustCompile(`^perl(\d*)Packages$`),
+		interpreter: func(version string) string { return "perl" + version },
+		expression:  withPackages,
+	},
+	{
+		name:        "ruby",
+		pattern:     regexp.MustCompile(`^rubyPackages(_\d+_\d+)?$`),
+		interpreter: func(version string) string { return "ruby" + version },
+		expression:  withPackages,
+	},
+	{
+		name:        "haskell",
+		pattern:     regexp.MustCompile(`^haskellPackages$`),
+		interpreter: func(string) string { return "ghc" },
+		expression: func(_ string, _ string, packages []string) string {
+			return fmt.Sprintf("(pkgs.haskellPackages.ghcWithPackages (ps: [ %s]))", refs("ps", packages))
+		},
+	},
+	{
+		name:        "neovim",
+		pattern:     regexp.MustCompile(`^vimPlugins$`),
+		interpreter: func(string) string { return "neovim" },
+		expression: func(_ string, set string, packages []string) string {
+			return fmt.Sprintf("(pkgs.neovim.override { configure.packages.pam.start = [ %s]; })", refs("pkgs."+set, packages))
+		},
+	},
+}
+
+// devShellSets hold packages that belong to a project rather than a host, which have no
+// interpreter to build them into
+var devShellSets = regexp.MustCompile(`^nodePackages(_latest)?$`)
+
+func find(set string) (language, string, bool) {
+	for _, lang := range languages {
+		if match := lang.pattern.FindStringSubmatch(set); match != nil {
+			version := ""
+			if len(match) > 1 {
+				version = match[1]
+			}
+			return lang, version, true
+		}
+	}
+	return language{}, "", false
+}
+
+// Detect returns the wrapper building attr into its interpreter, e.g. python311 for
+// python311Packages.numpy. ok is false for packages outside the known language sets.
+func Detect(attr string) (types.Wrapper, bool) {
+	set, name, found := strings.Cut(attr, ".")
+	if !found || strings.Contains(name, ".") {
+		return types.Wrapper{}, false
+	}
+	if _, _, ok := find(set); !ok {
+		return types.Wrapper{}, false
+	}
+	return types.Wrapper{Set: set, Packages: []string{name}}, true
+}
+
+// DevShell reports whether attr is a package of a set such as nodePackages, which projects
+// use from a devshell instead of hosts installing it
+func DevShell(attr string) bool {
+	set, _, found := strings.Cut(attr, ".")
+	return found && devShellSets.MatchString(set)
+}
+
+// Language names the language of the wrapper's set, e.g. python
+func Language(w types.Wrapper) string {
+	lang, _, _ := find(w.Set)
+	return lang.name
+}
+
+// Interpreter returns the attribute of the interpreter the packages are built into
+func Interpreter(w types.Wrapper) string {
+	lang, version, ok := find(w.Set)
+	if !ok {
+		return ""
+	}
+	return lang.interpreter(version)
+}
+
+// Name is the name of the module holding the wrapper, e.g. python311-env
+func Name(w types.Wrapper) string {
+	return Interpreter(w) + "-env"
+}
+
+// Expression returns the nix expression of the interpreter built with the packages
+func Expression(w types.Wrapper) string {
+	lang, version, ok := find(w.Set)
+	if !ok {
+		return ""
+	}
+	return lang.expression(lang.interpreter(version), w.Set, w.Packages)
+}
+
+// Merge adds the packages of other that w doesn't have yet
+func Merge(w types.Wrapper, other types.Wrapper) types.Wrapper {
+	merged := types.Wrapper{Set: w.Set, Packages: slices.Clone(w.Packages)}
+	for _, name := range other.Packages {
+		if !slices.Contains(merged.Packages, name) {
+			merged.Packages = append(merged.Packages, name)
+		}
+	}
+	return merged
+}
+
+// Format lists the packages of w as attribute paths, as module headers record them, e.g.
+// python311Packages.numpy,python311Packages.pandas
+func Format(w types.Wrapper) string {
+	attrs := make([]string, len(w.Packages))
+	for i, name := range w.Packages {
+		attrs[i] = w.Set + "." + name
+	}
+	return strings.Join(attrs, ",")
+}
+
+// Parse reads a wrapper from the attribute paths Format lists
+func Parse(value string) (types.Wrapper, bool) {
+	var w types.Wrapper
+	for _, attr := range strings.Split(value, ",") {
+		found, ok := Detect(attr)
+		if !ok || (w.Set != "" && found.Set != w.Set) {
+			return types.Wrapper{}, false
+		}
+		w = Merge(types.Wrapper{Set: found.Set, Packages: w.Packages}, found)
+	}
+	return w, true
+}
+
+// Apply turns pkg, a package of the wrapper's interpreter, into the interpreter built with
+// the packages of w
+func Apply(pkg *types.Package, w types.Wrapper) {
+	pkg.PName = Name(w)
+	pkg.FullPath = Interpreter(w)
+	pkg.Description = fmt.Sprintf("%s with %s", Interpreter(w), strings.Join(w.Packages, ", "))
+	pkg.Wrapper = &w
+}
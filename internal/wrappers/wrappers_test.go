@@ -0,0 +1,79 @@
+package wrappers
+
+import (
+	"reflect"
+	"testing"
+
+	"pam/internal/types"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		attr        string
+		ok          bool
+		interpreter string
+		expression  string
+	}{
+		{attr: "python311Packages.numpy", ok: true, interpreter: "python311", expression: "(pkgs.python311.withPackages (ps: [ ps.numpy ]))"},
+		{attr: "python3Packages.requests", ok: true, interpreter: "python3", expression: "(pkgs.python3.withPackages (ps: [ ps.requests ]))"},
+		{attr: "perlPackages.Moose", ok: true, interpreter: "perl", expression: "(pkgs.perl.withPackages (ps: [ ps.Moose ]))"},
+		{attr: "rubyPackages_3_3.rails", ok: true, interpreter: "ruby_3_3", expression: "(pkgs.ruby_3_3.withPackages (ps: [ ps.rails ]))"},
+		{attr: "haskellPackages.lens", ok: true, interpreter: "ghc", expression: "(pkgs.haskellPackages.ghcWithPackages (ps: [ ps.lens ]))"},
+		{attr: "vimPlugins.telescope-nvim", ok: true, interpreter: "neovim", expression: "(pkgs.neovim.override { configure.packages.pam.start = [ pkgs.vimPlugins.telescope-nvim ]; })"},
+		{attr: "nodePackages.prettier"},
+		{attr: "firefox"},
+		{attr: "haskell.packages.ghc96.lens"},
+	}
+	for _, tt := range tests {
+		w, ok := Detect(tt.attr)
+		if ok != tt.ok {
+			t.Errorf("Detect(%q) ok = %v, want %v", tt.attr, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got := Interpreter(w); got != tt.interpreter {
+			t.Errorf("Interpreter(%q) = %q, want %q", tt.attr, got, tt.interpreter)
+		}
+		if got := Expression(w); got != tt.expression {
+			t.Errorf("Expression(%q) = %q, want %q", tt.attr, got, tt.expression)
+		}
+	}
+}
+
+func TestDevShell(t *testing.T) {
+	for attr, want := range map[string]bool{"nodePackages.prettier": true, "nodePackages_latest.eslint": true, "python3Packages.numpy": false, "nodejs": false} {
+		if got := DevShell(attr); got != want {
+			t.Errorf("DevShell(%q) = %v, want %v", attr, got, want)
+		}
+	}
+}
+
+func TestFormatAndParse(t *testing.T) {
+	w := Merge(types.Wrapper{Set: "python311Packages", Packages: []string{"numpy"}}, types.Wrapper{Set: "python311Packages", Packages: []string{"pandas", "numpy"}})
+	if !reflect.DeepEqual(w.Packages, []string{"numpy", "pandas"}) {
+		t.Errorf("Merge() = %v, want numpy and pandas once", w.Packages)
+	}
+	formatted := Format(w)
+	if formatted != "python311Packages.numpy,python311Packages.pandas" {
+		t.Errorf("Format() = %q", formatted)
+	}
+	parsed, ok := Parse(formatted)
+	if !ok || !reflect.DeepEqual(parsed, w) {
+		t.Errorf("Parse(%q) = %+v, %v, want %+v", formatted, parsed, ok, w)
+	}
+	for _, value := range []string{"", "firefox", "python311Packages.numpy,perlPackages.Moose"} {
+		if _, ok := Parse(value); ok {
+			t.Errorf("Parse(%q) should fail", value)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	pkg := types.Package{PName: "python3", FullPath: "python311", Version: "3.11.9", System: "x86_64-linux"}
+	Apply(&pkg, types.Wrapper{Set: "python311Packages", Packages: []string{"numpy", "pandas"}})
+	if pkg.PName != "python311-env" || pkg.FullPath != "python311" || pkg.Description != "python311 with numpy, pandas" || pkg.Wrapper == nil {
+		t.Errorf("Apply() = %+v", pkg)
+	}
+}